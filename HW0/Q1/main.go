@@ -0,0 +1,11 @@
+// Command hw0 runs "oslabs hw0" on its own; the code is in package
+// labs/hw0.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/hw0"
+)
+
+func main() { hw0.Main(os.Args[1:]) }
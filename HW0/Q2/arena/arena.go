@@ -0,0 +1,106 @@
+// Package arena is a stack (LIFO) allocator built on the HW0 stack: one
+// fixed byte buffer handed out with a bump pointer, and a stack.Stack of
+// the offsets where live allocations start. Blocks are freed in reverse
+// order of allocation, either one at a time with Free or all at once back
+// to a Mark. Nothing is ever garbage collected, so short-lived scratch
+// space costs a pointer bump instead of a heap allocation.
+package arena
+
+import (
+	"errors"
+
+	"example.com/operating-systems/HW0/Q2/stack"
+)
+
+var (
+	// ErrOutOfMemory is returned by Alloc when the arena can't fit the block.
+	ErrOutOfMemory = errors.New("arena: out of memory")
+	// ErrBadSize is returned by Alloc for sizes below 1.
+	ErrBadSize = errors.New("arena: allocation size must be positive")
+	// ErrNotTop is returned by Free for a block that isn't the latest allocation.
+	ErrNotTop = errors.New("arena: free out of LIFO order")
+	// ErrBadMark is returned by Release for a mark that is already released.
+	ErrBadMark = errors.New("arena: mark is above the current top")
+)
+
+// align is the alignment of every block.
+const align = 8
+
+// Arena hands out blocks of one buffer in LIFO order.
+type Arena struct {
+	buf    []byte
+	off    int          // next free byte
+	starts *stack.Stack // start offset of every live block, newest on top
+}
+
+// Mark is a point to Release back to.
+type Mark struct {
+	depth int // live blocks at the time of the mark
+	off   int
+}
+
+// New returns an arena of size bytes.
+func New(size int) *Arena {
+	return &Arena{buf: make([]byte, size), starts: stack.New()}
+}
+
+// Alloc returns a zeroed block of n bytes.
+func (a *Arena) Alloc(n int) ([]byte, error) {
+	if n < 1 {
+		return nil, ErrBadSize
+	}
+	end := a.off + (n+align-1)&^(align-1)
+	if end > len(a.buf) {
+		return nil, ErrOutOfMemory
+	}
+	if err := a.starts.Push(a.off); err != nil {
+		return nil, err
+	}
+	b := a.buf[a.off : a.off+n : a.off+n] // capped, so append can't spill into the next block
+	clear(b)
+	a.off = end
+	return b, nil
+}
+
+// Free releases b, which must be the most recent live allocation.
+func (a *Arena) Free(b []byte) error {
+	start, err := a.starts.Peek()
+	if err != nil || len(b) == 0 || &a.buf[start] != &b[0] {
+		return ErrNotTop
+	}
+	_, _ = a.starts.Pop()
+	a.off = start
+	return nil
+}
+
+// Mark records the current top; Release(m) frees everything allocated since.
+func (a *Arena) Mark() Mark {
+	return Mark{depth: a.starts.Len(), off: a.off}
+}
+
+// Release frees every block allocated after m was taken.
+func (a *Arena) Release(m Mark) error {
+	if m.depth > a.starts.Len() || m.off > a.off {
+		return ErrBadMark
+	}
+	for a.starts.Len() > m.depth {
+		_, _ = a.starts.Pop()
+	}
+	a.off = m.off
+	return nil
+}
+
+// Reset frees every block.
+func (a *Arena) Reset() {
+	_ = a.Release(Mark{})
+}
+
+// Used returns the bytes currently allocated (including alignment padding).
+func (a *Arena) Used() int {
+	return a.off
+}
+
+// Live returns the number of blocks currently allocated.
+func (a *Arena) Live() int {
+	return a.starts.Len()
+}
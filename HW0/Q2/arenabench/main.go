@@ -0,0 +1,11 @@
+// Command arenabench runs "oslabs arenabench" on its own; the code is in package
+// labs/arenabench.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/arenabench"
+)
+
+func main() { arenabench.Main(os.Args[1:]) }
@@ -0,0 +1,364 @@
+// Package freelist is a malloc-style allocator over one fixed byte buffer,
+// kept the way OSTEP's free-space chapter describes: every block starts
+// with an 8-byte header inside the buffer, and the free blocks form a list
+// threaded through their own headers, sorted by address. Alloc searches
+// the list with a fit policy (first, best, worst, or next fit) and splits
+// the block it picks; Free puts the block back and coalesces it with free
+// neighbours, so blocks can be freed in any order (unlike package arena).
+package freelist
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+var (
+	// ErrOutOfMemory is returned by Alloc when no free block is big enough.
+	ErrOutOfMemory = errors.New("freelist: out of memory")
+	// ErrBadSize is returned by Alloc for sizes below 1.
+	ErrBadSize = errors.New("freelist: allocation size must be positive")
+	// ErrBadFree is returned by Free for a block this allocator didn't hand
+	// out, or one already freed.
+	ErrBadFree = errors.New("freelist: not an allocated block (double free?)")
+)
+
+// Fit is the policy Alloc uses to pick a free block.
+type Fit int
+
+const (
+	FirstFit Fit = iota // the first block big enough, from the start of the list
+	BestFit             // the smallest block big enough
+	WorstFit            // the largest block
+	NextFit             // first fit, starting where the last search stopped
+)
+
+// Fits lists every policy.
+var Fits = []Fit{FirstFit, BestFit, WorstFit, NextFit}
+
+func (f Fit) String() string {
+	switch f {
+	case FirstFit:
+		return "first"
+	case BestFit:
+		return "best"
+	case WorstFit:
+		return "worst"
+	case NextFit:
+		return "next"
+	}
+	return fmt.Sprintf("Fit(%d)", int(f))
+}
+
+// ParseFit parses "first", "best", "worst", or "next".
+func ParseFit(s string) (Fit, error) {
+	for _, f := range Fits {
+		if s == f.String() {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown fit %q (use first, best, worst, or next)", s)
+}
+
+const (
+	align      = 8          // every block starts and ends 8-byte aligned
+	headerSize = 8          // block size, then the magic number or the next free block
+	magic      = 1234567    // marks an allocated block, as in OSTEP
+	none       = 0xFFFFFFFF // end of the free list
+	minBlock   = headerSize + align
+)
+
+// Allocator hands out blocks of one buffer. It is not safe for concurrent use.
+type Allocator struct {
+	buf   []byte
+	fit   Fit
+	head  uint32 // first free block, or none
+	rover uint32 // next fit: where the next search starts
+	live  int    // allocated blocks
+	asked int    // bytes asked for by the live blocks
+	used  int    // bytes in live blocks, headers and padding included
+
+	searches, examined int // Alloc calls and free blocks looked at
+}
+
+// New returns an allocator over size bytes (rounded down to a multiple
+// of 8, at most 4 GiB) using fit.
+func New(size int, fit Fit) *Allocator {
+	size = int(min(int64(size), 1<<32-align)) &^ (align - 1) // int64: 1<<32 overflows a 32-bit int
+	a := &Allocator{buf: make([]byte, size), fit: fit, head: none, rover: none}
+	if size >= minBlock {
+		a.setFree(0, uint32(size), none)
+		a.head, a.rover = 0, 0
+	}
+	return a
+}
+
+// Header fields, little endian: a block's size (header included) and,
+// for a free block, the offset of the next one, for an allocated one magic.
+func (a *Allocator) size(off uint32) uint32 { return binary.LittleEndian.Uint32(a.buf[off:]) }
+func (a *Allocator) next(off uint32) uint32 { return binary.LittleEndian.Uint32(a.buf[off+4:]) }
+func (a *Allocator) setNext(off, next uint32) {
+	binary.LittleEndian.PutUint32(a.buf[off+4:], next)
+}
+func (a *Allocator) setFree(off, size, next uint32) {
+	binary.LittleEndian.PutUint32(a.buf[off:], size)
+	a.setNext(off, next)
+}
+
+// Alloc returns a zeroed block of n bytes.
+func (a *Allocator) Alloc(n int) ([]byte, error) {
+	if n < 1 {
+		return nil, ErrBadSize
+	}
+	if n > len(a.buf) {
+		return nil, ErrOutOfMemory
+	}
+	need := uint32(headerSize + (n+align-1)&^(align-1))
+	a.searches++
+	prev, off := a.find(need)
+	if off == none {
+		return nil, ErrOutOfMemory
+	}
+
+	// Split off the tail if it can hold a block of its own; otherwise the
+	// whole block goes, the slack becoming internal fragmentation
+	size, rest := a.size(off), a.next(off)
+	if size-need >= minBlock {
+		a.setFree(off+need, size-need, rest)
+		rest, size = off+need, need
+	}
+	if prev == none {
+		a.head = rest
+	} else {
+		a.setNext(prev, rest)
+	}
+	a.rover = rest
+	if a.rover == none {
+		a.rover = a.head
+	}
+
+	binary.LittleEndian.PutUint32(a.buf[off:], size)
+	binary.LittleEndian.PutUint32(a.buf[off+4:], magic)
+	a.live++
+	a.asked += n
+	a.used += int(size)
+	b := a.buf[off+headerSize : off+headerSize+uint32(n) : off+headerSize+uint32(n)] // capped, so append can't spill
+	clear(b)
+	return b, nil
+}
+
+// find returns the free block of at least need bytes the policy picks, and
+// the free block before it in the list (none if it is the head).
+func (a *Allocator) find(need uint32) (prev, off uint32) {
+	prev, off = none, none
+	if a.fit == NextFit {
+		return a.findNext(need)
+	}
+	p := uint32(none)
+	for b := a.head; b != none; p, b = b, a.next(b) {
+		a.examined++
+		s := a.size(b)
+		if s < need {
+			continue
+		}
+		switch {
+		case off == none,
+			a.fit == BestFit && s < a.size(off),
+			a.fit == WorstFit && s > a.size(off):
+			prev, off = p, b
+		}
+		if a.fit == FirstFit || (a.fit == BestFit && s == need) {
+			break
+		}
+	}
+	return prev, off
+}
+
+// findNext is first fit starting at the rover and wrapping around once.
+func (a *Allocator) findNext(need uint32) (prev, off uint32) {
+	if a.head == none {
+		return none, none
+	}
+	// The list is singly linked, so find the rover's predecessor first
+	p := uint32(none)
+	for b := a.head; b != a.rover && b != none; p, b = b, a.next(b) {
+	}
+	b := a.rover
+	for {
+		a.examined++
+		if a.size(b) >= need {
+			return p, b
+		}
+		p, b = b, a.next(b)
+		if b == none {
+			p, b = none, a.head
+		}
+		if b == a.rover {
+			return none, none
+		}
+	}
+}
+
+// Free returns b, a block from Alloc, to the free list, merging it with
+// the free blocks right before and after it.
+func (a *Allocator) Free(b []byte) error {
+	if len(b) == 0 || len(a.buf) == 0 {
+		return ErrBadFree
+	}
+	base := uintptr(unsafe.Pointer(&a.buf[0]))
+	at := uintptr(unsafe.Pointer(&b[0]))
+	if at < base+headerSize || at >= base+uintptr(len(a.buf)) || (at-base)%align != 0 {
+		return ErrBadFree
+	}
+	off := uint32(at-base) - headerSize
+	size := a.size(off)
+	if a.next(off) != magic || size < minBlock || off+size > uint32(len(a.buf)) || len(b) > int(size-headerSize) {
+		return ErrBadFree
+	}
+	a.live--
+	a.asked -= len(b)
+	a.used -= int(size)
+
+	// Find the neighbours in the address-sorted list
+	prev, next := uint32(none), a.head
+	for next != none && next < off {
+		prev, next = next, a.next(next)
+	}
+	a.setFree(off, size, next)
+	if next != none && off+size == next {
+		a.setFree(off, size+a.size(next), a.next(next))
+		if a.rover == next {
+			a.rover = off
+		}
+	}
+	if prev == none {
+		a.head = off
+	} else if prev+a.size(prev) == off {
+		a.setFree(prev, a.size(prev)+a.size(off), a.next(off))
+		if a.rover == off {
+			a.rover = prev
+		}
+	} else {
+		a.setNext(prev, off)
+	}
+	if a.rover == none {
+		a.rover = a.head
+	}
+	return nil
+}
+
+// Block is one block of the buffer, as Blocks reports it.
+type Block struct {
+	Off, Size int // header included
+	Free      bool
+}
+
+// Blocks walks the whole buffer, block by block.
+func (a *Allocator) Blocks() []Block {
+	var out []Block
+	nextFree := a.head
+	for off := uint32(0); off+minBlock <= uint32(len(a.buf)); {
+		s := a.size(off)
+		if s < minBlock {
+			break // corrupt; Check says more
+		}
+		free := off == nextFree
+		if free {
+			nextFree = a.next(off)
+		}
+		out = append(out, Block{Off: int(off), Size: int(s), Free: free})
+		off += s
+	}
+	return out
+}
+
+// Check verifies the heap: blocks tile the buffer exactly, allocated ones
+// carry the magic number, the free list is sorted by address, and no two
+// free blocks are adjacent (they would have been coalesced).
+func (a *Allocator) Check() error {
+	blocks := a.Blocks()
+	total, live, used := 0, 0, 0
+	for i, b := range blocks {
+		total += b.Size
+		if b.Free {
+			if i > 0 && blocks[i-1].Free {
+				return fmt.Errorf("freelist: free blocks at %d and %d were not coalesced", blocks[i-1].Off, b.Off)
+			}
+			continue
+		}
+		if a.next(uint32(b.Off)) != magic {
+			return fmt.Errorf("freelist: block at %d is neither free nor allocated", b.Off)
+		}
+		live++
+		used += b.Size
+	}
+	if total != len(a.buf) {
+		return fmt.Errorf("freelist: blocks cover %d of %d bytes", total, len(a.buf))
+	}
+	free := 0
+	for b := a.head; b != none; b = a.next(b) {
+		free++
+	}
+	if n := len(blocks) - live; free != n {
+		return fmt.Errorf("freelist: %d blocks on the free list, %d free blocks in the heap", free, n)
+	}
+	if live != a.live || used != a.used {
+		return fmt.Errorf("freelist: %d live blocks (%d bytes), counted %d (%d bytes)", live, used, a.live, a.used)
+	}
+	return nil
+}
+
+// Stats describes the heap.
+type Stats struct {
+	Size       int // the buffer
+	Live       int // allocated blocks
+	Asked      int // bytes asked for by the live blocks
+	Used       int // bytes in live blocks, headers and padding included
+	Free       int // bytes in free blocks
+	FreeBlocks int
+	Largest    int // the largest free block
+
+	Searches, Examined int // Alloc calls, and free blocks they looked at
+}
+
+// Stats reports the heap's state now.
+func (a *Allocator) Stats() Stats {
+	s := Stats{Size: len(a.buf), Live: a.live, Asked: a.asked, Used: a.used, Searches: a.searches, Examined: a.examined}
+	for b := a.head; b != none; b = a.next(b) {
+		size := int(a.size(b))
+		s.Free += size
+		s.FreeBlocks++
+		s.Largest = max(s.Largest, size)
+	}
+	return s
+}
+
+// External is the share of free memory outside the largest free block:
+// 0 when it is all in one piece, near 1 when it is in slivers.
+func (s Stats) External() float64 {
+	if s.Free == 0 {
+		return 0
+	}
+	return 1 - float64(s.Largest)/float64(s.Free)
+}
+
+// Internal is the share of the live blocks' bytes lost to headers,
+// rounding, and unsplit slack.
+func (s Stats) Internal() float64 {
+	if s.Used == 0 {
+		return 0
+	}
+	return 1 - float64(s.Asked)/float64(s.Used)
+}
+
+// String draws the free list, OSTEP style: [ addr:off sz:size ] -> ...
+func (a *Allocator) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Free List [ Size %d ]:", a.Stats().FreeBlocks)
+	for f := a.head; f != none; f = a.next(f) {
+		fmt.Fprintf(&b, " [ addr:%d sz:%d ]", f, a.size(f))
+	}
+	return b.String()
+}
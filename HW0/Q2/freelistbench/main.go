@@ -0,0 +1,11 @@
+// Command freelistbench runs "oslabs freelistbench" on its own; the code is in package
+// labs/freelistbench.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/freelistbench"
+)
+
+func main() { freelistbench.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command stackdemo runs "oslabs stackdemo" on its own; the code is in package
+// labs/stackdemo.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/stackdemo"
+)
+
+func main() { stackdemo.Main(os.Args[1:]) }
@@ -0,0 +1,159 @@
+package stack
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"example.com/operating-systems/hazard"
+)
+
+// Concurrent is a stack that many goroutines can use at once.
+type Concurrent interface {
+	Push(value int) error
+	Pop() (int, error)
+}
+
+// Locked is a Stack behind a single mutex: every Push and Pop serializes on it.
+type Locked struct {
+	mu sync.Mutex
+	s  Stack
+}
+
+// NewLocked returns an empty, unbounded mutex-protected stack.
+func NewLocked() *Locked {
+	return &Locked{}
+}
+
+func (l *Locked) Push(value int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.s.Push(value)
+}
+
+func (l *Locked) Pop() (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.s.Pop()
+}
+
+type tNode struct {
+	val  int
+	next *tNode
+}
+
+// Treiber is the classic lock-free stack. The top is an atomic pointer;
+// Push and Pop read it, build the new top, and CompareAndSwap it in,
+// retrying when another goroutine got there first. Every Push allocates a
+// fresh node and the GC keeps popped nodes alive while anyone still holds
+// them, so the ABA problem can't happen here.
+type Treiber struct {
+	top     atomic.Pointer[tNode]
+	retries atomic.Uint64 // failed CAS attempts, for the benchmark
+}
+
+// NewTreiber returns an empty lock-free stack.
+func NewTreiber() *Treiber {
+	return &Treiber{}
+}
+
+// Push never fails; the error is there to satisfy Concurrent.
+func (t *Treiber) Push(value int) error {
+	n := &tNode{val: value}
+	for {
+		top := t.top.Load()
+		n.next = top
+		if t.top.CompareAndSwap(top, n) {
+			return nil
+		}
+		t.retries.Add(1)
+		runtime.Gosched()
+	}
+}
+
+func (t *Treiber) Pop() (int, error) {
+	for {
+		top := t.top.Load()
+		if top == nil {
+			return 0, ErrEmpty
+		}
+		if t.top.CompareAndSwap(top, top.next) {
+			return top.val, nil
+		}
+		t.retries.Add(1)
+		runtime.Gosched()
+	}
+}
+
+// Retries returns how many CAS attempts have failed so far. The counter is
+// only touched on a failed CAS, so it adds nothing to uncontended operations.
+func (t *Treiber) Retries() uint64 {
+	return t.retries.Load()
+}
+
+// TreiberHazard is the Treiber stack recycling its nodes: a popped node
+// is retired to a hazard-pointer domain and reused by later pushes once
+// no Pop can still be reading it. Reuse is what makes ABA possible: a
+// Pop that read top A and A.next, then lost the CPU while A was popped,
+// reused and pushed again, would CAS A back out with a stale next.
+// Protecting top with a hazard pointer keeps A from being reused under
+// it; with hazard.Config.Unsafe it isn't, and the stack can lose or
+// duplicate values.
+type TreiberHazard struct {
+	top     atomic.Pointer[tNode]
+	d       *hazard.Domain[tNode]
+	retries atomic.Uint64
+}
+
+// NewTreiberHazard returns an empty lock-free stack whose nodes are
+// reclaimed by a domain configured by c.
+func NewTreiberHazard(c hazard.Config) (*TreiberHazard, error) {
+	d, err := hazard.NewDomain[tNode](c)
+	if err != nil {
+		return nil, err
+	}
+	return &TreiberHazard{d: d}, nil
+}
+
+// Push never fails; the error is there to satisfy Concurrent.
+func (t *TreiberHazard) Push(value int) error {
+	r := t.d.Acquire()
+	defer r.Release()
+	n := r.New()
+	n.val = value
+	for {
+		top := t.top.Load()
+		n.next = top
+		if t.top.CompareAndSwap(top, n) {
+			return nil
+		}
+		t.retries.Add(1)
+		runtime.Gosched()
+	}
+}
+
+func (t *TreiberHazard) Pop() (int, error) {
+	r := t.d.Acquire()
+	defer r.Release()
+	for {
+		top := r.Protect(0, &t.top)
+		if top == nil {
+			return 0, ErrEmpty
+		}
+		if t.top.CompareAndSwap(top, top.next) {
+			v := top.val
+			r.Retire(top)
+			return v, nil
+		}
+		t.retries.Add(1)
+		runtime.Gosched()
+	}
+}
+
+// Retries returns how many CAS attempts have failed so far.
+func (t *TreiberHazard) Retries() uint64 {
+	return t.retries.Load()
+}
+
+// Domain returns the stack's hazard-pointer domain, for its Stats.
+func (t *TreiberHazard) Domain() *hazard.Domain[tNode] { return t.d }
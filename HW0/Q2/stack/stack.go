@@ -0,0 +1,71 @@
+// Package stack is the HW0 Q2 stack as a library type: backed by a slice
+// that grows (and shrinks) as needed, with overflow and underflow reported
+// as errors instead of printed.
+package stack
+
+import "errors"
+
+var (
+	// ErrEmpty is returned by Pop and Peek on an empty stack.
+	ErrEmpty = errors.New("stack underflow: stack is empty")
+	// ErrFull is returned by Push on a bounded stack that is at its limit.
+	ErrFull = errors.New("stack overflow: stack is full")
+)
+
+// minCap is the smallest backing array the stack shrinks back to.
+const minCap = 16
+
+// Stack is a LIFO stack of ints. The zero value is an empty, unbounded stack.
+type Stack struct {
+	items []int
+	limit int // maximum size; 0 = unbounded
+}
+
+// New returns an empty stack that grows without limit.
+func New() *Stack {
+	return &Stack{}
+}
+
+// NewBounded returns an empty stack that holds at most limit values
+// (limit <= 0 means unbounded), like the original fixed array of 100.
+func NewBounded(limit int) *Stack {
+	return &Stack{limit: max(limit, 0)}
+}
+
+// Push adds value to the top of the stack.
+func (s *Stack) Push(value int) error {
+	if s.limit > 0 && len(s.items) >= s.limit {
+		return ErrFull
+	}
+	s.items = append(s.items, value) // append doubles the array when it's full
+	return nil
+}
+
+// Pop removes and returns the top value.
+func (s *Stack) Pop() (int, error) {
+	if len(s.items) == 0 {
+		return 0, ErrEmpty
+	}
+	top := len(s.items) - 1
+	val := s.items[top]
+	s.items = s.items[:top]
+
+	// Give memory back once the stack is down to a quarter of its array
+	if c := cap(s.items); c > minCap && len(s.items) <= c/4 {
+		s.items = append(make([]int, 0, c/2), s.items...)
+	}
+	return val, nil
+}
+
+// Peek returns the top value without removing it.
+func (s *Stack) Peek() (int, error) {
+	if len(s.items) == 0 {
+		return 0, ErrEmpty
+	}
+	return s.items[len(s.items)-1], nil
+}
+
+// Len returns the number of values on the stack.
+func (s *Stack) Len() int {
+	return len(s.items)
+}
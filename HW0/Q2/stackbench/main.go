@@ -0,0 +1,11 @@
+// Command stackbench runs "oslabs stackbench" on its own; the code is in package
+// labs/stackbench.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/stackbench"
+)
+
+func main() { stackbench.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command prodcons runs "oslabs prodcons" on its own; the code is in package
+// labs/prodcons.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/prodcons"
+)
+
+func main() { prodcons.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command locks runs "oslabs locks" on its own; the code is in package
+// labs/locks.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/locks"
+)
+
+func main() { locks.Main(os.Args[1:]) }
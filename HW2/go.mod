@@ -1,3 +0,0 @@
-module locks-bench
-
-go 1.25.1
@@ -0,0 +1,11 @@
+// Command lists runs "oslabs lists" on its own; the code is in package
+// labs/lists.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/lists"
+)
+
+func main() { lists.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command queues runs "oslabs queues" on its own; the code is in package
+// labs/queues.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/queues"
+)
+
+func main() { queues.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command raidbench runs "oslabs raidbench" on its own; the code is in package
+// labs/raidbench.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/raidbench"
+)
+
+func main() { raidbench.Main(os.Args[1:]) }
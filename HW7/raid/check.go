@@ -0,0 +1,75 @@
+package raid
+
+import (
+    "bytes"
+    "fmt"
+)
+
+// Check verifies the redundancy of an array that nothing is writing to:
+// that every mirror of a RAID 1 holds the same blocks, and that every
+// stripe's parity in a RAID 4 or 5 is the XOR of its data. RAID 0 has
+// nothing to check.
+func Check(r RAID) error {
+    switch r := r.(type) {
+    case *RAID0:
+        return nil
+    case *RAID1:
+        return checkMirrors(r.disks)
+    case *RAID4:
+        return checkParity(append(append([]*Disk(nil), r.dataDisks...), r.parity), func(int) int { return len(r.dataDisks) })
+    case *RAID5:
+        return checkParity(r.disks, func(stripe int) int { return stripe % len(r.disks) })
+    }
+    return fmt.Errorf("raid: cannot check a %T", r)
+}
+
+// stripes returns how many blocks the largest of disks holds.
+func stripes(disks []*Disk) (int, error) {
+    n := 0
+    for _, d := range disks {
+        b, err := d.Blocks()
+        if err != nil { return 0, err }
+        n = max(n, b)
+    }
+    return n, nil
+}
+
+func checkMirrors(disks []*Disk) error {
+    n, err := stripes(disks)
+    if err != nil { return err }
+    for b := 0; b < n; b++ {
+        first, err := disks[0].ReadBlock(b)
+        if err != nil { return err }
+        for i, d := range disks[1:] {
+            other, err := d.ReadBlock(b)
+            if err != nil { return err }
+            if !bytes.Equal(first, other) {
+                return fmt.Errorf("raid: block %d differs between mirrors 0 and %d", b, i+1)
+            }
+        }
+    }
+    return nil
+}
+
+// checkParity checks each stripe of disks, whose parity is on disk
+// parityDisk(stripe).
+func checkParity(disks []*Disk, parityDisk func(stripe int) int) error {
+    n, err := stripes(disks)
+    if err != nil { return err }
+    for s := 0; s < n; s++ {
+        p := parityDisk(s)
+        want := make([]byte, BlockSize)
+        for i, d := range disks {
+            if i == p { continue }
+            b, err := d.ReadBlock(s)
+            if err != nil { return err }
+            want = xorBlocks(want, b)
+        }
+        got, err := disks[p].ReadBlock(s)
+        if err != nil { return err }
+        if !bytes.Equal(got, want) {
+            return fmt.Errorf("raid: stripe %d: parity on disk %d is not the XOR of its data", s, p)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,80 @@
+package raid
+
+import (
+    "errors"
+    "io"
+    "os"
+
+    "example.com/operating-systems/internal/fsio"
+)
+
+const BlockSize = 4096
+
+// DiskOptions says how a disk file is opened and made durable.
+type DiskOptions struct {
+    Sync        fsio.SyncMode // after every block written; fsio.Full by default
+    Direct      bool          // bypass the page cache
+    Preallocate int           // blocks to reserve space for when opening
+}
+
+// Disk is a file of blocks. Reads and writes are positional (no shared
+// file offset), so goroutines can use a disk at once.
+type Disk struct {
+    f    *os.File
+    opts DiskOptions
+}
+
+// OpenDisk opens a disk file that syncs every block it writes in full.
+func OpenDisk(filename string) (*Disk, error) {
+    return OpenDiskWith(filename, DiskOptions{})
+}
+
+// OpenDiskWith opens a disk file as o says.
+func OpenDiskWith(filename string, o DiskOptions) (*Disk, error) {
+    open := os.OpenFile
+    if o.Direct { open = fsio.OpenDirect }
+    f, err := open(filename, os.O_RDWR|os.O_CREATE, 0666)
+    if err != nil { return nil, err }
+    if o.Preallocate > 0 {
+        if err := fsio.Preallocate(f, int64(o.Preallocate)*BlockSize); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+            f.Close()
+            return nil, err
+        }
+    }
+    return &Disk{f, o}, nil
+}
+
+func (d *Disk) WriteBlock(block int, data []byte) error {
+    if d.opts.Direct && !fsio.IsAligned(data) {
+        buf := fsio.AlignedBlock(BlockSize)
+        copy(buf, data)
+        data = buf
+    }
+    _, err := d.f.WriteAt(data, int64(block*BlockSize))
+    if err != nil { return err }
+    return fsio.Sync(d.f, d.opts.Sync)
+}
+
+// ReadBlock reads a block; past the end of the file, a block is zeros.
+func (d *Disk) ReadBlock(block int) ([]byte, error) {
+    var buf []byte
+    if d.opts.Direct {
+        buf = fsio.AlignedBlock(BlockSize)
+    } else {
+        buf = make([]byte, BlockSize)
+    }
+    _, err := d.f.ReadAt(buf, int64(block*BlockSize))
+    if errors.Is(err, io.EOF) { err = nil }
+    return buf, err
+}
+
+// Blocks returns how many blocks the disk holds, counting a partial one.
+func (d *Disk) Blocks() (int, error) {
+    fi, err := d.f.Stat()
+    if err != nil { return 0, err }
+    return int((fi.Size() + BlockSize - 1) / BlockSize), nil
+}
+
+func (d *Disk) Close() error {
+    return d.f.Close()
+}
@@ -2,13 +2,15 @@ package raid
 
 type RAID1 struct {
     disks []*Disk
+    locks stripeLocks
 }
 
 func NewRAID1(disks []*Disk) *RAID1 {
-    return &RAID1{disks}
+    return &RAID1{disks: disks}
 }
 
 func (r *RAID1) Write(block int, data []byte) error {
+    defer r.locks.lock(block).Unlock()
     for _, d := range r.disks {
         if err := d.WriteBlock(block, data); err != nil { return err }
     }
@@ -9,6 +9,7 @@ func xorBlocks(a, b []byte) []byte {
 type RAID4 struct {
     dataDisks []*Disk
     parity    *Disk
+    locks     stripeLocks
 }
 
 func NewRAID4(disks []*Disk) *RAID4 {
@@ -21,6 +22,7 @@ func NewRAID4(disks []*Disk) *RAID4 {
 func (r *RAID4) Write(block int, data []byte) error {
     stripeDisk := block % len(r.dataDisks)
     offset := block / len(r.dataDisks)
+    defer r.locks.lock(offset).Unlock()
 
     // Write data
     if err := r.dataDisks[stripeDisk].WriteBlock(offset, data); err != nil {
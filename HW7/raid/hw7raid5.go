@@ -2,10 +2,11 @@ package raid
 
 type RAID5 struct {
     disks []*Disk
+    locks stripeLocks
 }
 
 func NewRAID5(disks []*Disk) *RAID5 {
-    return &RAID5{disks}
+    return &RAID5{disks: disks}
 }
 
 func (r *RAID5) Write(block int, data []byte) error {
@@ -14,6 +15,7 @@ func (r *RAID5) Write(block int, data []byte) error {
     pos := block % (n - 1)
 
     parityDisk := stripe % n
+    defer r.locks.lock(stripe).Unlock()
 
     dataDiskIndex := 0
     for i := 0; i < n; i++ {
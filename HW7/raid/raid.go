@@ -0,0 +1,22 @@
+package raid
+
+import "sync"
+
+// RAID is implemented by every RAID level.
+type RAID interface {
+    Write(blockNum int, data []byte) error
+    Read(blockNum int) ([]byte, error)
+}
+
+// stripeLocks serializes writes to a stripe, so that the mirrors of a
+// block (RAID 1) or a stripe and its parity (RAID 4 and 5) are updated
+// as one: two writers in the same stripe would otherwise each compute
+// parity from a mix of old and new data. Stripes share a fixed number of
+// locks, so writes to different stripes rarely wait on each other.
+type stripeLocks [64]sync.Mutex
+
+func (l *stripeLocks) lock(stripe int) *sync.Mutex {
+    m := &l[stripe%len(l)]
+    m.Lock()
+    return m
+}
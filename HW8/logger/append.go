@@ -0,0 +1,136 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"example.com/operating-systems/internal/fsio"
+)
+
+// Append Logger
+// Opens the file O_APPEND, without truncating it, and writes each entry
+// with one write(2) of the whole encoded entry, unbuffered. The kernel
+// moves the offset to the end and writes there as one step, so whole
+// entries from any number of goroutines, or processes, sharing the file
+// land one after another and never over or inside each other; there is
+// no lock to take. Batching: fsync every batchN entries, counted across
+// the goroutines of this process. There is no rotation or compression:
+// another process may be writing the file.
+type AppendLogger struct {
+	levelFilter
+	f      *os.File
+	enc    Encoder
+	opts   Options
+	batchN int64
+	count  atomic.Int64
+	health // for Stats
+
+	errMu   sync.Mutex
+	lastErr error // the first error, for every later Log to return
+}
+
+func NewAppendLogger(path string, batchN int) (*AppendLogger, error) {
+	return NewAppendLoggerWith(path, batchN, Options{})
+}
+
+// NewAppendLoggerWith opens path for appending, creating it if need be;
+// o's Rotation and Compress are ignored.
+func NewAppendLoggerWith(path string, batchN int, o Options) (*AppendLogger, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if batchN <= 0 {
+		batchN = 1
+	}
+	enc := o.Encoder
+	if enc == nil {
+		enc = Text
+	}
+	l := &AppendLogger{f: f, enc: enc, opts: o, batchN: int64(batchN)}
+	l.onError = o.OnError
+	l.SetLevel(o.MinLevel)
+	return l, nil
+}
+
+func (l *AppendLogger) setErr(err error) {
+	l.fail(err)
+	l.errMu.Lock()
+	defer l.errMu.Unlock()
+	if l.lastErr == nil {
+		l.lastErr = err
+	}
+}
+
+func (l *AppendLogger) getErr() error {
+	l.errMu.Lock()
+	defer l.errMu.Unlock()
+	return l.lastErr
+}
+
+func (l *AppendLogger) Log(entry LogEntry) error {
+	if l.drop(entry) {
+		return nil
+	}
+	if err := l.getErr(); err != nil {
+		return err
+	}
+	// One write of the whole entry: the file offset is the kernel's.
+	n, err := l.f.WriteString(l.enc.Encode(entry))
+	if err != nil {
+		l.setErr(err)
+		return err
+	}
+	l.wrote(n)
+	if l.count.Add(1)%l.batchN == 0 {
+		return l.sync()
+	}
+	return nil
+}
+
+func (l *AppendLogger) sync() error {
+	if err := fsio.Sync(l.f, l.opts.Sync); err != nil {
+		l.setErr(err)
+		return err
+	}
+	if l.opts.Sync != fsio.None {
+		l.syncs.Add(1)
+	}
+	return nil
+}
+
+// LogCtx logs entry unless ctx has ended; a write waits for nothing.
+func (l *AppendLogger) LogCtx(ctx context.Context, entry LogEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.Log(entry)
+}
+
+// LogDurable logs entry and syncs the file at once.
+func (l *AppendLogger) LogDurable(entry LogEntry) <-chan error {
+	if l.drop(entry) {
+		return acked(nil)
+	}
+	if err := l.Log(entry); err != nil {
+		return acked(err)
+	}
+	return acked(l.sync())
+}
+
+// Stats reports what this process has written; entries are written in
+// Log, so none are pending.
+func (l *AppendLogger) Stats() Stats { return l.stats(0) }
+
+func (l *AppendLogger) Close() error {
+	serr := l.fail(fsio.Sync(l.f, l.opts.Sync))
+	if err := l.f.Close(); err != nil {
+		return l.fail(err)
+	}
+	if serr != nil {
+		return serr
+	}
+	return l.getErr()
+}
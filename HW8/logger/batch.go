@@ -0,0 +1,52 @@
+package logger
+
+// BatchPolicy decides how many entries a writer goroutine (ChannelLogger's,
+// RingLogger's or CombiningLogger's) writes between fsyncs. After each entry the writer
+// asks Size, passing the number of entries queued behind it. Once the
+// entries written since the last sync reach that size, the writer syncs
+// them as one batch. A policy belongs to one writer, so Options.Batch
+// makes a new one for each.
+type BatchPolicy interface {
+	Size(backlog int) int
+}
+
+// FixedBatch syncs every n entries, whatever the backlog, as batchN does.
+type FixedBatch int
+
+func (n FixedBatch) Size(backlog int) int { return max(1, int(n)) }
+
+// AdaptiveBatch sizes the batch by the backlog. While as many entries are
+// queued as the batch holds, it doubles the batch, up to Max, so a burst
+// is synced in fewer and larger fsyncs. Each time the writer finds
+// nothing queued, it halves the batch, down to Min, so a trickle is
+// synced promptly.
+type AdaptiveBatch struct {
+	Min, Max int
+	size     int
+}
+
+// NewAdaptiveBatch returns a policy between lo and hi entries a batch
+// (at least one), starting at lo.
+func NewAdaptiveBatch(lo, hi int) *AdaptiveBatch {
+	lo = max(lo, 1)
+	hi = max(hi, lo)
+	return &AdaptiveBatch{Min: lo, Max: hi, size: lo}
+}
+
+// batchPolicy returns a new policy as o says, or FixedBatch(batchN).
+func batchPolicy(o Options, batchN int) BatchPolicy {
+	if o.Batch != nil {
+		return o.Batch()
+	}
+	return FixedBatch(batchN)
+}
+
+func (a *AdaptiveBatch) Size(backlog int) int {
+	switch {
+	case backlog == 0:
+		a.size = max(a.Min, a.size/2)
+	case backlog >= a.size:
+		a.size = min(a.Max, a.size*2)
+	}
+	return a.size
+}
@@ -0,0 +1,390 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/cacheline"
+)
+
+// Combining Logger
+// Each producer goroutine registers for a Producer of its own and logs
+// through it into a ring that only it writes and only the combiner
+// reads: a single-producer, single-consumer queue, so a Log is a slot
+// write and one atomic store, with no lock and no counter another
+// producer touches. One combiner goroutine visits the rings round robin,
+// taking what each holds as it gets there, and writes those entries to
+// the file; two producers never share a cache line. A producer whose
+// ring is full waits for the combiner to come round.
+// Batching: fsync every batchN entries (or as Options.Batch says, by the
+// backlog in the ring being drained), or at the end of a pass that took
+// a durable entry, and on a ticker with a FlushInterval. A pass that
+// finds every ring empty spins a while and then sleeps until a producer
+// wakes it, as RingLogger's flusher does.
+// Log on the logger itself, for a goroutine that hasn't registered, goes
+// through one shared Producer under a mutex.
+type CombiningLogger struct {
+	levelFilter
+	lf   *logFile
+	size int // slots per producer ring
+
+	regMu     sync.Mutex
+	producers atomic.Pointer[[]*Producer] // copied on each change
+
+	sharedMu sync.Mutex
+	shared   *Producer
+
+	sleeping cacheline.Padded[atomic.Bool]
+	wake     chan struct{}
+	ticker   *time.Ticker // every FlushInterval; nil without one
+	closed   atomic.Bool
+	done     chan struct{}
+	closeErr error // closing the file's, set before done is closed
+
+	batchN  int
+	batches []int // the size of every batch synced, for BatchSizes
+}
+
+// Producer is one goroutine's handle on a CombiningLogger. Only that
+// goroutine may call it; Close it when the goroutine is done logging.
+type Producer struct {
+	l     *CombiningLogger
+	slots []combineSlot
+	mask  uint64
+
+	tail cacheline.Padded[atomic.Uint64] // next slot the producer fills
+	head cacheline.Padded[atomic.Uint64] // next slot the combiner takes
+	seen uint64                          // head as the producer last read it
+	done atomic.Bool                     // closed: drop once drained
+}
+
+// combineSlot is an entry in a producer's ring.
+type combineSlot struct {
+	entry LogEntry
+	ack   chan error // for LogDurable
+}
+
+// combineSpins is how many empty passes the combiner makes before
+// sleeping.
+const combineSpins = 64
+
+func NewCombiningLogger(path string, batchN int, size int) (*CombiningLogger, error) {
+	return NewCombiningLoggerWith(path, batchN, size, Options{})
+}
+
+// NewCombiningLoggerWith returns a combining logger whose producers each
+// get a ring of size slots, rounded up to a power of two (256 if
+// size <= 0).
+func NewCombiningLoggerWith(path string, batchN int, size int, o Options) (*CombiningLogger, error) {
+	lf, err := openLogFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+	if batchN <= 0 {
+		batchN = 1
+	}
+	if size <= 0 {
+		size = 256
+	}
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+
+	l := &CombiningLogger{
+		lf:     lf,
+		size:   n,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		batchN: batchN,
+	}
+	l.producers.Store(&[]*Producer{})
+	l.SetLevel(o.MinLevel)
+	l.shared = l.Register()
+
+	if o.FlushInterval > 0 {
+		l.ticker = time.NewTicker(o.FlushInterval)
+	}
+	go l.combiner()
+	return l, nil
+}
+
+// Register returns a new Producer for the calling goroutine.
+func (l *CombiningLogger) Register() *Producer {
+	p := &Producer{l: l, slots: make([]combineSlot, l.size), mask: uint64(l.size - 1)}
+	l.regMu.Lock()
+	defer l.regMu.Unlock()
+	old := *l.producers.Load()
+	ps := make([]*Producer, len(old), len(old)+1)
+	copy(ps, old)
+	ps = append(ps, p)
+	l.producers.Store(&ps)
+	return p
+}
+
+// unregister drops p, which is closed and drained, from the combiner's
+// rounds.
+func (l *CombiningLogger) unregister(p *Producer) {
+	l.regMu.Lock()
+	defer l.regMu.Unlock()
+	old := *l.producers.Load()
+	ps := make([]*Producer, 0, len(old))
+	for _, q := range old {
+		if q != p {
+			ps = append(ps, q)
+		}
+	}
+	l.producers.Store(&ps)
+}
+
+// Log logs entry through the shared producer, for goroutines that
+// haven't registered.
+func (l *CombiningLogger) Log(entry LogEntry) error {
+	l.sharedMu.Lock()
+	defer l.sharedMu.Unlock()
+	return l.shared.Log(entry)
+}
+
+// LogCtx logs entry through the shared producer unless ctx ends first.
+// The mutex can't be waited for with a deadline, room in the ring can.
+func (l *CombiningLogger) LogCtx(ctx context.Context, entry LogEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.sharedMu.Lock()
+	defer l.sharedMu.Unlock()
+	return l.shared.LogCtx(ctx, entry)
+}
+
+func (l *CombiningLogger) LogDurable(entry LogEntry) <-chan error {
+	l.sharedMu.Lock()
+	defer l.sharedMu.Unlock()
+	return l.shared.LogDurable(entry)
+}
+
+func (p *Producer) Log(entry LogEntry) error {
+	return p.LogCtx(context.Background(), entry)
+}
+
+// LogCtx logs entry unless ctx ends while the ring is full.
+func (p *Producer) LogCtx(ctx context.Context, entry LogEntry) error {
+	if p.l.drop(entry) {
+		return nil
+	}
+	// If the combiner hit an error, stop accepting logs
+	if err := p.l.lf.Health(); err != nil {
+		return err
+	}
+	return p.put(ctx, entry, nil)
+}
+
+func (p *Producer) LogDurable(entry LogEntry) <-chan error {
+	if p.l.drop(entry) {
+		return acked(nil)
+	}
+	if err := p.l.lf.Health(); err != nil {
+		return acked(err)
+	}
+	ack := make(chan error, 1)
+	if err := p.put(context.Background(), entry, ack); err != nil {
+		return acked(err)
+	}
+	return ack
+}
+
+// put fills the next slot with entry and publishes it, waiting while
+// the ring is full.
+func (p *Producer) put(ctx context.Context, entry LogEntry, ack chan error) error {
+	if p.l.closed.Load() || p.done.Load() {
+		return os.ErrClosed
+	}
+	n := p.tail.V.Load() // only this goroutine stores it
+	for n-p.seen == uint64(len(p.slots)) {
+		// Full as last seen: look at the combiner's progress, which is
+		// the only time a producer reads its cache line.
+		if p.seen = p.head.V.Load(); n-p.seen < uint64(len(p.slots)) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p.l.signal()
+		runtime.Gosched()
+	}
+	s := &p.slots[n&p.mask]
+	s.entry, s.ack = entry, ack
+	p.tail.V.Store(n + 1)
+	p.l.signal()
+	return nil
+}
+
+// Level and SetLevel are the logger's minimum level, which every
+// producer shares.
+func (p *Producer) Level() Level { return p.l.Level() }
+
+func (p *Producer) SetLevel(min Level) { p.l.SetLevel(min) }
+
+// Close ends the producer; the combiner still writes what it logged.
+func (p *Producer) Close() error {
+	p.done.Store(true)
+	p.l.signal()
+	return nil
+}
+
+// signal wakes the combiner if it is asleep.
+func (l *CombiningLogger) signal() {
+	if l.sleeping.V.Load() && l.sleeping.V.CompareAndSwap(true, false) {
+		select {
+		case l.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (l *CombiningLogger) combiner() {
+	defer close(l.done)
+
+	policy := batchPolicy(l.lf.opts, l.batchN)
+	pending := 0
+	var acks []chan error // waiting on the next sync
+	syncBatch := func() {
+		l.batches = append(l.batches, pending)
+		pending = 0
+		err := l.lf.sync()
+		for _, ack := range acks {
+			ack <- err
+		}
+		acks = acks[:0]
+	}
+	var tick <-chan time.Time
+	if l.ticker != nil {
+		defer l.ticker.Stop()
+		tick = l.ticker.C
+	}
+
+	for idle := 0; ; {
+		select {
+		case <-tick:
+			if pending > 0 {
+				syncBatch()
+			}
+		default:
+		}
+		closing := l.closed.Load() // read before the pass, so it sees all
+		took := 0
+		for _, p := range *l.producers.Load() {
+			done := p.done.Load() // likewise
+			head, tail := p.head.V.Load(), p.tail.V.Load()
+			for ; head != tail; head++ {
+				s := &p.slots[head&p.mask]
+				entry, ack := s.entry, s.ack
+				s.entry, s.ack = LogEntry{}, nil
+				p.head.V.Store(head + 1)
+				took++
+
+				if err := l.lf.writeEntry(entry); err != nil {
+					if ack != nil {
+						ack <- err
+					}
+					continue
+				}
+				if ack != nil {
+					acks = append(acks, ack)
+				}
+				pending++
+				if pending >= policy.Size(int(tail-head-1)) {
+					syncBatch()
+				}
+			}
+			if done && p != l.shared {
+				l.unregister(p)
+			}
+		}
+		if len(acks) > 0 {
+			syncBatch()
+		}
+		switch {
+		case took > 0:
+			idle = 0
+		case closing:
+			if pending > 0 {
+				l.batches = append(l.batches, pending) // synced by close
+			}
+			l.closeErr = l.lf.close()
+			return
+		case idle < combineSpins:
+			idle++
+			runtime.Gosched()
+		default:
+			if l.sleep(tick) && pending > 0 {
+				syncBatch()
+			}
+			idle = 0
+		}
+	}
+}
+
+// sleep waits until a producer (or Close) wakes the combiner, or tick
+// fires, which it reports.
+func (l *CombiningLogger) sleep(tick <-chan time.Time) (ticked bool) {
+	l.sleeping.V.Store(true)
+	// Look again: a producer that published before sleeping was set
+	// didn't know to wake us.
+	for _, p := range *l.producers.Load() {
+		if p.head.V.Load() != p.tail.V.Load() || l.closed.Load() {
+			if l.sleeping.V.CompareAndSwap(true, false) {
+				return false
+			}
+			break
+		}
+	}
+	select {
+	case <-l.wake:
+		return false
+	case <-tick:
+		// Awake on our own: a producer that already cleared sleeping
+		// leaves a wake behind, which the next sleep takes at once.
+		l.sleeping.V.Store(false)
+		return true
+	}
+}
+
+// BatchSizes returns how many entries each fsync the combiner did
+// covered, in order; call it after Close.
+func (l *CombiningLogger) BatchSizes() []int { return l.batches }
+
+// Stats reports what the combiner has written; Pending is the entries
+// in the producers' rings.
+func (l *CombiningLogger) Stats() Stats {
+	var pending int64
+	for _, p := range *l.producers.Load() {
+		head := p.head.V.Load()
+		pending += int64(p.tail.V.Load() - head)
+	}
+	return l.lf.stats(pending)
+}
+
+// Health returns the last error the combiner hit, without waiting for a
+// Log to return it.
+func (l *CombiningLogger) Health() error { return l.lf.Health() }
+
+// Close writes what every producer has logged, syncs it and closes the
+// file, returning an error from that, or else the last the combiner hit.
+// Producers must be done logging; they needn't be closed.
+func (l *CombiningLogger) Close() error {
+	l.closed.Store(true)
+	l.sleeping.V.Store(false)
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	<-l.done
+	if l.closeErr != nil {
+		return l.closeErr
+	}
+	return l.lf.Health()
+}
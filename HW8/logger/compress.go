@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// OpenLog opens the log at path for reading as one stream: its rotated
+// backups first, oldest (path.N) to newest (path.1), then path itself.
+// Each segment that is gzip, as Options.Compress writes, is decompressed
+// on the way. A gzip segment cut short, like the live file since its
+// last sync or one a crash tore, reads as far as it decompresses.
+func OpenLog(path string) (io.ReadCloser, error) {
+	var paths []string
+	for i := 1; ; i++ {
+		p := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(p); err != nil {
+			break
+		}
+		paths = append([]string{p}, paths...)
+	}
+	paths = append(paths, path)
+
+	l := &segmentReader{}
+	var rs []io.Reader
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.files = append(l.files, f)
+		r, err := decompress(f)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		rs = append(rs, r)
+	}
+	l.Reader = io.MultiReader(rs...)
+	return l, nil
+}
+
+// segmentReader reads a log's segments in turn and closes them all.
+type segmentReader struct {
+	io.Reader
+	files []*os.File
+}
+
+func (l *segmentReader) Close() error {
+	var first error
+	for _, f := range l.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// decompress returns f's contents, gunzipped if they start as gzip does.
+func decompress(f *os.File) (io.Reader, error) {
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(2)
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return br, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return truncated{zr}, nil
+}
+
+// truncated ends a gzip stream that stops early, with no checksum
+// footer, as if it ended there.
+type truncated struct {
+	r io.Reader
+}
+
+func (t truncated) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
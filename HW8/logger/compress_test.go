@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A new log starts afresh: OpenLog mustn't read the backups an earlier,
+// rotating run left as the start of it.
+func TestOpenLogAfterRotatingRun(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.log")
+			logN := func(o Options, run string, n int) {
+				t.Helper()
+				l, err := NewMutexLoggerWith(path, 1, o)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := 0; i < n; i++ {
+					e := LogEntry{Timestamp: time.Now(), Level: "INFO", Message: fmt.Sprintf("%s %d", run, i)}
+					if err := l.Log(e); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := l.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			logN(Options{Compress: compress, Rotation: RotationConfig{MaxBytes: 200, MaxBackups: 5}}, "first", 50)
+			if _, err := os.Stat(path + ".1"); err != nil {
+				t.Fatalf("the rotating run left no backup: %v", err)
+			}
+			logN(Options{Compress: compress}, "second", 3)
+			if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+				t.Errorf("%s.1 still there after a new log (%v)", path, err)
+			}
+
+			r, err := OpenLog(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			var lines []string
+			for sc := bufio.NewScanner(r); sc.Scan(); {
+				lines = append(lines, sc.Text())
+			}
+			if len(lines) != 3 {
+				t.Fatalf("OpenLog read %d lines, want the second run's 3:\n%s", len(lines), strings.Join(lines, "\n"))
+			}
+			for i, line := range lines {
+				if want := fmt.Sprintf("second %d", i); !strings.Contains(line, want) {
+					t.Errorf("line %d = %q, want it to hold %q", i, line, want)
+				}
+			}
+		})
+	}
+}
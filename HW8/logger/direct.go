@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+
+	"example.com/operating-systems/internal/fsio"
+)
+
+// Direct I/O
+// With Options.Direct a log file is opened with the page cache bypassed
+// (O_DIRECT on Linux), so a write goes to the device when it is made and
+// a sync's time is the device's, not the kernel's writeback. Direct I/O
+// takes only whole blocks at block offsets, from aligned memory, so the
+// file's bytes collect in a directWriter's aligned buffer and reach the
+// file at each sync, or when the buffer fills.
+
+// directBuf is the size of a directWriter's buffer, a whole number of
+// blocks.
+const directBuf = 64 * 1024
+
+// directWriter buffers writes to a file opened for direct I/O. Flush
+// writes the buffer out, its last, partial block padded with zeros, and
+// cuts the file back to its real length; the partial block stays in the
+// buffer and is written again, fuller, at the next Flush.
+type directWriter struct {
+	f     *os.File
+	buf   []byte // fsio.AlignedBlock(directBuf)
+	n     int    // bytes in buf
+	off   int64  // the file offset buf starts at, a multiple of fsio.Alignment
+	dirty bool   // bytes written since the last Flush
+}
+
+func newDirectWriter(f *os.File) *directWriter {
+	return &directWriter{f: f, buf: fsio.AlignedBlock(directBuf)}
+}
+
+// reset starts writing f, from its start.
+func (w *directWriter) reset(f *os.File) {
+	w.f, w.n, w.off, w.dirty = f, 0, 0, false
+}
+
+func (w *directWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		c := copy(w.buf[w.n:], p)
+		w.n += c
+		p = p[c:]
+		total += c
+		w.dirty = true
+		if w.n == len(w.buf) {
+			if _, err := w.f.WriteAt(w.buf, w.off); err != nil {
+				return total, err
+			}
+			w.off += int64(w.n)
+			w.n, w.dirty = 0, false
+		}
+	}
+	return total, nil
+}
+
+// Flush writes what is buffered to the file.
+func (w *directWriter) Flush() error {
+	if !w.dirty {
+		return nil
+	}
+	end := (w.n + fsio.Alignment - 1) &^ (fsio.Alignment - 1)
+	clear(w.buf[w.n:end])
+	if _, err := w.f.WriteAt(w.buf[:end], w.off); err != nil {
+		return err
+	}
+	if end != w.n {
+		if err := w.f.Truncate(w.off + int64(w.n)); err != nil {
+			return err
+		}
+	}
+	whole := w.n &^ (fsio.Alignment - 1)
+	copy(w.buf, w.buf[whole:w.n])
+	w.n -= whole
+	w.off += int64(whole)
+	w.dirty = false
+	return nil
+}
+
+// createLogFile creates path, for direct I/O if o.Direct asks for it
+// and the platform and file system allow it, and reports which.
+func createLogFile(path string, o Options) (f *os.File, direct bool, err error) {
+	if o.Direct {
+		if f, err := fsio.OpenDirect(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666); err == nil {
+			return f, true, nil
+		}
+	}
+	f, err = os.Create(path)
+	return f, false, err
+}
+
+// DirectSupported reports whether a log file in dir can be written with
+// direct I/O: nil if it can, or why not. Where it can't, Options.Direct
+// falls back to the page cache.
+func DirectSupported(dir string) error {
+	path := filepath.Join(dir, ".direct-probe")
+	f, err := fsio.OpenDirect(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	_, err = f.WriteAt(fsio.AlignedBlock(fsio.Alignment), 0)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A group commit's entries are durable once Log returns, so with Direct
+// they must be in the file, not the direct buffer, before Close.
+func TestGroupCommitDirect(t *testing.T) {
+	dir := t.TempDir()
+	if err := DirectSupported(dir); err != nil {
+		t.Skipf("no direct I/O in %s: %v", dir, err)
+	}
+	path := filepath.Join(dir, "group.log")
+	l, err := NewGroupCommitLoggerWith(path, 0, Options{Direct: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	const n = 5
+	for i := 0; i < n; i++ {
+		e := LogEntry{Timestamp: time.Now(), Level: "INFO", Message: fmt.Sprintf("entry %d", i)}
+		if i%2 == 0 {
+			err = l.Log(e)
+		} else {
+			err = <-l.LogDurable(e)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		if len(lines) != i+1 || !strings.Contains(lines[i], e.Message) {
+			t.Fatalf("after logging %q the file holds %d bytes:\n%s", e.Message, len(data), data)
+		}
+	}
+}
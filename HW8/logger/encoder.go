@@ -0,0 +1,113 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encoder turns an entry into the line a logger writes, newline and all.
+type Encoder interface {
+	Encode(e LogEntry) string
+}
+
+// The encoders: Text is the bracketed line String writes, for people;
+// JSON is one object per line, for jq and log pipelines; Binary is
+// checksummed records, for finding where a crash tore the log.
+var (
+	Text   Encoder = TextEncoder{}
+	JSON   Encoder = JSONEncoder{}
+	Binary Encoder = BinaryEncoder{}
+)
+
+// ParseEncoder accepts "text", "json" or "binary".
+func ParseEncoder(s string) (Encoder, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "text", "txt":
+		return Text, nil
+	case "json", "jsonl", "ndjson":
+		return JSON, nil
+	case "binary", "wal":
+		return Binary, nil
+	}
+	return nil, fmt.Errorf("logger: unknown format %q (text, json, binary)", s)
+}
+
+// TextEncoder writes String's line, with any Fields after the message as
+// key=value in key order. ParseEntry leaves them in the Message.
+type TextEncoder struct{}
+
+func (TextEncoder) Encode(e LogEntry) string {
+	if len(e.Fields) == 0 {
+		return e.String()
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimSuffix(e.String(), "\n"))
+	for _, k := range fieldKeys(e.Fields) {
+		v := fmt.Sprint(e.Fields[k])
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, " %s=%s", k, v)
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+func fieldKeys(fields map[string]any) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (TextEncoder) String() string { return "text" }
+
+// JSONEncoder writes an entry as one JSON object per line:
+//
+//	{"time":"2006-01-02T15:04:05.999999999Z07:00","level":"INFO","context":"req-1","clock":"3","msg":"...","fields":{...}}
+//
+// with the timestamp at full resolution, and clock and fields left out
+// when empty. ParseEntry reads it back.
+type JSONEncoder struct{}
+
+// jsonEntry is LogEntry as JSONEncoder writes it.
+type jsonEntry struct {
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Context string         `json:"context"`
+	Clock   string         `json:"clock,omitempty"`
+	Message string         `json:"msg"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+func (JSONEncoder) Encode(e LogEntry) string {
+	line, err := json.Marshal(jsonEntry{e.Timestamp, e.Level, e.Context, e.Clock, e.Message, e.Fields})
+	if err != nil {
+		// A field json can't encode (a channel, a func): log it as text
+		// rather than lose the entry.
+		fields := make(map[string]any, len(e.Fields))
+		for k, v := range e.Fields {
+			fields[k] = fmt.Sprint(v)
+		}
+		line, _ = json.Marshal(jsonEntry{e.Timestamp, e.Level, e.Context, e.Clock, e.Message, fields})
+	}
+	return string(line) + "\n"
+}
+
+func (JSONEncoder) String() string { return "json" }
+
+// parseJSONEntry reads back a line JSONEncoder wrote. Numbers in Fields
+// come back as float64, as encoding/json decodes them.
+func parseJSONEntry(line string) (LogEntry, error) {
+	var j jsonEntry
+	if err := json.Unmarshal([]byte(line), &j); err != nil {
+		return LogEntry{}, fmt.Errorf("malformed log line %q: %w", line, err)
+	}
+	return LogEntry{Timestamp: j.Time, Level: j.Level, Context: j.Context, Message: j.Message, Clock: j.Clock, Fields: j.Fields}, nil
+}
@@ -0,0 +1,157 @@
+package logger
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Group Commit Logger
+// Log writes its entry under a mutex, then waits for an fsync that
+// covers it, as a database commits a transaction. The first caller to
+// find no fsync running becomes the leader: it waits window for others
+// to join (none with a zero window), notes how far the file has been
+// written, and fsyncs without the mutex while the next group writes
+// behind it. Everyone whose entry that fsync covered returns together;
+// anyone left becomes, or waits for, the next leader. So fsyncs are as
+// frequent as the disk allows and no more: one per group, however many
+// callers arrive while the last one runs. Log returns only once its
+// entry is on disk, like the naive logger, but without its fsync each.
+type GroupCommitLogger struct {
+	levelFilter
+	lf     *logFile
+	window time.Duration
+
+	mu      sync.Mutex
+	cond    *sync.Cond // signalled when a commit finishes
+	written uint64     // entries written to the file
+	synced  uint64     // entries an fsync has covered
+	syncing bool       // a leader is committing
+	err     error      // from the first failed fsync; every later Log returns it
+
+	syncs atomic.Int64
+}
+
+func NewGroupCommitLogger(path string, window time.Duration) (*GroupCommitLogger, error) {
+	return NewGroupCommitLoggerWith(path, window, Options{})
+}
+
+func NewGroupCommitLoggerWith(path string, window time.Duration, o Options) (*GroupCommitLogger, error) {
+	lf, err := openLogFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+	l := &GroupCommitLogger{lf: lf, window: window}
+	l.cond = sync.NewCond(&l.mu)
+	l.SetLevel(o.MinLevel)
+	return l, nil
+}
+
+func (l *GroupCommitLogger) Log(entry LogEntry) error {
+	return l.LogCtx(context.Background(), entry)
+}
+
+// LogCtx is Log, giving up if ctx ends while it waits for another
+// leader's commit. Its entry is written by then and will be synced by
+// the next commit, or by Close.
+func (l *GroupCommitLogger) LogCtx(ctx context.Context, entry LogEntry) error {
+	if l.drop(entry) {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s := l.lf.encode(entry) // outside the lock
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	// Rotating closes the file a leader is syncing, so with rotation on
+	// a write waits for the leader to finish.
+	for l.syncing && l.lf.opts.Rotation.enabled() {
+		l.cond.Wait()
+	}
+	if err := l.lf.write(s); err != nil {
+		return err
+	}
+	l.written++
+	mine := l.written
+
+	if ctx.Done() != nil {
+		stop := context.AfterFunc(ctx, func() {
+			l.mu.Lock()
+			l.cond.Broadcast()
+			l.mu.Unlock()
+		})
+		defer stop()
+	}
+	for l.synced < mine && l.err == nil {
+		if !l.syncing {
+			l.commit()
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.cond.Wait()
+	}
+	return l.err
+}
+
+// commit is the leader's turn: called and returning with mu held, it
+// fsyncs everything written by the end of the window without it.
+func (l *GroupCommitLogger) commit() {
+	l.syncing = true
+	if l.window > 0 {
+		l.mu.Unlock()
+		time.Sleep(l.window)
+		l.mu.Lock()
+	}
+	upTo := l.written
+	// The compressor and the direct buffer are written under mu, so they
+	// are flushed under mu, in logFile.sync's order.
+	err := l.lf.fail(l.lf.flushGzip())
+	if err == nil {
+		err = l.lf.fail(l.lf.flushDirect())
+	}
+	l.mu.Unlock()
+	if err == nil {
+		err = l.lf.fail(l.lf.fsync())
+	}
+	l.syncs.Add(1)
+	l.mu.Lock()
+	if err != nil && l.err == nil {
+		l.err = err
+	}
+	l.synced = upTo
+	l.syncing = false
+	l.cond.Broadcast()
+}
+
+// LogDurable logs entry; Log has already waited for its fsync.
+func (l *GroupCommitLogger) LogDurable(entry LogEntry) <-chan error {
+	return acked(l.Log(entry))
+}
+
+// Syncs is how many fsyncs the logger has done: fewer than its entries
+// by however much the groups coalesced.
+func (l *GroupCommitLogger) Syncs() int64 { return l.syncs.Load() }
+
+// Stats reports what the logger has written; a caller waiting for its
+// commit has already written its entry, so none are pending.
+func (l *GroupCommitLogger) Stats() Stats { return l.lf.stats(0) }
+
+// Health returns the last write or fsync error.
+func (l *GroupCommitLogger) Health() error { return l.lf.Health() }
+
+func (l *GroupCommitLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.syncing {
+		l.cond.Wait()
+	}
+	return l.lf.close()
+}
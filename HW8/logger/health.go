@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Stats is what a logger has done so far.
+type Stats struct {
+	Pending int64 // entries taken but not yet written: queued in a channel or ring
+	Entries int64 // entries written to the file
+	Bytes   int64 // bytes those took, before compression
+	Syncs   int64 // fsyncs (msyncs for MmapLogger) done; none under fsio.None
+	LastErr error // the most recent write or sync error, nil if none
+}
+
+// HealthLogger is a Logger that reports on itself, so a caller can tell
+// a logger that has stopped writing from a quiet one. Health returns the
+// most recent error the logger hit writing or syncing, nil while it has
+// hit none; for ChannelLogger and RingLogger that is as soon as their
+// writer hits it, where Log would return it only on the next call.
+// Options.OnError hears of each error as it happens.
+type HealthLogger interface {
+	Logger
+	Stats() Stats
+	Health() error
+}
+
+// health is the counters and last error every logger keeps, in its
+// logFile or, for loggers without one, itself.
+type health struct {
+	onError func(error)
+	entries atomic.Int64
+	bytes   atomic.Int64
+	syncs   atomic.Int64
+
+	errMu   sync.Mutex
+	lastErr error
+}
+
+// wrote counts an entry of n bytes written.
+func (h *health) wrote(n int) {
+	h.entries.Add(1)
+	h.bytes.Add(int64(n))
+}
+
+// fail records err, if any, tells OnError and returns it.
+func (h *health) fail(err error) error {
+	if err == nil {
+		return nil
+	}
+	h.errMu.Lock()
+	h.lastErr = err
+	h.errMu.Unlock()
+	if h.onError != nil {
+		h.onError(err)
+	}
+	return err
+}
+
+// Health returns the most recent error, nil if there has been none.
+func (h *health) Health() error {
+	h.errMu.Lock()
+	defer h.errMu.Unlock()
+	return h.lastErr
+}
+
+// stats returns the counters, with pending entries queued.
+func (h *health) stats(pending int64) Stats {
+	return Stats{
+		Pending: pending,
+		Entries: h.entries.Load(),
+		Bytes:   h.bytes.Load(),
+		Syncs:   h.syncs.Load(),
+		LastErr: h.Health(),
+	}
+}
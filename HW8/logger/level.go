@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is an entry's severity, for filtering. LogEntry.Level stays a
+// string so any level can be written; ParseLevel reads the four a filter
+// knows.
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int32(l))
+}
+
+// ParseLevel accepts a level's name in any case.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO":
+		return LevelInfo, nil
+	case "WARN", "WARNING":
+		return LevelWarn, nil
+	case "ERROR":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("logger: unknown level %q (debug, info, warn, error)", s)
+}
+
+// Set and the String above make a *Level a flag.Value.
+func (l *Level) Set(s string) error {
+	v, err := ParseLevel(s)
+	if err == nil {
+		*l = v
+	}
+	return err
+}
+
+// Enabled reports whether an entry at level is logged with l the
+// minimum. A level ParseLevel doesn't know is always logged.
+func (l Level) Enabled(level string) bool {
+	if l <= LevelDebug {
+		return true
+	}
+	v, err := ParseLevel(level)
+	return err != nil || v >= l
+}
+
+// LevelLogger is a Logger that drops entries below a minimum level
+// before doing any work for them. SetLevel changes the minimum at any
+// time, from any goroutine; entries already accepted are still written.
+// A dropped entry's Log returns nil, and its LogDurable's channel nil at
+// once.
+type LevelLogger interface {
+	Logger
+	SetLevel(min Level)
+	Level() Level
+}
+
+// levelFilter is the minimum level every logger embeds.
+type levelFilter struct {
+	min atomic.Int32
+}
+
+// SetLevel sets the minimum level entries are logged at.
+func (f *levelFilter) SetLevel(min Level) { f.min.Store(int32(min)) }
+
+// Level returns the minimum level entries are logged at.
+func (f *levelFilter) Level() Level { return Level(f.min.Load()) }
+
+// drop reports whether e is below the minimum.
+func (f *levelFilter) drop(e LogEntry) bool {
+	return !f.Level().Enabled(e.Level)
+}
@@ -0,0 +1,910 @@
+// Package logger holds the HW8 loggers (naive, mutex, channel) so other
+// homeworks can log through them; HW8/main.go benchmarks the three.
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/internal/fsio"
+)
+
+type LogEntry struct {
+	Timestamp time.Time
+	Level     string
+	Context   string
+	Message   string
+	// Clock is an optional logical timestamp (see package lclock), written
+	// as a fourth bracket, "[@clock]", when set.
+	Clock string
+	// Fields are any other key/value pairs; how they are written is up
+	// to the logger's Encoder.
+	Fields map[string]any
+}
+
+// timeLayout is the timestamp format of a log line.
+const timeLayout = "2006-01-02 15:04:05"
+
+func (e LogEntry) String() string {
+	if e.Clock != "" {
+		return fmt.Sprintf("[%s] [%s] [%s] [@%s] %s\n",
+			e.Timestamp.Format(timeLayout),
+			e.Level,
+			e.Context,
+			e.Clock,
+			e.Message,
+		)
+	}
+
+	return fmt.Sprintf("[%s] [%s] [%s] %s\n",
+		e.Timestamp.Format(timeLayout),
+		e.Level,
+		e.Context,
+		e.Message,
+	)
+}
+
+// ParseEntry reads back one line written by String (trailing newline optional).
+// The timestamp is taken as local time, at the one-second resolution String keeps.
+// A bracket starting "[@" after the context is the Clock.
+// A line starting "{" is read as JSONEncoder wrote it.
+func ParseEntry(line string) (LogEntry, error) {
+	if strings.HasPrefix(line, "{") {
+		return parseJSONEntry(line)
+	}
+	rest := strings.TrimSuffix(line, "\n")
+	field := func(sep string) (string, bool) {
+		if !strings.HasPrefix(rest, "[") {
+			return "", false
+		}
+		v, after, ok := strings.Cut(rest[1:], sep)
+		rest = after
+		return v, ok
+	}
+	ts, ok1 := field("] ")
+	level, ok2 := field("] ")
+	context, ok3 := field("] ")
+	if !ok1 || !ok2 || !ok3 {
+		return LogEntry{}, fmt.Errorf("malformed log line %q", line)
+	}
+	t, err := time.ParseInLocation(timeLayout, ts, time.Local)
+	if err != nil {
+		return LogEntry{}, fmt.Errorf("malformed log line %q: %w", line, err)
+	}
+	var clock string
+	if strings.HasPrefix(rest, "[@") {
+		c, after, ok := strings.Cut(rest[2:], "] ")
+		if !ok {
+			return LogEntry{}, fmt.Errorf("malformed log line %q: unterminated clock", line)
+		}
+		clock, rest = c, after
+	}
+	return LogEntry{Timestamp: t, Level: level, Context: context, Message: rest, Clock: clock}, nil
+}
+
+type Logger interface {
+	Log(entry LogEntry) error
+	// LogCtx is Log, giving up with ctx's error if ctx ends while the
+	// call is blocked: waiting for room, or for its entry's fsync. An
+	// entry the logger has already taken may still be written.
+	LogCtx(ctx context.Context, entry LogEntry) error
+	Close() error
+}
+
+// DurableLogger is a Logger that can say when an entry is on disk.
+// LogDurable logs entry as Log does and returns a channel that receives
+// once, when the fsync that covers the entry has finished: nil, or the
+// error that kept the entry from the disk. Timing from the call to the
+// receive gives an entry's durable write latency.
+type DurableLogger interface {
+	Logger
+	LogDurable(entry LogEntry) <-chan error
+}
+
+// acked returns a channel that already holds err.
+func acked(err error) <-chan error {
+	ch := make(chan error, 1)
+	ch <- err
+	return ch
+}
+
+// Options says how a logger writes entries, how it makes its file
+// durable and when it starts a new one.
+type Options struct {
+	Encoder  Encoder        // Text by default
+	Sync     fsio.SyncMode  // how each fsync syncs; fsio.Full by default
+	Rotation RotationConfig // none by default
+	MinLevel Level          // LevelDebug, logging everything, by default
+	Overflow Overflow       // what a full ChannelLogger does; Block by default
+	// Compress writes the file as gzip. Entries are compressed as they
+	// are written but reach the OS only at each sync, and rotation
+	// rolls over to a new gzip segment, closing the old one with its
+	// checksum; MaxBytes counts bytes before compression. OpenLog reads
+	// the segments back.
+	Compress bool
+	// FlushInterval bounds how long a batching logger (mutex, channel,
+	// ring, combining) leaves written entries unsynced: a ticker this
+	// often syncs a batch that hasn't filled. Zero waits for a full batch, however long
+	// traffic stops for.
+	FlushInterval time.Duration
+	// Batch, if set, makes the BatchPolicy a ChannelLogger's,
+	// RingLogger's or CombiningLogger's writer syncs by, in place of
+	// FixedBatch(batchN). The other loggers have no backlog to size a batch by and keep batchN.
+	Batch func() BatchPolicy
+	// OnError, if set, is called with each error the logger hits writing
+	// or syncing, from the goroutine that hit it: for ChannelLogger and
+	// RingLogger their writer, so it hears at once of an error Log would
+	// return only on the next call. It must not call the logger.
+	OnError func(error)
+	// Direct opens the file for direct I/O, bypassing the page cache, so
+	// that the benchmark times the device rather than the kernel's
+	// buffering. Entries wait in an aligned buffer and reach the file in
+	// whole blocks at each sync, so until a sync they are neither on
+	// disk nor visible to a reader. Where the platform or file system
+	// can't (tmpfs can't), the file is opened as usual; DirectSupported
+	// says which. The append and mmap loggers ignore it.
+	Direct bool
+}
+
+// RotationConfig bounds a log file. When the next entry would take the
+// file past MaxBytes, or it has been open MaxAge, the logger syncs and
+// closes it, renames it to path.1 (path.1 to path.2, and so on, keeping
+// MaxBackups of them and deleting the oldest) and carries on in a new,
+// empty file at path. Each rename is atomic, so a reader sees either the
+// old file or the new one at path, never a partial one. A zero MaxBytes
+// or MaxAge doesn't limit that; the zero RotationConfig never rotates.
+// Age is checked when an entry is written, so an idle log stays put.
+// With MaxBackups 0, rotating discards the old file. A new logger, which
+// starts its log afresh, removes any backups an earlier one left.
+type RotationConfig struct {
+	MaxBytes   int64
+	MaxAge     time.Duration
+	MaxBackups int
+}
+
+func (r RotationConfig) enabled() bool { return r.MaxBytes > 0 || r.MaxAge > 0 }
+
+// logFile is the file a logger writes: buffered, synced as its Options
+// say, and rotated as they say. It does no locking of its own; each
+// logger calls it the way it serializes its writes.
+type logFile struct {
+	path   string
+	f      *os.File
+	bw     *bufio.Writer
+	gz     *gzip.Writer  // between bw and f with Compress; nil without
+	dw     *directWriter // in front of f with Direct, where allowed; nil without
+	opts   Options
+	size   int64
+	opened time.Time
+	health // for Stats
+}
+
+func openLogFile(path string, o Options) (*logFile, error) {
+	if err := removeBackups(path); err != nil {
+		return nil, err
+	}
+	f, direct, err := createLogFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+	lf := &logFile{path: path, f: f, opts: o, opened: time.Now()}
+	lf.onError = o.OnError
+	var w io.Writer = f
+	if direct {
+		lf.dw = newDirectWriter(f)
+		w = lf.dw
+	}
+	if o.Compress {
+		lf.gz = gzip.NewWriter(w)
+		lf.bw = bufio.NewWriterSize(lf.gz, 64*1024)
+	} else {
+		lf.bw = bufio.NewWriterSize(w, 64*1024)
+	}
+	return lf, nil
+}
+
+// write writes s and flushes it to the OS (to the compressor, with
+// Compress, or the direct buffer, with Direct), rotating first if s
+// would take the file past its bounds.
+func (lf *logFile) write(s string) error {
+	if lf.due(len(s)) {
+		if err := lf.rotate(); err != nil {
+			return lf.fail(err)
+		}
+	}
+	n, err := lf.bw.WriteString(s)
+	lf.size += int64(n)
+	if err != nil {
+		return lf.fail(err)
+	}
+	// write can be buffered; flush so it reaches OS
+	if err := lf.bw.Flush(); err != nil {
+		return lf.fail(err)
+	}
+	lf.wrote(n)
+	return nil
+}
+
+// writeEntry writes e as the file's Encoder encodes it.
+func (lf *logFile) writeEntry(e LogEntry) error {
+	return lf.write(lf.encode(e))
+}
+
+func (lf *logFile) encode(e LogEntry) string {
+	enc := lf.opts.Encoder
+	if enc == nil {
+		enc = Text
+	}
+	return enc.Encode(e)
+}
+
+// due reports whether the file must rotate before n more bytes.
+func (lf *logFile) due(n int) bool {
+	r := lf.opts.Rotation
+	if !r.enabled() || lf.size == 0 {
+		return false
+	}
+	return r.MaxBytes > 0 && lf.size+int64(n) > r.MaxBytes || r.MaxAge > 0 && time.Since(lf.opened) >= r.MaxAge
+}
+
+// sync makes what has been written durable.
+func (lf *logFile) sync() error {
+	if err := lf.flushGzip(); err != nil {
+		return lf.fail(err)
+	}
+	if err := lf.flushDirect(); err != nil {
+		return lf.fail(err)
+	}
+	return lf.fail(lf.fsync())
+}
+
+// flushGzip hands the compressor's output so far to the OS, so that
+// everything written decompresses; without Compress it does nothing.
+func (lf *logFile) flushGzip() error {
+	if lf.gz == nil {
+		return nil
+	}
+	return lf.gz.Flush()
+}
+
+// flushDirect writes the direct buffer to the file; without Direct it
+// does nothing.
+func (lf *logFile) flushDirect() error {
+	if lf.dw == nil {
+		return nil
+	}
+	return lf.dw.Flush()
+}
+
+// fsync syncs what the OS has been handed, counting it.
+func (lf *logFile) fsync() error {
+	if err := fsio.Sync(lf.f, lf.opts.Sync); err != nil {
+		return err
+	}
+	if lf.opts.Sync != fsio.None {
+		lf.syncs.Add(1)
+	}
+	return nil
+}
+
+// finish flushes what is buffered and ends the gzip segment, if any.
+func (lf *logFile) finish() error {
+	err := lf.bw.Flush()
+	if lf.gz != nil {
+		if cerr := lf.gz.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if derr := lf.flushDirect(); err == nil {
+		err = derr
+	}
+	return err
+}
+
+// close flushes, syncs and closes the file, returning the first error.
+func (lf *logFile) close() error {
+	err := lf.fail(lf.finish())
+	if serr := lf.fail(lf.fsync()); err == nil { // final durability
+		err = serr
+	}
+	if cerr := lf.fail(lf.f.Close()); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// rotate closes the file, shifts the backups along and opens a new one.
+func (lf *logFile) rotate() error {
+	if err := lf.finish(); err != nil {
+		return err
+	}
+	if err := lf.fsync(); err != nil {
+		return err
+	}
+	if err := lf.f.Close(); err != nil {
+		return err
+	}
+	keep := lf.opts.Rotation.MaxBackups
+	backup := func(i int) string { return fmt.Sprintf("%s.%d", lf.path, i) }
+	if keep > 0 {
+		if err := os.Remove(backup(keep)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for i := keep - 1; i >= 1; i-- {
+		if err := os.Rename(backup(i), backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if keep > 0 {
+		if err := os.Rename(lf.path, backup(1)); err != nil {
+			return err
+		}
+	}
+	f, direct, err := createLogFile(lf.path, lf.opts)
+	if err != nil {
+		return err
+	}
+	lf.f, lf.size, lf.opened = f, 0, time.Now()
+	var w io.Writer = f
+	switch {
+	case direct && lf.dw != nil:
+		lf.dw.reset(f)
+		w = lf.dw
+	case direct:
+		lf.dw = newDirectWriter(f)
+		w = lf.dw
+	default:
+		lf.dw = nil
+	}
+	if lf.gz != nil {
+		lf.gz.Reset(w)
+		lf.bw.Reset(lf.gz)
+	} else {
+		lf.bw.Reset(w)
+	}
+	return nil
+}
+
+// removeBackups removes path.1, path.2, ... up to the first missing one:
+// an earlier log's backups, which OpenLog would otherwise read as the
+// start of a new log at path.
+func removeBackups(path string) error {
+	for i := 1; ; i++ {
+		err := os.Remove(fmt.Sprintf("%s.%d", path, i))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Naive Logger
+// No synchronization. fsync after every write.
+type NaiveLogger struct {
+	levelFilter
+	lf *logFile
+}
+
+func NewNaiveLogger(path string) (*NaiveLogger, error) {
+	return NewNaiveLoggerWith(path, Options{})
+}
+
+func NewNaiveLoggerWith(path string, o Options) (*NaiveLogger, error) {
+	lf, err := openLogFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+	l := &NaiveLogger{lf: lf}
+	l.SetLevel(o.MinLevel)
+	return l, nil
+}
+
+func (l *NaiveLogger) Log(entry LogEntry) error {
+	if l.drop(entry) {
+		return nil
+	}
+	// UNSAFE: multiple goroutines will call this at once (rotation too)
+	if err := l.lf.writeEntry(entry); err != nil {
+		return err
+	}
+	// fsync after every write
+	return l.lf.sync()
+}
+
+// LogCtx logs entry unless ctx has ended; the naive logger waits for
+// nothing but its own fsync.
+func (l *NaiveLogger) LogCtx(ctx context.Context, entry LogEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.Log(entry)
+}
+
+// LogDurable logs entry; every entry is synced before Log returns.
+func (l *NaiveLogger) LogDurable(entry LogEntry) <-chan error {
+	return acked(l.Log(entry))
+}
+
+func (l *NaiveLogger) Close() error {
+	_ = l.lf.fail(l.lf.finish())
+	return l.lf.fail(l.lf.f.Close())
+}
+
+// Stats reports what the logger has written; nothing is ever pending.
+func (l *NaiveLogger) Stats() Stats { return l.lf.stats(0) }
+
+// Health returns the last write or sync error.
+func (l *NaiveLogger) Health() error { return l.lf.Health() }
+
+// Mutex Logger
+// Mutex around file writes, and rotation. Batching: fsync every 10 entries,
+// and with a FlushInterval, a ticker goroutine syncs a partial batch.
+type MutexLogger struct {
+	levelFilter
+	lf       *logFile
+	mu       sync.Mutex
+	batchN   int
+	pending  int
+	flushErr error // from a timed sync, for the next Log to return
+	stop     chan struct{}
+
+	closing  sync.Once
+	closeErr error // the first Close's, for the rest to return
+}
+
+func NewMutexLogger(path string, batchN int) (*MutexLogger, error) {
+	return NewMutexLoggerWith(path, batchN, Options{})
+}
+
+func NewMutexLoggerWith(path string, batchN int, o Options) (*MutexLogger, error) {
+	lf, err := openLogFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+	if batchN <= 0 {
+		batchN = 1
+	}
+	l := &MutexLogger{
+		lf:     lf,
+		batchN: batchN,
+		stop:   make(chan struct{}),
+	}
+	l.SetLevel(o.MinLevel)
+	if o.FlushInterval > 0 {
+		go l.flushLoop(o.FlushInterval)
+	}
+	return l, nil
+}
+
+// flushLoop syncs whatever is pending every d, until Close.
+func (l *MutexLogger) flushLoop(d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			l.mu.Lock()
+			if l.pending > 0 {
+				l.pending = 0
+				if err := l.lf.sync(); err != nil && l.flushErr == nil {
+					l.flushErr = err
+				}
+			}
+			l.mu.Unlock()
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+func (l *MutexLogger) Log(entry LogEntry) error {
+	// Dropped before taking the lock, so filtered entries don't contend.
+	if l.drop(entry) {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.flushErr; err != nil {
+		l.flushErr = nil
+		return err
+	}
+	if err := l.lf.writeEntry(entry); err != nil {
+		return err
+	}
+
+	l.pending++
+	if l.pending >= l.batchN {
+		l.pending = 0
+		return l.lf.sync() // fsync batched
+	}
+	return nil
+}
+
+// LogCtx logs entry unless ctx has ended first. A sync.Mutex can't be
+// waited for with a deadline, so once it is waiting for the lock the
+// call finishes.
+func (l *MutexLogger) LogCtx(ctx context.Context, entry LogEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.Log(entry)
+}
+
+// LogDurable logs entry and syncs the batch it ends up in at once: there
+// is no writer of its own to sync later, so a durable entry cuts its
+// batch short.
+func (l *MutexLogger) LogDurable(entry LogEntry) <-chan error {
+	if l.drop(entry) {
+		return acked(nil)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.lf.writeEntry(entry); err != nil {
+		return acked(err)
+	}
+	l.pending = 0
+	return acked(l.lf.sync())
+}
+
+// Close syncs and closes the file. Closing again returns what the first
+// Close did.
+func (l *MutexLogger) Close() error {
+	l.closing.Do(func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		close(l.stop)
+		l.pending = 0 // a tick already waiting for mu finds nothing to sync
+		l.closeErr = l.lf.close()
+	})
+	return l.closeErr
+}
+
+// Stats reports what the logger has written; entries are written in
+// Log, so none are pending.
+func (l *MutexLogger) Stats() Stats { return l.lf.stats(0) }
+
+// Health returns the last write or sync error, a timed sync's too.
+func (l *MutexLogger) Health() error { return l.lf.Health() }
+
+// Channel Logger
+// Goroutines send entries to a channel; one writer goroutine writes,
+// and rotates, the file.
+// Batching: fsync every 10 entries (or as Options.Batch says), or sooner
+// for a durable entry: once nothing is queued behind it, the writer
+// syncs what it has (a group commit), so LogDurable never waits on
+// entries that aren't coming. With a FlushInterval, the writer also
+// syncs a partial batch on a ticker.
+// With its channel full, the logger does as its Options.Overflow says,
+// counting every entry it drops in Dropped.
+type ChannelLogger struct {
+	levelFilter
+	lf      *logFile
+	ch      chan channelEntry
+	done    chan struct{}
+	errMu   sync.Mutex
+	lastErr error
+	dropped atomic.Int64
+
+	closing  sync.Once
+	abandon  chan struct{} // closed when Shutdown's ctx ends: stop draining
+	giveUp   sync.Once
+	closeErr error // closing the file's, set before done is closed
+
+	batchN  int
+	batches []int // the size of every batch synced, for BatchSizes
+}
+
+// Overflow is what a ChannelLogger does with an entry when its channel
+// is full.
+type Overflow int
+
+const (
+	Block      Overflow = iota // wait for room
+	DropNewest                 // drop the entry; Log returns nil
+	DropOldest                 // drop the oldest queued entry to make room
+	Reject                     // drop the entry; Log returns ErrBufferFull
+)
+
+// ErrBufferFull is what Log returns under Reject when the channel is
+// full; ErrDropped is what a dropped durable entry's channel receives.
+var (
+	ErrBufferFull = errors.New("logger: buffer full")
+	ErrDropped    = errors.New("logger: entry dropped")
+)
+
+func (o Overflow) String() string {
+	switch o {
+	case Block:
+		return "block"
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	case Reject:
+		return "reject"
+	}
+	return fmt.Sprintf("Overflow(%d)", int(o))
+}
+
+// ParseOverflow accepts a policy's name.
+func ParseOverflow(s string) (Overflow, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "block":
+		return Block, nil
+	case "drop-newest", "drop":
+		return DropNewest, nil
+	case "drop-oldest":
+		return DropOldest, nil
+	case "reject", "error":
+		return Reject, nil
+	}
+	return 0, fmt.Errorf("logger: unknown overflow policy %q (block, drop-newest, drop-oldest, reject)", s)
+}
+
+// Set and the String above make an *Overflow a flag.Value.
+func (o *Overflow) Set(s string) error {
+	v, err := ParseOverflow(s)
+	if err == nil {
+		*o = v
+	}
+	return err
+}
+
+// channelEntry is an entry on its way to the writer, with the channel to
+// acknowledge it on once it is synced, if anyone is waiting.
+type channelEntry struct {
+	entry LogEntry
+	ack   chan error
+}
+
+func NewChannelLogger(path string, batchN int, chanBuf int) (*ChannelLogger, error) {
+	return NewChannelLoggerWith(path, batchN, chanBuf, Options{})
+}
+
+func NewChannelLoggerWith(path string, batchN int, chanBuf int, o Options) (*ChannelLogger, error) {
+	lf, err := openLogFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+	if batchN <= 0 {
+		batchN = 1
+	}
+	if chanBuf <= 0 {
+		chanBuf = 100
+	}
+
+	l := &ChannelLogger{
+		lf:      lf,
+		ch:      make(chan channelEntry, chanBuf),
+		done:    make(chan struct{}),
+		abandon: make(chan struct{}),
+		batchN:  batchN,
+	}
+	l.SetLevel(o.MinLevel)
+
+	go l.writerLoop()
+	return l, nil
+}
+
+func (l *ChannelLogger) setErr(err error) {
+	l.errMu.Lock()
+	defer l.errMu.Unlock()
+	if l.lastErr == nil {
+		l.lastErr = err
+	}
+}
+
+func (l *ChannelLogger) getErr() error {
+	l.errMu.Lock()
+	defer l.errMu.Unlock()
+	return l.lastErr
+}
+
+func (l *ChannelLogger) writerLoop() {
+	defer close(l.done)
+
+	policy := batchPolicy(l.lf.opts, l.batchN)
+	pending := 0
+	var acks []chan error // waiting on the next sync
+	syncBatch := func() {
+		l.batches = append(l.batches, pending)
+		pending = 0
+		err := l.lf.sync()
+		if err != nil {
+			l.setErr(err)
+		}
+		for _, ack := range acks {
+			ack <- err
+		}
+		acks = acks[:0]
+	}
+	var tick <-chan time.Time
+	if d := l.lf.opts.FlushInterval; d > 0 {
+		t := time.NewTicker(d)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		select {
+		case ce, ok := <-l.ch:
+			if !ok {
+				if pending > 0 {
+					l.batches = append(l.batches, pending) // synced by close
+				}
+				l.closeErr = l.lf.close()
+				l.setErr(l.closeErr)
+				return
+			}
+			if err := l.lf.writeEntry(ce.entry); err != nil {
+				l.setErr(err)
+				if ce.ack != nil {
+					ce.ack <- err
+				}
+				continue
+			}
+			if ce.ack != nil {
+				acks = append(acks, ce.ack)
+			}
+
+			pending++
+			if pending >= policy.Size(len(l.ch)) || len(acks) > 0 && len(l.ch) == 0 {
+				syncBatch()
+			}
+		case <-tick:
+			if pending > 0 {
+				syncBatch()
+			}
+		case <-l.abandon:
+			// Shutdown ran out of time: sync what is written and drop
+			// the rest. The channel is closed, so this ends.
+			for ce := range l.ch {
+				l.dropped.Add(1)
+				if ce.ack != nil {
+					ce.ack <- ErrDropped
+				}
+			}
+			if pending > 0 {
+				syncBatch()
+			}
+			l.closeErr = l.lf.close()
+			l.setErr(l.closeErr)
+			return
+		}
+	}
+}
+
+func (l *ChannelLogger) Log(entry LogEntry) error {
+	if l.drop(entry) {
+		return nil
+	}
+	// If writer hit an error, stop accepting logs
+	if err := l.getErr(); err != nil {
+		return err
+	}
+	return l.send(context.Background(), channelEntry{entry: entry})
+}
+
+// LogCtx is Log, giving up if ctx ends while it waits for room in the
+// channel (under Block; the other policies never wait).
+func (l *ChannelLogger) LogCtx(ctx context.Context, entry LogEntry) error {
+	if l.drop(entry) {
+		return nil
+	}
+	if err := l.getErr(); err != nil {
+		return err
+	}
+	return l.send(ctx, channelEntry{entry: entry})
+}
+
+// LogDurable logs entry; if the overflow policy drops it, the channel
+// receives ErrDropped (or ErrBufferFull under Reject).
+func (l *ChannelLogger) LogDurable(entry LogEntry) <-chan error {
+	if l.drop(entry) {
+		return acked(nil)
+	}
+	if err := l.getErr(); err != nil {
+		return acked(err)
+	}
+	ack := make(chan error, 1)
+	if err := l.send(context.Background(), channelEntry{entry, ack}); err != nil {
+		ack <- err
+	}
+	return ack
+}
+
+// send queues ce for the writer, doing as the overflow policy says if
+// the channel is full.
+func (l *ChannelLogger) send(ctx context.Context, ce channelEntry) error {
+	policy := l.lf.opts.Overflow
+	if policy == Block {
+		select {
+		case l.ch <- ce:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for {
+		select {
+		case l.ch <- ce:
+			return nil
+		default:
+		}
+		switch policy {
+		case DropNewest:
+			l.dropped.Add(1)
+			if ce.ack != nil {
+				ce.ack <- ErrDropped
+			}
+			return nil
+		case Reject:
+			l.dropped.Add(1)
+			return ErrBufferFull
+		}
+		// DropOldest: take the head of the queue, unless the writer
+		// just did, and try again.
+		select {
+		case old := <-l.ch:
+			l.dropped.Add(1)
+			if old.ack != nil {
+				old.ack <- ErrDropped
+			}
+		default:
+		}
+	}
+}
+
+// Dropped is how many entries the overflow policy has dropped.
+func (l *ChannelLogger) Dropped() int64 { return l.dropped.Load() }
+
+// BatchSizes returns how many entries each fsync the writer did covered,
+// in order; call it after Close.
+func (l *ChannelLogger) BatchSizes() []int { return l.batches }
+
+// Stats reports what the writer has written; Pending is the entries
+// queued in the channel.
+func (l *ChannelLogger) Stats() Stats { return l.lf.stats(int64(len(l.ch))) }
+
+// Health returns the last error the writer hit, without waiting for a
+// Log to return it.
+func (l *ChannelLogger) Health() error { return l.lf.Health() }
+
+// Close is Shutdown with no deadline: it writes every queued entry.
+func (l *ChannelLogger) Close() error {
+	return l.Shutdown(context.Background())
+}
+
+// Shutdown stops the logger taking entries and waits for the writer to
+// write and sync the queued ones, or for ctx to end first. Then the
+// writer drops what is still queued (counted in Dropped), syncs what it
+// wrote and closes the file, and Shutdown returns ctx's error, joined
+// with any from that final sync and close. Either way the file is closed
+// when it returns, and a final sync or close that failed is reported.
+// Log after Shutdown panics, as a send on a closed channel does.
+func (l *ChannelLogger) Shutdown(ctx context.Context) error {
+	l.closing.Do(func() { close(l.ch) })
+	select {
+	case <-l.done:
+		return l.getErr()
+	case <-ctx.Done():
+	}
+	l.giveUp.Do(func() { close(l.abandon) })
+	<-l.done
+	return errors.Join(ctx.Err(), l.closeErr)
+}
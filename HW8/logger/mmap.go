@@ -0,0 +1,213 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"example.com/operating-systems/internal/fsio"
+)
+
+// Mmap Logger
+// Pre-allocates the file a window at a time, maps the window and logs
+// an entry by copying it into the mapping under a mutex: no write
+// system call, no buffer of its own, the page cache is the buffer. The
+// kernel writes dirty pages back when it likes; every batchN entries the
+// logger msyncs the pages written since the last msync, its fsync. A
+// full window is msynced and unmapped, the file grown by another and
+// that mapped. Close cuts the file to what was written; a process that
+// dies first leaves zeros after its last entry, up to the window's end.
+// There is no rotation or compression: the file is the mapping.
+type MmapLogger struct {
+	levelFilter
+	mu     sync.Mutex
+	f      *os.File
+	enc    Encoder
+	opts   Options
+	batchN int
+	count  int
+	window int64  // bytes mapped at a time, a multiple of the page size
+	base   int64  // file offset of mem
+	mem    []byte // the mapped window
+	off    int    // bytes written into mem
+	synced int    // bytes of mem msynced
+	err    error  // sticky: a failed map or msync stops the logger
+	health        // for Stats
+}
+
+// DefaultMmapWindow is the window NewMmapLogger maps.
+const DefaultMmapWindow = 4 << 20
+
+func NewMmapLogger(path string, batchN int) (*MmapLogger, error) {
+	return NewMmapLoggerWith(path, DefaultMmapWindow, batchN, Options{})
+}
+
+// NewMmapLoggerWith maps path window bytes (rounded up to a page) at a
+// time; o's Rotation and Compress are ignored. Where the platform has
+// no mmap it returns an error wrapping errors.ErrUnsupported.
+func NewMmapLoggerWith(path string, window int64, batchN int, o Options) (*MmapLogger, error) {
+	if err := removeBackups(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	page := int64(os.Getpagesize())
+	if window <= 0 {
+		window = DefaultMmapWindow
+	}
+	window = (window + page - 1) / page * page
+	if batchN <= 0 {
+		batchN = 1
+	}
+	enc := o.Encoder
+	if enc == nil {
+		enc = Text
+	}
+	l := &MmapLogger{f: f, enc: enc, opts: o, batchN: batchN, window: window}
+	l.onError = o.OnError
+	if err := l.mapAt(0); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	l.SetLevel(o.MinLevel)
+	return l, nil
+}
+
+// mapAt grows the file to base+window, reserving the blocks if the
+// platform can so that page faults don't allocate them, and maps the
+// window at base.
+func (l *MmapLogger) mapAt(base int64) error {
+	if err := l.f.Truncate(base + l.window); err != nil {
+		return err
+	}
+	_ = fsio.Preallocate(l.f, base+l.window) // best effort
+	mem, err := mmapFile(l.f, base, int(l.window))
+	if err != nil {
+		return err
+	}
+	l.base, l.mem, l.off, l.synced = base, mem, 0, 0
+	return nil
+}
+
+// write copies s into the mapping, moving to the next window as one
+// fills; the caller holds mu.
+func (l *MmapLogger) write(s string) error {
+	for len(s) > 0 {
+		if l.off == len(l.mem) {
+			if err := l.sync(); err != nil {
+				return err
+			}
+			if err := munmapFile(l.mem); err != nil {
+				return err
+			}
+			l.mem = nil
+			if err := l.mapAt(l.base + l.window); err != nil {
+				return err
+			}
+		}
+		n := copy(l.mem[l.off:], s)
+		l.off += n
+		s = s[n:]
+	}
+	return nil
+}
+
+// sync msyncs the pages written since the last sync; the caller holds
+// mu. msync wants a page-aligned start, so the page the last sync ended
+// in is written again.
+func (l *MmapLogger) sync() error {
+	if l.opts.Sync == fsio.None || l.synced == l.off {
+		return nil
+	}
+	start := l.synced &^ (os.Getpagesize() - 1)
+	if err := msync(l.mem[start:l.off]); err != nil {
+		return err
+	}
+	l.synced = l.off
+	l.syncs.Add(1)
+	return nil
+}
+
+func (l *MmapLogger) Log(entry LogEntry) error {
+	if l.drop(entry) {
+		return nil
+	}
+	s := l.enc.Encode(entry) // outside the lock
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	if l.err = l.fail(l.write(s)); l.err != nil {
+		return l.err
+	}
+	l.wrote(len(s))
+	l.count++
+	if l.count%l.batchN == 0 {
+		l.err = l.fail(l.sync())
+	}
+	return l.err
+}
+
+// LogCtx logs entry unless ctx has ended; a copy waits only for mu.
+func (l *MmapLogger) LogCtx(ctx context.Context, entry LogEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.Log(entry)
+}
+
+// LogDurable logs entry and msyncs it at once.
+func (l *MmapLogger) LogDurable(entry LogEntry) <-chan error {
+	if l.drop(entry) {
+		return acked(nil)
+	}
+	if err := l.Log(entry); err != nil {
+		return acked(err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		l.err = l.fail(l.sync())
+	}
+	return acked(l.err)
+}
+
+// Stats reports what the logger has copied into the file; entries are
+// copied in Log, so none are pending.
+func (l *MmapLogger) Stats() Stats { return l.stats(0) }
+
+// Close msyncs and unmaps the window, cuts the file to the entries
+// written and syncs that.
+func (l *MmapLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.err
+	if l.mem != nil {
+		if serr := l.sync(); err == nil {
+			err = serr
+		}
+		if uerr := munmapFile(l.mem); err == nil {
+			err = uerr
+		}
+		l.mem = nil
+	}
+	if terr := l.f.Truncate(l.base + int64(l.off)); err == nil {
+		err = terr
+	}
+	if serr := fsio.Sync(l.f, l.opts.Sync); err == nil {
+		err = serr
+	}
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != l.err {
+		l.fail(err)
+	}
+	l.err = os.ErrClosed
+	return err
+}
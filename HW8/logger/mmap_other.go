@@ -0,0 +1,23 @@
+//go:build !linux && !darwin
+
+package logger
+
+import (
+	"errors"
+	"os"
+)
+
+// MmapLogger needs mmap and msync, which this platform doesn't provide
+// through package syscall.
+
+func mmapFile(f *os.File, off int64, n int) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func munmapFile(mem []byte) error {
+	return errors.ErrUnsupported
+}
+
+func msync(mem []byte) error {
+	return errors.ErrUnsupported
+}
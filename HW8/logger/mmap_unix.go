@@ -0,0 +1,29 @@
+//go:build linux || darwin
+
+package logger
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func mmapFile(f *os.File, off int64, n int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), off, n, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+func munmapFile(mem []byte) error {
+	return syscall.Munmap(mem)
+}
+
+// msync writes mem's dirty pages to the file and waits for them.
+func msync(mem []byte) error {
+	if len(mem) == 0 {
+		return nil
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&mem[0])), uintptr(len(mem)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
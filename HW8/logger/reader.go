@@ -0,0 +1,249 @@
+package logger
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// LogReader reads a log back as entries: all of a finished one with
+// ReadAll, or a live one as it is written with Follow, the consumer's
+// half of a logger.
+type LogReader struct {
+	path string
+	// Poll is how often Follow looks for more once it has read all there
+	// is; 10ms if zero. An entry is seen up to Poll after it is written.
+	Poll time.Duration
+	// Skipped counts the lines Follow couldn't parse and passed over;
+	// read it once Follow's channel has closed.
+	Skipped int
+
+	err error
+}
+
+func NewLogReader(path string) *LogReader {
+	return &LogReader{path: path}
+}
+
+// ReadAll parses the whole log, rotated segments first as OpenLog reads
+// them: text or JSON lines, or binary records up to the first torn one.
+// A line that doesn't parse is an error.
+func (r *LogReader) ReadAll() ([]LogEntry, error) {
+	f, err := OpenLog(r.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	if first, err := br.Peek(1); err == nil && first[0] != '[' && first[0] != '{' {
+		entries, _, err := ReadBinary(br)
+		return entries, err
+	}
+	var out []LogEntry
+	sc := bufio.NewScanner(br)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		e, err := ParseEntry(sc.Text())
+		if err != nil {
+			return out, err
+		}
+		out = append(out, e)
+	}
+	return out, sc.Err()
+}
+
+// Follow tails the live file, from its start, as tail -F does: it sends
+// each entry on the channel once its line is complete, and when it
+// reaches the end looks again every Poll. If the file is rotated (path
+// names another file) it finishes the old one and carries on from the
+// start of the new one; if it is truncated it starts again. It waits for
+// a file that doesn't exist yet. The channel closes when ctx ends, or at
+// an error, which Err then returns. Follow reads lines; a binary or
+// compressed log can only be read whole, with ReadAll.
+func (r *LogReader) Follow(ctx context.Context) <-chan LogEntry {
+	out := make(chan LogEntry, 256)
+	// Open the file now if it is there, so that nothing written after
+	// Follow returns is rotated away unread.
+	f, _ := os.Open(r.path)
+	go func() {
+		defer close(out)
+		if err := r.follow(ctx, out, f); err != nil && ctx.Err() == nil {
+			r.err = err
+		}
+	}()
+	return out
+}
+
+// Err is the error that stopped Follow, nil if ctx did; read it once
+// Follow's channel has closed.
+func (r *LogReader) Err() error { return r.err }
+
+// backupIndex returns k if the log's backup path.k is fi. If fi has been
+// rotated out of the backups altogether, it returns one past the oldest
+// backup modified since fi was, so that Follow goes on to that one and
+// not to older backups another run left.
+func (r *LogReader) backupIndex(fi os.FileInfo) int {
+	newer := 0
+	for k := 1; ; k++ {
+		b, err := os.Stat(fmt.Sprintf("%s.%d", r.path, k))
+		if err != nil {
+			return newer + 1
+		}
+		if os.SameFile(fi, b) {
+			return k
+		}
+		if b.ModTime().After(fi.ModTime()) {
+			newer = k
+		}
+	}
+}
+
+// errNotLines is what Follow stops at in a log it can't read as lines.
+var errNotLines = errors.New("logger: Follow reads text or JSON lines; read binary or compressed logs with ReadAll")
+
+// follow is Follow's goroutine, starting with f if it is open.
+func (r *LogReader) follow(ctx context.Context, out chan<- LogEntry, f *os.File) error {
+	poll := r.Poll
+	if poll <= 0 {
+		poll = 10 * time.Millisecond
+	}
+	wait := func() error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(poll):
+			return nil
+		}
+	}
+
+	var (
+		fi      os.FileInfo
+		br      *bufio.Reader
+		off     int64
+		partial []byte // a line read up to the end of the file, so far
+		checked bool   // the file's first byte has been seen to start a line
+		rotated bool   // path names another file: read this one's last entries
+	)
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	// use starts reading f from the top.
+	use := func() error {
+		var err error
+		if fi, err = f.Stat(); err != nil {
+			return err
+		}
+		br, off, partial, checked, rotated = bufio.NewReaderSize(f, 64*1024), 0, partial[:0], false, false
+		return nil
+	}
+	// open waits for name to exist and uses it.
+	open := func(name string) error {
+		if f != nil {
+			f.Close()
+			f = nil
+		}
+		for {
+			var err error
+			if f, err = os.Open(name); err == nil {
+				return use()
+			}
+			if !os.IsNotExist(err) {
+				return err
+			}
+			if err := wait(); err != nil {
+				return err
+			}
+		}
+	}
+	start := use
+	if f == nil {
+		start = func() error { return open(r.path) }
+	}
+	if err := start(); err != nil {
+		return err
+	}
+
+	for {
+		if !checked {
+			if b, err := br.Peek(1); err == nil {
+				if b[0] != '[' && b[0] != '{' {
+					return errNotLines
+				}
+				checked = true
+			}
+		}
+		chunk, err := br.ReadBytes('\n')
+		off += int64(len(chunk))
+		partial = append(partial, chunk...)
+		if err == nil {
+			line := strings.TrimSuffix(string(partial), "\n")
+			partial = partial[:0]
+			e, perr := ParseEntry(line)
+			if perr != nil {
+				r.Skipped++
+				continue
+			}
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+
+		// At the end: has the file been rotated away, or cut short?
+		if rotated {
+			// The old file was finished before it was renamed, and this
+			// pass has read what was written to it after the last. Go on
+			// to the file rotated in after it, which may be a backup by
+			// now too: path.k-1 if it is path.k.
+			if st, err := f.Stat(); err == nil {
+				fi = st // with its last write's time, for backupIndex
+			}
+			for {
+				old, k := fi, r.backupIndex(fi)
+				next := r.path
+				if k > 1 {
+					next = fmt.Sprintf("%s.%d", r.path, k-1)
+				}
+				if err := open(next); err != nil {
+					return err
+				}
+				if r.backupIndex(old) == k {
+					break
+				}
+				fi = old // rotated again while opening: look again
+			}
+			continue
+		}
+		now, err := os.Stat(r.path)
+		switch {
+		case err != nil && !os.IsNotExist(err):
+			return err
+		case err == nil && !os.SameFile(fi, now):
+			rotated = true
+			continue
+		case err == nil && now.Size() < off:
+			// Truncated, as a new logger's os.Create does.
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			br.Reset(f)
+			off, partial, checked = 0, partial[:0], false
+			continue
+		}
+		if err := wait(); err != nil {
+			return err
+		}
+	}
+}
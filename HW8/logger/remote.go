@@ -0,0 +1,197 @@
+package logger
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// Remote Logger
+// Sends each entry to a collector as a syslog message (see EncodeSyslog)
+// instead of writing a file: over UDP one message a datagram, as RFC
+// 5426 has it, or over TCP each prefixed with its length and a space,
+// RFC 6587's octet counting. Log sends its entry under a mutex and
+// returns; durability is the collector's. Over TCP the collector answers
+// each burst of messages, once it has synced them, with how many it has
+// synced so far (a little-endian uint64), so LogDurable waits for the
+// answer covering its entry and Close for every entry to be covered.
+// UDP has no answers: LogDurable returns once its datagram is sent, and
+// a datagram the network or a full socket buffer drops is gone.
+type RemoteLogger struct {
+	levelFilter
+	health
+	network string
+	conn    net.Conn
+	host    string
+	app     string
+	pid     int
+
+	mu   sync.Mutex // one message at a time
+	sent uint64     // messages sent
+
+	ackMu   sync.Mutex
+	ackCond *sync.Cond
+	acked   uint64 // messages the collector has synced (TCP)
+	ackErr  error  // why the collector stopped answering
+}
+
+// ErrCollectorGone is what a TCP logger's calls return once the
+// collector's connection has ended.
+var ErrCollectorGone = errors.New("logger: collector closed the connection")
+
+func NewRemoteLogger(network, addr string) (*RemoteLogger, error) {
+	return NewRemoteLoggerWith(network, addr, Options{})
+}
+
+// NewRemoteLoggerWith dials the collector at addr over network, "udp" or
+// "tcp". o's Encoder, Sync, Rotation and Compress are the collector's
+// business and ignored here.
+func NewRemoteLoggerWith(network, addr string, o Options) (*RemoteLogger, error) {
+	switch network {
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("logger: unknown network %q (udp, tcp)", network)
+	}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	l := &RemoteLogger{
+		network: network,
+		conn:    conn,
+		host:    host,
+		app:     filepath.Base(os.Args[0]),
+		pid:     os.Getpid(),
+	}
+	l.ackCond = sync.NewCond(&l.ackMu)
+	l.onError = o.OnError
+	l.SetLevel(o.MinLevel)
+	if network == "tcp" {
+		go l.readAcks()
+	}
+	return l, nil
+}
+
+// readAcks takes the collector's answers until the connection ends.
+func (l *RemoteLogger) readAcks() {
+	br := bufio.NewReader(l.conn)
+	var b [8]byte
+	for {
+		if _, err := io.ReadFull(br, b[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				err = ErrCollectorGone
+			}
+			l.ackMu.Lock()
+			l.ackErr = err
+			l.ackCond.Broadcast()
+			l.ackMu.Unlock()
+			return
+		}
+		l.ackMu.Lock()
+		l.acked = binary.LittleEndian.Uint64(b[:])
+		l.ackCond.Broadcast()
+		l.ackMu.Unlock()
+	}
+}
+
+// send sends entry and returns its number.
+func (l *RemoteLogger) send(entry LogEntry) (uint64, error) {
+	msg := EncodeSyslog(entry, l.host, l.app, l.pid)
+	if l.network == "tcp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := io.WriteString(l.conn, msg); err != nil {
+		return 0, l.fail(err)
+	}
+	l.wrote(len(msg))
+	l.sent++
+	return l.sent, nil
+}
+
+// waitAck waits until the collector has synced message n.
+func (l *RemoteLogger) waitAck(n uint64) error {
+	l.ackMu.Lock()
+	defer l.ackMu.Unlock()
+	for l.acked < n && l.ackErr == nil {
+		l.ackCond.Wait()
+	}
+	if l.acked >= n {
+		return nil
+	}
+	return l.fail(l.ackErr)
+}
+
+func (l *RemoteLogger) Log(entry LogEntry) error {
+	if l.drop(entry) {
+		return nil
+	}
+	_, err := l.send(entry)
+	return err
+}
+
+// LogCtx logs entry unless ctx has ended; sending waits for nothing but
+// the mutex and the socket.
+func (l *RemoteLogger) LogCtx(ctx context.Context, entry LogEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.Log(entry)
+}
+
+// LogDurable sends entry and, over TCP, waits for the collector to say
+// it has synced it.
+func (l *RemoteLogger) LogDurable(entry LogEntry) <-chan error {
+	if l.drop(entry) {
+		return acked(nil)
+	}
+	n, err := l.send(entry)
+	if err != nil || l.network != "tcp" {
+		return acked(err)
+	}
+	return acked(l.waitAck(n))
+}
+
+// Stats reports what has been sent; Pending is the messages the
+// collector hasn't yet said it synced (none over UDP), and Syncs stays 0:
+// the collector syncs.
+func (l *RemoteLogger) Stats() Stats {
+	// Acked first: it never passes sent, read after it.
+	l.ackMu.Lock()
+	acked := l.acked
+	l.ackMu.Unlock()
+	l.mu.Lock()
+	sent := l.sent
+	l.mu.Unlock()
+	var pending int64
+	if l.network == "tcp" {
+		pending = int64(sent - acked)
+	}
+	return l.stats(pending)
+}
+
+// Close waits, over TCP, for the collector to have synced everything
+// sent, and hangs up.
+func (l *RemoteLogger) Close() error {
+	var err error
+	if l.network == "tcp" {
+		l.mu.Lock()
+		sent := l.sent
+		l.mu.Unlock()
+		err = l.waitAck(sent)
+	}
+	if cerr := l.conn.Close(); err == nil {
+		err = l.fail(cerr)
+	}
+	return err
+}
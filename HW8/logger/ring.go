@@ -0,0 +1,296 @@
+package logger
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/cacheline"
+)
+
+// Ring Logger
+// Goroutines put entries in a fixed ring of slots without taking a lock,
+// and one flusher goroutine writes them out, like a small LMAX
+// disruptor. A producer claims the next sequence number with one atomic
+// add, waits for that slot to come free, fills it and publishes it by
+// storing the slot's sequence; the flusher takes published slots in
+// order and hands them back. With the ring full, producers wait for the
+// flusher rather than grow it. The flusher spins briefly when the ring
+// is empty and then sleeps until a producer wakes it, which producers
+// only pay for while it sleeps.
+// Batching: fsync every batchN entries (or as Options.Batch says), or
+// sooner for a durable entry once no published entry follows it, as
+// ChannelLogger does, and on a ticker with a FlushInterval: the flusher
+// looks at it between entries and wakes for it when asleep.
+type RingLogger struct {
+	levelFilter
+	lf    *logFile
+	slots []ringSlot
+	mask  uint64
+
+	tail cacheline.Padded[atomic.Uint64] // next sequence a producer claims
+	head cacheline.Padded[atomic.Uint64] // next sequence the flusher takes
+
+	sleeping atomic.Bool
+	wake     chan struct{}
+	ticker   *time.Ticker // every FlushInterval; nil without one
+	closed   atomic.Bool
+	done     chan struct{}
+
+	errMu   sync.Mutex
+	lastErr error
+
+	batchN  int
+	batches []int // the size of every batch synced, for BatchSizes
+}
+
+// ringSlot holds entry n when seq is n+1, and is free for entry n when
+// seq is n (it starts at its index, free for the first lap).
+type ringSlot struct {
+	seq   atomic.Uint64
+	entry LogEntry
+	ack   chan error // for LogDurable
+	_     cacheline.Pad
+}
+
+// ringSpins is how many times the flusher looks again before sleeping.
+const ringSpins = 64
+
+func NewRingLogger(path string, batchN int, size int) (*RingLogger, error) {
+	return NewRingLoggerWith(path, batchN, size, Options{})
+}
+
+// NewRingLoggerWith returns a ring logger with size slots, rounded up to
+// a power of two (1024 if size <= 0).
+func NewRingLoggerWith(path string, batchN int, size int, o Options) (*RingLogger, error) {
+	lf, err := openLogFile(path, o)
+	if err != nil {
+		return nil, err
+	}
+	if batchN <= 0 {
+		batchN = 1
+	}
+	if size <= 0 {
+		size = 1024
+	}
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+
+	l := &RingLogger{
+		lf:     lf,
+		slots:  make([]ringSlot, n),
+		mask:   uint64(n - 1),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		batchN: batchN,
+	}
+	for i := range l.slots {
+		l.slots[i].seq.Store(uint64(i))
+	}
+	l.SetLevel(o.MinLevel)
+
+	if o.FlushInterval > 0 {
+		l.ticker = time.NewTicker(o.FlushInterval)
+	}
+	go l.flusher()
+	return l, nil
+}
+
+func (l *RingLogger) setErr(err error) {
+	l.errMu.Lock()
+	defer l.errMu.Unlock()
+	if l.lastErr == nil {
+		l.lastErr = err
+	}
+}
+
+func (l *RingLogger) getErr() error {
+	l.errMu.Lock()
+	defer l.errMu.Unlock()
+	return l.lastErr
+}
+
+func (l *RingLogger) Log(entry LogEntry) error {
+	if l.drop(entry) {
+		return nil
+	}
+	// If the flusher hit an error, stop accepting logs
+	if err := l.getErr(); err != nil {
+		return err
+	}
+	l.put(entry, nil)
+	return nil
+}
+
+// LogCtx logs entry unless ctx has ended first. A producer that has
+// claimed a slot must fill it, or the flusher would wait on it forever,
+// so once claimed the call finishes.
+func (l *RingLogger) LogCtx(ctx context.Context, entry LogEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.Log(entry)
+}
+
+func (l *RingLogger) LogDurable(entry LogEntry) <-chan error {
+	if l.drop(entry) {
+		return acked(nil)
+	}
+	if err := l.getErr(); err != nil {
+		return acked(err)
+	}
+	ack := make(chan error, 1)
+	l.put(entry, ack)
+	return ack
+}
+
+// put claims the next slot and publishes entry in it.
+func (l *RingLogger) put(entry LogEntry, ack chan error) {
+	n := l.tail.V.Add(1) - 1
+	s := &l.slots[n&l.mask]
+	for s.seq.Load() != n {
+		runtime.Gosched() // full: wait for the flusher to free the slot
+	}
+	s.entry, s.ack = entry, ack
+	s.seq.Store(n + 1)
+	l.signal()
+}
+
+// signal wakes the flusher if it is asleep.
+func (l *RingLogger) signal() {
+	if l.sleeping.Load() && l.sleeping.CompareAndSwap(true, false) {
+		select {
+		case l.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (l *RingLogger) flusher() {
+	defer close(l.done)
+
+	policy := batchPolicy(l.lf.opts, l.batchN)
+	pending := 0
+	var acks []chan error // waiting on the next sync
+	syncBatch := func() {
+		l.batches = append(l.batches, pending)
+		pending = 0
+		err := l.lf.sync()
+		if err != nil {
+			l.setErr(err)
+		}
+		for _, ack := range acks {
+			ack <- err
+		}
+		acks = acks[:0]
+	}
+	var tick <-chan time.Time
+	if l.ticker != nil {
+		defer l.ticker.Stop()
+		tick = l.ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+			if pending > 0 {
+				syncBatch()
+			}
+		default:
+		}
+		n := l.head.V.Load()
+		s := &l.slots[n&l.mask]
+		if s.seq.Load() != n+1 {
+			if l.closed.Load() && n == l.tail.V.Load() {
+				break // everything claimed has been written
+			}
+			if l.idle(s, n, tick) && pending > 0 {
+				syncBatch()
+			}
+			continue
+		}
+		entry, ack := s.entry, s.ack
+		s.entry, s.ack = LogEntry{}, nil
+		s.seq.Store(n + uint64(len(l.slots))) // free for the next lap
+		l.head.V.Store(n + 1)
+
+		if err := l.lf.writeEntry(entry); err != nil {
+			l.setErr(err)
+			if ack != nil {
+				ack <- err
+			}
+			continue
+		}
+		if ack != nil {
+			acks = append(acks, ack)
+		}
+		pending++
+		if pending >= policy.Size(int(l.tail.V.Load()-n-1)) || len(acks) > 0 && l.slots[(n+1)&l.mask].seq.Load() != n+2 {
+			syncBatch()
+		}
+	}
+
+	if pending > 0 {
+		l.batches = append(l.batches, pending) // synced by close
+	}
+	l.setErr(l.lf.close())
+}
+
+// idle waits for slot s to be published as entry n: spinning a while,
+// then asleep until a producer (or Close) wakes it, or tick fires, which
+// it reports.
+func (l *RingLogger) idle(s *ringSlot, n uint64, tick <-chan time.Time) (ticked bool) {
+	for range ringSpins {
+		if s.seq.Load() == n+1 || l.closed.Load() {
+			return false
+		}
+		runtime.Gosched()
+	}
+	l.sleeping.Store(true)
+	// Look again: a producer that published before sleeping was set
+	// didn't know to wake us.
+	if s.seq.Load() == n+1 || l.closed.Load() {
+		if l.sleeping.CompareAndSwap(true, false) {
+			return false
+		}
+	}
+	select {
+	case <-l.wake:
+		return false
+	case <-tick:
+		// Awake on our own: a producer that already cleared sleeping
+		// leaves a wake behind, which the next sleep takes at once.
+		l.sleeping.Store(false)
+		return true
+	}
+}
+
+// BatchSizes returns how many entries each fsync the flusher did
+// covered, in order; call it after Close.
+func (l *RingLogger) BatchSizes() []int { return l.batches }
+
+// Stats reports what the flusher has written; Pending is the entries
+// claimed in the ring and not yet taken.
+func (l *RingLogger) Stats() Stats {
+	head := l.head.V.Load()
+	return l.lf.stats(int64(l.tail.V.Load() - head))
+}
+
+// Health returns the last error the flusher hit, without waiting for a
+// Log to return it.
+func (l *RingLogger) Health() error { return l.lf.Health() }
+
+func (l *RingLogger) Close() error {
+	l.closed.Store(true)
+	l.sleeping.Store(false)
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	<-l.done
+	return l.getErr()
+}
@@ -0,0 +1,194 @@
+package logger
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sharded Logger
+// K MutexLoggers, each with its own file, buffer, lock and fsync batch;
+// an entry goes to the shard its key hashes to, so producers with
+// different keys rarely contend. The key is the entry's Context unless
+// the logger is given another: keying by producer keeps each producer's
+// entries in one file, in order. MergeShards joins the files afterwards
+// into one log in timestamp order.
+type ShardedLogger struct {
+	levelFilter
+	shards []*MutexLogger
+	key    func(LogEntry) string
+}
+
+// ShardPath is the file shard i of a sharded log at path writes:
+// "app.log" shard 2 is "app.2.log".
+func ShardPath(path string, i int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(path, ext), i, ext)
+}
+
+func NewShardedLogger(path string, shards int, batchN int) (*ShardedLogger, error) {
+	return NewShardedLoggerWith(path, shards, batchN, nil, Options{})
+}
+
+// NewShardedLoggerWith returns a logger writing shards files (at least
+// one) named by ShardPath, choosing each entry's shard by key (Context
+// if nil).
+func NewShardedLoggerWith(path string, shards int, batchN int, key func(LogEntry) string, o Options) (*ShardedLogger, error) {
+	if shards <= 0 {
+		shards = 1
+	}
+	if key == nil {
+		key = func(e LogEntry) string { return e.Context }
+	}
+	l := &ShardedLogger{key: key}
+	l.SetLevel(o.MinLevel)
+	o.MinLevel = LevelDebug // filtered here, once
+	for i := 0; i < shards; i++ {
+		s, err := NewMutexLoggerWith(ShardPath(path, i), batchN, o)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.shards = append(l.shards, s)
+	}
+	return l, nil
+}
+
+// shard returns the shard e's key hashes to.
+func (l *ShardedLogger) shard(e LogEntry) *MutexLogger {
+	h := fnv.New32a()
+	h.Write([]byte(l.key(e)))
+	return l.shards[h.Sum32()%uint32(len(l.shards))]
+}
+
+func (l *ShardedLogger) Log(entry LogEntry) error {
+	if l.drop(entry) {
+		return nil
+	}
+	return l.shard(entry).Log(entry)
+}
+
+func (l *ShardedLogger) LogCtx(ctx context.Context, entry LogEntry) error {
+	if l.drop(entry) {
+		return nil
+	}
+	return l.shard(entry).LogCtx(ctx, entry)
+}
+
+// LogDurable logs entry and syncs its shard's batch at once, as
+// MutexLogger does; the other shards carry on.
+func (l *ShardedLogger) LogDurable(entry LogEntry) <-chan error {
+	if l.drop(entry) {
+		return acked(nil)
+	}
+	return l.shard(entry).LogDurable(entry)
+}
+
+// Close closes every shard, returning the first error.
+func (l *ShardedLogger) Close() error {
+	var first error
+	for _, s := range l.shards {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Stats adds up the shards' stats; LastErr is the lowest shard's.
+func (l *ShardedLogger) Stats() Stats {
+	var st Stats
+	for _, s := range l.shards {
+		ss := s.Stats()
+		st.Pending += ss.Pending
+		st.Entries += ss.Entries
+		st.Bytes += ss.Bytes
+		st.Syncs += ss.Syncs
+		if st.LastErr == nil {
+			st.LastErr = ss.LastErr
+		}
+	}
+	return st
+}
+
+// Health returns the lowest shard's last error.
+func (l *ShardedLogger) Health() error { return l.Stats().LastErr }
+
+// MergeShards writes the shards files of a sharded log at path into one
+// log at path, in timestamp order, and returns how many lines it wrote.
+// It merges the files as they are, taking the earliest line at the head
+// of any shard each time, so each shard's lines keep their order; among
+// equal timestamps (text keeps only seconds) the lowest shard goes
+// first. A line that doesn't parse is written in its place, as late as
+// the line before it. Shards are read as OpenLog reads them, rotated
+// segments and all; the merged log is written uncompressed.
+func MergeShards(path string, shards int) (int, error) {
+	type head struct {
+		sc   *bufio.Scanner
+		line string
+		t    time.Time
+		ok   bool
+	}
+	heads := make([]*head, shards)
+	for i := range heads {
+		f, err := OpenLog(ShardPath(path, i))
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, 1<<20)
+		heads[i] = &head{sc: sc}
+	}
+	next := func(h *head) error {
+		h.ok = h.sc.Scan()
+		if !h.ok {
+			return h.sc.Err()
+		}
+		h.line = h.sc.Text()
+		if e, err := ParseEntry(h.line); err == nil {
+			h.t = e.Timestamp
+		}
+		return nil
+	}
+	for _, h := range heads {
+		if err := next(h); err != nil {
+			return 0, err
+		}
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriterSize(out, 64*1024)
+	n := 0
+	for {
+		var min *head
+		for _, h := range heads {
+			if h.ok && (min == nil || h.t.Before(min.t)) {
+				min = h
+			}
+		}
+		if min == nil {
+			break
+		}
+		bw.WriteString(min.line)
+		bw.WriteByte('\n')
+		n++
+		if err := next(min); err != nil {
+			out.Close()
+			return n, err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		out.Close()
+		return n, err
+	}
+	return n, out.Close()
+}
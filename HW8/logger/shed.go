@@ -0,0 +1,207 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Load shedding
+// A Filter decides, before a logger does any work for an entry, whether
+// to keep it; Filtered puts filters in front of any logger. Shedding
+// entries this way means fewer writes and, for the batching loggers,
+// fewer fsyncs, at the price of the entries suppressed, which each
+// filter counts. RateLimiter keeps a steady rate with some burst on
+// top; Sampler keeps a fraction of the entries at each level.
+
+// Filter decides which entries reach a logger. Allow is called from any
+// goroutine; Suppressed is how many entries it has turned away.
+type Filter interface {
+	Allow(e LogEntry) bool
+	Suppressed() int64
+}
+
+// ErrSuppressed is what a suppressed durable entry's channel receives.
+var ErrSuppressed = errors.New("logger: entry suppressed by a filter")
+
+// RateLimiter is a token bucket: it allows an entry when it has a token,
+// earning rate tokens a second and holding at most burst of them, and
+// suppresses the entry when it has none. It starts full.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time // when tokens was last brought up to date
+
+	suppressed atomic.Int64
+}
+
+// NewRateLimiter returns a limiter allowing rate entries a second, and
+// bursts of up to burst (at least one).
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	b := float64(max(burst, 1))
+	return &RateLimiter{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+func (r *RateLimiter) Allow(LogEntry) bool {
+	r.mu.Lock()
+	now := time.Now()
+	r.tokens = min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+	r.last = now
+	ok := r.tokens >= 1
+	if ok {
+		r.tokens--
+	}
+	r.mu.Unlock()
+	if !ok {
+		r.suppressed.Add(1)
+	}
+	return ok
+}
+
+func (r *RateLimiter) Suppressed() int64 { return r.suppressed.Load() }
+
+// Sampler keeps one in every[level] entries at each level, at random,
+// and every entry at a level it has no rate for (or a rate of 1 or
+// less), as well as any level ParseLevel doesn't know.
+type Sampler struct {
+	every      [LevelError + 1]int
+	suppressed atomic.Int64
+}
+
+// NewSampler returns a sampler keeping one in every[l] entries at level
+// l: {LevelDebug: 100} keeps a hundredth of DEBUG entries and all the
+// rest.
+func NewSampler(every map[Level]int) *Sampler {
+	s := &Sampler{}
+	for l, n := range every {
+		if l >= LevelDebug && l <= LevelError {
+			s.every[l] = n
+		}
+	}
+	return s
+}
+
+func (s *Sampler) Allow(e LogEntry) bool {
+	l, err := ParseLevel(e.Level)
+	if err != nil || s.every[l] <= 1 || rand.IntN(s.every[l]) == 0 {
+		return true
+	}
+	s.suppressed.Add(1)
+	return false
+}
+
+func (s *Sampler) Suppressed() int64 { return s.suppressed.Load() }
+
+// FilteredLogger is a logger behind filters: an entry reaches it only if
+// every filter, in order, allows it, and the first to refuse it counts
+// it. An entry below the logger's level is passed straight on for the
+// logger to drop, so it spends no tokens and isn't counted. A suppressed
+// entry's Log returns nil, and its LogDurable's channel ErrSuppressed.
+// Stats, Health, Level and SetLevel are the logger's own, where it has
+// them.
+type FilteredLogger struct {
+	l       DurableLogger
+	filters []Filter
+}
+
+// Filtered returns l behind filters. Filtered loggers nest, so
+// Filtered(Filtered(l, a), b) asks b and then a.
+func Filtered(l DurableLogger, filters ...Filter) *FilteredLogger {
+	return &FilteredLogger{l: l, filters: filters}
+}
+
+// Unwrap returns the logger behind the filters.
+func (f *FilteredLogger) Unwrap() DurableLogger { return f.l }
+
+// Filters returns the filters, so that another logger can be put behind
+// the same ones, sharing their tokens and counts.
+func (f *FilteredLogger) Filters() []Filter { return f.filters }
+
+// allow reports whether e gets through to the logger.
+func (f *FilteredLogger) allow(e LogEntry) bool {
+	if ll, ok := f.l.(LevelLogger); ok && !ll.Level().Enabled(e.Level) {
+		return true // for the logger to drop
+	}
+	for _, flt := range f.filters {
+		if !flt.Allow(e) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *FilteredLogger) Log(entry LogEntry) error {
+	if !f.allow(entry) {
+		return nil
+	}
+	return f.l.Log(entry)
+}
+
+func (f *FilteredLogger) LogCtx(ctx context.Context, entry LogEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !f.allow(entry) {
+		return nil
+	}
+	return f.l.LogCtx(ctx, entry)
+}
+
+func (f *FilteredLogger) LogDurable(entry LogEntry) <-chan error {
+	if !f.allow(entry) {
+		return acked(ErrSuppressed)
+	}
+	return f.l.LogDurable(entry)
+}
+
+func (f *FilteredLogger) Close() error { return f.l.Close() }
+
+// Suppressed is how many entries the filters have turned away, those
+// of a FilteredLogger behind this one included.
+func (f *FilteredLogger) Suppressed() int64 {
+	var n int64
+	for _, flt := range f.filters {
+		n += flt.Suppressed()
+	}
+	if inner, ok := f.l.(*FilteredLogger); ok {
+		n += inner.Suppressed()
+	}
+	return n
+}
+
+// Stats is the logger's; one without Stats reports none.
+func (f *FilteredLogger) Stats() Stats {
+	if h, ok := f.l.(HealthLogger); ok {
+		return h.Stats()
+	}
+	return Stats{}
+}
+
+// Health is the logger's; one without Health reports nil.
+func (f *FilteredLogger) Health() error {
+	if h, ok := f.l.(HealthLogger); ok {
+		return h.Health()
+	}
+	return nil
+}
+
+// Level is the logger's minimum level; LevelDebug for one without.
+func (f *FilteredLogger) Level() Level {
+	if ll, ok := f.l.(LevelLogger); ok {
+		return ll.Level()
+	}
+	return LevelDebug
+}
+
+// SetLevel sets the logger's minimum level, if it has one.
+func (f *FilteredLogger) SetLevel(min Level) {
+	if ll, ok := f.l.(LevelLogger); ok {
+		ll.SetLevel(min)
+	}
+}
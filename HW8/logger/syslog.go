@@ -0,0 +1,175 @@
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A syslog message, as RemoteLogger sends an entry, is RFC 5424's
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID - [hw8@32473 context="..."][fields@32473 k="v" ...] MSG
+//
+// PRI is facility user (1) times 8 plus the severity the entry's level
+// maps to: DEBUG 7, INFO 6, WARN 4, ERROR 3; another level is sent as
+// notice (5) with the level itself in a level parameter. The timestamp
+// keeps microseconds, all RFC 5424 allows. The context, and any clock,
+// go in one structured-data element and the fields in another; 32473 is
+// the enterprise number RFC 5424 reserves for examples.
+const (
+	syslogFacility = 1 // user-level messages
+	syslogTime     = "2006-01-02T15:04:05.000000Z07:00"
+	sdMeta         = "hw8@32473"
+	sdFields       = "fields@32473"
+)
+
+var severities = map[string]int{"DEBUG": 7, "INFO": 6, "WARN": 4, "ERROR": 3}
+
+// severityNames names each severity for ParseSyslog, with the levels'
+// own names for theirs.
+var severityNames = [8]string{"EMERG", "ALERT", "CRIT", "ERROR", "WARN", "NOTICE", "INFO", "DEBUG"}
+
+// EncodeSyslog returns e as a syslog message from app, process pid, on
+// host.
+func EncodeSyslog(e LogEntry, host, app string, pid int) string {
+	sev, ok := severities[e.Level]
+	if !ok {
+		sev = 5
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - [%s", syslogFacility*8+sev, e.Timestamp.Format(syslogTime), nilValue(host), nilValue(app), pid, sdMeta)
+	param := func(k, v string) {
+		b.WriteString(" " + k + `="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(v))
+		b.WriteByte('"')
+	}
+	param("context", e.Context)
+	if e.Clock != "" {
+		param("clock", e.Clock)
+	}
+	if !ok {
+		param("level", e.Level)
+	}
+	b.WriteByte(']')
+	if len(e.Fields) > 0 {
+		b.WriteString("[" + sdFields)
+		for _, k := range fieldKeys(e.Fields) {
+			param(k, fmt.Sprint(e.Fields[k]))
+		}
+		b.WriteByte(']')
+	}
+	b.WriteString(" " + e.Message)
+	return b.String()
+}
+
+// nilValue is s, or RFC 5424's "-" for an empty header field.
+func nilValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n") {
+		return "-"
+	}
+	return s
+}
+
+// ParseSyslog reads back a message EncodeSyslog wrote. A field's value
+// that reads as an integer comes back as an int64, the rest as strings:
+// structured data has no types.
+func ParseSyslog(msg string) (LogEntry, error) {
+	bad := func(why string) (LogEntry, error) {
+		return LogEntry{}, fmt.Errorf("malformed syslog message %q: %s", msg, why)
+	}
+	rest, ok := strings.CutPrefix(msg, "<")
+	if !ok {
+		return bad("no PRI")
+	}
+	pri, rest, ok := strings.Cut(rest, ">")
+	p, err := strconv.Atoi(pri)
+	if !ok || err != nil || p < 0 {
+		return bad("bad PRI")
+	}
+	head := strings.SplitN(rest, " ", 7)
+	if len(head) < 7 || head[0] != "1" {
+		return bad("short header")
+	}
+	t, err := time.Parse(time.RFC3339Nano, head[1])
+	if err != nil {
+		return bad(err.Error())
+	}
+	e := LogEntry{Timestamp: t, Level: severityNames[p%8]}
+
+	// Structured data: "-" or elements, each "[id k="v" ...]".
+	rest = head[6]
+	if r, ok := strings.CutPrefix(rest, "-"); ok {
+		rest = r
+	}
+	for strings.HasPrefix(rest, "[") {
+		end := -1
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\\' {
+				i++
+			} else if rest[i] == '"' {
+				for i++; i < len(rest) && rest[i] != '"'; i++ {
+					if rest[i] == '\\' {
+						i++
+					}
+				}
+			} else if rest[i] == ']' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return bad("unterminated structured data")
+		}
+		id, params, err := parseSD(rest[1:end])
+		if err != nil {
+			return bad(err.Error())
+		}
+		rest = rest[end+1:]
+		switch id {
+		case sdMeta:
+			e.Context, e.Clock = params["context"], params["clock"]
+			if l, ok := params["level"]; ok {
+				e.Level = l
+			}
+		case sdFields:
+			e.Fields = make(map[string]any, len(params))
+			for k, v := range params {
+				if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+					e.Fields[k] = n
+				} else {
+					e.Fields[k] = v
+				}
+			}
+		}
+	}
+	e.Message = strings.TrimPrefix(rest, " ")
+	return e, nil
+}
+
+// parseSD splits the inside of a structured-data element into its ID
+// and parameters, unescaping the values.
+func parseSD(s string) (string, map[string]string, error) {
+	id, s, _ := strings.Cut(s, " ")
+	params := map[string]string{}
+	for s != "" {
+		k, after, ok := strings.Cut(s, `="`)
+		if !ok {
+			return "", nil, fmt.Errorf("bad parameter in %s", id)
+		}
+		var v strings.Builder
+		i := 0
+		for ; i < len(after) && after[i] != '"'; i++ {
+			if after[i] == '\\' && i+1 < len(after) {
+				i++
+			}
+			v.WriteByte(after[i])
+		}
+		if i == len(after) {
+			return "", nil, fmt.Errorf("unterminated value in %s", id)
+		}
+		params[k] = v.String()
+		s = strings.TrimPrefix(after[i+1:], " ")
+	}
+	return id, params, nil
+}
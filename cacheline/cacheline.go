@@ -0,0 +1,33 @@
+// Package cacheline keeps values that different goroutines write off each
+// other's cache lines. Two counters in one line are false sharing: the
+// goroutines never touch each other's counter, but every write takes the
+// whole line away from the other core, so they run as if they shared one.
+// HW4's harness has it, a []Counter with one element per worker, and
+// cmd/falseshare measures what it costs.
+package cacheline
+
+import "sync/atomic"
+
+// Pad is a cache line of padding.
+type Pad [Size]byte
+
+// Padded holds a V with a cache line of padding on each side, so it has
+// its line to itself wherever it's placed, in a slice or a struct.
+type Padded[T any] struct {
+	_ Pad
+	V T
+	_ Pad
+}
+
+// Counter is an atomic counter alone on its cache line; a []Counter
+// gives each worker its own line.
+type Counter struct {
+	n atomic.Uint64
+	_ [Size - 8]byte
+}
+
+// Add adds d and returns the new count.
+func (c *Counter) Add(d uint64) uint64 { return c.n.Add(d) }
+
+// Load returns the count.
+func (c *Counter) Load() uint64 { return c.n.Load() }
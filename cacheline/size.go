@@ -0,0 +1,6 @@
+//go:build !arm64
+
+package cacheline
+
+// Size is the cache line size in bytes: 64 on x86 and most others.
+const Size = 64
@@ -0,0 +1,5 @@
+package cacheline
+
+// Size is the cache line size in bytes. Most arm64 cores use 64, but
+// Apple's use 128, and padding to the larger is only wasted space.
+const Size = 128
@@ -0,0 +1,317 @@
+// Package cgroup is a user-space imitation of the Linux cgroup CPU
+// controller for groups of goroutine tasks. Each Group has cpu.shares,
+// a weight that decides how the CPUs are split when groups compete, and
+// optionally a quota (cpu.max), the most CPUs it may use however idle
+// the rest are. An Executor runs tasks on a fixed number of cores, at
+// most one task per core, and gives each group a token bucket of CPU
+// time, refilled every Period at the rate the group is entitled to: its
+// share of the cores among the groups with tasks to run, capped by its
+// quota. Go can't stop a goroutine from outside, so tasks call
+// Checkpoint.Check between pieces of work; Check charges the CPU time
+// used since the last one to the group and, once the bucket is empty,
+// gives up the core until the next refill (the group is throttled).
+// Check also hands the core on after a Period, so tasks of one group
+// take turns.
+//
+// Stats are the cpu.stat counters: usage, periods the group was busy,
+// periods it was throttled in, and time its tasks spent throttled.
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Group is a cgroup's CPU settings.
+type Group struct {
+	Name   string
+	Shares int     // weight among competing groups; 1024 is the Linux default
+	Quota  float64 // most CPUs the group may use (0: no limit)
+}
+
+// Config is an executor's settings.
+type Config struct {
+	CPUs   int           // cores: tasks running at once, at most GOMAXPROCS for usage to be CPU time
+	Period time.Duration // how often buckets refill, and a task's longest turn
+}
+
+// DefaultConfig uses every CPU and Linux's 100ms CFS bandwidth period
+// cut to 10ms, so short experiments see many periods.
+var DefaultConfig = Config{CPUs: runtime.NumCPU(), Period: 10 * time.Millisecond}
+
+var (
+	ErrUnknownGroup = errors.New("cgroup: unknown group")
+	ErrStopped      = errors.New("cgroup: executor stopped")
+)
+
+// ParseGroup reads a group written "name:shares" or "name:shares:quota",
+// shares defaulting to 1024 when only a name is given.
+func ParseGroup(s string) (Group, error) {
+	f := strings.Split(strings.TrimSpace(s), ":")
+	g := Group{Name: f[0], Shares: 1024}
+	var err error
+	if len(f) > 1 {
+		g.Shares, err = strconv.Atoi(f[1])
+	}
+	if err == nil && len(f) > 2 {
+		g.Quota, err = strconv.ParseFloat(f[2], 64)
+	}
+	if err != nil || g.Name == "" || len(f) > 3 || g.Shares < 1 || g.Quota < 0 {
+		return Group{}, fmt.Errorf("cgroup: bad group %q (name:shares[:quota])", s)
+	}
+	return g, nil
+}
+
+// Entitled is the CPUs each group gets when all of them compete for
+// cpus: shares in proportion to Shares, where a group capped by its
+// Quota gives what it can't use to the others.
+func Entitled(cpus float64, groups []Group) []float64 {
+	out := make([]float64, len(groups))
+	open := make([]bool, len(groups))
+	for i := range open {
+		open[i] = true
+	}
+	left := cpus
+	for {
+		total := 0
+		for i, g := range groups {
+			if open[i] {
+				total += g.Shares
+			}
+		}
+		if total == 0 {
+			return out
+		}
+		capped := false
+		for i, g := range groups {
+			if fair := left * float64(g.Shares) / float64(total); open[i] && g.Quota > 0 && g.Quota < fair {
+				out[i], open[i], capped = g.Quota, false, true
+				left -= g.Quota
+			}
+		}
+		if !capped {
+			for i, g := range groups {
+				if open[i] {
+					out[i] = left * float64(g.Shares) / float64(total)
+				}
+			}
+			return out
+		}
+	}
+}
+
+// Stats is a group's accounting.
+type Stats struct {
+	Group         string
+	Tasks         int           // tasks started
+	Usage         time.Duration // CPU time charged
+	Periods       int           // periods in which the group had tasks
+	Throttled     int           // periods in which it ran out of tokens
+	ThrottledTime time.Duration // time its tasks waited for tokens, summed
+	Rate          float64       // CPUs it was entitled to at the last refill
+}
+
+// group is a Group being run.
+type group struct {
+	Group
+	tokens    time.Duration // may go negative: work between checkpoints overdraws
+	live      int           // tasks started and not finished
+	throttled bool          // ran out during this period
+	stats     Stats
+}
+
+// Executor runs tasks in groups; see the package comment.
+type Executor struct {
+	c      Config
+	cores  chan struct{}
+	mu     sync.Mutex
+	refill *sync.Cond
+	groups map[string]*group
+	order  []string
+	wg     sync.WaitGroup
+	ticker *time.Ticker
+	done   chan struct{}
+	stop   bool
+}
+
+// New returns an executor for groups, refilling their buckets until
+// Close.
+func New(c Config, groups ...Group) (*Executor, error) {
+	if c.CPUs < 1 || c.Period <= 0 {
+		return nil, fmt.Errorf("cgroup: need at least 1 CPU and a positive period, got %d and %v", c.CPUs, c.Period)
+	}
+	e := &Executor{c: c, cores: make(chan struct{}, c.CPUs), groups: map[string]*group{}, done: make(chan struct{})}
+	e.refill = sync.NewCond(&e.mu)
+	for _, g := range groups {
+		if g.Shares < 1 || g.Quota < 0 {
+			return nil, fmt.Errorf("cgroup: group %q needs positive shares and a quota of at least 0, got %d and %g", g.Name, g.Shares, g.Quota)
+		}
+		if _, dup := e.groups[g.Name]; dup {
+			return nil, fmt.Errorf("cgroup: group %q defined twice", g.Name)
+		}
+		e.groups[g.Name] = &group{Group: g, stats: Stats{Group: g.Name}}
+		e.order = append(e.order, g.Name)
+	}
+	e.ticker = time.NewTicker(c.Period)
+	go e.run()
+	return e, nil
+}
+
+// run refills the buckets every period.
+func (e *Executor) run() {
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-e.ticker.C:
+		}
+		e.mu.Lock()
+		var busy []*group
+		var caps []Group
+		for _, name := range e.order {
+			if g := e.groups[name]; g.live > 0 {
+				// A group can't use more cores than it has tasks.
+				c := g.Group
+				if c.Quota == 0 || c.Quota > float64(g.live) {
+					c.Quota = float64(g.live)
+				}
+				busy, caps = append(busy, g), append(caps, c)
+			}
+		}
+		for i, rate := range Entitled(float64(e.c.CPUs), caps) {
+			g, budget := busy[i], time.Duration(rate*float64(e.c.Period))
+			g.tokens = min(g.tokens+budget, budget)
+			g.stats.Rate = rate
+			g.stats.Periods++
+			if g.throttled {
+				g.stats.Throttled++
+				g.throttled = false
+			}
+		}
+		e.mu.Unlock()
+		e.refill.Broadcast()
+	}
+}
+
+// Go starts task in group. The task must call cp.Check every so often,
+// and return once Check returns false.
+func (e *Executor) Go(group string, task func(cp *Checkpoint)) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	g, ok := e.groups[group]
+	switch {
+	case !ok:
+		return fmt.Errorf("%w %q", ErrUnknownGroup, group)
+	case e.stop:
+		return ErrStopped
+	}
+	g.live++
+	g.stats.Tasks++
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		cp := &Checkpoint{e: e, g: g}
+		cp.acquire()
+		task(cp)
+		e.mu.Lock()
+		cp.charge()
+		g.live--
+		e.mu.Unlock()
+		<-e.cores
+	}()
+	return nil
+}
+
+// Stop makes every Check return false from now on, and Go fail.
+func (e *Executor) Stop() {
+	e.mu.Lock()
+	e.stop = true
+	e.mu.Unlock()
+	e.refill.Broadcast()
+}
+
+// Wait waits for every task started to return.
+func (e *Executor) Wait() { e.wg.Wait() }
+
+// Close stops the executor, waits for its tasks and stops refilling.
+func (e *Executor) Close() {
+	e.Stop()
+	e.Wait()
+	e.ticker.Stop()
+	close(e.done)
+}
+
+// Stats returns every group's accounting, in the order given to New.
+func (e *Executor) Stats() []Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]Stats, 0, len(e.order))
+	for _, name := range e.order {
+		out = append(out, e.groups[name].stats)
+	}
+	return out
+}
+
+// Checkpoint is a running task's handle on its executor.
+type Checkpoint struct {
+	e     *Executor
+	g     *group
+	since time.Time // when the CPU time not yet charged began
+	turn  time.Time // when the task got its core
+}
+
+// acquire waits for a core.
+func (cp *Checkpoint) acquire() {
+	cp.e.cores <- struct{}{}
+	cp.since = time.Now()
+	cp.turn = cp.since
+}
+
+// charge bills the group for the time since the last charge; e.mu is
+// held.
+func (cp *Checkpoint) charge() {
+	now := time.Now()
+	used := now.Sub(cp.since)
+	cp.since = now
+	cp.g.tokens -= used
+	cp.g.stats.Usage += used
+}
+
+// Check charges the CPU time used since the last Check, waits without a
+// core while the group is throttled, and yields the core after a whole
+// period. It reports whether the task should go on: false once the
+// executor is stopping.
+func (cp *Checkpoint) Check() bool {
+	e := cp.e
+	e.mu.Lock()
+	cp.charge()
+	if e.stop {
+		e.mu.Unlock()
+		return false
+	}
+	if cp.g.tokens > 0 {
+		e.mu.Unlock()
+		if time.Since(cp.turn) >= e.c.Period {
+			<-e.cores
+			cp.acquire()
+		}
+		return true
+	}
+
+	cp.g.throttled = true
+	<-e.cores
+	began := time.Now()
+	for cp.g.tokens <= 0 && !e.stop {
+		e.refill.Wait()
+	}
+	cp.g.stats.ThrottledTime += time.Since(began)
+	stop := e.stop
+	e.mu.Unlock()
+	cp.acquire()
+	return !stop
+}
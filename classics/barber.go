@@ -0,0 +1,214 @@
+package classics
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/locks"
+)
+
+// BarberConfig is a day at the barbershop: Customers arrive a random
+// 0-2*Arrive apart, and a customer who finds all Chairs in the waiting
+// room taken leaves without a haircut. The one barber takes Cut per
+// haircut and sleeps when nobody is waiting.
+type BarberConfig struct {
+	Customers, Chairs int
+	Cut, Arrive       time.Duration
+	Seed              int64
+}
+
+// DefaultBarber is a busy shop: customers come about as fast as the
+// barber cuts.
+var DefaultBarber = BarberConfig{Customers: 500, Chairs: 3, Cut: 200 * time.Microsecond, Arrive: 200 * time.Microsecond, Seed: 1}
+
+// barberShop is what both solutions share: the customers' outcomes and
+// the counts the checks watch.
+type barberShop struct {
+	c       BarberConfig
+	r       *Result
+	mu      sync.Mutex // guards r and wait
+	served  []int32    // haircuts per customer
+	balked  atomic.Int64
+	inChair atomic.Int32
+	wait    time.Duration // total, of the customers served
+}
+
+// sit puts customer i in the barber's chair, where nobody else may be.
+func (s *barberShop) sit(i int, arrived time.Time) {
+	if s.inChair.Add(1) != 1 {
+		s.mu.Lock()
+		s.r.fail("customer %d sat in an occupied chair", i)
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	s.wait += time.Since(arrived)
+	s.mu.Unlock()
+	atomic.AddInt32(&s.served[i], 1)
+}
+
+func (s *barberShop) leave() { s.inChair.Add(-1) }
+
+func (s *barberShop) cut() {
+	if s.c.Cut > 0 {
+		time.Sleep(s.c.Cut)
+	}
+}
+
+// Barber runs the sleeping barber problem.
+func Barber(impl Impl, c BarberConfig) (Result, error) {
+	if c.Customers < 1 || c.Chairs < 1 || c.Cut < 0 || c.Arrive < 0 {
+		return Result{}, fmt.Errorf("classics: barber needs a customer and a chair, and times not negative")
+	}
+	r := Result{Problem: "barber", Impl: impl}
+	s := &barberShop{c: c, r: &r, served: make([]int32, c.Customers)}
+	var customer func(i int)
+	var closeShop func()
+	switch impl {
+	case Channels:
+		customer, closeShop = s.channels()
+	case Semaphores:
+		customer, closeShop = s.semaphores()
+	default:
+		return r, fmt.Errorf("classics: unknown implementation %v", impl)
+	}
+
+	rng := rand.New(rand.NewSource(c.Seed))
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < c.Customers; i++ {
+		if c.Arrive > 0 {
+			time.Sleep(time.Duration(rng.Int63n(2 * int64(c.Arrive))))
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			customer(i)
+		}(i)
+	}
+	wg.Wait()
+	closeShop()
+	r.Elapsed = time.Since(start)
+
+	served := 0
+	for i, n := range s.served {
+		if n > 1 {
+			r.fail("customer %d got %d haircuts", i, n)
+		}
+		served += int(n)
+	}
+	balked := int(s.balked.Load())
+	if served+balked != c.Customers {
+		r.fail("%d served and %d turned away, of %d customers", served, balked, c.Customers)
+	}
+	r.Ops = served
+	r.Notes = fmt.Sprintf("%d served, %d turned away", served, balked)
+	if served > 0 {
+		r.Notes += fmt.Sprintf(", mean wait %v", (s.wait / time.Duration(served)).Round(time.Microsecond))
+	}
+	return r, nil
+}
+
+// channels is the waiting room as a buffered channel: a customer who
+// can't send without blocking leaves, and the barber, ranging over the
+// room, sleeps in the receive when it's empty.
+func (s *barberShop) channels() (customer func(i int), closeShop func()) {
+	type visit struct {
+		arrived time.Time
+		called  chan struct{} // closed when the barber calls the customer in
+		done    chan struct{} // closed when the haircut is over
+		left    chan struct{} // closed when the customer is out of the chair
+	}
+	room := make(chan *visit, s.c.Chairs)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for v := range room {
+			close(v.called)
+			s.cut()
+			close(v.done)
+			<-v.left
+		}
+	}()
+	customer = func(i int) {
+		v := &visit{arrived: time.Now(),
+			called: make(chan struct{}), done: make(chan struct{}), left: make(chan struct{})}
+		select {
+		case room <- v:
+		default:
+			s.balked.Add(1)
+			return
+		}
+		<-v.called
+		s.sit(i, v.arrived)
+		<-v.done
+		s.leave()
+		close(v.left)
+	}
+	closeShop = func() {
+		close(room)
+		<-closed
+	}
+	return customer, closeShop
+}
+
+// semaphores is Downey's solution (5.2): a count of waiting customers
+// under a lock, a customer and a barber semaphore for the two to signal
+// each other ready, and a rendezvous at the end of the haircut.
+func (s *barberShop) semaphores() (customer func(i int), closeShop func()) {
+	var (
+		mu           locks.QueueLock // guards waiting and closing
+		waiting      int
+		closing      bool
+		customers    = locks.NewSemaphore(0) // customers waiting for the barber
+		barber       = locks.NewSemaphore(0) // the barber ready for the next one
+		customerDone = locks.NewSemaphore(0)
+		barberDone   = locks.NewSemaphore(0)
+		arrived      = make([]time.Time, s.c.Customers)
+		closed       = make(chan struct{})
+	)
+	go func() {
+		defer close(closed)
+		for {
+			customers.Wait()
+			mu.Lock()
+			if closing && waiting == 0 {
+				mu.Unlock()
+				return
+			}
+			waiting--
+			mu.Unlock()
+			barber.Post()
+			s.cut()
+			barberDone.Post()
+			customerDone.Wait()
+		}
+	}()
+	customer = func(i int) {
+		arrived[i] = time.Now()
+		mu.Lock()
+		if waiting == s.c.Chairs {
+			mu.Unlock()
+			s.balked.Add(1)
+			return
+		}
+		waiting++
+		mu.Unlock()
+		customers.Post()
+		barber.Wait()
+		s.sit(i, arrived[i])
+		barberDone.Wait()
+		s.leave()
+		customerDone.Post()
+	}
+	closeShop = func() {
+		mu.Lock()
+		closing = true
+		mu.Unlock()
+		customers.Post()
+		<-closed
+	}
+	return customer, closeShop
+}
@@ -0,0 +1,76 @@
+// Package classics solves textbook synchronization problems (the
+// sleeping barber, the cigarette smokers, and H2O, as in Downey's Little
+// Book of Semaphores) twice each: once with channels and goroutines doing
+// the coordinating, and once with the semaphores and condition variables
+// of package locks. Every run checks its own outcome (nobody served
+// twice, only the right smoker smoking, two hydrogens and one oxygen to a
+// molecule) and times itself.
+package classics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Impl is how a problem is solved.
+type Impl int
+
+const (
+	Channels Impl = iota
+	Semaphores
+)
+
+// Impls lists both implementations.
+var Impls = []Impl{Channels, Semaphores}
+
+func (i Impl) String() string {
+	switch i {
+	case Channels:
+		return "channels"
+	case Semaphores:
+		return "semaphores"
+	}
+	return fmt.Sprintf("Impl(%d)", int(i))
+}
+
+// ParseImpl returns the implementation named s.
+func ParseImpl(s string) (Impl, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "channels", "chan", "channel":
+		return Channels, nil
+	case "semaphores", "sem", "semaphore":
+		return Semaphores, nil
+	}
+	return 0, fmt.Errorf("classics: unknown implementation %q (channels, semaphores)", s)
+}
+
+// maxViolations caps how many violations a Result lists.
+const maxViolations = 10
+
+// Result is one run of a problem.
+type Result struct {
+	Problem    string
+	Impl       Impl
+	Ops        int // haircuts given, cigarettes smoked, or molecules made
+	Elapsed    time.Duration
+	Notes      string   // problem-specific counts
+	Violations []string // what the checks caught, the first maxViolations of them
+}
+
+// OK reports whether the run passed its checks.
+func (r Result) OK() bool { return len(r.Violations) == 0 }
+
+// PerSec is the run's throughput in Ops.
+func (r Result) PerSec() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Ops) / r.Elapsed.Seconds()
+}
+
+func (r *Result) fail(format string, args ...any) {
+	if len(r.Violations) < maxViolations {
+		r.Violations = append(r.Violations, fmt.Sprintf(format, args...))
+	}
+}
@@ -0,0 +1,182 @@
+package classics
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"example.com/operating-systems/locks"
+)
+
+// H2OConfig is how many water molecules to make: twice as many hydrogen
+// goroutines as oxygen ones start, in a random order.
+type H2OConfig struct {
+	Molecules int
+	Seed      int64
+}
+
+// DefaultH2O is ten thousand molecules.
+var DefaultH2O = H2OConfig{Molecules: 10000, Seed: 1}
+
+// Atom kinds.
+const (
+	hydrogen = iota
+	oxygen
+)
+
+// H2O runs the building-H2O problem: atoms arrive one goroutine each, and
+// must pass the barrier to bond in threes, two hydrogens and one oxygen
+// to a molecule, each atom knowing which molecule it's in.
+func H2O(impl Impl, c H2OConfig) (Result, error) {
+	if c.Molecules < 1 {
+		return Result{}, fmt.Errorf("classics: h2o needs at least 1 molecule")
+	}
+	r := Result{Problem: "h2o", Impl: impl}
+	var (
+		mu    sync.Mutex // guards bonds
+		bonds = map[int][2]int{}
+	)
+	// bond records an atom of kind k joining molecule m
+	bond := func(k, m int) {
+		mu.Lock()
+		b := bonds[m]
+		b[k]++
+		bonds[m] = b
+		mu.Unlock()
+	}
+	var atom func(k int)
+	var stop func()
+	switch impl {
+	case Channels:
+		atom, stop = h2oChannels(c.Molecules, bond)
+	case Semaphores:
+		atom, stop = h2oSemaphores(bond)
+	default:
+		return r, fmt.Errorf("classics: unknown implementation %v", impl)
+	}
+
+	kinds := make([]int, 3*c.Molecules)
+	for i := range kinds {
+		if i%3 == 2 {
+			kinds[i] = oxygen
+		}
+	}
+	rng := rand.New(rand.NewSource(c.Seed))
+	rng.Shuffle(len(kinds), func(i, j int) { kinds[i], kinds[j] = kinds[j], kinds[i] })
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, k := range kinds {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			atom(k)
+		}(k)
+	}
+	wg.Wait()
+	stop()
+	r.Elapsed = time.Since(start)
+
+	for m, b := range bonds {
+		if b[hydrogen] != 2 || b[oxygen] != 1 {
+			r.fail("molecule %d has %d hydrogens and %d oxygens", m, b[hydrogen], b[oxygen])
+		}
+	}
+	if len(bonds) != c.Molecules {
+		r.fail("made %d molecules, not %d", len(bonds), c.Molecules)
+	}
+	r.Ops = len(bonds)
+	r.Notes = fmt.Sprintf("%d atoms bonded", 3*c.Molecules)
+	return r, nil
+}
+
+// h2oChannels has a bonder goroutine take two hydrogens and an oxygen off
+// their queues for each molecule and tell each its molecule's number.
+func h2oChannels(molecules int, bond func(k, m int)) (atom func(k int), stop func()) {
+	var queues [2]chan chan int
+	queues[hydrogen], queues[oxygen] = make(chan chan int), make(chan chan int)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for m := 0; m < molecules; m++ {
+			h1, h2, o := <-queues[hydrogen], <-queues[hydrogen], <-queues[oxygen]
+			h1 <- m
+			h2 <- m
+			o <- m
+		}
+	}()
+	atom = func(k int) {
+		reply := make(chan int, 1)
+		queues[k] <- reply
+		bond(k, <-reply)
+	}
+	return atom, func() { <-done }
+}
+
+// h2oSemaphores is Downey's solution (5.6): whichever atom completes a
+// molecule, under the mutex, releases two hydrogens and an oxygen from
+// their queues and keeps the mutex; the three bond and meet at a barrier,
+// and the oxygen then releases the mutex for the next molecule.
+func h2oSemaphores(bond func(k, m int)) (atom func(k int), stop func()) {
+	var (
+		mu       = locks.NewSemaphore(1) // a semaphore: the oxygen releases it, not the locker
+		waiting  [2]int                  // atoms queued, by kind
+		queues   = [2]*locks.Semaphore{locks.NewSemaphore(0), locks.NewSemaphore(0)}
+		molecule = -1 // the molecule bonding now, set under mu
+		b        = newBarrier(3)
+	)
+	atom = func(k int) {
+		mu.Wait()
+		waiting[k]++
+		if waiting[hydrogen] >= 2 && waiting[oxygen] >= 1 {
+			waiting[hydrogen] -= 2
+			waiting[oxygen]--
+			molecule++
+			queues[hydrogen].Post()
+			queues[hydrogen].Post()
+			queues[oxygen].Post()
+		} else {
+			mu.Post()
+		}
+		queues[k].Wait()
+		bond(k, molecule)
+		b.wait()
+		if k == oxygen {
+			mu.Post()
+		}
+	}
+	return atom, func() {}
+}
+
+// barrier is a reusable barrier for n goroutines, on a lock and
+// condition variable from package locks; the generation keeps a fast
+// goroutine's next round from mixing with the stragglers of this one.
+type barrier struct {
+	l          locks.QueueLock
+	c          *locks.Cond
+	n, count   int
+	generation int
+}
+
+func newBarrier(n int) *barrier {
+	b := &barrier{n: n}
+	b.c = locks.NewCond(&b.l)
+	return b
+}
+
+func (b *barrier) wait() {
+	b.l.Lock()
+	defer b.l.Unlock()
+	g := b.generation
+	b.count++
+	if b.count == b.n {
+		b.count = 0
+		b.generation++
+		b.c.Broadcast()
+		return
+	}
+	for g == b.generation {
+		b.c.Wait()
+	}
+}
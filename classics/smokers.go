@@ -0,0 +1,223 @@
+package classics
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/locks"
+)
+
+// The three ingredients; smoker i has an endless supply of ingredient i.
+const (
+	tobacco = iota
+	paper
+	match
+)
+
+var ingredients = [3]string{"tobacco", "paper", "match"}
+
+// SmokersConfig is how many rounds the agent puts out ingredients.
+type SmokersConfig struct {
+	Rounds int
+	Seed   int64
+}
+
+// DefaultSmokers is twenty thousand rounds.
+var DefaultSmokers = SmokersConfig{Rounds: 20000, Seed: 1}
+
+// Smokers runs the cigarette smokers problem (Patil): each round the
+// agent, which can't be changed, signals two random ingredients
+// separately and waits for a cigarette to be smoked, and only the smoker
+// holding the third ingredient may take them. A smoker that simply waits
+// on its two missing ingredients can take one meant for another smoker and
+// deadlock, so both solutions put something between the agent and the
+// smokers that sees what's on the table.
+func Smokers(impl Impl, c SmokersConfig) (Result, error) {
+	if c.Rounds < 1 {
+		return Result{}, fmt.Errorf("classics: smokers needs at least 1 round")
+	}
+	r := Result{Problem: "smokers", Impl: impl}
+	var (
+		mu       sync.Mutex // guards r
+		missing  atomic.Int32
+		smoked   [3]int
+		expected [3]int
+	)
+	// smoke is smoker s taking the ingredients: it must be the one they
+	// were put out for
+	smoke := func(s int) {
+		if m := int(missing.Load()); m != s {
+			mu.Lock()
+			r.fail("the %s smoker took ingredients put out for the %s smoker", ingredients[s], ingredients[m])
+			mu.Unlock()
+		}
+		smoked[s]++
+	}
+	rng := rand.New(rand.NewSource(c.Seed))
+	// next picks the round's missing ingredient, returning the two the
+	// agent puts out
+	next := func() (int, int) {
+		m := rng.Intn(3)
+		expected[m]++
+		missing.Store(int32(m))
+		return (m + 1) % 3, (m + 2) % 3
+	}
+
+	start := time.Now()
+	switch impl {
+	case Channels:
+		smokersChannels(c.Rounds, next, smoke)
+	case Semaphores:
+		smokersSemaphores(c.Rounds, next, smoke)
+	default:
+		return r, fmt.Errorf("classics: unknown implementation %v", impl)
+	}
+	r.Elapsed = time.Since(start)
+
+	for s := range smoked {
+		r.Ops += smoked[s]
+		if smoked[s] != expected[s] {
+			r.fail("the %s smoker smoked %d times, for %d rounds missing %s", ingredients[s], smoked[s], expected[s], ingredients[s])
+		}
+	}
+	r.Notes = fmt.Sprintf("smoked %d/%d/%d (tobacco/paper/match)", smoked[tobacco], smoked[paper], smoked[match])
+	return r, nil
+}
+
+// smokersChannels puts a table goroutine in the middle: the agent sends
+// each ingredient on its own channel, the table collects them and, once
+// two are out, hands them to the smoker with the third, who tells the
+// agent it's done.
+func smokersChannels(rounds int, next func() (int, int), smoke func(int)) {
+	var put, take [3]chan struct{}
+	for i := range put {
+		put[i], take[i] = make(chan struct{}), make(chan struct{})
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		var on [3]bool
+		for {
+			var i int
+			select {
+			case <-put[tobacco]:
+				i = tobacco
+			case <-put[paper]:
+				i = paper
+			case <-put[match]:
+				i = match
+			case <-done:
+				for _, t := range take {
+					close(t)
+				}
+				return
+			}
+			on[i] = true
+			for s := range on {
+				if !on[s] && on[(s+1)%3] && on[(s+2)%3] {
+					on[(s+1)%3], on[(s+2)%3] = false, false
+					take[s] <- struct{}{}
+				}
+			}
+		}
+	}()
+	smokedCh := make(chan struct{})
+	for s := 0; s < 3; s++ {
+		go func(s int) {
+			defer wg.Done()
+			for range take[s] {
+				smoke(s)
+				smokedCh <- struct{}{}
+			}
+		}(s)
+	}
+	for round := 0; round < rounds; round++ {
+		a, b := next()
+		put[a] <- struct{}{}
+		put[b] <- struct{}{}
+		<-smokedCh
+	}
+	close(done)
+	wg.Wait()
+}
+
+// smokersSemaphores is Parnas's solution as Downey gives it (4.5): a
+// pusher per ingredient wakes on it, and under a mutex either finds one of
+// the others already out, and wakes the smoker who needs the pair, or
+// leaves word that its own is.
+func smokersSemaphores(rounds int, next func() (int, int), smoke func(int)) {
+	var (
+		agent   = locks.NewSemaphore(1)
+		mu      locks.QueueLock // guards on and done
+		on      [3]bool
+		done    bool
+		put     [3]*locks.Semaphore
+		smokers [3]*locks.Semaphore
+		wg      sync.WaitGroup
+	)
+	for i := range put {
+		put[i], smokers[i] = locks.NewSemaphore(0), locks.NewSemaphore(0)
+	}
+	isDone := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return done
+	}
+	wg.Add(6)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for {
+				put[i].Wait()
+				mu.Lock()
+				if done {
+					mu.Unlock()
+					return
+				}
+				j, k := (i+1)%3, (i+2)%3
+				switch {
+				case on[j]:
+					on[j] = false
+					smokers[k].Post()
+				case on[k]:
+					on[k] = false
+					smokers[j].Post()
+				default:
+					on[i] = true
+				}
+				mu.Unlock()
+			}
+		}(i)
+		go func(s int) {
+			defer wg.Done()
+			for {
+				smokers[s].Wait()
+				if isDone() {
+					return
+				}
+				smoke(s)
+				agent.Post()
+			}
+		}(i)
+	}
+	for round := 0; round < rounds; round++ {
+		agent.Wait()
+		a, b := next()
+		put[a].Post()
+		put[b].Post()
+	}
+	agent.Wait()
+	mu.Lock()
+	done = true
+	mu.Unlock()
+	for i := range put {
+		put[i].Post()
+		smokers[i].Post()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,144 @@
+// Package clist is HW3's concurrent linked lists, as a library: a
+// coarse-grained list behind a single mutex, and a hand-over-hand list
+// with a lock per node, where a traversal holds the lock of the node it
+// is on and the next one, so threads can walk different parts of the
+// list at once. Both insert at the head and support Contains; HW3's
+// benchmark (labs/lists) compares their throughput.
+package clist
+
+import "sync"
+
+/***************
+ * Common types
+ ***************/
+
+// List is a set of ints that goroutines can share.
+type List interface {
+	Insert(key int) bool   // insert at head (returns true if success)
+	Contains(key int) bool // lookup
+	Keys() []int           // every key, head to tail
+	// (Delete omitted for simplicity—bench focuses on Insert vs Contains)
+}
+
+/**********************************************
+ * 1) Coarse-grained (single-lock) linked list
+ **********************************************/
+
+type coarseNode struct {
+	key  int
+	next *coarseNode
+}
+
+// CoarseList guards the whole list with one mutex.
+type CoarseList struct {
+	head *coarseNode
+	mu   sync.Mutex
+}
+
+func NewCoarseList() *CoarseList {
+	return &CoarseList{}
+}
+
+func (l *CoarseList) Insert(key int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := &coarseNode{key: key, next: l.head}
+	l.head = n
+	return true
+}
+
+func (l *CoarseList) Contains(key int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for cur := l.head; cur != nil; cur = cur.next {
+		if cur.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *CoarseList) Keys() []int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var keys []int
+	for cur := l.head; cur != nil; cur = cur.next {
+		keys = append(keys, cur.key)
+	}
+	return keys
+}
+
+/*****************************************************
+ * 2) Hand-over-hand (lock-coupling) linked list
+ *    - Uses a sentinel head node so head pointer
+ *      does not change (helps lock coupling).
+ *****************************************************/
+
+type hohNode struct {
+	key  int
+	next *hohNode
+	mu   sync.Mutex
+}
+
+// HoHList locks node by node, holding at most two locks at a time.
+type HoHList struct {
+	head *hohNode // sentinel: head.key is unused; data starts at head.next
+}
+
+func NewHoHList() *HoHList {
+	// sentinel head (no data)
+	return &HoHList{head: &hohNode{}}
+}
+
+// Insert at head: lock only the sentinel, splice new node
+func (l *HoHList) Insert(key int) bool {
+	l.head.mu.Lock()
+	defer l.head.mu.Unlock()
+
+	n := &hohNode{key: key, next: l.head.next}
+	l.head.next = n
+	return true
+}
+
+// Contains with lock coupling (no defers; explicit unlocks to avoid double-unlock)
+func (l *HoHList) Contains(key int) bool {
+	prev := l.head
+	prev.mu.Lock()
+
+	cur := prev.next
+	for cur != nil {
+		cur.mu.Lock()
+		if cur.key == key {
+			// Unlock both before returning
+			cur.mu.Unlock()
+			prev.mu.Unlock()
+			return true
+		}
+		// Slide window: unlock prev, move forward
+		prev.mu.Unlock()
+		prev = cur
+		cur = cur.next
+	}
+
+	// Unlock the last held lock (the sentinel if list was empty, or the last node visited)
+	prev.mu.Unlock()
+	return false
+}
+
+// Keys walks the list with lock coupling, like Contains.
+func (l *HoHList) Keys() []int {
+	var keys []int
+	prev := l.head
+	prev.mu.Lock()
+	for cur := prev.next; cur != nil; cur = cur.next {
+		cur.mu.Lock()
+		keys = append(keys, cur.key)
+		prev.mu.Unlock()
+		prev = cur
+	}
+	prev.mu.Unlock()
+	return keys
+}
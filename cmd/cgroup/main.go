@@ -0,0 +1,11 @@
+// Command cgroup runs "oslabs cgroup" on its own; the code is in package
+// labs/cgroup.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/cgroup"
+)
+
+func main() { cgroup.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command classics runs "oslabs classics" on its own; the code is in package
+// labs/classics.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/classics"
+)
+
+func main() { classics.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command compare runs "oslabs compare" on its own; the code is in package
+// labs/compare.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/compare"
+)
+
+func main() { compare.Main(os.Args[1:]) }
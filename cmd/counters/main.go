@@ -0,0 +1,11 @@
+// Command counters runs "oslabs counters" on its own; the code is in package
+// labs/counters.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/counters"
+)
+
+func main() { counters.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command ctxswitch runs "oslabs ctxswitch" on its own; the code is in package
+// labs/ctxswitch.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/ctxswitch"
+)
+
+func main() { ctxswitch.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command deadlock runs "oslabs deadlock" on its own; the code is in package
+// labs/deadlock.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/deadlock"
+)
+
+func main() { deadlock.Main(os.Args[1:]) }
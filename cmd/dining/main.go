@@ -0,0 +1,11 @@
+// Command dining runs "oslabs dining" on its own; the code is in package
+// labs/dining.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/dining"
+)
+
+func main() { dining.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command experiment runs "oslabs experiment" on its own; the code is in
+// package labs/experiment.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/experiment"
+)
+
+func main() { experiment.Main(os.Args[1:]) }
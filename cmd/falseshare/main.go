@@ -0,0 +1,11 @@
+// Command falseshare runs "oslabs falseshare" on its own; the code is in package
+// labs/falseshare.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/falseshare"
+)
+
+func main() { falseshare.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command ffsbench runs "oslabs ffsbench" on its own; the code is in package
+// labs/ffsbench.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/ffsbench"
+)
+
+func main() { ffsbench.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command fs runs "oslabs fs" on its own; the code is in package
+// labs/fs.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/fs"
+)
+
+func main() { fs.Main(os.Args[1:]) }
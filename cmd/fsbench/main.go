@@ -0,0 +1,11 @@
+// Command fsbench runs "oslabs fsbench" on its own; the code is in package
+// labs/fsbench.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/fsbench"
+)
+
+func main() { fsbench.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command fsck runs "oslabs fsck" on its own; the code is in package
+// labs/fsck.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/fsck"
+)
+
+func main() { fsck.Main(os.Args[1:]) }
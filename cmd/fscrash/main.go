@@ -0,0 +1,11 @@
+// Command fscrash runs "oslabs fscrash" on its own; the code is in package
+// labs/fscrash.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/fscrash"
+)
+
+func main() { fscrash.Main(os.Args[1:]) }
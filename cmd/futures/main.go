@@ -0,0 +1,11 @@
+// Command futures runs "oslabs futures" on its own; the code is in package
+// labs/futures.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/futures"
+)
+
+func main() { futures.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command gc runs "oslabs gc" on its own; the code is in package
+// labs/gc.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/gc"
+)
+
+func main() { gc.Main(os.Args[1:]) }
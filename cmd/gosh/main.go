@@ -0,0 +1,11 @@
+// Command gosh runs "oslabs gosh" on its own; the code is in package
+// labs/gosh.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/gosh"
+)
+
+func main() { gosh.Main(os.Args[1:]) }
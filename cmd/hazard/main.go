@@ -0,0 +1,11 @@
+// Command hazard runs "oslabs hazard" on its own; the code is in package
+// labs/hazard.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/hazard"
+)
+
+func main() { hazard.Main(os.Args[1:]) }
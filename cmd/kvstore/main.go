@@ -0,0 +1,11 @@
+// Command kvstore runs "oslabs kvstore" on its own; the code is in package
+// labs/kvstore.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/kvstore"
+)
+
+func main() { kvstore.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command lfsbench runs "oslabs lfsbench" on its own; the code is in package
+// labs/lfsbench.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/lfsbench"
+)
+
+func main() { lfsbench.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command logcheck runs "oslabs logcheck" on its own; the code is in package
+// labs/logcheck.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/logcheck"
+)
+
+func main() { logcheck.Main(os.Args[1:]) }
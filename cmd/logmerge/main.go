@@ -0,0 +1,11 @@
+// Command logmerge runs "oslabs logmerge" on its own; the code is in package
+// labs/logmerge.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/logmerge"
+)
+
+func main() { logmerge.Main(os.Args[1:]) }
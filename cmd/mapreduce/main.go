@@ -0,0 +1,11 @@
+// Command mapreduce runs "oslabs mapreduce" on its own; the code is in package
+// labs/mapreduce.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/mapreduce"
+)
+
+func main() { mapreduce.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command memlat runs "oslabs memlat" on its own; the code is in package
+// labs/memlat.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/memlat"
+)
+
+func main() { memlat.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command mesi runs "oslabs mesi" on its own; the code is in package
+// labs/mesi.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/mesi"
+)
+
+func main() { mesi.Main(os.Args[1:]) }
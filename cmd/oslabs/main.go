@@ -0,0 +1,156 @@
+// oslabs, every experiment in one binary
+// Runs any of the experiments as a subcommand: the first argument names
+// it and the rest are its flags, as "go run ./cmd/<name>" would take
+// them. Experiments that start a second process start this binary again
+// as the same subcommand.
+//
+//	go run ./cmd/oslabs list
+//	go run ./cmd/oslabs sched -policy rr
+//	go run ./cmd/oslabs prodcons --mode shm --n 1000 --quiet
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/labs/arenabench"
+	"example.com/operating-systems/labs/cgroup"
+	"example.com/operating-systems/labs/classics"
+	"example.com/operating-systems/labs/compare"
+	"example.com/operating-systems/labs/counters"
+	"example.com/operating-systems/labs/ctxswitch"
+	"example.com/operating-systems/labs/deadlock"
+	"example.com/operating-systems/labs/dining"
+	"example.com/operating-systems/labs/experiment"
+	"example.com/operating-systems/labs/falseshare"
+	"example.com/operating-systems/labs/ffsbench"
+	"example.com/operating-systems/labs/freelistbench"
+	"example.com/operating-systems/labs/fs"
+	"example.com/operating-systems/labs/fsbench"
+	"example.com/operating-systems/labs/fsck"
+	"example.com/operating-systems/labs/fscrash"
+	"example.com/operating-systems/labs/futures"
+	"example.com/operating-systems/labs/gc"
+	"example.com/operating-systems/labs/gosh"
+	"example.com/operating-systems/labs/hazard"
+	"example.com/operating-systems/labs/hw0"
+	"example.com/operating-systems/labs/kvstore"
+	"example.com/operating-systems/labs/lfsbench"
+	"example.com/operating-systems/labs/lists"
+	"example.com/operating-systems/labs/locks"
+	"example.com/operating-systems/labs/logbench"
+	"example.com/operating-systems/labs/logcheck"
+	"example.com/operating-systems/labs/logmerge"
+	"example.com/operating-systems/labs/mapreduce"
+	"example.com/operating-systems/labs/memlat"
+	"example.com/operating-systems/labs/mesi"
+	"example.com/operating-systems/labs/paging"
+	"example.com/operating-systems/labs/poolbench"
+	"example.com/operating-systems/labs/prodcons"
+	"example.com/operating-systems/labs/queues"
+	"example.com/operating-systems/labs/raidbench"
+	"example.com/operating-systems/labs/rcumap"
+	"example.com/operating-systems/labs/replog"
+	"example.com/operating-systems/labs/rwbench"
+	"example.com/operating-systems/labs/sched"
+	"example.com/operating-systems/labs/shmring"
+	"example.com/operating-systems/labs/spawnbench"
+	"example.com/operating-systems/labs/stackbench"
+	"example.com/operating-systems/labs/stackdemo"
+	"example.com/operating-systems/labs/stracelite"
+	"example.com/operating-systems/labs/stress"
+	"example.com/operating-systems/labs/vcpu"
+	"example.com/operating-systems/labs/vm"
+)
+
+// subcommand is one experiment.
+type subcommand struct {
+	name    string
+	summary string
+	main    func(args []string)
+}
+
+var subcommands = []subcommand{
+	{"arenabench", "Arena allocator demo and benchmark", arenabench.Main},
+	{"cgroup", "CPU shares and quotas for goroutine groups", cgroup.Main},
+	{"classics", "Classic synchronization problems", classics.Main},
+	{"compare", "Benchmark run comparison", compare.Main},
+	{"counters", "Counter scalability vs accuracy", counters.Main},
+	{"ctxswitch", "Context-switch cost", ctxswitch.Main},
+	{"deadlock", "Deadlock detector demo", deadlock.Main},
+	{"dining", "Dining philosophers", dining.Main},
+	{"experiment", "Experiment runner: a file of benchmark configurations, one report", experiment.Main},
+	{"falseshare", "False sharing", falseshare.Main},
+	{"ffsbench", "FFS locality benchmark", ffsbench.Main},
+	{"freelistbench", "Free-list allocator demo and fragmentation benchmark", freelistbench.Main},
+	{"fs", "Simple file system shell", fs.Main},
+	{"fsbench", "File system microbenchmarks", fsbench.Main},
+	{"fsck", "File system checker", fsck.Main},
+	{"fscrash", "File system crash-injection harness", fscrash.Main},
+	{"futures", "Futures demo", futures.Main},
+	{"gc", "Garbage collector simulator", gc.Main},
+	{"gosh", "gosh, a small shell", gosh.Main},
+	{"hazard", "Hazard-pointer reclamation benchmark", hazard.Main},
+	{"hw0", "HW0 Q1: producer and consumer processes over pipes", hw0.Main},
+	{"kvstore", "Key-value store benchmark and crash checker", kvstore.Main},
+	{"lfsbench", "Log-structured file system benchmark", lfsbench.Main},
+	{"lists", "HW3: coarse- vs fine-grained locked linked lists", lists.Main},
+	{"locks", "HW2 Q3: ticket vs CAS spin lock wait times", locks.Main},
+	{"logbench", "HW8: logger benchmark", logbench.Main},
+	{"logcheck", "HW8: log corruption checker", logcheck.Main},
+	{"logmerge", "Causal log merge", logmerge.Main},
+	{"mapreduce", "MapReduce word count", mapreduce.Main},
+	{"memlat", "Memory hierarchy latency and bandwidth", memlat.Main},
+	{"mesi", "MESI cache-coherence simulator", mesi.Main},
+	{"paging", "Page replacement simulator", paging.Main},
+	{"poolbench", "Worker pool benchmark", poolbench.Main},
+	{"prodcons", "HW1 Q2: producer-consumer over pipes, sockets, shared memory and more", prodcons.Main},
+	{"queues", "HW4: concurrent queue benchmarks", queues.Main},
+	{"raidbench", "HW7: RAID benchmark", raidbench.Main},
+	{"rcumap", "RCU map vs readers-writers-locked maps", rcumap.Main},
+	{"replog", "Replicated log: durability vs availability", replog.Main},
+	{"rwbench", "Readers-writers benchmark", rwbench.Main},
+	{"sched", "CPU scheduling simulator", sched.Main},
+	{"shmring", "Shared-memory ring throughput", shmring.Main},
+	{"spawnbench", "Process vs goroutine creation cost", spawnbench.Main},
+	{"stackbench", "Stack benchmark: mutex-protected stack vs Treiber lock-free stack", stackbench.Main},
+	{"stackdemo", "HW0 Q2: stack package demo", stackdemo.Main},
+	{"strace-lite", "strace-lite, a syscall counter", stracelite.Main},
+	{"stress", "Stress test of every concurrent structure, with invariant checks", stress.Main},
+	{"vcpu", "Tiny virtual CPU", vcpu.Main},
+	{"vm", "Virtual memory address translation simulator", vm.Main},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	switch name := os.Args[1]; name {
+	case "help", "list", "-h", "-help", "--help":
+		usage(os.Stdout)
+		return
+	default:
+		for _, s := range subcommands {
+			if s.name == name {
+				labs.SetSubcommand(name)
+				s.main(os.Args[2:])
+				return
+			}
+		}
+		fmt.Fprintf(os.Stderr, "oslabs: unknown subcommand %q\n", name)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: oslabs <subcommand> [flags]")
+	fmt.Fprintln(w, "       oslabs <subcommand> -h   lists a subcommand's flags")
+	fmt.Fprintln(w)
+	for _, s := range subcommands {
+		fmt.Fprintf(w, "  %-13s  %s\n", s.name, s.summary)
+	}
+}
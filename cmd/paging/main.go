@@ -0,0 +1,11 @@
+// Command paging runs "oslabs paging" on its own; the code is in package
+// labs/paging.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/paging"
+)
+
+func main() { paging.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command poolbench runs "oslabs poolbench" on its own; the code is in package
+// labs/poolbench.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/poolbench"
+)
+
+func main() { poolbench.Main(os.Args[1:]) }
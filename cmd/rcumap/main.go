@@ -0,0 +1,11 @@
+// Command rcumap runs "oslabs rcumap" on its own; the code is in package
+// labs/rcumap.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/rcumap"
+)
+
+func main() { rcumap.Main(os.Args[1:]) }
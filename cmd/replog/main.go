@@ -0,0 +1,11 @@
+// Command replog runs "oslabs replog" on its own; the code is in package
+// labs/replog.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/replog"
+)
+
+func main() { replog.Main(os.Args[1:]) }
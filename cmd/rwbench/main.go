@@ -0,0 +1,11 @@
+// Command rwbench runs "oslabs rwbench" on its own; the code is in package
+// labs/rwbench.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/rwbench"
+)
+
+func main() { rwbench.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command sched runs "oslabs sched" on its own; the code is in package
+// labs/sched.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/sched"
+)
+
+func main() { sched.Main(os.Args[1:]) }
@@ -0,0 +1,13 @@
+//go:build unix
+
+// Command shmring runs "oslabs shmring" on its own; the code is in package
+// labs/shmring.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/shmring"
+)
+
+func main() { shmring.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command spawnbench runs "oslabs spawnbench" on its own; the code is in package
+// labs/spawnbench.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/spawnbench"
+)
+
+func main() { spawnbench.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command strace-lite runs "oslabs strace-lite" on its own; the code is in package
+// labs/stracelite.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/stracelite"
+)
+
+func main() { stracelite.Main(os.Args[1:]) }
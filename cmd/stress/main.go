@@ -0,0 +1,11 @@
+// Command stress runs "oslabs stress" on its own; the code is in package
+// labs/stress.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/stress"
+)
+
+func main() { stress.Main(os.Args[1:]) }
@@ -0,0 +1,11 @@
+// Command vcpu runs "oslabs vcpu" on its own; the code is in package
+// labs/vcpu.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/vcpu"
+)
+
+func main() { vcpu.Main(os.Args[1:]) }
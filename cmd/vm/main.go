@@ -0,0 +1,11 @@
+// Command vm runs "oslabs vm" on its own; the code is in package
+// labs/vm.
+package main
+
+import (
+	"os"
+
+	"example.com/operating-systems/labs/vm"
+)
+
+func main() { vm.Main(os.Args[1:]) }
@@ -0,0 +1,212 @@
+// Package counters holds the counter designs of OSTEP chapter 29 side by
+// side: one atomic, one behind a mutex, the sloppy (approximate) counter
+// with a lock per shard and a global count that shards move their counts
+// into every Threshold, and a per-goroutine design that counts with no
+// synchronization at all and flushes every Threshold. The exact two are
+// the slowest with many writers, all of them writing one cache line; the
+// other two trade that for a Value that lags the true count by up to
+// Slack.
+package counters
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"example.com/operating-systems/cacheline"
+)
+
+// Counter counts for a fixed set of workers, numbered from 0.
+type Counter interface {
+	// Add adds delta for worker; only worker's goroutine may call it
+	// with that number.
+	Add(worker int, delta int64)
+	// Flush moves worker's held count into the global one; a worker
+	// calls it when done, so Value catches up.
+	Flush(worker int)
+	// Value is the global count, which may lag the true count by up to
+	// Slack.
+	Value() int64
+	// Slack is the most Value can lag by.
+	Slack() int64
+}
+
+// Kind names a counter design.
+type Kind int
+
+const (
+	Atomic Kind = iota
+	Mutex
+	Sloppy
+	Local
+)
+
+// Kinds lists every design, in the order cmd/counters runs them.
+var Kinds = []Kind{Atomic, Mutex, Sloppy, Local}
+
+func (k Kind) String() string {
+	switch k {
+	case Atomic:
+		return "atomic"
+	case Mutex:
+		return "mutex"
+	case Sloppy:
+		return "sloppy"
+	case Local:
+		return "local"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// ParseKind returns the design named s.
+func ParseKind(s string) (Kind, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "atomic", "global":
+		return Atomic, nil
+	case "mutex", "lock":
+		return Mutex, nil
+	case "sloppy", "approximate", "sharded":
+		return Sloppy, nil
+	case "local", "per-goroutine", "flush":
+		return Local, nil
+	}
+	return 0, fmt.Errorf("counters: unknown kind %q (atomic, mutex, sloppy, local)", s)
+}
+
+// New returns a counter of kind k for workers workers. threshold is how
+// much a shard or worker holds before moving it to the global count; the
+// exact kinds ignore it. Sloppy has a shard per CPU.
+func New(k Kind, workers int, threshold int64) (Counter, error) {
+	if workers < 1 || threshold < 1 {
+		return nil, fmt.Errorf("counters: need workers and threshold at least 1, got %d, %d", workers, threshold)
+	}
+	switch k {
+	case Atomic:
+		return &AtomicCounter{}, nil
+	case Mutex:
+		return &MutexCounter{}, nil
+	case Sloppy:
+		return NewSloppy(workers, runtime.NumCPU(), threshold), nil
+	case Local:
+		return NewLocal(workers, threshold), nil
+	}
+	return nil, fmt.Errorf("counters: unknown kind %v", k)
+}
+
+// AtomicCounter is one atomic integer that every worker adds to.
+type AtomicCounter struct{ n atomic.Int64 }
+
+func (c *AtomicCounter) Add(_ int, delta int64) { c.n.Add(delta) }
+func (c *AtomicCounter) Flush(int)              {}
+func (c *AtomicCounter) Value() int64           { return c.n.Load() }
+func (c *AtomicCounter) Slack() int64           { return 0 }
+
+// MutexCounter is an integer behind a lock (OSTEP Figure 29.2).
+type MutexCounter struct {
+	mu sync.Mutex
+	n  int64
+}
+
+func (c *MutexCounter) Add(_ int, delta int64) {
+	c.mu.Lock()
+	c.n += delta
+	c.mu.Unlock()
+}
+
+func (c *MutexCounter) Flush(int) {}
+
+func (c *MutexCounter) Value() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+func (c *MutexCounter) Slack() int64 { return 0 }
+
+// shard is one of the sloppy counter's local counts, on its own line.
+type shard struct {
+	mu sync.Mutex
+	n  int64
+}
+
+// SloppyCounter is OSTEP's approximate counter (Figure 29.5): workers
+// add to one of several locked local counts, worker % shards, and a
+// local count that reaches the threshold is moved to the global count
+// under the global lock.
+type SloppyCounter struct {
+	shards    []cacheline.Padded[shard]
+	mu        sync.Mutex
+	global    int64
+	threshold int64
+}
+
+// NewSloppy returns a sloppy counter with shards local counts.
+func NewSloppy(workers, shards int, threshold int64) *SloppyCounter {
+	shards = max(1, min(shards, workers))
+	return &SloppyCounter{shards: make([]cacheline.Padded[shard], shards), threshold: threshold}
+}
+
+func (c *SloppyCounter) Add(worker int, delta int64) {
+	s := &c.shards[worker%len(c.shards)].V
+	s.mu.Lock()
+	s.n += delta
+	if s.n >= c.threshold {
+		c.mu.Lock()
+		c.global += s.n
+		c.mu.Unlock()
+		s.n = 0
+	}
+	s.mu.Unlock()
+}
+
+func (c *SloppyCounter) Flush(worker int) {
+	s := &c.shards[worker%len(c.shards)].V
+	s.mu.Lock()
+	c.mu.Lock()
+	c.global += s.n
+	c.mu.Unlock()
+	s.n = 0
+	s.mu.Unlock()
+}
+
+func (c *SloppyCounter) Value() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.global
+}
+
+func (c *SloppyCounter) Slack() int64 { return int64(len(c.shards)) * (c.threshold - 1) }
+
+// LocalCounter gives each worker a count of its own that only it
+// touches, so adding takes no lock and no atomic, and moves it to the
+// global atomic count every threshold.
+type LocalCounter struct {
+	locals    []cacheline.Padded[int64]
+	global    atomic.Int64
+	threshold int64
+}
+
+// NewLocal returns a per-worker counter.
+func NewLocal(workers int, threshold int64) *LocalCounter {
+	return &LocalCounter{locals: make([]cacheline.Padded[int64], workers), threshold: threshold}
+}
+
+func (c *LocalCounter) Add(worker int, delta int64) {
+	l := &c.locals[worker].V
+	*l += delta
+	if *l >= c.threshold {
+		c.global.Add(*l)
+		*l = 0
+	}
+}
+
+func (c *LocalCounter) Flush(worker int) {
+	l := &c.locals[worker].V
+	c.global.Add(*l)
+	*l = 0
+}
+
+func (c *LocalCounter) Value() int64 { return c.global.Load() }
+func (c *LocalCounter) Slack() int64 { return int64(len(c.locals)) * (c.threshold - 1) }
@@ -0,0 +1,346 @@
+// Package dining runs the dining philosophers for real: N goroutines round
+// a table, a fork between each pair, each thinking, getting hungry, and
+// eating with both its forks. Strategies decide how the forks are picked
+// up, from the naive one that can deadlock to Chandy and Misra's
+// message-passing one, and a watchdog notices when the table stops making
+// progress and says whether it deadlocked (everyone hungry, nobody even
+// trying any more) or livelocked (forks still being grabbed and put back,
+// but no meals).
+package dining
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Strategy is how philosophers pick up their forks.
+type Strategy int
+
+const (
+	// Naive picks up the left fork, then the right: when everyone holds a
+	// left fork at once, nobody gets a right one.
+	Naive Strategy = iota
+	// Ordered picks up the lower-numbered fork first, so there's no cycle
+	// of waits for a deadlock to form around.
+	Ordered
+	// Waiter asks an arbitrator, which hands out both forks together or
+	// neither, so no philosopher ever holds one fork and waits on another.
+	Waiter
+	// ChandyMisra passes forks and requests for them as messages between
+	// neighbours; a philosopher gives up a fork when asked if it's dirty
+	// (eaten with) and keeps it if it's clean, which keeps the precedence
+	// between neighbours acyclic and lets nobody starve.
+	ChandyMisra
+	// Polite picks up the left fork and only tries the right; failing, it
+	// puts the left back and waits Reach before trying again. It can't
+	// deadlock, but philosophers in step with each other can livelock.
+	Polite
+)
+
+// Strategies lists every strategy.
+var Strategies = []Strategy{Naive, Ordered, Waiter, ChandyMisra, Polite}
+
+func (s Strategy) String() string {
+	switch s {
+	case Naive:
+		return "naive"
+	case Ordered:
+		return "ordered"
+	case Waiter:
+		return "waiter"
+	case ChandyMisra:
+		return "chandy-misra"
+	case Polite:
+		return "polite"
+	}
+	return fmt.Sprintf("Strategy(%d)", int(s))
+}
+
+// ParseStrategy returns the strategy named s.
+func ParseStrategy(s string) (Strategy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "naive":
+		return Naive, nil
+	case "ordered", "order", "hierarchy":
+		return Ordered, nil
+	case "waiter", "arbitrator":
+		return Waiter, nil
+	case "chandy-misra", "chandymisra", "cm":
+		return ChandyMisra, nil
+	case "polite":
+		return Polite, nil
+	}
+	return 0, fmt.Errorf("dining: unknown strategy %q (naive, ordered, waiter, chandy-misra, polite)", s)
+}
+
+// Config is a dinner.
+type Config struct {
+	Philosophers int
+	Duration     time.Duration // how long to run, unless the table hangs first
+	Think, Eat   time.Duration // each spell lasts a random time up to this; 0 just yields
+	Reach        time.Duration // pause between picking up the first fork and the second
+	Window       time.Duration // no meals for this long, with someone hungry, is a hang
+	Seed         int64
+}
+
+// DefaultConfig is five philosophers for two seconds.
+var DefaultConfig = Config{
+	Philosophers: 5,
+	Duration:     2 * time.Second,
+	Think:        time.Millisecond,
+	Eat:          time.Millisecond,
+	Reach:        time.Millisecond,
+	Window:       250 * time.Millisecond,
+	Seed:         1,
+}
+
+// Hang is how a table stopped making progress.
+type Hang int
+
+const (
+	NoHang Hang = iota
+	Deadlock
+	Livelock
+)
+
+func (h Hang) String() string {
+	switch h {
+	case NoHang:
+		return "ok"
+	case Deadlock:
+		return "deadlock"
+	case Livelock:
+		return "livelock"
+	}
+	return fmt.Sprintf("Hang(%d)", int(h))
+}
+
+// Result is a finished dinner.
+type Result struct {
+	Strategy Strategy
+	Elapsed  time.Duration // until Duration ran out or the hang was noticed
+	Meals    []int         // per philosopher
+	Grabs    []int         // attempts at a fork, per philosopher
+	MaxWait  time.Duration // longest time from hungry to eating
+	Hang     Hang
+	HangAt   time.Duration // when the last meal before the hang was eaten
+	Holding  []int         // forks each philosopher held when the hang was noticed
+}
+
+// Total is the meals eaten in all.
+func (r Result) Total() int {
+	n := 0
+	for _, m := range r.Meals {
+		n += m
+	}
+	return n
+}
+
+// MealsPerSec is the table's throughput.
+func (r Result) MealsPerSec() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Total()) / r.Elapsed.Seconds()
+}
+
+// Fairness is Jain's index of the meals each philosopher got (1 = even,
+// 1/N = one philosopher ate everything).
+func (r Result) Fairness() float64 {
+	var sum, sq float64
+	for _, m := range r.Meals {
+		sum += float64(m)
+		sq += float64(m) * float64(m)
+	}
+	if sq == 0 {
+		return 0
+	}
+	return sum * sum / (float64(len(r.Meals)) * sq)
+}
+
+// philosopher states, as the watchdog sees them.
+const (
+	thinking int32 = iota
+	hungry
+	eating
+)
+
+// table is a strategy's forks. pickUp blocks until p holds both its forks,
+// returning false if the dinner ended first; putDown gives them back.
+type table interface {
+	pickUp(p int) bool
+	putDown(p int)
+	// halt wakes every philosopher waiting in pickUp once stop is closed.
+	halt()
+}
+
+// dinner is the shared state of a run: what the philosophers are doing,
+// for the watchdog, and the stop signal.
+type dinner struct {
+	n       int
+	reach   time.Duration
+	stop    chan struct{}
+	state   []atomic.Int32
+	held    []atomic.Int32 // forks in hand
+	meals   []atomic.Int64
+	grabs   []atomic.Int64
+	stopped atomic.Bool
+}
+
+func (d *dinner) left(p int) int  { return p }
+func (d *dinner) right(p int) int { return (p + 1) % d.n }
+
+// grab counts an attempt by p at a fork.
+func (d *dinner) grab(p int) { d.grabs[p].Add(1) }
+
+// pause waits out the reach between two forks, or returns false if the
+// dinner ends first.
+func (d *dinner) pause() bool {
+	if d.reach <= 0 {
+		runtime.Gosched()
+		return !d.stopped.Load()
+	}
+	t := time.NewTimer(d.reach)
+	defer t.Stop()
+	select {
+	case <-d.stop:
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// Run seats c.Philosophers at a table using strategy s and lets them eat
+// for c.Duration, or until the watchdog finds them hung.
+func Run(c Config, s Strategy) (Result, error) {
+	if c.Philosophers < 2 {
+		return Result{}, fmt.Errorf("dining: need at least 2 philosophers, got %d", c.Philosophers)
+	}
+	if c.Duration <= 0 || c.Think < 0 || c.Eat < 0 || c.Reach < 0 {
+		return Result{}, fmt.Errorf("dining: duration must be positive and think, eat and reach not negative")
+	}
+	if c.Window <= c.Think+c.Eat+c.Reach {
+		return Result{}, fmt.Errorf("dining: window %v must be longer than think+eat+reach (%v), or a slow meal looks like a hang",
+			c.Window, c.Think+c.Eat+c.Reach)
+	}
+	n := c.Philosophers
+	d := &dinner{n: n, reach: c.Reach, stop: make(chan struct{}),
+		state: make([]atomic.Int32, n), held: make([]atomic.Int32, n),
+		meals: make([]atomic.Int64, n), grabs: make([]atomic.Int64, n)}
+	var t table
+	switch s {
+	case Naive, Ordered, Polite:
+		t = newForks(d, s)
+	case Waiter:
+		t = newWaiter(d)
+	case ChandyMisra:
+		t = newChandyMisra(d)
+	default:
+		return Result{}, fmt.Errorf("dining: unknown strategy %v", s)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex // guards maxWait and lastMeal
+		maxWait time.Duration
+		start   = time.Now()
+		// lastMeal is when the latest meal began, since start
+		lastMeal time.Duration
+	)
+	for p := 0; p < n; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(c.Seed + int64(p)))
+			spell := func(max time.Duration) {
+				if max <= 0 {
+					runtime.Gosched()
+					return
+				}
+				time.Sleep(time.Duration(rng.Int63n(int64(max)) + 1))
+			}
+			for !d.stopped.Load() {
+				spell(c.Think)
+				d.state[p].Store(hungry)
+				hungrySince := time.Now()
+				if !t.pickUp(p) {
+					return
+				}
+				d.state[p].Store(eating)
+				now := time.Now()
+				mu.Lock()
+				maxWait = max(maxWait, now.Sub(hungrySince))
+				lastMeal = now.Sub(start)
+				mu.Unlock()
+				d.meals[p].Add(1)
+				spell(c.Eat)
+				t.putDown(p)
+				d.state[p].Store(thinking)
+			}
+		}(p)
+	}
+
+	// The watchdog polls the counts a few times a Window. Once nobody has
+	// eaten for a Window and somebody is hungry the table is hung: a
+	// deadlock if nobody has grabbed at a fork for half a Window either,
+	// a livelock if they're still trying
+	r := Result{Strategy: s}
+	tick := time.NewTicker(c.Window / 8)
+	end := time.NewTimer(c.Duration)
+	lastMeals, lastGrabs := int64(-1), int64(-1)
+	var mealAt, grabAt time.Time
+watch:
+	for {
+		select {
+		case <-end.C:
+			break watch
+		case now := <-tick.C:
+			var meals, grabs int64
+			anyHungry := false
+			for p := 0; p < n; p++ {
+				meals += d.meals[p].Load()
+				grabs += d.grabs[p].Load()
+				anyHungry = anyHungry || d.state[p].Load() == hungry
+			}
+			if meals != lastMeals {
+				lastMeals, mealAt = meals, now
+			}
+			if grabs != lastGrabs {
+				lastGrabs, grabAt = grabs, now
+			}
+			if now.Sub(mealAt) >= c.Window && anyHungry {
+				r.Hang = Deadlock
+				if now.Sub(grabAt) < c.Window/2 {
+					r.Hang = Livelock
+				}
+				r.Holding = make([]int, n)
+				for p := range r.Holding {
+					r.Holding[p] = int(d.held[p].Load())
+				}
+				break watch
+			}
+		}
+	}
+	tick.Stop()
+	end.Stop()
+	r.Elapsed = time.Since(start)
+	d.stopped.Store(true)
+	close(d.stop)
+	t.halt()
+	wg.Wait()
+
+	r.Meals, r.Grabs = make([]int, n), make([]int, n)
+	for p := 0; p < n; p++ {
+		r.Meals[p], r.Grabs[p] = int(d.meals[p].Load()), int(d.grabs[p].Load())
+	}
+	r.MaxWait = maxWait
+	if r.Hang != NoHang {
+		r.HangAt = lastMeal
+	}
+	return r, nil
+}
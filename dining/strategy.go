@@ -0,0 +1,280 @@
+package dining
+
+import "sync"
+
+// forks is a table of plain forks, each a one-token channel: holding the
+// token is holding the fork. Naive, Ordered and Polite differ only in the
+// order they take them.
+type forks struct {
+	d     *dinner
+	s     Strategy
+	forks []chan struct{}
+}
+
+func newForks(d *dinner, s Strategy) *forks {
+	t := &forks{d: d, s: s, forks: make([]chan struct{}, d.n)}
+	for i := range t.forks {
+		t.forks[i] = make(chan struct{}, 1)
+		t.forks[i] <- struct{}{}
+	}
+	return t
+}
+
+// take blocks until p holds fork f, or returns false if the dinner ends.
+func (t *forks) take(p, f int) bool {
+	t.d.grab(p)
+	select {
+	case <-t.forks[f]:
+		t.d.held[p].Add(1)
+		return true
+	case <-t.d.stop:
+		return false
+	}
+}
+
+// tryTake takes fork f if it's on the table.
+func (t *forks) tryTake(p, f int) bool {
+	t.d.grab(p)
+	select {
+	case <-t.forks[f]:
+		t.d.held[p].Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *forks) give(p, f int) {
+	t.d.held[p].Add(-1)
+	t.forks[f] <- struct{}{}
+}
+
+func (t *forks) pickUp(p int) bool {
+	first, second := t.d.left(p), t.d.right(p)
+	if t.s == Ordered && second < first {
+		first, second = second, first
+	}
+	for {
+		if !t.take(p, first) {
+			return false
+		}
+		if !t.d.pause() {
+			t.give(p, first)
+			return false
+		}
+		if t.s != Polite {
+			if !t.take(p, second) {
+				t.give(p, first)
+				return false
+			}
+			return true
+		}
+		if t.tryTake(p, second) {
+			return true
+		}
+		t.give(p, first)
+		if !t.d.pause() {
+			return false
+		}
+	}
+}
+
+func (t *forks) putDown(p int) {
+	t.give(p, t.d.left(p))
+	t.give(p, t.d.right(p))
+}
+
+// halt has nothing to do: take already watches the stop channel.
+func (t *forks) halt() {}
+
+// waiter is the arbitrator: one monitor over every fork, handing a
+// philosopher both of its forks at once when both are free.
+type waiter struct {
+	d     *dinner
+	mu    sync.Mutex
+	freed *sync.Cond // signalled when forks go back on the table
+	inUse []bool
+}
+
+func newWaiter(d *dinner) *waiter {
+	w := &waiter{d: d, inUse: make([]bool, d.n)}
+	w.freed = sync.NewCond(&w.mu)
+	return w
+}
+
+func (w *waiter) pickUp(p int) bool {
+	l, r := w.d.left(p), w.d.right(p)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.d.grab(p)
+	for w.inUse[l] || w.inUse[r] {
+		if w.d.stopped.Load() {
+			return false
+		}
+		w.freed.Wait()
+	}
+	w.inUse[l], w.inUse[r] = true, true
+	w.d.held[p].Store(2)
+	return true
+}
+
+func (w *waiter) putDown(p int) {
+	w.mu.Lock()
+	w.inUse[w.d.left(p)], w.inUse[w.d.right(p)] = false, false
+	w.d.held[p].Store(0)
+	w.mu.Unlock()
+	w.freed.Broadcast()
+}
+
+func (w *waiter) halt() {
+	w.mu.Lock()
+	w.mu.Unlock()
+	w.freed.Broadcast()
+}
+
+// chandyMisra is Chandy and Misra's solution, run as message passing: each
+// philosopher has an agent goroutine that alone knows which of its forks
+// it holds, whether they're dirty, and which requests it's sitting on, and
+// that trades forks and requests with the neighbouring agents. Every fork
+// starts dirty with the lower-numbered of its two philosophers, and the
+// request token for it with the other.
+//
+// An agent whose philosopher is hungry sends a request for each fork it
+// lacks. An agent asked for a fork gives it up, cleaned, if it's dirty and
+// its philosopher isn't eating (asking for it straight back if hungry);
+// otherwise it keeps the request until the meal is over, when all its
+// forks turn dirty and it sends the ones asked for. A clean fork is one
+// passed to a hungry philosopher who hasn't eaten with it yet, so the one
+// who waited longest wins each contested fork.
+type chandyMisra struct {
+	d      *dinner
+	agents []*agent
+}
+
+type agent struct {
+	p             int
+	hungry, ready chan struct{} // philosopher -> agent, and back when it may eat
+	done          chan struct{} // philosopher -> agent, after eating
+	forks, reqs   chan int      // from neighbours: a fork, or a request for one
+}
+
+func newChandyMisra(d *dinner) *chandyMisra {
+	t := &chandyMisra{d: d, agents: make([]*agent, d.n)}
+	for p := range t.agents {
+		// A philosopher has two forks, so at most two of each message are
+		// ever in flight to it, and sends never block
+		t.agents[p] = &agent{p: p, hungry: make(chan struct{}, 1), ready: make(chan struct{}, 1),
+			done: make(chan struct{}, 1), forks: make(chan int, 2), reqs: make(chan int, 2)}
+	}
+	for _, a := range t.agents {
+		go t.run(a)
+	}
+	return t
+}
+
+// neighbour is who p shares fork f with.
+func (t *chandyMisra) neighbour(p, f int) int {
+	if f == t.d.left(p) {
+		return (p - 1 + t.d.n) % t.d.n
+	}
+	return f
+}
+
+func (t *chandyMisra) run(a *agent) {
+	d := t.d
+	mine := [2]int{d.left(a.p), d.right(a.p)}
+	var have, dirty, token [2]bool
+	for i, f := range mine {
+		if a.p < t.neighbour(a.p, f) {
+			have[i], dirty[i] = true, true
+		} else {
+			token[i] = true
+		}
+	}
+	d.held[a.p].Store(int32(count(have)))
+	side := func(f int) int {
+		if f == mine[0] {
+			return 0
+		}
+		return 1
+	}
+	send := func(i int) {
+		have[i], dirty[i] = false, false
+		d.held[a.p].Add(-1)
+		t.agents[t.neighbour(a.p, mine[i])].forks <- mine[i]
+	}
+	request := func(i int) {
+		token[i] = false
+		d.grab(a.p)
+		t.agents[t.neighbour(a.p, mine[i])].reqs <- mine[i]
+	}
+	isHungry, isEating := false, false
+	tryEat := func() {
+		if isHungry && have[0] && have[1] {
+			isHungry, isEating = false, true
+			a.ready <- struct{}{}
+		}
+	}
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-a.hungry:
+			isHungry = true
+			for i := range mine {
+				if !have[i] && token[i] {
+					request(i)
+				}
+			}
+			tryEat()
+		case f := <-a.forks:
+			i := side(f)
+			have[i], dirty[i] = true, false
+			d.held[a.p].Add(1)
+			tryEat()
+		case f := <-a.reqs:
+			i := side(f)
+			token[i] = true
+			if have[i] && dirty[i] && !isEating {
+				send(i)
+				if isHungry {
+					request(i)
+				}
+			}
+		case <-a.done:
+			isEating = false
+			dirty = [2]bool{true, true}
+			for i := range mine {
+				if token[i] && have[i] {
+					send(i)
+				}
+			}
+		}
+	}
+}
+
+func count(b [2]bool) int {
+	n := 0
+	for _, v := range b {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+func (t *chandyMisra) pickUp(p int) bool {
+	a := t.agents[p]
+	a.hungry <- struct{}{}
+	select {
+	case <-a.ready:
+		return true
+	case <-t.d.stop:
+		return false
+	}
+}
+
+func (t *chandyMisra) putDown(p int) { t.agents[p].done <- struct{}{} }
+
+// halt has nothing to do: the agents and pickUp watch the stop channel.
+func (t *chandyMisra) halt() {}
@@ -0,0 +1,154 @@
+// Package epoch is epoch-based reclamation (Fraser's EBR), the grace
+// periods of RCU. Readers bracket their access to shared data with Enter
+// and Exit, which record the global epoch they saw; a writer that
+// unlinks something retires it, tagged with the current epoch. The
+// epoch only advances once every reader inside has seen it, so when it
+// is two past a retired value's tag, no reader can still hold that
+// value, and it is freed.
+//
+// Compared with hazard pointers (package hazard), readers do less, one
+// store on the way in and one out with no per-pointer validation, but a
+// single stalled reader holds up all reclamation instead of only the
+// nodes it protects. As there, the GC makes freeing unnecessary in Go,
+// so free is whatever the owner wants done with a value nobody can
+// reach, such as reusing it.
+package epoch
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Domain is a global epoch, the readers that watch it and the values
+// retired under it.
+type Domain[T any] struct {
+	epoch   atomic.Uint64
+	head    atomic.Pointer[Guard[T]] // every guard, never removed
+	records atomic.Int64
+	free    func(T)
+
+	mu    sync.Mutex
+	limbo [3][]T // by tag % 3: the epoch before last, last and current
+
+	retired, freed, advances atomic.Uint64
+}
+
+// NewDomain returns a domain at epoch 0 that calls free with each value
+// once it is safe to, from whichever goroutine's Retire or Synchronize
+// advanced the epoch.
+func NewDomain[T any](free func(T)) *Domain[T] {
+	return &Domain[T]{free: free}
+}
+
+// Guard is a reader's record, held from Enter to Exit.
+type Guard[T any] struct {
+	d      *Domain[T]
+	next   *Guard[T]
+	active atomic.Bool
+	epoch  atomic.Uint64
+}
+
+// Enter starts a read-side critical section: until Exit, nothing
+// retired after Enter is freed.
+func (d *Domain[T]) Enter() *Guard[T] {
+	g := d.acquire()
+	for {
+		e := d.epoch.Load()
+		g.epoch.Store(e)
+		if d.epoch.Load() == e {
+			return g
+		}
+	}
+}
+
+func (d *Domain[T]) acquire() *Guard[T] {
+	for g := d.head.Load(); g != nil; g = g.next {
+		if !g.active.Load() && g.active.CompareAndSwap(false, true) {
+			return g
+		}
+	}
+	g := &Guard[T]{d: d}
+	g.active.Store(true)
+	for {
+		head := d.head.Load()
+		g.next = head
+		if d.head.CompareAndSwap(head, g) {
+			d.records.Add(1)
+			return g
+		}
+	}
+}
+
+// Exit ends the critical section; g must not be used again.
+func (g *Guard[T]) Exit() { g.active.Store(false) }
+
+// Retire hands over v, no longer reachable by readers that enter from
+// now on, to be freed once every reader that might hold it has exited.
+func (d *Domain[T]) Retire(v T) {
+	d.retired.Add(1)
+	d.mu.Lock()
+	e := d.epoch.Load()
+	d.limbo[e%3] = append(d.limbo[e%3], v)
+	d.mu.Unlock()
+	d.TryAdvance()
+}
+
+// TryAdvance moves the epoch on if every reader inside has seen the
+// current one, freeing what was retired two epochs ago, and reports
+// whether it did.
+func (d *Domain[T]) TryAdvance() bool {
+	d.mu.Lock()
+	e := d.epoch.Load()
+	for g := d.head.Load(); g != nil; g = g.next {
+		if g.active.Load() && g.epoch.Load() != e {
+			d.mu.Unlock()
+			return false
+		}
+	}
+	d.epoch.Store(e + 1)
+	d.advances.Add(1)
+	// Retired under e-1: no reader is still in e-1 or earlier.
+	old := d.limbo[(e+2)%3]
+	d.limbo[(e+2)%3] = nil
+	d.mu.Unlock()
+	for _, v := range old {
+		d.free(v)
+	}
+	d.freed.Add(uint64(len(old)))
+	return true
+}
+
+// Synchronize waits for a grace period: every reader inside when it was
+// called has exited, and everything retired before has been freed.
+func (d *Domain[T]) Synchronize() {
+	target := d.epoch.Load() + 2
+	for d.epoch.Load() < target {
+		if !d.TryAdvance() {
+			runtime.Gosched()
+		}
+	}
+}
+
+// Stats counts what a domain has done.
+type Stats struct {
+	Epoch    uint64
+	Records  int
+	Retired  uint64
+	Freed    uint64
+	Advances uint64
+}
+
+// Pending is the retired values not yet freed.
+func (s Stats) Pending() uint64 { return s.Retired - s.Freed }
+
+// Stats returns the counts so far.
+func (d *Domain[T]) Stats() Stats {
+	return Stats{
+		Epoch:    d.epoch.Load(),
+		Records:  int(d.records.Load()),
+		Retired:  d.retired.Load(),
+		Freed:    d.freed.Load(),
+		Advances: d.advances.Load(),
+	}
+}
@@ -0,0 +1,292 @@
+package fs
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CacheConfig sizes and tunes a Cache.
+type CacheConfig struct {
+	Blocks     int           // blocks held, across every device sharing the cache
+	ReadAhead  int           // blocks read ahead after a sequential miss, 0 for none
+	WriteBack  bool          // hold writes until eviction or a flush, instead of writing through
+	FlushEvery time.Duration // with WriteBack, flush in the background this often; 0 for never
+}
+
+// CacheStats counts a cache's traffic.
+type CacheStats struct {
+	Reads, Hits    int // block reads asked for, and those found in the cache
+	ReadAheads     int // blocks read ahead
+	ReadAheadHits  int // reads answered by a block read ahead
+	Writes         int // block writes asked for
+	DeviceReads    int
+	DeviceWrites   int
+	Evictions      int
+	DirtyEvictions int // evictions that had to write the block back
+	Flushes        int
+}
+
+// HitRate is the fraction of reads the cache answered.
+func (s CacheStats) HitRate() float64 {
+	if s.Reads == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Reads)
+}
+
+func (s CacheStats) String() string {
+	return fmt.Sprintf("%d reads, %.1f%% hits (%d read ahead, %d of them used), %d writes; device %d reads, %d writes; %d evictions (%d dirty), %d flushes",
+		s.Reads, 100*s.HitRate(), s.ReadAheads, s.ReadAheadHits, s.Writes, s.DeviceReads, s.DeviceWrites, s.Evictions, s.DirtyEvictions, s.Flushes)
+}
+
+// Cache is an LRU buffer cache of device blocks. Devices wrap their
+// Device with Cache.Device, and every device wrapped by one Cache shares
+// its blocks, so a file system and a RAID array under another can compete
+// for the same memory. A Cache is safe for concurrent use (its flusher
+// runs alongside), though an FS on it is not.
+//
+// With WriteBack a write only dirties the cached block; it reaches the
+// device when evicted or flushed, in block order, not write order, so a
+// crash can lose or reorder any unflushed writes: journaling's ordering
+// needs write-through, or a Flush at each commit.
+type Cache struct {
+	cfg     CacheConfig
+	mu      sync.Mutex
+	order   *list.List // least recently used at the back
+	at      map[cacheKey]*list.Element
+	devs    []Device
+	stats   CacheStats
+	stop    chan struct{}
+	stopped chan struct{}
+	err     error // the flusher's first failure
+}
+
+type cacheKey struct{ dev, n int }
+
+type cacheBlock struct {
+	key       cacheKey
+	data      []byte
+	dirty     bool
+	readAhead bool // read ahead and not yet asked for
+}
+
+// NewCache returns an empty cache, starting its flusher if it has one.
+func NewCache(cfg CacheConfig) (*Cache, error) {
+	if cfg.Blocks < 1 {
+		return nil, fmt.Errorf("fs: a cache needs at least 1 block, got %d", cfg.Blocks)
+	}
+	if cfg.ReadAhead < 0 || cfg.ReadAhead >= cfg.Blocks {
+		return nil, fmt.Errorf("fs: read-ahead of %d blocks doesn't fit a %d-block cache", cfg.ReadAhead, cfg.Blocks)
+	}
+	c := &Cache{cfg: cfg, order: list.New(), at: map[cacheKey]*list.Element{}}
+	if cfg.WriteBack && cfg.FlushEvery > 0 {
+		c.stop, c.stopped = make(chan struct{}), make(chan struct{})
+		go c.flusher()
+	}
+	return c, nil
+}
+
+// flusher flushes every FlushEvery until Close.
+func (c *Cache) flusher() {
+	defer close(c.stopped)
+	t := time.NewTicker(c.cfg.FlushEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-t.C:
+			if err := c.Flush(); err != nil {
+				c.mu.Lock()
+				if c.err == nil {
+					c.err = err
+				}
+				c.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Device returns dev seen through the cache.
+func (c *Cache) Device(dev Device) Device {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.devs = append(c.devs, dev)
+	return &cachedDevice{c: c, id: len(c.devs) - 1, last: -2}
+}
+
+// Stats returns the traffic so far.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Flush writes every dirty block back, in device and block order.
+func (c *Cache) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Flushes++
+	var dirty []*cacheBlock
+	for e := c.order.Front(); e != nil; e = e.Next() {
+		if b := e.Value.(*cacheBlock); b.dirty {
+			dirty = append(dirty, b)
+		}
+	}
+	sort.Slice(dirty, func(i, j int) bool {
+		a, b := dirty[i].key, dirty[j].key
+		return a.dev < b.dev || a.dev == b.dev && a.n < b.n
+	})
+	for _, b := range dirty {
+		if err := c.writeBack(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the flusher and flushes, returning the first error the
+// flusher met, if any.
+func (c *Cache) Close() error {
+	if c.stop != nil {
+		close(c.stop)
+		<-c.stopped
+		c.stop = nil
+	}
+	err := c.Flush()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return err
+}
+
+func (c *Cache) writeBack(b *cacheBlock) error {
+	if err := c.devs[b.key.dev].WriteBlock(b.key.n, b.data); err != nil {
+		return err
+	}
+	c.stats.DeviceWrites++
+	b.dirty = false
+	return nil
+}
+
+// insert caches a block, evicting the least recently used beyond the
+// cache's size.
+func (c *Cache) insert(b *cacheBlock) error {
+	c.at[b.key] = c.order.PushFront(b)
+	for c.order.Len() > c.cfg.Blocks {
+		e := c.order.Back()
+		old := e.Value.(*cacheBlock)
+		if old.dirty {
+			if err := c.writeBack(old); err != nil {
+				return err
+			}
+			c.stats.DirtyEvictions++
+		}
+		c.order.Remove(e)
+		delete(c.at, old.key)
+		c.stats.Evictions++
+	}
+	return nil
+}
+
+// fetch reads block n of device id from the device, as exactly BlockSize
+// bytes (a raid.Disk block past the end of its file reads as zeros).
+func (c *Cache) fetch(id, n int) ([]byte, error) {
+	data, err := c.devs[id].ReadBlock(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	c.stats.DeviceReads++
+	if len(data) < BlockSize {
+		data = append(data, make([]byte, BlockSize-len(data))...)
+	}
+	return data[:BlockSize], nil
+}
+
+// cachedDevice is one device's view of a Cache.
+type cachedDevice struct {
+	c    *Cache
+	id   int
+	last int // the last block read, to spot sequential reads
+}
+
+func (d *cachedDevice) ReadBlock(n int) ([]byte, error) {
+	c := d.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Reads++
+	seq := n == d.last+1
+	d.last = n
+	key := cacheKey{d.id, n}
+	if e, ok := c.at[key]; ok {
+		c.stats.Hits++
+		b := e.Value.(*cacheBlock)
+		if b.readAhead {
+			c.stats.ReadAheadHits++
+			b.readAhead = false
+		}
+		c.order.MoveToFront(e)
+		return append([]byte(nil), b.data...), nil
+	}
+	data, err := c.fetch(d.id, n)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.insert(&cacheBlock{key: key, data: data}); err != nil {
+		return nil, err
+	}
+	if seq {
+		// Read ahead what isn't cached yet; a block past the device's end
+		// just stops it
+		for i := n + 1; i <= n+c.cfg.ReadAhead; i++ {
+			next := cacheKey{d.id, i}
+			if _, ok := c.at[next]; ok {
+				continue
+			}
+			ahead, err := c.fetch(d.id, i)
+			if err != nil {
+				break
+			}
+			c.stats.ReadAheads++
+			if err := c.insert(&cacheBlock{key: next, data: ahead, readAhead: true}); err != nil {
+				return nil, err
+			}
+			// Keep the block asked for ahead of those read after it
+			if e, ok := c.at[key]; ok {
+				c.order.MoveToFront(e)
+			}
+		}
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (d *cachedDevice) WriteBlock(n int, data []byte) error {
+	c := d.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Writes++
+	key := cacheKey{d.id, n}
+	buf := make([]byte, BlockSize)
+	copy(buf, data)
+	if !c.cfg.WriteBack {
+		if err := c.devs[d.id].WriteBlock(n, buf); err != nil {
+			return err
+		}
+		c.stats.DeviceWrites++
+	}
+	if e, ok := c.at[key]; ok {
+		b := e.Value.(*cacheBlock)
+		b.data, b.readAhead = buf, false
+		b.dirty = b.dirty || c.cfg.WriteBack
+		c.order.MoveToFront(e)
+		return nil
+	}
+	return c.insert(&cacheBlock{key: key, data: buf, dirty: c.cfg.WriteBack})
+}
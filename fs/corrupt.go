@@ -0,0 +1,226 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Populate fills an empty file system with the tree Corruptions damage:
+// /a.txt, /big (past the direct blocks, so it has an indirect block),
+// /docs with b.txt, a hard link to /a.txt and an empty directory sub, and
+// /keep.txt, which no corruption touches.
+func Populate(f *FS) error {
+	for _, d := range []string{"/docs", "/docs/sub"} {
+		if err := f.Mkdir(d); err != nil {
+			return err
+		}
+	}
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"/a.txt", []byte("the quick brown fox\n")},
+		{"/docs/b.txt", bytes.Repeat([]byte("b"), BlockSize+100)},
+		{"/big", bytes.Repeat([]byte("0123456789abcdef"), (direct+2)*BlockSize/16)},
+		{"/keep.txt", KeepData},
+	}
+	for _, file := range files {
+		if err := f.WriteFile(file.name, file.data); err != nil {
+			return err
+		}
+	}
+	return f.Link("/a.txt", "/docs/a-link")
+}
+
+// KeepData is /keep.txt's contents, which must survive every repair.
+var KeepData = []byte("this file must survive fsck\n")
+
+// Corruption damages a populated file system in one way, behind the
+// FS's back, by writing the device directly.
+type Corruption struct {
+	Name  string
+	What  string
+	Apply func(f *FS) error
+}
+
+// Corruptions are the damage fsck is expected to detect and repair.
+var Corruptions = []Corruption{
+	{"superblock", "a layout field of the superblock is wrong", func(f *FS) error {
+		b, err := readBlock(f.dev, 0)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(b[4*7:], uint32(f.sb.DataStart+3))
+		return f.dev.WriteBlock(0, b)
+	}},
+	{"orphaned-block", "a free data block marked in use", func(f *FS) error {
+		return f.setBitmap(false, f.freeData(), true)
+	}},
+	{"lost-block", "a block of /a.txt marked free", func(f *FS) error {
+		_, ino, err := f.target("/a.txt")
+		if err != nil {
+			return err
+		}
+		return f.setBitmap(false, ino.Direct[0]-f.sb.DataStart, false)
+	}},
+	{"leaked-inode", "a free inode marked in use", func(f *FS) error {
+		return f.setBitmap(true, f.freeInum(), true)
+	}},
+	{"lost-inode", "/docs/b.txt's inode marked free", func(f *FS) error {
+		inum, _, err := f.target("/docs/b.txt")
+		if err != nil {
+			return err
+		}
+		return f.setBitmap(true, inum, false)
+	}},
+	{"dangling-inode", "a file with data that no directory names", func(f *FS) error {
+		inum, err := f.allocInode(TypeFile, RootInode)
+		if err != nil {
+			return err
+		}
+		if _, err := f.writeAt(inum, []byte("nobody's file\n"), 0); err != nil {
+			return err
+		}
+		return f.setLinks(inum, 1)
+	}},
+	{"dangling-dir", "a directory with a file in it, unlinked but never freed", func(f *FS) error {
+		if err := f.Mkdir("/lost"); err != nil {
+			return err
+		}
+		if err := f.WriteFile("/lost/x", []byte("in a lost directory\n")); err != nil {
+			return err
+		}
+		_, slot, err := f.lookup(RootInode, "lost")
+		if err != nil {
+			return err
+		}
+		return f.writeEntry(RootInode, slot, DirEntry{})
+	}},
+	{"links-high", "/a.txt's link count too high", func(f *FS) error {
+		return f.mutate("/a.txt", func(ino *Inode) { ino.Links += 3 })
+	}},
+	{"links-low", "/docs's link count too low", func(f *FS) error {
+		return f.mutate("/docs", func(ino *Inode) { ino.Links-- })
+	}},
+	{"dangling-entry", "a directory entry naming a free inode", func(f *FS) error {
+		return f.addEntry(RootInode, "ghost", f.freeInum())
+	}},
+	{"bad-pointer", "a block pointer of /docs/b.txt outside the data region", func(f *FS) error {
+		return f.mutate("/docs/b.txt", func(ino *Inode) { ino.Direct[0] = f.sb.Blocks + 10 })
+	}},
+	{"duplicate-block", "/docs/b.txt sharing a block with /a.txt", func(f *FS) error {
+		_, a, err := f.target("/a.txt")
+		if err != nil {
+			return err
+		}
+		return f.mutate("/docs/b.txt", func(ino *Inode) { ino.Direct[1] = a.Direct[0] })
+	}},
+	{"past-size", "/a.txt pointing to a block past its size", func(f *FS) error {
+		b, err := f.allocBlock(0)
+		if err != nil {
+			return err
+		}
+		return f.mutate("/a.txt", func(ino *Inode) { ino.Direct[5] = b })
+	}},
+	{"bad-indirect", "garbage pointers in /big's indirect block", func(f *FS) error {
+		_, ino, err := f.target("/big")
+		if err != nil {
+			return err
+		}
+		ptrs, err := readBlock(f.dev, ino.Indirect)
+		if err != nil {
+			return err
+		}
+		for i := 5; i < 9; i++ {
+			binary.LittleEndian.PutUint32(ptrs[4*i:], 0xdead0000+uint32(i))
+		}
+		return f.dev.WriteBlock(ino.Indirect, ptrs)
+	}},
+	{"bad-type", "/docs/b.txt's inode has an unknown type", func(f *FS) error {
+		return f.mutate("/docs/b.txt", func(ino *Inode) { ino.Type = 9 })
+	}},
+	{"bad-dotdot", `/docs/sub's ".." naming itself`, func(f *FS) error {
+		inum, _, err := f.target("/docs/sub")
+		if err != nil {
+			return err
+		}
+		return f.writeEntry(inum, 1, DirEntry{Name: "..", Inode: inum})
+	}},
+	{"no-dot", `/docs missing its "." entry`, func(f *FS) error {
+		inum, _, err := f.target("/docs")
+		if err != nil {
+			return err
+		}
+		return f.writeEntry(inum, 0, DirEntry{})
+	}},
+	{"dir-hard-link", "a second name for directory /docs", func(f *FS) error {
+		inum, _, err := f.target("/docs")
+		if err != nil {
+			return err
+		}
+		return f.addEntry(RootInode, "docs2", inum)
+	}},
+	{"dir-size", "/docs's size not a whole number of entries", func(f *FS) error {
+		return f.mutate("/docs", func(ino *Inode) { ino.Size += 5 })
+	}},
+}
+
+// FindCorruption looks up a corruption by name.
+func FindCorruption(name string) (Corruption, error) {
+	for _, c := range Corruptions {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return Corruption{}, fmt.Errorf("fs: no corruption %q", name)
+}
+
+// target resolves path to its inode.
+func (f *FS) target(path string) (int, Inode, error) {
+	inum, err := f.resolve(path)
+	if err != nil {
+		return 0, Inode{}, err
+	}
+	ino, err := f.Inode(inum)
+	return inum, ino, err
+}
+
+// mutate rewrites the inode at path.
+func (f *FS) mutate(path string, change func(*Inode)) error {
+	inum, ino, err := f.target(path)
+	if err != nil {
+		return err
+	}
+	change(&ino)
+	return f.writeInode(inum, ino)
+}
+
+// freeInum and freeData return the last free inode and data block.
+func (f *FS) freeInum() int {
+	for i := f.sb.Inodes - 1; i > 0; i-- {
+		if !bit(f.ibmap, i) {
+			return i
+		}
+	}
+	return 0
+}
+
+func (f *FS) freeData() int {
+	for i := f.sb.DataBlocks() - 1; i > 0; i-- {
+		if !bit(f.dbmap, i) {
+			return i
+		}
+	}
+	return 0
+}
+
+// setBitmap sets bit i of the inode or data bitmap to v and writes it.
+func (f *FS) setBitmap(inodes bool, i int, v bool) error {
+	if inodes {
+		setBit(f.ibmap, i, v)
+		return f.dev.WriteBlock(f.sb.InodeBitmap, f.ibmap)
+	}
+	setBit(f.dbmap, i, v)
+	return f.dev.WriteBlock(f.sb.DataBitmap, f.dbmap)
+}
@@ -0,0 +1,98 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"example.com/operating-systems/HW7/raid"
+)
+
+// BlockSize is the file system's block, the size of a raid.Disk block.
+const BlockSize = raid.BlockSize
+
+// Device is the block device a file system lives on. *raid.Disk is one;
+// Array makes any RAID array one.
+type Device interface {
+	ReadBlock(n int) ([]byte, error)
+	WriteBlock(n int, data []byte) error
+}
+
+// Array adapts a RAID array (raid.RAID0, RAID1, RAID4, RAID5) to a Device.
+type Array struct{ raid.RAID }
+
+func (a Array) ReadBlock(n int) ([]byte, error)     { return a.Read(n) }
+func (a Array) WriteBlock(n int, data []byte) error { return a.Write(n, data) }
+
+// MemDevice is a Device in memory, counting its I/O.
+type MemDevice struct {
+	blocks        [][]byte
+	Reads, Writes int
+}
+
+// NewMemDevice returns a zeroed device of n blocks.
+func NewMemDevice(n int) *MemDevice {
+	d := &MemDevice{blocks: make([][]byte, n)}
+	for i := range d.blocks {
+		d.blocks[i] = make([]byte, BlockSize)
+	}
+	return d
+}
+
+func (d *MemDevice) ReadBlock(n int) ([]byte, error) {
+	if n < 0 || n >= len(d.blocks) {
+		return nil, fmt.Errorf("fs: block %d is outside the %d-block device", n, len(d.blocks))
+	}
+	d.Reads++
+	return append([]byte(nil), d.blocks[n]...), nil
+}
+
+func (d *MemDevice) WriteBlock(n int, data []byte) error {
+	if n < 0 || n >= len(d.blocks) {
+		return fmt.Errorf("fs: block %d is outside the %d-block device", n, len(d.blocks))
+	}
+	d.Writes++
+	copy(d.blocks[n], data)
+	return nil
+}
+
+// Clone copies the device, counters and all.
+func (d *MemDevice) Clone() *MemDevice {
+	c := &MemDevice{blocks: make([][]byte, len(d.blocks)), Reads: d.Reads, Writes: d.Writes}
+	for i, b := range d.blocks {
+		c.blocks[i] = append([]byte(nil), b...)
+	}
+	return c
+}
+
+// ErrCrashed is what a CrashDevice's writes return once it has crashed.
+var ErrCrashed = errors.New("fs: device crashed")
+
+// CrashDevice passes reads and the first Left writes through to Device,
+// then crashes: every later write is lost, as if the power went out. Each
+// block write is atomic.
+type CrashDevice struct {
+	Device
+	Left int
+}
+
+func (d *CrashDevice) WriteBlock(n int, data []byte) error {
+	if d.Left <= 0 {
+		return ErrCrashed
+	}
+	d.Left--
+	return d.Device.WriteBlock(n, data)
+}
+
+// readBlock reads block n of dev as exactly BlockSize bytes. A raid.Disk
+// is a plain file, so a block past its end (never written) reads as zeros.
+func readBlock(dev Device, n int) ([]byte, error) {
+	data, err := dev.ReadBlock(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(data) < BlockSize {
+		data = append(data, make([]byte, BlockSize-len(data))...)
+	}
+	return data[:BlockSize], nil
+}
@@ -0,0 +1,444 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// DirEntry is one name in a directory.
+type DirEntry struct {
+	Name  string
+	Inode int
+}
+
+// entries reads every slot of directory dir; a free slot has an empty name.
+func (f *FS) entries(dir int) ([]DirEntry, error) {
+	ino, err := f.Inode(dir)
+	if err != nil {
+		return nil, err
+	}
+	if ino.Type != TypeDir {
+		return nil, ErrNotDir
+	}
+	buf := make([]byte, ino.Size)
+	if _, err := f.readAt(dir, buf, 0); err != nil {
+		return nil, err
+	}
+	return parseEntries(buf), nil
+}
+
+// parseEntries decodes the slots of a directory's contents.
+func parseEntries(buf []byte) []DirEntry {
+	out := make([]DirEntry, len(buf)/dirEntrySize)
+	for i := range out {
+		e := buf[i*dirEntrySize:]
+		name, _, _ := bytes.Cut(e[4:dirEntrySize], []byte{0})
+		out[i] = DirEntry{Name: string(name), Inode: int(binary.LittleEndian.Uint32(e))}
+	}
+	return out
+}
+
+// writeEntry writes slot i of directory dir.
+func (f *FS) writeEntry(dir, i int, e DirEntry) error {
+	b := make([]byte, dirEntrySize)
+	binary.LittleEndian.PutUint32(b, uint32(e.Inode))
+	copy(b[4:], e.Name)
+	_, err := f.writeAt(dir, b, i*dirEntrySize)
+	return err
+}
+
+// lookup finds name in directory dir and returns its inode and slot.
+func (f *FS) lookup(dir int, name string) (int, int, error) {
+	ents, err := f.entries(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i, e := range ents {
+		if e.Name != "" && e.Name == name {
+			return e.Inode, i, nil
+		}
+	}
+	return 0, 0, ErrNotFound
+}
+
+// addEntry puts name -> inum in directory dir, in the first free slot or
+// at the end.
+func (f *FS) addEntry(dir int, name string, inum int) error {
+	ents, err := f.entries(dir)
+	if err != nil {
+		return err
+	}
+	slot := len(ents)
+	for i, e := range ents {
+		if e.Name == "" {
+			slot = i
+			break
+		}
+	}
+	return f.writeEntry(dir, slot, DirEntry{Name: name, Inode: inum})
+}
+
+// initDir writes the "." and ".." entries of a new directory.
+func (f *FS) initDir(dir, parent int) error {
+	if err := f.writeEntry(dir, 0, DirEntry{Name: ".", Inode: dir}); err != nil {
+		return err
+	}
+	if err := f.writeEntry(dir, 1, DirEntry{Name: "..", Inode: parent}); err != nil {
+		return err
+	}
+	return f.setLinks(dir, 2)
+}
+
+// setLinks sets inode inum's link count.
+func (f *FS) setLinks(inum, links int) error {
+	ino, err := f.Inode(inum)
+	if err != nil {
+		return err
+	}
+	ino.Links = links
+	return f.writeInode(inum, ino)
+}
+
+// split turns an absolute path into its names.
+func split(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, ErrBadPath
+	}
+	var names []string
+	for _, n := range strings.Split(path, "/") {
+		if n != "" {
+			names = append(names, n)
+		}
+	}
+	return names, nil
+}
+
+// resolve returns the inode path names.
+func (f *FS) resolve(path string) (int, error) {
+	names, err := split(path)
+	if err != nil {
+		return 0, err
+	}
+	inum := RootInode
+	for _, n := range names {
+		if inum, _, err = f.lookup(inum, n); err != nil {
+			return 0, err
+		}
+	}
+	return inum, nil
+}
+
+// parent resolves everything but the last name of path, which must be a
+// directory, and returns it with the last name. The root has no parent.
+func (f *FS) parent(path string) (int, string, error) {
+	names, err := split(path)
+	if err != nil {
+		return 0, "", err
+	}
+	if len(names) == 0 {
+		return 0, "", ErrBadPath
+	}
+	name := names[len(names)-1]
+	if len(name) > MaxNameLen {
+		return 0, "", ErrNameTooLong
+	}
+	dir, err := f.resolve("/" + strings.Join(names[:len(names)-1], "/"))
+	if err != nil {
+		return 0, "", err
+	}
+	return dir, name, nil
+}
+
+// create makes an empty inode of type t named path.
+func (f *FS) create(path string, t FileType) (int, int, error) {
+	if path == "/" {
+		return 0, 0, ErrExists
+	}
+	dir, name, err := f.parent(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, _, err := f.lookup(dir, name); err == nil {
+		return 0, 0, ErrExists
+	} else if err != ErrNotFound {
+		return 0, 0, err
+	}
+	inum, err := f.allocInode(t, dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	return dir, inum, f.addEntry(dir, name, inum)
+}
+
+// Create makes an empty file.
+func (f *FS) Create(path string) error {
+	return f.atomic(func() error {
+		_, inum, err := f.create(path, TypeFile)
+		if err != nil {
+			return err
+		}
+		return f.setLinks(inum, 1)
+	})
+}
+
+// Mkdir makes an empty directory.
+func (f *FS) Mkdir(path string) error {
+	return f.atomic(func() error {
+		dir, inum, err := f.create(path, TypeDir)
+		if err != nil {
+			return err
+		}
+		if err := f.initDir(inum, dir); err != nil {
+			return err
+		}
+		// The new directory's ".." links to its parent
+		p, err := f.Inode(dir)
+		if err != nil {
+			return err
+		}
+		return f.setLinks(dir, p.Links+1)
+	})
+}
+
+// Link gives the file at old a second name, new (a hard link).
+func (f *FS) Link(old, new string) error {
+	return f.atomic(func() error {
+		inum, err := f.resolve(old)
+		if err != nil {
+			return err
+		}
+		ino, err := f.Inode(inum)
+		if err != nil {
+			return err
+		}
+		if ino.Type == TypeDir {
+			return ErrIsDir
+		}
+		dir, name, err := f.parent(new)
+		if err != nil {
+			return err
+		}
+		if _, _, err := f.lookup(dir, name); err == nil {
+			return ErrExists
+		}
+		if err := f.addEntry(dir, name, inum); err != nil {
+			return err
+		}
+		return f.setLinks(inum, ino.Links+1)
+	})
+}
+
+// Unlink removes a file's name, and the file itself with its last name.
+func (f *FS) Unlink(path string) error {
+	return f.atomic(func() error {
+		dir, name, err := f.parent(path)
+		if err != nil {
+			return err
+		}
+		inum, slot, err := f.lookup(dir, name)
+		if err != nil {
+			return err
+		}
+		ino, err := f.Inode(inum)
+		if err != nil {
+			return err
+		}
+		if ino.Type == TypeDir {
+			return ErrIsDir
+		}
+		if err := f.writeEntry(dir, slot, DirEntry{}); err != nil {
+			return err
+		}
+		if ino.Links > 1 {
+			return f.setLinks(inum, ino.Links-1)
+		}
+		return f.release(inum, ino)
+	})
+}
+
+// Rmdir removes an empty directory.
+func (f *FS) Rmdir(path string) error {
+	return f.atomic(func() error {
+		dir, name, err := f.parent(path)
+		if err != nil {
+			return err
+		}
+		if name == "." || name == ".." {
+			return ErrBadPath
+		}
+		inum, slot, err := f.lookup(dir, name)
+		if err != nil {
+			return err
+		}
+		ents, err := f.entries(inum)
+		if err != nil {
+			return err
+		}
+		for _, e := range ents {
+			if e.Name != "" && e.Name != "." && e.Name != ".." {
+				return ErrNotEmpty
+			}
+		}
+		if err := f.writeEntry(dir, slot, DirEntry{}); err != nil {
+			return err
+		}
+		p, err := f.Inode(dir)
+		if err != nil {
+			return err
+		}
+		if err := f.setLinks(dir, p.Links-1); err != nil {
+			return err
+		}
+		ino, err := f.Inode(inum)
+		if err != nil {
+			return err
+		}
+		return f.release(inum, ino)
+	})
+}
+
+// release frees an inode and its blocks.
+func (f *FS) release(inum int, ino Inode) error {
+	blocks, err := f.blocks(ino)
+	if err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		if err := f.freeBlock(b); err != nil {
+			return err
+		}
+	}
+	return f.freeInode(inum)
+}
+
+// file resolves path to a regular file.
+func (f *FS) file(path string) (int, error) {
+	inum, err := f.resolve(path)
+	if err != nil {
+		return 0, err
+	}
+	ino, err := f.Inode(inum)
+	if err != nil {
+		return 0, err
+	}
+	if ino.Type == TypeDir {
+		return 0, ErrIsDir
+	}
+	return inum, nil
+}
+
+// ReadAt reads the file at path from offset off, up to its end.
+func (f *FS) ReadAt(path string, p []byte, off int) (int, error) {
+	inum, err := f.file(path)
+	if err != nil {
+		return 0, err
+	}
+	return f.readAt(inum, p, off)
+}
+
+// WriteAt writes p to the file at path at offset off, growing it as needed.
+func (f *FS) WriteAt(path string, p []byte, off int) (int, error) {
+	inum, err := f.file(path)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = f.atomic(func() error {
+		n, err = f.writeAt(inum, p, off)
+		return err
+	})
+	return n, err
+}
+
+// ReadFile returns the whole file at path.
+func (f *FS) ReadFile(path string) ([]byte, error) {
+	inum, err := f.file(path)
+	if err != nil {
+		return nil, err
+	}
+	ino, err := f.Inode(inum)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, ino.Size)
+	n, err := f.readAt(inum, buf, 0)
+	return buf[:n], err
+}
+
+// WriteFile replaces the contents of the file at path with data, creating
+// it if needed.
+func (f *FS) WriteFile(path string, data []byte) error {
+	return f.atomic(func() error {
+		inum, err := f.file(path)
+		if err == ErrNotFound {
+			if err = f.Create(path); err == nil {
+				inum, err = f.file(path)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if err := f.truncate(inum, 0); err != nil {
+			return err
+		}
+		_, err = f.writeAt(inum, data, 0)
+		return err
+	})
+}
+
+// Truncate shrinks the file at path to size bytes.
+func (f *FS) Truncate(path string, size int) error {
+	return f.atomic(func() error {
+		inum, err := f.file(path)
+		if err != nil {
+			return err
+		}
+		return f.truncate(inum, size)
+	})
+}
+
+// ReadDir lists the directory at path, "." and ".." included.
+func (f *FS) ReadDir(path string) ([]DirEntry, error) {
+	inum, err := f.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	ents, err := f.entries(inum)
+	if err != nil {
+		return nil, err
+	}
+	var out []DirEntry
+	for _, e := range ents {
+		if e.Name != "" {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// Stat describes a file or directory.
+type Stat struct {
+	Inode  int
+	Type   FileType
+	Links  int
+	Size   int
+	Blocks int // data blocks, the indirect block included
+}
+
+// Stat looks up path.
+func (f *FS) Stat(path string) (Stat, error) {
+	inum, err := f.resolve(path)
+	if err != nil {
+		return Stat{}, err
+	}
+	ino, err := f.Inode(inum)
+	if err != nil {
+		return Stat{}, err
+	}
+	blocks, err := f.blocks(ino)
+	if err != nil {
+		return Stat{}, err
+	}
+	return Stat{Inode: inum, Type: ino.Type, Links: ino.Links, Size: ino.Size, Blocks: len(blocks)}, nil
+}
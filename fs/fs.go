@@ -0,0 +1,316 @@
+// Package fs is a very simple file system in the style of OSTEP's vsfs,
+// on any block Device (a raid.Disk, a RAID array, or memory). The disk
+// holds, in order: a superblock, an inode bitmap block, a data bitmap
+// block, the inode table, and the data blocks. Inodes are 128 bytes with
+// 12 direct block pointers and one indirect block; a directory is a file
+// of fixed 32-byte entries (inode number and name), starting with "." and
+// "..". An optional journal sits between the inode table and the data
+// blocks. Every change is written through to the device at once (through
+// the journal, when mounted with one), so there is no cache to flush and
+// nothing to lose at unmount. An FS is not safe for concurrent use.
+package fs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotFound    = errors.New("fs: no such file or directory")
+	ErrExists      = errors.New("fs: file exists")
+	ErrNotDir      = errors.New("fs: not a directory")
+	ErrIsDir       = errors.New("fs: is a directory")
+	ErrNotEmpty    = errors.New("fs: directory not empty")
+	ErrNoSpace     = errors.New("fs: no free data blocks")
+	ErrNoInodes    = errors.New("fs: no free inodes")
+	ErrNameTooLong = errors.New("fs: file name too long")
+	ErrTooBig      = errors.New("fs: file too large")
+	ErrBadPath     = errors.New("fs: invalid path (not absolute, or the root)")
+	ErrBadFS       = errors.New("fs: not a file system (bad superblock)")
+	ErrNoJournal   = errors.New("fs: the file system has no journal")
+	ErrTxTooBig    = errors.New("fs: transaction doesn't fit in the journal")
+)
+
+const (
+	magic          = 0x76736673 // "vsfs"
+	InodeSize      = 128
+	inodesPerBlock = BlockSize / InodeSize
+	direct         = 12
+	ptrsPerBlock   = BlockSize / 4
+	// MaxFileSize is what the direct blocks and one indirect block reach.
+	MaxFileSize  = (direct + ptrsPerBlock) * BlockSize
+	dirEntrySize = 32
+	// MaxNameLen is the longest name a directory entry holds.
+	MaxNameLen = dirEntrySize - 4 - 1
+	// RootInode is the root directory's inode number.
+	RootInode = 0
+)
+
+// Superblock describes the layout; it is block 0.
+type Superblock struct {
+	Blocks      int // device blocks the file system uses
+	Inodes      int
+	InodeBitmap int // block numbers
+	DataBitmap  int
+	InodeTable  int
+	InodeBlocks int
+	Journal     int // first journal block
+	JournalSize int // journal blocks, 0 for none
+	DataStart   int // first data block; data block i of the bitmap is DataStart+i
+	Groups      int // block groups, each with its share of the inode table; 0 for none
+}
+
+// DataBlocks is the size of the data region.
+func (sb Superblock) DataBlocks() int { return sb.Blocks - sb.DataStart }
+
+func (sb Superblock) encode() []byte {
+	b := make([]byte, BlockSize)
+	for i, v := range []int{magic, sb.Blocks, sb.Inodes, sb.InodeBitmap, sb.DataBitmap, sb.InodeTable, sb.InodeBlocks, sb.DataStart, sb.Journal, sb.JournalSize, sb.Groups} {
+		binary.LittleEndian.PutUint32(b[4*i:], uint32(v))
+	}
+	return b
+}
+
+func decodeSuper(b []byte) (Superblock, error) {
+	f := make([]int, 11)
+	for i := range f {
+		f[i] = int(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	sb := Superblock{Blocks: f[1], Inodes: f[2], InodeBitmap: f[3], DataBitmap: f[4], InodeTable: f[5], InodeBlocks: f[6], DataStart: f[7], Journal: f[8], JournalSize: f[9], Groups: f[10]}
+	if f[0] != magic {
+		return sb, ErrBadFS
+	}
+	return sb, nil
+}
+
+// layout plans a file system of blocks blocks, inodes inodes, a journal
+// of journal blocks, and groups block groups (0 or 1 for none). With
+// groups the inode table is split among them, each share at the start of
+// its group's stretch of the data region, and inodes is rounded up to
+// fill every share.
+func layout(blocks, inodes, journal, groups int) (Superblock, error) {
+	sb := Superblock{Blocks: blocks, Inodes: inodes, InodeBitmap: 1, DataBitmap: 2, InodeTable: 3, JournalSize: journal, Groups: groups}
+	sb.InodeBlocks = (inodes + inodesPerBlock - 1) / inodesPerBlock
+	if groups > 1 {
+		sb.InodeBlocks = (sb.InodeBlocks + groups - 1) / groups * groups
+		sb.Inodes = min(sb.InodeBlocks*inodesPerBlock, 8*BlockSize) // every group gets its share
+		sb.InodeTable = 0
+		sb.Journal = sb.DataBitmap + 1
+	} else {
+		sb.Journal = sb.InodeTable + sb.InodeBlocks
+	}
+	sb.DataStart = sb.Journal + journal
+	switch {
+	case inodes < 1 || inodes > 8*BlockSize:
+		return sb, fmt.Errorf("fs: need 1 to %d inodes, got %d", 8*BlockSize, inodes)
+	case journal < 0 || journal > 0 && journal < 3:
+		return sb, fmt.Errorf("fs: a journal needs at least 3 blocks, got %d", journal)
+	case groups < 0:
+		return sb, fmt.Errorf("fs: negative group count %d", groups)
+	case sb.DataBlocks() < 1:
+		return sb, fmt.Errorf("fs: %d blocks leave no room for data after %d inode and %d journal blocks", blocks, sb.InodeBlocks, journal)
+	case sb.DataBlocks() > 8*BlockSize:
+		return sb, fmt.Errorf("fs: at most %d data blocks, got %d", 8*BlockSize, sb.DataBlocks())
+	case groups > 1 && sb.DataBlocks()/groups <= sb.groupInodeBlocks():
+		return sb, fmt.Errorf("fs: %d data blocks in %d groups leave no room for data after each group's %d inode blocks",
+			sb.DataBlocks(), groups, sb.groupInodeBlocks())
+	}
+	return sb, nil
+}
+
+// FS is a mounted file system.
+type FS struct {
+	dev   Device
+	sb    Superblock
+	ibmap []byte // cached, written through
+	dbmap []byte
+	mode  JournalMode
+	tx    map[int][]byte // blocks logged by the open transaction
+	order []int          // and the order they were first written in
+	freed map[int]bool   // blocks it freed, not reused until it commits
+	seq   int            // transactions committed
+}
+
+// Mkfs writes an empty file system of blocks blocks with room for inodes
+// files and directories and a journal of journal blocks (0 for none) to
+// dev: the superblock, empty bitmaps, a zeroed inode table, an empty
+// journal, and the root directory.
+func Mkfs(dev Device, blocks, inodes, journal int) error {
+	return MkfsGroups(dev, blocks, inodes, journal, 0)
+}
+
+// MkfsGroups is Mkfs for a file system in groups block groups, which
+// allocates FFS style (see group.go); 0 or 1 groups is Mkfs's flat layout.
+func MkfsGroups(dev Device, blocks, inodes, journal, groups int) error {
+	sb, err := layout(blocks, inodes, journal, groups)
+	if err != nil {
+		return err
+	}
+	zero := make([]byte, BlockSize)
+	for b := sb.InodeBitmap; b < sb.DataStart; b++ {
+		if err := dev.WriteBlock(b, zero); err != nil {
+			return err
+		}
+	}
+	if sb.grouped() {
+		// Zero each group's inode blocks, and mark them in use
+		dbmap := make([]byte, BlockSize)
+		for i := 0; i < sb.DataBlocks(); i++ {
+			if sb.reserved(i) {
+				if err := dev.WriteBlock(sb.DataStart+i, zero); err != nil {
+					return err
+				}
+				setBit(dbmap, i, true)
+			}
+		}
+		if err := dev.WriteBlock(sb.DataBitmap, dbmap); err != nil {
+			return err
+		}
+	}
+	if err := dev.WriteBlock(0, sb.encode()); err != nil {
+		return err
+	}
+	f, err := Mount(dev)
+	if err != nil {
+		return err
+	}
+	root, err := f.allocInode(TypeDir, RootInode)
+	if err != nil {
+		return err
+	}
+	return f.initDir(root, root)
+}
+
+// Mount mounts the file system on dev without journaling.
+func Mount(dev Device) (*FS, error) { return MountJournal(dev, NoJournal) }
+
+// MountJournal mounts the file system on dev, logging changes as mode says.
+// Either way it first recovers: a transaction committed to the journal but
+// not yet written in place is replayed.
+func MountJournal(dev Device, mode JournalMode) (*FS, error) {
+	b, err := readBlock(dev, 0)
+	if err != nil {
+		return nil, err
+	}
+	sb, err := decodeSuper(b)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := layout(sb.Blocks, sb.Inodes, sb.JournalSize, sb.Groups); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadFS, err)
+	}
+	if mode != NoJournal && sb.JournalSize == 0 {
+		return nil, ErrNoJournal
+	}
+	if _, err := replay(dev, sb); err != nil {
+		return nil, err
+	}
+	f := &FS{dev: dev, sb: sb, mode: mode}
+	if err := f.loadBitmaps(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// loadBitmaps reads both bitmaps from the device.
+func (f *FS) loadBitmaps() error {
+	var err error
+	if f.ibmap, err = readBlock(f.dev, f.sb.InodeBitmap); err != nil {
+		return err
+	}
+	f.dbmap, err = readBlock(f.dev, f.sb.DataBitmap)
+	return err
+}
+
+// Superblock returns the file system's layout.
+func (f *FS) Superblock() Superblock { return f.sb }
+
+// Statfs counts the file system's free space.
+type Statfs struct {
+	Blocks, FreeBlocks int // data blocks
+	Inodes, FreeInodes int
+}
+
+func (f *FS) Statfs() Statfs {
+	s := Statfs{Inodes: f.sb.Inodes}
+	for i := 0; i < f.sb.DataBlocks(); i++ {
+		if f.sb.reserved(i) {
+			continue
+		}
+		s.Blocks++
+		if !bit(f.dbmap, i) {
+			s.FreeBlocks++
+		}
+	}
+	for i := 0; i < s.Inodes; i++ {
+		if !bit(f.ibmap, i) {
+			s.FreeInodes++
+		}
+	}
+	return s
+}
+
+// bit reports bit i of a bitmap, setBit sets it to v.
+func bit(bm []byte, i int) bool { return bm[i/8]&(1<<(i%8)) != 0 }
+
+func setBit(bm []byte, i int, v bool) {
+	if v {
+		bm[i/8] |= 1 << (i % 8)
+	} else {
+		bm[i/8] &^= 1 << (i % 8)
+	}
+}
+
+// allocInode takes the first free inode from where inodeGoal says to
+// start looking for one of type t in directory parent, and writes it out
+// as an empty inode of type t.
+func (f *FS) allocInode(t FileType, parent int) (int, error) {
+	start := f.inodeGoal(t, parent)
+	for j := 0; j < f.sb.Inodes; j++ {
+		if i := (start + j) % f.sb.Inodes; !bit(f.ibmap, i) {
+			setBit(f.ibmap, i, true)
+			if err := f.write(f.sb.InodeBitmap, f.ibmap, true); err != nil {
+				return 0, err
+			}
+			return i, f.writeInode(i, Inode{Type: t})
+		}
+	}
+	return 0, ErrNoInodes
+}
+
+// freeInode clears inum's inode and its bitmap bit.
+func (f *FS) freeInode(inum int) error {
+	if err := f.writeInode(inum, Inode{}); err != nil {
+		return err
+	}
+	setBit(f.ibmap, inum, false)
+	return f.write(f.sb.InodeBitmap, f.ibmap, true)
+}
+
+// allocBlock takes the first free data block from data block goal on
+// (wrapping around), zeroes it, and returns its block number. A block the
+// open transaction freed is not free yet: until the commit, the old
+// metadata on disk may still point to it.
+func (f *FS) allocBlock(goal int) (int, error) {
+	for j := 0; j < f.sb.DataBlocks(); j++ {
+		if i := (goal + j) % f.sb.DataBlocks(); !bit(f.dbmap, i) && !f.freed[f.sb.DataStart+i] {
+			setBit(f.dbmap, i, true)
+			if err := f.write(f.sb.DataBitmap, f.dbmap, true); err != nil {
+				return 0, err
+			}
+			b := f.sb.DataStart + i
+			return b, f.write(b, make([]byte, BlockSize), false)
+		}
+	}
+	return 0, ErrNoSpace
+}
+
+// freeBlock returns data block b to the bitmap.
+func (f *FS) freeBlock(b int) error {
+	if f.freed != nil {
+		f.freed[b] = true
+	}
+	setBit(f.dbmap, b-f.sb.DataStart, false)
+	return f.write(f.sb.DataBitmap, f.dbmap, true)
+}
@@ -0,0 +1,476 @@
+package fs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Problem is one inconsistency Fsck found.
+type Problem struct {
+	What  string
+	Fixed bool
+}
+
+func (p Problem) String() string {
+	if p.Fixed {
+		return p.What + " (fixed)"
+	}
+	return p.What
+}
+
+// FsckReport is what Fsck found, and what it counted in use after any
+// repairs.
+type FsckReport struct {
+	Problems    []Problem
+	Files, Dirs int
+	Blocks      int // data blocks in use, indirect blocks included
+}
+
+// Clean reports whether the file system was consistent.
+func (r *FsckReport) Clean() bool { return len(r.Problems) == 0 }
+
+// Fixed counts the problems repaired.
+func (r *FsckReport) Fixed() int {
+	n := 0
+	for _, p := range r.Problems {
+		if p.Fixed {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *FsckReport) String() string {
+	var b strings.Builder
+	for _, p := range r.Problems {
+		fmt.Fprintf(&b, "  %v\n", p)
+	}
+	if r.Clean() {
+		fmt.Fprintf(&b, "clean: %d files, %d directories, %d data blocks\n", r.Files, r.Dirs, r.Blocks)
+	} else {
+		fmt.Fprintf(&b, "%d problem(s), %d fixed: %d files, %d directories, %d data blocks\n", len(r.Problems), r.Fixed(), r.Files, r.Dirs, r.Blocks)
+	}
+	return b.String()
+}
+
+// Fsck checks the file system on dev, and with repair set fixes what it
+// finds, in the order fsck does:
+//
+//   - the superblock's layout fields against its size and inode count;
+//   - the journal: a committed transaction never checkpointed is replayed;
+//   - every in-use inode: its type, size, and block pointers (outside the
+//     data region, past the file's size, or a block another inode already
+//     has are dropped);
+//   - both bitmaps against the inodes and blocks actually in use, so
+//     orphaned blocks and leaked inodes go back to the free pool;
+//   - the directory tree from the root: "." and "..", entries naming free
+//     inodes, and second links to a directory are fixed or removed;
+//   - link counts against the entries naming each inode; an inode no
+//     directory names (dangling) is freed with its blocks.
+//
+// A superblock with a bad magic number or an impossible size, or a root
+// that is not a directory, can't be repaired and is an error wrapping
+// ErrBadFS. Without repair nothing is written.
+func Fsck(dev Device, repair bool) (*FsckReport, error) {
+	b, err := readBlock(dev, 0)
+	if err != nil {
+		return nil, err
+	}
+	sb, err := decodeSuper(b)
+	if err != nil {
+		return nil, err
+	}
+	want, err := layout(sb.Blocks, sb.Inodes, sb.JournalSize, sb.Groups)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadFS, err)
+	}
+	if _, err := dev.ReadBlock(want.Blocks - 1); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: the device is smaller than its %d blocks: %v", ErrBadFS, want.Blocks, err)
+	}
+	c := &checker{
+		f:      &FS{dev: dev, sb: want},
+		repair: repair,
+		r:      &FsckReport{},
+		inodes: make([]Inode, want.Inodes),
+		data:   make([][]int, want.Inodes),
+		owner:  make([]int, want.DataBlocks()),
+		refs:   make([]int, want.Inodes),
+	}
+	for i := range c.owner {
+		if want.reserved(i) {
+			c.owner[i] = inodeTable
+		}
+	}
+	if sb != want {
+		c.report("superblock: layout %+v doesn't match %d blocks and %d inodes", sb, want.Blocks, want.Inodes)
+		if repair {
+			if err := dev.WriteBlock(0, want.encode()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	order, tx, err := committed(dev, want)
+	if err != nil {
+		return nil, err
+	}
+	if order != nil {
+		c.report("journal: a committed transaction of %d blocks was never checkpointed; replayed", len(order))
+		if repair {
+			if err := checkpoint(dev, want, order, tx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if c.f.ibmap, err = readBlock(dev, want.InodeBitmap); err != nil {
+		return nil, err
+	}
+	if c.f.dbmap, err = readBlock(dev, want.DataBitmap); err != nil {
+		return nil, err
+	}
+	for _, pass := range []func() error{c.scanInodes, c.checkBitmaps, c.walk, c.checkLinks} {
+		if err := pass(); err != nil {
+			return nil, err
+		}
+	}
+	return c.r, nil
+}
+
+// checker is the state of one Fsck run. Its inodes are the checked (and
+// in repair mode, written back) copies, so later passes never follow a bad
+// pointer even when nothing is written.
+type checker struct {
+	f      *FS
+	repair bool
+	r      *FsckReport
+	inodes []Inode
+	data   [][]int // per inode, the device block of each file block (0 for a hole)
+	owner  []int   // per data block, the inode using it plus one, or inodeTable
+	refs   []int   // per inode, directory entries naming it
+}
+
+// inodeTable owns a group's inode table blocks.
+const inodeTable = -1
+
+// report records a problem, fixed if repairing.
+func (c *checker) report(format string, args ...any) {
+	c.r.Problems = append(c.r.Problems, Problem{What: fmt.Sprintf(format, args...), Fixed: c.repair})
+}
+
+// scanInodes checks every in-use inode and claims its blocks.
+func (c *checker) scanInodes() error {
+	for inum := range c.inodes {
+		ino, err := c.f.Inode(inum)
+		if err != nil {
+			return err
+		}
+		if ino.Type == TypeFree {
+			continue
+		}
+		if ino.Type != TypeFile && ino.Type != TypeDir {
+			c.report("inode %d: unknown type %d; cleared", inum, int(ino.Type))
+			if err := c.writeInode(inum, Inode{}); err != nil {
+				return err
+			}
+			continue
+		}
+		changed := false
+		if ino.Size > MaxFileSize {
+			c.report("inode %d: size %d is past the largest file, %d", inum, ino.Size, MaxFileSize)
+			ino.Size, changed = MaxFileSize, true
+		}
+		if ino.Type == TypeDir && ino.Size%dirEntrySize != 0 {
+			c.report("inode %d: directory size %d is not a whole number of entries", inum, ino.Size)
+			ino.Size -= ino.Size % dirEntrySize
+			changed = true
+		}
+		nblocks := (ino.Size + BlockSize - 1) / BlockSize
+		data := make([]int, nblocks)
+		for n, b := range ino.Direct {
+			if b == 0 {
+				continue
+			}
+			if c.claim(inum, b, fmt.Sprintf("block %d", n), n >= nblocks) {
+				data[n] = b
+			} else {
+				ino.Direct[n] = 0
+				changed = true
+			}
+		}
+		if ino.Indirect != 0 {
+			if !c.claim(inum, ino.Indirect, "the indirect block", nblocks <= direct) {
+				ino.Indirect = 0
+				changed = true
+			} else if err := c.scanIndirect(inum, ino.Indirect, data); err != nil {
+				return err
+			}
+		}
+		if changed {
+			if err := c.writeInode(inum, ino); err != nil {
+				return err
+			}
+		}
+		c.inodes[inum], c.data[inum] = ino, data
+	}
+	return nil
+}
+
+// scanIndirect claims the blocks an indirect block points to.
+func (c *checker) scanIndirect(inum, ind int, data []int) error {
+	ptrs, err := readBlock(c.f.dev, ind)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i := 0; i < ptrsPerBlock; i++ {
+		b := int(binary.LittleEndian.Uint32(ptrs[4*i:]))
+		if b == 0 {
+			continue
+		}
+		n := direct + i
+		if c.claim(inum, b, fmt.Sprintf("block %d", n), n >= len(data)) {
+			data[n] = b
+		} else {
+			binary.LittleEndian.PutUint32(ptrs[4*i:], 0)
+			changed = true
+		}
+	}
+	if changed && c.repair {
+		return c.f.dev.WriteBlock(ind, ptrs)
+	}
+	return nil
+}
+
+// claim records device block b as used by inode inum, unless it is out
+// of the data region, past the file's end, or already taken; then it
+// reports the pointer, to be dropped, and returns false.
+func (c *checker) claim(inum, b int, what string, past bool) bool {
+	sb := c.f.sb
+	switch {
+	case b < sb.DataStart || b >= sb.Blocks:
+		c.report("inode %d: %s points outside the data region, to block %d; dropped", inum, what, b)
+	case c.owner[b-sb.DataStart] == inodeTable:
+		c.report("inode %d: %s points into the inode table, to block %d; dropped", inum, what, b)
+	case past:
+		c.report("inode %d: %s (block %d) lies past its size; dropped", inum, what, b)
+	case c.owner[b-sb.DataStart] != 0:
+		c.report("inode %d: %s (block %d) already belongs to inode %d; dropped", inum, what, b, c.owner[b-sb.DataStart]-1)
+	default:
+		c.owner[b-sb.DataStart] = inum + 1
+		return true
+	}
+	return false
+}
+
+// checkBitmaps makes both bitmaps match the inodes and blocks in use.
+func (c *checker) checkBitmaps() error {
+	f, sb := c.f, c.f.sb
+	ichanged, dchanged := false, false
+	for i := 0; i < 8*BlockSize; i++ {
+		used := i < sb.Inodes && c.inodes[i].Type != TypeFree
+		if bit(f.ibmap, i) == used {
+			continue
+		}
+		switch {
+		case used:
+			c.report("inode bitmap: inode %d is in use but marked free", i)
+		case i < sb.Inodes:
+			c.report("inode bitmap: inode %d is free but marked in use", i)
+		default:
+			c.report("inode bitmap: bit %d is set, past the last inode", i)
+		}
+		setBit(f.ibmap, i, used)
+		ichanged = true
+	}
+	for i := 0; i < 8*BlockSize; i++ {
+		used := i < sb.DataBlocks() && c.owner[i] != 0
+		if bit(f.dbmap, i) == used {
+			continue
+		}
+		switch {
+		case used && c.owner[i] == inodeTable:
+			c.report("data bitmap: inode table block %d is marked free", sb.DataStart+i)
+		case used:
+			c.report("data bitmap: block %d of inode %d is marked free", sb.DataStart+i, c.owner[i]-1)
+		case i < sb.DataBlocks():
+			c.report("data bitmap: block %d is marked in use but no inode has it (orphaned)", sb.DataStart+i)
+		default:
+			c.report("data bitmap: bit %d is set, past the last data block", i)
+		}
+		setBit(f.dbmap, i, used)
+		dchanged = true
+	}
+	if !c.repair {
+		return nil
+	}
+	if ichanged {
+		if err := f.dev.WriteBlock(sb.InodeBitmap, f.ibmap); err != nil {
+			return err
+		}
+	}
+	if dchanged {
+		return f.dev.WriteBlock(sb.DataBitmap, f.dbmap)
+	}
+	return nil
+}
+
+// walk checks the directory tree from the root, counting the entries
+// naming each inode.
+func (c *checker) walk() error {
+	if c.inodes[RootInode].Type != TypeDir {
+		return fmt.Errorf("%w: the root inode is not a directory", ErrBadFS)
+	}
+	type dir struct {
+		inum, parent int
+		path         string
+	}
+	seen := map[int]bool{RootInode: true}
+	queue := []dir{{RootInode, RootInode, "/"}}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		ents, err := c.entries(d.inum)
+		if err != nil {
+			return err
+		}
+		dot, dotdot := false, false
+		for slot, e := range ents {
+			if e.Name == "" {
+				continue
+			}
+			switch {
+			case e.Name == "." || e.Name == "..":
+				want, found := d.inum, &dot
+				if e.Name == ".." {
+					want, found = d.parent, &dotdot
+				}
+				if *found {
+					c.report("directory %s: a second %q entry; removed", d.path, e.Name)
+					if err := c.writeEntry(d.inum, slot, DirEntry{}); err != nil {
+						return err
+					}
+					continue
+				}
+				*found = true
+				if e.Inode != want {
+					c.report("directory %s: %q names inode %d, not %d", d.path, e.Name, e.Inode, want)
+					if err := c.writeEntry(d.inum, slot, DirEntry{Name: e.Name, Inode: want}); err != nil {
+						return err
+					}
+				}
+				c.refs[want]++
+			case strings.Contains(e.Name, "/"):
+				c.report("directory %s: entry %q has a bad name; removed", d.path, e.Name)
+				if err := c.writeEntry(d.inum, slot, DirEntry{}); err != nil {
+					return err
+				}
+			case e.Inode < 0 || e.Inode >= len(c.inodes) || c.inodes[e.Inode].Type == TypeFree:
+				c.report("directory %s: entry %q names free inode %d; removed", d.path, e.Name, e.Inode)
+				if err := c.writeEntry(d.inum, slot, DirEntry{}); err != nil {
+					return err
+				}
+			case c.inodes[e.Inode].Type == TypeDir && seen[e.Inode]:
+				c.report("directory %s: entry %q is a second link to directory inode %d; removed", d.path, e.Name, e.Inode)
+				if err := c.writeEntry(d.inum, slot, DirEntry{}); err != nil {
+					return err
+				}
+			default:
+				c.refs[e.Inode]++
+				if c.inodes[e.Inode].Type == TypeDir {
+					seen[e.Inode] = true
+					queue = append(queue, dir{e.Inode, d.inum, strings.TrimSuffix(d.path, "/") + "/" + e.Name})
+				}
+			}
+		}
+		for i, ok := range []bool{dot, dotdot} {
+			if ok {
+				continue
+			}
+			name, want := ".", d.inum
+			if i == 1 {
+				name, want = "..", d.parent
+			}
+			c.report("directory %s: no %q entry; added", d.path, name)
+			c.refs[want]++
+			if c.repair {
+				if err := c.f.addEntry(d.inum, name, want); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// entries reads directory inum through its checked block list.
+func (c *checker) entries(inum int) ([]DirEntry, error) {
+	buf := make([]byte, 0, len(c.data[inum])*BlockSize)
+	for _, b := range c.data[inum] {
+		data := make([]byte, BlockSize)
+		if b != 0 {
+			var err error
+			if data, err = readBlock(c.f.dev, b); err != nil {
+				return nil, err
+			}
+		}
+		buf = append(buf, data...)
+	}
+	return parseEntries(buf[:c.inodes[inum].Size]), nil
+}
+
+// checkLinks frees dangling inodes and fixes link counts.
+func (c *checker) checkLinks() error {
+	for inum, ino := range c.inodes {
+		if ino.Type == TypeFree {
+			continue
+		}
+		if c.refs[inum] == 0 {
+			c.report("inode %d: %s of %d bytes is in use but no directory names it (dangling); freed", inum, ino.Type, ino.Size)
+			if c.repair {
+				if err := c.f.release(inum, ino); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if ino.Links != c.refs[inum] {
+			c.report("inode %d: link count is %d, but %d entries name it", inum, ino.Links, c.refs[inum])
+			ino.Links = c.refs[inum]
+			if err := c.writeInode(inum, ino); err != nil {
+				return err
+			}
+		}
+		if ino.Type == TypeDir {
+			c.r.Dirs++
+		} else {
+			c.r.Files++
+		}
+		for _, b := range c.data[inum] {
+			if b != 0 {
+				c.r.Blocks++
+			}
+		}
+		if ino.Indirect != 0 {
+			c.r.Blocks++
+		}
+	}
+	return nil
+}
+
+// writeInode and writeEntry write a repair, only when repairing.
+func (c *checker) writeInode(inum int, ino Inode) error {
+	c.inodes[inum] = ino
+	if !c.repair {
+		return nil
+	}
+	return c.f.writeInode(inum, ino)
+}
+
+func (c *checker) writeEntry(dir, slot int, e DirEntry) error {
+	if !c.repair {
+		return nil
+	}
+	return c.f.writeEntry(dir, slot, e)
+}
@@ -0,0 +1,130 @@
+package fs
+
+// Block groups, after FFS's cylinder groups. With Groups > 1 the data
+// region is cut into that many stretches of equal size (the last takes
+// the remainder), each starting with its share of the inode table, whose
+// blocks stay marked in use in the data bitmap. Allocation then keeps
+// related things close:
+//
+//   - a file's inode goes in its directory's group;
+//   - a new directory's inode goes in a group with at least the average
+//     number of free inodes and the most free blocks, spreading
+//     directories out so each has room for its files;
+//   - a file's first block goes in its inode's group, and each next block
+//     as close after the one before as is free;
+//   - a large file moves on to the next group every chunkBlocks blocks
+//     past the direct ones, so one file can't fill a group its neighbours
+//     need.
+//
+// Without groups everything is first free, as in plain vsfs.
+
+// chunkBlocks is how many blocks of a large file go in one group.
+const chunkBlocks = 64
+
+func (sb Superblock) grouped() bool { return sb.Groups > 1 }
+
+// groupInodeBlocks is how many inode table blocks each group has.
+func (sb Superblock) groupInodeBlocks() int { return sb.InodeBlocks / sb.Groups }
+
+func (sb Superblock) inodesPerGroup() int { return sb.groupInodeBlocks() * inodesPerBlock }
+
+// groupStart is group g's first data block (a bitmap index); it runs to
+// groupStart(g+1).
+func (sb Superblock) groupStart(g int) int {
+	if g >= sb.Groups {
+		return sb.DataBlocks()
+	}
+	return g * (sb.DataBlocks() / sb.Groups)
+}
+
+// GroupOf returns the group device block b lies in, 0 without groups.
+func (sb Superblock) GroupOf(b int) int {
+	if !sb.grouped() || b < sb.DataStart {
+		return 0
+	}
+	return min((b-sb.DataStart)/(sb.DataBlocks()/sb.Groups), sb.Groups-1)
+}
+
+// InodeGroup returns the group inode inum lies in, 0 without groups.
+func (sb Superblock) InodeGroup(inum int) int {
+	if !sb.grouped() {
+		return 0
+	}
+	return inum / sb.inodesPerGroup()
+}
+
+// inodeBlock returns the inode table block holding inum and its offset there.
+func (sb Superblock) inodeBlock(inum int) (int, int) {
+	if !sb.grouped() {
+		return sb.InodeTable + inum/inodesPerBlock, inum % inodesPerBlock * InodeSize
+	}
+	g, i := inum/sb.inodesPerGroup(), inum%sb.inodesPerGroup()
+	return sb.DataStart + sb.groupStart(g) + i/inodesPerBlock, i % inodesPerBlock * InodeSize
+}
+
+// reserved reports whether data block i (a bitmap index) holds part of
+// the inode table.
+func (sb Superblock) reserved(i int) bool {
+	return sb.grouped() && i-sb.groupStart(sb.GroupOf(sb.DataStart+i)) < sb.groupInodeBlocks()
+}
+
+// inodeGoal is the inode number to look for a free inode of type t from,
+// for an entry in directory parent.
+func (f *FS) inodeGoal(t FileType, parent int) int {
+	sb := f.sb
+	if !sb.grouped() || !bit(f.ibmap, RootInode) { // the root is inode 0
+		return 0
+	}
+	if t != TypeDir {
+		return sb.InodeGroup(parent) * sb.inodesPerGroup()
+	}
+	free := make([]int, sb.Groups)
+	total := 0
+	for i := 0; i < sb.Inodes; i++ {
+		if !bit(f.ibmap, i) {
+			free[sb.InodeGroup(i)]++
+			total++
+		}
+	}
+	best, bestBlocks := sb.InodeGroup(parent), -1
+	for g := range free {
+		if free[g] == 0 || free[g]*sb.Groups < total {
+			continue
+		}
+		if n := f.freeBlocks(g); n > bestBlocks {
+			best, bestBlocks = g, n
+		}
+	}
+	return best * sb.inodesPerGroup()
+}
+
+// freeBlocks counts group g's free data blocks.
+func (f *FS) freeBlocks(g int) int {
+	n := 0
+	for i := f.sb.groupStart(g); i < f.sb.groupStart(g+1); i++ {
+		if !bit(f.dbmap, i) {
+			n++
+		}
+	}
+	return n
+}
+
+// blockGoal is the data block (a bitmap index) to look for a free block
+// from, for block n of inode inum; prev is the device block of the file's
+// block n-1, 0 if it has none.
+func (f *FS) blockGoal(inum, n, prev int) int {
+	sb := f.sb
+	switch {
+	case !sb.grouped():
+		return 0
+	case n >= direct && (n-direct)%chunkBlocks == 0:
+		g := sb.InodeGroup(inum)
+		if prev != 0 {
+			g = sb.GroupOf(prev)
+		}
+		return sb.groupStart((g + 1) % sb.Groups)
+	case prev != 0:
+		return prev + 1 - sb.DataStart
+	}
+	return sb.groupStart(sb.InodeGroup(inum))
+}
@@ -0,0 +1,314 @@
+package fs
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// FileType is an inode's type.
+type FileType uint16
+
+const (
+	TypeFree FileType = iota // an unused inode
+	TypeFile
+	TypeDir
+)
+
+func (t FileType) String() string {
+	switch t {
+	case TypeFree:
+		return "free"
+	case TypeFile:
+		return "file"
+	case TypeDir:
+		return "dir"
+	}
+	return fmt.Sprintf("FileType(%d)", int(t))
+}
+
+// Inode is an on-disk inode. Block pointers are device block numbers, 0
+// for none (block 0 is the superblock, never data).
+type Inode struct {
+	Type     FileType
+	Links    int // directory entries naming it (plus "." and the subdirectories' ".." for a directory)
+	Size     int
+	Direct   [direct]int
+	Indirect int // a block of further pointers
+}
+
+func (ino Inode) encode(b []byte) {
+	binary.LittleEndian.PutUint16(b[0:], uint16(ino.Type))
+	binary.LittleEndian.PutUint16(b[2:], uint16(ino.Links))
+	binary.LittleEndian.PutUint32(b[4:], uint32(ino.Size))
+	for i, p := range ino.Direct {
+		binary.LittleEndian.PutUint32(b[8+4*i:], uint32(p))
+	}
+	binary.LittleEndian.PutUint32(b[8+4*direct:], uint32(ino.Indirect))
+	clear(b[12+4*direct : InodeSize])
+}
+
+func decodeInode(b []byte) Inode {
+	ino := Inode{
+		Type:     FileType(binary.LittleEndian.Uint16(b[0:])),
+		Links:    int(binary.LittleEndian.Uint16(b[2:])),
+		Size:     int(binary.LittleEndian.Uint32(b[4:])),
+		Indirect: int(binary.LittleEndian.Uint32(b[8+4*direct:])),
+	}
+	for i := range ino.Direct {
+		ino.Direct[i] = int(binary.LittleEndian.Uint32(b[8+4*i:]))
+	}
+	return ino
+}
+
+// inodeBlock returns the inode table block holding inum and its offset there.
+func (f *FS) inodeBlock(inum int) (int, int) { return f.sb.inodeBlock(inum) }
+
+// Inode reads inode inum.
+func (f *FS) Inode(inum int) (Inode, error) {
+	if inum < 0 || inum >= f.sb.Inodes {
+		return Inode{}, fmt.Errorf("fs: inode %d is out of range", inum)
+	}
+	blk, off := f.inodeBlock(inum)
+	b, err := f.read(blk)
+	if err != nil {
+		return Inode{}, err
+	}
+	return decodeInode(b[off:]), nil
+}
+
+// writeInode writes inode inum, rewriting its inode table block.
+func (f *FS) writeInode(inum int, ino Inode) error {
+	blk, off := f.inodeBlock(inum)
+	b, err := f.read(blk)
+	if err != nil {
+		return err
+	}
+	ino.encode(b[off:])
+	return f.write(blk, b, true)
+}
+
+// bmap returns the device block holding block n of inode inum's file, 0
+// for a hole. With alloc set, a missing block (and the indirect block) is
+// allocated first, which updates ino.
+func (f *FS) bmap(inum int, ino *Inode, n int, alloc bool) (int, error) {
+	fn := n
+	goal := func() (int, error) {
+		prev := 0
+		if fn > 0 && f.sb.grouped() {
+			var err error
+			if prev, err = f.bmap(inum, ino, fn-1, false); err != nil {
+				return 0, err
+			}
+		}
+		return f.blockGoal(inum, fn, prev), nil
+	}
+	if n < direct {
+		if ino.Direct[n] == 0 && alloc {
+			g, err := goal()
+			if err != nil {
+				return 0, err
+			}
+			b, err := f.allocBlock(g)
+			if err != nil {
+				return 0, err
+			}
+			ino.Direct[n] = b
+		}
+		return ino.Direct[n], nil
+	}
+	n -= direct
+	if n >= ptrsPerBlock {
+		return 0, ErrTooBig
+	}
+	if ino.Indirect == 0 {
+		if !alloc {
+			return 0, nil
+		}
+		g, err := goal()
+		if err != nil {
+			return 0, err
+		}
+		b, err := f.allocBlock(g)
+		if err != nil {
+			return 0, err
+		}
+		ino.Indirect = b
+	}
+	ptrs, err := f.read(ino.Indirect)
+	if err != nil {
+		return 0, err
+	}
+	b := int(binary.LittleEndian.Uint32(ptrs[4*n:]))
+	if b == 0 && alloc {
+		g, err := goal()
+		if err != nil {
+			return 0, err
+		}
+		if b, err = f.allocBlock(g); err != nil {
+			return 0, err
+		}
+		binary.LittleEndian.PutUint32(ptrs[4*n:], uint32(b))
+		if err := f.write(ino.Indirect, ptrs, true); err != nil {
+			return 0, err
+		}
+	}
+	return b, nil
+}
+
+// readAt reads from inode inum at off, up to its size.
+func (f *FS) readAt(inum int, p []byte, off int) (int, error) {
+	ino, err := f.Inode(inum)
+	if err != nil {
+		return 0, err
+	}
+	if off >= ino.Size {
+		return 0, nil
+	}
+	p = p[:min(len(p), ino.Size-off)]
+	done := 0
+	for done < len(p) {
+		pos := off + done
+		blk, err := f.bmap(inum, &ino, pos/BlockSize, false)
+		if err != nil {
+			return done, err
+		}
+		n := min(len(p)-done, BlockSize-pos%BlockSize)
+		if blk == 0 {
+			clear(p[done : done+n]) // a hole
+		} else {
+			data, err := f.read(blk)
+			if err != nil {
+				return done, err
+			}
+			copy(p[done:done+n], data[pos%BlockSize:])
+		}
+		done += n
+	}
+	return done, nil
+}
+
+// writeAt writes p to inode inum at off, allocating blocks as needed and
+// growing the file.
+func (f *FS) writeAt(inum int, p []byte, off int) (int, error) {
+	if off+len(p) > MaxFileSize {
+		return 0, ErrTooBig
+	}
+	ino, err := f.Inode(inum)
+	if err != nil {
+		return 0, err
+	}
+	done := 0
+	for done < len(p) {
+		pos := off + done
+		blk, err := f.bmap(inum, &ino, pos/BlockSize, true)
+		if err != nil {
+			// Keep what was written, and the blocks allocated for it
+			ino.Size = max(ino.Size, pos)
+			if werr := f.writeInode(inum, ino); werr != nil {
+				return done, werr
+			}
+			return done, err
+		}
+		n := min(len(p)-done, BlockSize-pos%BlockSize)
+		data := make([]byte, BlockSize)
+		if n < BlockSize {
+			if data, err = f.read(blk); err != nil {
+				return done, err
+			}
+		}
+		copy(data[pos%BlockSize:], p[done:done+n])
+		if err := f.write(blk, data, ino.Type == TypeDir); err != nil {
+			return done, err
+		}
+		done += n
+	}
+	ino.Size = max(ino.Size, off+len(p))
+	return done, f.writeInode(inum, ino)
+}
+
+// truncate shrinks inode inum to size bytes, freeing the blocks past it
+// and zeroing the rest of the last one, so growing the file again reads
+// zeros there.
+func (f *FS) truncate(inum, size int) error {
+	ino, err := f.Inode(inum)
+	if err != nil {
+		return err
+	}
+	if size >= ino.Size {
+		return nil
+	}
+	keep := (size + BlockSize - 1) / BlockSize
+	for n := keep; n < (ino.Size+BlockSize-1)/BlockSize; n++ {
+		blk, err := f.bmap(inum, &ino, n, false)
+		if err != nil {
+			return err
+		}
+		if blk == 0 {
+			continue
+		}
+		if err := f.freeBlock(blk); err != nil {
+			return err
+		}
+		if n < direct {
+			ino.Direct[n] = 0
+		}
+	}
+	if ino.Indirect != 0 {
+		if keep <= direct {
+			if err := f.freeBlock(ino.Indirect); err != nil {
+				return err
+			}
+			ino.Indirect = 0
+		} else {
+			ptrs, err := f.read(ino.Indirect)
+			if err != nil {
+				return err
+			}
+			clear(ptrs[4*(keep-direct):])
+			if err := f.write(ino.Indirect, ptrs, true); err != nil {
+				return err
+			}
+		}
+	}
+	if size%BlockSize != 0 {
+		blk, err := f.bmap(inum, &ino, size/BlockSize, false)
+		if err != nil {
+			return err
+		}
+		if blk != 0 {
+			data, err := f.read(blk)
+			if err != nil {
+				return err
+			}
+			clear(data[size%BlockSize:])
+			if err := f.write(blk, data, ino.Type == TypeDir); err != nil {
+				return err
+			}
+		}
+	}
+	ino.Size = size
+	return f.writeInode(inum, ino)
+}
+
+// blocks lists the data blocks inode inum uses, the indirect block included.
+func (f *FS) blocks(ino Inode) ([]int, error) {
+	var out []int
+	for _, b := range ino.Direct {
+		if b != 0 {
+			out = append(out, b)
+		}
+	}
+	if ino.Indirect != 0 {
+		out = append(out, ino.Indirect)
+		ptrs, err := f.read(ino.Indirect)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < ptrsPerBlock; i++ {
+			if b := int(binary.LittleEndian.Uint32(ptrs[4*i:])); b != 0 {
+				out = append(out, b)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,216 @@
+package fs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// JournalMode is what a mounted file system logs to its journal before
+// writing it in place.
+type JournalMode int
+
+const (
+	NoJournal       JournalMode = iota // write everything in place at once
+	JournalMetadata                    // log metadata; file data goes in place first (ordered mode)
+	JournalAll                         // log metadata and file data alike
+)
+
+// JournalModes lists the modes, unjournaled first.
+var JournalModes = []JournalMode{NoJournal, JournalMetadata, JournalAll}
+
+func (m JournalMode) String() string {
+	switch m {
+	case NoJournal:
+		return "none"
+	case JournalMetadata:
+		return "journal-metadata"
+	case JournalAll:
+		return "journal-all"
+	}
+	return fmt.Sprintf("JournalMode(%d)", int(m))
+}
+
+// ParseJournalMode reads "none", "metadata" or "all", with or without the
+// "journal-" prefix.
+func ParseJournalMode(s string) (JournalMode, error) {
+	switch s {
+	case "none":
+		return NoJournal, nil
+	case "metadata", "journal-metadata":
+		return JournalMetadata, nil
+	case "all", "journal-all":
+		return JournalAll, nil
+	}
+	return 0, fmt.Errorf("fs: unknown journal mode %q (none, metadata, all)", s)
+}
+
+// The journal holds one transaction at a time, OSTEP style: a descriptor
+// block (txBegin, sequence number, block count, and each logged block's
+// home address), the logged blocks, then a commit block (txEnd, sequence
+// number, count, and a CRC of the descriptor and logged blocks). Once the
+// commit block is on disk the transaction is checkpointed, its blocks
+// written in place, and the descriptor zeroed to free the journal.
+const (
+	txBegin = 0x54784220 // "TxB "
+	txEnd   = 0x54784520 // "TxE "
+	maxTx   = (BlockSize - 12) / 4
+)
+
+// Mode is the journal mode the file system was mounted with.
+func (f *FS) Mode() JournalMode { return f.mode }
+
+// read reads block n, as the open transaction left it.
+func (f *FS) read(n int) ([]byte, error) {
+	if b, ok := f.tx[n]; ok {
+		return append([]byte(nil), b...), nil
+	}
+	return readBlock(f.dev, n)
+}
+
+// write writes block n, metadata if meta is set, else file data. In a
+// transaction metadata is logged for the commit, and so is data in
+// JournalAll mode; in JournalMetadata mode data goes straight in place,
+// ahead of the commit that makes it reachable.
+func (f *FS) write(n int, data []byte, meta bool) error {
+	_, logged := f.tx[n]
+	if f.tx == nil || !meta && !logged && f.mode != JournalAll {
+		return f.dev.WriteBlock(n, data)
+	}
+	if !logged {
+		f.order = append(f.order, n)
+	}
+	b := make([]byte, BlockSize)
+	copy(b, data)
+	f.tx[n] = b
+	return nil
+}
+
+// atomic runs op as one transaction when journaling. Whatever op changed
+// is committed, even when it fails part way (a write that ran out of
+// space keeps what it wrote).
+func (f *FS) atomic(op func() error) error {
+	if f.mode == NoJournal || f.tx != nil {
+		return op()
+	}
+	f.tx, f.freed = map[int][]byte{}, map[int]bool{}
+	err := op()
+	if cerr := f.commit(); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// commit writes the open transaction to the journal, then checkpoints it.
+// A transaction too big for the journal is dropped, and the cached
+// bitmaps reread.
+func (f *FS) commit() error {
+	tx, order := f.tx, f.order
+	f.tx, f.order, f.freed = nil, nil, nil
+	if len(order) == 0 {
+		return nil
+	}
+	if room := min(maxTx, f.sb.JournalSize-2); len(order) > room {
+		if err := f.loadBitmaps(); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %d blocks, room for %d", ErrTxTooBig, len(order), room)
+	}
+	f.seq++
+	j := f.sb.Journal
+	desc := make([]byte, BlockSize)
+	binary.LittleEndian.PutUint32(desc[0:], txBegin)
+	binary.LittleEndian.PutUint32(desc[4:], uint32(f.seq))
+	binary.LittleEndian.PutUint32(desc[8:], uint32(len(order)))
+	for i, n := range order {
+		binary.LittleEndian.PutUint32(desc[12+4*i:], uint32(n))
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(desc)
+	if err := f.dev.WriteBlock(j, desc); err != nil {
+		return err
+	}
+	for i, n := range order {
+		crc.Write(tx[n])
+		if err := f.dev.WriteBlock(j+1+i, tx[n]); err != nil {
+			return err
+		}
+	}
+	end := make([]byte, BlockSize)
+	binary.LittleEndian.PutUint32(end[0:], txEnd)
+	binary.LittleEndian.PutUint32(end[4:], uint32(f.seq))
+	binary.LittleEndian.PutUint32(end[8:], uint32(len(order)))
+	binary.LittleEndian.PutUint32(end[12:], crc.Sum32())
+	if err := f.dev.WriteBlock(j+1+len(order), end); err != nil {
+		return err
+	}
+	return checkpoint(f.dev, f.sb, order, tx)
+}
+
+// checkpoint writes a committed transaction's blocks in place and frees
+// the journal.
+func checkpoint(dev Device, sb Superblock, order []int, tx map[int][]byte) error {
+	for _, n := range order {
+		if err := dev.WriteBlock(n, tx[n]); err != nil {
+			return err
+		}
+	}
+	return dev.WriteBlock(sb.Journal, make([]byte, BlockSize))
+}
+
+// committed reads the transaction in dev's journal, if there is one and
+// its commit block made it to disk; a transaction without one never
+// happened.
+func committed(dev Device, sb Superblock) ([]int, map[int][]byte, error) {
+	if sb.JournalSize == 0 {
+		return nil, nil, nil
+	}
+	desc, err := readBlock(dev, sb.Journal)
+	if err != nil {
+		return nil, nil, err
+	}
+	count := int(binary.LittleEndian.Uint32(desc[8:]))
+	if binary.LittleEndian.Uint32(desc[0:]) != txBegin || count < 1 || count > min(maxTx, sb.JournalSize-2) {
+		return nil, nil, nil
+	}
+	end, err := readBlock(dev, sb.Journal+1+count)
+	if err != nil {
+		return nil, nil, err
+	}
+	if binary.LittleEndian.Uint32(end[0:]) != txEnd || binary.LittleEndian.Uint32(end[4:]) != binary.LittleEndian.Uint32(desc[4:]) ||
+		int(binary.LittleEndian.Uint32(end[8:])) != count {
+		return nil, nil, nil
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(desc)
+	order := make([]int, count)
+	tx := map[int][]byte{}
+	for i := range order {
+		b, err := readBlock(dev, sb.Journal+1+i)
+		if err != nil {
+			return nil, nil, err
+		}
+		crc.Write(b)
+		order[i] = int(binary.LittleEndian.Uint32(desc[12+4*i:]))
+		tx[order[i]] = b
+	}
+	if crc.Sum32() != binary.LittleEndian.Uint32(end[12:]) {
+		return nil, nil, nil
+	}
+	for _, n := range order {
+		if n < 1 || n >= sb.Blocks || n >= sb.Journal && n < sb.DataStart {
+			return nil, nil, nil
+		}
+	}
+	return order, tx, nil
+}
+
+// replay checkpoints the committed transaction in dev's journal, if any,
+// returning how many blocks it wrote in place.
+func replay(dev Device, sb Superblock) (int, error) {
+	order, tx, err := committed(dev, sb)
+	if err != nil || order == nil {
+		return 0, err
+	}
+	return len(order), checkpoint(dev, sb, order, tx)
+}
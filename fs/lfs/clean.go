@@ -0,0 +1,288 @@
+package lfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Policy picks the segments the cleaner cleans.
+type Policy int
+
+const (
+	Greedy      Policy = iota // the segment with the fewest live blocks
+	CostBenefit               // the best (1-u)*age/(1+u): old, mostly empty segments first
+)
+
+// Policies lists the policies.
+var Policies = []Policy{Greedy, CostBenefit}
+
+func (p Policy) String() string {
+	switch p {
+	case Greedy:
+		return "greedy"
+	case CostBenefit:
+		return "cost-benefit"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// ParsePolicy reads "greedy" or "cost-benefit" ("cb").
+func ParsePolicy(s string) (Policy, error) {
+	switch strings.ToLower(s) {
+	case "greedy":
+		return Greedy, nil
+	case "cost-benefit", "costbenefit", "cb":
+		return CostBenefit, nil
+	}
+	return 0, fmt.Errorf("lfs: unknown cleaning policy %q (greedy, cost-benefit)", s)
+}
+
+// Cleaner configures the segment cleaner: it starts when fewer than Low
+// segments are free and cleans until High are.
+type Cleaner struct {
+	Policy    Policy
+	Low, High int
+}
+
+// DefaultCleaner cleans by cost-benefit, from 4 free segments up to 8.
+var DefaultCleaner = Cleaner{Policy: CostBenefit, Low: 4, High: 8}
+
+// Stats counts the file system's log traffic.
+type Stats struct {
+	Written        int // blocks appended by file system operations
+	CleanerRead    int // blocks the cleaner read, summaries included
+	CleanerWritten int // live blocks it appended again
+	Cleaned        int // segments cleaned
+	CleanedLive    int // live blocks they held, summed
+	SegmentWrites  int
+	Checkpoints    int
+}
+
+// WriteCost is Rosenblum's write cost: blocks read and written per block
+// of new data, 1 with no cleaning.
+func (s Stats) WriteCost() float64 {
+	if s.Written == 0 {
+		return 0
+	}
+	return float64(s.Written+s.CleanerRead+s.CleanerWritten) / float64(s.Written)
+}
+
+// CleanedUtilization is the mean live fraction of the segments cleaned.
+func (s Stats) CleanedUtilization(segBlocks int) float64 {
+	if s.Cleaned == 0 {
+		return 0
+	}
+	return float64(s.CleanedLive) / float64(s.Cleaned*(segBlocks-1))
+}
+
+// Stats returns the traffic so far.
+func (f *FS) Stats() Stats { return f.stats }
+
+// Utilization is the live fraction of the log.
+func (f *FS) Utilization() float64 {
+	live := 0
+	for _, l := range f.live {
+		live += l
+	}
+	return float64(live) / float64(f.geo.Segments*(f.geo.SegBlocks-1))
+}
+
+// FreeSegments counts the segments free to fill.
+func (f *FS) FreeSegments() int {
+	n := 0
+	for _, free := range f.free {
+		if free {
+			n++
+		}
+	}
+	return n
+}
+
+// checkpointEvery is how many segment writes pass between checkpoints.
+const checkpointEvery = 8
+
+// maintain runs after every operation: it checkpoints every few segments,
+// and when free segments run low, checkpoints to free the emptied ones and
+// cleans if that wasn't enough.
+func (f *FS) maintain() error {
+	if f.clock-f.lastCP >= checkpointEvery {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+	if f.FreeSegments() >= f.cleaner.Low {
+		return nil
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if f.FreeSegments() >= f.cleaner.Low {
+		return nil
+	}
+	return f.Clean()
+}
+
+// Clean cleans victim segments until, counting the segments already empty,
+// Cleaner.High will be free, then checkpoints so they are.
+func (f *FS) Clean() error {
+	f.cleaning = true
+	defer func() { f.cleaning = false }()
+	cleaned := map[int]bool{}
+	empty := func() int {
+		n := 0
+		for s := range f.live {
+			if f.free[s] || s != f.seg && f.live[s] == 0 {
+				n++
+			}
+		}
+		return n
+	}
+	for empty() < f.cleaner.High {
+		v := f.victim(cleaned)
+		if v < 0 {
+			break
+		}
+		cleaned[v] = true
+		if err := f.cleanSegment(v); err != nil {
+			return err
+		}
+		// Cleaned segments are only free after a checkpoint; take one
+		// before the copying runs out of room
+		if f.FreeSegments() < 2 {
+			if err := f.Sync(); err != nil {
+				return err
+			}
+		}
+	}
+	return f.Sync()
+}
+
+// victim picks the next segment to clean by the policy, -1 if none would
+// gain anything.
+func (f *FS) victim(skip map[int]bool) int {
+	best, bestScore := -1, 0.0
+	capacity := f.geo.SegBlocks - 1
+	for s, live := range f.live {
+		if f.free[s] || s == f.seg || skip[s] || live == 0 || live >= capacity {
+			continue
+		}
+		u := float64(live) / float64(capacity)
+		var score float64
+		switch f.cleaner.Policy {
+		case Greedy:
+			score = 1 - u
+		case CostBenefit:
+			score = (1 - u) * float64(f.clock-f.when[s]+1) / (1 + u)
+		}
+		if best < 0 || score > bestScore {
+			best, bestScore = s, score
+		}
+	}
+	return best
+}
+
+// cleanSegment reads segment s and appends its live blocks to the log
+// again, leaving it empty.
+func (f *FS) cleanSegment(s int) error {
+	start := f.geo.segStart(s)
+	sum, err := readBlock(f.dev, start)
+	if err != nil {
+		return err
+	}
+	count := int(binary.LittleEndian.Uint32(sum[4:]))
+	if binary.LittleEndian.Uint32(sum) != sumMagic || count > f.geo.SegBlocks-1 {
+		return fmt.Errorf("lfs: segment %d has a bad summary", s)
+	}
+	f.stats.CleanerRead += 1 + count
+	f.stats.Cleaned++
+	f.stats.CleanedLive += f.live[s]
+	blocks := make([][]byte, count)
+	for i := range blocks {
+		if blocks[i], err = readBlock(f.dev, start+1+i); err != nil {
+			return err
+		}
+	}
+
+	// Gather each file's blocks, so its inode and indirect block are
+	// appended once
+	type move struct{ n, i int }
+	files := map[int][]move{}
+	var inodes, pieces []move
+	for i := range blocks {
+		e := entry{
+			inum: int(int32(binary.LittleEndian.Uint32(sum[12+8*i:]))),
+			n:    int(int32(binary.LittleEndian.Uint32(sum[16+8*i:]))),
+		}
+		switch {
+		case e.n == kindImap:
+			pieces = append(pieces, move{e.inum, i})
+		case e.inum < 0 || e.inum >= f.geo.Inodes || f.imap[e.inum] == 0:
+			// its file is gone
+		case e.n == kindInode:
+			inodes = append(inodes, move{e.inum, i})
+		default:
+			files[e.inum] = append(files[e.inum], move{e.n, i})
+		}
+	}
+	inums := make([]int, 0, len(files))
+	for inum := range files {
+		inums = append(inums, inum)
+	}
+	sort.Ints(inums)
+	for _, inum := range inums {
+		m, err := f.blockMap(inum)
+		if err != nil {
+			return err
+		}
+		changed := false
+		for _, mv := range files[inum] {
+			addr := start + 1 + mv.i
+			if mv.n == kindIndirect {
+				if m.ino.Indirect == addr {
+					// save appends it anew
+					if err := m.indirect(); err != nil {
+						return err
+					}
+					m.dirty, changed = true, true
+				}
+				continue
+			}
+			if cur, err := m.get(mv.n); err != nil || cur != addr {
+				continue
+			}
+			moved, err := f.append(blocks[mv.i], entry{inum, mv.n})
+			if err != nil {
+				return err
+			}
+			if err := m.set(mv.n, moved); err != nil {
+				return err
+			}
+			changed = true
+		}
+		if changed {
+			if err := m.save(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, mv := range inodes {
+		if inum := mv.n; f.imap[inum] == start+1+mv.i {
+			if err := f.putInode(inum, decodeInode(blocks[mv.i])); err != nil {
+				return err
+			}
+		}
+	}
+	for _, mv := range pieces {
+		if p := mv.n; p >= 0 && p < len(f.pieces) && f.pieces[p] == start+1+mv.i {
+			if err := f.writePiece(p); err != nil {
+				return err
+			}
+		}
+	}
+	if f.live[s] != 0 {
+		return fmt.Errorf("lfs: segment %d still has %d live blocks after cleaning", s, f.live[s])
+	}
+	return nil
+}
@@ -0,0 +1,678 @@
+package lfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"example.com/operating-systems/fs"
+)
+
+func encodeInode(ino fs.Inode) []byte {
+	b := make([]byte, BlockSize)
+	binary.LittleEndian.PutUint16(b[0:], uint16(ino.Type))
+	binary.LittleEndian.PutUint16(b[2:], uint16(ino.Links))
+	binary.LittleEndian.PutUint32(b[4:], uint32(ino.Size))
+	for i, p := range ino.Direct {
+		binary.LittleEndian.PutUint32(b[8+4*i:], uint32(p))
+	}
+	binary.LittleEndian.PutUint32(b[8+4*direct:], uint32(ino.Indirect))
+	return b
+}
+
+func decodeInode(b []byte) fs.Inode {
+	ino := fs.Inode{
+		Type:     fs.FileType(binary.LittleEndian.Uint16(b[0:])),
+		Links:    int(binary.LittleEndian.Uint16(b[2:])),
+		Size:     int(binary.LittleEndian.Uint32(b[4:])),
+		Indirect: int(binary.LittleEndian.Uint32(b[8+4*direct:])),
+	}
+	for i := range ino.Direct {
+		ino.Direct[i] = int(binary.LittleEndian.Uint32(b[8+4*i:]))
+	}
+	return ino
+}
+
+// Inode reads inode inum's newest copy.
+func (f *FS) Inode(inum int) (fs.Inode, error) {
+	if inum < 0 || inum >= f.geo.Inodes || f.imap[inum] == 0 {
+		return fs.Inode{}, fmt.Errorf("lfs: inode %d is not in use", inum)
+	}
+	b, err := f.read(f.imap[inum])
+	if err != nil {
+		return fs.Inode{}, err
+	}
+	return decodeInode(b), nil
+}
+
+// putInode appends a new copy of inode inum and points the inode map at it.
+func (f *FS) putInode(inum int, ino fs.Inode) error {
+	addr, err := f.append(encodeInode(ino), entry{inum, kindInode})
+	if err != nil {
+		return err
+	}
+	f.kill(f.imap[inum])
+	f.imap[inum] = addr
+	f.dirty[inum/perPiece] = true
+	return nil
+}
+
+// allocInode takes the first free inode number for an empty inode of type t.
+func (f *FS) allocInode(t fs.FileType) (int, error) {
+	for i, addr := range f.imap {
+		if addr == 0 {
+			return i, f.putInode(i, fs.Inode{Type: t})
+		}
+	}
+	return 0, fs.ErrNoInodes
+}
+
+// release frees inode inum and its blocks.
+func (f *FS) release(inum int) error {
+	m, err := f.blockMap(inum)
+	if err != nil {
+		return err
+	}
+	for n := 0; n < (m.ino.Size+BlockSize-1)/BlockSize; n++ {
+		if err := m.set(n, 0); err != nil {
+			return err
+		}
+	}
+	f.kill(m.ino.Indirect)
+	f.kill(f.imap[inum])
+	f.imap[inum] = 0
+	f.dirty[inum/perPiece] = true
+	return nil
+}
+
+// blockMap edits one file's block pointers, the indirect block included;
+// save appends whatever changed.
+type blockMap struct {
+	f     *FS
+	inum  int
+	ino   fs.Inode
+	ptrs  []byte // the indirect block, read when first needed
+	dirty bool   // ptrs changed
+}
+
+func (f *FS) blockMap(inum int) (*blockMap, error) {
+	ino, err := f.Inode(inum)
+	if err != nil {
+		return nil, err
+	}
+	return &blockMap{f: f, inum: inum, ino: ino}, nil
+}
+
+func (m *blockMap) indirect() error {
+	if m.ptrs != nil {
+		return nil
+	}
+	if m.ino.Indirect == 0 {
+		m.ptrs = make([]byte, BlockSize)
+		return nil
+	}
+	var err error
+	m.ptrs, err = m.f.read(m.ino.Indirect)
+	return err
+}
+
+// get returns the address of file block n, 0 for a hole.
+func (m *blockMap) get(n int) (int, error) {
+	if n < direct {
+		return m.ino.Direct[n], nil
+	}
+	if n-direct >= ptrsPerBlock {
+		return 0, fs.ErrTooBig
+	}
+	if m.ptrs == nil && m.ino.Indirect == 0 {
+		return 0, nil
+	}
+	if err := m.indirect(); err != nil {
+		return 0, err
+	}
+	return int(binary.LittleEndian.Uint32(m.ptrs[4*(n-direct):])), nil
+}
+
+// set points file block n at addr, killing the block it replaces.
+func (m *blockMap) set(n, addr int) error {
+	old, err := m.get(n)
+	if err != nil {
+		return err
+	}
+	m.f.kill(old)
+	if n < direct {
+		m.ino.Direct[n] = addr
+		return nil
+	}
+	if err := m.indirect(); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(m.ptrs[4*(n-direct):], uint32(addr))
+	m.dirty = true
+	return nil
+}
+
+// save appends the changed indirect block, dropping it once empty, and
+// the inode.
+func (m *blockMap) save() error {
+	if m.dirty {
+		f := m.f
+		f.kill(m.ino.Indirect)
+		m.ino.Indirect = 0
+		if !bytes.Equal(m.ptrs, make([]byte, BlockSize)) {
+			addr, err := f.append(m.ptrs, entry{m.inum, kindIndirect})
+			if err != nil {
+				return err
+			}
+			m.ino.Indirect = addr
+		}
+		m.dirty = false
+	}
+	return m.f.putInode(m.inum, m.ino)
+}
+
+// readAt reads from inode inum at off, up to its size.
+func (f *FS) readAt(inum int, p []byte, off int) (int, error) {
+	m, err := f.blockMap(inum)
+	if err != nil {
+		return 0, err
+	}
+	if off >= m.ino.Size {
+		return 0, nil
+	}
+	p = p[:min(len(p), m.ino.Size-off)]
+	done := 0
+	for done < len(p) {
+		pos := off + done
+		addr, err := m.get(pos / BlockSize)
+		if err != nil {
+			return done, err
+		}
+		n := min(len(p)-done, BlockSize-pos%BlockSize)
+		if addr == 0 {
+			clear(p[done : done+n])
+		} else {
+			data, err := f.read(addr)
+			if err != nil {
+				return done, err
+			}
+			copy(p[done:done+n], data[pos%BlockSize:])
+		}
+		done += n
+	}
+	return done, nil
+}
+
+// writeAt writes p to inode inum at off: every block it touches is
+// appended anew.
+func (f *FS) writeAt(inum int, p []byte, off int) (int, error) {
+	if off+len(p) > MaxFileSize {
+		return 0, fs.ErrTooBig
+	}
+	m, err := f.blockMap(inum)
+	if err != nil {
+		return 0, err
+	}
+	done := 0
+	for done < len(p) {
+		pos := off + done
+		old, err := m.get(pos / BlockSize)
+		if err != nil {
+			return done, err
+		}
+		n := min(len(p)-done, BlockSize-pos%BlockSize)
+		data := make([]byte, BlockSize)
+		if n < BlockSize && old != 0 {
+			if data, err = f.read(old); err != nil {
+				return done, err
+			}
+		}
+		copy(data[pos%BlockSize:], p[done:done+n])
+		addr, err := f.append(data, entry{inum, pos / BlockSize})
+		if err == nil {
+			err = m.set(pos/BlockSize, addr)
+		}
+		if err != nil {
+			// Keep what was written
+			m.ino.Size = max(m.ino.Size, pos)
+			if serr := m.save(); serr != nil {
+				return done, serr
+			}
+			return done, err
+		}
+		done += n
+	}
+	m.ino.Size = max(m.ino.Size, off+len(p))
+	return done, m.save()
+}
+
+// truncate shrinks inode inum to size bytes.
+func (f *FS) truncate(inum, size int) error {
+	m, err := f.blockMap(inum)
+	if err != nil {
+		return err
+	}
+	if size >= m.ino.Size {
+		return nil
+	}
+	for n := (size + BlockSize - 1) / BlockSize; n < (m.ino.Size+BlockSize-1)/BlockSize; n++ {
+		if err := m.set(n, 0); err != nil {
+			return err
+		}
+	}
+	if size%BlockSize != 0 {
+		old, err := m.get(size / BlockSize)
+		if err != nil {
+			return err
+		}
+		if old != 0 {
+			data, err := f.read(old)
+			if err != nil {
+				return err
+			}
+			clear(data[size%BlockSize:])
+			addr, err := f.append(data, entry{inum, size / BlockSize})
+			if err != nil {
+				return err
+			}
+			if err := m.set(size/BlockSize, addr); err != nil {
+				return err
+			}
+		}
+	}
+	m.ino.Size = size
+	return m.save()
+}
+
+// Directories are files of 32-byte entries, as in package fs.
+const dirEntrySize = 32
+
+func (f *FS) entries(dir int) ([]fs.DirEntry, error) {
+	ino, err := f.Inode(dir)
+	if err != nil {
+		return nil, err
+	}
+	if ino.Type != fs.TypeDir {
+		return nil, fs.ErrNotDir
+	}
+	buf := make([]byte, ino.Size)
+	if _, err := f.readAt(dir, buf, 0); err != nil {
+		return nil, err
+	}
+	out := make([]fs.DirEntry, len(buf)/dirEntrySize)
+	for i := range out {
+		e := buf[i*dirEntrySize:]
+		name, _, _ := bytes.Cut(e[4:dirEntrySize], []byte{0})
+		out[i] = fs.DirEntry{Name: string(name), Inode: int(binary.LittleEndian.Uint32(e))}
+	}
+	return out, nil
+}
+
+func (f *FS) writeEntry(dir, i int, e fs.DirEntry) error {
+	b := make([]byte, dirEntrySize)
+	binary.LittleEndian.PutUint32(b, uint32(e.Inode))
+	copy(b[4:], e.Name)
+	_, err := f.writeAt(dir, b, i*dirEntrySize)
+	return err
+}
+
+func (f *FS) lookup(dir int, name string) (int, int, error) {
+	ents, err := f.entries(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i, e := range ents {
+		if e.Name != "" && e.Name == name {
+			return e.Inode, i, nil
+		}
+	}
+	return 0, 0, fs.ErrNotFound
+}
+
+func (f *FS) addEntry(dir int, name string, inum int) error {
+	ents, err := f.entries(dir)
+	if err != nil {
+		return err
+	}
+	slot := len(ents)
+	for i, e := range ents {
+		if e.Name == "" {
+			slot = i
+			break
+		}
+	}
+	return f.writeEntry(dir, slot, fs.DirEntry{Name: name, Inode: inum})
+}
+
+func (f *FS) initDir(dir, parent int) error {
+	b := make([]byte, 2*dirEntrySize)
+	binary.LittleEndian.PutUint32(b, uint32(dir))
+	copy(b[4:], ".")
+	binary.LittleEndian.PutUint32(b[dirEntrySize:], uint32(parent))
+	copy(b[dirEntrySize+4:], "..")
+	if _, err := f.writeAt(dir, b, 0); err != nil {
+		return err
+	}
+	return f.setLinks(dir, 2)
+}
+
+func (f *FS) setLinks(inum, links int) error {
+	ino, err := f.Inode(inum)
+	if err != nil {
+		return err
+	}
+	ino.Links = links
+	return f.putInode(inum, ino)
+}
+
+func (f *FS) resolve(path string) (int, error) {
+	if !strings.HasPrefix(path, "/") {
+		return 0, fs.ErrBadPath
+	}
+	inum := RootInode
+	for _, n := range strings.Split(path, "/") {
+		if n == "" {
+			continue
+		}
+		var err error
+		if inum, _, err = f.lookup(inum, n); err != nil {
+			return 0, err
+		}
+	}
+	return inum, nil
+}
+
+// parent resolves all but the last name of path, returning it and the name.
+func (f *FS) parent(path string) (int, string, error) {
+	path = strings.TrimRight(path, "/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 || i == len(path)-1 {
+		return 0, "", fs.ErrBadPath
+	}
+	name := path[i+1:]
+	if len(name) > fs.MaxNameLen {
+		return 0, "", fs.ErrNameTooLong
+	}
+	dir, err := f.resolve(path[:i+1])
+	return dir, name, err
+}
+
+func (f *FS) create(path string, t fs.FileType) (int, int, error) {
+	dir, name, err := f.parent(path)
+	if err != nil {
+		if strings.Trim(path, "/") == "" {
+			err = fs.ErrExists
+		}
+		return 0, 0, err
+	}
+	if _, _, err := f.lookup(dir, name); err == nil {
+		return 0, 0, fs.ErrExists
+	} else if err != fs.ErrNotFound {
+		return 0, 0, err
+	}
+	inum, err := f.allocInode(t)
+	if err != nil {
+		return 0, 0, err
+	}
+	return dir, inum, f.addEntry(dir, name, inum)
+}
+
+// op runs a file system operation, then lets the cleaner keep up.
+func (f *FS) op(fn func() error) error {
+	if err := fn(); err != nil {
+		return err
+	}
+	return f.maintain()
+}
+
+// Create makes an empty file.
+func (f *FS) Create(path string) error {
+	return f.op(func() error {
+		_, inum, err := f.create(path, fs.TypeFile)
+		if err != nil {
+			return err
+		}
+		return f.setLinks(inum, 1)
+	})
+}
+
+// Mkdir makes an empty directory.
+func (f *FS) Mkdir(path string) error {
+	return f.op(func() error {
+		dir, inum, err := f.create(path, fs.TypeDir)
+		if err != nil {
+			return err
+		}
+		if err := f.initDir(inum, dir); err != nil {
+			return err
+		}
+		p, err := f.Inode(dir)
+		if err != nil {
+			return err
+		}
+		return f.setLinks(dir, p.Links+1)
+	})
+}
+
+// Link gives the file at old a second name, new.
+func (f *FS) Link(old, new string) error {
+	return f.op(func() error {
+		inum, err := f.resolve(old)
+		if err != nil {
+			return err
+		}
+		ino, err := f.Inode(inum)
+		if err != nil {
+			return err
+		}
+		if ino.Type == fs.TypeDir {
+			return fs.ErrIsDir
+		}
+		dir, name, err := f.parent(new)
+		if err != nil {
+			return err
+		}
+		if _, _, err := f.lookup(dir, name); err == nil {
+			return fs.ErrExists
+		}
+		if err := f.addEntry(dir, name, inum); err != nil {
+			return err
+		}
+		return f.setLinks(inum, ino.Links+1)
+	})
+}
+
+// Unlink removes a file's name, and the file with its last name.
+func (f *FS) Unlink(path string) error {
+	return f.op(func() error {
+		dir, name, err := f.parent(path)
+		if err != nil {
+			return err
+		}
+		inum, slot, err := f.lookup(dir, name)
+		if err != nil {
+			return err
+		}
+		ino, err := f.Inode(inum)
+		if err != nil {
+			return err
+		}
+		if ino.Type == fs.TypeDir {
+			return fs.ErrIsDir
+		}
+		if err := f.writeEntry(dir, slot, fs.DirEntry{}); err != nil {
+			return err
+		}
+		if ino.Links > 1 {
+			return f.setLinks(inum, ino.Links-1)
+		}
+		return f.release(inum)
+	})
+}
+
+// Rmdir removes an empty directory.
+func (f *FS) Rmdir(path string) error {
+	return f.op(func() error {
+		dir, name, err := f.parent(path)
+		if err != nil {
+			return err
+		}
+		if name == "." || name == ".." {
+			return fs.ErrBadPath
+		}
+		inum, slot, err := f.lookup(dir, name)
+		if err != nil {
+			return err
+		}
+		ents, err := f.entries(inum)
+		if err != nil {
+			return err
+		}
+		for _, e := range ents {
+			if e.Name != "" && e.Name != "." && e.Name != ".." {
+				return fs.ErrNotEmpty
+			}
+		}
+		if err := f.writeEntry(dir, slot, fs.DirEntry{}); err != nil {
+			return err
+		}
+		p, err := f.Inode(dir)
+		if err != nil {
+			return err
+		}
+		if err := f.setLinks(dir, p.Links-1); err != nil {
+			return err
+		}
+		return f.release(inum)
+	})
+}
+
+// file resolves path to a regular file.
+func (f *FS) file(path string) (int, error) {
+	inum, err := f.resolve(path)
+	if err != nil {
+		return 0, err
+	}
+	ino, err := f.Inode(inum)
+	if err != nil {
+		return 0, err
+	}
+	if ino.Type == fs.TypeDir {
+		return 0, fs.ErrIsDir
+	}
+	return inum, nil
+}
+
+// ReadAt reads the file at path from offset off, up to its end.
+func (f *FS) ReadAt(path string, p []byte, off int) (int, error) {
+	inum, err := f.file(path)
+	if err != nil {
+		return 0, err
+	}
+	return f.readAt(inum, p, off)
+}
+
+// WriteAt writes p to the file at path at offset off.
+func (f *FS) WriteAt(path string, p []byte, off int) (int, error) {
+	var n int
+	err := f.op(func() error {
+		inum, err := f.file(path)
+		if err != nil {
+			return err
+		}
+		n, err = f.writeAt(inum, p, off)
+		return err
+	})
+	return n, err
+}
+
+// ReadFile returns the whole file at path.
+func (f *FS) ReadFile(path string) ([]byte, error) {
+	inum, err := f.file(path)
+	if err != nil {
+		return nil, err
+	}
+	ino, err := f.Inode(inum)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, ino.Size)
+	n, err := f.readAt(inum, buf, 0)
+	return buf[:n], err
+}
+
+// WriteFile replaces the contents of the file at path, creating it if
+// needed.
+func (f *FS) WriteFile(path string, data []byte) error {
+	return f.op(func() error {
+		inum, err := f.file(path)
+		if err == fs.ErrNotFound {
+			if _, inum, err = f.create(path, fs.TypeFile); err == nil {
+				err = f.setLinks(inum, 1)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if err := f.truncate(inum, 0); err != nil {
+			return err
+		}
+		_, err = f.writeAt(inum, data, 0)
+		return err
+	})
+}
+
+// Truncate shrinks the file at path to size bytes.
+func (f *FS) Truncate(path string, size int) error {
+	return f.op(func() error {
+		inum, err := f.file(path)
+		if err != nil {
+			return err
+		}
+		return f.truncate(inum, size)
+	})
+}
+
+// ReadDir lists the directory at path, "." and ".." included.
+func (f *FS) ReadDir(path string) ([]fs.DirEntry, error) {
+	inum, err := f.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	ents, err := f.entries(inum)
+	if err != nil {
+		return nil, err
+	}
+	var out []fs.DirEntry
+	for _, e := range ents {
+		if e.Name != "" {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// Stat looks up path.
+func (f *FS) Stat(path string) (fs.Stat, error) {
+	inum, err := f.resolve(path)
+	if err != nil {
+		return fs.Stat{}, err
+	}
+	m, err := f.blockMap(inum)
+	if err != nil {
+		return fs.Stat{}, err
+	}
+	st := fs.Stat{Inode: inum, Type: m.ino.Type, Links: m.ino.Links, Size: m.ino.Size}
+	for n := 0; n < (m.ino.Size+BlockSize-1)/BlockSize; n++ {
+		if addr, err := m.get(n); err != nil {
+			return fs.Stat{}, err
+		} else if addr != 0 {
+			st.Blocks++
+		}
+	}
+	if m.ino.Indirect != 0 {
+		st.Blocks++
+	}
+	return st, nil
+}
@@ -0,0 +1,362 @@
+// Package lfs is a log-structured file system in the style of OSTEP's LFS
+// chapter (Rosenblum and Ousterhout), on the block devices of package fs,
+// with the same directory format and operations as fs's vsfs layout.
+//
+// Blocks 0 and 1 are two checkpoint regions, written alternately; the rest
+// of the device is segments. Nothing is written in place: new data blocks,
+// indirect blocks, inodes (one per block) and pieces of the inode map are
+// appended to the segment being filled, and a full segment goes to disk in
+// one sequential write, its first block a summary naming each block's
+// owner. The inode map, which says where each inode's newest copy is, is
+// kept in memory; a checkpoint appends its changed pieces and then writes
+// a checkpoint region pointing to every piece, with each segment's live
+// block count. Mount reads the newer checkpoint region, so what was written
+// after the last checkpoint (Sync) is lost in a crash.
+//
+// Overwritten blocks leave dead space behind. When free segments fall
+// below Cleaner.Low, the cleaner picks victim segments (greedy: the
+// emptiest; cost-benefit: the best (1-u)*age/(1+u), u the live fraction),
+// reads them, appends their live blocks to the log again, and after the
+// next checkpoint reuses them, until Cleaner.High segments are free.
+package lfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"example.com/operating-systems/fs"
+)
+
+// BlockSize is fs's block size.
+const BlockSize = fs.BlockSize
+
+var ErrBadFS = errors.New("lfs: not a file system (no valid checkpoint region)")
+
+const (
+	magic        = 0x6c667331 // "lfs1"
+	sumMagic     = 0x6c667353 // "lfsS"
+	direct       = 12
+	ptrsPerBlock = BlockSize / 4
+	perPiece     = BlockSize / 4 // inode addresses per inode map piece
+	// MaxFileSize is what the direct blocks and one indirect block reach.
+	MaxFileSize = (direct + ptrsPerBlock) * BlockSize
+	// MaxSegBlocks is the most blocks one summary block describes, plus it.
+	MaxSegBlocks = (BlockSize-12)/8 + 1
+	// RootInode is the root directory's inode number.
+	RootInode = 0
+)
+
+// A summary entry's n is the file block number, or one of these.
+const (
+	kindInode    = -1
+	kindIndirect = -2
+	kindImap     = -3 // inum is the piece number
+)
+
+// entry is a summary entry: whose block it is.
+type entry struct{ inum, n int }
+
+// Geometry is the file system's layout.
+type Geometry struct {
+	Blocks    int // device blocks used
+	SegBlocks int // blocks per segment, the summary block included
+	Segments  int
+	Inodes    int
+}
+
+func (g Geometry) segStart(s int) int { return 2 + s*g.SegBlocks }
+func (g Geometry) segOf(addr int) int { return (addr - 2) / g.SegBlocks }
+func (g Geometry) pieces() int        { return (g.Inodes + perPiece - 1) / perPiece }
+
+// geometry plans a file system; the checkpoint region must fit a block.
+func geometry(blocks, segBlocks, inodes int) (Geometry, error) {
+	g := Geometry{Blocks: blocks, SegBlocks: segBlocks, Inodes: inodes}
+	if segBlocks < 2 || segBlocks > MaxSegBlocks {
+		return g, fmt.Errorf("lfs: segments must be 2 to %d blocks, got %d", MaxSegBlocks, segBlocks)
+	}
+	g.Segments = (blocks - 2) / segBlocks
+	switch {
+	case g.Segments < 4:
+		return g, fmt.Errorf("lfs: %d blocks make %d segments of %d; need at least 4", blocks, g.Segments, segBlocks)
+	case inodes < 1:
+		return g, fmt.Errorf("lfs: need at least 1 inode, got %d", inodes)
+	case 24+4*g.pieces()+8*g.Segments > BlockSize:
+		return g, fmt.Errorf("lfs: %d segments and %d inodes don't fit the checkpoint region", g.Segments, inodes)
+	}
+	return g, nil
+}
+
+// FS is a mounted log-structured file system.
+type FS struct {
+	dev      fs.Device
+	geo      Geometry
+	cleaner  Cleaner
+	imap     []int  // inode -> block address of its newest copy, 0 if free
+	pieces   []int  // inode map piece -> its block address
+	dirty    []bool // pieces changed since the last checkpoint
+	live     []int  // per segment, blocks still in use
+	when     []int  // per segment, the clock when it was last written
+	free     []bool // segments free to fill: empty as of the last checkpoint
+	seg      int    // the segment being filled
+	sum      []entry
+	pend     [][]byte // its blocks not yet written, the last len(pend) of sum
+	clock    int      // segment writes so far, the cleaner's sense of age
+	seq      int      // checkpoints written
+	lastCP   int      // clock at the last checkpoint
+	cleaning bool
+	stats    Stats
+}
+
+// Mkfs writes an empty log-structured file system of blocks blocks, in
+// segments of segBlocks blocks, with room for inodes files and directories.
+func Mkfs(dev fs.Device, blocks, segBlocks, inodes int) error {
+	g, err := geometry(blocks, segBlocks, inodes)
+	if err != nil {
+		return err
+	}
+	f := newFS(dev, g, DefaultCleaner)
+	for s := range f.free {
+		f.free[s] = true
+	}
+	if err := f.writeCR(); err != nil { // the first checkpoint region ...
+		return err
+	}
+	if err := f.advance(); err != nil {
+		return err
+	}
+	root, err := f.allocInode(fs.TypeDir)
+	if err != nil {
+		return err
+	}
+	if err := f.initDir(root, root); err != nil {
+		return err
+	}
+	return f.Sync() // ... and the second, with the root in it
+}
+
+func newFS(dev fs.Device, g Geometry, c Cleaner) *FS {
+	return &FS{
+		dev: dev, geo: g, cleaner: c,
+		imap:   make([]int, g.Inodes),
+		pieces: make([]int, g.pieces()),
+		dirty:  make([]bool, g.pieces()),
+		live:   make([]int, g.Segments),
+		when:   make([]int, g.Segments),
+		free:   make([]bool, g.Segments),
+		seg:    g.Segments - 1,
+	}
+}
+
+// Mount reads the newer checkpoint region and the inode map of the file
+// system on dev, to be cleaned as c says.
+func Mount(dev fs.Device, c Cleaner) (*FS, error) {
+	var best []byte
+	bestSeq := -1
+	for cr := 0; cr < 2; cr++ {
+		b, err := readBlock(dev, cr)
+		if err != nil {
+			return nil, err
+		}
+		if binary.LittleEndian.Uint32(b) == magic && int(binary.LittleEndian.Uint32(b[4:])) > bestSeq {
+			best, bestSeq = b, int(binary.LittleEndian.Uint32(b[4:]))
+		}
+	}
+	if best == nil {
+		return nil, ErrBadFS
+	}
+	u := func(i int) int { return int(binary.LittleEndian.Uint32(best[4*i:])) }
+	g, err := geometry(u(2), u(3), u(4))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadFS, err)
+	}
+	f := newFS(dev, g, c)
+	f.seq, f.clock = bestSeq, u(5)
+	f.lastCP = f.clock
+	for p := range f.pieces {
+		f.pieces[p] = u(6 + p)
+		if f.pieces[p] == 0 {
+			continue
+		}
+		b, err := readBlock(dev, f.pieces[p])
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perPiece && p*perPiece+i < g.Inodes; i++ {
+			f.imap[p*perPiece+i] = int(binary.LittleEndian.Uint32(b[4*i:]))
+		}
+	}
+	for s := range f.live {
+		f.live[s] = u(6 + len(f.pieces) + 2*s)
+		f.when[s] = u(6 + len(f.pieces) + 2*s + 1)
+		f.free[s] = f.live[s] == 0
+	}
+	if err := f.advance(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Geometry returns the file system's layout.
+func (f *FS) Geometry() Geometry { return f.geo }
+
+// Sync checkpoints: it appends the changed inode map pieces, writes out
+// the segment being filled, and writes a checkpoint region. Segments
+// emptied since the last checkpoint become free.
+func (f *FS) Sync() error {
+	for p, d := range f.dirty {
+		if d {
+			if err := f.writePiece(p); err != nil {
+				return err
+			}
+		}
+	}
+	if err := f.flush(); err != nil {
+		return err
+	}
+	if err := f.writeCR(); err != nil {
+		return err
+	}
+	for s := range f.free {
+		if s != f.seg && f.live[s] == 0 {
+			f.free[s] = true
+		}
+	}
+	f.lastCP = f.clock
+	f.stats.Checkpoints++
+	return nil
+}
+
+// writeCR writes the next checkpoint region.
+func (f *FS) writeCR() error {
+	f.seq++
+	b := make([]byte, BlockSize)
+	put := func(i, v int) { binary.LittleEndian.PutUint32(b[4*i:], uint32(v)) }
+	for i, v := range []int{magic, f.seq, f.geo.Blocks, f.geo.SegBlocks, f.geo.Inodes, f.clock} {
+		put(i, v)
+	}
+	for p, addr := range f.pieces {
+		put(6+p, addr)
+	}
+	for s := range f.live {
+		put(6+len(f.pieces)+2*s, f.live[s])
+		put(6+len(f.pieces)+2*s+1, f.when[s])
+	}
+	return f.dev.WriteBlock(f.seq%2, b)
+}
+
+// writePiece appends inode map piece p.
+func (f *FS) writePiece(p int) error {
+	b := make([]byte, BlockSize)
+	for i := 0; i < perPiece && p*perPiece+i < f.geo.Inodes; i++ {
+		binary.LittleEndian.PutUint32(b[4*i:], uint32(f.imap[p*perPiece+i]))
+	}
+	addr, err := f.append(b, entry{p, kindImap})
+	if err != nil {
+		return err
+	}
+	f.kill(f.pieces[p])
+	f.pieces[p], f.dirty[p] = addr, false
+	return nil
+}
+
+// append adds a block to the log, returning its address.
+func (f *FS) append(data []byte, e entry) (int, error) {
+	if len(f.sum) == f.geo.SegBlocks-1 {
+		if err := f.flush(); err != nil {
+			return 0, err
+		}
+		if err := f.advance(); err != nil {
+			return 0, err
+		}
+	}
+	addr := f.geo.segStart(f.seg) + 1 + len(f.sum)
+	b := make([]byte, BlockSize)
+	copy(b, data)
+	f.sum = append(f.sum, e)
+	f.pend = append(f.pend, b)
+	f.live[f.seg]++
+	if f.cleaning {
+		f.stats.CleanerWritten++
+	} else {
+		f.stats.Written++
+	}
+	return addr, nil
+}
+
+// flush writes the summary and the pending blocks of the segment being
+// filled, in one pass.
+func (f *FS) flush() error {
+	if len(f.pend) == 0 {
+		return nil
+	}
+	start := f.geo.segStart(f.seg)
+	sum := make([]byte, BlockSize)
+	binary.LittleEndian.PutUint32(sum[0:], sumMagic)
+	binary.LittleEndian.PutUint32(sum[4:], uint32(len(f.sum)))
+	binary.LittleEndian.PutUint32(sum[8:], uint32(f.clock))
+	for i, e := range f.sum {
+		binary.LittleEndian.PutUint32(sum[12+8*i:], uint32(int32(e.inum)))
+		binary.LittleEndian.PutUint32(sum[16+8*i:], uint32(int32(e.n)))
+	}
+	if err := f.dev.WriteBlock(start, sum); err != nil {
+		return err
+	}
+	first := start + 1 + len(f.sum) - len(f.pend)
+	for i, b := range f.pend {
+		if err := f.dev.WriteBlock(first+i, b); err != nil {
+			return err
+		}
+	}
+	f.pend = nil
+	f.when[f.seg] = f.clock
+	f.clock++
+	f.stats.SegmentWrites++
+	return nil
+}
+
+// advance starts filling the next free segment.
+func (f *FS) advance() error {
+	for i := 1; i <= f.geo.Segments; i++ {
+		s := (f.seg + i) % f.geo.Segments
+		if f.free[s] {
+			f.free[s] = false
+			f.seg, f.sum, f.live[s] = s, nil, 0
+			return nil
+		}
+	}
+	return fs.ErrNoSpace
+}
+
+// kill marks the block at addr dead.
+func (f *FS) kill(addr int) {
+	if addr != 0 {
+		f.live[f.geo.segOf(addr)]--
+	}
+}
+
+// read reads the block at addr, from the segment being filled if it is
+// still pending there.
+func (f *FS) read(addr int) ([]byte, error) {
+	if f.geo.segOf(addr) == f.seg {
+		i := addr - f.geo.segStart(f.seg) - 1 - (len(f.sum) - len(f.pend))
+		if i >= 0 && i < len(f.pend) {
+			return append([]byte(nil), f.pend[i]...), nil
+		}
+	}
+	return readBlock(f.dev, addr)
+}
+
+// readBlock reads block n of dev as exactly BlockSize bytes; a raid.Disk
+// block past the end of its file reads as zeros.
+func readBlock(dev fs.Device, n int) ([]byte, error) {
+	data, err := dev.ReadBlock(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(data) < BlockSize {
+		data = append(data, make([]byte, BlockSize-len(data))...)
+	}
+	return data[:BlockSize], nil
+}
@@ -0,0 +1,179 @@
+// Package future is futures on the worker pool: Submit runs a function on
+// a pool.Pool and hands back a Future for its result, which Get waits
+// for. Then chains a function to run on the pool once a future is done,
+// and All waits for a set of them, so a computation can be laid out as a
+// graph of tasks without a goroutine blocked per edge: nothing waits for
+// a future but the caller of Get, and continuations are queued when their
+// input completes, not before.
+package future
+
+import (
+	"errors"
+	"runtime/debug"
+	"time"
+
+	"example.com/operating-systems/locks"
+	"example.com/operating-systems/pool"
+)
+
+// ErrTimeout is GetTimeout giving up.
+var ErrTimeout = errors.New("future: timed out")
+
+// Future is a value that will be ready later.
+type Future[T any] struct {
+	done  chan struct{} // closed once val and err are set
+	val   T
+	err   error
+	mu    locks.QueueLock // guards then and fired
+	then  []func()        // run when the future resolves
+	fired bool
+}
+
+func newFuture[T any]() *Future[T] { return &Future[T]{done: make(chan struct{})} }
+
+// Ready returns a future already resolved to v and err.
+func Ready[T any](v T, err error) *Future[T] {
+	f := newFuture[T]()
+	f.resolve(v, err)
+	return f
+}
+
+// resolve sets the result, wakes Get, and runs the continuations; only
+// the first call counts.
+func (f *Future[T]) resolve(v T, err error) {
+	f.mu.Lock()
+	if f.fired {
+		f.mu.Unlock()
+		return
+	}
+	f.fired = true
+	f.val, f.err = v, err
+	then := f.then
+	f.then = nil
+	f.mu.Unlock()
+	close(f.done)
+	for _, g := range then {
+		g()
+	}
+}
+
+// onDone runs g once f resolves: now, if it has.
+func (f *Future[T]) onDone(g func()) {
+	f.mu.Lock()
+	if !f.fired {
+		f.then = append(f.then, g)
+		f.mu.Unlock()
+		return
+	}
+	f.mu.Unlock()
+	g()
+}
+
+// Get waits for the result.
+func (f *Future[T]) Get() (T, error) {
+	<-f.done
+	return f.val, f.err
+}
+
+// GetTimeout waits up to d for the result, returning ErrTimeout if it
+// isn't ready by then; the future carries on regardless.
+func (f *Future[T]) GetTimeout(d time.Duration) (T, error) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-t.C:
+		var zero T
+		return zero, ErrTimeout
+	}
+}
+
+// Done is closed when the result is ready.
+func (f *Future[T]) Done() <-chan struct{} { return f.done }
+
+// Submit runs fn on p. A panic in fn resolves the future with a
+// *pool.PanicError, and a pool that's shut down with pool.ErrClosed.
+func Submit[T any](p *pool.Pool, fn func() (T, error)) *Future[T] {
+	f := newFuture[T]()
+	submit(p, f, fn)
+	return f
+}
+
+// submit queues fn on p to resolve f. It may be called from a worker (a
+// continuation firing), so it mustn't wait for room in a full queue: that
+// worker could be the one that would have made it. A full queue gets a
+// goroutine to wait instead.
+func submit[T any](p *pool.Pool, f *Future[T], fn func() (T, error)) {
+	task := func() {
+		var v T
+		var err error
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &pool.PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+			v, err = fn()
+		}()
+		f.resolve(v, err)
+	}
+	switch err := p.TrySubmit(task); {
+	case err == nil:
+	case errors.Is(err, pool.ErrFull):
+		go func() {
+			if err := p.Submit(task); err != nil {
+				var zero T
+				f.resolve(zero, err)
+			}
+		}()
+	default:
+		var zero T
+		f.resolve(zero, err)
+	}
+}
+
+// Then runs g on p with f's value once f is done. If f fails, g doesn't
+// run and the new future fails the same way.
+func Then[T, U any](p *pool.Pool, f *Future[T], g func(T) (U, error)) *Future[U] {
+	out := newFuture[U]()
+	f.onDone(func() {
+		if f.err != nil {
+			var zero U
+			out.resolve(zero, f.err)
+			return
+		}
+		submit(p, out, func() (U, error) { return g(f.val) })
+	})
+	return out
+}
+
+// All resolves to every future's value, in order, once they're all done,
+// or to the first error as soon as one fails.
+func All[T any](fs ...*Future[T]) *Future[[]T] {
+	out := newFuture[[]T]()
+	if len(fs) == 0 {
+		out.resolve(nil, nil)
+		return out
+	}
+	vals := make([]T, len(fs))
+	var mu locks.QueueLock // guards left
+	left := len(fs)
+	for i, f := range fs {
+		f.onDone(func() {
+			if f.err != nil {
+				out.resolve(nil, f.err)
+				return
+			}
+			vals[i] = f.val
+			mu.Lock()
+			left--
+			last := left == 0
+			mu.Unlock()
+			if last {
+				out.resolve(vals, nil)
+			}
+		})
+	}
+	return out
+}
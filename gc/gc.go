@@ -0,0 +1,374 @@
+// Package gc simulates a garbage-collected heap: objects with pointer
+// fields, a root set the mutator holds them through, and collectors that
+// find the unreachable objects by marking from the roots and sweep them
+// back to the allocator. Object storage comes from a free-list allocator
+// (package freelist), so a sweep really returns blocks and a heap can
+// fragment. Collection work is counted in abstract units (one per root
+// scanned, object blackened, pointer followed, or object swept), so pauses
+// compare across machines; wall-clock times are reported as well.
+package gc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/operating-systems/HW0/Q2/freelist"
+)
+
+// color is an object's tri-color marking state: white (not reached yet,
+// garbage if still white when marking ends), grey (reached, fields not
+// scanned yet), black (reached and scanned).
+type color uint8
+
+const (
+	white color = iota
+	grey
+	black
+)
+
+// Object is a heap object.
+type Object struct {
+	ID    int
+	Size  int
+	Refs  []*Object // pointer fields, nil when unset
+	color color
+	block []byte
+	freed bool
+}
+
+// Collector decides when and how much to collect.
+type Collector interface {
+	Name() string
+	// BeforeAlloc runs before every allocation; an incremental collector
+	// does a slice of its work here.
+	BeforeAlloc(h *Heap)
+	// Collect runs a whole collection (finishing one in progress) when an
+	// allocation finds no room.
+	Collect(h *Heap)
+	// Barrier runs before the mutator stores tgt into one of src's fields.
+	Barrier(h *Heap, src, tgt *Object)
+}
+
+// phase is where the heap's collection cycle is.
+type phase int
+
+const (
+	idle phase = iota
+	marking
+	sweeping
+)
+
+// Pause is one stretch of collection work with the mutator stopped.
+type Pause struct {
+	Cycle int
+	Kind  string // "full" (stop the world), "roots", "mark", "remark", "sweep", or "finish"
+	Work  int
+	Time  time.Duration
+}
+
+// Cycle is one complete collection.
+type Cycle struct {
+	Marked     int // objects found live
+	Freed      int
+	FreedBytes int
+	Pauses     int
+	Work       int
+}
+
+// Stats counts what happened to a heap.
+type Stats struct {
+	Ops        int // mutator operations
+	Allocs     int
+	AllocBytes int
+	Failed     int // allocations with no room even after a full collection
+	Stores     int // pointer stores
+	Shaded     int // objects the write barrier greyed
+	PeakBytes  int // most bytes in live blocks at once
+	Pauses     []Pause
+	Cycles     []Cycle
+}
+
+// Heap is a garbage-collected heap of size bytes.
+type Heap struct {
+	Roots []*Object // what the mutator holds directly
+
+	mem    *freelist.Allocator
+	size   int
+	c      Collector
+	objs   []*Object // every allocated object, in allocation order
+	nextID int
+	phase  phase
+	grey   []*Object // the mark stack
+	swept  int       // sweeping: objects in objs examined so far
+	kept   int       // sweeping: survivors compacted to the front of objs
+	cur    Cycle
+	Stats  Stats
+}
+
+// NewHeap returns an empty heap of size bytes, allocating with fit and
+// collecting with c.
+func NewHeap(size int, fit freelist.Fit, c Collector) *Heap {
+	return &Heap{mem: freelist.New(size, fit), size: size, c: c}
+}
+
+// Alloc returns a new object of size bytes with fields nil pointer fields.
+// When the allocator has no room the collector runs a full collection
+// and the allocation is retried once.
+func (h *Heap) Alloc(size, fields int) (*Object, error) {
+	h.c.BeforeAlloc(h)
+	b, err := h.mem.Alloc(size)
+	if errors.Is(err, freelist.ErrOutOfMemory) {
+		h.c.Collect(h)
+		b, err = h.mem.Alloc(size)
+	}
+	if err != nil {
+		h.Stats.Failed++
+		return nil, err
+	}
+	h.nextID++
+	o := &Object{ID: h.nextID, Size: size, Refs: make([]*Object, fields), block: b}
+	// Objects allocated mid-cycle survive it: they're black while marking,
+	// and while sweeping they land past the sweep point and must not be
+	// taken for garbage
+	if h.phase != idle {
+		o.color = black
+	}
+	h.objs = append(h.objs, o)
+	h.Stats.Allocs++
+	h.Stats.AllocBytes += size
+	h.Stats.PeakBytes = max(h.Stats.PeakBytes, h.mem.Stats().Used)
+	return o, nil
+}
+
+// Store sets src.Refs[i] = tgt, through the collector's write barrier.
+func (h *Heap) Store(src *Object, i int, tgt *Object) {
+	if tgt != nil {
+		h.c.Barrier(h, src, tgt)
+	}
+	src.Refs[i] = tgt
+	h.Stats.Stores++
+}
+
+// Occupancy is the share of the heap in live blocks, headers included.
+func (h *Heap) Occupancy() float64 {
+	return float64(h.mem.Stats().Used) / float64(h.size)
+}
+
+// Collector names the heap's collector.
+func (h *Heap) Collector() string { return h.c.Name() }
+
+// Memory reports the allocator's state.
+func (h *Heap) Memory() freelist.Stats { return h.mem.Stats() }
+
+// shade greys a white object.
+func (h *Heap) shade(o *Object) {
+	if o.color == white {
+		o.color = grey
+		h.grey = append(h.grey, o)
+	}
+}
+
+// startMark begins a cycle by greying the roots.
+func (h *Heap) startMark() int {
+	h.phase = marking
+	h.cur = Cycle{}
+	for _, r := range h.Roots {
+		h.shade(r)
+	}
+	return len(h.Roots)
+}
+
+// rescan greys the roots again: the root set changes while an
+// incremental cycle marks, and nothing reachable from it may stay white.
+func (h *Heap) rescan() int {
+	for _, r := range h.Roots {
+		h.shade(r)
+	}
+	return len(h.Roots)
+}
+
+// mark blackens grey objects until the mark stack is empty or budget
+// units of work are done (budget < 0: no limit). It reports the work done
+// and whether marking is complete.
+func (h *Heap) mark(budget int) (int, bool) {
+	work := 0
+	for len(h.grey) > 0 && (budget < 0 || work < budget) {
+		o := h.grey[len(h.grey)-1]
+		h.grey = h.grey[:len(h.grey)-1]
+		for _, r := range o.Refs {
+			if r != nil {
+				h.shade(r)
+			}
+		}
+		o.color = black
+		h.cur.Marked++
+		work += 1 + len(o.Refs)
+	}
+	return work, len(h.grey) == 0
+}
+
+// startSweep ends marking.
+func (h *Heap) startSweep() {
+	h.phase = sweeping
+	h.swept, h.kept = 0, 0
+}
+
+// sweep frees white objects and whitens black ones for the next cycle,
+// compacting the survivors to the front of objs, until it reaches the
+// end or does budget units of work (budget < 0: no limit).
+func (h *Heap) sweep(budget int) (int, bool) {
+	work := 0
+	for h.swept < len(h.objs) && (budget < 0 || work < budget) {
+		o := h.objs[h.swept]
+		h.swept++
+		work++
+		if o.color == white {
+			if err := h.mem.Free(o.block); err != nil {
+				panic(fmt.Sprintf("gc: freeing object %d: %v", o.ID, err))
+			}
+			o.freed, o.block = true, nil
+			h.cur.Freed++
+			h.cur.FreedBytes += o.Size
+			continue
+		}
+		o.color = white
+		h.objs[h.kept] = o
+		h.kept++
+	}
+	if h.swept < len(h.objs) {
+		return work, false
+	}
+	clear(h.objs[h.kept:])
+	h.objs = h.objs[:h.kept]
+	h.phase = idle
+	return work, true
+}
+
+// pause records a stretch of collection work in the current cycle.
+func (h *Heap) pause(kind string, work int, start time.Time) {
+	h.cur.Pauses++
+	h.cur.Work += work
+	h.Stats.Pauses = append(h.Stats.Pauses, Pause{Cycle: len(h.Stats.Cycles) + 1, Kind: kind, Work: work, Time: time.Since(start)})
+}
+
+// endCycle records the cycle the last sweep finished.
+func (h *Heap) endCycle() {
+	h.Stats.Cycles = append(h.Stats.Cycles, h.cur)
+}
+
+// finish completes the cycle in progress, or runs a whole one, in a
+// single pause.
+func (h *Heap) finish(kind string) {
+	start := time.Now()
+	work := 0
+	if h.phase == idle {
+		work += h.startMark()
+	}
+	if h.phase == marking {
+		work += h.rescan()
+		w, _ := h.mark(-1)
+		work += w
+		h.startSweep()
+	}
+	w, _ := h.sweep(-1)
+	h.pause(kind, work+w, start)
+	h.endCycle()
+}
+
+// MarkSweep is the stop-the-world collector: when an allocation finds no
+// room it marks everything reachable from the roots and sweeps the rest,
+// all in one pause.
+type MarkSweep struct{}
+
+func (MarkSweep) Name() string                      { return "mark-sweep (stop the world)" }
+func (MarkSweep) BeforeAlloc(h *Heap)               {}
+func (MarkSweep) Collect(h *Heap)                   { h.finish("full") }
+func (MarkSweep) Barrier(h *Heap, src, tgt *Object) {}
+
+// Incremental spreads a mark-sweep cycle over the mutator's allocations:
+// a cycle starts once the heap is Trigger full, and every allocation then
+// pays for Budget units of marking or sweeping. The mutator keeps changing
+// the object graph while marking goes on, so a Dijkstra write barrier
+// greys any white object stored into a field; without it (NoBarrier) an
+// object moved behind an already-scanned one can be swept while still
+// reachable. Marking ends by rescanning the roots. Allocating faster than
+// the budget collects ends in a full collection.
+type Incremental struct {
+	Budget    int     // work units per allocation
+	Trigger   float64 // occupancy that starts a cycle
+	NoBarrier bool
+}
+
+func (c Incremental) Name() string {
+	s := fmt.Sprintf("incremental (budget %d, trigger %.0f%%)", c.Budget, 100*c.Trigger)
+	if c.NoBarrier {
+		s += " without write barrier"
+	}
+	return s
+}
+
+func (c Incremental) BeforeAlloc(h *Heap) {
+	start := time.Now()
+	switch h.phase {
+	case idle:
+		if h.Occupancy() >= c.Trigger {
+			h.pause("roots", h.startMark(), start)
+		}
+	case marking:
+		work, done := h.mark(c.Budget)
+		if !done {
+			h.pause("mark", work, start)
+			break
+		}
+		// Remark: the roots may hold objects marking hasn't seen
+		work += h.rescan()
+		w, _ := h.mark(-1)
+		h.startSweep()
+		h.pause("remark", work+w, start)
+	case sweeping:
+		work, done := h.sweep(c.Budget)
+		h.pause("sweep", work, start)
+		if done {
+			h.endCycle()
+		}
+	}
+}
+
+func (c Incremental) Collect(h *Heap) { h.finish("finish") }
+
+func (c Incremental) Barrier(h *Heap, src, tgt *Object) {
+	if h.phase == marking && !c.NoBarrier {
+		if tgt.color == white {
+			h.Stats.Shaded++
+		}
+		h.shade(tgt)
+	}
+}
+
+// ErrDangling is returned by Verify when a reachable object was freed.
+var ErrDangling = errors.New("gc: reachable object was freed")
+
+// Verify walks the object graph from the roots and checks that the
+// collector freed nothing reachable.
+func (h *Heap) Verify() error {
+	seen := map[*Object]bool{}
+	stack := append([]*Object(nil), h.Roots...)
+	for len(stack) > 0 {
+		o := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[o] {
+			continue
+		}
+		seen[o] = true
+		if o.freed {
+			return fmt.Errorf("%w: object %d", ErrDangling, o.ID)
+		}
+		for _, r := range o.Refs {
+			if r != nil {
+				stack = append(stack, r)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package gc
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Report summarizes the run: allocation, reclamation, and pauses.
+func (h *Heap) Report() string {
+	var b strings.Builder
+	s := h.Stats
+	fmt.Fprintf(&b, "%s, %d-byte heap\n", h.Collector(), h.size)
+	fmt.Fprintf(&b, "  mutator: %d ops, %d allocations (%d bytes), %d failed, %d pointer stores", s.Ops, s.Allocs, s.AllocBytes, s.Failed, s.Stores)
+	if s.Shaded > 0 {
+		fmt.Fprintf(&b, ", %d objects shaded by the write barrier", s.Shaded)
+	}
+	freed, freedBytes, work := 0, 0, 0
+	for _, c := range s.Cycles {
+		freed += c.Freed
+		freedBytes += c.FreedBytes
+		work += c.Work
+	}
+	fmt.Fprintf(&b, "\n  collector: %d cycles, %d objects (%d bytes) reclaimed, %d units of work (%.2f per allocation)\n",
+		len(s.Cycles), freed, freedBytes, work, float64(work)/float64(max(s.Allocs, 1)))
+	if len(s.Cycles) > 0 {
+		fmt.Fprintf(&b, "  per cycle: %.1f objects live, %.1f reclaimed, %.1f pauses\n",
+			avg(s.Cycles, func(c Cycle) int { return c.Marked }), avg(s.Cycles, func(c Cycle) int { return c.Freed }),
+			avg(s.Cycles, func(c Cycle) int { return c.Pauses }))
+	}
+	p := h.PauseStats()
+	fmt.Fprintf(&b, "  pauses: %d, work max %d mean %.1f p99 %d, time max %v total %v\n", p.Count, p.MaxWork, p.MeanWork, p.P99Work, p.MaxTime, p.Total)
+	m := h.Memory()
+	fmt.Fprintf(&b, "  heap now: %d objects, %.1f%% in use, %d free blocks, external fragmentation %.1f%%, peak %d bytes\n",
+		len(h.objs), 100*h.Occupancy(), m.FreeBlocks, 100*m.External(), s.PeakBytes)
+	return b.String()
+}
+
+// PauseStats summarizes the pauses.
+type PauseStats struct {
+	Count    int
+	MaxWork  int
+	MeanWork float64
+	P99Work  int
+	MaxTime  time.Duration
+	Total    time.Duration
+}
+
+// PauseStats summarizes the heap's pauses so far.
+func (h *Heap) PauseStats() PauseStats {
+	var p PauseStats
+	ps := h.Stats.Pauses
+	if len(ps) == 0 {
+		return p
+	}
+	works := make([]int, len(ps))
+	total := 0
+	for i, x := range ps {
+		works[i] = x.Work
+		total += x.Work
+		p.MaxTime = max(p.MaxTime, x.Time)
+		p.Total += x.Time
+	}
+	slices.Sort(works)
+	p.Count = len(ps)
+	p.MaxWork = works[len(works)-1]
+	p.MeanWork = float64(total) / float64(len(ps))
+	p.P99Work = works[(len(works)-1)*99/100]
+	return p
+}
+
+// avg is the mean of f over cycles.
+func avg(cycles []Cycle, f func(Cycle) int) float64 {
+	total := 0
+	for _, c := range cycles {
+		total += f(c)
+	}
+	return float64(total) / float64(len(cycles))
+}
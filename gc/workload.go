@@ -0,0 +1,103 @@
+package gc
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Workload generates a mutator: a program that allocates objects, keeps
+// some of them in its roots (its local variables), and links objects it can
+// reach to one another. Whatever drops out of reach is garbage. The same
+// seed gives the same operations, as long as allocations succeed.
+type Workload struct {
+	Ops     int
+	Seed    int64
+	MinSize int // bytes per object, uniform in [MinSize, MaxSize]
+	MaxSize int
+	Fields  int     // pointer fields per object, uniform in [0, Fields]
+	Roots   int     // roots held; allocating past this drops a random one
+	Link    float64 // chance an operation stores a pointer instead of allocating
+	Unlink  float64 // chance a store writes nil, cutting a link
+	Move    float64 // chance a store moves a pointer: copies one from a field, then clears that field
+	Walk    int     // most pointers followed from a root to reach an object
+}
+
+// DefaultWorkload is a mix of short-lived objects and linked structures
+// that outlive the roots that made them.
+func DefaultWorkload() Workload {
+	return Workload{Ops: 100000, MinSize: 16, MaxSize: 256, Fields: 4, Roots: 64, Link: 0.4, Unlink: 0.2, Move: 0.2, Walk: 3}
+}
+
+func (w Workload) String() string {
+	return fmt.Sprintf("%d ops, %d-%d byte objects, up to %d fields, %d roots, %.0f%% stores (%.0f%% nil, %.0f%% moves), walks up to %d",
+		w.Ops, w.MinSize, w.MaxSize, w.Fields, w.Roots, 100*w.Link, 100*w.Unlink, 100*w.Move, w.Walk)
+}
+
+// Run plays the workload on h, calling check (if not nil) after every
+// operation and stopping at the first error it returns. An allocation
+// that fails even after a full collection is counted and skipped.
+func (w Workload) Run(h *Heap, check func() error) error {
+	r := rand.New(rand.NewSource(w.Seed))
+	for i := 0; i < w.Ops; i++ {
+		h.Stats.Ops++
+		if len(h.Roots) > 0 && r.Float64() < w.Link {
+			w.store(h, r)
+		} else {
+			size := w.MinSize + r.Intn(w.MaxSize-w.MinSize+1)
+			if o, err := h.Alloc(size, r.Intn(w.Fields+1)); err == nil {
+				h.Roots = append(h.Roots, o)
+			}
+			if len(h.Roots) > w.Roots {
+				k := r.Intn(len(h.Roots))
+				h.Roots[k] = h.Roots[len(h.Roots)-1]
+				h.Roots = h.Roots[:len(h.Roots)-1]
+			}
+		}
+		if check != nil {
+			if err := check(); err != nil {
+				return fmt.Errorf("op %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// reach picks an object the mutator can get at: a random root, then up to
+// Walk random non-nil pointers from it.
+func (w Workload) reach(h *Heap, r *rand.Rand) *Object {
+	o := h.Roots[r.Intn(len(h.Roots))]
+	for steps := r.Intn(w.Walk + 1); steps > 0 && len(o.Refs) > 0; steps-- {
+		next := o.Refs[r.Intn(len(o.Refs))]
+		if next == nil {
+			break
+		}
+		o = next
+	}
+	return o
+}
+
+// store makes one pointer store into an object the mutator reaches: a
+// move, a nil, or a pointer to another reachable object.
+func (w Workload) store(h *Heap, r *rand.Rand) {
+	src := w.reach(h, r)
+	if len(src.Refs) == 0 {
+		return
+	}
+	i := r.Intn(len(src.Refs))
+	switch x := r.Float64(); {
+	case x < w.Move:
+		// What an incremental collector without a write barrier gets
+		// wrong: the object can leave a part of the graph not scanned yet
+		// for a part already scanned
+		from := w.reach(h, r)
+		if len(from.Refs) > 0 {
+			f := r.Intn(len(from.Refs))
+			h.Store(src, i, from.Refs[f])
+			h.Store(from, f, nil)
+		}
+	case x < w.Move+w.Unlink:
+		h.Store(src, i, nil)
+	default:
+		h.Store(src, i, w.reach(h, r))
+	}
+}
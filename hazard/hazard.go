@@ -0,0 +1,201 @@
+// Package hazard is Michael's hazard pointers, the safe memory reclamation
+// scheme for lock-free structures. A thread that is about to dereference
+// a shared node publishes it in one of its hazard pointers first, and a
+// node unlinked from the structure is retired rather than freed: it
+// waits on its retiring thread's list until a scan finds no hazard
+// pointer naming it.
+//
+// Go's GC makes all this unnecessary, so here "freeing" a node means
+// handing it back for reuse: Record.New returns reclaimed nodes before
+// allocating. Reusing a node that someone still reads is exactly the
+// use-after-free (and ABA) hazard pointers exist to prevent, which lets
+// the scheme be studied, and turned off with Config.Unsafe, apart from
+// the GC.
+package hazard
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Config tunes a domain.
+type Config struct {
+	Hazards int // hazard pointers per record
+	// Threshold is how many retired nodes a record holds before it scans;
+	// 0 means twice the hazard pointers of every record, the usual R.
+	Threshold int
+	// Unsafe frees retired nodes at once, ignoring hazard pointers.
+	Unsafe bool
+}
+
+// DefaultConfig is two hazard pointers, enough for the MS queue, and
+// the usual threshold.
+var DefaultConfig = Config{Hazards: 2}
+
+// Domain is the hazard pointers and retired nodes of one structure (or
+// several sharing a node type).
+type Domain[T any] struct {
+	cfg     Config
+	head    atomic.Pointer[Record[T]] // every record, never removed
+	records atomic.Int64
+
+	retired, freed, allocated, scans atomic.Uint64
+}
+
+// NewDomain returns a domain with no records.
+func NewDomain[T any](c Config) (*Domain[T], error) {
+	if c.Hazards < 1 || c.Threshold < 0 {
+		return nil, fmt.Errorf("hazard: need at least 1 hazard pointer and a threshold of at least 0, got %+v", c)
+	}
+	return &Domain[T]{cfg: c}, nil
+}
+
+// Record is one thread's: its hazard pointers, the nodes it has retired
+// and not yet freed, and the freed nodes it reuses. Only the goroutine
+// that acquired it may use it, until it releases it.
+type Record[T any] struct {
+	d       *Domain[T]
+	next    *Record[T]
+	active  atomic.Bool
+	hp      []atomic.Pointer[T]
+	retired []*T
+	free    []*T
+}
+
+// Acquire returns a record for the calling goroutine: an inactive one,
+// with whatever its last owner left retired, or a new one.
+func (d *Domain[T]) Acquire() *Record[T] {
+	for r := d.head.Load(); r != nil; r = r.next {
+		if !r.active.Load() && r.active.CompareAndSwap(false, true) {
+			return r
+		}
+	}
+	r := &Record[T]{d: d, hp: make([]atomic.Pointer[T], d.cfg.Hazards)}
+	r.active.Store(true)
+	for {
+		head := d.head.Load()
+		r.next = head
+		if d.head.CompareAndSwap(head, r) {
+			d.records.Add(1)
+			return r
+		}
+	}
+}
+
+// Release clears r's hazard pointers and gives it up. Its retired nodes
+// stay with it for the next owner to scan.
+func (r *Record[T]) Release() {
+	for i := range r.hp {
+		r.hp[i].Store(nil)
+	}
+	r.active.Store(false)
+}
+
+// Protect loads src into hazard pointer i until it reads the same node
+// twice, so that the node returned was still reachable, and so not yet
+// retired, once protected.
+func (r *Record[T]) Protect(i int, src *atomic.Pointer[T]) *T {
+	p := src.Load()
+	for {
+		r.hp[i].Store(p)
+		q := src.Load()
+		if q == p {
+			return p
+		}
+		p = q
+	}
+}
+
+// Set points hazard pointer i at p; the caller must check p is still
+// reachable afterwards, as Protect does.
+func (r *Record[T]) Set(i int, p *T) { r.hp[i].Store(p) }
+
+// Clear empties hazard pointer i.
+func (r *Record[T]) Clear(i int) { r.hp[i].Store(nil) }
+
+// Retire hands over p, unlinked from the structure, to be freed once no
+// hazard pointer names it, scanning if r holds enough retired nodes.
+func (r *Record[T]) Retire(p *T) {
+	r.d.retired.Add(1)
+	if r.d.cfg.Unsafe {
+		r.reclaim(p)
+		return
+	}
+	r.retired = append(r.retired, p)
+	threshold := r.d.cfg.Threshold
+	if threshold == 0 {
+		threshold = 2 * r.d.cfg.Hazards * int(r.d.records.Load())
+	}
+	if len(r.retired) >= threshold {
+		r.Scan()
+	}
+}
+
+// Scan frees every node r has retired that no hazard pointer names.
+func (r *Record[T]) Scan() {
+	r.d.scans.Add(1)
+	hazards := map[*T]bool{}
+	for o := r.d.head.Load(); o != nil; o = o.next {
+		for i := range o.hp {
+			if p := o.hp[i].Load(); p != nil {
+				hazards[p] = true
+			}
+		}
+	}
+	kept := r.retired[:0]
+	for _, p := range r.retired {
+		if hazards[p] {
+			kept = append(kept, p)
+		} else {
+			r.reclaim(p)
+		}
+	}
+	clear(r.retired[len(kept):])
+	r.retired = kept
+}
+
+func (r *Record[T]) reclaim(p *T) {
+	r.free = append(r.free, p)
+	r.d.freed.Add(1)
+}
+
+// New returns a freed node to reuse, its fields as they were left, or a
+// newly allocated one.
+func (r *Record[T]) New() *T {
+	if n := len(r.free); n > 0 {
+		p := r.free[n-1]
+		r.free[n-1] = nil
+		r.free = r.free[:n-1]
+		return p
+	}
+	r.d.allocated.Add(1)
+	return new(T)
+}
+
+// Stats counts what a domain has done.
+type Stats struct {
+	Records   int
+	Allocated uint64 // nodes New had to allocate
+	Retired   uint64
+	Freed     uint64
+	Scans     uint64
+}
+
+// Pending is the retired nodes not yet freed.
+func (s Stats) Pending() uint64 { return s.Retired - s.Freed }
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d records, %d allocated, %d retired, %d freed, %d pending, %d scans",
+		s.Records, s.Allocated, s.Retired, s.Freed, s.Pending(), s.Scans)
+}
+
+// Stats returns the counts so far.
+func (d *Domain[T]) Stats() Stats {
+	return Stats{
+		Records:   int(d.records.Load()),
+		Allocated: d.allocated.Load(),
+		Retired:   d.retired.Load(),
+		Freed:     d.freed.Load(),
+		Scans:     d.scans.Load(),
+	}
+}
@@ -0,0 +1,29 @@
+package fsio
+
+import (
+	"os"
+	"syscall"
+)
+
+func dataSync(f *os.File) error {
+	return ignoringEINTR(func() error { return syscall.Fdatasync(int(f.Fd())) })
+}
+
+func openDirect(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(name, flag|syscall.O_DIRECT, perm)
+}
+
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE: allocate without growing the file.
+const fallocKeepSize = 1
+
+func preallocate(f *os.File, size int64) error {
+	return ignoringEINTR(func() error { return syscall.Fallocate(int(f.Fd()), fallocKeepSize, 0, size) })
+}
+
+func ignoringEINTR(fn func() error) error {
+	for {
+		if err := fn(); err != syscall.EINTR {
+			return err
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin && !windows
+
+package fsio
+
+import (
+	"errors"
+	"os"
+)
+
+func dataSync(f *os.File) error {
+	return f.Sync()
+}
+
+func openDirect(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func preallocate(f *os.File, size int64) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,63 @@
+package fsio
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// dataSync is Full: Windows has nothing lighter than FlushFileBuffers.
+func dataSync(f *os.File) error {
+	return f.Sync()
+}
+
+// CreateFile flags syscall doesn't name.
+const (
+	fileFlagNoBuffering  = 0x20000000
+	fileFlagWriteThrough = 0x80000000
+)
+
+func openDirect(name string, flag int, perm os.FileMode) (*os.File, error) {
+	if flag&os.O_APPEND != 0 {
+		return nil, errors.New("O_APPEND is not supported")
+	}
+	path, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	var access uint32
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		access = syscall.GENERIC_READ
+	case os.O_WRONLY:
+		access = syscall.GENERIC_WRITE
+	default:
+		access = syscall.GENERIC_READ | syscall.GENERIC_WRITE
+	}
+	var create uint32
+	switch {
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		create = syscall.CREATE_NEW
+	case flag&(os.O_CREATE|os.O_TRUNC) == os.O_CREATE|os.O_TRUNC:
+		create = syscall.CREATE_ALWAYS
+	case flag&os.O_CREATE != 0:
+		create = syscall.OPEN_ALWAYS
+	case flag&os.O_TRUNC != 0:
+		create = syscall.TRUNCATE_EXISTING
+	default:
+		create = syscall.OPEN_EXISTING
+	}
+	attrs := uint32(syscall.FILE_ATTRIBUTE_NORMAL | fileFlagNoBuffering | fileFlagWriteThrough)
+	if perm&0o200 == 0 {
+		attrs |= syscall.FILE_ATTRIBUTE_READONLY
+	}
+	h, err := syscall.CreateFile(path, access, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, nil, create, attrs, 0)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), name), nil
+}
+
+func preallocate(f *os.File, size int64) error {
+	return errors.ErrUnsupported
+}
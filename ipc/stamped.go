@@ -0,0 +1,55 @@
+package ipc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// StampedWriter writes the stamped protocol: the binary framing with the
+// time the message was sent after the sequence number.
+type StampedWriter struct{ *bufio.Writer }
+
+// WriteMsg writes a message stamped with the time now.
+func (w StampedWriter) WriteMsg(seq int, payload []byte) error {
+	return w.WriteAt(seq, time.Now(), payload)
+}
+
+// WriteAt writes a message stamped with an explicit time, such as when a
+// paced message was due rather than when it was written.
+func (w StampedWriter) WriteAt(seq int, at time.Time, payload []byte) error {
+	var hdr [2*binary.MaxVarintLen64 + 8]byte
+	k := binary.PutUvarint(hdr[:], uint64(seq))
+	binary.LittleEndian.PutUint64(hdr[k:], uint64(at.UnixNano()))
+	k += 8
+	k += binary.PutUvarint(hdr[k:], uint64(len(payload)))
+	_, _ = w.Write(hdr[:k])
+	_, err := w.Write(payload)
+	return err
+}
+
+// StampedReader reads the stamped protocol.
+type StampedReader struct {
+	At time.Time // stamp of the last message read
+
+	br  *bufio.Reader
+	buf []byte
+}
+
+// NewStampedReader reads stamped messages from br.
+func NewStampedReader(br *bufio.Reader) *StampedReader { return &StampedReader{br: br} }
+
+func (r *StampedReader) ReadMsg() (int, []byte, error) {
+	seq, err := binary.ReadUvarint(r.br)
+	if err != nil {
+		return 0, nil, err
+	}
+	var ts [8]byte
+	if _, err := io.ReadFull(r.br, ts[:]); err != nil {
+		return 0, nil, noEOF(err)
+	}
+	r.At = time.Unix(0, int64(binary.LittleEndian.Uint64(ts[:])))
+	payload, err := readPayload(r.br, &r.buf)
+	return int(seq), payload, err
+}
@@ -0,0 +1,39 @@
+package ipc
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// AttachStreams gives cmd a data pipe and an ACK pipe (see PassStreams).
+// release closes our copies of the child's ends; call it once cmd has
+// started (or failed to), so EOF on either pipe means the other side is gone.
+func AttachStreams(cmd *exec.Cmd) (data io.WriteCloser, ack io.ReadCloser, release func(), err error) {
+	dataR, dataW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ack, release, err = AttachAck(cmd, dataR)
+	if err != nil {
+		dataR.Close()
+		dataW.Close()
+		return nil, nil, nil, err
+	}
+	return dataW, ack, release, nil
+}
+
+// AttachAck is AttachStreams for a child whose data comes from an existing
+// pipe (read end dataR), e.g. the output of a relay process.
+func AttachAck(cmd *exec.Cmd, dataR *os.File) (ack io.ReadCloser, release func(), err error) {
+	ackR, ackW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	PassStreams(cmd, dataR, ackW)
+	release = func() {
+		dataR.Close()
+		ackW.Close()
+	}
+	return ackR, release, nil
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package ipc
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// PassStreams falls back to the child's stdin and stderr, since there is
+// no cmd.ExtraFiles here.
+func PassStreams(cmd *exec.Cmd, data, ack *os.File) {
+	cmd.Stdin = data
+	cmd.Stderr = ack
+}
+
+// ChildStreams is the child's side of PassStreams.
+func ChildStreams() (data io.Reader, ack io.Writer) { return os.Stdin, os.Stderr }
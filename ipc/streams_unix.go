@@ -0,0 +1,27 @@
+//go:build unix
+
+package ipc
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// A child gets its own pair of pipes instead of stdin/stderr, so its
+// standard streams stay free for logging and the protocol doesn't care
+// how the console is redirected.
+const (
+	dataFd = 3 // child reads messages here (cmd.ExtraFiles[0])
+	ackFd  = 4 // child writes ACKs here (cmd.ExtraFiles[1])
+)
+
+// PassStreams hands the child its data and ACK pipe ends as fds 3 and 4.
+func PassStreams(cmd *exec.Cmd, data, ack *os.File) {
+	cmd.ExtraFiles = []*os.File{data, ack}
+}
+
+// ChildStreams is the child's side of PassStreams.
+func ChildStreams() (data io.Reader, ack io.Writer) {
+	return os.NewFile(dataFd, "data"), os.NewFile(ackFd, "ack")
+}
@@ -0,0 +1,378 @@
+// Package kvstore is a durable key-value store in the Bitcask style, on
+// the block devices of package fs, so on a raid.Disk, any RAID array of
+// HW7 through fs.Array, or memory. The write-ahead log is the store: Put
+// and Delete append a record (CRC-checked, like HW8's log entries made
+// crash-safe) to the head segment, and an in-memory hash index maps each
+// key to its newest record, so Get is one read.
+//
+// Block 0 is a superblock; the rest of the device is segments of
+// SegBlocks blocks, each starting with a header that gives its sequence
+// number. Records go to the device once Config.SyncEvery of them have
+// been appended, or on Sync, the tail block rewritten as it fills. Open
+// recovers by replaying every segment in sequence order up to the first
+// record that doesn't check out, so a crash loses only what wasn't
+// written yet, and always a suffix of the operations.
+//
+// Overwrites and deletes leave dead records behind. When fewer than
+// Config.Low segments are free, compaction copies the oldest segment's
+// live records to the head of the log and frees it, as a circular log:
+// cleaning oldest first means a deletion in the segment cleaned can be
+// dropped, as no older segment is left to hold the key.
+package kvstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"example.com/operating-systems/fs"
+)
+
+// BlockSize is fs's block size.
+const BlockSize = fs.BlockSize
+
+const (
+	magic    = 0x6b767331 // "kvs1"
+	segMagic = 0x6b767353 // "kvsS"
+	// MaxKey is the longest key a record holds.
+	MaxKey = 1<<16 - 1
+)
+
+var (
+	ErrNotFound = errors.New("kvstore: key not found")
+	ErrBadStore = errors.New("kvstore: not a store (bad superblock)")
+	ErrTooLarge = errors.New("kvstore: record larger than a segment")
+	ErrFull     = errors.New("kvstore: store full of live data")
+	ErrClosed   = errors.New("kvstore: store closed")
+)
+
+// Geometry is the store's layout.
+type Geometry struct {
+	Blocks    int // device blocks used
+	SegBlocks int
+	Segments  int
+}
+
+func (g Geometry) segStart(s int) int { return 1 + s*g.SegBlocks }
+
+// Config tunes an open store.
+type Config struct {
+	// SyncEvery is how many records are appended before the log is
+	// written out: 1 writes every Put and Delete through, 0 only Sync
+	// and a full segment.
+	SyncEvery int
+	// Low is how few free segments start compaction.
+	Low int
+}
+
+// DefaultConfig writes every record through and compacts to keep two
+// segments free.
+var DefaultConfig = Config{SyncEvery: 1, Low: 2}
+
+// loc is where a record is: its segment, byte offset there and length.
+type loc struct{ seg, off, size int }
+
+// Store is an open key-value store, safe for concurrent use.
+type Store struct {
+	mu  sync.Mutex
+	dev fs.Device
+	geo Geometry
+	cfg Config
+
+	index   map[string]loc
+	seq     []uint64 // per segment, its sequence number, 0 if free
+	used    []int    // per segment, bytes of log in it
+	live    []int    // per segment, bytes of records the index points at
+	order   []int    // segments in use, oldest first
+	lastSeq uint64
+
+	head    int    // the segment being appended to
+	buf     []byte // its contents so far
+	written int    // bytes of buf on the device
+	pending int    // records appended since the last flush
+
+	compacting bool
+	closed     bool
+	stats      Stats
+}
+
+// Stats counts what a store has done since it was opened.
+type Stats struct {
+	Puts, Deletes, Gets int
+	Appended            int64 // record bytes Put and Delete appended
+	Copied              int64 // record bytes compaction copied forward
+	Compactions         int   // segments compacted
+	Flushes             int
+	BlockWrites         int
+	Replayed            int // records replayed by Open
+}
+
+// WriteAmplification is bytes written to the device per byte of record
+// appended.
+func (s Stats) WriteAmplification() float64 {
+	if s.Appended == 0 {
+		return 0
+	}
+	return float64(s.BlockWrites) * BlockSize / float64(s.Appended)
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d puts, %d deletes, %d gets; %d bytes appended, %d copied by %d compactions; %d flushes, %d block writes (%.1fx); %d records replayed",
+		s.Puts, s.Deletes, s.Gets, s.Appended, s.Copied, s.Compactions, s.Flushes, s.BlockWrites, s.WriteAmplification(), s.Replayed)
+}
+
+// Format writes an empty store of blocks blocks in segments of segBlocks.
+func Format(dev fs.Device, blocks, segBlocks int) error {
+	g := Geometry{Blocks: blocks, SegBlocks: segBlocks}
+	if segBlocks < 1 {
+		return fmt.Errorf("kvstore: segments need at least 1 block, got %d", segBlocks)
+	}
+	if g.Segments = (blocks - 1) / segBlocks; g.Segments < 3 {
+		return fmt.Errorf("kvstore: %d blocks make %d segments of %d; need at least 3", blocks, g.Segments, segBlocks)
+	}
+	for s := 0; s < g.Segments; s++ {
+		if err := dev.WriteBlock(g.segStart(s), make([]byte, BlockSize)); err != nil {
+			return err
+		}
+	}
+	sb := make([]byte, BlockSize)
+	binary.LittleEndian.PutUint32(sb, magic)
+	binary.LittleEndian.PutUint32(sb[4:], uint32(blocks))
+	binary.LittleEndian.PutUint32(sb[8:], uint32(segBlocks))
+	return dev.WriteBlock(0, sb)
+}
+
+// Open recovers the store on dev by replaying its log.
+func Open(dev fs.Device, c Config) (*Store, error) {
+	if c.SyncEvery < 0 || c.Low < 1 {
+		return nil, fmt.Errorf("kvstore: need SyncEvery at least 0 and Low at least 1, got %+v", c)
+	}
+	sb, err := readBlock(dev, 0)
+	if err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(sb) != magic {
+		return nil, ErrBadStore
+	}
+	g := Geometry{Blocks: int(binary.LittleEndian.Uint32(sb[4:])), SegBlocks: int(binary.LittleEndian.Uint32(sb[8:]))}
+	if g.SegBlocks < 1 {
+		return nil, ErrBadStore
+	}
+	g.Segments = (g.Blocks - 1) / g.SegBlocks
+	s := &Store{
+		dev: dev, geo: g, cfg: c, index: map[string]loc{},
+		seq: make([]uint64, g.Segments), used: make([]int, g.Segments), live: make([]int, g.Segments),
+	}
+	for seg := range s.seq {
+		h, err := readBlock(dev, g.segStart(seg))
+		if err != nil {
+			return nil, err
+		}
+		if binary.LittleEndian.Uint32(h) == segMagic {
+			s.seq[seg] = binary.LittleEndian.Uint64(h[4:])
+			s.order = append(s.order, seg)
+		}
+	}
+	sort.Slice(s.order, func(a, b int) bool { return s.seq[s.order[a]] < s.seq[s.order[b]] })
+	if len(s.order) == 0 {
+		s.start(0, 1)
+		s.lastSeq = 1
+		return s, nil
+	}
+	var data []byte
+	for _, seg := range s.order {
+		if data, err = s.readSegment(seg, 0, g.SegBlocks-1); err != nil {
+			return nil, err
+		}
+		off := segHeader
+		for {
+			r, ok := decode(data[off:], s.seq[seg])
+			if !ok {
+				break
+			}
+			s.apply(r.kind, r.key, loc{seg, off, r.size})
+			s.stats.Replayed++
+			off += r.size
+		}
+		s.used[seg] = off
+	}
+	// Go on appending to the newest segment, after its last good record.
+	s.head = s.order[len(s.order)-1]
+	s.lastSeq = s.seq[s.head]
+	s.buf = append(make([]byte, 0, g.SegBlocks*BlockSize), data[:s.used[s.head]]...)
+	s.written = len(s.buf)
+	return s, nil
+}
+
+// apply points the index at a record just appended or replayed, keeping
+// the live byte counts.
+func (s *Store) apply(kind byte, key string, l loc) {
+	if old, ok := s.index[key]; ok {
+		s.live[old.seg] -= old.size
+		delete(s.index, key)
+	}
+	if kind == kindPut {
+		s.index[key] = l
+		s.live[l.seg] += l.size
+	}
+}
+
+// Geometry returns the store's layout.
+func (s *Store) Geometry() Geometry { return s.geo }
+
+// Put sets key to val.
+func (s *Store) Put(key string, val []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.write(kindPut, key, val); err != nil {
+		return err
+	}
+	s.stats.Puts++
+	return nil
+}
+
+// Delete removes key, reporting ErrNotFound if it wasn't there.
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.index[key]; !ok {
+		return ErrNotFound
+	}
+	if err := s.write(kindDel, key, nil); err != nil {
+		return err
+	}
+	s.stats.Deletes++
+	return nil
+}
+
+func (s *Store) write(kind byte, key string, val []byte) error {
+	switch {
+	case s.closed:
+		return ErrClosed
+	case len(key) > MaxKey:
+		return fmt.Errorf("kvstore: key of %d bytes is longer than %d", len(key), MaxKey)
+	}
+	l, err := s.append(kind, key, val)
+	if err != nil {
+		return err
+	}
+	s.apply(kind, key, l)
+	s.stats.Appended += int64(l.size)
+	if s.cfg.SyncEvery > 0 && s.pending >= s.cfg.SyncEvery {
+		return s.flush()
+	}
+	return nil
+}
+
+// Get returns key's value, or ErrNotFound.
+func (s *Store) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	l, ok := s.index[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	s.stats.Gets++
+	var data []byte
+	if l.seg == s.head {
+		data = s.buf[l.off : l.off+l.size]
+	} else {
+		first := l.off / BlockSize
+		b, err := s.readSegment(l.seg, first, (l.off+l.size-1)/BlockSize)
+		if err != nil {
+			return nil, err
+		}
+		data = b[l.off-first*BlockSize:]
+	}
+	r, ok := decode(data, s.seq[l.seg])
+	if !ok || r.key != key {
+		return nil, fmt.Errorf("kvstore: record for %q at segment %d offset %d is corrupt", key, l.seg, l.off)
+	}
+	return append([]byte(nil), r.val...), nil
+}
+
+// Len is the number of keys.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.index)
+}
+
+// Keys returns every key, sorted.
+func (s *Store) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.index))
+	for k := range s.index {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Sync writes out every record appended so far.
+func (s *Store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.flush()
+}
+
+// Compact compacts the oldest segment now, whatever is free.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	s.compacting = true
+	defer func() { s.compacting = false }()
+	return s.compactOldest()
+}
+
+// Utilization is the fraction of the log in use that live records fill.
+func (s *Store) Utilization() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	used, live := 0, 0
+	for seg := range s.seq {
+		used += s.used[seg]
+		live += s.live[seg]
+	}
+	if used == 0 {
+		return 0
+	}
+	return float64(live) / float64(used)
+}
+
+// FreeSegments is how many segments hold nothing.
+func (s *Store) FreeSegments() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.freeSegments()
+}
+
+// Stats returns the counts so far.
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Close syncs the store; it can't be used afterwards.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	s.closed = true
+	return s.flush()
+}
@@ -0,0 +1,237 @@
+package kvstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"example.com/operating-systems/fs"
+)
+
+// A record is a header, then the key, then the value:
+//
+//	crc    uint32  CRC-32 of everything after it
+//	seq    uint64  the segment's sequence number
+//	kind   uint8   put or del
+//	keyLen uint16
+//	valLen uint32
+//
+// Carrying the segment's sequence number means what an earlier use of a
+// reused segment left past the end of the log never reads as a record.
+const (
+	recHeader = 19
+	segHeader = 12 // segMagic uint32, seq uint64
+
+	kindPut = 1
+	kindDel = 2
+)
+
+// record is a decoded record.
+type record struct {
+	kind byte
+	key  string
+	val  []byte
+	size int // bytes in the log
+}
+
+// encode appends the record for kind, key and val in segment seq to b.
+func encode(b []byte, seq uint64, kind byte, key string, val []byte) []byte {
+	start := len(b)
+	b = append(b, make([]byte, recHeader)...)
+	h := b[start:]
+	binary.LittleEndian.PutUint64(h[4:], seq)
+	h[12] = kind
+	binary.LittleEndian.PutUint16(h[13:], uint16(len(key)))
+	binary.LittleEndian.PutUint32(h[15:], uint32(len(val)))
+	b = append(b, key...)
+	b = append(b, val...)
+	binary.LittleEndian.PutUint32(b[start:], crc32.ChecksumIEEE(b[start+4:]))
+	return b
+}
+
+// decode reads the record at the start of b, a segment's bytes from
+// some offset on, reporting false at the end of the log: too few bytes
+// left, a bad CRC, another segment use's sequence number, or a kind
+// that isn't one.
+func decode(b []byte, seq uint64) (record, bool) {
+	if len(b) < recHeader {
+		return record{}, false
+	}
+	kind := b[12]
+	klen := int(binary.LittleEndian.Uint16(b[13:]))
+	vlen := int(binary.LittleEndian.Uint32(b[15:]))
+	size := recHeader + klen + vlen
+	if kind != kindPut && kind != kindDel || size > len(b) || binary.LittleEndian.Uint64(b[4:]) != seq {
+		return record{}, false
+	}
+	if crc32.ChecksumIEEE(b[4:size]) != binary.LittleEndian.Uint32(b) {
+		return record{}, false
+	}
+	return record{
+		kind: kind,
+		key:  string(b[recHeader : recHeader+klen]),
+		val:  b[recHeader+klen : size],
+		size: size,
+	}, true
+}
+
+// readBlock reads block n of dev as exactly BlockSize bytes; a raid.Disk
+// block past the end of its file reads short, as zeros.
+func readBlock(dev fs.Device, n int) ([]byte, error) {
+	data, err := dev.ReadBlock(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(data) < BlockSize {
+		data = append(data, make([]byte, BlockSize-len(data))...)
+	}
+	return data[:BlockSize], nil
+}
+
+// readSegment reads segment s's blocks from first to last, inclusive.
+func (s *Store) readSegment(seg, first, last int) ([]byte, error) {
+	out := make([]byte, 0, (last-first+1)*BlockSize)
+	for b := first; b <= last; b++ {
+		data, err := readBlock(s.dev, s.geo.segStart(seg)+b)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+// flush writes the head segment's blocks from the first not wholly on
+// disk through the last with anything in it.
+func (s *Store) flush() error {
+	if s.pending == 0 && s.written == len(s.buf) {
+		return nil
+	}
+	first, last := s.written/BlockSize, (len(s.buf)-1)/BlockSize
+	for b := first; b <= last; b++ {
+		block := make([]byte, BlockSize)
+		copy(block, s.buf[b*BlockSize:])
+		if err := s.dev.WriteBlock(s.geo.segStart(s.head)+b, block); err != nil {
+			return err
+		}
+		s.stats.BlockWrites++
+	}
+	s.stats.Flushes++
+	s.written, s.pending = len(s.buf), 0
+	return nil
+}
+
+// append adds a record to the head segment, starting a new one if it
+// doesn't fit, and returns where it went.
+func (s *Store) append(kind byte, key string, val []byte) (loc, error) {
+	size := recHeader + len(key) + len(val)
+	if segHeader+size > s.geo.SegBlocks*BlockSize {
+		return loc{}, ErrTooLarge
+	}
+	if len(s.buf)+size > s.geo.SegBlocks*BlockSize {
+		if err := s.roll(); err != nil {
+			return loc{}, err
+		}
+	}
+	l := loc{seg: s.head, off: len(s.buf), size: size}
+	s.buf = encode(s.buf, s.seq[s.head], kind, key, val)
+	s.used[s.head] += size
+	s.pending++
+	return l, nil
+}
+
+// roll seals the head segment and starts the next in a free one, then
+// compacts if too few are left free; compaction copies into the new
+// head, so there is always room for what it copies.
+func (s *Store) roll() error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	next := -1
+	for seg := range s.seq {
+		if s.seq[seg] == 0 {
+			next = seg
+			break
+		}
+	}
+	if next < 0 {
+		return ErrFull
+	}
+	s.lastSeq++
+	s.start(next, s.lastSeq)
+	if s.compacting {
+		return nil
+	}
+	s.compacting = true
+	defer func() { s.compacting = false }()
+	// Each compaction frees the oldest segment, so going round them all
+	// once is as far as it can get.
+	for tries := len(s.order) - 1; s.freeSegments() < s.cfg.Low && tries > 0; tries-- {
+		if err := s.compactOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// start makes seg the head segment, empty, as sequence number seq.
+func (s *Store) start(seg int, seq uint64) {
+	s.head, s.seq[seg], s.used[seg], s.live[seg] = seg, seq, segHeader, 0
+	s.order = append(s.order, seg)
+	s.buf = make([]byte, segHeader, s.geo.SegBlocks*BlockSize)
+	binary.LittleEndian.PutUint32(s.buf, segMagic)
+	binary.LittleEndian.PutUint64(s.buf[4:], seq)
+	s.written, s.pending = 0, 1 // the header, even with no records yet
+}
+
+// compactOldest copies the oldest segment's live records to the head of
+// the log, writes them out, and frees it. Its deletions are dropped:
+// there's no older segment left for the key to come back from.
+func (s *Store) compactOldest() error {
+	victim := s.order[0]
+	if victim == s.head {
+		return nil
+	}
+	data, err := s.readSegment(victim, 0, s.geo.SegBlocks-1)
+	if err != nil {
+		return err
+	}
+	for off := segHeader; ; {
+		r, ok := decode(data[off:], s.seq[victim])
+		if !ok {
+			break
+		}
+		if r.kind == kindPut && s.index[r.key] == (loc{victim, off, r.size}) {
+			l, err := s.append(kindPut, r.key, r.val)
+			if err != nil {
+				return err
+			}
+			s.apply(kindPut, r.key, l)
+			s.stats.Copied += int64(r.size)
+		}
+		off += r.size
+	}
+	if err := s.flush(); err != nil {
+		return err
+	}
+	// Only once the copies are on disk may the segment go.
+	if err := s.dev.WriteBlock(s.geo.segStart(victim), make([]byte, BlockSize)); err != nil {
+		return err
+	}
+	s.stats.BlockWrites++
+	s.stats.Compactions++
+	s.seq[victim], s.used[victim], s.live[victim] = 0, 0, 0
+	s.order = s.order[1:]
+	return nil
+}
+
+func (s *Store) freeSegments() int {
+	n := 0
+	for _, q := range s.seq {
+		if q == 0 {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,142 @@
+// Arena allocator demo and benchmark
+// Shows the LIFO rules of the stack-backed arena (HW0/Q2/arena), then
+// times short-lived allocations: batches of -objs blocks of -size bytes
+// that die together, taken from the arena between a Mark and a Release,
+// versus make() on the Go heap with the GC cleaning up after them.
+//
+//	go run ./HW0/Q2/arenabench -iters 200000 -objs 16 -size 64
+package arenabench
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"example.com/operating-systems/HW0/Q2/arena"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("arenabench")
+
+// sink keeps the make() blocks reachable so they really go to the heap.
+var sink [][]byte
+
+func demo() error {
+	a := arena.New(1024)
+	x, _ := a.Alloc(10)
+	y, _ := a.Alloc(20)
+	fmt.Printf("alloc 10, alloc 20: live=%d used=%d bytes\n", a.Live(), a.Used())
+
+	if err := a.Free(x); errors.Is(err, arena.ErrNotTop) {
+		fmt.Println("free the first block first:", err)
+	}
+	if err := a.Free(y); err != nil {
+		return err
+	}
+	fmt.Printf("free the 20-byte block: live=%d used=%d bytes\n", a.Live(), a.Used())
+
+	m := a.Mark()
+	for i := 0; i < 5; i++ {
+		if _, err := a.Alloc(100); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("mark, then 5 x alloc 100: live=%d used=%d bytes\n", a.Live(), a.Used())
+	if err := a.Release(m); err != nil {
+		return err
+	}
+	fmt.Printf("release to the mark: live=%d used=%d bytes\n", a.Live(), a.Used())
+
+	if _, err := a.Alloc(2000); errors.Is(err, arena.ErrOutOfMemory) {
+		fmt.Println("alloc 2000 from a 1024-byte arena:", err)
+	}
+	return a.Free(x)
+}
+
+// measurement is one benchmark run.
+type measurement struct {
+	elapsed   time.Duration
+	gcCycles  uint32
+	gcPause   time.Duration
+	heapBytes uint64
+}
+
+// measure runs fn and reports its time and what the GC did meanwhile.
+func measure(fn func()) measurement {
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	fn()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return measurement{
+		elapsed:   elapsed,
+		gcCycles:  after.NumGC - before.NumGC,
+		gcPause:   time.Duration(after.PauseTotalNs - before.PauseTotalNs),
+		heapBytes: after.TotalAlloc - before.TotalAlloc,
+	}
+}
+
+func Main(args []string) {
+	var (
+		iters  = cmdline.Int("iters", 200000, "batches of short-lived objects")
+		objs   = cmdline.Int("objs", 16, "objects allocated (and freed together) per batch")
+		size   = cmdline.Int("size", 64, "bytes per object")
+		trials = cmdline.Int("trials", 3, "benchmark trials per allocator")
+	)
+	defer labs.ParseBench(cmdline, args)()
+	*objs, *size = max(*objs, 1), max(*size, 1)
+
+	fmt.Println("Demo:")
+	if err := demo(); err != nil {
+		fmt.Fprintln(os.Stderr, "demo:", err)
+		os.Exit(1)
+	}
+
+	a := arena.New(*objs * (*size + 8))
+	sink = make([][]byte, *objs)
+	var check byte // read back from every block so neither loop is optimized away
+
+	runArena := func() {
+		for i := 0; i < *iters; i++ {
+			m := a.Mark()
+			for j := 0; j < *objs; j++ {
+				b, err := a.Alloc(*size)
+				if err != nil {
+					panic(err) // the arena is sized for one batch
+				}
+				b[0] = byte(j)
+				check ^= b[0]
+			}
+			_ = a.Release(m)
+		}
+	}
+	runMake := func() {
+		for i := 0; i < *iters; i++ {
+			for j := 0; j < *objs; j++ {
+				b := make([]byte, *size)
+				b[0] = byte(j)
+				check ^= b[0]
+				sink[j] = b
+			}
+		}
+	}
+
+	total := *iters * *objs
+	fmt.Printf("\nBenchmark: %d batches x %d objects x %d bytes (%d allocations per trial)\n", *iters, *objs, *size, total)
+	for _, alloc := range []struct {
+		name string
+		fn   func()
+	}{{"arena", runArena}, {"make", runMake}} {
+		for t := 1; t <= *trials; t++ {
+			r := measure(alloc.fn)
+			fmt.Printf("%-5s trial %d: %v  %.1f ns/alloc  %.2f M allocs/sec  gc=%d pause=%v heap=%.1f MB\n",
+				alloc.name, t, r.elapsed, float64(r.elapsed.Nanoseconds())/float64(total),
+				float64(total)/r.elapsed.Seconds()/1e6, r.gcCycles, r.gcPause, float64(r.heapBytes)/1e6)
+		}
+	}
+	_ = check
+}
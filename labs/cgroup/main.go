@@ -0,0 +1,140 @@
+// CPU shares and quotas for goroutine groups
+// Runs -tasks CPU-bound tasks in each group of -groups under a
+// cgroup.Executor for -dur. Each task burns CPU in -chunk pieces and
+// calls Check between them. The table compares each group's entitlement
+// (its share of -cpus cores by weight, capped by its quota) with the
+// CPU it really got, and gives the cpu.stat counters: periods busy,
+// periods throttled and time throttled. With -late, the last group only
+// starts halfway through, so the others split its cores in the first
+// half: shares are work-conserving, quotas are not.
+//
+//	go run ./cmd/cgroup
+//	go run ./cmd/cgroup -groups batch:256,web:1024,capped:1024:0.2 -dur 3s
+//	go run ./cmd/cgroup -groups a:1024,b:1024 -late -chunk 2ms
+package cgroup
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/cgroup"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("cgroup")
+
+func Main(args []string) {
+	cfg := cgroup.DefaultConfig
+	var (
+		groups = cmdline.String("groups", "a:1024,b:512,c:1024:0.1", "comma-separated groups, name:shares[:quota]")
+		tasks  = cmdline.Int("tasks", 2, "tasks per group")
+		dur    = cmdline.Duration("dur", 2*time.Second, "how long to run")
+		chunk  = cmdline.Duration("chunk", 200*time.Microsecond, "CPU burnt between checkpoints")
+		late   = cmdline.Bool("late", false, "start the last group halfway through")
+	)
+	cmdline.IntVar(&cfg.CPUs, "cpus", cfg.CPUs, "cores the executor runs tasks on")
+	cmdline.DurationVar(&cfg.Period, "period", cfg.Period, "token bucket refill period")
+	cmdline.Parse(args)
+	var gs []cgroup.Group
+	for _, s := range strings.Split(*groups, ",") {
+		g, err := cgroup.ParseGroup(s)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		gs = append(gs, g)
+	}
+	e, err := cgroup.New(cfg, gs...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	spins := calibrate(*chunk)
+	task := func(cp *cgroup.Checkpoint) {
+		for cp.Check() {
+			burn(spins)
+		}
+	}
+	start := func(g cgroup.Group) {
+		for i := 0; i < *tasks; i++ {
+			if err := e.Go(g.Name, task); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+	}
+	first := gs
+	if *late {
+		first = gs[:len(gs)-1]
+	}
+	for _, g := range first {
+		start(g)
+	}
+	began := time.Now()
+	if *late {
+		time.Sleep(*dur / 2)
+		start(gs[len(gs)-1])
+		time.Sleep(*dur - *dur/2)
+	} else {
+		time.Sleep(*dur)
+	}
+	e.Close()
+	elapsed := time.Since(began)
+
+	fmt.Printf("%d cores, period %v, %d tasks per group, %v, checkpoint every %v\n\n", cfg.CPUs, cfg.Period, *tasks, elapsed.Round(time.Millisecond), *chunk)
+	fmt.Printf("%-10s %6s %6s %9s %9s %8s %9s %10s\n", "group", "shares", "quota", "entitled", "used", "periods", "throttled", "thr. time")
+	var total time.Duration
+	for i, st := range e.Stats() {
+		total += st.Usage
+		quota := "-"
+		if gs[i].Quota > 0 {
+			quota = fmt.Sprintf("%.2f", gs[i].Quota)
+		}
+		fmt.Printf("%-10s %6d %6s %9.2f %9.2f %8d %9d %10v\n", st.Group, gs[i].Shares, quota, entitled(cfg.CPUs, *tasks, gs)[i],
+			float64(st.Usage)/float64(elapsed), st.Periods, st.Throttled, st.ThrottledTime.Round(time.Millisecond))
+	}
+	fmt.Printf("%-10s %6s %6s %9s %9.2f\n", "total", "", "", "", float64(total)/float64(elapsed))
+}
+
+// entitled is each group's share of cpus with all of them busy, none
+// using more cores than it has tasks.
+func entitled(cpus, tasks int, gs []cgroup.Group) []float64 {
+	caps := append([]cgroup.Group(nil), gs...)
+	for i := range caps {
+		if caps[i].Quota == 0 || caps[i].Quota > float64(tasks) {
+			caps[i].Quota = float64(tasks)
+		}
+	}
+	return cgroup.Entitled(float64(cpus), caps)
+}
+
+// spinSink keeps the busy loop from being optimized away.
+var spinSink atomic.Uint64
+
+// burn spins for n iterations of an xorshift loop.
+func burn(n int) {
+	x := uint64(1469598103934665603)
+	for i := 0; i < n; i++ {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+	}
+	spinSink.Add(x & 1)
+}
+
+// calibrate returns how many burn iterations take about d.
+func calibrate(d time.Duration) int {
+	n := 1 << 10
+	for {
+		start := time.Now()
+		burn(n)
+		if took := time.Since(start); took >= 20*time.Millisecond {
+			return max(int(float64(n)*float64(d)/float64(took)), 1)
+		}
+		n *= 2
+	}
+}
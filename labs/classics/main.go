@@ -0,0 +1,96 @@
+// Classic synchronization problems
+// Runs the sleeping barber, cigarette smokers and H2O problems of package
+// classics with each implementation (channels, and the semaphores and
+// condition variables of package locks), checks every run, and compares
+// their throughput. -runs repeats each, keeping the fastest time; any
+// failed check is listed and makes the exit status 1.
+//
+//	go run ./cmd/classics
+//	go run ./cmd/classics -problems barber -customers 2000 -chairs 1 -arrive 100us
+//	go run ./cmd/classics -impls semaphores -molecules 100000 -runs 5
+package classics
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/classics"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("classics")
+
+func Main(args []string) {
+	b, s, h := classics.DefaultBarber, classics.DefaultSmokers, classics.DefaultH2O
+	var (
+		problems = cmdline.String("problems", "barber,smokers,h2o", "comma-separated problems: barber | smokers | h2o")
+		impls    = cmdline.String("impls", "channels,semaphores", "comma-separated implementations: channels | semaphores")
+		runs     = cmdline.Int("runs", 1, "runs of each, keeping the fastest")
+		seed     = cmdline.Int64("seed", 1, "random seed")
+	)
+	cmdline.IntVar(&b.Customers, "customers", b.Customers, "barber: customers")
+	cmdline.IntVar(&b.Chairs, "chairs", b.Chairs, "barber: waiting room chairs")
+	cmdline.DurationVar(&b.Cut, "cut", b.Cut, "barber: time per haircut")
+	cmdline.DurationVar(&b.Arrive, "arrive", b.Arrive, "barber: mean time between arrivals")
+	cmdline.IntVar(&s.Rounds, "rounds", s.Rounds, "smokers: rounds the agent puts out ingredients")
+	cmdline.IntVar(&h.Molecules, "molecules", h.Molecules, "h2o: molecules to make")
+	cmdline.Parse(args)
+	b.Seed, s.Seed, h.Seed = *seed, *seed, *seed
+
+	var rows []classics.Result
+	failed := false
+	for _, p := range strings.Split(*problems, ",") {
+		p = strings.TrimSpace(p)
+		for _, name := range strings.Split(*impls, ",") {
+			impl, err := classics.ParseImpl(name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			var best classics.Result
+			for i := 0; i < max(1, *runs); i++ {
+				var r classics.Result
+				switch p {
+				case "barber":
+					r, err = classics.Barber(impl, b)
+				case "smokers":
+					r, err = classics.Smokers(impl, s)
+				case "h2o":
+					r, err = classics.H2O(impl, h)
+				default:
+					err = fmt.Errorf("unknown problem %q (barber, smokers, h2o)", p)
+				}
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				if i == 0 || !r.OK() || best.OK() && r.Elapsed < best.Elapsed {
+					best = r
+				}
+			}
+			status := "ok"
+			if !best.OK() {
+				status, failed = "FAILED", true
+			}
+			fmt.Printf("%-8s %-10s %s: %s\n", best.Problem, best.Impl, status, best.Notes)
+			for _, v := range best.Violations {
+				fmt.Printf("    %s\n", v)
+			}
+			rows = append(rows, best)
+		}
+	}
+
+	fmt.Printf("\n%-8s %-10s %8s %12s %12s %7s\n", "problem", "impl", "ops", "elapsed", "ops/s", "checks")
+	for _, r := range rows {
+		status := "ok"
+		if !r.OK() {
+			status = "FAILED"
+		}
+		fmt.Printf("%-8s %-10s %8d %12v %12.0f %7s\n", r.Problem, r.Impl, r.Ops, r.Elapsed.Round(time.Microsecond), r.PerSec(), status)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,134 @@
+// Benchmark run comparison
+// Compares two benchmark runs recorded with -record (package results):
+// every metric both runs measured, base to head, with its change, and
+// REGRESSION beside any that got worse by more than -threshold. Settings
+// that differ between the runs are listed first, since a changed flag
+// explains a changed number. BASE and HEAD are run numbers among the
+// runs of -bench as -list numbers them, negative counting back from the
+// last; by default HEAD is the last run and BASE the one before it, and
+// -bench is the benchmark of the last run in the file. The exit status
+// is 1 if anything regressed, so a script can check a change.
+//
+//	go run ./HW4 -q ms -dur 1s -runs 3 -record results.jsonl
+//	go run ./cmd/compare -file results.jsonl -list
+//	go run ./cmd/compare -file results.jsonl -threshold 0.1
+//	go run ./cmd/compare -file results.jsonl -bench queues 1 -1
+package compare
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/results"
+)
+
+var cmdline = labs.FlagSet("compare")
+
+func Main(args []string) {
+	var (
+		file      = cmdline.String("file", "results.jsonl", "results store to read")
+		bench     = cmdline.String("bench", "", "benchmark whose runs to compare (default: that of the last run)")
+		threshold = cmdline.Float64("threshold", 0.05, "flag metrics that got worse by more than this fraction")
+		list      = cmdline.Bool("list", false, "list the runs instead")
+	)
+	cmdline.Parse(args)
+	runs, err := results.Load(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "compare:", err)
+		os.Exit(1)
+	}
+	if *list {
+		listRuns(runs, *bench)
+		return
+	}
+	if len(runs) == 0 {
+		fmt.Fprintf(os.Stderr, "compare: %s has no runs\n", *file)
+		os.Exit(1)
+	}
+	if *bench == "" {
+		*bench = runs[len(runs)-1].Bench
+	}
+	nums := []int{-2, -1}
+	if cmdline.NArg() > 2 {
+		fmt.Fprintln(os.Stderr, "compare: at most two runs: BASE HEAD")
+		os.Exit(2)
+	}
+	for i, a := range cmdline.Args() {
+		n, err := strconv.Atoi(a)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "compare: bad run number %q\n", a)
+			os.Exit(2)
+		}
+		nums[i] = n
+	}
+	var picked [2]int
+	for i, n := range nums {
+		if picked[i], err = results.Pick(runs, *bench, n); err != nil {
+			fmt.Fprintf(os.Stderr, "compare: %s has no run %d of %s (see -list)\n", *file, n, *bench)
+			os.Exit(1)
+		}
+	}
+	base, head := runs[picked[0]], runs[picked[1]]
+	if regressed := report(base, head, *threshold); regressed > 0 {
+		fmt.Printf("\n%d regressions beyond %.1f%%\n", regressed, 100**threshold)
+		os.Exit(1)
+	}
+}
+
+// listRuns prints the runs of bench (or all), numbered as Pick numbers them.
+func listRuns(runs []results.Run, bench string) {
+	count := map[string]int{}
+	fmt.Printf("%4s  %-12s %-20s %-20s %7s  %s\n", "run", "bench", "time", "rev", "metrics", "host")
+	for _, r := range runs {
+		count[r.Bench]++
+		if bench != "" && r.Bench != bench {
+			continue
+		}
+		fmt.Printf("%4d  %-12s %-20s %-20s %7d  %s\n", count[r.Bench], r.Bench,
+			r.Time.Local().Format("2006-01-02 15:04:05"), r.Rev, len(r.Metrics), r.Host)
+	}
+}
+
+// report prints the comparison and returns how many metrics regressed.
+func report(base, head results.Run, threshold float64) int {
+	for _, x := range []struct {
+		label string
+		r     results.Run
+	}{{"base", base}, {"head", head}} {
+		fmt.Printf("%s: %s at %s, rev %s, on %s\n", x.label, x.r.Bench,
+			x.r.Time.Local().Format("2006-01-02 15:04:05"), x.r.Rev, x.r.Host)
+	}
+	if base.Host != head.Host {
+		fmt.Println("warning: the runs are from different hosts")
+	}
+	if diff := results.ConfigDiff(base, head); len(diff) > 0 {
+		fmt.Printf("settings changed:\n  %s\n", strings.Join(diff, "\n  "))
+	}
+	fmt.Println()
+
+	deltas := results.Compare(base, head, threshold)
+	width := len("metric")
+	for _, d := range deltas {
+		width = max(width, len(d.Metric))
+	}
+	fmt.Printf("%-*s %14s %14s %9s\n", width, "metric", "base", "head", "change")
+	regressed := 0
+	for _, d := range deltas {
+		flag := ""
+		if d.Regression {
+			flag = "  REGRESSION"
+			regressed++
+		}
+		fmt.Printf("%-*s %14s %14s %+8.1f%%%s\n", width, d.Metric, results.Format(d.Base, d.Unit), results.Format(d.Head, d.Unit), 100*d.Change, flag)
+	}
+	for _, name := range results.Only(base, head) {
+		fmt.Printf("%-*s only in base\n", width, name)
+	}
+	for _, name := range results.Only(head, base) {
+		fmt.Printf("%-*s only in head\n", width, name)
+	}
+	return regressed
+}
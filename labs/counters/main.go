@@ -0,0 +1,175 @@
+// Counter scalability vs accuracy
+// Runs each counter design of package counters with N goroutines adding
+// 1 -n times each, at every -thresholds value for the approximate ones,
+// and reports throughput against accuracy. While they run, a reader
+// samples Value every -sample and compares it with the true count (each
+// goroutine publishes its progress on its own cache line), giving the
+// mean and worst lag a reader saw; "held" is what was still held
+// locally when the goroutines finished, before they flushed. The exact
+// designs never lag and scale worst; the larger the threshold, the
+// faster the approximate ones and the further behind.
+//
+//	go run ./cmd/counters
+//	go run ./cmd/counters -goroutines 1,4,16 -thresholds 1,64,4096 -n 2000000
+//	go run ./cmd/counters -kinds sloppy,local -goroutines 8
+package counters
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/cacheline"
+	"example.com/operating-systems/counters"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("counters")
+
+// result is one run.
+type result struct {
+	elapsed           time.Duration
+	meanLag, worstLag float64
+	held              int64
+	samples           int
+}
+
+func Main(args []string) {
+	var (
+		kinds  = cmdline.String("kinds", "atomic,mutex,sloppy,local", "comma-separated designs: atomic | mutex | sloppy | local")
+		gs     = cmdline.String("goroutines", "1,2,4,8", "comma-separated goroutine counts")
+		ths    = cmdline.String("thresholds", "16,1024", "comma-separated thresholds for sloppy and local")
+		n      = cmdline.Int("n", 1000000, "adds per goroutine")
+		sample = cmdline.Duration("sample", 100*time.Microsecond, "how often the reader samples Value")
+	)
+	defer labs.ParseBench(cmdline, args)()
+	var ks []counters.Kind
+	for _, s := range strings.Split(*kinds, ",") {
+		k, err := counters.ParseKind(s)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		ks = append(ks, k)
+	}
+	counts, err := ints(*gs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "counters: -goroutines:", err)
+		os.Exit(2)
+	}
+	thresholds, err := ints(*ths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "counters: -thresholds:", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("%d CPUs, %d adds per goroutine\n\n", runtime.NumCPU(), *n)
+	fmt.Printf("%4s %-8s %9s %10s %10s %12s %12s %10s\n", "g", "design", "threshold", "Mops/s", "slack", "mean lag", "worst lag", "held")
+	for _, g := range counts {
+		for _, k := range ks {
+			tl := thresholds
+			if k == counters.Atomic || k == counters.Mutex {
+				tl = []int{1}
+			}
+			for _, t := range tl {
+				c, err := counters.New(k, g, int64(t))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(2)
+				}
+				r := run(c, g, *n, *sample)
+				if got, want := c.Value(), int64(g**n); got != want {
+					fmt.Fprintf(os.Stderr, "counters: %v counted %d, want %d\n", k, got, want)
+					os.Exit(1)
+				}
+				th := "-"
+				if k == counters.Sloppy || k == counters.Local {
+					th = strconv.Itoa(t)
+				}
+				fmt.Printf("%4d %-8v %9s %10.1f %10d %12.1f %12.0f %10d\n", g, k, th,
+					float64(g**n)/r.elapsed.Seconds()/1e6, c.Slack(), r.meanLag, r.worstLag, r.held)
+			}
+		}
+	}
+}
+
+// run has g goroutines add 1 to c n times each while a reader samples
+// c.Value against their published progress.
+func run(c counters.Counter, g, n int, every time.Duration) result {
+	progress := make([]cacheline.Counter, g) // adds done, each goroutine's on its own line
+	var wg sync.WaitGroup
+	var done sync.WaitGroup // adds finished, flushes not yet made
+	var finished atomic.Bool
+	flush := make(chan struct{})
+	start := make(chan struct{})
+	for i := 0; i < g; i++ {
+		wg.Add(1)
+		done.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			p := &progress[i]
+			for k := 0; k < n; k++ {
+				c.Add(i, 1)
+				p.Add(1)
+			}
+			done.Done()
+			<-flush
+			c.Flush(i)
+		}()
+	}
+
+	var r result
+	var sum float64
+	sampler := make(chan struct{})
+	go func() {
+		defer close(sampler)
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for !finished.Load() {
+			<-t.C
+			// Value first: the progress read after it can only be
+			// higher than it was then, never lower than the truth.
+			v := c.Value()
+			var truth uint64
+			for i := range progress {
+				truth += progress[i].Load()
+			}
+			lag := float64(int64(truth) - v)
+			sum += lag
+			r.worstLag = max(r.worstLag, lag)
+			r.samples++
+		}
+	}()
+
+	began := time.Now()
+	close(start)
+	done.Wait()
+	r.elapsed = time.Since(began)
+	finished.Store(true)
+	<-sampler
+	r.held = int64(g*n) - c.Value()
+	close(flush)
+	wg.Wait()
+	if r.samples > 0 {
+		r.meanLag = sum / float64(r.samples)
+	}
+	return r
+}
+
+func ints(s string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("bad value %q", f)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
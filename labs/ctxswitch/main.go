@@ -0,0 +1,296 @@
+// Context-switch cost
+// Measures a switch the lmbench way, by ping-pong: two parties pass a
+// token back and forth -n times, so a round trip is two switches, and
+// each side's blocking read hands the CPU to the other. The parties are
+//
+//	process    this binary and a child copy, over two blocking pipes
+//	thread     two goroutines locked to their own OS threads, the same way
+//	goroutine  two goroutines over unbuffered channels, GOMAXPROCS=1
+//	goroutine/N  the same with GOMAXPROCS at its default
+//
+// The process and thread parties are pinned to -cpu (Linux), so every
+// hand-off is a real switch on that CPU rather than a wake-up on another.
+// Passing the token through a pipe costs something too, so the pipe
+// lines are also shown less a write+read pair timed in one thread, which
+// leaves the switch alone. Voluntary context switches from getrusage
+// confirm the switches happened.
+//
+//	go run ./cmd/ctxswitch
+//	go run ./cmd/ctxswitch -n 200000 -cpu 0 -runs 5
+package ctxswitch
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("ctxswitch")
+
+// childArg makes the binary the process party's child.
+const childArg = "-ctxswitch-child"
+
+// result is one party's best run.
+type result struct {
+	name   string
+	rtt    time.Duration // per round trip
+	vcsw   int64         // voluntary switches per round trip
+	pinned bool
+}
+
+func Main(args []string) {
+	if len(args) > 1 && args[0] == childArg {
+		cpu, _ := strconv.Atoi(args[1])
+		child(cpu)
+		return
+	}
+	var (
+		n    = cmdline.Int("n", 50000, "round trips per run")
+		runs = cmdline.Int("runs", 3, "runs per party; the fastest is reported")
+		cpu  = cmdline.Int("cpu", 0, "CPU to pin the process and thread parties to; -1 to not pin")
+	)
+	defer labs.ParseBench(cmdline, args)()
+
+	pair, _, err := best(*runs, func() (time.Duration, int64, error) {
+		return pinned(*cpu, func() (time.Duration, int64, error) { return pipePair(*n) })
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ctxswitch:", err)
+		os.Exit(1)
+	}
+	var results []result
+	for _, p := range []struct {
+		name string
+		run  func() (time.Duration, int64, error)
+	}{
+		{"process", func() (time.Duration, int64, error) {
+			return pinned(*cpu, func() (time.Duration, int64, error) { return processes(*n, *cpu) })
+		}},
+		{"thread", func() (time.Duration, int64, error) {
+			return pinned(*cpu, func() (time.Duration, int64, error) { return threads(*n, *cpu) })
+		}},
+		{"goroutine", func() (time.Duration, int64, error) { return goroutines(*n, 1) }},
+		{"goroutine/N", func() (time.Duration, int64, error) { return goroutines(*n, runtime.NumCPU()) }},
+	} {
+		d, v, err := best(*runs, p.run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ctxswitch: %s: %v\n", p.name, err)
+			os.Exit(1)
+		}
+		results = append(results, result{name: p.name, rtt: d, vcsw: v, pinned: *cpu >= 0 && pinSupported})
+	}
+
+	fmt.Printf("%d round trips, best of %d; a write+read pair on one pipe costs %v\n\n", *n, *runs, pair)
+	fmt.Printf("%-12s %12s %12s %16s %12s\n", "party", "round trip", "ns/switch", "less pipe cost", "vcsw/trip")
+	for _, r := range results {
+		perSwitch := float64(r.rtt.Nanoseconds()) / 2
+		less := "-"
+		if r.name == "process" || r.name == "thread" {
+			less = fmt.Sprintf("%.0f", max(0, perSwitch-float64(pair.Nanoseconds())))
+		}
+		name := r.name
+		if r.pinned && less != "-" {
+			name += "*"
+		}
+		fmt.Printf("%-12s %12v %12.0f %16s %12.2f\n", name, r.rtt, perSwitch, less, float64(r.vcsw)/float64(*n))
+	}
+	if *cpu >= 0 && pinSupported {
+		fmt.Printf("\n* pinned to CPU %d\n", *cpu)
+	}
+}
+
+// best runs f runs times and returns its fastest run.
+func best(runs int, f func() (time.Duration, int64, error)) (time.Duration, int64, error) {
+	var ds []time.Duration
+	var vcsw int64
+	for i := 0; i < max(1, runs); i++ {
+		d, v, err := f()
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(ds) == 0 || d < ds[0] {
+			vcsw = v
+		}
+		ds = append(ds, d)
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	}
+	return ds[0], vcsw, nil
+}
+
+// pinned runs f on a goroutine of its own, locked to its thread and
+// pinned to cpu. The goroutine exits still locked, so the runtime
+// throws the pinned thread away rather than reuse it for other
+// goroutines.
+func pinned(cpu int, f func() (time.Duration, int64, error)) (time.Duration, int64, error) {
+	type ret struct {
+		d   time.Duration
+		v   int64
+		err error
+	}
+	done := make(chan ret)
+	go func() {
+		runtime.LockOSThread()
+		pin(cpu)
+		d, v, err := f()
+		done <- ret{d, v, err}
+	}()
+	r := <-done
+	return r.d, r.v, r.err
+}
+
+// pipePair times a write and a read of one byte on one pipe from one
+// thread: the pipe's cost with no switch in it.
+func pipePair(n int) (time.Duration, int64, error) {
+	r, w, err := blockingPipe()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer r.Close()
+	defer w.Close()
+	buf := []byte{0}
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if _, err := w.Write(buf); err != nil {
+			return 0, 0, err
+		}
+		if _, err := r.Read(buf); err != nil {
+			return 0, 0, err
+		}
+	}
+	return time.Since(start) / time.Duration(n), 0, nil
+}
+
+// processes ping-pongs with a child copy of this binary over its stdin
+// and stdout.
+func processes(n, cpu int) (time.Duration, int64, error) {
+	childIn, in, err := blockingPipe()
+	if err != nil {
+		return 0, 0, err
+	}
+	out, childOut, err := blockingPipe()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer out.Close()
+	cmd := labs.Command(childArg, strconv.Itoa(cpu))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = childIn, childOut, os.Stderr
+	err = cmd.Start()
+	childIn.Close()
+	childOut.Close()
+	if err != nil {
+		in.Close()
+		return 0, 0, err
+	}
+	defer cmd.Wait()
+	defer in.Close()
+
+	buf := []byte{0}
+	// One trip first, so the child's start-up isn't timed.
+	if _, err := in.Write(buf); err != nil {
+		return 0, 0, err
+	}
+	if _, err := io.ReadFull(out, buf); err != nil {
+		return 0, 0, err
+	}
+	before := vcsw()
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if _, err := in.Write(buf); err != nil {
+			return 0, 0, err
+		}
+		if _, err := io.ReadFull(out, buf); err != nil {
+			return 0, 0, err
+		}
+	}
+	el := time.Since(start)
+	return el / time.Duration(n), vcsw() - before, nil
+}
+
+// child echoes each byte from stdin to stdout until stdin closes.
+func child(cpu int) {
+	runtime.LockOSThread()
+	pin(cpu)
+	buf := []byte{0}
+	for {
+		if _, err := os.Stdin.Read(buf); err != nil {
+			return
+		}
+		if _, err := os.Stdout.Write(buf); err != nil {
+			return
+		}
+	}
+}
+
+// threads ping-pongs between two goroutines, each locked to its own OS
+// thread and pinned, over two pipes; this one is run pinned.
+func threads(n, cpu int) (time.Duration, int64, error) {
+	ar, aw, err := blockingPipe()
+	if err != nil {
+		return 0, 0, err
+	}
+	br, bw, err := blockingPipe()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer ar.Close()
+	defer br.Close()
+	ready := make(chan struct{})
+	go func() {
+		runtime.LockOSThread() // and never unlocked, as in pinned
+		pin(cpu)
+		defer bw.Close()
+		close(ready)
+		buf := []byte{0}
+		for {
+			if _, err := ar.Read(buf); err != nil {
+				return
+			}
+			if _, err := bw.Write(buf); err != nil {
+				return
+			}
+		}
+	}()
+	<-ready
+	buf := []byte{0}
+	before := vcsw()
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if _, err := aw.Write(buf); err != nil {
+			return 0, 0, err
+		}
+		if _, err := br.Read(buf); err != nil {
+			return 0, 0, err
+		}
+	}
+	el := time.Since(start)
+	v := vcsw() - before
+	aw.Close()
+	return el / time.Duration(n), v, nil
+}
+
+// goroutines ping-pongs between two goroutines over unbuffered channels
+// with GOMAXPROCS set to procs.
+func goroutines(n, procs int) (time.Duration, int64, error) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+	ping, pong := make(chan struct{}), make(chan struct{})
+	go func() {
+		for range ping {
+			pong <- struct{}{}
+		}
+	}()
+	defer close(ping)
+	before := vcsw()
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		ping <- struct{}{}
+		<-pong
+	}
+	el := time.Since(start)
+	return el / time.Duration(n), vcsw() - before, nil
+}
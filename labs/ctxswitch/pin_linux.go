@@ -0,0 +1,19 @@
+package ctxswitch
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const pinSupported = true
+
+// pin binds the calling thread to cpu with sched_setaffinity(2); a
+// negative cpu leaves it be. The caller should be locked to its thread.
+func pin(cpu int) {
+	if cpu < 0 {
+		return
+	}
+	var mask [1024 / 64]uint64
+	mask[cpu/64%len(mask)] |= 1 << (cpu % 64)
+	syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package ctxswitch
+
+const pinSupported = false
+
+// pin can't bind threads to a CPU here, so the parties run wherever the
+// OS puts them.
+func pin(int) {}
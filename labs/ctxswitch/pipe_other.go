@@ -0,0 +1,8 @@
+//go:build !unix
+
+package ctxswitch
+
+import "os"
+
+// blockingPipe is os.Pipe, which doesn't use the runtime poller here.
+func blockingPipe() (r, w *os.File, err error) { return os.Pipe() }
@@ -0,0 +1,22 @@
+//go:build unix
+
+package ctxswitch
+
+import (
+	"os"
+	"syscall"
+)
+
+// blockingPipe is os.Pipe without the runtime poller: os.Pipe makes its
+// ends non-blocking and parks a reader in the poller, which adds wake-ups
+// of its own, while reads on these ends block in the kernel, as a C
+// program's would.
+func blockingPipe() (r, w *os.File, err error) {
+	var p [2]int
+	if err := syscall.Pipe(p[:]); err != nil {
+		return nil, nil, os.NewSyscallError("pipe", err)
+	}
+	syscall.CloseOnExec(p[0])
+	syscall.CloseOnExec(p[1])
+	return os.NewFile(uintptr(p[0]), "|0"), os.NewFile(uintptr(p[1]), "|1"), nil
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package ctxswitch
+
+import "syscall"
+
+// vcsw is this process's voluntary context switches, from getrusage(2);
+// for the process party, that's the parent's half of them.
+func vcsw() int64 {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return int64(ru.Nvcsw)
+}
@@ -0,0 +1,150 @@
+// Deadlock detector demo
+// Runs scenarios on locks tracked by a locks.Detector and prints the
+// deadlocks it finds in the wait-for graph, with the goroutines, the locks
+// they wait for and hold, and where they locked them; a scenario that
+// doesn't deadlock runs for -timeout and reports nothing.
+//
+//	abba          two goroutines take locks A and B in opposite orders
+//	self          a goroutine locks a lock it already holds
+//	philosophers  -n philosophers take their left fork, then their right
+//	ordered       the same, lower-numbered fork first: no deadlock
+//
+// -lock picks the lock under the tracking: queue (HW2-Q1's), ticket, cas,
+// or sync.Mutex.
+//
+//	go run ./cmd/deadlock
+//	go run ./cmd/deadlock -scenario philosophers -n 8 -lock ticket
+//	go run ./cmd/deadlock -scenario ordered -timeout 1s
+package deadlock
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/locks"
+)
+
+var cmdline = labs.FlagSet("deadlock")
+
+func Main(args []string) {
+	var (
+		scenarios = cmdline.String("scenario", "abba,self,philosophers,ordered", "comma-separated scenarios: abba | self | philosophers | ordered")
+		n         = cmdline.Int("n", 5, "philosophers")
+		kind      = cmdline.String("lock", "queue", "lock under the tracking: queue | ticket | cas | mutex")
+		every     = cmdline.Duration("every", 50*time.Millisecond, "how often the detector checks")
+		timeout   = cmdline.Duration("timeout", 2*time.Second, "how long to wait for a deadlock")
+	)
+	cmdline.Parse(args)
+	newLock, err := lockKind(*kind)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, sc := range strings.Split(*scenarios, ",") {
+		sc = strings.TrimSpace(sc)
+		found := make(chan locks.Deadlock, 1)
+		d := locks.NewDetector(*every, func(dl locks.Deadlock) {
+			select {
+			case found <- dl:
+			default:
+			}
+		})
+		var tracked []*locks.Tracked
+		lock := func(name string) *locks.Tracked {
+			t := d.Wrap(name, newLock())
+			tracked = append(tracked, t)
+			return t
+		}
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		switch sc {
+		case "abba":
+			a, b := lock("A"), lock("B")
+			for _, order := range [][2]*locks.Tracked{{a, b}, {b, a}} {
+				go func(first, second *locks.Tracked) {
+					first.Lock()
+					time.Sleep(10 * time.Millisecond)
+					second.Lock()
+					second.Unlock()
+					first.Unlock()
+				}(order[0], order[1])
+			}
+		case "self":
+			a := lock("A")
+			go func() {
+				a.Lock()
+				a.Lock()
+			}()
+		case "philosophers", "ordered":
+			forks := make([]*locks.Tracked, *n)
+			for i := range forks {
+				forks[i] = lock(fmt.Sprintf("fork%d", i))
+			}
+			for p := 0; p < *n; p++ {
+				first, second := p, (p+1)%*n
+				if sc == "ordered" && second < first {
+					first, second = second, first
+				}
+				wg.Add(1)
+				go func(first, second *locks.Tracked) {
+					defer wg.Done()
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						first.Lock()
+						time.Sleep(time.Millisecond)
+						second.Lock()
+						time.Sleep(time.Millisecond)
+						second.Unlock()
+						first.Unlock()
+					}
+				}(forks[first], forks[second])
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "unknown scenario %q (abba, self, philosophers, ordered)\n", sc)
+			os.Exit(1)
+		}
+
+		start := time.Now()
+		select {
+		case dl := <-found:
+			fmt.Printf("%s: found after %v\n%s\n", sc, time.Since(start).Round(time.Millisecond), dl)
+		case <-time.After(*timeout):
+			fmt.Printf("%s: no deadlock in %v\n", sc, *timeout)
+		}
+		d.Close()
+		// The deadlocked goroutines stay stuck; the others are let go
+		close(stop)
+		if sc == "ordered" {
+			wg.Wait()
+		}
+		for _, t := range tracked {
+			s := t.Stats()
+			fmt.Printf("    %-6s %6d acquisitions, %5.1f%% contended, %v waited\n", t.Name, s.Acquisitions,
+				100*float64(s.Contended)/float64(max(1, s.Acquisitions)), s.Wait.Round(time.Millisecond))
+		}
+		fmt.Println()
+	}
+}
+
+func lockKind(s string) (func() locks.Lock, error) {
+	switch s {
+	case "queue":
+		return func() locks.Lock { return &locks.QueueLock{} }, nil
+	case "ticket":
+		return func() locks.Lock { return &locks.TicketLock{} }, nil
+	case "cas":
+		return func() locks.Lock { return &locks.CASLock{} }, nil
+	case "mutex":
+		return func() locks.Lock { return &sync.Mutex{} }, nil
+	}
+	return nil, fmt.Errorf("unknown lock %q (queue, ticket, cas, mutex)", s)
+}
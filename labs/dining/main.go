@@ -0,0 +1,84 @@
+// Dining philosophers
+// Seats philosophers round a table under each fork-taking strategy of
+// package dining, lets them eat for -duration, and reports meals per
+// second, how evenly the meals were shared, the longest wait for forks,
+// and whether the table deadlocked or livelocked on the way (a watchdog
+// calls it hung after -window with no meals and someone hungry).
+//
+// -reach is the pause between a philosopher's first fork and its second;
+// the longer it is the sooner naive deadlocks, and polite waits as long
+// after putting a fork back.
+//
+//	go run ./cmd/dining
+//	go run ./cmd/dining -n 10 -duration 5s -strategies ordered,waiter,chandy-misra
+//	go run ./cmd/dining -strategies naive -reach 0 -think 0 -eat 0 -v
+package dining
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/operating-systems/dining"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("dining")
+
+func Main(args []string) {
+	c := dining.DefaultConfig
+	var (
+		strategies = cmdline.String("strategies", "naive,ordered,waiter,chandy-misra,polite", "comma-separated strategies: naive | ordered | waiter | chandy-misra | polite")
+		verbose    = cmdline.Bool("v", false, "print each philosopher's meals and fork grabs")
+	)
+	cmdline.IntVar(&c.Philosophers, "n", c.Philosophers, "philosophers")
+	cmdline.DurationVar(&c.Duration, "duration", c.Duration, "how long each strategy runs")
+	cmdline.DurationVar(&c.Think, "think", c.Think, "longest thinking spell")
+	cmdline.DurationVar(&c.Eat, "eat", c.Eat, "longest meal")
+	cmdline.DurationVar(&c.Reach, "reach", c.Reach, "pause between the first fork and the second")
+	cmdline.DurationVar(&c.Window, "window", c.Window, "no meals for this long is a hang")
+	cmdline.Int64Var(&c.Seed, "seed", c.Seed, "random seed")
+	cmdline.Parse(args)
+
+	var results []dining.Result
+	for _, name := range strings.Split(*strategies, ",") {
+		s, err := dining.ParseStrategy(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		r, err := dining.Run(c, s)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%-12s %d meals in %.2fs", s, r.Total(), r.Elapsed.Seconds())
+		switch r.Hang {
+		case dining.Deadlock:
+			fmt.Printf(": DEADLOCK after the last meal at %.3fs, forks held %v\n", r.HangAt.Seconds(), r.Holding)
+		case dining.Livelock:
+			fmt.Printf(": LIVELOCK after the last meal at %.3fs, forks held %v\n", r.HangAt.Seconds(), r.Holding)
+		default:
+			fmt.Println()
+		}
+		if *verbose {
+			for p := range r.Meals {
+				fmt.Printf("    philosopher %d: %d meals, %d fork grabs\n", p, r.Meals[p], r.Grabs[p])
+			}
+		}
+		results = append(results, r)
+	}
+
+	fmt.Printf("\n%-12s %8s %10s %6s %6s %9s %11s %10s %9s\n",
+		"strategy", "meals", "meals/s", "min", "max", "fairness", "grabs/meal", "max wait", "outcome")
+	for _, r := range results {
+		lo, hi := r.Meals[0], r.Meals[0]
+		grabs := 0
+		for p, m := range r.Meals {
+			lo, hi = min(lo, m), max(hi, m)
+			grabs += r.Grabs[p]
+		}
+		fmt.Printf("%-12s %8d %10.1f %6d %6d %9.3f %11.2f %10s %9s\n", r.Strategy, r.Total(), r.MealsPerSec(),
+			lo, hi, r.Fairness(), float64(grabs)/float64(max(1, r.Total())), r.MaxWait.Round(10e3), r.Hang)
+	}
+}
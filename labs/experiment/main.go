@@ -0,0 +1,319 @@
+// Experiment runner
+// Runs every configuration an experiment file describes, one after
+// another, and writes what each run measured to one JSON report, so a
+// whole assignment's results come back with one command. The file is
+// JSON (the standard library has no YAML) and lists experiments: an
+// oslabs subcommand ("bench") or any other program ("command", such as
+// a C homework's binary), the flags every run gets, and a matrix of flag
+// values whose every combination is run "repeat" times. Each run is
+// passed -record, so the metrics the benchmark records land in the
+// report beside its flags, exit status and time; -record also appends
+// them to a results store for oslabs compare. A failed run is reported
+// and the rest still run; the exit status is 1 if any failed.
+//
+// Subcommands run in this binary when it is oslabs; otherwise the
+// runner builds cmd/oslabs first.
+//
+//	go run ./cmd/experiment experiments/assignments.json
+//	go run ./cmd/experiment -n experiments/assignments.json          # list the runs
+//	go run ./cmd/experiment -only queues,lists -o hw.json -record results.jsonl experiments/assignments.json
+package experiment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/results"
+)
+
+var cmdline = labs.FlagSet("experiment")
+
+// Report is what the runner writes: every run, in the order they ran.
+type Report struct {
+	File    string        `json:"file"`
+	Started time.Time     `json:"started"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+	Rev     string        `json:"rev"`
+	Host    results.Host  `json:"host"`
+	Runs    []Run         `json:"runs"`
+	Failed  int           `json:"failed"`
+}
+
+// Run is one run of one configuration of an experiment.
+type Run struct {
+	Experiment string            `json:"experiment"`
+	Bench      string            `json:"bench,omitempty"`
+	Params     map[string]string `json:"params,omitempty"` // the matrix's flags
+	Repeat     int               `json:"repeat"`           // from 1
+	Argv       []string          `json:"argv"`
+	Dir        string            `json:"dir,omitempty"`
+	Elapsed    time.Duration     `json:"elapsed_ns"`
+	Error      string            `json:"error,omitempty"`
+	Log        string            `json:"log,omitempty"`
+
+	// Config is every flag's value, as the benchmark recorded it.
+	Config  map[string]string `json:"config,omitempty"`
+	Metrics []results.Metric  `json:"metrics,omitempty"`
+}
+
+// job is a run still to do.
+type job struct {
+	e      *Experiment
+	params map[string]string
+	repeat int
+}
+
+func Main(args []string) {
+	var (
+		out     = cmdline.String("o", "", "write the report to `file` (default: the experiment file's name with -results.json)")
+		record  = cmdline.String(results.RecordFlag, "", "also append every recorded run to this results store (overrides the file's)")
+		only    = cmdline.String("only", "", "run only these experiments (comma-separated names)")
+		dryRun  = cmdline.Bool("n", false, "print the runs without running them")
+		verbose = cmdline.Bool("v", false, "show each run's output as it runs")
+		logDir  = cmdline.String("logs", "", "save each run's output in `dir`")
+		oslabs  = cmdline.String("oslabs", "", "oslabs binary to run subcommands with (default: this one, or build cmd/oslabs)")
+	)
+	cmdline.Parse(args)
+	if cmdline.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] FILE\n", labs.Prog())
+		os.Exit(2)
+	}
+	path := cmdline.Arg(0)
+	spec, err := Load(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *record == "" {
+		*record = spec.Record
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "-results.json"
+	}
+
+	jobs, err := plan(spec, *only)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *dryRun {
+		for i, j := range jobs {
+			fmt.Printf("%3d  %-12s %s  (run %d)\n", i+1, j.e.Name, strings.Join(j.e.args(j.params), " "), j.repeat)
+		}
+		return
+	}
+
+	tmp, err := os.MkdirTemp("", "experiment")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "experiment:", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(tmp)
+	if *logDir != "" {
+		if err := os.MkdirAll(*logDir, 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, "experiment:", err)
+			os.Exit(1)
+		}
+	}
+	bin, err := oslabsBinary(*oslabs, jobs, tmp)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "experiment:", err)
+		os.Exit(1)
+	}
+
+	rep := Report{File: path, Started: time.Now().UTC().Truncate(time.Second), Rev: results.Revision(), Host: results.CurrentHost()}
+	for i, j := range jobs {
+		fmt.Printf("[%d/%d] %s", i+1, len(jobs), j.e.Name)
+		if len(j.params) > 0 {
+			fmt.Printf(" %s", label(j.params))
+		}
+		if j.e.Repeat > 1 {
+			fmt.Printf(" (run %d)", j.repeat)
+		}
+		fmt.Println()
+		r, recorded := run(j, bin, tmp, i+1, *logDir, *verbose)
+		if r.Error != "" {
+			rep.Failed++
+			fmt.Printf("  FAILED after %v: %s\n", r.Elapsed.Round(time.Millisecond), r.Error)
+		} else {
+			fmt.Printf("  ok in %v\n", r.Elapsed.Round(time.Millisecond))
+		}
+		for _, m := range r.Metrics {
+			fmt.Printf("    %s\n", m)
+		}
+		if *record != "" {
+			for _, rr := range recorded {
+				if err := results.Append(*record, rr); err != nil {
+					fmt.Fprintln(os.Stderr, "experiment: record:", err)
+				}
+			}
+		}
+		rep.Runs = append(rep.Runs, r)
+	}
+	rep.Elapsed = time.Since(rep.Started).Round(time.Millisecond)
+
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err == nil {
+		err = os.WriteFile(*out, append(data, '\n'), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "experiment:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\n%d runs, %d failed, in %v; report in %s\n", len(rep.Runs), rep.Failed, rep.Elapsed, *out)
+	if rep.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// plan lists every run of the experiments named in only (all if only is
+// empty), in file order.
+func plan(spec *Spec, only string) ([]job, error) {
+	want := map[string]bool{}
+	for _, name := range strings.Split(only, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			want[name] = true
+		}
+	}
+	var jobs []job
+	for i := range spec.Experiments {
+		e := &spec.Experiments[i]
+		if len(want) > 0 && !want[e.Name] {
+			continue
+		}
+		delete(want, e.Name)
+		for _, c := range e.Configurations() {
+			for r := 1; r <= e.Repeat; r++ {
+				jobs = append(jobs, job{e: e, params: c, repeat: r})
+			}
+		}
+	}
+	for name := range want {
+		return nil, fmt.Errorf("experiment: no experiment named %q", name)
+	}
+	return jobs, nil
+}
+
+// oslabsBinary returns the oslabs binary to run subcommands with, if any
+// job needs one: path if set, this binary if it is oslabs, or else one
+// built into dir.
+func oslabsBinary(path string, jobs []job, dir string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	need := false
+	for _, j := range jobs {
+		need = need || j.e.Bench != ""
+	}
+	if self, ok := labs.Binary(); !need || ok {
+		return self, nil
+	}
+	bin := filepath.Join(dir, "oslabs")
+	fmt.Println("building cmd/oslabs")
+	cmd := exec.Command("go", "build", "-o", bin, "example.com/operating-systems/cmd/oslabs")
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("building cmd/oslabs: %v", err)
+	}
+	return bin, nil
+}
+
+// run runs job j, the n-th, and returns what it measured and the runs it
+// recorded.
+func run(j job, bin, tmp string, n int, logDir string, verbose bool) (Run, []results.Run) {
+	e := j.e
+	args := e.args(j.params)
+	store := filepath.Join(tmp, fmt.Sprintf("run%d.jsonl", n))
+	if e.records() {
+		args = append([]string{"-" + results.RecordFlag + "=" + store}, args...)
+	}
+	argv := append(append([]string(nil), e.Command...), args...)
+	if e.Bench != "" {
+		argv = append([]string{bin, e.Bench}, args...)
+	}
+	r := Run{Experiment: e.Name, Bench: e.Bench, Params: j.params, Repeat: j.repeat, Argv: argv, Dir: e.Dir}
+
+	ctx := context.Background()
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(e.Timeout))
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = e.Dir
+	if e.Bench != "" && e.Dir == "" {
+		cmd.Dir = filepath.Join(tmp, fmt.Sprintf("run%d", n))
+		if err := os.Mkdir(cmd.Dir, 0o755); err != nil {
+			r.Error = err.Error()
+			return r, nil
+		}
+		defer os.RemoveAll(cmd.Dir)
+	}
+	var output bytes.Buffer
+	var w io.Writer = &output
+	if verbose {
+		w = io.MultiWriter(&output, os.Stdout)
+	}
+	cmd.Stdout, cmd.Stderr = w, w
+
+	start := time.Now()
+	err := cmd.Run()
+	r.Elapsed = time.Since(start)
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %v", time.Duration(e.Timeout))
+	}
+	if err != nil {
+		r.Error = err.Error()
+		if !verbose {
+			fmt.Print(indent(tail(output.String(), 10)))
+		}
+	}
+	if logDir != "" {
+		r.Log = filepath.Join(logDir, fmt.Sprintf("%03d-%s.log", n, strings.ReplaceAll(e.Name, "/", "_")))
+		if err := os.WriteFile(r.Log, output.Bytes(), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, "experiment:", err)
+		}
+	}
+
+	if !e.records() {
+		return r, nil
+	}
+	recorded, err := results.Load(store)
+	if err != nil {
+		if r.Error == "" && errors.Is(err, os.ErrNotExist) {
+			r.Error = "recorded no results (does it take -record?)"
+		}
+		return r, nil
+	}
+	for _, rr := range recorded {
+		r.Config = rr.Config
+		r.Metrics = append(r.Metrics, rr.Metrics...)
+	}
+	return r, recorded
+}
+
+// tail returns the last n lines of s.
+func tail(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func indent(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "    | " + strings.ReplaceAll(s, "\n", "\n    | ") + "\n"
+}
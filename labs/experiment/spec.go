@@ -0,0 +1,186 @@
+package experiment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Spec is an experiment file.
+type Spec struct {
+	// Record, if set, is a results store every recorded run is appended
+	// to as well, for oslabs compare; -record overrides it.
+	Record      string       `json:"record"`
+	Experiments []Experiment `json:"experiments"`
+}
+
+// Experiment is one benchmark and the configurations to run it in.
+type Experiment struct {
+	Name string `json:"name"` // default: Bench, or Command[0]
+
+	// Exactly one of Bench, an oslabs subcommand, and Command, a program
+	// and its first arguments (such as ["go", "run", "."]), says what
+	// to run.
+	Bench   string   `json:"bench"`
+	Command []string `json:"command"`
+
+	// Dir is where to run it, relative to where the runner was started.
+	// By default a Bench runs in a scratch directory of its own, so the
+	// files a benchmark leaves behind don't litter the tree, and a
+	// Command runs where the runner does.
+	Dir string `json:"dir"`
+
+	// Flags go to every run, and Matrix gives the values to try for the
+	// rest: every combination is one configuration. Values are strings,
+	// numbers or booleans, passed as -name=value.
+	Flags  map[string]any   `json:"flags"`
+	Matrix map[string][]any `json:"matrix"`
+	Args   []string         `json:"args"` // after the flags
+
+	Repeat  int      `json:"repeat"`  // runs of each configuration; default 1
+	Timeout Duration `json:"timeout"` // per run; default none
+
+	// Record says whether to pass -record and collect the metrics the
+	// benchmark records; default true. Turn it off for a program without
+	// a -record flag.
+	Record *bool `json:"record"`
+}
+
+// Duration is a time.Duration written as a string ("90s") in the file.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	*d = Duration(v)
+	return err
+}
+
+// Load reads and checks the experiment file at path.
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // so 1000000 stays 1000000, not 1e+06
+	dec.DisallowUnknownFields()
+	var s Spec
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("experiment: %s: %v", path, err)
+	}
+	for i := range s.Experiments {
+		e := &s.Experiments[i]
+		if (e.Bench == "") == (len(e.Command) == 0) {
+			return nil, fmt.Errorf("experiment: %s: experiment %d needs one of bench and command", path, i+1)
+		}
+		if e.Name == "" {
+			e.Name = e.Bench
+			if e.Name == "" {
+				e.Name = e.Command[0]
+			}
+		}
+		if e.Repeat < 0 {
+			return nil, fmt.Errorf("experiment: %s: %s: negative repeat", path, e.Name)
+		}
+		e.Repeat = max(e.Repeat, 1)
+		for k, v := range e.Flags {
+			if _, err := flagValue(v); err != nil {
+				return nil, fmt.Errorf("experiment: %s: %s: flag %s: %v", path, e.Name, k, err)
+			}
+		}
+		for k, vs := range e.Matrix {
+			if len(vs) == 0 {
+				return nil, fmt.Errorf("experiment: %s: %s: matrix %s has no values", path, e.Name, k)
+			}
+			for _, v := range vs {
+				if _, err := flagValue(v); err != nil {
+					return nil, fmt.Errorf("experiment: %s: %s: matrix %s: %v", path, e.Name, k, err)
+				}
+			}
+		}
+	}
+	return &s, nil
+}
+
+// records reports whether e's runs are to record their metrics.
+func (e *Experiment) records() bool { return e.Record == nil || *e.Record }
+
+// flagValue formats a value from the file as a flag's argument.
+func flagValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("%v is not a string, number or boolean", v)
+}
+
+// Configurations returns every combination of e's matrix, each as flag
+// name to value, varying the last flag in name order fastest; with no
+// matrix there is one, empty, configuration.
+func (e *Experiment) Configurations() []map[string]string {
+	names := make([]string, 0, len(e.Matrix))
+	for k := range e.Matrix {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	configs := []map[string]string{{}}
+	for _, k := range names {
+		var next []map[string]string
+		for _, c := range configs {
+			for _, v := range e.Matrix[k] {
+				s, _ := flagValue(v)
+				n := map[string]string{k: s}
+				for ck, cv := range c {
+					n[ck] = cv
+				}
+				next = append(next, n)
+			}
+		}
+		configs = next
+	}
+	return configs
+}
+
+// args returns the arguments for one run of e in config, before any
+// -record: the fixed flags and then the configuration's, each in name
+// order, then e.Args.
+func (e *Experiment) args(config map[string]string) []string {
+	var args []string
+	for _, m := range []map[string]string{stringFlags(e.Flags), config} {
+		names := make([]string, 0, len(m))
+		for k := range m {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			args = append(args, "-"+k+"="+m[k])
+		}
+	}
+	return append(args, e.Args...)
+}
+
+func stringFlags(flags map[string]any) map[string]string {
+	m := make(map[string]string, len(flags))
+	for k, v := range flags {
+		m[k], _ = flagValue(v)
+	}
+	return m
+}
+
+// label describes a configuration as "k=v k=v", in name order.
+func label(config map[string]string) string {
+	parts := make([]string, 0, len(config))
+	for k, v := range config {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
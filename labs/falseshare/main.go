@@ -0,0 +1,154 @@
+// False sharing
+// Each of N goroutines adds 1 to its own counter -n times, the counters
+// laid out three ways:
+//
+//	adjacent  a []atomic.Uint64, eight counters to a cache line, as
+//	          HW4's []Counter puts its workers' counts
+//	padded    a []cacheline.Counter, one counter to a line
+//	local     a local variable per goroutine, stored once at the end
+//
+// No goroutine reads another's counter, yet adjacent runs far slower on
+// several cores: each write takes the line from the core that wrote it
+// last. padded gets most of local's speed back with the counters still
+// shared. -layouts picks which to run (adjacent vs padded toggles the
+// padding), and the table compares each against adjacent. It takes at
+// least two cores to see anything; GOMAXPROCS is the goroutine count.
+//
+//	go run ./cmd/falseshare
+//	go run ./cmd/falseshare -goroutines 2,4,8,16 -n 5000000
+//	go run ./cmd/falseshare -layouts adjacent,padded -goroutines 4
+package falseshare
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/cacheline"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("falseshare")
+
+// layouts run n increments on each of g counters, returning the total.
+var layouts = map[string]func(g, n int) uint64{
+	"adjacent": func(g, n int) uint64 {
+		cs := make([]atomic.Uint64, g)
+		run(g, func(i int) {
+			for k := 0; k < n; k++ {
+				cs[i].Add(1)
+			}
+		})
+		var sum uint64
+		for i := range cs {
+			sum += cs[i].Load()
+		}
+		return sum
+	},
+	"padded": func(g, n int) uint64 {
+		cs := make([]cacheline.Counter, g)
+		run(g, func(i int) {
+			for k := 0; k < n; k++ {
+				cs[i].Add(1)
+			}
+		})
+		var sum uint64
+		for i := range cs {
+			sum += cs[i].Load()
+		}
+		return sum
+	},
+	"local": func(g, n int) uint64 {
+		cs := make([]uint64, g)
+		run(g, func(i int) {
+			var c atomic.Uint64 // atomic like the others, but on this goroutine's stack
+			for k := 0; k < n; k++ {
+				c.Add(1)
+			}
+			cs[i] = c.Load()
+		})
+		var sum uint64
+		for _, c := range cs {
+			sum += c
+		}
+		return sum
+	},
+}
+
+// run runs f(0) to f(g-1) on g goroutines, started together.
+func run(g int, f func(i int)) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < g; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			f(i)
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
+
+func Main(args []string) {
+	var (
+		gs   = cmdline.String("goroutines", "1,2,4,8", "comma-separated goroutine counts")
+		n    = cmdline.Int("n", 2000000, "increments per goroutine")
+		lays = cmdline.String("layouts", "adjacent,padded,local", "comma-separated layouts: adjacent | padded | local")
+		runs = cmdline.Int("runs", 3, "runs per point; the fastest is reported")
+	)
+	defer labs.ParseBench(cmdline, args)()
+	var counts []int
+	for _, s := range strings.Split(*gs, ",") {
+		g, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || g < 1 {
+			fmt.Fprintf(os.Stderr, "falseshare: bad goroutine count %q\n", s)
+			os.Exit(2)
+		}
+		counts = append(counts, g)
+	}
+	var names []string
+	for _, s := range strings.Split(*lays, ",") {
+		s = strings.TrimSpace(s)
+		if layouts[s] == nil {
+			fmt.Fprintf(os.Stderr, "falseshare: unknown layout %q (adjacent, padded, local)\n", s)
+			os.Exit(2)
+		}
+		names = append(names, s)
+	}
+
+	fmt.Printf("%d CPUs, cache line %d bytes, %d increments per goroutine\n\n", runtime.NumCPU(), cacheline.Size, *n)
+	fmt.Printf("%10s %-9s %12s %10s %12s\n", "goroutines", "layout", "Mops/s", "ns/op", "vs adjacent")
+	for _, g := range counts {
+		prev := runtime.GOMAXPROCS(g)
+		base := 0.0
+		for _, name := range names {
+			var best time.Duration
+			for r := 0; r < max(1, *runs); r++ {
+				start := time.Now()
+				if got := layouts[name](g, *n); got != uint64(g**n) {
+					fmt.Fprintf(os.Stderr, "falseshare: %s counted %d, want %d\n", name, got, g**n)
+					os.Exit(1)
+				}
+				if el := time.Since(start); r == 0 || el < best {
+					best = el
+				}
+			}
+			ops := float64(g**n) / best.Seconds()
+			vs := "-"
+			if name == "adjacent" {
+				base = ops
+			} else if base > 0 {
+				vs = fmt.Sprintf("%.1fx", ops/base)
+			}
+			fmt.Printf("%10d %-9s %12.1f %10.2f %12s\n", g, name, ops/1e6, float64(best.Nanoseconds())/float64(*n), vs)
+		}
+		runtime.GOMAXPROCS(prev)
+	}
+}
@@ -0,0 +1,272 @@
+// FFS locality benchmark
+// Ages a file system and then reads every file back, to compare how well
+// each layout keeps related blocks together: the flat vsfs layout with
+// first-free allocation against block groups with FFS's placement
+// heuristics (package fs, group.go).
+//
+// Aging fills the data region to -util with files in -dirs directories,
+// written -streams at a time in -chunk-block appends, as concurrent
+// writers would; then for -churn rounds it deletes a quarter of the files
+// at random and writes new ones back up to -util. Sizes are mostly small
+// with a tail of large files. After a remount, the read phase lists each
+// directory and reads each file whole, in directory order.
+//
+// Reads go through an fs.Cache of -cache blocks, which keeps the
+// directories, inode blocks and indirect blocks the file system rereads
+// at every step. The disk under it counts every block read and the seek
+// before it (a read not of the block after the last one), with the
+// seek's distance. A seek is modeled as -settle ms plus -sweep ms for
+// crossing the whole disk, scaled by distance, and a block transfer as
+// -xfer ms.
+//
+//	go run ./cmd/ffsbench
+//	go run ./cmd/ffsbench -groups 0,4,16,32 -churn 10
+//	go run ./cmd/ffsbench -streams 1 -util 0.3
+package ffsbench
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"example.com/operating-systems/fs"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("ffsbench")
+
+func Main(args []string) {
+	var (
+		groups  = cmdline.String("groups", "0,16", "comma-separated group counts to compare; 0 is the flat layout, first-free")
+		blocks  = cmdline.Int("blocks", 8192, "device blocks")
+		inodes  = cmdline.Int("inodes", 2048, "inodes")
+		dirs    = cmdline.Int("dirs", 16, "directories")
+		util    = cmdline.Float64("util", 0.6, "fraction of the data region to fill")
+		churn   = cmdline.Int("churn", 5, "rounds of deleting a quarter of the files and refilling")
+		streams = cmdline.Int("streams", 4, "files written at once")
+		chunk   = cmdline.Int("chunk", 2, "blocks per append")
+		cache   = cmdline.Int("cache", 64, "buffer cache blocks for the read phase (at least 1)")
+		settle  = cmdline.Float64("settle", 1, "modeled ms per seek, before moving")
+		sweep   = cmdline.Float64("sweep", 10, "modeled ms to seek across the whole disk")
+		xfer    = cmdline.Float64("xfer", 0.05, "modeled ms per block transferred")
+		seed    = cmdline.Int64("seed", 1, "random seed")
+	)
+	defer labs.ParseBench(cmdline, args)()
+
+	gs, err := parseInts(*groups)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	c := cfg{blocks: *blocks, inodes: *inodes, dirs: *dirs, util: *util, churn: *churn,
+		streams: max(1, *streams), chunk: max(1, *chunk), cache: *cache, seed: *seed}
+	var rows []result
+	for _, g := range gs {
+		r, err := run(g, c)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%d groups: %v\n", g, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%-11s %d files in %d blocks (%.0f%% full): read %d blocks with %d seeks\n",
+			r.name, r.files, r.used, 100*r.full, r.reads, r.seeks)
+		rows = append(rows, r)
+	}
+
+	fmt.Printf("\n%-11s %7s %8s %10s %10s %12s %10s\n", "layout", "files", "reads", "seq reads", "seeks/file", "mean seek", "ms/file")
+	for _, r := range rows {
+		ms := float64(r.seeks)**settle + float64(r.distance)/float64(*blocks)**sweep + float64(r.reads)**xfer
+		fmt.Printf("%-11s %7d %8d %9.1f%% %10.2f %6.0f blocks %10.2f\n", r.name, r.files, r.reads,
+			100*float64(r.reads-r.seeks)/float64(r.reads), float64(r.seeks)/float64(r.files),
+			float64(r.distance)/float64(max(1, r.seeks)), ms/float64(r.files))
+	}
+}
+
+// cfg is the workload.
+type cfg struct {
+	blocks, inodes, dirs  int
+	util                  float64
+	churn, streams, chunk int
+	cache                 int
+	seed                  int64
+}
+
+// result is what reading the aged file system back cost.
+type result struct {
+	name                   string
+	files, used            int
+	full                   float64
+	reads, seeks, distance int
+}
+
+// run ages a file system with groups block groups and reads it back.
+func run(groups int, c cfg) (result, error) {
+	r := result{name: "first-free"}
+	if groups > 1 {
+		r.name = fmt.Sprintf("ffs/%d", groups)
+	}
+	dev := &meter{Device: fs.NewMemDevice(c.blocks)}
+	if err := fs.MkfsGroups(dev, c.blocks, c.inodes, 0, groups); err != nil {
+		return r, err
+	}
+	f, err := fs.Mount(dev)
+	if err != nil {
+		return r, err
+	}
+	for d := 0; d < c.dirs; d++ {
+		if err := f.Mkdir(fmt.Sprintf("/d%d", d)); err != nil {
+			return r, err
+		}
+	}
+
+	// Every variant sees the same files: the sizes and names come from
+	// the seed alone
+	rng := rand.New(rand.NewSource(c.seed))
+	var live []string
+	next := 0
+	fill := func() error {
+		var pending []string
+		sizes := map[string]int{}
+		for {
+			s := f.Statfs()
+			if float64(s.Blocks-s.FreeBlocks) >= c.util*float64(s.Blocks) || s.FreeInodes == 0 {
+				break
+			}
+			// Enough files to reach util, written streams at a time
+			p := fmt.Sprintf("/d%d/f%d", rng.Intn(c.dirs), next)
+			next++
+			sizes[p] = size(rng)
+			pending = append(pending, p)
+			if len(pending) < c.streams {
+				continue
+			}
+			if err := write(f, pending, sizes, c.chunk); err != nil {
+				return err
+			}
+			live = append(live, pending...)
+			pending = nil
+		}
+		if err := write(f, pending, sizes, c.chunk); err != nil {
+			return err
+		}
+		live = append(live, pending...)
+		return nil
+	}
+	if err := fill(); err != nil {
+		return r, err
+	}
+	for round := 0; round < c.churn; round++ {
+		rng.Shuffle(len(live), func(i, j int) { live[i], live[j] = live[j], live[i] })
+		for _, p := range live[:len(live)/4] {
+			if err := f.Unlink(p); err != nil {
+				return r, err
+			}
+		}
+		live = live[len(live)/4:]
+		if err := fill(); err != nil {
+			return r, err
+		}
+	}
+	s := f.Statfs()
+	r.files, r.used = len(live), s.Blocks-s.FreeBlocks
+	r.full = float64(r.used) / float64(s.Blocks)
+
+	// Read it all back, from a fresh mount
+	cache, err := fs.NewCache(fs.CacheConfig{Blocks: c.cache})
+	if err != nil {
+		return r, err
+	}
+	if f, err = fs.Mount(cache.Device(dev)); err != nil {
+		return r, err
+	}
+	dev.reads, dev.seeks, dev.distance, dev.last = 0, 0, 0, 0
+	for d := 0; d < c.dirs; d++ {
+		dir := fmt.Sprintf("/d%d", d)
+		ents, err := f.ReadDir(dir)
+		if err != nil {
+			return r, err
+		}
+		for _, e := range ents {
+			if e.Name == "." || e.Name == ".." {
+				continue
+			}
+			if _, err := f.ReadFile(dir + "/" + e.Name); err != nil {
+				return r, err
+			}
+		}
+	}
+	r.reads, r.seeks, r.distance = dev.reads, dev.seeks, dev.distance
+	return r, nil
+}
+
+// size draws a file size in bytes: 70% of files take 1-3 blocks, 25% 4-12,
+// and 5% 13-80.
+func size(rng *rand.Rand) int {
+	var n int
+	switch p := rng.Float64(); {
+	case p < 0.70:
+		n = 1 + rng.Intn(3)
+	case p < 0.95:
+		n = 4 + rng.Intn(9)
+	default:
+		n = 13 + rng.Intn(68)
+	}
+	return n*fs.BlockSize - rng.Intn(fs.BlockSize)
+}
+
+// write creates the files at paths and appends to each in turn, chunk
+// blocks at a time, until each has its size.
+func write(f *fs.FS, paths []string, sizes map[string]int, chunk int) error {
+	for _, p := range paths {
+		if err := f.Create(p); err != nil {
+			return err
+		}
+	}
+	buf := make([]byte, chunk*fs.BlockSize)
+	for off := 0; ; off += len(buf) {
+		done := true
+		for _, p := range paths {
+			if off >= sizes[p] {
+				continue
+			}
+			done = false
+			if _, err := f.WriteAt(p, buf[:min(len(buf), sizes[p]-off)], off); err != nil {
+				return err
+			}
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// meter counts a device's block reads, and a seek, with its distance, for
+// every read that isn't of the block after the last.
+type meter struct {
+	fs.Device
+	last                   int
+	reads, seeks, distance int
+}
+
+func (m *meter) ReadBlock(n int) ([]byte, error) {
+	if n != m.last+1 {
+		m.seeks++
+		m.distance += max(n-m.last, m.last-n)
+	}
+	m.last = n
+	m.reads++
+	return m.Device.ReadBlock(n)
+}
+
+func parseInts(s string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("bad group count %q", f)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
@@ -0,0 +1,211 @@
+// Free-list allocator demo and fragmentation benchmark
+// Shows splitting and coalescing in the free-list allocator
+// (HW0/Q2/freelist), then plays one randomized trace of allocations and
+// frees through every fit policy and compares how they fragment the heap:
+// failed allocations, how full the heap was at the first failure, the
+// external fragmentation, the free-list length, and the search cost.
+//
+//	go run ./HW0/Q2/freelistbench -ops 50000 -heap 64k -min 16 -max 1024
+//	go run ./HW0/Q2/freelistbench -fits best,worst -check
+package freelistbench
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/HW0/Q2/freelist"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("freelistbench")
+
+func demo() error {
+	a := freelist.New(104, freelist.FirstFit)
+	fmt.Println("new 104-byte heap:      ", a)
+	x, _ := a.Alloc(10)
+	y, _ := a.Alloc(20)
+	z, _ := a.Alloc(10)
+	fmt.Println("alloc 10, 20, 10:       ", a)
+	if err := a.Free(y); err != nil {
+		return err
+	}
+	fmt.Println("free the 20 (a hole):   ", a)
+	if err := a.Free(x); err != nil {
+		return err
+	}
+	fmt.Println("free the first 10:      ", a, "(coalesced)")
+	if err := a.Free(z); err != nil {
+		return err
+	}
+	fmt.Println("free the last 10:       ", a)
+	if err := a.Free(z); err != nil {
+		fmt.Println("free it again:          ", err)
+	}
+	if _, err := a.Alloc(200); err != nil {
+		fmt.Println("alloc 200:              ", err)
+	}
+	return a.Check()
+}
+
+// op is one step of a trace: allocate size bytes as block id, or free id.
+type op struct {
+	alloc bool
+	id    int
+	size  int
+}
+
+// genTrace makes n operations: with probability free (and something to
+// free) a random live block is freed, otherwise a new one of min..max
+// bytes is allocated.
+func genTrace(n, lo, hi int, free float64, seed int64) []op {
+	r := rand.New(rand.NewSource(seed))
+	var out []op
+	var live []int
+	for i := 0; i < n; i++ {
+		if len(live) > 0 && r.Float64() < free {
+			k := r.Intn(len(live))
+			out = append(out, op{id: live[k]})
+			live[k] = live[len(live)-1]
+			live = live[:len(live)-1]
+			continue
+		}
+		id := len(out)
+		out = append(out, op{alloc: true, id: id, size: lo + r.Intn(hi-lo+1)})
+		live = append(live, id)
+	}
+	return out
+}
+
+// result is one fit's run of the trace.
+type result struct {
+	fit       freelist.Fit
+	allocs    int
+	failed    int
+	firstFail float64 // share of the heap asked for when the first allocation failed
+	external  float64 // mean over the trace
+	freeBlks  float64 // mean over the trace
+	perSearch float64 // free blocks examined per Alloc
+	elapsed   time.Duration
+}
+
+// run plays trace through a fresh heap of the given size. A failed
+// allocation is skipped, and so is its free.
+func run(fit freelist.Fit, heap int, trace []op, check bool) (result, error) {
+	a := freelist.New(heap, fit)
+	res := result{fit: fit, firstFail: -1}
+	blocks := map[int][]byte{}
+	var ext, nfree float64
+	start := time.Now()
+	for i, o := range trace {
+		if o.alloc {
+			res.allocs++
+			b, err := a.Alloc(o.size)
+			if err != nil {
+				if res.failed == 0 {
+					res.firstFail = float64(a.Stats().Asked) / float64(heap)
+				}
+				res.failed++
+			} else {
+				blocks[o.id] = b
+			}
+		} else if b, ok := blocks[o.id]; ok {
+			if err := a.Free(b); err != nil {
+				return res, fmt.Errorf("op %d: %v", i, err)
+			}
+			delete(blocks, o.id)
+		}
+		if check {
+			if err := a.Check(); err != nil {
+				return res, fmt.Errorf("op %d: %v", i, err)
+			}
+		}
+		s := a.Stats()
+		ext += s.External()
+		nfree += float64(s.FreeBlocks)
+	}
+	res.elapsed = time.Since(start)
+	s := a.Stats()
+	res.external = ext / float64(len(trace))
+	res.freeBlks = nfree / float64(len(trace))
+	if s.Searches > 0 {
+		res.perSearch = float64(s.Examined) / float64(s.Searches)
+	}
+	return res, nil
+}
+
+func Main(args []string) {
+	var (
+		ops   = cmdline.Int("ops", 20000, "operations in the trace")
+		heap  = cmdline.String("heap", "64k", "heap size in bytes (k and m suffixes work)")
+		lo    = cmdline.Int("min", 8, "smallest allocation")
+		hi    = cmdline.Int("max", 512, "largest allocation")
+		free  = cmdline.Float64("free", 0.5, "chance each operation frees a random live block instead of allocating")
+		seed  = cmdline.Int64("seed", 1, "trace seed")
+		fits  = cmdline.String("fits", "first,best,worst,next", "comma-separated fit policies to compare")
+		check = cmdline.Bool("check", false, "verify the heap's invariants after every operation")
+	)
+	defer labs.ParseBench(cmdline, args)()
+	*lo = max(*lo, 1)
+	*hi = max(*hi, *lo)
+	size, err := parseSize(*heap)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bad -heap:", err)
+		os.Exit(2)
+	}
+	var policies []freelist.Fit
+	for _, f := range strings.Split(*fits, ",") {
+		fit, err := freelist.ParseFit(strings.TrimSpace(f))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		policies = append(policies, fit)
+	}
+
+	fmt.Println("Demo:")
+	if err := demo(); err != nil {
+		fmt.Fprintln(os.Stderr, "demo:", err)
+		os.Exit(1)
+	}
+
+	trace := genTrace(max(*ops, 1), *lo, *hi, *free, *seed)
+	fmt.Printf("\nFragmentation: %d operations, %d-%d byte blocks, %.0f%% frees, %d-byte heap\n", len(trace), *lo, *hi, 100**free, size)
+	fmt.Printf("%-6s %8s %12s %10s %12s %12s %10s\n", "fit", "failed", "first fail", "external", "free blocks", "examined", "ns/op")
+	for _, fit := range policies {
+		r, err := run(fit, size, trace, *check)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s fit: %v\n", fit, err)
+			os.Exit(1)
+		}
+		first := "-"
+		if r.firstFail >= 0 {
+			first = fmt.Sprintf("%.1f%% full", 100*r.firstFail)
+		}
+		fmt.Printf("%-6s %7.2f%% %12s %9.1f%% %12.1f %12.1f %10.1f\n", fit, 100*float64(r.failed)/float64(max(r.allocs, 1)), first,
+			100*r.external, r.freeBlks, r.perSearch, float64(r.elapsed.Nanoseconds())/float64(len(trace)))
+	}
+	if *check {
+		fmt.Println("\nheap invariants held after every operation")
+	}
+}
+
+// parseSize parses a byte count with an optional k or m suffix.
+func parseSize(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	mult := 1
+	switch {
+	case strings.HasSuffix(s, "k"):
+		mult, s = 1<<10, s[:len(s)-1]
+	case strings.HasSuffix(s, "m"):
+		mult, s = 1<<20, s[:len(s)-1]
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return v * mult, nil
+}
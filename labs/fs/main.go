@@ -0,0 +1,244 @@
+// Simple file system shell
+// Formats and mounts the vsfs-style file system of package fs on a disk
+// image (a raid.Disk), on a RAID array of disk files, or in memory, and
+// runs commands against it: from the command line, separated by ";", or
+// one per line on stdin.
+//
+//	go run ./cmd/fs -mkfs "mkdir /docs; write /docs/a.txt hello world; ls /docs; cat /docs/a.txt"
+//	go run ./cmd/fs "stat /docs/a.txt; df; dump"          # the same image, fs.img, later
+//	go run ./cmd/fs -raid 5 -disks 4 -mkfs "write /x 123; cat /x"
+//	go run ./cmd/fs -mem -mkfs < script.txt
+//	go run ./cmd/fs -img j.img -mkfs -journal 24 -mode metadata "write /y 42; dump"
+//	go run ./cmd/fs -mem -blocks 256 -groups 4 "mkdir /a; mkdir /b; write /a/x 1; write /b/y 2; dump"
+package fs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"example.com/operating-systems/HW7/raid"
+	"example.com/operating-systems/fs"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("fs")
+
+func Main(args []string) {
+	var (
+		img    = cmdline.String("img", "fs.img", "disk image file (a raid.Disk)")
+		level  = cmdline.Int("raid", -1, "use a RAID array instead: level 0, 1, 4, or 5")
+		disks  = cmdline.Int("disks", 4, "-raid: number of disk files")
+		dir    = cmdline.String("dir", ".", "-raid: directory of the disk files disk0.dat, disk1.dat, ...")
+		mem    = cmdline.Bool("mem", false, "use an in-memory device (implies -mkfs)")
+		mkfs   = cmdline.Bool("mkfs", false, "format the device first")
+		blocks = cmdline.Int("blocks", 64, "-mkfs: blocks in the file system")
+		inodes = cmdline.Int("inodes", 80, "-mkfs: inodes")
+		jsize  = cmdline.Int("journal", 0, "-mkfs: journal blocks (0 for none)")
+		groups = cmdline.Int("groups", 0, "-mkfs: block groups (0 for the flat layout)")
+		mode   = cmdline.String("mode", "none", "journal mode: none, metadata, or all")
+	)
+	cmdline.Parse(args)
+
+	jmode, err := fs.ParseJournalMode(*mode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	dev, err := open(*img, *level, *disks, *dir, *mem, *blocks)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *mkfs || *mem {
+		if err := fs.MkfsGroups(dev, *blocks, *inodes, *jsize, *groups); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	f, err := fs.MountJournal(dev, jmode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	failed := false
+	run := func(line string) {
+		args := strings.Fields(line)
+		if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+			return
+		}
+		if err := command(f, args); err != nil {
+			fmt.Printf("%s: %v\n", args[0], err)
+			failed = true
+		}
+	}
+	if cmdline.NArg() > 0 {
+		for _, line := range strings.Split(strings.Join(cmdline.Args(), " "), ";") {
+			run(line)
+		}
+	} else {
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			run(sc.Text())
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// open returns the device to use.
+func open(img string, level, disks int, dir string, mem bool, blocks int) (fs.Device, error) {
+	if mem {
+		return fs.NewMemDevice(blocks), nil
+	}
+	if level < 0 {
+		return raid.OpenDisk(img)
+	}
+	var ds []*raid.Disk
+	for i := 0; i < disks; i++ {
+		d, err := raid.OpenDisk(filepath.Join(dir, fmt.Sprintf("disk%d.dat", i)))
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	switch {
+	case level == 0:
+		return fs.Array{RAID: raid.NewRAID0(ds)}, nil
+	case level == 1:
+		return fs.Array{RAID: raid.NewRAID1(ds)}, nil
+	case level == 4 && disks >= 2:
+		return fs.Array{RAID: raid.NewRAID4(ds)}, nil
+	case level == 5 && disks >= 3:
+		return fs.Array{RAID: raid.NewRAID5(ds)}, nil
+	}
+	return nil, fmt.Errorf("can't build RAID %d from %d disks (RAID 4 needs 2, RAID 5 needs 3)", level, disks)
+}
+
+// command runs one shell command.
+func command(f *fs.FS, args []string) error {
+	need := func(n int) error {
+		if len(args)-1 < n {
+			return fmt.Errorf("needs %d argument(s)", n)
+		}
+		return nil
+	}
+	switch args[0] {
+	case "mkdir", "touch", "cat", "rm", "rmdir", "stat":
+		if err := need(1); err != nil {
+			return err
+		}
+	case "write", "append", "ln", "truncate":
+		if err := need(2); err != nil {
+			return err
+		}
+	}
+	switch args[0] {
+	case "mkdir":
+		return f.Mkdir(args[1])
+	case "touch":
+		return f.Create(args[1])
+	case "write":
+		return f.WriteFile(args[1], []byte(strings.Join(args[2:], " ")+"\n"))
+	case "append":
+		st, err := f.Stat(args[1])
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteAt(args[1], []byte(strings.Join(args[2:], " ")+"\n"), st.Size)
+		return err
+	case "cat":
+		data, err := f.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case "ls":
+		path := "/"
+		if len(args) > 1 {
+			path = args[1]
+		}
+		ents, err := f.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, e := range ents {
+			ino, err := f.Inode(e.Inode)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%4d %-4s %2d %8d  %s\n", e.Inode, ino.Type, ino.Links, ino.Size, e.Name)
+		}
+	case "rm":
+		return f.Unlink(args[1])
+	case "rmdir":
+		return f.Rmdir(args[1])
+	case "ln":
+		return f.Link(args[1], args[2])
+	case "truncate":
+		n, err := strconv.Atoi(args[2])
+		if err != nil {
+			return err
+		}
+		return f.Truncate(args[1], n)
+	case "stat":
+		st, err := f.Stat(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: inode %d, %s, %d link(s), %d bytes, %d block(s)\n", args[1], st.Inode, st.Type, st.Links, st.Size, st.Blocks)
+	case "df":
+		s := f.Statfs()
+		fmt.Printf("data blocks: %d of %d free (%d bytes each); inodes: %d of %d free\n", s.FreeBlocks, s.Blocks, fs.BlockSize, s.FreeInodes, s.Inodes)
+	case "dump":
+		return dump(f)
+	default:
+		return fmt.Errorf("unknown command (mkdir, touch, write, append, cat, ls, rm, rmdir, ln, truncate, stat, df, dump)")
+	}
+	return nil
+}
+
+// dump prints the layout and every used inode, like vsfs.py's view.
+func dump(f *fs.FS) error {
+	sb := f.Superblock()
+	fmt.Printf("superblock: %d blocks, %d inodes; inode bitmap at %d, data bitmap at %d, ",
+		sb.Blocks, sb.Inodes, sb.InodeBitmap, sb.DataBitmap)
+	if sb.Groups > 1 {
+		fmt.Printf("inode table in %d groups (%d block(s) at the start of each), ", sb.Groups, sb.InodeBlocks/sb.Groups)
+	} else {
+		fmt.Printf("inode table %d-%d, ", sb.InodeTable, sb.InodeTable+sb.InodeBlocks-1)
+	}
+	if sb.JournalSize > 0 {
+		fmt.Printf("journal %d-%d (%s), ", sb.Journal, sb.DataStart-1, f.Mode())
+	}
+	fmt.Printf("data %d-%d\n", sb.DataStart, sb.Blocks-1)
+	for inum := 0; inum < sb.Inodes; inum++ {
+		ino, err := f.Inode(inum)
+		if err != nil {
+			return err
+		}
+		if ino.Type == fs.TypeFree {
+			continue
+		}
+		var ptrs []int
+		for _, b := range ino.Direct {
+			if b != 0 {
+				ptrs = append(ptrs, b)
+			}
+		}
+		fmt.Printf("  inode %3d: %-4s links %d size %d blocks %v", inum, ino.Type, ino.Links, ino.Size, ptrs)
+		if sb.Groups > 1 {
+			fmt.Printf(" group %d", sb.InodeGroup(inum))
+		}
+		if ino.Indirect != 0 {
+			fmt.Printf(" indirect %d", ino.Indirect)
+		}
+		fmt.Println()
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+// File system microbenchmarks
+// Times individual file system operations on each file system variant and
+// each device under it, and reports per-operation latency percentiles:
+//
+//	create     write a new small file (-small bytes) in a two-level tree
+//	lookup     stat a random one of them by path
+//	seqwrite   write a large file (-large bytes) in -io byte pieces, in order
+//	seqread    read it back the same way
+//	randwrite  overwrite -io byte pieces at random offsets
+//	randread   read pieces at random offsets
+//	delete     unlink every small file
+//
+// The variants are the vsfs layout of package fs (plain, with metadata
+// journaling, and in FFS block groups) and the log-structured fs/lfs. The
+// devices are memory, one raid.Disk file, or a RAID array of -disks disk
+// files (each block write to a disk file is synced, as raid.Disk does),
+// made in a temporary directory and removed afterwards.
+//
+// With -cache the runs repeat behind an fs.Cache of each size asked for (0
+// is uncached): an LRU buffer cache with -readahead blocks of read-ahead,
+// write-back unless -writethrough, flushed every -flush and at the end of
+// the run. The final flush is timed and shown with the cache's hit rate.
+//
+//	go run ./cmd/fsbench
+//	go run ./cmd/fsbench -variants vsfs,lfs -devices mem,raid0,raid5 -files 500
+//	go run ./cmd/fsbench -tests create,lookup,delete -small 100
+//	go run ./cmd/fsbench -cache 0,64,1024 -devices disk,raid5 -variants vsfs,ffs
+package fsbench
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/HW7/raid"
+	"example.com/operating-systems/fs"
+	"example.com/operating-systems/fs/lfs"
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/stats"
+)
+
+var cmdline = labs.FlagSet("fsbench")
+
+// fileSystem is what the benchmarks need; fs.FS and lfs.FS both have it.
+type fileSystem interface {
+	Mkdir(path string) error
+	WriteFile(path string, data []byte) error
+	WriteAt(path string, p []byte, off int) (int, error)
+	ReadAt(path string, p []byte, off int) (int, error)
+	Stat(path string) (fs.Stat, error)
+	Unlink(path string) error
+}
+
+var (
+	allVariants = []string{"vsfs", "vsfs-journal", "ffs", "lfs"}
+	allDevices  = []string{"mem", "disk", "raid0", "raid1", "raid4", "raid5"}
+	allTests    = []string{"create", "lookup", "seqwrite", "seqread", "randwrite", "randread", "delete"}
+)
+
+func Main(args []string) {
+	var (
+		variants = cmdline.String("variants", strings.Join(allVariants, ","), "comma-separated file systems: "+strings.Join(allVariants, ", "))
+		devices  = cmdline.String("devices", "mem,disk,raid0,raid5", "comma-separated devices: "+strings.Join(allDevices, ", "))
+		tests    = cmdline.String("tests", strings.Join(allTests, ","), "comma-separated benchmarks, run in this order")
+		disks    = cmdline.Int("disks", 4, "disks in each RAID array")
+		blocks   = cmdline.Int("blocks", 4096, "file system blocks")
+		files    = cmdline.Int("files", 200, "small files to create, look up and delete")
+		dirs     = cmdline.Int("dirs", 8, "directories at each of the two levels")
+		small    = cmdline.Int("small", 1024, "bytes per small file")
+		large    = cmdline.Int("large", 1<<20, "bytes in the large file")
+		io       = cmdline.Int("io", 16<<10, "bytes per large-file read or write")
+		ops      = cmdline.Int("ops", 200, "random reads, writes and lookups")
+		seed     = cmdline.Int64("seed", 1, "random seed")
+		caches   = cmdline.String("cache", "0", "comma-separated buffer cache sizes in blocks; 0 for none")
+		ahead    = cmdline.Int("readahead", 8, "cache: blocks to read ahead on a sequential miss")
+		through  = cmdline.Bool("writethrough", false, "cache: write through instead of back")
+		flush    = cmdline.Duration("flush", 0, "cache: background flush interval; 0 for only at the end")
+	)
+	defer labs.ParseBench(cmdline, args)()
+
+	tmp, err := os.MkdirTemp("", "fsbench")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(tmp)
+
+	c := cfg{blocks: *blocks, files: *files, dirs: *dirs, small: *small, large: *large, io: *io, ops: *ops, seed: *seed}
+	if c.large > lfs.MaxFileSize || c.large > fs.MaxFileSize {
+		fmt.Fprintf(os.Stderr, "-large: at most %d bytes\n", min(lfs.MaxFileSize, fs.MaxFileSize))
+		os.Exit(1)
+	}
+	c.tests = strings.Split(*tests, ",")
+	for _, t := range c.tests {
+		if !contains(allTests, t) {
+			fmt.Fprintf(os.Stderr, "unknown benchmark %q (%s)\n", t, strings.Join(allTests, ", "))
+			os.Exit(1)
+		}
+	}
+	sizes, err := parseInts(*caches)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	type row struct {
+		variant, device, test string
+		cache                 int
+		s                     latSummary
+	}
+	var rows []row
+	n := 0
+	for _, size := range sizes {
+		for _, d := range strings.Split(*devices, ",") {
+			for _, v := range strings.Split(*variants, ",") {
+				n++
+				dev, err := open(d, *disks, filepath.Join(tmp, fmt.Sprint(n)), c.blocks)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				var cache *fs.Cache
+				if size > 0 {
+					cfg := fs.CacheConfig{Blocks: size, ReadAhead: min(*ahead, size-1), WriteBack: !*through, FlushEvery: *flush}
+					if cache, err = fs.NewCache(cfg); err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						os.Exit(1)
+					}
+					dev = cache.Device(dev)
+				}
+				f, err := format(v, dev, c)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s on %s: %v\n", v, d, err)
+					os.Exit(1)
+				}
+				start := time.Now()
+				res, err := run(f, c)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s on %s: %v\n", v, d, err)
+					os.Exit(1)
+				}
+				fmt.Printf("%-12s on %-5s cache %4d: %v", v, d, size, time.Since(start).Round(time.Millisecond))
+				if cache != nil {
+					start := time.Now()
+					if err := cache.Close(); err != nil {
+						fmt.Fprintf(os.Stderr, "\n%s on %s: flushing: %v\n", v, d, err)
+						os.Exit(1)
+					}
+					fmt.Printf(", final flush %v; %v", time.Since(start).Round(time.Microsecond), cache.Stats())
+				}
+				fmt.Println()
+				for _, t := range c.tests {
+					rows = append(rows, row{v, d, t, size, summarizeLatency(res[t])})
+				}
+			}
+		}
+	}
+
+	fmt.Printf("\n%-12s %-6s %6s %-10s %6s %10s %10s %10s %10s %10s\n", "variant", "device", "cache", "test", "ops", "p50", "p95", "p99", "max", "ops/s")
+	for _, r := range rows {
+		fmt.Printf("%-12s %-6s %6d %-10s %6d %10v %10v %10v %10v %10.0f\n", r.variant, r.device, r.cache, r.test, r.s.N,
+			r.s.P50.Round(time.Microsecond), r.s.P95.Round(time.Microsecond), r.s.P99.Round(time.Microsecond),
+			r.s.Max.Round(time.Microsecond), r.s.rate())
+	}
+}
+
+// cfg is the workload.
+type cfg struct {
+	blocks, files, dirs, small, large, io, ops int
+	tests                                      []string
+	seed                                       int64
+}
+
+// open makes a device: memory, or disk files in dir.
+func open(name string, disks int, dir string, blocks int) (fs.Device, error) {
+	if name == "mem" {
+		return fs.NewMemDevice(blocks), nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	n := disks
+	if name == "disk" {
+		n = 1
+	}
+	var ds []*raid.Disk
+	for i := 0; i < n; i++ {
+		d, err := raid.OpenDisk(filepath.Join(dir, fmt.Sprintf("disk%d.dat", i)))
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	switch {
+	case name == "disk":
+		return ds[0], nil
+	case name == "raid0":
+		return fs.Array{RAID: raid.NewRAID0(ds)}, nil
+	case name == "raid1":
+		return fs.Array{RAID: raid.NewRAID1(ds)}, nil
+	case name == "raid4" && disks >= 2:
+		return fs.Array{RAID: raid.NewRAID4(ds)}, nil
+	case name == "raid5" && disks >= 3:
+		return fs.Array{RAID: raid.NewRAID5(ds)}, nil
+	case name == "raid4" || name == "raid5":
+		return nil, fmt.Errorf("%s needs more disks than %d", name, disks)
+	}
+	return nil, fmt.Errorf("unknown device %q (%s)", name, strings.Join(allDevices, ", "))
+}
+
+// format makes file system variant v on dev.
+func format(v string, dev fs.Device, c cfg) (fileSystem, error) {
+	inodes := c.files + c.dirs*(c.dirs+1) + 8
+	switch v {
+	case "vsfs", "vsfs-journal", "ffs":
+		journal, groups, mode := 0, 0, fs.NoJournal
+		if v == "vsfs-journal" {
+			journal, mode = 64, fs.JournalMetadata
+		}
+		if v == "ffs" {
+			groups = 16
+		}
+		if err := fs.MkfsGroups(dev, c.blocks, inodes, journal, groups); err != nil {
+			return nil, err
+		}
+		return fs.MountJournal(dev, mode)
+	case "lfs":
+		if err := lfs.Mkfs(dev, c.blocks, 32, inodes); err != nil {
+			return nil, err
+		}
+		return lfs.Mount(dev, lfs.DefaultCleaner)
+	}
+	return nil, fmt.Errorf("unknown variant %q (%s)", v, strings.Join(allVariants, ", "))
+}
+
+// run runs the benchmarks on f, returning each one's latencies.
+func run(f fileSystem, c cfg) (map[string][]time.Duration, error) {
+	rng := rand.New(rand.NewSource(c.seed))
+	res := map[string][]time.Duration{}
+	time1 := func(test string, op func() error) error {
+		start := time.Now()
+		err := op()
+		res[test] = append(res[test], time.Since(start))
+		return err
+	}
+	for a := 0; a < c.dirs; a++ {
+		if err := f.Mkdir(fmt.Sprintf("/a%d", a)); err != nil {
+			return nil, err
+		}
+		for b := 0; b < c.dirs; b++ {
+			if err := f.Mkdir(fmt.Sprintf("/a%d/b%d", a, b)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	path := func(i int) string { return fmt.Sprintf("/a%d/b%d/f%d", i%c.dirs, i/c.dirs%c.dirs, i) }
+	small := make([]byte, c.small)
+	buf := make([]byte, c.io)
+	rng.Read(small)
+	rng.Read(buf)
+	pieces := max(1, c.large/c.io)
+	for _, test := range c.tests {
+		var err error
+		switch test {
+		case "create":
+			for i := 0; i < c.files && err == nil; i++ {
+				err = time1(test, func() error { return f.WriteFile(path(i), small) })
+			}
+		case "lookup":
+			for i := 0; i < c.ops && err == nil; i++ {
+				p := path(rng.Intn(c.files))
+				err = time1(test, func() error { _, err := f.Stat(p); return err })
+			}
+		case "seqwrite":
+			if err = f.WriteFile("/large", nil); err != nil && err != fs.ErrExists {
+				break
+			}
+			for i := 0; i < pieces && err == nil; i++ {
+				err = time1(test, func() error { _, err := f.WriteAt("/large", buf, i*c.io); return err })
+			}
+		case "seqread":
+			for i := 0; i < pieces && err == nil; i++ {
+				err = time1(test, func() error { _, err := f.ReadAt("/large", buf, i*c.io); return err })
+			}
+		case "randwrite":
+			for i := 0; i < c.ops && err == nil; i++ {
+				off := rng.Intn(pieces) * c.io
+				err = time1(test, func() error { _, err := f.WriteAt("/large", buf, off); return err })
+			}
+		case "randread":
+			for i := 0; i < c.ops && err == nil; i++ {
+				off := rng.Intn(pieces) * c.io
+				err = time1(test, func() error { _, err := f.ReadAt("/large", buf, off); return err })
+			}
+		case "delete":
+			for i := 0; i < c.files && err == nil; i++ {
+				err = time1(test, func() error { return f.Unlink(path(i)) })
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", test, err)
+		}
+	}
+	return res, nil
+}
+
+func parseInts(s string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("bad cache size %q", f)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// latSummary is a latency distribution.
+type latSummary struct {
+	N                  int
+	Total              time.Duration
+	P50, P95, P99, Max time.Duration
+}
+
+// rate is operations per second.
+func (s latSummary) rate() float64 {
+	if s.Total <= 0 {
+		return 0
+	}
+	return float64(s.N) / s.Total.Seconds()
+}
+
+func summarizeLatency(ds []time.Duration) latSummary {
+	s := stats.Summarize(ds)
+	return latSummary{
+		N:     s.N,
+		Total: s.Mean * time.Duration(s.N),
+		P50:   s.Quantile(0.50),
+		P95:   s.Quantile(0.95),
+		P99:   s.Quantile(0.99),
+		Max:   s.Max,
+	}
+}
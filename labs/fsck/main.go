@@ -0,0 +1,194 @@
+// File system checker
+// Checks, and unless -n repairs, the file system of package fs on a disk
+// image or RAID array. With -inject it instead runs the corruption suite:
+// for each fs.Corruption it builds a populated file system in memory,
+// damages it, and requires fsck to detect the damage without writing,
+// repair it, find the result clean, leave /keep.txt intact, and leave a
+// file system that still works.
+//
+//	go run ./cmd/fsck -img fs.img -n
+//	go run ./cmd/fsck -raid 5 -disks 4
+//	go run ./cmd/fsck -inject
+//	go run ./cmd/fsck -inject -corrupt dangling-dir,bad-type -v
+//	go run ./cmd/fsck -inject -groups 4 -blocks 128
+package fsck
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/operating-systems/HW7/raid"
+	"example.com/operating-systems/fs"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("fsck")
+
+func Main(args []string) {
+	var (
+		img     = cmdline.String("img", "fs.img", "disk image file (a raid.Disk)")
+		level   = cmdline.Int("raid", -1, "check a RAID array instead: level 0, 1, 4, or 5")
+		disks   = cmdline.Int("disks", 4, "-raid: number of disk files")
+		dir     = cmdline.String("dir", ".", "-raid: directory of the disk files disk0.dat, disk1.dat, ...")
+		check   = cmdline.Bool("n", false, "only check, don't repair")
+		inject  = cmdline.Bool("inject", false, "run the corruption-injection suite instead")
+		corrupt = cmdline.String("corrupt", "", "-inject: comma-separated corruptions to run (default all)")
+		blocks  = cmdline.Int("blocks", 64, "-inject: blocks in each file system")
+		inodes  = cmdline.Int("inodes", 80, "-inject: inodes")
+		groups  = cmdline.Int("groups", 0, "-inject: block groups (0 for the flat layout)")
+		verbose = cmdline.Bool("v", false, "-inject: print fsck's reports")
+	)
+	cmdline.Parse(args)
+
+	if *inject {
+		cs := fs.Corruptions
+		if *corrupt != "" {
+			cs = nil
+			for _, name := range strings.Split(*corrupt, ",") {
+				c, err := fs.FindCorruption(strings.TrimSpace(name))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				cs = append(cs, c)
+			}
+		}
+		if !suite(cs, *blocks, *inodes, *groups, *verbose) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	dev, err := open(*img, *level, *disks, *dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	r, err := fs.Fsck(dev, !*check)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Print(r)
+	if !r.Clean() {
+		os.Exit(1)
+	}
+}
+
+// open returns the device to check.
+func open(img string, level, disks int, dir string) (fs.Device, error) {
+	if level < 0 {
+		return raid.OpenDisk(img)
+	}
+	var ds []*raid.Disk
+	for i := 0; i < disks; i++ {
+		d, err := raid.OpenDisk(filepath.Join(dir, fmt.Sprintf("disk%d.dat", i)))
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	switch {
+	case level == 0:
+		return fs.Array{RAID: raid.NewRAID0(ds)}, nil
+	case level == 1:
+		return fs.Array{RAID: raid.NewRAID1(ds)}, nil
+	case level == 4 && disks >= 2:
+		return fs.Array{RAID: raid.NewRAID4(ds)}, nil
+	case level == 5 && disks >= 3:
+		return fs.Array{RAID: raid.NewRAID5(ds)}, nil
+	}
+	return nil, fmt.Errorf("can't build RAID %d from %d disks (RAID 4 needs 2, RAID 5 needs 3)", level, disks)
+}
+
+// suite runs each corruption and prints a table; it reports whether all
+// passed.
+func suite(cs []fs.Corruption, blocks, inodes, groups int, verbose bool) bool {
+	fmt.Printf("%-16s %-58s %6s %6s  %s\n", "corruption", "", "found", "fixed", "result")
+	ok := true
+	for _, c := range cs {
+		found, fixed, err := inject(c, blocks, inodes, groups, verbose)
+		result := "ok"
+		if err != nil {
+			result = "FAIL: " + err.Error()
+			ok = false
+		}
+		fmt.Printf("%-16s %-58s %6d %6d  %s\n", c.Name, c.What, found, fixed, result)
+	}
+	return ok
+}
+
+// inject runs one corruption through detection, repair, and the checks
+// after it, returning how many problems fsck found and fixed.
+func inject(c fs.Corruption, blocks, inodes, groups int, verbose bool) (int, int, error) {
+	dev := fs.NewMemDevice(blocks)
+	if err := fs.MkfsGroups(dev, blocks, inodes, 0, groups); err != nil {
+		return 0, 0, err
+	}
+	f, err := fs.Mount(dev)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := fs.Populate(f); err != nil {
+		return 0, 0, err
+	}
+	if r, err := fs.Fsck(dev, false); err != nil || !r.Clean() {
+		return 0, 0, fmt.Errorf("not clean before the corruption: %v%v", err, r)
+	}
+	if err := c.Apply(f); err != nil {
+		return 0, 0, err
+	}
+
+	writes := dev.Writes
+	r, err := fs.Fsck(dev, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	if verbose {
+		fmt.Printf("%s, checked:\n%v", c.Name, r)
+	}
+	if dev.Writes != writes {
+		return len(r.Problems), 0, errors.New("fsck -n wrote to the device")
+	}
+	if r.Clean() {
+		return 0, 0, errors.New("not detected")
+	}
+
+	r, err = fs.Fsck(dev, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	if verbose {
+		fmt.Printf("%s, repaired:\n%v", c.Name, r)
+	}
+	found, fixed := len(r.Problems), r.Fixed()
+	if after, err := fs.Fsck(dev, false); err != nil || !after.Clean() {
+		return found, fixed, fmt.Errorf("not clean after repair: %v\n%v", err, after)
+	}
+
+	// The repaired file system mounts, keeps /keep.txt, and still works
+	if f, err = fs.Mount(dev); err != nil {
+		return found, fixed, err
+	}
+	if data, err := f.ReadFile("/keep.txt"); err != nil || !bytes.Equal(data, fs.KeepData) {
+		return found, fixed, fmt.Errorf("/keep.txt lost: %v", err)
+	}
+	data := bytes.Repeat([]byte("new"), 3000)
+	if err := f.WriteFile("/new", data); err != nil {
+		return found, fixed, err
+	}
+	if err := f.Mkdir("/newdir"); err != nil {
+		return found, fixed, err
+	}
+	if got, err := f.ReadFile("/new"); err != nil || !bytes.Equal(got, data) {
+		return found, fixed, fmt.Errorf("writing after repair: %v", err)
+	}
+	if after, err := fs.Fsck(dev, false); err != nil || !after.Clean() {
+		return found, fixed, fmt.Errorf("not clean after writing: %v\n%v", err, after)
+	}
+	return found, fixed, nil
+}
@@ -0,0 +1,293 @@
+// File system crash-injection harness
+// Runs a script of file system operations under each journal mode, and
+// for every operation crashes the device after each possible number of
+// block writes: 0, 1, ... up to the writes the operation needs. After each
+// crash the file system is remounted (replaying the journal) and checked:
+//
+//	consistent  fsck finds nothing wrong
+//	atomic      the names, types, link counts and sizes are exactly as
+//	            before the operation or exactly as after it
+//	data        the file contents are too
+//
+// The unjournaled baseline is expected to fail the first two; journaling
+// metadata makes every crash consistent and atomic but can tear file data
+// written in place (an overwrite, or the tail a truncate zeroes);
+// journaling everything keeps the data too.
+//
+//	go run ./cmd/fscrash
+//	go run ./cmd/fscrash -modes metadata -v
+//	go run ./cmd/fscrash -ops "mkdir /d; write /d/f 9000; poke /d/f 100 5000; rm /d/f"
+package fscrash
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"example.com/operating-systems/fs"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("fscrash")
+
+// script is the default workload. write PATH N replaces a file with N
+// bytes, append PATH N adds N, and poke PATH OFF N overwrites N bytes in
+// place at OFF.
+const script = "mkdir /docs; write /docs/a 3000; write /big 60000; append /docs/a 5000; ln /docs/a /a2; " +
+	"poke /big 1000 9000; write /big 20000; truncate /docs/a 100; rm /a2; mkdir /docs/sub; rmdir /docs/sub; rm /big"
+
+func Main(args []string) {
+	var (
+		modes   = cmdline.String("modes", "none,metadata,all", "comma-separated journal modes to compare")
+		ops     = cmdline.String("ops", script, "operations, separated by \";\": mkdir, write, append, poke, ln, rm, rmdir, truncate")
+		blocks  = cmdline.Int("blocks", 128, "blocks in the file system")
+		inodes  = cmdline.Int("inodes", 80, "inodes")
+		journal = cmdline.Int("journal", 40, "journal blocks, for the journaled modes")
+		verbose = cmdline.Bool("v", false, "list every crash that was inconsistent or not atomic")
+	)
+	cmdline.Parse(args)
+
+	var list []string
+	for _, op := range strings.Split(*ops, ";") {
+		if op = strings.TrimSpace(op); op != "" {
+			list = append(list, op)
+		}
+	}
+	var results []result
+	for _, name := range strings.Split(*modes, ",") {
+		mode, err := fs.ParseJournalMode(strings.TrimSpace(name))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		jsize := *journal
+		if mode == fs.NoJournal {
+			jsize = 0
+		}
+		r, err := run(mode, list, *blocks, *inodes, jsize, *verbose)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", mode, err)
+			os.Exit(1)
+		}
+		results = append(results, r)
+	}
+
+	fmt.Printf("\n%-17s %6s %8s %11s %8s %8s %12s\n", "mode", "ops", "crashes", "consistent", "atomic", "data", "writes/op")
+	for _, r := range results {
+		fmt.Printf("%-17v %6d %8d %11s %8s %8s %12.1f\n", r.mode, r.ops, r.crashes,
+			pct(r.consistent, r.crashes), pct(r.atomic, r.crashes), pct(r.data, r.crashes), float64(r.writes)/float64(r.ops))
+	}
+}
+
+// result tallies one mode's crashes.
+type result struct {
+	mode                     fs.JournalMode
+	ops, writes              int
+	crashes                  int
+	consistent, atomic, data int
+}
+
+func pct(n, of int) string {
+	if of == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(of))
+}
+
+// run plays the script under mode, crashing every operation at every
+// write.
+func run(mode fs.JournalMode, ops []string, blocks, inodes, journal int, verbose bool) (result, error) {
+	r := result{mode: mode, ops: len(ops)}
+	dev := fs.NewMemDevice(blocks)
+	if err := fs.Mkfs(dev, blocks, inodes, journal); err != nil {
+		return r, err
+	}
+	for i, op := range ops {
+		before, err := snapshot(dev)
+		if err != nil {
+			return r, err
+		}
+		// Run it whole first, to count its writes and see the state after
+		after := dev.Clone()
+		crash := &fs.CrashDevice{Device: after, Left: 1 << 30}
+		if err := apply(crash, mode, op, i); err != nil {
+			return r, fmt.Errorf("%s: %v", op, err)
+		}
+		want, err := snapshot(after)
+		if err != nil {
+			return r, err
+		}
+		writes := 1<<30 - crash.Left
+		r.writes += writes
+
+		for k := 0; k < writes; k++ {
+			d := dev.Clone()
+			if err := apply(&fs.CrashDevice{Device: d, Left: k}, mode, op, i); err == nil {
+				return r, fmt.Errorf("%s: survived a crash after %d of %d writes", op, k, writes)
+			}
+			r.crashes++
+			// Reboot: mount to recover, then check
+			var problems []string
+			var rep *fs.FsckReport
+			_, err := fs.Mount(d)
+			if err == nil {
+				rep, err = fs.Fsck(d, false)
+			}
+			switch {
+			case err != nil:
+				problems = append(problems, err.Error())
+			case rep.Clean():
+				r.consistent++
+			default:
+				problems = append(problems, fmt.Sprintf("fsck: %d problem(s), first: %v", len(rep.Problems), rep.Problems[0]))
+			}
+			got, serr := snapshot(d)
+			switch {
+			case serr != nil:
+				problems = append(problems, serr.Error())
+			case got.meta == before.meta || got.meta == want.meta:
+				r.atomic++
+				if got.full == before.full || got.full == want.full {
+					r.data++
+				} else {
+					problems = append(problems, "file data torn")
+				}
+			default:
+				problems = append(problems, "not atomic")
+			}
+			if verbose && len(problems) > 0 {
+				fmt.Printf("%v: %q crashed after %d of %d writes: %s\n", mode, op, k, writes, strings.Join(problems, "; "))
+			}
+		}
+		dev = after
+	}
+	return r, nil
+}
+
+// apply mounts dev and runs op, the script's i-th.
+func apply(dev fs.Device, mode fs.JournalMode, op string, i int) error {
+	f, err := fs.MountJournal(dev, mode)
+	if err != nil {
+		return err
+	}
+	args := strings.Fields(op)
+	num := func(j int) (int, error) {
+		if j >= len(args) {
+			return 0, fmt.Errorf("%s needs %d arguments", args[0], j)
+		}
+		return strconv.Atoi(args[j])
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("bad operation %q", op)
+	}
+	switch args[0] {
+	case "mkdir":
+		return f.Mkdir(args[1])
+	case "rm":
+		return f.Unlink(args[1])
+	case "rmdir":
+		return f.Rmdir(args[1])
+	case "ln":
+		if len(args) < 3 {
+			return fmt.Errorf("ln needs 2 arguments")
+		}
+		return f.Link(args[1], args[2])
+	case "truncate":
+		n, err := num(2)
+		if err != nil {
+			return err
+		}
+		return f.Truncate(args[1], n)
+	case "write":
+		n, err := num(2)
+		if err != nil {
+			return err
+		}
+		return f.WriteFile(args[1], fill(n, i))
+	case "append", "poke":
+		n, err := num(len(args) - 1)
+		if err != nil {
+			return err
+		}
+		off := 0
+		if args[0] == "poke" {
+			if off, err = num(2); err != nil {
+				return err
+			}
+		} else {
+			st, err := f.Stat(args[1])
+			if err != nil {
+				return err
+			}
+			off = st.Size
+		}
+		_, err = f.WriteAt(args[1], fill(n, i), off)
+		return err
+	}
+	return fmt.Errorf("unknown operation %q", args[0])
+}
+
+// fill is n bytes that differ from one operation to the next.
+func fill(n, i int) []byte {
+	return bytes.Repeat([]byte{byte('a' + i%26)}, n)
+}
+
+// state is a file system's tree: meta without file contents, full with.
+type state struct{ meta, full string }
+
+// snapshot walks the tree of the file system on dev, without writing.
+func snapshot(dev fs.Device) (state, error) {
+	if m, ok := dev.(*fs.MemDevice); ok {
+		dev = m.Clone() // mounting may replay the journal
+	}
+	f, err := fs.Mount(dev)
+	if err != nil {
+		return state{}, err
+	}
+	var meta, full []string
+	var walk func(path string, depth int) error
+	walk = func(path string, depth int) error {
+		if depth > 32 {
+			return fmt.Errorf("%s: directories nest too deep", path)
+		}
+		ents, err := f.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, e := range ents {
+			if e.Name == "." || e.Name == ".." {
+				continue
+			}
+			p := strings.TrimSuffix(path, "/") + "/" + e.Name
+			st, err := f.Stat(p)
+			if err != nil {
+				return err
+			}
+			line := fmt.Sprintf("%s %v links=%d size=%d", p, st.Type, st.Links, st.Size)
+			meta = append(meta, line)
+			if st.Type == fs.TypeDir {
+				full = append(full, line)
+				if err := walk(p, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			data, err := f.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			full = append(full, fmt.Sprintf("%s crc=%08x", line, crc32.ChecksumIEEE(data)))
+		}
+		return nil
+	}
+	if err := walk("/", 0); err != nil {
+		return state{}, err
+	}
+	sort.Strings(meta)
+	sort.Strings(full)
+	return state{strings.Join(meta, "\n"), strings.Join(full, "\n")}, nil
+}
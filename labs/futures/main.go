@@ -0,0 +1,130 @@
+// Futures demo
+// Counts the primes below -n on a worker pool (package pool) with
+// futures (package future): one Submit per -chunk numbers, a Then on each
+// to turn its count into a line of the report, and All to gather them,
+// checked against a serial count. Then shows the rest of the API: a
+// GetTimeout that gives up, an error passing down a Then chain without
+// running the rest of it, and a panicking task coming back as an error.
+//
+//	go run ./cmd/futures
+//	go run ./cmd/futures -n 5000000 -chunk 100000 -max 4
+package futures
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/future"
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/pool"
+)
+
+var cmdline = labs.FlagSet("futures")
+
+func Main(args []string) {
+	cfg := pool.DefaultConfig
+	var (
+		n     = cmdline.Int("n", 2000000, "count primes below this")
+		chunk = cmdline.Int("chunk", 50000, "numbers per task")
+	)
+	cmdline.IntVar(&cfg.Max, "max", cfg.Max, "pool: most workers")
+	cmdline.IntVar(&cfg.Queue, "queue", cfg.Queue, "pool: queued tasks")
+	cmdline.Parse(args)
+	*chunk = max(1, *chunk)
+
+	p, err := pool.New(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer p.Shutdown(context.Background())
+
+	start := time.Now()
+	want := primes(0, *n)
+	serial := time.Since(start)
+
+	start = time.Now()
+	var parts []*future.Future[int]
+	for lo := 0; lo < *n; lo += *chunk {
+		lo, hi := lo, min(lo+*chunk, *n)
+		count := future.Submit(p, func() (int, error) { return primes(lo, hi), nil })
+		parts = append(parts, count)
+	}
+	counts, err := future.All(parts...).Get()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	got := 0
+	for _, c := range counts {
+		got += c
+	}
+	parallel := time.Since(start)
+	status := "ok"
+	if got != want {
+		status = fmt.Sprintf("MISMATCH, serial count %d", want)
+	}
+	fmt.Printf("primes below %d: %d in %d tasks (%s)\n", *n, got, len(parts), status)
+	fmt.Printf("    serial %v, on the pool %v (%.1fx), %v\n", serial.Round(time.Millisecond),
+		parallel.Round(time.Millisecond), serial.Seconds()/parallel.Seconds(), p.Stats())
+
+	// Then: the densest chunk, worked out from the counts once they're in
+	densest := future.Then(p, future.All(parts...), func(cs []int) (string, error) {
+		best := 0
+		for i, c := range cs {
+			if c > cs[best] {
+				best = i
+			}
+		}
+		return fmt.Sprintf("[%d, %d) with %d primes", best**chunk, min((best+1)**chunk, *n), cs[best]), nil
+	})
+	s, _ := densest.Get()
+	fmt.Println("densest chunk:", s)
+
+	// GetTimeout gives up on a slow task, which still finishes
+	slow := future.Submit(p, func() (string, error) {
+		time.Sleep(50 * time.Millisecond)
+		return "done", nil
+	})
+	_, err = slow.GetTimeout(10 * time.Millisecond)
+	v, _ := slow.Get()
+	fmt.Printf("slow task: GetTimeout(10ms) says %q; Get later says %q\n", err, v)
+
+	// An error skips the rest of a chain
+	var ran atomic.Bool
+	failed := future.Then(p,
+		future.Submit(p, func() (int, error) { return 0, errors.New("disk on fire") }),
+		func(int) (int, error) { ran.Store(true); return 1, nil })
+	_, err = failed.Get()
+	fmt.Printf("failing chain: %v (second step ran: %v)\n", err, ran.Load())
+
+	// A panic comes back as an error, and the pool carries on
+	_, err = future.Submit(p, func() (int, error) {
+		var m map[string]int
+		m["x"] = 1
+		return 0, nil
+	}).Get()
+	fmt.Printf("panicking task: %v\n", err)
+}
+
+// primes counts the primes in [lo, hi) by trial division.
+func primes(lo, hi int) int {
+	n := 0
+	for x := max(lo, 2); x < hi; x++ {
+		prime := true
+		for d := 2; d*d <= x; d++ {
+			if x%d == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			n++
+		}
+	}
+	return n
+}
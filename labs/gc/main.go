@@ -0,0 +1,129 @@
+// Garbage collector simulator
+// Runs a generated mutator against a toy heap (see package gc) under a
+// stop-the-world mark-sweep collector and an incremental one, and compares
+// how much they reclaim, how much work they do, and how long they pause.
+//
+//	go run ./cmd/gc                                   # both collectors, default workload
+//	go run ./cmd/gc -heap 32k -ops 200000 -budget 20,100 -trigger 0.6
+//	go run ./cmd/gc -collector incr -budget 5 -no-barrier -check    # watch a reachable object get freed
+package gc
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"example.com/operating-systems/HW0/Q2/freelist"
+	"example.com/operating-systems/gc"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("gc")
+
+func Main(args []string) {
+	w := gc.DefaultWorkload()
+	var (
+		heap      = cmdline.Int("heap", 64<<10, "heap size in bytes")
+		fitName   = cmdline.String("fit", "first", "allocator fit policy: first | best | worst | next")
+		collector = cmdline.String("collector", "stw,incr", "comma-separated collectors: stw (stop-the-world mark-sweep) | incr (incremental)")
+		budget    = cmdline.String("budget", "50", "incr: comma-separated work units per allocation")
+		trigger   = cmdline.Float64("trigger", 0.7, "incr: heap occupancy that starts a cycle")
+		noBarrier = cmdline.Bool("no-barrier", false, "incr: leave out the write barrier")
+		check     = cmdline.Bool("check", false, "verify after every operation that nothing reachable was freed")
+		pauses    = cmdline.Bool("pauses", false, "list every pause")
+	)
+	cmdline.IntVar(&w.Ops, "ops", w.Ops, "mutator operations")
+	cmdline.Int64Var(&w.Seed, "seed", w.Seed, "mutator seed")
+	cmdline.IntVar(&w.MinSize, "min", w.MinSize, "smallest object, bytes")
+	cmdline.IntVar(&w.MaxSize, "max", w.MaxSize, "largest object, bytes")
+	cmdline.IntVar(&w.Fields, "fields", w.Fields, "most pointer fields per object")
+	cmdline.IntVar(&w.Roots, "roots", w.Roots, "roots the mutator holds")
+	cmdline.Float64Var(&w.Link, "link", w.Link, "chance an operation stores a pointer instead of allocating")
+	cmdline.Float64Var(&w.Unlink, "unlink", w.Unlink, "chance a pointer store writes nil")
+	cmdline.Float64Var(&w.Move, "move", w.Move, "chance a pointer store moves a pointer from another field")
+	cmdline.IntVar(&w.Walk, "walk", w.Walk, "most pointers followed from a root to pick an object")
+	cmdline.Parse(args)
+	w.MinSize = max(w.MinSize, 1)
+	w.MaxSize = max(w.MaxSize, w.MinSize)
+	w.Fields, w.Roots, w.Walk = max(w.Fields, 0), max(w.Roots, 1), max(w.Walk, 0)
+
+	fit, err := freelist.ParseFit(*fitName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	budgets, err := parseInts(*budget)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bad -budget:", err)
+		os.Exit(2)
+	}
+	var collectors []gc.Collector
+	for _, c := range strings.Split(*collector, ",") {
+		switch strings.TrimSpace(c) {
+		case "stw":
+			collectors = append(collectors, gc.MarkSweep{})
+		case "incr":
+			for _, b := range budgets {
+				collectors = append(collectors, gc.Incremental{Budget: max(b, 1), Trigger: *trigger, NoBarrier: *noBarrier})
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "unknown collector %q (use stw or incr)\n", c)
+			os.Exit(2)
+		}
+	}
+
+	fmt.Printf("Workload: %s\n\n", w)
+	var heaps []*gc.Heap
+	for _, c := range collectors {
+		h := gc.NewHeap(*heap, fit, c)
+		var verify func() error
+		if *check {
+			verify = h.Verify
+		}
+		if err := w.Run(h, verify); err != nil {
+			fmt.Printf("%s: %v\n\n", c.Name(), err)
+			continue
+		}
+		fmt.Println(h.Report())
+		if *pauses {
+			for _, p := range h.Stats.Pauses {
+				fmt.Printf("  cycle %4d %-7s work %6d  %v\n", p.Cycle, p.Kind, p.Work, p.Time)
+			}
+			fmt.Println()
+		}
+		heaps = append(heaps, h)
+	}
+	if *check && len(heaps) == len(collectors) {
+		fmt.Printf("no reachable object was freed, checked after every operation\n\n")
+	}
+
+	// Side-by-side summary
+	width := len("collector")
+	for _, h := range heaps {
+		width = max(width, len(h.Collector()))
+	}
+	fmt.Printf("%-*s %7s %7s %10s %9s %9s %9s %9s\n", width, "collector", "cycles", "failed", "reclaimed", "work", "pauses", "max work", "p99 work")
+	for _, h := range heaps {
+		freed, work := 0, 0
+		for _, c := range h.Stats.Cycles {
+			freed += c.Freed
+			work += c.Work
+		}
+		p := h.PauseStats()
+		fmt.Printf("%-*s %7d %7d %10d %9d %9d %9d %9d\n", width, h.Collector(), len(h.Stats.Cycles), h.Stats.Failed, freed, work, p.Count, p.MaxWork, p.P99Work)
+	}
+}
+
+// parseInts parses a comma-separated list like "1,2,3".
+func parseInts(list string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(list, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
@@ -0,0 +1,367 @@
+// gosh, a small shell
+// Reads command lines and runs them the way HW0/HW1 run processes, with
+// os/exec and pipes: external programs found on $PATH, pipelines joined
+// by os.Pipe (a | b | c), redirection (< in, > out, >> append, 2> err),
+// background jobs (ended by &), lists (a; b), quoting ('...', "...", \), $VAR and $?
+// expansion, and the built-ins cd, exit and jobs. Finished background
+// jobs are reported before the next prompt. Ctrl-C goes to the
+// foreground pipeline, not the shell.
+//
+//	go run ./cmd/gosh
+//	go run ./cmd/gosh -c 'ls -l | sort -k5 -n | tail -3 > big.txt'
+//	printf 'sleep 1 &\njobs\necho $HOME | tr a-z A-Z\n' | go run ./cmd/gosh
+package gosh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("gosh")
+
+// lastStatus is the exit status of the last foreground pipeline, for $?.
+var lastStatus int
+
+// job is a background pipeline.
+type job struct {
+	id     int
+	text   string
+	pids   []int
+	done   chan struct{} // closed when every process has exited
+	status int
+}
+
+// shell is the state carried between lines.
+type shell struct {
+	mu   sync.Mutex // guards jobs and next
+	jobs []*job
+	next int
+}
+
+func Main(args []string) {
+	script := cmdline.String("c", "", "run this line and exit")
+	cmdline.Parse(args)
+
+	// The terminal sends Ctrl-C to the whole foreground process group:
+	// the children die of it, and the shell, catching it, doesn't.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		for range sig {
+		}
+	}()
+
+	sh := &shell{next: 1}
+	if *script != "" {
+		sh.line(*script)
+		os.Exit(lastStatus)
+	}
+	interactive := false
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		interactive = true
+	}
+	in := bufio.NewReader(os.Stdin)
+	for {
+		sh.reap()
+		if interactive {
+			fmt.Print(prompt())
+		}
+		line, err := in.ReadString('\n')
+		if line != "" {
+			sh.line(line)
+		}
+		if err != nil {
+			if interactive {
+				fmt.Println()
+			}
+			os.Exit(lastStatus)
+		}
+	}
+}
+
+// prompt is the working directory, shortened under $HOME.
+func prompt() string {
+	dir, _ := os.Getwd()
+	if home, err := os.UserHomeDir(); err == nil && home != "" && strings.HasPrefix(dir, home) {
+		dir = "~" + dir[len(home):]
+	}
+	return "gosh:" + dir + "$ "
+}
+
+// line runs one command line.
+func (sh *shell) line(line string) {
+	for line != "" {
+		p, rest, err := parse(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gosh:", err)
+			lastStatus = 2
+			return
+		}
+		if len(p.cmds) > 0 {
+			sh.run(p)
+		}
+		line = rest
+	}
+}
+
+// run runs one pipeline, in the foreground or as a job.
+func (sh *shell) run(p pipeline) {
+	if len(p.cmds) == 1 && !p.background {
+		if b, ok := builtins[p.cmds[0].args[0]]; ok {
+			lastStatus = b(sh, p.cmds[0])
+			return
+		}
+	}
+	for _, c := range p.cmds {
+		if _, ok := builtins[c.args[0]]; ok {
+			fmt.Fprintf(os.Stderr, "gosh: %s: built-ins can't be piped or run in the background\n", c.args[0])
+			lastStatus = 2
+			return
+		}
+	}
+	procs, err := start(p)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gosh:", err)
+		lastStatus = 127
+		return
+	}
+	if !p.background {
+		lastStatus = wait(procs)
+		return
+	}
+	j := &job{text: p.text, done: make(chan struct{})}
+	for _, c := range procs {
+		j.pids = append(j.pids, c.Process.Pid)
+	}
+	sh.mu.Lock()
+	j.id = sh.next
+	sh.next++
+	sh.jobs = append(sh.jobs, j)
+	sh.mu.Unlock()
+	go func() {
+		j.status = wait(procs)
+		close(j.done)
+	}()
+	fmt.Printf("[%d] %d\n", j.id, j.pids[len(j.pids)-1])
+	lastStatus = 0
+}
+
+// start starts every command of p, each reading the one before it
+// through a pipe. If one can't start, those already running are killed
+// and waited for.
+func start(p pipeline) ([]*exec.Cmd, error) {
+	var procs []*exec.Cmd
+	var files []*os.File // the shell's copies of pipe ends and redirections, closed once the children have them
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	fail := func(err error) ([]*exec.Cmd, error) {
+		for _, c := range procs {
+			c.Process.Kill()
+			c.Wait()
+		}
+		return nil, err
+	}
+	var prev *os.File // the read end of the pipe from the previous command
+	for i, c := range p.cmds {
+		cmd := exec.Command(c.args[0], c.args[1:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if p.background && i == 0 {
+			cmd.Stdin = nil // a background job doesn't get the terminal's input
+		}
+		if prev != nil {
+			cmd.Stdin = prev
+		}
+		prev = nil
+		if i < len(p.cmds)-1 {
+			r, w, err := os.Pipe()
+			if err != nil {
+				return fail(err)
+			}
+			files = append(files, r, w)
+			cmd.Stdout, prev = w, r
+		}
+		if c.in != "" {
+			f, err := os.Open(c.in)
+			if err != nil {
+				return fail(err)
+			}
+			files = append(files, f)
+			cmd.Stdin = f
+		}
+		if c.out != "" {
+			flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			if c.appendOut {
+				flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			}
+			f, err := os.OpenFile(c.out, flags, 0o644)
+			if err != nil {
+				return fail(err)
+			}
+			files = append(files, f)
+			cmd.Stdout = f
+		}
+		if c.errOut != "" {
+			f, err := os.OpenFile(c.errOut, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+			if err != nil {
+				return fail(err)
+			}
+			files = append(files, f)
+			cmd.Stderr = f
+		}
+		if err := cmd.Start(); err != nil {
+			var ee *exec.Error
+			if errors.As(err, &ee) {
+				err = fmt.Errorf("%s: command not found", c.args[0])
+			}
+			return fail(err)
+		}
+		procs = append(procs, cmd)
+	}
+	return procs, nil
+}
+
+// wait waits for every process and returns the last one's exit status.
+func wait(procs []*exec.Cmd) int {
+	status := 0
+	for _, c := range procs {
+		err := c.Wait()
+		var ee *exec.ExitError
+		switch {
+		case err == nil:
+			status = 0
+		case errors.As(err, &ee):
+			status = ee.ExitCode()
+			if status < 0 {
+				status = signalStatus(ee.ProcessState)
+			}
+		default:
+			fmt.Fprintln(os.Stderr, "gosh:", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// reap reports and forgets background jobs that have finished.
+func (sh *shell) reap() {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	live := sh.jobs[:0]
+	for _, j := range sh.jobs {
+		select {
+		case <-j.done:
+			fmt.Printf("[%d]  %-20s %s\n", j.id, doneText(j.status), j.text)
+		default:
+			live = append(live, j)
+		}
+	}
+	sh.jobs = live
+	if len(live) == 0 {
+		sh.next = 1
+	}
+}
+
+func doneText(status int) string {
+	if status == 0 {
+		return "Done"
+	}
+	return fmt.Sprintf("Exit %d", status)
+}
+
+// builtins run in the shell itself, returning an exit status.
+var builtins = map[string]func(*shell, command) int{
+	"cd":   builtinCd,
+	"exit": builtinExit,
+	"jobs": builtinJobs,
+}
+
+// builtinCd changes directory: to $HOME with no argument, to the previous
+// directory with -.
+func builtinCd(_ *shell, c command) int {
+	dir := ""
+	switch len(c.args) {
+	case 1:
+		dir = os.Getenv("HOME")
+	case 2:
+		dir = c.args[1]
+	default:
+		fmt.Fprintln(os.Stderr, "gosh: cd: too many arguments")
+		return 1
+	}
+	if dir == "-" {
+		dir = os.Getenv("OLDPWD")
+		fmt.Println(dir)
+	} else if dir == "~" || strings.HasPrefix(dir, "~/") {
+		dir = filepath.Join(os.Getenv("HOME"), dir[1:])
+	}
+	old, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		fmt.Fprintln(os.Stderr, "gosh: cd:", err)
+		return 1
+	}
+	os.Setenv("OLDPWD", old)
+	if wd, err := os.Getwd(); err == nil {
+		os.Setenv("PWD", wd)
+	}
+	return 0
+}
+
+// builtinExit exits with the given status, or the last one.
+func builtinExit(_ *shell, c command) int {
+	code := lastStatus
+	if len(c.args) > 1 {
+		n, err := strconv.Atoi(c.args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gosh: exit: %s: numeric argument required\n", c.args[1])
+			return 2
+		}
+		code = n
+	}
+	os.Exit(code)
+	return code
+}
+
+// builtinJobs lists the background jobs, running or finished but not yet
+// reported. Its output can be redirected.
+func builtinJobs(sh *shell, c command) int {
+	var w io.Writer = os.Stdout
+	if c.out != "" {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if c.appendOut {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(c.out, flags, 0o644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gosh: jobs:", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	for _, j := range sh.jobs {
+		state := "Running"
+		select {
+		case <-j.done:
+			state = doneText(j.status)
+		default:
+		}
+		fmt.Fprintf(w, "[%d]  %v  %-20s %s\n", j.id, j.pids, state, j.text)
+	}
+	return 0
+}
@@ -0,0 +1,198 @@
+package gosh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command is one stage of a pipeline.
+type command struct {
+	args      []string
+	in, out   string // redirections; "" for none
+	appendOut bool   // >> rather than >
+	errOut    string // 2>
+}
+
+// pipeline is commands joined by |, perhaps run in the background.
+type pipeline struct {
+	cmds       []command
+	background bool
+	text       string // as typed, for jobs
+}
+
+// token is a word or an operator; quoted words never come out as
+// operators, so '|' is an argument.
+type token struct {
+	s  string
+	op bool
+}
+
+// lex splits the first pipeline off a line into words and the operators
+// | < > >> 2> and the & or ; ending it, returning what's left of the line
+// after that. Single quotes keep everything literally, double quotes keep
+// all but \" and \\, a backslash outside quotes escapes the next
+// character, and $NAME or ${NAME} outside single quotes is replaced by
+// the variable's value. Lexing a pipeline at a time means $? and the
+// variables cd sets are those left by the pipeline before.
+func lex(line string) ([]token, string, error) {
+	var toks []token
+	var word strings.Builder
+	inWord := false
+	flush := func() {
+		if inWord {
+			toks = append(toks, token{s: word.String()})
+			word.Reset()
+			inWord = false
+		}
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		case c == '#' && !inWord:
+			i = len(line)
+		case c == '\'':
+			j := strings.IndexByte(line[i+1:], '\'')
+			if j < 0 {
+				return nil, "", errors.New("unterminated '")
+			}
+			word.WriteString(line[i+1 : i+1+j])
+			inWord = true
+			i += j + 1
+		case c == '"':
+			inWord = true
+			for i++; ; i++ {
+				if i >= len(line) {
+					return nil, "", errors.New(`unterminated "`)
+				}
+				if line[i] == '"' {
+					break
+				}
+				if line[i] == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\' || line[i+1] == '$') {
+					i++
+					word.WriteByte(line[i])
+					continue
+				}
+				if line[i] == '$' {
+					i += expand(line[i:], &word) - 1
+					continue
+				}
+				word.WriteByte(line[i])
+			}
+		case c == '\\':
+			if i+1 < len(line) {
+				i++
+				word.WriteByte(line[i])
+				inWord = true
+			}
+		case c == '$':
+			i += expand(line[i:], &word) - 1
+			inWord = true
+		case c == '&' || c == ';':
+			flush()
+			return append(toks, token{s: string(c), op: true}), line[i+1:], nil
+		case c == '|' || c == '<':
+			flush()
+			toks = append(toks, token{s: string(c), op: true})
+		case c == '>':
+			if word.String() == "2" && inWord && (i == 0 || line[i-1] == '2') {
+				word.Reset()
+				inWord = false
+				toks = append(toks, token{s: "2>", op: true})
+				continue
+			}
+			flush()
+			if i+1 < len(line) && line[i+1] == '>' {
+				i++
+				toks = append(toks, token{s: ">>", op: true})
+			} else {
+				toks = append(toks, token{s: ">", op: true})
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	flush()
+	return toks, "", nil
+}
+
+// expand writes the value of the variable s starts with ($NAME or
+// ${NAME}) to w and returns how many bytes of s it took. A lone $ is
+// kept as it is.
+func expand(s string, w *strings.Builder) int {
+	if strings.HasPrefix(s, "${") {
+		if j := strings.IndexByte(s, '}'); j > 0 {
+			w.WriteString(os.Getenv(s[2:j]))
+			return j + 1
+		}
+	}
+	n := 1
+	for n < len(s) && (s[n] == '_' || s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z' || n > 1 && s[n] >= '0' && s[n] <= '9') {
+		n++
+	}
+	if n == 1 {
+		if len(s) > 1 && s[1] == '?' {
+			w.WriteString(fmt.Sprint(lastStatus))
+			return 2
+		}
+		w.WriteByte('$')
+		return 1
+	}
+	w.WriteString(os.Getenv(s[1:n]))
+	return n
+}
+
+// parse parses the first pipeline of a line, returning the rest of the
+// line. An empty pipeline has no commands.
+func parse(line string) (p pipeline, rest string, err error) {
+	toks, rest, err := lex(line)
+	if err != nil {
+		return pipeline{}, "", err
+	}
+	var cur command
+	var words []string // the tokens, for p.text
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if !t.op {
+			cur.args = append(cur.args, t.s)
+			words = append(words, t.s)
+			continue
+		}
+		switch t.s {
+		case "|":
+			if len(cur.args) == 0 {
+				return pipeline{}, "", errors.New("syntax error near |")
+			}
+			p.cmds = append(p.cmds, cur)
+			cur = command{}
+			words = append(words, t.s)
+		case "&":
+			p.background = true
+		case "<", ">", ">>", "2>":
+			if i+1 == len(toks) || toks[i+1].op {
+				return pipeline{}, "", fmt.Errorf("syntax error: %s needs a file", t.s)
+			}
+			i++
+			switch t.s {
+			case "<":
+				cur.in = toks[i].s
+			case ">", ">>":
+				cur.out, cur.appendOut = toks[i].s, t.s == ">>"
+			case "2>":
+				cur.errOut = toks[i].s
+			}
+			words = append(words, t.s, toks[i].s)
+		}
+	}
+	if len(cur.args) > 0 {
+		p.cmds = append(p.cmds, cur)
+	} else if len(p.cmds) > 0 || cur.in != "" || cur.out != "" || cur.errOut != "" || p.background {
+		return pipeline{}, "", errors.New("syntax error: missing command")
+	}
+	p.text = strings.Join(words, " ")
+	return p, rest, nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package gosh
+
+import "os"
+
+// signalStatus is the status of a process that didn't exit normally;
+// without wait statuses there's no signal number to add.
+func signalStatus(*os.ProcessState) int { return 128 }
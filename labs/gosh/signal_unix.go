@@ -0,0 +1,17 @@
+//go:build unix
+
+package gosh
+
+import (
+	"os"
+	"syscall"
+)
+
+// signalStatus is the status of a process killed by a signal: 128 plus
+// the signal's number, as sh reports it.
+func signalStatus(ps *os.ProcessState) int {
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return 128
+}
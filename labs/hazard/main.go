@@ -0,0 +1,203 @@
+// Hazard-pointer reclamation benchmark
+// Runs the lock-free Treiber stack (HW0/Q2/stack) and MS queue (package
+// queue) three ways: with the GC reclaiming nodes (the original
+// structures), with nodes recycled through hazard pointers (package
+// hazard), and with nodes recycled at once, ignoring hazard pointers.
+// Each of N goroutines pushes a unique value and pops one, -n times; the
+// structure is then drained and every value must have come out exactly
+// once. The table gives throughput, the values lost and duplicated, and
+// the domain's counts: nodes allocated (recycling keeps this near the
+// peak size rather than the total pushed), retired, still pending, and
+// scans. Unsafe reuse is the ABA problem made real: it takes more than
+// one CPU to see it, and a corrupted structure can hang, which -timeout
+// reports.
+//
+//	go run ./cmd/hazard
+//	go run ./cmd/hazard -goroutines 4,16 -n 200000 -threshold 64
+//	go run ./cmd/hazard -structures stack -modes unsafe -goroutines 8
+package hazard
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/operating-systems/HW0/Q2/stack"
+	"example.com/operating-systems/hazard"
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/queue"
+)
+
+var cmdline = labs.FlagSet("hazard")
+
+// subject is a stack or queue under test.
+type subject struct {
+	put   func(v int)
+	take  func() (int, bool)
+	stats func() (hazard.Stats, bool)
+}
+
+func newSubject(structure, mode string, cfg hazard.Config) (subject, error) {
+	cfg.Unsafe = mode == "unsafe"
+	noStats := func() (hazard.Stats, bool) { return hazard.Stats{}, false }
+	switch structure + "/" + mode {
+	case "stack/gc":
+		s := stack.NewTreiber()
+		return subject{func(v int) { s.Push(v) }, popper(s), noStats}, nil
+	case "stack/hazard", "stack/unsafe":
+		s, err := stack.NewTreiberHazard(cfg)
+		if err != nil {
+			return subject{}, err
+		}
+		return subject{func(v int) { s.Push(v) }, popper(s), func() (hazard.Stats, bool) { return s.Domain().Stats(), true }}, nil
+	case "queue/gc":
+		q := queue.NewMS[int]()
+		return subject{q.Enqueue, q.Dequeue, noStats}, nil
+	case "queue/hazard", "queue/unsafe":
+		q, err := queue.NewMSHazard[int](cfg)
+		if err != nil {
+			return subject{}, err
+		}
+		return subject{q.Enqueue, q.Dequeue, func() (hazard.Stats, bool) { return q.Domain().Stats(), true }}, nil
+	}
+	return subject{}, fmt.Errorf("hazard: unknown structure %q or mode %q (stack, queue; gc, hazard, unsafe)", structure, mode)
+}
+
+func popper(s stack.Concurrent) func() (int, bool) {
+	return func() (int, bool) {
+		v, err := s.Pop()
+		return v, err == nil
+	}
+}
+
+// result is one run.
+type result struct {
+	elapsed     time.Duration
+	lost, dupes int
+	hung        bool
+}
+
+func Main(args []string) {
+	cfg := hazard.DefaultConfig
+	var (
+		structures = cmdline.String("structures", "stack,queue", "comma-separated structures: stack | queue")
+		modes      = cmdline.String("modes", "gc,hazard,unsafe", "comma-separated reclamation: gc | hazard | unsafe")
+		gs         = cmdline.String("goroutines", "1,4,8", "comma-separated goroutine counts")
+		n          = cmdline.Int("n", 100000, "push-pop pairs per goroutine")
+		timeout    = cmdline.Duration("timeout", 10*time.Second, "give up on a run after this long")
+	)
+	cmdline.IntVar(&cfg.Threshold, "threshold", cfg.Threshold, "retired nodes a record holds before scanning (0: twice the hazard pointers of all records)")
+	defer labs.ParseBench(cmdline, args)()
+	counts, err := ints(*gs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "hazard: -goroutines:", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("%d CPUs, %d push-pop pairs per goroutine\n\n", runtime.NumCPU(), *n)
+	fmt.Printf("%-6s %-7s %4s %10s %8s %8s %10s %10s %8s %8s\n", "struct", "mode", "g", "Mops/s", "lost", "dupes", "allocated", "retired", "pending", "scans")
+	for _, st := range strings.Split(*structures, ",") {
+		for _, mode := range strings.Split(*modes, ",") {
+			st, mode := strings.TrimSpace(st), strings.TrimSpace(mode)
+			for _, g := range counts {
+				s, err := newSubject(st, mode, cfg)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(2)
+				}
+				r := run(s, g, *n, *timeout)
+				if r.hung {
+					fmt.Printf("%-6s %-7s %4d %10s  (no progress in %v: the structure is corrupted)\n", st, mode, g, "hung", *timeout)
+					continue
+				}
+				fmt.Printf("%-6s %-7s %4d %10.2f %8d %8d", st, mode, g, float64(2*g**n)/r.elapsed.Seconds()/1e6, r.lost, r.dupes)
+				if ds, ok := s.stats(); ok {
+					fmt.Printf(" %10d %10d %8d %8d", ds.Allocated, ds.Retired, ds.Pending(), ds.Scans)
+				} else {
+					fmt.Printf(" %10s %10s %8s %8s", "-", "-", "-", "-")
+				}
+				fmt.Println()
+			}
+		}
+	}
+}
+
+// run has g goroutines each put then take n times, drains s and checks
+// every value came out once. It gives up after timeout, leaving the
+// goroutines behind.
+func run(s subject, g, n int, timeout time.Duration) result {
+	var r result
+	total := g * n
+	finished := make(chan []int)
+	began := time.Now()
+	go func() {
+		got := make([][]int, g)
+		var wg sync.WaitGroup
+		for i := 0; i < g; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := 0; k < n; k++ {
+					s.put(i*n + k)
+					if v, ok := s.take(); ok {
+						got[i] = append(got[i], v)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		var all []int
+		for _, vs := range got {
+			all = append(all, vs...)
+		}
+		// A cycle would drain forever; more values than were put is
+		// already wrong.
+		for len(all) <= total {
+			v, ok := s.take()
+			if !ok {
+				break
+			}
+			all = append(all, v)
+		}
+		finished <- all
+	}()
+
+	select {
+	case all := <-finished:
+		r.elapsed = time.Since(began)
+		seen := make([]int, total)
+		for _, v := range all {
+			if v < 0 || v >= total {
+				r.dupes++ // a value never put: a node read after reuse
+				continue
+			}
+			if seen[v]++; seen[v] == 2 {
+				r.dupes++
+			}
+		}
+		for _, c := range seen {
+			if c == 0 {
+				r.lost++
+			}
+		}
+	case <-time.After(timeout):
+		r.hung = true
+	}
+	return r
+}
+
+func ints(s string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("bad value %q", f)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
@@ -14,24 +14,25 @@
 */
 
 /*Imports, packages and constants*/
-package main
+package hw0
 
 import (
 	"bufio"
 	"fmt"
 	"os"
-	"os/exec"
 	"strconv"
+
+	"example.com/operating-systems/labs"
 )
 
 const roleFlag = "--role=consumer"
 
-func main() {
+func Main(args []string) {
 	/*
 		Run as a prodcuer first
 		Then, when producer function runs code with consumer flag, run consumer
 	*/
-	if len(os.Args) > 1 && os.Args[1] == roleFlag {
+	if len(args) > 0 && args[0] == roleFlag {
 		consumer()
 		return
 	}
@@ -40,7 +41,7 @@ func main() {
 
 func producer() {
 	// Run program with consumer flag
-	cmd := exec.Command(os.Args[0], roleFlag)
+	cmd := labs.Command(roleFlag)
 
 	// Set up pipes
 	consumerStdin, _ := cmd.StdinPipe() // Producer writes here
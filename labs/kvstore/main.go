@@ -0,0 +1,364 @@
+// Key-value store benchmark and crash checker
+// Runs a random workload (-puts and -deletes percent, gets the rest, over
+// -keys keys of -value byte values) against a kvstore on each device in
+// -devices: memory, one raid.Disk file, or a RAID array of -disks disk
+// files made in a temporary directory. Every Get is checked against a
+// map of what the store should hold. The store is then closed and
+// reopened, and its recovery (replaying the whole log) timed and checked
+// the same way. The table gives throughput, write amplification (bytes
+// written to the device per byte of record), compactions, utilization
+// and recovery time.
+//
+// -crash N instead crashes a store in memory N times, at points spread
+// over the workload's block writes, reopens it and checks the recovered
+// contents are those after some prefix of the operations, no shorter
+// than the last Sync (every -sync operations).
+//
+//	go run ./cmd/kvstore
+//	go run ./cmd/kvstore -devices mem,raid1,raid5 -ops 20000 -value 200
+//	go run ./cmd/kvstore -crash 200 -sync 8 -ops 2000
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/HW7/raid"
+	"example.com/operating-systems/fs"
+	"example.com/operating-systems/kvstore"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("kvstore")
+
+var allDevices = []string{"mem", "disk", "raid0", "raid1", "raid4", "raid5"}
+
+// op is one operation of the workload.
+type op struct {
+	kind byte // 'p'ut, 'd'elete or 'g'et
+	key  string
+	val  []byte
+}
+
+// workload is the operations and how to build the store they run on.
+type workload struct {
+	ops              []op
+	blocks, segBlock int
+	cfg              kvstore.Config
+}
+
+func Main(args []string) {
+	cfg := kvstore.DefaultConfig
+	var (
+		devices = cmdline.String("devices", "mem,disk,raid5", "comma-separated devices: "+strings.Join(allDevices, ", "))
+		disks   = cmdline.Int("disks", 4, "disks in a RAID array")
+		blocks  = cmdline.Int("blocks", 1024, "blocks in the store")
+		seg     = cmdline.Int("seg", 16, "blocks per segment")
+		n       = cmdline.Int("ops", 5000, "operations")
+		keys    = cmdline.Int("keys", 500, "distinct keys")
+		value   = cmdline.Int("value", 100, "bytes per value")
+		puts    = cmdline.Int("puts", 60, "percent of operations that are puts")
+		deletes = cmdline.Int("deletes", 10, "percent of operations that are deletes")
+		seed    = cmdline.Int64("seed", 1, "workload seed")
+		crash   = cmdline.Int("crash", 0, "crash-check this many times on a memory device instead")
+		sync    = cmdline.Int("sync", 1, "-crash: operations between Syncs")
+	)
+	cmdline.IntVar(&cfg.SyncEvery, "sync-every", cfg.SyncEvery, "records appended before the log is written (0: only on Sync)")
+	cmdline.IntVar(&cfg.Low, "low", cfg.Low, "compact when fewer segments than this are free")
+	defer labs.ParseBench(cmdline, args)()
+	if *puts+*deletes > 100 || *keys < 1 || *sync < 1 {
+		fmt.Fprintln(os.Stderr, "kvstore: need -puts + -deletes at most 100, and -keys and -sync at least 1")
+		os.Exit(2)
+	}
+	w := workload{ops: generate(*n, *keys, *value, *puts, *deletes, *seed), blocks: *blocks, segBlock: *seg, cfg: cfg}
+
+	if *crash > 0 {
+		if err := crashCheck(w, *crash, *sync); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Printf("%d ops (%d%% put, %d%% delete) over %d keys of %d-byte values; %d blocks in %d-block segments\n\n",
+		*n, *puts, *deletes, *keys, *value, *blocks, *seg)
+	fmt.Printf("%-6s %10s %8s %8s %8s %8s %10s %9s %6s\n", "device", "ops/s", "wamp", "compact", "util", "keys", "recovery", "replayed", "check")
+	for _, name := range strings.Split(*devices, ",") {
+		name = strings.TrimSpace(name)
+		dir, err := os.MkdirTemp("", "kvstore")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		err = bench(name, *disks, dir, w)
+		os.RemoveAll(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// generate makes n operations on keys keys.
+func generate(n, keys, value, puts, deletes int, seed int64) []op {
+	rng := rand.New(rand.NewSource(seed))
+	ops := make([]op, n)
+	for i := range ops {
+		o := op{key: fmt.Sprintf("key%06d", rng.Intn(keys))}
+		switch p := rng.Intn(100); {
+		case p < puts:
+			o.kind, o.val = 'p', make([]byte, value)
+			rng.Read(o.val)
+		case p < puts+deletes:
+			o.kind = 'd'
+		default:
+			o.kind = 'g'
+		}
+		ops[i] = o
+	}
+	return ops
+}
+
+// apply does o to the store and to want, checking a Get against it.
+func apply(s *kvstore.Store, o op, want map[string][]byte) error {
+	switch o.kind {
+	case 'p':
+		if err := s.Put(o.key, o.val); err != nil {
+			return err
+		}
+		want[o.key] = o.val
+	case 'd':
+		if err := s.Delete(o.key); err != nil && !errors.Is(err, kvstore.ErrNotFound) {
+			return err
+		}
+		delete(want, o.key)
+	case 'g':
+		v, err := s.Get(o.key)
+		if errors.Is(err, kvstore.ErrNotFound) {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(v, want[o.key]) {
+			return fmt.Errorf("get %s: wrong value", o.key)
+		}
+	}
+	return nil
+}
+
+// contents reads everything in s.
+func contents(s *kvstore.Store) (map[string][]byte, error) {
+	m := map[string][]byte{}
+	for _, k := range s.Keys() {
+		v, err := s.Get(k)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func equal(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || !bytes.Equal(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// bench runs w on a store on device name and reports a row.
+func bench(name string, disks int, dir string, w workload) error {
+	dev, err := open(name, disks, dir, w.blocks)
+	if err != nil {
+		return err
+	}
+	if err := kvstore.Format(dev, w.blocks, w.segBlock); err != nil {
+		return err
+	}
+	s, err := kvstore.Open(dev, w.cfg)
+	if err != nil {
+		return err
+	}
+	want := map[string][]byte{}
+	began := time.Now()
+	for i, o := range w.ops {
+		if err := apply(s, o, want); err != nil {
+			return fmt.Errorf("op %d: %v", i, err)
+		}
+	}
+	elapsed := time.Since(began)
+	st, util := s.Stats(), s.Utilization()
+	if err := s.Close(); err != nil {
+		return err
+	}
+
+	began = time.Now()
+	s, err = kvstore.Open(dev, w.cfg)
+	if err != nil {
+		return fmt.Errorf("reopen: %v", err)
+	}
+	recovery := time.Since(began)
+	got, err := contents(s)
+	if err != nil {
+		return fmt.Errorf("reopen: %v", err)
+	}
+	check := "ok"
+	if !equal(got, want) {
+		check = "LOST"
+	}
+	fmt.Printf("%-6s %10.0f %8.2f %8d %7.0f%% %8d %10v %9d %6s\n", name, float64(len(w.ops))/elapsed.Seconds(),
+		st.WriteAmplification(), st.Compactions, 100*util, len(got), recovery.Round(time.Microsecond), s.Stats().Replayed, check)
+	return nil
+}
+
+// crashCheck crashes a store running w trials times and checks each
+// recovery.
+func crashCheck(w workload, trials, sync int) error {
+	base := fs.NewMemDevice(w.blocks)
+	if err := kvstore.Format(base, w.blocks, w.segBlock); err != nil {
+		return err
+	}
+	// Run it whole first, to count its writes.
+	counter := &fs.CrashDevice{Device: base.Clone(), Left: 1 << 30}
+	if _, _, err := runUntilCrash(counter, w, sync); err != nil {
+		return err
+	}
+	writes := 1<<30 - counter.Left
+
+	// states[j] is the contents after the first j operations.
+	states := []map[string][]byte{{}}
+	for _, o := range w.ops {
+		next := map[string][]byte{}
+		for k, v := range states[len(states)-1] {
+			next[k] = v
+		}
+		switch o.kind {
+		case 'p':
+			next[o.key] = o.val
+		case 'd':
+			delete(next, o.key)
+		}
+		states = append(states, next)
+	}
+
+	ok, lostSynced, bad := 0, 0, 0
+	var lost int
+	for t := 0; t < trials; t++ {
+		k := t * writes / trials
+		dev := base.Clone()
+		durable, issued, err := runUntilCrash(&fs.CrashDevice{Device: dev, Left: k}, w, sync)
+		if err != nil {
+			return err
+		}
+		s, err := kvstore.Open(dev, w.cfg)
+		if err != nil {
+			return fmt.Errorf("crash after %d writes: reopen: %v", k, err)
+		}
+		got, err := contents(s)
+		if err != nil {
+			return fmt.Errorf("crash after %d writes: %v", k, err)
+		}
+		match := -1
+		for j := issued; j >= 0; j-- {
+			if equal(got, states[j]) {
+				match = j
+				break
+			}
+		}
+		switch {
+		case match < 0:
+			bad++
+		case match < durable:
+			lostSynced++
+		default:
+			ok++
+			lost += issued - match
+		}
+	}
+	fmt.Printf("%d ops, %d block writes, %d crashes: %d recovered a prefix at least as long as the last sync, %d lost synced operations, %d recovered no prefix at all\n",
+		len(w.ops), writes, trials, ok, lostSynced, bad)
+	if ok > 0 {
+		fmt.Printf("%.1f unsynced operations lost per crash on average\n", float64(lost)/float64(ok))
+	}
+	if ok != trials {
+		return errors.New("kvstore: recovery failed")
+	}
+	return nil
+}
+
+// runUntilCrash runs w on dev until a write fails, syncing every sync
+// operations, and returns the operations synced and those begun.
+func runUntilCrash(dev fs.Device, w workload, sync int) (durable, issued int, err error) {
+	s, err := kvstore.Open(dev, w.cfg)
+	if err != nil {
+		return 0, 0, err
+	}
+	want := map[string][]byte{}
+	for i, o := range w.ops {
+		if err := apply(s, o, want); err != nil {
+			if errors.Is(err, fs.ErrCrashed) {
+				return durable, i + 1, nil
+			}
+			return 0, 0, fmt.Errorf("op %d: %v", i, err)
+		}
+		if (i+1)%sync == 0 {
+			if err := s.Sync(); err != nil {
+				if errors.Is(err, fs.ErrCrashed) {
+					return durable, i + 1, nil
+				}
+				return 0, 0, err
+			}
+			durable = i + 1
+		}
+	}
+	if err := s.Sync(); err != nil && !errors.Is(err, fs.ErrCrashed) {
+		return 0, 0, err
+	}
+	return durable, len(w.ops), nil
+}
+
+// open makes a device: memory, or disk files in dir.
+func open(name string, disks int, dir string, blocks int) (fs.Device, error) {
+	if name == "mem" {
+		return fs.NewMemDevice(blocks), nil
+	}
+	n := disks
+	if name == "disk" {
+		n = 1
+	}
+	var ds []*raid.Disk
+	for i := 0; i < n; i++ {
+		d, err := raid.OpenDisk(filepath.Join(dir, fmt.Sprintf("disk%d.dat", i)))
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	switch {
+	case name == "disk":
+		return ds[0], nil
+	case name == "raid0":
+		return fs.Array{RAID: raid.NewRAID0(ds)}, nil
+	case name == "raid1":
+		return fs.Array{RAID: raid.NewRAID1(ds)}, nil
+	case name == "raid4" && disks >= 2:
+		return fs.Array{RAID: raid.NewRAID4(ds)}, nil
+	case name == "raid5" && disks >= 3:
+		return fs.Array{RAID: raid.NewRAID5(ds)}, nil
+	case name == "raid4" || name == "raid5":
+		return nil, fmt.Errorf("%s needs more disks than %d", name, disks)
+	}
+	return nil, fmt.Errorf("unknown device %q (%s)", name, strings.Join(allDevices, ", "))
+}
@@ -0,0 +1,93 @@
+// Package labs holds what the oslabs subcommands share. Each experiment
+// is a package under labs with a Main(args) function that parses its own
+// flag set; cmd/oslabs runs every one of them from a single binary
+// ("oslabs sched -policy rr"), and a small main in each experiment's
+// original directory still runs it on its own ("go run ./cmd/sched").
+package labs
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"example.com/operating-systems/results"
+)
+
+// argv0 is how to run the current subcommand again: the program, then
+// the subcommand's name when one binary holds many.
+var argv0 []string
+
+// SetSubcommand records that this process is running subcommand name of
+// a binary that holds several, for Command and usage messages.
+func SetSubcommand(name string) {
+	argv0 = []string{name}
+}
+
+// Prog is how the current subcommand is invoked, for usage messages:
+// "oslabs sched", or the program's own name.
+func Prog() string {
+	base := os.Args[0]
+	if i := strings.LastIndexAny(base, `/\`); i >= 0 {
+		base = base[i+1:]
+	}
+	return strings.Join(append([]string{base}, argv0...), " ")
+}
+
+// Command returns a command that runs this program again, as the same
+// subcommand, with args: the other side of an experiment that needs a
+// second process.
+func Command(args ...string) *exec.Cmd {
+	self, _ := Binary()
+	return exec.Command(self, append(append([]string(nil), argv0...), args...)...)
+}
+
+// Binary returns the path of the running binary, and whether it is one
+// that holds every subcommand, so that "Binary() name args..." runs
+// subcommand name: true under oslabs, false under a single experiment's
+// own main.
+func Binary() (string, bool) {
+	self, err := os.Executable()
+	if err != nil {
+		self = os.Args[0]
+	}
+	return self, len(argv0) > 0
+}
+
+// FlagSet returns the flag set a subcommand parses its arguments with.
+// Every subcommand's -h has the same form: how to invoke it, then its
+// flags.
+func FlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [flags]\n", Prog())
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// BenchFlagSet is FlagSet for a benchmark: it adds -record, naming the
+// results store Record appends the run to.
+func BenchFlagSet(name string) *flag.FlagSet {
+	fs := FlagSet(name)
+	fs.String(results.RecordFlag, "", "append this run's settings and results to `file` (see oslabs compare)")
+	return fs
+}
+
+// Record appends a run of fs's benchmark that measured metrics to the
+// store -record names, with every flag's value as its config; without
+// -record it does nothing.
+func Record(fs *flag.FlagSet, metrics ...results.Metric) error {
+	f := fs.Lookup(results.RecordFlag)
+	if f == nil || f.Value.String() == "" {
+		return nil
+	}
+	config := results.FlagConfig(fs)
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := f.Value.(*profilePath); ok {
+			delete(config, f.Name) // where the profiles went isn't a setting
+		}
+	})
+	return results.Append(f.Value.String(), results.NewRun(fs.Name(), config, metrics...))
+}
@@ -0,0 +1,237 @@
+// Log-structured file system benchmark
+// Fills a file system with small files to each disk utilization asked
+// for, then overwrites them at random, hot/cold skewed (by default 90% of
+// the writes go to 10% of the files), and reports the disk traffic of the
+// overwrites on the vsfs layout of package fs and on the log-structured
+// file system of package fs/lfs with each cleaning policy.
+//
+// As in the LFS paper, reads are taken to hit a large cache, so only
+// writes reach the disk: the device counts blocks written and the seeks
+// between them (a write not to the block after the last one), and the
+// modeled time per overwrite is seeks*seek + blocks*xfer, with lfs
+// charged a seek and a segment transfer for every segment its cleaner
+// reads. vsfs updates data, inode and directory in place, a seek apiece;
+// lfs writes whole segments in one go, but the cleaner must read and
+// rewrite live blocks to make room, so its write cost (blocks read and
+// written per block of new data) rises with utilization, faster for
+// greedy than for cost-benefit under skew.
+//
+//	go run ./cmd/lfsbench
+//	go run ./cmd/lfsbench -util 0.5,0.8 -writes 20000 -hot 0.95 -hotfrac 0.05
+//	go run ./cmd/lfsbench -variants lfs-greedy,lfs-cb -seg 64
+package lfsbench
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"example.com/operating-systems/fs"
+	"example.com/operating-systems/fs/lfs"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("lfsbench")
+
+// target is a file system under test: vsfs and lfs share these.
+type target interface {
+	Mkdir(path string) error
+	WriteFile(path string, data []byte) error
+}
+
+func Main(args []string) {
+	var (
+		variants = cmdline.String("variants", "vsfs,lfs-greedy,lfs-cb", "comma-separated file systems: vsfs, lfs-greedy, lfs-cb")
+		utils    = cmdline.String("util", "0.3,0.5,0.7", "comma-separated utilizations to fill to")
+		blocks   = cmdline.Int("blocks", 4096, "device blocks")
+		seg      = cmdline.Int("seg", 32, "lfs: blocks per segment")
+		size     = cmdline.Int("size", 2000, "bytes per file")
+		dirs     = cmdline.Int("dirs", 16, "directories the files are spread over")
+		writes   = cmdline.Int("writes", 10000, "overwrites to measure")
+		hot      = cmdline.Float64("hot", 0.9, "fraction of the writes that go to the hot files")
+		hotFrac  = cmdline.Float64("hotfrac", 0.1, "fraction of the files that are hot")
+		low      = cmdline.Int("low", lfs.DefaultCleaner.Low, "lfs: clean when fewer segments than this are free")
+		high     = cmdline.Int("high", lfs.DefaultCleaner.High, "lfs: clean until this many are")
+		seek     = cmdline.Float64("seek", 8, "modeled ms per seek")
+		xfer     = cmdline.Float64("xfer", 0.05, "modeled ms per block transferred")
+		seed     = cmdline.Int64("seed", 1, "random seed")
+	)
+	defer labs.ParseBench(cmdline, args)()
+
+	us, err := parseFloats(*utils)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	type row struct {
+		variant string
+		util    float64
+		r       result
+	}
+	var rows []row
+	for _, u := range us {
+		for _, v := range strings.Split(*variants, ",") {
+			v = strings.TrimSpace(v)
+			c := cfg{blocks: *blocks, seg: *seg, size: *size, dirs: *dirs, writes: *writes,
+				hot: *hot, hotFrac: *hotFrac, util: u, cleaner: lfs.Cleaner{Low: *low, High: *high}, seed: *seed}
+			r, err := run(v, c)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s at %.0f%%: %v\n", v, 100*u, err)
+				os.Exit(1)
+			}
+			fmt.Printf("%-10s util %3.0f%%: %d files, %d overwrites: %d blocks written, %d seeks\n",
+				v, 100*u, r.files, *writes, r.written, r.seeks)
+			rows = append(rows, row{v, u, r})
+		}
+	}
+
+	fmt.Printf("\n%-10s %5s %6s %11s %9s %10s %9s %8s %11s\n",
+		"variant", "util", "live", "written/op", "seeks/op", "ms/op", "cleaned", "clean u", "write cost")
+	for _, row := range rows {
+		r, w := row.r, float64(*writes)
+		seeks, blocks := r.seeks+r.stats.Cleaned, r.written+r.stats.CleanerRead
+		ms := (float64(seeks)**seek + float64(blocks)**xfer) / w
+		fmt.Printf("%-10s %4.0f%% %5.0f%% %11.2f %9.2f %10.2f", row.variant, 100*row.util, 100*r.live,
+			float64(r.written)/w, float64(seeks)/w, ms)
+		if r.lfs {
+			fmt.Printf(" %9d %7.0f%% %11.2f\n", r.stats.Cleaned, 100*r.stats.CleanedUtilization(*seg), r.stats.WriteCost())
+		} else {
+			fmt.Printf(" %9s %8s %11s\n", "-", "-", "-")
+		}
+	}
+}
+
+// cfg is one run's workload.
+type cfg struct {
+	blocks, seg, size, dirs, writes int
+	hot, hotFrac, util              float64
+	cleaner                         lfs.Cleaner
+	seed                            int64
+}
+
+// result is what the overwrites cost.
+type result struct {
+	files          int
+	written, seeks int
+	live           float64 // the log's live fraction at the end (lfs)
+	lfs            bool
+	stats          lfs.Stats
+}
+
+// run fills variant v to c.util and measures c.writes overwrites.
+func run(v string, c cfg) (result, error) {
+	var r result
+	mem := fs.NewMemDevice(c.blocks)
+	dev := &meter{Device: mem, last: -2}
+	// A file takes its data blocks and, in lfs, an inode block
+	per := (c.size+fs.BlockSize-1)/fs.BlockSize + 1
+	r.files = int(c.util * float64(c.blocks) / float64(per))
+	var t target
+	var l *lfs.FS
+	switch v {
+	case "vsfs":
+		if err := fs.Mkfs(dev, c.blocks, r.files+c.dirs+1, 0); err != nil {
+			return r, err
+		}
+		f, err := fs.Mount(dev)
+		if err != nil {
+			return r, err
+		}
+		t = f
+	case "lfs-greedy", "lfs-cb":
+		c.cleaner.Policy = lfs.Greedy
+		if v == "lfs-cb" {
+			c.cleaner.Policy = lfs.CostBenefit
+		}
+		if err := lfs.Mkfs(dev, c.blocks, c.seg, r.files+c.dirs+1); err != nil {
+			return r, err
+		}
+		f, err := lfs.Mount(dev, c.cleaner)
+		if err != nil {
+			return r, err
+		}
+		t, l, r.lfs = f, f, true
+	default:
+		return r, fmt.Errorf("unknown variant %q (vsfs, lfs-greedy, lfs-cb)", v)
+	}
+
+	rng := rand.New(rand.NewSource(c.seed))
+	data := make([]byte, c.size)
+	path := func(i int) string { return fmt.Sprintf("/d%d/f%d", i%c.dirs, i) }
+	for d := 0; d < c.dirs; d++ {
+		if err := t.Mkdir(fmt.Sprintf("/d%d", d)); err != nil {
+			return r, err
+		}
+	}
+	for i := 0; i < r.files; i++ {
+		rng.Read(data)
+		if err := t.WriteFile(path(i), data); err != nil {
+			return r, fmt.Errorf("filling, file %d of %d: %v", i, r.files, err)
+		}
+	}
+
+	var base lfs.Stats
+	if l != nil {
+		base = l.Stats()
+	}
+	dev.writes, dev.seeks = 0, 0
+	hotFiles := max(1, int(c.hotFrac*float64(r.files)))
+	for w := 0; w < c.writes; w++ {
+		i := rng.Intn(hotFiles)
+		if rng.Float64() >= c.hot && r.files > hotFiles {
+			i = hotFiles + rng.Intn(r.files-hotFiles)
+		}
+		rng.Read(data)
+		if err := t.WriteFile(path(i), data); err != nil {
+			return r, fmt.Errorf("write %d: %v", w, err)
+		}
+	}
+	r.written, r.seeks = dev.writes, dev.seeks
+	if l != nil {
+		s := l.Stats()
+		r.stats = lfs.Stats{
+			Written:        s.Written - base.Written,
+			CleanerRead:    s.CleanerRead - base.CleanerRead,
+			CleanerWritten: s.CleanerWritten - base.CleanerWritten,
+			Cleaned:        s.Cleaned - base.Cleaned,
+			CleanedLive:    s.CleanedLive - base.CleanedLive,
+			SegmentWrites:  s.SegmentWrites - base.SegmentWrites,
+			Checkpoints:    s.Checkpoints - base.Checkpoints,
+		}
+		r.live = l.Utilization()
+	} else {
+		r.live = c.util
+	}
+	return r, nil
+}
+
+// meter counts a device's block writes, and a seek for every write that
+// doesn't follow on from the last.
+type meter struct {
+	fs.Device
+	last          int
+	writes, seeks int
+}
+
+func (m *meter) WriteBlock(n int, data []byte) error {
+	if n != m.last+1 && n != m.last {
+		m.seeks++
+	}
+	m.last = n
+	m.writes++
+	return m.Device.WriteBlock(n, data)
+}
+
+func parseFloats(s string) ([]float64, error) {
+	var out []float64
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || v <= 0 || v >= 1 {
+			return nil, fmt.Errorf("bad utilization %q: want a fraction between 0 and 1", f)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
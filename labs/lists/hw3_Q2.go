@@ -0,0 +1,119 @@
+package lists
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/clist"
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/results"
+)
+
+var cmdline = labs.BenchFlagSet("lists")
+
+/**********************************
+ * Benchmark / workload harness
+ **********************************/
+
+type config struct {
+	impl         string        // "coarse", "hoh", or "both"
+	workers      int           // goroutines
+	writePercent int           // 0..100 (rest are reads)
+	duration     time.Duration // per trial
+	preload      int           // initial size
+	keyspace     int           // random key range
+	seed         int64
+}
+
+// parseFlags parses args; defer the function it returns, which writes any
+// profiles asked for.
+func parseFlags(args []string) (config, func()) {
+	var c config
+	cmdline.StringVar(&c.impl, "impl", "both", "which impl to run: coarse | hoh | both")
+	cmdline.IntVar(&c.workers, "workers", 8, "number of goroutines")
+	cmdline.IntVar(&c.writePercent, "writePercent", 10, "percent of insert operations (0..100)")
+	cmdline.DurationVar(&c.duration, "duration", 3*time.Second, "how long to run each trial")
+	cmdline.IntVar(&c.preload, "preload", 20000, "how many keys to insert before running")
+	cmdline.IntVar(&c.keyspace, "keyspace", 100000, "range of random keys used by workers")
+	cmdline.Int64Var(&c.seed, "seed", time.Now().UnixNano(), "random seed")
+	stop := labs.ParseBench(cmdline, args)
+	return c, stop
+}
+
+func preloadList(L clist.List, n, keyspace int, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		L.Insert(r.Intn(keyspace))
+	}
+}
+
+type result struct {
+	ops uint64
+}
+
+func runTrial(name string, L clist.List, c config) result {
+	var ops uint64
+	stop := time.Now().Add(c.duration)
+
+	var wg sync.WaitGroup
+	wg.Add(c.workers)
+
+	// Give each worker its own RNG to avoid contention
+	for w := 0; w < c.workers; w++ {
+		wseed := c.seed + int64(w)*101
+		r := rand.New(rand.NewSource(wseed))
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(stop) {
+				k := r.Intn(c.keyspace)
+				// choose op
+				if r.Intn(100) < c.writePercent {
+					L.Insert(k)
+				} else {
+					L.Contains(k)
+				}
+				atomic.AddUint64(&ops, 1)
+			}
+		}()
+	}
+
+	wg.Wait()
+	return result{ops: ops}
+}
+
+func Main(args []string) {
+	c, stop := parseFlags(args)
+	defer stop()
+	fmt.Printf("Concurrent Linked List Benchmark\n")
+	fmt.Printf("impl=%s workers=%d write%%=%d duration=%s preload=%d keyspace=%d\n\n",
+		c.impl, c.workers, c.writePercent, c.duration, c.preload, c.keyspace)
+
+	var metrics []results.Metric
+	run := func(name string, newList func() clist.List) {
+		L := newList()
+		preloadList(L, c.preload, c.keyspace, c.seed)
+		res := runTrial(name, L, c)
+		opsPerSec := float64(res.ops) / c.duration.Seconds()
+		fmt.Printf("%-12s  total_ops=%d  ops/sec=%.0f\n", name, res.ops, opsPerSec)
+		metrics = append(metrics, results.Rate(name, opsPerSec, "ops/s"))
+	}
+
+	switch c.impl {
+	case "coarse":
+		run("coarse-lock", func() clist.List { return clist.NewCoarseList() })
+	case "hoh":
+		run("hand-over", func() clist.List { return clist.NewHoHList() })
+	case "both":
+		run("coarse-lock", func() clist.List { return clist.NewCoarseList() })
+		run("hand-over", func() clist.List { return clist.NewHoHList() })
+	default:
+		fmt.Println("unknown -impl; use coarse | hoh | both")
+		return
+	}
+	if err := labs.Record(cmdline, metrics...); err != nil {
+		fmt.Println("record:", err)
+	}
+}
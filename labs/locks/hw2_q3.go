@@ -1,14 +1,16 @@
-package main
+package locks
 
 import (
-	"flag"
 	"fmt"
-	"math"
+	"os"
 	"runtime"
-	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/results"
+	"example.com/operating-systems/stats"
 )
 
 /*
@@ -95,44 +97,13 @@ type Summary struct {
 }
 
 func summarize(ds []time.Duration) Summary {
-	n := len(ds)
-	if n == 0 {
-		return Summary{}
-	}
-
-	vals := make([]float64, n)
-	var sum, max float64
-	for i, d := range ds {
-		v := float64(d.Nanoseconds())
-		vals[i] = v
-		sum += v
-		if v > max {
-			max = v
-		}
-	}
-	sort.Float64s(vals)
-
-	// Return the q-th percentile with simple linear interpolation.
-	percentile := func(q float64) float64 {
-		if n == 1 {
-			return vals[0]
-		}
-		pos := q * float64(n-1)
-		lo := int(math.Floor(pos))
-		hi := int(math.Ceil(pos))
-		if lo == hi {
-			return vals[lo]
-		}
-		f := pos - float64(lo)
-		return vals[lo]*(1-f) + vals[hi]*f
-	}
-
+	s := stats.Summarize(ds)
 	return Summary{
-		N:      n,
-		MeanNS: sum / float64(n),
-		P50NS:  percentile(0.50),
-		P95NS:  percentile(0.95),
-		MaxNS:  max,
+		N:      s.N,
+		MeanNS: float64(s.Mean.Nanoseconds()),
+		P50NS:  float64(s.Quantile(0.50).Nanoseconds()),
+		P95NS:  float64(s.Quantile(0.95).Nanoseconds()),
+		MaxNS:  float64(s.Max.Nanoseconds()),
 	}
 }
 
@@ -185,15 +156,17 @@ func run(lock Lock, goroutines, iters, csUS int) Summary {
 
 /* ---------------- main + flags ---------------- */
 
-func main() {
+var cmdline = labs.BenchFlagSet("locks")
+
+func Main(args []string) {
 	var (
-		lockType   = flag.String("type", "ticket", "lock type: ticket | cas")
-		goroutines = flag.Int("goroutines", 8, "number of goroutines contending")
-		iters      = flag.Int("iters", 100000, "lock acquisitions per goroutine")
-		csUS       = flag.Int("csus", 2, "critical-section time (microseconds)")
-		gmp        = flag.Int("gomaxprocs", runtime.NumCPU(), "number of CPUs to use")
+		lockType   = cmdline.String("type", "ticket", "lock type: ticket | cas")
+		goroutines = cmdline.Int("goroutines", 8, "number of goroutines contending")
+		iters      = cmdline.Int("iters", 100000, "lock acquisitions per goroutine")
+		csUS       = cmdline.Int("csus", 2, "critical-section time (microseconds)")
+		gmp        = cmdline.Int("gomaxprocs", runtime.NumCPU(), "number of CPUs to use")
 	)
-	flag.Parse()
+	defer labs.ParseBench(cmdline, args)()
 
 	// Limit how many CPUs the Go scheduler uses.
 	runtime.GOMAXPROCS(*gmp)
@@ -206,7 +179,8 @@ func main() {
 	case "cas":
 		l = &CASLock{}
 	default:
-		panic("unknown -type (use 'ticket' or 'cas')")
+		fmt.Fprintln(os.Stderr, "unknown -type (use 'ticket' or 'cas')")
+		os.Exit(2)
 	}
 
 	// Short warmup so the scheduler settles a bit.
@@ -219,4 +193,11 @@ func main() {
 		*lockType, *goroutines, *iters, *csUS, *gmp)
 	fmt.Printf("Wait (ns): mean=%.0f  p50=%.0f  p95=%.0f  max=%.0f  (N=%d)\n",
 		s.MeanNS, s.P50NS, s.P95NS, s.MaxNS, s.N)
+
+	ns := func(v float64) time.Duration { return time.Duration(v) }
+	if err := labs.Record(cmdline,
+		results.Duration("wait mean", ns(s.MeanNS)), results.Duration("wait p50", ns(s.P50NS)),
+		results.Duration("wait p95", ns(s.P95NS)), results.Duration("wait max", ns(s.MaxNS))); err != nil {
+		fmt.Println("record:", err)
+	}
 }
@@ -0,0 +1,222 @@
+// Remote logging (HW8 extension)
+// -remote udp|tcp adds an eighth logger, RemoteLogger, which ships each
+// entry as a syslog message to a collector: this program re-run with
+// -collect, the bundled tiny syslog server. The collector parses each
+// message back into an entry and writes it through a MutexLogger of its
+// own to remote.log, with the benchmark's -sync and -format, so
+// logcheck checks that too. Over TCP it syncs each burst of messages
+// (LogDurable on the burst's last entry) before answering with how many
+// it has synced, which is what the remote LogDurable and Close wait for;
+// over UDP nothing answers and a dropped datagram is lost, which the
+// collector's count at the end shows.
+
+package logbench
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/labs"
+)
+
+// remoteLog is the file the collector writes.
+const remoteLog = "remote.log"
+
+// collectChild runs the collector on a free loopback port: it prints
+// the address it listens on, collects until its stdin closes, then
+// prints how many messages it received.
+func collectChild(network string, batchN int, opts logger.Options) error {
+	l, err := logger.NewMutexLoggerWith(remoteLog, batchN, opts)
+	if err != nil {
+		return err
+	}
+	var received, bad atomic.Int64
+	handle := func(msg string, durable bool) {
+		e, err := logger.ParseSyslog(msg)
+		if err != nil {
+			bad.Add(1)
+			return
+		}
+		received.Add(1)
+		if durable {
+			<-l.LogDurable(e)
+		} else {
+			l.Log(e)
+		}
+	}
+	var stop func()
+	switch network {
+	case "udp":
+		stop, err = collectUDP(handle)
+	case "tcp":
+		stop, err = collectTCP(handle)
+	default:
+		err = fmt.Errorf("unknown network %q (udp, tcp)", network)
+	}
+	if err != nil {
+		l.Close()
+		return err
+	}
+	io.Copy(io.Discard, os.Stdin) // until the benchmark is done
+	stop()
+	if err := l.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("received %d %d\n", received.Load(), bad.Load())
+	return nil
+}
+
+// collectUDP takes a message a datagram. Its stop reads what is still
+// queued, until the socket has been quiet a moment.
+func collectUDP(handle func(msg string, durable bool)) (stop func(), err error) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	if uc, ok := pc.(*net.UDPConn); ok {
+		uc.SetReadBuffer(4 << 20) // as much as the kernel allows, up to this
+	}
+	fmt.Println("listening on", pc.LocalAddr())
+	var draining atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 64<<10)
+		for {
+			if draining.Load() {
+				pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			}
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			handle(string(buf[:n]), false)
+		}
+	}()
+	return func() {
+		draining.Store(true)
+		pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		<-done
+		pc.Close()
+	}, nil
+}
+
+// collectTCP takes length-prefixed messages on each connection and, when
+// a connection has nothing more buffered, syncs and answers. Its stop
+// stops accepting and waits for the connections to hang up.
+func collectTCP(handle func(msg string, durable bool)) (stop func(), err error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("listening on", ln.Addr())
+	var wg sync.WaitGroup
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer conn.Close()
+				br := bufio.NewReaderSize(conn, 64<<10)
+				var n uint64
+				var ack [8]byte
+				for {
+					msg, err := readFrame(br)
+					if err != nil {
+						return
+					}
+					n++
+					last := br.Buffered() == 0
+					handle(msg, last)
+					if last {
+						binary.LittleEndian.PutUint64(ack[:], n)
+						if _, err := conn.Write(ack[:]); err != nil {
+							return
+						}
+					}
+				}
+			}()
+		}
+	}()
+	return func() {
+		ln.Close()
+		wg.Wait()
+	}, nil
+}
+
+// readFrame reads one octet-counted message: its length, a space, and
+// that many bytes.
+func readFrame(br *bufio.Reader) (string, error) {
+	length, err := br.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil || n < 0 || n > 1<<20 {
+		return "", fmt.Errorf("bad frame length %q", length)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(br, msg); err != nil {
+		return "", err
+	}
+	return string(msg), nil
+}
+
+// collector is the running collector process.
+type collector struct {
+	addr  string
+	stdin io.WriteCloser
+	out   *bufio.Scanner
+	wait  func() error
+}
+
+// startCollector starts the collector, re-running this program with
+// args, and waits for it to say where it listens.
+func startCollector(args []string, network string) (*collector, error) {
+	cmd := labs.Command(append(args, "-collect", network)...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	c := &collector{stdin: stdin, out: bufio.NewScanner(stdout), wait: cmd.Wait}
+	if !c.out.Scan() {
+		stdin.Close()
+		cmd.Wait()
+		return nil, errors.New("collector exited before listening")
+	}
+	c.addr, _ = strings.CutPrefix(c.out.Text(), "listening on ")
+	return c, nil
+}
+
+// stop tells the collector the benchmark is done and returns how many
+// messages it received and how many of those it couldn't parse.
+func (c *collector) stop() (received, bad int64, err error) {
+	c.stdin.Close()
+	if c.out.Scan() {
+		fmt.Sscanf(c.out.Text(), "received %d %d", &received, &bad)
+	}
+	return received, bad, c.wait()
+}
@@ -0,0 +1,264 @@
+// Crash test (HW8 extension)
+// -crash runs the benchmark's producers in a child process (this program
+// re-run with -crash-child) logging binary records to crash.log, kills
+// it with SIGKILL after the given time, and reads back what is on disk.
+// A kill leaves every write() that finished in the page cache, so the
+// log usually ends on a record boundary; -tear also cuts the file at a
+// random byte, as losing power before the last pages were synced would.
+// Either way ReadBinary recovers the records up to the first torn one,
+// and each goroutine's recovered entries must be a prefix of what it
+// logged: no holes before the tear.
+//
+// The child also tells the parent, over its stdout, of every entry the
+// logger has acknowledged: once Log has returned, or with -durable once
+// LogDurable's channel has said it is synced. So the parent can count
+// the acknowledged entries that didn't survive. For a logger that writes
+// in Log, a kill loses none; a channel or ring logger's Log returns
+// before its writer has the entry, so its acknowledgements promise
+// nothing until -durable. -crash-logger takes a list of loggers, or
+// all, and runs each in turn; -crash-random kills each child at a random
+// point up to the -crash time instead of at it.
+
+package logbench
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/results"
+)
+
+// crashLog is the file the child writes.
+const crashLog = "crash.log"
+
+// crashLoggers are the loggers -crash-logger all runs: those that write
+// one file.
+var crashLoggers = []string{"naive", "mutex", "channel", "ring", "group", "mmap", "append", "combine"}
+
+// crashChild logs entries from goroutines goroutines through the kind of
+// logger named until it is killed, printing "g i" as goroutine g's entry
+// i is acknowledged.
+func crashChild(path, kind string, goroutines, batchN int, durable bool, opts logger.Options) error {
+	opts.Encoder = logger.Binary
+	opts.MinLevel = logger.LevelDebug // a filtered entry would count as acknowledged and lost
+	var (
+		l   logger.DurableLogger
+		err error
+	)
+	switch kind {
+	case "naive":
+		l, err = logger.NewNaiveLoggerWith(path, opts)
+	case "mutex":
+		l, err = logger.NewMutexLoggerWith(path, batchN, opts)
+	case "channel":
+		l, err = logger.NewChannelLoggerWith(path, batchN, 200, opts)
+	case "ring":
+		l, err = logger.NewRingLoggerWith(path, batchN, 1024, opts)
+	case "group":
+		l, err = logger.NewGroupCommitLoggerWith(path, 0, opts)
+	case "mmap":
+		l, err = logger.NewMmapLoggerWith(path, logger.DefaultMmapWindow, batchN, opts)
+	case "append":
+		l, err = logger.NewAppendLoggerWith(path, batchN, opts)
+	case "combine":
+		l, err = logger.NewCombiningLoggerWith(path, batchN, 0, opts)
+	default:
+		return fmt.Errorf("unknown logger %q (%s)", kind, strings.Join(crashLoggers, ", "))
+	}
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, release := perGoroutine(l)
+			defer release()
+			for i := 0; ; i++ {
+				e := randEntry(g, i)
+				var err error
+				if durable {
+					err = <-l.LogDurable(e)
+				} else {
+					err = l.Log(e)
+				}
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "crash child:", err)
+					return
+				}
+				// One unbuffered write, so that a kill can't lose it.
+				fmt.Printf("%d %d\n", g, i)
+			}
+		}()
+	}
+	wg.Wait()
+	return l.Close()
+}
+
+// crashResult is what one crash left.
+type crashResult struct {
+	kind      string
+	after     time.Duration // when the child was killed
+	size      int64         // bytes in the log, after any tear
+	recovered int           // records ReadBinary recovered
+	acked     int           // entries the child heard acknowledged
+	lost      int           // of those, not recovered
+	holes     int           // recovered entries not following their goroutine's last
+}
+
+// crashTest crashes a child for each kind of logger and reports what
+// survived. A child is killed after limit, or with random at a random
+// point up to it. It fails if any log has holes, or if with durable an
+// acknowledged entry was lost to a kill alone.
+func crashTest(args []string, kinds []string, limit time.Duration, random, tear, durable bool) error {
+	for _, kind := range kinds {
+		if !slices.Contains(crashLoggers, kind) {
+			return fmt.Errorf("unknown logger %q (%s, or all)", kind, strings.Join(crashLoggers, ", "))
+		}
+	}
+	var rs []crashResult
+	for _, kind := range kinds {
+		after := limit
+		if random {
+			after = time.Duration(rand.Int63n(int64(limit))) + 1
+		}
+		r, err := crash(args, kind, after, tear)
+		if err != nil {
+			return fmt.Errorf("%s: %v", kind, err)
+		}
+		rs = append(rs, r)
+	}
+
+	if len(rs) > 1 {
+		ack := "Log returned"
+		if durable {
+			ack = "synced"
+		}
+		fmt.Printf("\nacknowledged = %s\n", ack)
+		fmt.Printf("%-8s %10s %10s %10s %10s %10s %8s\n", "logger", "killed at", "acked", "acked lost", "recovered", "unacked", "holes")
+		for _, r := range rs {
+			fmt.Printf("%-8s %10v %10d %10d %10d %10d %8d\n", r.kind, r.after.Round(time.Millisecond), r.acked, r.lost,
+				r.recovered, r.recovered-(r.acked-r.lost), r.holes)
+		}
+	}
+	var metrics []results.Metric
+	var bad []string
+	for _, r := range rs {
+		metrics = append(metrics,
+			results.Metric{Name: "crash-" + r.kind + "-acked", Value: float64(r.acked), Unit: "entries", Better: results.Higher},
+			results.Metric{Name: "crash-" + r.kind + "-acked-lost", Value: float64(r.lost), Unit: "entries", Better: results.Lower},
+			results.Metric{Name: "crash-" + r.kind + "-recovered", Value: float64(r.recovered), Unit: "entries", Better: results.Higher})
+		if r.holes > 0 || durable && !tear && r.lost > 0 {
+			bad = append(bad, r.kind)
+		}
+	}
+	if err := labs.Record(cmdline, metrics...); err != nil {
+		fmt.Println("record:", err)
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("lost entries it shouldn't have: %s", strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// crash runs a child logging through kind until after, kills it,
+// optionally tears the log, and reports what ReadBinary recovers against
+// what the child heard acknowledged.
+func crash(args []string, kind string, after time.Duration, tear bool) (crashResult, error) {
+	r := crashResult{kind: kind, after: after}
+	os.Remove(crashLog)
+	cmd := labs.Command(append(args, "-crash-logger", kind, "-crash-child", crashLog)...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return r, err
+	}
+	if err := cmd.Start(); err != nil {
+		return r, err
+	}
+	acked := map[int]int{} // goroutine: entries 0..n-1 acknowledged
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		sc := bufio.NewScanner(stdout)
+		for sc.Scan() {
+			gs, is, _ := strings.Cut(sc.Text(), " ")
+			g, err1 := strconv.Atoi(gs)
+			i, err2 := strconv.Atoi(is)
+			if err1 == nil && err2 == nil && i+1 > acked[g] {
+				acked[g] = i + 1
+			}
+		}
+	}()
+	time.Sleep(after)
+	if err := cmd.Process.Kill(); err != nil {
+		return r, err
+	}
+	<-read // what the child wrote before it died
+	cmd.Wait()
+
+	fi, err := os.Stat(crashLog)
+	if err != nil {
+		return r, err
+	}
+	r.size = fi.Size()
+	fmt.Printf("crash: killed the %s logger after %v; %s holds %d bytes\n", kind, after.Round(time.Microsecond), crashLog, r.size)
+	if tear && r.size > 0 {
+		r.size = rand.Int63n(r.size)
+		if err := os.Truncate(crashLog, r.size); err != nil {
+			return r, err
+		}
+		fmt.Printf("  tore the file at byte %d, as if the pages after it were never synced\n", r.size)
+	}
+
+	f, err := os.Open(crashLog)
+	if err != nil {
+		return r, err
+	}
+	defer f.Close()
+	entries, valid, err := logger.ReadBinary(f)
+	r.recovered = len(entries)
+	switch {
+	case errors.Is(err, logger.ErrTorn):
+		fmt.Printf("  %d records recovered (%d bytes); stopped at %v; %d bytes after it discarded\n",
+			len(entries), valid, err, r.size-valid)
+	case err != nil:
+		return r, err
+	default:
+		fmt.Printf("  %d records recovered (%d bytes); the log ends on a record boundary\n", len(entries), valid)
+	}
+
+	// Each goroutine logged 0, 1, 2, ... in order, and the log is
+	// written in order, so what survives of it is 0..k-1.
+	next := map[int]int{}
+	for _, e := range entries {
+		g, i := int(e.Fields["goroutine"].(float64)), int(e.Fields["seq"].(float64))
+		if i != next[g] {
+			r.holes++
+		}
+		next[g] = i + 1
+	}
+	for g, n := range acked {
+		r.acked += n
+		r.lost += max(n-next[g], 0)
+	}
+	if r.holes > 0 {
+		fmt.Printf("  %d recovered entries don't follow their goroutine's one before\n", r.holes)
+	} else {
+		fmt.Printf("  every goroutine's recovered entries are a prefix of what it logged (%d goroutines)\n", len(next))
+	}
+	fmt.Printf("  %d entries acknowledged, %d of them lost; %d recovered entries not yet acknowledged\n",
+		r.acked, r.lost, r.recovered-(r.acked-r.lost))
+	return r, nil
+}
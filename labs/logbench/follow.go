@@ -0,0 +1,83 @@
+// Follow mode (HW8 extension)
+// -follow runs the consumer's half of the experiment: while a logger
+// runs, a LogReader tails each of its files and times every entry from
+// its timestamp, taken as it was logged, to when the reader parsed it
+// back: producer to disk to reader. That needs the JSON format, whose
+// timestamps keep nanoseconds; text keeps seconds.
+
+package logbench
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/stats"
+)
+
+// follower tails a logger's files while it runs.
+type follower struct {
+	cancel context.CancelFunc
+	poll   time.Duration
+	wg     sync.WaitGroup
+	read   atomic.Int64
+
+	mu      sync.Mutex // over the rest, which each reader adds to as it stops
+	skipped int
+	lat     []time.Duration
+	err     error
+}
+
+// startFollow starts a LogReader following each of paths, looking for
+// more every poll.
+func startFollow(paths []string, poll time.Duration) *follower {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &follower{cancel: cancel, poll: poll}
+	for _, path := range paths {
+		r := logger.NewLogReader(path)
+		r.Poll = poll
+		entries := r.Follow(ctx)
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			var lat []time.Duration
+			for e := range entries {
+				f.read.Add(1)
+				if e.Timestamp.IsZero() {
+					continue // a torn line that happened to parse
+				}
+				lat = append(lat, time.Since(e.Timestamp))
+			}
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.lat = append(f.lat, lat...)
+			f.skipped += r.Skipped
+			if err := r.Err(); err != nil && f.err == nil {
+				f.err = err
+			}
+		}()
+	}
+	return f
+}
+
+// stop waits for the readers to catch up with the want entries the
+// logger wrote, or for grace to pass, stops them and prints what they
+// read. It returns every entry's end-to-end latency.
+func (f *follower) stop(want int64, grace time.Duration) []time.Duration {
+	for deadline := time.Now().Add(grace); f.read.Load() < want && time.Now().Before(deadline); {
+		time.Sleep(f.poll)
+	}
+	f.cancel()
+	f.wg.Wait()
+	if f.err != nil {
+		fmt.Println("  follow:", f.err)
+		return nil
+	}
+	l := stats.Summarize(f.lat)
+	fmt.Printf("  follow: read %d of %d entries (%d unparsable lines): end-to-end p50=%v  p99=%v  max=%v\n",
+		f.read.Load(), want, f.skipped, l.Quantile(0.50).Round(time.Microsecond), l.Quantile(0.99).Round(time.Microsecond), l.Max.Round(time.Microsecond))
+	return f.lat
+}
@@ -0,0 +1,733 @@
+package logbench
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/results"
+	"example.com/operating-systems/stats"
+)
+
+var cmdline = labs.BenchFlagSet("logbench")
+
+// Benchmark Driver
+
+var levels = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func randEntry(gid, i int) logger.LogEntry {
+	level := levels[rand.Intn(len(levels))]
+	ctx := fmt.Sprintf("req-%d-%d", gid, i)
+	msg := fmt.Sprintf("Message number %d from goroutine %d", i, gid)
+	return logger.LogEntry{
+		Timestamp: time.Now(),
+		Level:     level,
+		Context:   ctx,
+		Message:   msg,
+		Fields:    map[string]any{"goroutine": gid, "seq": i},
+	}
+}
+
+// sample is one Log call.
+type sample struct {
+	call    time.Duration // until Log (or LogDurable) returned
+	durable time.Duration // -durable: until the entry was synced
+}
+
+// run is one logger's benchmark: its total time and every goroutine's
+// samples, in the order it logged them.
+type run struct {
+	name    string
+	d       time.Duration
+	cpu     time.Duration // the process's CPU time over the run, close included
+	samples [][]sample
+	dropped int64           // by the overflow policy; -1 for a logger without one
+	shed    int64           // suppressed by -rate and -sample; -1 without them
+	silent  bool            // fewer entries written than taken, with no error to say why
+	batches []int           // entries per fsync, for a logger that reports them
+	e2e     []time.Duration // -follow: each entry from logged to read back
+}
+
+// logErrors counts the errors every logger reports through OnError.
+var logErrors atomic.Int64
+
+// all returns f of every sample.
+func (r run) all(f func(sample) time.Duration) []time.Duration {
+	var out []time.Duration
+	for _, ss := range r.samples {
+		for _, s := range ss {
+			out = append(out, f(s))
+		}
+	}
+	return out
+}
+
+// runBenchmark logs entriesPerG entries from each of goroutines
+// goroutines, timing every call. With durable, each goroutine waits for
+// every entry to be synced before logging the next, and each of those
+// waits is timed too. With a timeout, each call is a LogCtx that gives
+// up after that long.
+func runBenchmark(name, title string, l logger.DurableLogger, goroutines int, entriesPerG int, durable bool, timeout time.Duration) run {
+	start, cpu := time.Now(), cpuTime()
+	errs := logErrors.Load()
+
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+
+	// How long each goroutine took to log all its entries: a wide spread
+	// means the logger served them unfairly.
+	perG := make([]time.Duration, goroutines)
+	samples := make([][]sample, goroutines)
+	// How many entries were at or above the logger's level: the rest it
+	// dropped before doing any work for them.
+	min := l.(logger.LevelLogger).Level()
+	kept := make([]int, goroutines)
+	abandoned := make([]int, goroutines)
+	for g := 0; g < goroutines; g++ {
+		gid := g
+		go func() {
+			defer wg.Done()
+			l, release := perGoroutine(l)
+			defer release()
+			ss := make([]sample, entriesPerG)
+			for i := range ss {
+				e := randEntry(gid, i)
+				if min.Enabled(e.Level) {
+					kept[gid]++
+				}
+				t := time.Now()
+				if timeout > 0 && !durable {
+					ctx, cancel := context.WithTimeout(context.Background(), timeout)
+					if errors.Is(l.LogCtx(ctx, e), context.DeadlineExceeded) {
+						abandoned[gid]++
+					}
+					cancel()
+					ss[i].call = time.Since(t)
+					continue
+				}
+				if !durable {
+					_ = l.Log(e)
+					ss[i].call = time.Since(t)
+					continue
+				}
+				ack := l.LogDurable(e)
+				ss[i].call = time.Since(t)
+				_ = <-ack
+				ss[i].durable = time.Since(t)
+			}
+			samples[gid] = ss
+			perG[gid] = time.Since(start)
+		}()
+	}
+
+	wg.Wait()
+	_ = l.Close()
+
+	r := run{name: name, d: time.Since(start), cpu: cpuTime() - cpu, samples: samples, dropped: -1, shed: -1}
+	total, written := goroutines*entriesPerG, 0
+	for _, k := range kept {
+		written += k
+	}
+	extra := ""
+	if f, ok := l.(*logger.FilteredLogger); ok {
+		r.shed = f.Suppressed()
+		written -= int(r.shed)
+		extra = fmt.Sprintf(" suppressed=%d", r.shed)
+	}
+	base := unwrapped(l)
+	if d, ok := base.(interface{ Dropped() int64 }); ok {
+		r.dropped = d.Dropped()
+		written -= int(r.dropped)
+		extra += fmt.Sprintf(" dropped=%d", r.dropped)
+	}
+	st := l.(logger.HealthLogger).Stats()
+	if st.Syncs > 0 {
+		extra += fmt.Sprintf(" fsyncs=%d (%.1f entries each)", st.Syncs, float64(st.Entries)/float64(st.Syncs))
+	}
+	count := fmt.Sprintf("written=%d", written)
+	if timeout > 0 {
+		// An abandoned call's entry may have been taken first, so how
+		// many were written is up to the log file.
+		n := 0
+		for _, a := range abandoned {
+			n += a
+		}
+		count = fmt.Sprintf("abandoned=%d", n)
+	}
+	fmt.Printf("%s: goroutines=%d entriesEach=%d total=%d %s%s time=%v cpu=%v throughput=%.0f entries/s\n",
+		title, goroutines, entriesPerG, total, count, extra, r.d, r.cpu.Round(time.Microsecond), float64(total)/r.d.Seconds())
+	// Every entry taken must have been written once the logger has
+	// closed, or have an error to account for it.
+	errs = logErrors.Load() - errs
+	if errs > 0 {
+		fmt.Printf("  errors=%d, last: %v\n", errs, st.LastErr)
+	} else if st.Pending != 0 || timeout == 0 && st.Entries != int64(written) {
+		r.silent = true
+		fmt.Printf("  SILENT FAILURE: %d of %d entries written, %d pending, no error reported\n", st.Entries, written, st.Pending)
+	}
+	s := stats.Summarize(perG)
+	fmt.Printf("  per goroutine: mean=%v ±%v  stddev=%v  min=%v  max=%v\n",
+		s.Mean.Round(time.Microsecond), s.CI95().Round(time.Microsecond), s.Stddev.Round(time.Microsecond),
+		s.Min.Round(time.Microsecond), s.Max.Round(time.Microsecond))
+	c := stats.Summarize(r.all(func(s sample) time.Duration { return s.call }))
+	// Calls that only queue an entry take well under a microsecond.
+	fmt.Printf("  Log call: p50=%v  p95=%v  p99=%v  max=%v\n",
+		c.Quantile(0.50).Round(10*time.Nanosecond), c.Quantile(0.95).Round(10*time.Nanosecond),
+		c.Quantile(0.99).Round(10*time.Nanosecond), c.Max.Round(10*time.Nanosecond))
+	if b, ok := base.(interface{ BatchSizes() []int }); ok && len(b.BatchSizes()) > 0 {
+		r.batches = b.BatchSizes()
+		printBatches(r.batches)
+	}
+	if durable {
+		a := stats.Summarize(r.all(func(s sample) time.Duration { return s.durable }))
+		fmt.Printf("  durable write: p50=%v  p99=%v  max=%v\n",
+			a.Quantile(0.50).Round(time.Microsecond), a.Quantile(0.99).Round(time.Microsecond), a.Max.Round(time.Microsecond))
+	}
+	return r
+}
+
+// perGoroutine returns the logger a benchmark goroutine logs through,
+// and release, to call when it is done: for a CombiningLogger a producer
+// of its own, behind the same filters if it is filtered; otherwise l.
+func perGoroutine(l logger.DurableLogger) (_ logger.DurableLogger, release func()) {
+	switch l := l.(type) {
+	case *logger.CombiningLogger:
+		p := l.Register()
+		return p, func() { p.Close() }
+	case *logger.FilteredLogger:
+		inner, release := perGoroutine(l.Unwrap())
+		return logger.Filtered(inner, l.Filters()...), release
+	}
+	return l, func() {}
+}
+
+// unwrapped returns the logger behind any filters.
+func unwrapped(l logger.DurableLogger) logger.DurableLogger {
+	for {
+		f, ok := l.(*logger.FilteredLogger)
+		if !ok {
+			return l
+		}
+		l = f.Unwrap()
+	}
+}
+
+// printBatches prints the distribution of batch sizes: percentiles, then
+// how many batches fell in each power-of-two range.
+func printBatches(sizes []int) {
+	b := stats.Summarize(sizes)
+	total := 0
+	for _, n := range sizes {
+		total += n
+	}
+	fmt.Printf("  batch size: batches=%d mean=%.1f p50=%d p90=%d p99=%d max=%d\n",
+		b.N, float64(total)/float64(b.N), b.Quantile(0.50), b.Quantile(0.90), b.Quantile(0.99), b.Max)
+	var counts []int
+	for _, n := range sizes {
+		i := 0
+		for 1<<(i+1) <= n {
+			i++
+		}
+		for len(counts) <= i {
+			counts = append(counts, 0)
+		}
+		counts[i]++
+	}
+	line := "  batches by size:"
+	for i, c := range counts {
+		if c == 0 {
+			continue
+		}
+		if lo, hi := 1<<i, 1<<(i+1)-1; lo == hi {
+			line += fmt.Sprintf(" %d:%d", lo, c)
+		} else {
+			line += fmt.Sprintf(" %d-%d:%d", lo, hi, c)
+		}
+	}
+	fmt.Println(line)
+}
+
+// metrics returns what -record stores for r: its total time, throughput
+// and call latency percentiles, and with durable its durable write ones.
+func (r run) metrics(durable bool) []results.Metric {
+	n := 0
+	for _, ss := range r.samples {
+		n += len(ss)
+	}
+	c := stats.Summarize(r.all(func(s sample) time.Duration { return s.call }))
+	ms := []results.Metric{
+		results.Duration(r.name, r.d),
+		results.Rate(r.name+"-throughput", float64(n)/r.d.Seconds(), "entries/s"),
+		results.Duration(r.name+"-cpu", r.cpu),
+		results.Duration(r.name+"-log-p50", c.Quantile(0.50)),
+		results.Duration(r.name+"-log-p95", c.Quantile(0.95)),
+		results.Duration(r.name+"-log-p99", c.Quantile(0.99)),
+		results.Duration(r.name+"-log-max", c.Max),
+	}
+	if r.dropped >= 0 {
+		ms = append(ms, results.Metric{Name: r.name + "-dropped", Value: float64(r.dropped), Unit: "entries", Better: results.Lower})
+	}
+	if r.shed >= 0 {
+		ms = append(ms, results.Metric{Name: r.name + "-suppressed", Value: float64(r.shed), Unit: "entries", Better: results.Lower})
+	}
+	if len(r.batches) > 0 {
+		ms = append(ms, results.Rate(r.name+"-batch-mean", float64(n-int(max(r.dropped, 0)+max(r.shed, 0)))/float64(len(r.batches)), "entries"))
+	}
+	if len(r.e2e) > 0 {
+		e := stats.Summarize(r.e2e)
+		ms = append(ms, results.Duration(r.name+"-e2e-p50", e.Quantile(0.50)), results.Duration(r.name+"-e2e-p99", e.Quantile(0.99)))
+	}
+	if durable {
+		a := stats.Summarize(r.all(func(s sample) time.Duration { return s.durable }))
+		ms = append(ms, results.Duration(r.name+"-durable-p50", a.Quantile(0.50)),
+			results.Duration(r.name+"-durable-p99", a.Quantile(0.99)))
+	}
+	return ms
+}
+
+// writeSamples writes every call of every run to path as CSV, one row
+// per call: logger, goroutine, seq, call_ns and durable_ns (empty
+// without -durable).
+func writeSamples(path string, runs []run, durable bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"logger", "goroutine", "seq", "call_ns", "durable_ns"})
+	for _, r := range runs {
+		for g, ss := range r.samples {
+			for i, s := range ss {
+				dur := ""
+				if durable {
+					dur = strconv.FormatInt(int64(s.durable), 10)
+				}
+				w.Write([]string{r.name, strconv.Itoa(g), strconv.Itoa(i), strconv.FormatInt(int64(s.call), 10), dur})
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// benchRemote starts a collector, runs the benchmark through a
+// RemoteLogger to it and reports what the collector received.
+func benchRemote(args []string, network string, opts logger.Options, bench func(string, string, logger.DurableLogger, ...string) run) (run, bool) {
+	c, err := startCollector(args, network)
+	if err != nil {
+		fmt.Println("remote:", err)
+		return run{}, false
+	}
+	l, err := logger.NewRemoteLoggerWith(network, c.addr, opts)
+	if err != nil {
+		fmt.Println("remote:", err)
+		c.stop()
+		return run{}, false
+	}
+	there := "fsync every 10 there"
+	if network == "tcp" {
+		there = "fsync every 10 and each burst there"
+	}
+	r := bench("remote", fmt.Sprintf("RemoteLogger (%s to a collector at %s, %s)", network, c.addr, there), l, remoteLog)
+	received, bad, err := c.stop()
+	if err != nil {
+		fmt.Println("  collector:", err)
+	}
+	sent := l.Stats().Entries
+	fmt.Printf("  collector: received %d of %d messages (%d lost, %d unparsable) into %s\n", received, sent, sent-received, bad, remoteLog)
+	return r, true
+}
+
+func Main(args []string) {
+	var opts logger.Options
+	opts.OnError = func(error) { logErrors.Add(1) }
+	goroutinesFlag := cmdline.Int("goroutines", 8, "producer goroutines per logger")
+	entriesFlag := cmdline.Int("entries", 50, "entries each goroutine logs")
+	ringSize := cmdline.Int("ring", 1024, "RingLogger slots (rounded up to a power of two)")
+	shards := cmdline.Int("shards", 4, "ShardedLogger files")
+	chanBuf := cmdline.Int("chan", 200, "ChannelLogger channel buffer")
+	cmdline.BoolVar(&opts.Compress, "compress", false, "write the logs as gzip segments (see -rotate-bytes)")
+	cmdline.BoolVar(&opts.Direct, "direct", false, "write the logs with direct I/O (O_DIRECT), bypassing the page cache, where the file system allows")
+	timeout := cmdline.Duration("timeout", 0, "log through LogCtx, abandoning a call blocked longer than this (0: Log)")
+	mmapWindow := cmdline.Int64("mmap-window", logger.DefaultMmapWindow, "MmapLogger: bytes of the file mapped at a time")
+	window := cmdline.Duration("group-window", 0, "GroupCommitLogger: how long a leader waits for others to join its commit")
+	cmdline.Var(&opts.Overflow, "overflow", "what a full ChannelLogger does: block, drop-newest, drop-oldest or reject")
+	durable := cmdline.Bool("durable", false, "wait for each entry to be fsynced before logging the next, and report per-entry durable write latency")
+	format := cmdline.String("format", "text", "log line format: text or json (one object per line, for jq)")
+	cmdline.Var(&opts.Sync, "sync", "how the loggers sync: full (fsync; F_FULLFSYNC on macOS), data (fdatasync), none")
+	cmdline.Int64Var(&opts.Rotation.MaxBytes, "rotate-bytes", 0, "rotate a log file before it grows past this many bytes (0: no limit)")
+	cmdline.DurationVar(&opts.Rotation.MaxAge, "rotate-age", 0, "rotate a log file once it has been open this long (0: no limit)")
+	cmdline.IntVar(&opts.Rotation.MaxBackups, "backups", 3, "rotated files to keep per log (name.log.1 is the newest)")
+	batch := cmdline.String("batch", "fixed", "how the channel, ring and combining loggers size fsync batches: fixed (10) or adaptive (by backlog)")
+	batchMax := cmdline.Int("batch-max", 256, "-batch adaptive: the largest batch")
+	cmdline.DurationVar(&opts.FlushInterval, "flush-interval", 0, "sync a partial batch after at most this long (0: only full batches)")
+	cmdline.Var(&opts.MinLevel, "level", "drop entries below this level: debug, info, warn or error (a quarter of entries are at each)")
+	rate := cmdline.Float64("rate", 0, "rate-limit each logger to this many entries/s, with a token bucket, suppressing the rest (0: no limit)")
+	burst := cmdline.Int("burst", 100, "-rate: entries the token bucket lets through at once")
+	sample := cmdline.String("sample", "", "keep one in N entries at each level listed, at random, like debug=100,info=10")
+	follow := cmdline.Bool("follow", false, "tail each log as it is written and report producer-to-reader latency (implies -format json)")
+	followPoll := cmdline.Duration("follow-poll", time.Millisecond, "-follow: how often a reader at the end of a log looks for more")
+	samplesOut := cmdline.String("samples", "", "write every call's latency to this CSV `file`")
+	crash := cmdline.Duration("crash", 0, "instead, log binary records in a child process, kill -9 it after this long and recover the log")
+	crashLogger := cmdline.String("crash-logger", "mutex", "-crash: the child's loggers, one child each: a list of naive, mutex, channel, ring, group, mmap, append and combine, or all")
+	crashRandom := cmdline.Bool("crash-random", false, "-crash: kill each child at a random point up to the -crash time")
+	tear := cmdline.Bool("tear", false, "-crash: also cut the log at a random byte, as a power loss would")
+	childLog := cmdline.String("crash-child", "", "internal: run as the -crash child, logging to this file")
+	procs := cmdline.Int("procs", 0, "instead, log from this many processes into one file, shared.log, and check it")
+	sharedLogger := cmdline.String("shared-logger", "append", "-procs: the processes' logger: append (O_APPEND) or mutex")
+	procsChildN := cmdline.Int("procs-child", -1, "internal: run as -procs child N")
+	producers := cmdline.String("producers", "", "instead, run the mutex and combining loggers at each of these producer counts, like 1,2,4,8,16,32,64,128")
+	sweepFlag := cmdline.Bool("sweep", false, "instead, run the loggers over a grid of the -sweep-* values, -trials times each, and write the results as CSV and JSON")
+	sweepLoggersFlag := cmdline.String("sweep-loggers", "naive,mutex,channel,ring,sharded,group,mmap,combine", "-sweep: the loggers to run")
+	sweepGoroutines := cmdline.String("sweep-goroutines", "1,8,64", "-sweep: goroutine counts")
+	sweepBatch := cmdline.String("sweep-batch", "1,10,100", "-sweep: entries per fsync, for the loggers that batch")
+	sweepChan := cmdline.String("sweep-chan", "16,200,1024", "-sweep: ChannelLogger channel buffers")
+	trials := cmdline.Int("trials", 3, "-sweep: runs of each configuration")
+	sweepOut := cmdline.String("sweep-out", "logbench-sweep", "-sweep: write the results to this `name`.csv and name.json")
+	sweepConfigFile := cmdline.String("sweep-config", "", "-sweep: read the grid from this JSON `file` (fields loggers, goroutines, entries, batch, chan, trials, out)")
+	remote := cmdline.String("remote", "", "also log over udp or tcp, as syslog, to a collector process writing remote.log")
+	collect := cmdline.String("collect", "", "internal: run as the -remote collector on this network")
+	defer labs.ParseBench(cmdline, args)()
+	enc, err := logger.ParseEncoder(*format)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	opts.Encoder = enc
+	if *follow {
+		opts.Encoder = logger.JSON
+	}
+	rand.Seed(time.Now().UnixNano())
+	every, err := parseSampling(*sample)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "logbench: -sample:", err)
+		os.Exit(2)
+	}
+	// shed puts l behind new filters as -rate and -sample say, if any.
+	shed := func(l logger.DurableLogger) logger.DurableLogger {
+		var filters []logger.Filter
+		if *rate > 0 {
+			filters = append(filters, logger.NewRateLimiter(*rate, *burst))
+		}
+		if len(every) > 0 {
+			filters = append(filters, logger.NewSampler(every))
+		}
+		if len(filters) == 0 {
+			return l
+		}
+		return logger.Filtered(l, filters...)
+	}
+
+	goroutines := *goroutinesFlag
+	entriesPerG := *entriesFlag
+	batchN := 10
+	batchDesc := "every 10" // how the channel, ring and combining loggers batch
+	switch *batch {
+	case "fixed":
+	case "adaptive":
+		opts.Batch = func() logger.BatchPolicy { return logger.NewAdaptiveBatch(1, *batchMax) }
+		batchDesc = fmt.Sprintf("every 1-%d, by backlog", *batchMax)
+	default:
+		fmt.Printf("unknown -batch %q (fixed, adaptive)\n", *batch)
+		return
+	}
+	if *childLog != "" {
+		if err := crashChild(*childLog, *crashLogger, goroutines, batchN, *durable, opts); err != nil {
+			fmt.Fprintln(os.Stderr, "crash child:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *collect != "" {
+		if err := collectChild(*collect, batchN, opts); err != nil {
+			fmt.Fprintln(os.Stderr, "collector:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *procsChildN >= 0 {
+		if err := procsChild(sharedLog, *sharedLogger, *procsChildN, goroutines, entriesPerG, batchN, opts); err != nil {
+			fmt.Fprintln(os.Stderr, "procs child:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *procs > 0 {
+		if err := procsTest(args, *sharedLogger, *procs, goroutines, entriesPerG); err != nil {
+			fmt.Fprintln(os.Stderr, "procs:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *crash > 0 {
+		kinds := splitList(*crashLogger)
+		if *crashLogger == "all" {
+			kinds = crashLoggers
+		}
+		if err := crashTest(args, kinds, *crash, *crashRandom, *tear, *durable); err != nil {
+			fmt.Fprintln(os.Stderr, "crash:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *producers != "" {
+		counts, err := parseInts(*producers)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "logbench: -producers:", err)
+			os.Exit(2)
+		}
+		runs := producerSweep(counts, entriesPerG, batchN, opts, *durable, *timeout)
+		record(runs, *durable)
+		exitIfSilent(runs)
+		return
+	}
+	if *sweepFlag || *sweepConfigFile != "" {
+		c := sweepConfig{Loggers: splitList(*sweepLoggersFlag), Entries: entriesPerG, Trials: *trials, Out: *sweepOut}
+		for _, d := range []struct {
+			flag string
+			list *string
+			to   *[]int
+		}{{"sweep-goroutines", sweepGoroutines, &c.Goroutines}, {"sweep-batch", sweepBatch, &c.Batch}, {"sweep-chan", sweepChan, &c.Chan}} {
+			if *d.to, err = parseInts(*d.list); err != nil {
+				fmt.Fprintf(os.Stderr, "logbench: -%s: %v\n", d.flag, err)
+				os.Exit(2)
+			}
+		}
+		if *sweepConfigFile != "" {
+			if err := loadSweep(*sweepConfigFile, &c); err != nil {
+				fmt.Fprintln(os.Stderr, "logbench: -sweep-config:", err)
+				os.Exit(2)
+			}
+		}
+		if opts.Compress && slices.Contains(c.Loggers, "naive") {
+			// As below: its goroutines would share one gzip.Writer.
+			c.Loggers = slices.DeleteFunc(c.Loggers, func(name string) bool { return name == "naive" })
+			fmt.Println("-compress: not sweeping the naive logger, whose goroutines would share its gzip.Writer unsynchronized")
+		}
+		byGoroutine := func(e logger.LogEntry) string { return fmt.Sprint(e.Fields["goroutine"]) }
+		all := []sweepLogger{
+			{"naive", false, false, func(int, int) (logger.DurableLogger, error) { return logger.NewNaiveLoggerWith("naive.log", opts) }},
+			{"mutex", true, false, func(b, _ int) (logger.DurableLogger, error) { return logger.NewMutexLoggerWith("mutex.log", b, opts) }},
+			{"channel", true, true, func(b, ch int) (logger.DurableLogger, error) {
+				return logger.NewChannelLoggerWith("channel.log", b, ch, opts)
+			}},
+			{"ring", true, false, func(b, _ int) (logger.DurableLogger, error) {
+				return logger.NewRingLoggerWith("ring.log", b, *ringSize, opts)
+			}},
+			{"sharded", true, false, func(b, _ int) (logger.DurableLogger, error) {
+				return logger.NewShardedLoggerWith("sharded.log", *shards, b, byGoroutine, opts)
+			}},
+			{"group", false, false, func(int, int) (logger.DurableLogger, error) {
+				return logger.NewGroupCommitLoggerWith("group.log", *window, opts)
+			}},
+			{"mmap", true, false, func(b, _ int) (logger.DurableLogger, error) {
+				return logger.NewMmapLoggerWith("mmap.log", *mmapWindow, b, opts)
+			}},
+			{"combine", true, false, func(b, _ int) (logger.DurableLogger, error) {
+				return logger.NewCombiningLoggerWith("combine.log", b, 0, opts)
+			}},
+		}
+		for i := range all {
+			open := all[i].open
+			all[i].open = func(b, ch int) (logger.DurableLogger, error) {
+				l, err := open(b, ch)
+				if err != nil {
+					return nil, err
+				}
+				return shed(l), nil
+			}
+		}
+		runs, err := sweep(c, all, batchN, *chanBuf, *durable, *timeout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "logbench: sweep:", err)
+			os.Exit(1)
+		}
+		record(runs, *durable)
+		exitIfSilent(runs)
+		return
+	}
+	// bench runs l's benchmark, with -follow tailing paths, the files it
+	// writes, as it does.
+	bench := func(name, title string, l logger.DurableLogger, paths ...string) run {
+		var f *follower
+		if *follow && len(paths) > 0 {
+			f = startFollow(paths, *followPoll)
+		}
+		g := goroutines
+		if name == "naive" && opts.Compress {
+			g = 1 // see the -compress note below
+		}
+		r := runBenchmark(name, title, shed(l), g, entriesPerG, *durable, *timeout)
+		if f != nil {
+			r.e2e = f.stop(l.(logger.HealthLogger).Stats().Entries, time.Second)
+		}
+		return r
+	}
+	fmt.Printf("sync: %v  format: %v  durable: %v  level: %v  compress: %v  direct: %v\n", opts.Sync, opts.Encoder, *durable, opts.MinLevel, opts.Compress, opts.Direct)
+	if opts.Compress {
+		// The naive logger's goroutines would share its gzip.Writer with
+		// no lock, and concurrent Writes to compress/flate's state can
+		// panic, ending the whole run.
+		fmt.Println("-compress: the naive logger runs one goroutine; more would share its gzip.Writer unsynchronized")
+	}
+	if opts.Direct {
+		if err := logger.DirectSupported("."); err != nil {
+			fmt.Printf("direct I/O unavailable (%v): the logs go through the page cache\n", err)
+		}
+		if *follow {
+			// A direct log's last block is padded, then cut back, at every sync.
+			fmt.Println("-follow can't tail direct I/O logs; not following")
+			*follow = false
+		}
+	}
+	if *rate > 0 || len(every) > 0 {
+		fmt.Printf("shedding: rate %.0f/s (burst %d)  sample %q\n", *rate, *burst, *sample)
+	}
+
+	// 1) Naive
+	naive, err := logger.NewNaiveLoggerWith("naive.log", opts)
+	if err != nil {
+		panic(err)
+	}
+	rNaive := bench("naive", "NaiveLogger (fsync every write)", naive, "naive.log")
+
+	// 2) Mutex
+	mutexLogger, err := logger.NewMutexLoggerWith("mutex.log", batchN, opts)
+	if err != nil {
+		panic(err)
+	}
+	rMutex := bench("mutex", "MutexLogger (fsync every 10)", mutexLogger, "mutex.log")
+
+	// 3) Channel
+	channelLogger, err := logger.NewChannelLoggerWith("channel.log", batchN, *chanBuf, opts)
+	if err != nil {
+		panic(err)
+	}
+	rChannel := bench("channel", fmt.Sprintf("ChannelLogger (fsync %s, %v when full)", batchDesc, opts.Overflow), channelLogger, "channel.log")
+
+	// 4) Lock-free ring
+	ringLogger, err := logger.NewRingLoggerWith("ring.log", batchN, *ringSize, opts)
+	if err != nil {
+		panic(err)
+	}
+	rRing := bench("ring", fmt.Sprintf("RingLogger (fsync %s)", batchDesc), ringLogger, "ring.log")
+
+	// 5) Sharded, one goroutine's entries per shard, merged afterwards
+	byGoroutine := func(e logger.LogEntry) string { return fmt.Sprint(e.Fields["goroutine"]) }
+	shardedLogger, err := logger.NewShardedLoggerWith("sharded.log", *shards, batchN, byGoroutine, opts)
+	if err != nil {
+		panic(err)
+	}
+	var shardPaths []string
+	for i := 0; i < *shards; i++ {
+		shardPaths = append(shardPaths, logger.ShardPath("sharded.log", i))
+	}
+	rSharded := bench("sharded", fmt.Sprintf("ShardedLogger (%d files, fsync every 10)", *shards), shardedLogger, shardPaths...)
+	// MergeShards merges lines; binary shards have none.
+	if opts.Encoder != logger.Binary {
+		start := time.Now()
+		n, err := logger.MergeShards("sharded.log", *shards)
+		if err != nil {
+			fmt.Println("merge:", err)
+		} else {
+			fmt.Printf("  merged %d lines into sharded.log in %v\n", n, time.Since(start).Round(time.Microsecond))
+		}
+	}
+
+	// 6) Group commit
+	groupLogger, err := logger.NewGroupCommitLoggerWith("group.log", *window, opts)
+	if err != nil {
+		panic(err)
+	}
+	rGroup := bench("group", "GroupCommitLogger (fsync per group)", groupLogger, "group.log")
+
+	// 7) Memory-mapped
+	runs := []run{rNaive, rMutex, rChannel, rRing, rSharded, rGroup}
+	mmapLogger, err := logger.NewMmapLoggerWith("mmap.log", *mmapWindow, batchN, opts)
+	if err != nil {
+		fmt.Println("mmap:", err)
+	} else {
+		// Not followed: the mapped file is zeros past the last entry
+		// until Close.
+		runs = append(runs, bench("mmap", "MmapLogger (msync every 10)", mmapLogger))
+	}
+
+	// 8) Combining, a ring per producer
+	combineLogger, err := logger.NewCombiningLoggerWith("combine.log", batchN, 0, opts)
+	if err != nil {
+		panic(err)
+	}
+	runs = append(runs, bench("combine", fmt.Sprintf("CombiningLogger (a ring per producer, fsync %s)", batchDesc), combineLogger, "combine.log"))
+
+	// 9) Remote, to a collector process
+	if *remote != "" {
+		if r, ok := benchRemote(args, *remote, opts, bench); ok {
+			runs = append(runs, r)
+		}
+	}
+	if *samplesOut != "" {
+		if err := writeSamples(*samplesOut, runs, *durable); err != nil {
+			fmt.Println("samples:", err)
+		}
+	}
+	record(runs, *durable)
+
+	if opts.MinLevel == logger.LevelDebug && opts.Overflow == logger.Block && *timeout == 0 && *rate == 0 && len(every) == 0 {
+		fmt.Println("\nTip: run `go run ./cmd/logcheck` to check the logs for torn, missing and out-of-order entries.")
+	}
+	exitIfSilent(runs)
+}
+
+// record records every run's metrics with -record.
+func record(runs []run, durable bool) {
+	var metrics []results.Metric
+	for _, r := range runs {
+		metrics = append(metrics, r.metrics(durable)...)
+	}
+	if err := labs.Record(cmdline, metrics...); err != nil {
+		fmt.Println("record:", err)
+	}
+}
+
+// exitIfSilent exits with status 1 if any run was a silent failure.
+func exitIfSilent(runs []run) {
+	for _, r := range runs {
+		if r.silent {
+			os.Exit(1)
+		}
+	}
+}
+
+// parseSampling parses -sample's list of level=N; empty means none.
+func parseSampling(list string) (map[logger.Level]int, error) {
+	every := map[logger.Level]int{}
+	for _, f := range splitList(list) {
+		name, n, ok := strings.Cut(f, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not level=N", f)
+		}
+		l, err := logger.ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		if every[l], err = strconv.Atoi(n); err != nil || every[l] < 1 {
+			return nil, fmt.Errorf("%q: N must be a positive integer", f)
+		}
+	}
+	return every, nil
+}
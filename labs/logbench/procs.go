@@ -0,0 +1,128 @@
+// Multi-process logging (HW8 extension)
+// -procs N runs the benchmark's producers in N processes (this program
+// re-run with -procs-child, as HW1 starts its consumers) that all log to
+// one file, shared.log, and then reads the file back. With the append
+// logger every process opens the file O_APPEND and writes whole entries
+// in one write each, so the kernel puts each at the end as it stands:
+// nothing is lost or torn. The mutex logger's lock is only within a
+// process; each process writes at its own offset from the start of the
+// file (truncating it, too, as it opens it), so the processes overwrite
+// each other's entries.
+
+package logbench
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/labs"
+)
+
+// sharedLog is the file the processes share.
+const sharedLog = "shared.log"
+
+// procsChild logs entriesPerG entries from each of goroutines goroutines
+// to path through the kind of logger named, as process proc of several:
+// its goroutines are numbered from proc*goroutines, so every entry in
+// the shared file names a goroutine no other process has.
+func procsChild(path, kind string, proc, goroutines, entriesPerG, batchN int, opts logger.Options) error {
+	var (
+		l   logger.Logger
+		err error
+	)
+	switch kind {
+	case "append":
+		l, err = logger.NewAppendLoggerWith(path, batchN, opts)
+	case "mutex":
+		l, err = logger.NewMutexLoggerWith(path, batchN, opts)
+	default:
+		return fmt.Errorf("unknown logger %q (append, mutex)", kind)
+	}
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < entriesPerG; i++ {
+				_ = l.Log(randEntry(proc*goroutines+g, i))
+			}
+		}()
+	}
+	wg.Wait()
+	return l.Close()
+}
+
+// procsTest runs procs children with args, each logging to shared.log,
+// and checks what the file holds.
+func procsTest(args []string, kind string, procs, goroutines, entriesPerG int) error {
+	os.Remove(sharedLog)
+	start := time.Now()
+	cmds := make([]*exec.Cmd, procs)
+	for p := range cmds {
+		cmds[p] = labs.Command(append(args, "-procs-child", strconv.Itoa(p))...)
+		cmds[p].Stdout, cmds[p].Stderr = os.Stdout, os.Stderr
+		if err := cmds[p].Start(); err != nil {
+			return err
+		}
+	}
+	for p, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("process %d: %v", p, err)
+		}
+	}
+	d := time.Since(start)
+	total := procs * goroutines * entriesPerG
+	fmt.Printf("%d processes x %d goroutines x %d entries through the %s logger into %s: time=%v throughput=%.0f entries/s\n",
+		procs, goroutines, entriesPerG, kind, sharedLog, d, float64(total)/d.Seconds())
+
+	f, err := os.Open(sharedLog)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	lines, torn := 0, 0
+	seen := map[[2]int]bool{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		lines++
+		g, i, ok := entryID(sc.Text())
+		if !ok {
+			torn++
+			continue
+		}
+		seen[[2]int{g, i}] = true
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	fmt.Printf("  %d lines: %d entries intact, %d torn, %d of %d missing\n", lines, len(seen), torn, total-len(seen), total)
+	if torn > 0 || len(seen) < total {
+		return fmt.Errorf("%s is corrupt: run `go run ./cmd/logcheck -goroutines %d -entries %d %s` for where",
+			sharedLog, procs*goroutines, entriesPerG, sharedLog)
+	}
+	return nil
+}
+
+// entryID returns the goroutine and sequence number a benchmark entry
+// names, if its line parses and its context and message agree.
+func entryID(line string) (g, i int, ok bool) {
+	e, err := logger.ParseEntry(line)
+	if err != nil {
+		return 0, 0, false
+	}
+	if _, err := fmt.Sscanf(e.Context, "req-%d-%d", &g, &i); err != nil {
+		return 0, 0, false
+	}
+	return g, i, strings.HasPrefix(e.Message, fmt.Sprintf("Message number %d from goroutine %d", i, g))
+}
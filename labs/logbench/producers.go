@@ -0,0 +1,64 @@
+// Producer sweep (HW8 extension)
+// -producers 1,2,4,...,128 runs only the MutexLogger and the
+// CombiningLogger, at each of those producer counts, and prints how
+// their throughput and Log call latency scale. Every MutexLogger call
+// takes the one lock; a CombiningLogger producer writes a ring of its
+// own, so past a few producers the mutex's handoffs are what the
+// combining logger saves.
+
+package logbench
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/stats"
+)
+
+// producerSweep benchmarks the two loggers at each count of producers,
+// entriesPerG entries each, and prints a table of the runs.
+func producerSweep(counts []int, entriesPerG, batchN int, opts logger.Options, durable bool, timeout time.Duration) []run {
+	var runs []run
+	for _, g := range counts {
+		m, err := logger.NewMutexLoggerWith("mutex.log", batchN, opts)
+		if err != nil {
+			panic(err)
+		}
+		runs = append(runs, runBenchmark(fmt.Sprintf("mutex-p%d", g), "MutexLogger (fsync every 10)", m, g, entriesPerG, durable, timeout))
+		c, err := logger.NewCombiningLoggerWith("combine.log", batchN, 0, opts)
+		if err != nil {
+			panic(err)
+		}
+		runs = append(runs, runBenchmark(fmt.Sprintf("combine-p%d", g), "CombiningLogger (fsync every 10)", c, g, entriesPerG, durable, timeout))
+	}
+
+	fmt.Printf("\n%9s %14s %14s %8s %12s %12s\n", "producers", "mutex/s", "combine/s", "speedup", "mutex p99", "combine p99")
+	for i, g := range counts {
+		m, c := runs[2*i], runs[2*i+1]
+		n := float64(g * entriesPerG)
+		mp := stats.Summarize(m.all(func(s sample) time.Duration { return s.call })).Quantile(0.99)
+		cp := stats.Summarize(c.all(func(s sample) time.Duration { return s.call })).Quantile(0.99)
+		fmt.Printf("%9d %14.0f %14.0f %7.2fx %12v %12v\n", g, n/m.d.Seconds(), n/c.d.Seconds(),
+			m.d.Seconds()/c.d.Seconds(), mp.Round(10*time.Nanosecond), cp.Round(10*time.Nanosecond))
+	}
+	return runs
+}
+
+// parseInts parses a comma-separated list like "1,8,64"; empty means none.
+func parseInts(list string) ([]int, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var out []int
+	for _, f := range strings.Split(list, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
@@ -0,0 +1,234 @@
+// Benchmark matrix (HW8 extension)
+// -sweep runs the loggers over a grid instead of once at -goroutines and
+// -entries: every goroutine count in -sweep-goroutines, every batch size
+// in -sweep-batch (for the loggers that batch: all but naive and group)
+// and every channel buffer in -sweep-chan (for the channel logger), each
+// -trials times. Every run is one row of OUT.csv and of OUT.json, ready
+// to plot; the JSON also names the revision and host, as oslabs
+// experiment's reports do. -sweep-config reads the grid from a JSON file
+// with the same fields, which take the place of the flags:
+//
+//	{"loggers": ["mutex", "ring"], "goroutines": [1, 8, 64], "entries": 200,
+//	 "batch": [1, 10, 100], "chan": [16, 1024], "trials": 3, "out": "hw8"}
+//
+// The remote logger needs a collector process and isn't swept.
+
+package logbench
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/results"
+	"example.com/operating-systems/stats"
+)
+
+// sweepConfig is the grid -sweep runs.
+type sweepConfig struct {
+	Loggers    []string `json:"loggers"`
+	Goroutines []int    `json:"goroutines"`
+	Entries    int      `json:"entries"`
+	Batch      []int    `json:"batch"`
+	Chan       []int    `json:"chan"`
+	Trials     int      `json:"trials"`
+	Out        string   `json:"out"`
+}
+
+// sweepRow is one run of the grid. Batch and Chan are 0 for a logger
+// they don't apply to.
+type sweepRow struct {
+	Logger     string  `json:"logger"`
+	Goroutines int     `json:"goroutines"`
+	Entries    int     `json:"entries"` // each
+	Batch      int     `json:"batch,omitempty"`
+	Chan       int     `json:"chan,omitempty"`
+	Trial      int     `json:"trial"` // from 1
+	TimeNS     int64   `json:"time_ns"`
+	CPUNS      int64   `json:"cpu_ns"`
+	Throughput float64 `json:"throughput"` // entries/s
+	LogP50NS   int64   `json:"log_p50_ns"`
+	LogP99NS   int64   `json:"log_p99_ns"`
+	DurableP50 int64   `json:"durable_p50_ns,omitempty"`
+	DurableP99 int64   `json:"durable_p99_ns,omitempty"`
+	Fsyncs     int64   `json:"fsyncs"`
+	Dropped    int64   `json:"dropped"`    // -1 for a logger without an overflow policy
+	Suppressed int64   `json:"suppressed"` // by -rate and -sample; -1 without them
+	Silent     bool    `json:"silent"`
+}
+
+// sweepReport is OUT.json.
+type sweepReport struct {
+	Started time.Time         `json:"started"`
+	Rev     string            `json:"rev"`
+	Host    results.Host      `json:"host"`
+	Grid    sweepConfig       `json:"grid"`
+	Flags   map[string]string `json:"flags"` // every logbench flag, -sync and -format among them
+	Runs    []sweepRow        `json:"runs"`
+}
+
+// sweepLogger makes one logger of the grid.
+type sweepLogger struct {
+	name         string
+	batch, chanB bool // whether -sweep-batch and -sweep-chan apply
+	open         func(batchN, chanBuf int) (logger.DurableLogger, error)
+}
+
+// loadSweep fills in c from the JSON file at path; a field the file
+// leaves out keeps its value.
+func loadSweep(path string, c *sweepConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// sweep runs every logger named in c, of all, over c's grid, printing
+// each run's report as it goes, and writes the rows to c.Out's CSV and
+// JSON files. A logger a dimension doesn't apply to gets batchN or
+// chanBuf. It returns the runs, each named for its cell and trial.
+func sweep(c sweepConfig, all []sweepLogger, batchN, chanBuf int, durable bool, timeout time.Duration) ([]run, error) {
+	var ls []sweepLogger
+	for _, name := range c.Loggers {
+		found := false
+		for _, l := range all {
+			if l.name == name {
+				ls, found = append(ls, l), true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown logger %q", name)
+		}
+	}
+	if len(c.Goroutines) == 0 || c.Entries <= 0 || c.Trials <= 0 {
+		return nil, fmt.Errorf("empty grid: goroutines %v, entries %d, trials %d", c.Goroutines, c.Entries, c.Trials)
+	}
+	// Dimensions a logger ignores are run once, at 0.
+	dim := func(vs []int, applies bool) []int {
+		if !applies || len(vs) == 0 {
+			return []int{0}
+		}
+		return vs
+	}
+
+	rep := sweepReport{Started: time.Now().UTC().Truncate(time.Second), Rev: results.Revision(), Host: results.CurrentHost(),
+		Grid: c, Flags: results.FlagConfig(cmdline)}
+	var runs []run
+	for _, l := range ls {
+		for _, g := range c.Goroutines {
+			for _, b := range dim(c.Batch, l.batch) {
+				for _, ch := range dim(c.Chan, l.chanB) {
+					for t := 1; t <= c.Trials; t++ {
+						cell := fmt.Sprintf("%s-g%d", l.name, g)
+						if b > 0 {
+							cell += fmt.Sprintf("-b%d", b)
+						}
+						if ch > 0 {
+							cell += fmt.Sprintf("-c%d", ch)
+						}
+						fmt.Printf("\n[%d/%d] %s trial %d\n", len(runs)+1, sweepSize(c, ls, dim), cell, t)
+						bn, cb := batchN, chanBuf
+						if b > 0 {
+							bn = b
+						}
+						if ch > 0 {
+							cb = ch
+						}
+						lg, err := l.open(bn, cb)
+						if err != nil {
+							return runs, err
+						}
+						r := runBenchmark(fmt.Sprintf("%s-t%d", cell, t), l.name, lg, g, c.Entries, durable, timeout)
+						runs = append(runs, r)
+						row := sweepRow{Logger: l.name, Goroutines: g, Entries: c.Entries, Batch: b, Chan: ch, Trial: t,
+							TimeNS: int64(r.d), CPUNS: int64(r.cpu), Throughput: float64(g*c.Entries) / r.d.Seconds(),
+							Fsyncs: lg.(logger.HealthLogger).Stats().Syncs, Dropped: r.dropped, Suppressed: r.shed, Silent: r.silent}
+						call := stats.Summarize(r.all(func(s sample) time.Duration { return s.call }))
+						row.LogP50NS, row.LogP99NS = int64(call.Quantile(0.50)), int64(call.Quantile(0.99))
+						if durable {
+							d := stats.Summarize(r.all(func(s sample) time.Duration { return s.durable }))
+							row.DurableP50, row.DurableP99 = int64(d.Quantile(0.50)), int64(d.Quantile(0.99))
+						}
+						rep.Runs = append(rep.Runs, row)
+					}
+				}
+			}
+		}
+	}
+
+	if err := writeSweepCSV(c.Out+".csv", rep.Runs); err != nil {
+		return runs, err
+	}
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err == nil {
+		err = os.WriteFile(c.Out+".json", append(data, '\n'), 0o644)
+	}
+	if err != nil {
+		return runs, err
+	}
+	fmt.Printf("\n%d runs in %v; results in %s.csv and %s.json\n", len(rep.Runs), time.Since(rep.Started).Round(time.Millisecond), c.Out, c.Out)
+	return runs, nil
+}
+
+// sweepSize is how many runs the grid takes.
+func sweepSize(c sweepConfig, ls []sweepLogger, dim func([]int, bool) []int) int {
+	n := 0
+	for _, l := range ls {
+		n += len(c.Goroutines) * len(dim(c.Batch, l.batch)) * len(dim(c.Chan, l.chanB)) * c.Trials
+	}
+	return n
+}
+
+// writeSweepCSV writes rows to path, one per run, with a header; a batch
+// or channel size that doesn't apply is left empty.
+func writeSweepCSV(path string, rows []sweepRow) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"logger", "goroutines", "entries", "batch", "chan", "trial", "time_ns", "cpu_ns", "throughput",
+		"log_p50_ns", "log_p99_ns", "durable_p50_ns", "durable_p99_ns", "fsyncs", "dropped", "suppressed", "silent"})
+	opt := func(v int64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatInt(v, 10)
+	}
+	for _, r := range rows {
+		w.Write([]string{r.Logger, strconv.Itoa(r.Goroutines), strconv.Itoa(r.Entries), opt(int64(r.Batch)), opt(int64(r.Chan)),
+			strconv.Itoa(r.Trial), strconv.FormatInt(r.TimeNS, 10), strconv.FormatInt(r.CPUNS, 10),
+			strconv.FormatFloat(r.Throughput, 'f', 0, 64), strconv.FormatInt(r.LogP50NS, 10), strconv.FormatInt(r.LogP99NS, 10),
+			opt(r.DurableP50), opt(r.DurableP99), strconv.FormatInt(r.Fsyncs, 10), strconv.FormatInt(r.Dropped, 10),
+			strconv.FormatInt(r.Suppressed, 10), strconv.FormatBool(r.Silent)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// splitList splits a comma-separated list of names; empty means none.
+func splitList(list string) []string {
+	var out []string
+	for _, f := range strings.Split(list, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
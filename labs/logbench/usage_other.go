@@ -0,0 +1,8 @@
+//go:build !unix
+
+package logbench
+
+import "time"
+
+// cpuTime has no getrusage to read here; the CPU column stays zero.
+func cpuTime() time.Duration { return 0 }
@@ -0,0 +1,210 @@
+package logcheck
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+)
+
+// expect is what the benchmark was run with; zero counts are taken from
+// the log.
+type expect struct {
+	goroutines int
+	entries    int
+	skew       time.Duration
+}
+
+// report is what check found in one log. Each problem list holds one
+// line per problem, in the order they were found.
+type report struct {
+	path       string
+	lines      int
+	goroutines int
+	entries    int
+
+	torn      []string // lines that don't parse or disagree with themselves
+	missing   []string // entries that never made it, as runs per goroutine
+	duplicate []string // entries logged once and written more than once
+	reordered []string // entries written after a later one of their goroutine
+	backwards []string // timestamps that go back
+}
+
+func (r *report) ok() bool {
+	return len(r.torn)+len(r.missing)+len(r.duplicate)+len(r.reordered)+len(r.backwards) == 0
+}
+
+// print writes r, with at most show problems of each kind (0: all).
+func (r *report) print(w io.Writer, show int) {
+	status := "OK"
+	if !r.ok() {
+		status = "CORRUPT"
+	}
+	fmt.Fprintf(w, "%s: %d lines, %d goroutines x %d entries: %s\n", r.path, r.lines, r.goroutines, r.entries, status)
+	for _, kind := range []struct {
+		name     string
+		problems []string
+	}{
+		{"torn lines", r.torn},
+		{"missing entries", r.missing},
+		{"duplicate entries", r.duplicate},
+		{"out-of-order entries", r.reordered},
+		{"timestamps going back", r.backwards},
+	} {
+		if len(kind.problems) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "  %s: %d\n", kind.name, len(kind.problems))
+		for i, p := range kind.problems {
+			if show > 0 && i == show {
+				fmt.Fprintf(w, "    ... %d more\n", len(kind.problems)-show)
+				break
+			}
+			fmt.Fprintf(w, "    %s\n", p)
+		}
+	}
+}
+
+// stamp is one entry's place in its goroutine's sequence.
+type stamp struct {
+	g, i int
+}
+
+// parse reads the goroutine and sequence number a benchmark entry
+// carries, requiring its context, message and fields to agree on them.
+func parse(line string) (stamp, time.Time, error) {
+	e, err := logger.ParseEntry(line)
+	if err != nil {
+		return stamp{}, time.Time{}, errors.New("not a log line")
+	}
+	var s stamp
+	if _, err := fmt.Sscanf(e.Context, "req-%d-%d", &s.g, &s.i); err != nil || e.Context != fmt.Sprintf("req-%d-%d", s.g, s.i) {
+		return stamp{}, time.Time{}, fmt.Errorf("context %q is not req-g-i", e.Context)
+	}
+	switch e.Level {
+	case "DEBUG", "INFO", "WARN", "ERROR":
+	default:
+		return stamp{}, time.Time{}, fmt.Errorf("level %q", e.Level)
+	}
+	msg := fmt.Sprintf("Message number %d from goroutine %d", s.i, s.g)
+	if e.Fields == nil {
+		// Text: the fields follow the message.
+		msg += fmt.Sprintf(" goroutine=%d seq=%d", s.g, s.i)
+	} else if len(e.Fields) != 2 || e.Fields["goroutine"] != float64(s.g) || e.Fields["seq"] != float64(s.i) {
+		return stamp{}, time.Time{}, fmt.Errorf("fields %v disagree with context %s", e.Fields, e.Context)
+	}
+	if e.Message != msg {
+		return stamp{}, time.Time{}, fmt.Errorf("message %q disagrees with context %s", e.Message, e.Context)
+	}
+	return s, e.Timestamp, nil
+}
+
+// check reads the log at path, with its rotated segments and gunzipped
+// if compressed, and reports what is wrong with it.
+func check(path string, want expect) (*report, error) {
+	f, err := logger.OpenLog(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := &report{path: path}
+	// seen[g][i] is the line entry i of goroutine g was first on.
+	seen := map[int]map[int]int{}
+	last := map[int]int{}        // the highest i seen from each goroutine
+	lastT := map[int]time.Time{} // and the latest timestamp
+	var latest time.Time
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		r.lines++
+		n, line := r.lines, sc.Text()
+		s, t, err := parse(line)
+		if err != nil {
+			r.torn = append(r.torn, fmt.Sprintf("line %d: %v: %q", n, err, excerpt(line)))
+			continue
+		}
+		r.goroutines = max(r.goroutines, s.g+1)
+		r.entries = max(r.entries, s.i+1)
+
+		if seen[s.g] == nil {
+			seen[s.g] = map[int]int{}
+			last[s.g] = -1
+		}
+		if first, ok := seen[s.g][s.i]; ok {
+			r.duplicate = append(r.duplicate, fmt.Sprintf("line %d: goroutine %d entry %d, first on line %d", n, s.g, s.i, first))
+			continue
+		}
+		seen[s.g][s.i] = n
+		if s.i < last[s.g] {
+			r.reordered = append(r.reordered, fmt.Sprintf("line %d: goroutine %d entry %d after entry %d", n, s.g, s.i, last[s.g]))
+		} else {
+			last[s.g] = s.i
+		}
+
+		if prev, ok := lastT[s.g]; ok && t.Before(prev) {
+			r.backwards = append(r.backwards, fmt.Sprintf("line %d: goroutine %d at %v, %v before its entry before", n, s.g, t.Format(time.StampMicro), prev.Sub(t)))
+		} else if t.Before(latest.Add(-want.skew)) {
+			r.backwards = append(r.backwards, fmt.Sprintf("line %d: %v, %v before the latest so far (-skew %v)", n, t.Format(time.StampMicro), latest.Sub(t), want.skew))
+		}
+		if t.After(lastT[s.g]) {
+			lastT[s.g] = t
+		}
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if want.goroutines > 0 {
+		r.goroutines = want.goroutines
+	}
+	if want.entries > 0 {
+		r.entries = want.entries
+	}
+	for g := 0; g < r.goroutines; g++ {
+		r.missing = append(r.missing, gaps(g, seen[g], r.entries)...)
+	}
+	return r, nil
+}
+
+// gaps lists the runs of entries 0..entries-1 of goroutine g that aren't
+// in seen.
+func gaps(g int, seen map[int]int, entries int) []string {
+	var out []string
+	for i := 0; i < entries; i++ {
+		if _, ok := seen[i]; ok {
+			continue
+		}
+		j := i
+		for j+1 < entries {
+			if _, ok := seen[j+1]; ok {
+				break
+			}
+			j++
+		}
+		run := "entry " + strconv.Itoa(i)
+		if j > i {
+			run = fmt.Sprintf("entries %d-%d", i, j)
+		}
+		out = append(out, fmt.Sprintf("goroutine %d: %s", g, run))
+		i = j
+	}
+	return out
+}
+
+// excerpt shortens a line for a report.
+func excerpt(line string) string {
+	line = strings.TrimSpace(line)
+	if len(line) > 80 {
+		line = line[:77] + "..."
+	}
+	return line
+}
@@ -0,0 +1,77 @@
+// Log checker
+// Verifies the log files HW8's benchmark writes (naive.log, mutex.log,
+// channel.log, ring.log, group.log, mmap.log, combine.log, remote.log, and
+// sharded.log, merged from its shards) and prints a corruption report for each. Every entry the
+// benchmark logs names the goroutine g that logged it and its sequence
+// number i there three times over: in its context ("req-g-i"), its
+// message ("Message number i from goroutine g") and its fields
+// (goroutine=g seq=i), in either format. So a line that doesn't parse, or
+// whose three disagree, is torn: two goroutines' writes were interleaved
+// into it. Across the file, each goroutine's entries must all be there,
+// once each, in the order it logged them, with timestamps that never go
+// backwards; the whole file's timestamps may step back only by as much
+// as -skew, since a goroutine stamps an entry before it gets into the
+// logger. The exit status is 1 if any log is corrupt.
+//
+// With no files named, it checks whichever of the benchmark's logs are in
+// the current directory. -goroutines and -entries say how many the
+// benchmark ran, so that a goroutine or a tail of entries lost entirely
+// is missed too; otherwise they are taken from the highest seen.
+//
+//	go run -race ./HW8 && go run ./cmd/logcheck
+//	go run ./cmd/logcheck -goroutines 8 -entries 50 naive.log
+//	go run ./HW8 -format json -goroutines 64 && go run ./cmd/logcheck -goroutines 64 -show 20
+package logcheck
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("logcheck")
+
+// benchLogs are the files HW8's benchmark writes.
+var benchLogs = []string{"naive.log", "mutex.log", "channel.log", "ring.log", "sharded.log", "group.log", "mmap.log", "combine.log", "remote.log"}
+
+func Main(args []string) {
+	var (
+		goroutines = cmdline.Int("goroutines", 0, "goroutines the benchmark ran (0: the highest seen)")
+		entries    = cmdline.Int("entries", 0, "entries each goroutine logged (0: the highest seen)")
+		skew       = cmdline.Duration("skew", time.Second, "most the file's timestamps may step back between goroutines")
+		show       = cmdline.Int("show", 5, "problems of each kind to print per log (0: all)")
+	)
+	cmdline.Parse(args)
+	files := cmdline.Args()
+	if len(files) == 0 {
+		for _, name := range benchLogs {
+			if _, err := os.Stat(name); err == nil {
+				files = append(files, name)
+			}
+		}
+		if len(files) == 0 {
+			fmt.Fprintln(os.Stderr, "logcheck: no logs named and none of", strings.Join(benchLogs, ", "), "here")
+			os.Exit(2)
+		}
+	}
+
+	corrupt := 0
+	for _, path := range files {
+		r, err := check(path, expect{goroutines: *goroutines, entries: *entries, skew: *skew})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "logcheck:", err)
+			os.Exit(1)
+		}
+		r.print(os.Stdout, *show)
+		if !r.ok() {
+			corrupt++
+		}
+	}
+	if corrupt > 0 {
+		fmt.Printf("%d of %d logs corrupt\n", corrupt, len(files))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,205 @@
+// Causal log merge
+// Merges HW8 logs written by several processes, each entry stamped with
+// logical clocks (package lclock, in the entry's "[@...]" bracket), into
+// one log on standard output (or -o), in a global order consistent with
+// causality: by vector clock (the default) or Lamport clock; -by wall
+// orders by the wall-clock timestamps instead. -check prints, for each
+// order, how many pairs of entries it puts the wrong way round by
+// happened-before, and how many pairs are concurrent, which any order
+// may put either way.
+//
+// -simulate DIR first writes logs to merge: -procs goroutine processes,
+// each with its own log file and a wall clock off by up to -skew, do
+// -events events each, local work or a message sent to or received from
+// another, stamping every one. Skew puts receives before their sends in
+// wall-clock order; the logical orders never do.
+//
+//	go run ./cmd/logmerge -simulate /tmp/logs -check -o /tmp/merged.log
+//	go run ./cmd/logmerge -by lamport a.log b.log c.log
+//	go run ./cmd/logmerge -simulate /tmp/logs -procs 5 -skew 10s -check -o /dev/null
+package logmerge
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/lclock"
+)
+
+var cmdline = labs.FlagSet("logmerge")
+
+func Main(args []string) {
+	var (
+		by       = cmdline.String("by", "vector", "merge order: vector | lamport | wall")
+		out      = cmdline.String("o", "", "write the merged log here instead of standard output")
+		check    = cmdline.Bool("check", false, "count causality violations and concurrent pairs in every order")
+		simulate = cmdline.String("simulate", "", "first write simulated process logs to this directory, and merge those")
+		procs    = cmdline.Int("procs", 3, "-simulate: processes")
+		events   = cmdline.Int("events", 100, "-simulate: events per process")
+		skew     = cmdline.Duration("skew", 5*time.Second, "-simulate: most a process's wall clock is off by")
+		seed     = cmdline.Int64("seed", 1, "-simulate: seed")
+	)
+	cmdline.Parse(args)
+	order, err := lclock.ParseBy(*by)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	files := cmdline.Args()
+	if *simulate != "" {
+		if files, err = simulateLogs(*simulate, *procs, *events, *skew, *seed); err != nil {
+			fmt.Fprintln(os.Stderr, "logmerge:", err)
+			os.Exit(1)
+		}
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "logmerge: name the logs to merge, or -simulate")
+		os.Exit(2)
+	}
+
+	var es []lclock.Entry
+	for _, path := range files {
+		got, err := read(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		es = append(es, got...)
+	}
+
+	if *check {
+		fmt.Fprintf(os.Stderr, "%d entries from %d logs\n", len(es), len(files))
+		for _, b := range lclock.Bys {
+			c := append([]lclock.Entry(nil), es...)
+			lclock.Order(c, b)
+			v, conc := lclock.Violations(c)
+			fmt.Fprintf(os.Stderr, "%-8v %6d causality violations, %d concurrent pairs\n", b, v, conc)
+		}
+	}
+
+	lclock.Order(es, order)
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	for _, e := range es {
+		bw.WriteString(e.LogEntry.String())
+	}
+	if err := bw.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// read parses every entry of the log at path.
+func read(path string) ([]lclock.Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []lclock.Entry
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		e, err := logger.ParseEntry(sc.Text())
+		if err == nil {
+			var le lclock.Entry
+			if le, err = lclock.Parse(e); err == nil {
+				out = append(out, le)
+				continue
+			}
+		}
+		return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+	}
+	return out, sc.Err()
+}
+
+// message is what simulated processes send each other.
+type message struct {
+	from  string
+	stamp lclock.Stamp
+}
+
+// simulateLogs runs procs processes exchanging messages and returns the
+// logs they wrote in dir.
+func simulateLogs(dir string, procs, events int, skew time.Duration, seed int64) ([]string, error) {
+	if procs < 2 {
+		return nil, fmt.Errorf("-simulate needs at least 2 processes, got %d", procs)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewSource(seed))
+	inbox := make([]chan message, procs)
+	logs := make([]logger.Logger, procs)
+	offset := make([]time.Duration, procs)
+	var files []string
+	for i := range inbox {
+		inbox[i] = make(chan message, events)
+		path := filepath.Join(dir, fmt.Sprintf("p%d.log", i))
+		l, err := logger.NewMutexLogger(path, 64)
+		if err != nil {
+			return nil, err
+		}
+		logs[i], files = l, append(files, path)
+		if skew > 0 {
+			offset[i] = time.Duration(rng.Int63n(int64(2*skew))) - skew
+		}
+	}
+
+	errs := make(chan error, procs)
+	for i := 0; i < procs; i++ {
+		go func() {
+			name := fmt.Sprintf("p%d", i)
+			clock := lclock.NewProcess(name)
+			rng := rand.New(rand.NewSource(seed + int64(i) + 1))
+			log := func(level, context, msg string, s lclock.Stamp) error {
+				return logs[i].Log(logger.LogEntry{Timestamp: time.Now().Add(offset[i]), Level: level, Context: context, Message: msg, Clock: s.String()})
+			}
+			var err error
+			for k := 0; k < events && err == nil; k++ {
+				switch r := rng.Intn(3); {
+				case r == 0:
+					err = log("INFO", name, fmt.Sprintf("work %d", k), clock.Event())
+				case r == 1:
+					to := (i + 1 + rng.Intn(procs-1)) % procs
+					s := clock.Event()
+					inbox[to] <- message{name, s}
+					err = log("INFO", name, fmt.Sprintf("send to p%d", to), s)
+				default:
+					select {
+					case m := <-inbox[i]:
+						err = log("INFO", name, "recv from "+m.from, clock.Receive(m.stamp))
+					default:
+						err = log("WARN", name, "inbox empty", clock.Event())
+					}
+				}
+				time.Sleep(time.Duration(rng.Intn(200)) * time.Microsecond)
+			}
+			if cerr := logs[i].Close(); err == nil {
+				err = cerr
+			}
+			errs <- err
+		}()
+	}
+	for range procs {
+		if err := <-errs; err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
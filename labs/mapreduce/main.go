@@ -0,0 +1,152 @@
+// MapReduce word count
+// Counts words with package mapreduce: the text (the files named, or
+// -words generated Zipf-distributed words) is split into -splits map
+// tasks on a worker pool, shuffled into -reducers partitions, and summed.
+// -fail crashes that fraction of task attempts partway through, and the
+// master re-executes them; the counts are checked against a plain serial
+// count either way. -log writes the task events through HW8's
+// ChannelLogger.
+//
+//	go run ./cmd/mapreduce
+//	go run ./cmd/mapreduce -fail 0.3 -log mapreduce.log
+//	go run ./cmd/mapreduce -splits 64 -reducers 8 -max 4 README.md HW8/logger/logger.go
+package mapreduce
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/mapreduce"
+	"example.com/operating-systems/pool"
+)
+
+var cmdline = labs.FlagSet("mapreduce")
+
+func Main(args []string) {
+	cfg := mapreduce.DefaultConfig
+	pcfg := pool.DefaultConfig
+	var (
+		splits  = cmdline.Int("splits", 16, "map tasks")
+		words   = cmdline.Int("words", 500000, "words to generate when no files are named")
+		top     = cmdline.Int("top", 10, "most common words to print")
+		logPath = cmdline.String("log", "", "write task events to this file")
+	)
+	cmdline.IntVar(&cfg.Reducers, "reducers", cfg.Reducers, "reduce partitions")
+	cmdline.IntVar(&cfg.Attempts, "attempts", cfg.Attempts, "tries per task")
+	cmdline.Float64Var(&cfg.Fail, "fail", 0.2, "fraction of task attempts to crash")
+	cmdline.Int64Var(&cfg.Seed, "seed", 1, "random seed")
+	cmdline.IntVar(&pcfg.Max, "max", pcfg.Max, "pool: most workers")
+	cmdline.Parse(args)
+
+	text, err := input(cmdline.Args(), *words, cfg.Seed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *logPath != "" {
+		l, err := logger.NewChannelLogger(*logPath, 64, 256)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg.Log = l
+		defer l.Close()
+	}
+	p, err := pool.New(pcfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer p.Shutdown(context.Background())
+
+	counts, stats, err := mapreduce.Run(p, cfg, mapreduce.Split(text, *splits),
+		func(s string, emit func(string, int)) error {
+			for _, w := range fields(s) {
+				emit(w, 1)
+			}
+			return nil
+		},
+		func(_ string, ones []int) (int, error) {
+			n := 0
+			for _, c := range ones {
+				n += c
+			}
+			return n, nil
+		})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(stats)
+
+	want := map[string]int{}
+	for _, w := range fields(text) {
+		want[w]++
+	}
+	bad := 0
+	for w, n := range want {
+		if counts[w] != n {
+			if bad < 5 {
+				fmt.Printf("    %q: counted %d, want %d\n", w, counts[w], n)
+			}
+			bad++
+		}
+	}
+	bad += max(0, len(counts)-len(want)) // words that shouldn't be there at all
+
+	keys := make([]string, 0, len(counts))
+	for w := range counts {
+		keys = append(keys, w)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if counts[keys[a]] != counts[keys[b]] {
+			return counts[keys[a]] > counts[keys[b]]
+		}
+		return keys[a] < keys[b]
+	})
+	for _, w := range keys[:min(*top, len(keys))] {
+		fmt.Printf("%8d  %s\n", counts[w], w)
+	}
+	if bad > 0 {
+		fmt.Printf("FAIL: %d of %d words miscounted\n", bad, len(want))
+		os.Exit(1)
+	}
+	fmt.Printf("ok: %d words, %d distinct, match the serial count\n", len(fields(text)), len(want))
+}
+
+// input reads the named files, or generates n words if there are none.
+func input(paths []string, n int, seed int64) (string, error) {
+	if len(paths) == 0 {
+		rng := rand.New(rand.NewSource(seed))
+		z := rand.NewZipf(rng, 1.2, 1, 5000)
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&b, "w%d ", z.Uint64())
+		}
+		return b.String(), nil
+	}
+	var b strings.Builder
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return "", err
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// fields splits s into lower-case words of letters and digits.
+func fields(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
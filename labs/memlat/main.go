@@ -0,0 +1,212 @@
+// Memory hierarchy latency and bandwidth
+// For working sets from -min to -max (doubling), measures
+//
+//	chase   load-to-load latency: a pointer chase through one word per
+//	        -line bytes in random order, a single cycle, so every load
+//	        waits for the last and the prefetcher can't guess the next
+//	stream  read bandwidth: a sequential sum over the whole set
+//	stride  ns per load for a sequential read of every -strides'th byte,
+//	        showing where a stride starts costing a line per load
+//
+// and then reads the cache sizes off the chase column: wherever latency
+// steps up by more than -step, the working set has just outgrown a
+// level, so that level holds about the size before the step. That is the
+// hardware under the lock and false-sharing experiments: a cache line
+// bouncing between cores costs what a miss to the next level does.
+//
+//	go run ./cmd/memlat
+//	go run ./cmd/memlat -max 256M -accesses 20000000
+//	go run ./cmd/memlat -strides 8,64,128,4096 -line 128
+package memlat
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("memlat")
+
+// row is one working-set size.
+type row struct {
+	size    int
+	chase   float64   // ns per dependent load
+	stream  float64   // GB/s
+	strided []float64 // ns per load, per stride
+}
+
+func Main(args []string) {
+	var (
+		minS     = cmdline.String("min", "4K", "smallest working set (K, M, G suffixes)")
+		maxS     = cmdline.String("max", "64M", "largest working set")
+		line     = cmdline.Int("line", 64, "bytes between chased words: the cache line size")
+		strideS  = cmdline.String("strides", "8,64,256", "comma-separated strides in bytes for the stride columns")
+		accesses = cmdline.Int("accesses", 4000000, "loads per chase or stride measurement")
+		step     = cmdline.Float64("step", 1.4, "latency ratio counted as a step to the next level")
+		seed     = cmdline.Int64("seed", 1, "seed for the chase order")
+	)
+	defer labs.ParseBench(cmdline, args)()
+	lo, err1 := parseSize(*minS)
+	hi, err2 := parseSize(*maxS)
+	var strides []int
+	for _, s := range strings.Split(*strideS, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 8 || n%8 != 0 {
+			fmt.Fprintf(os.Stderr, "memlat: stride %q should be a multiple of 8 bytes\n", s)
+			os.Exit(2)
+		}
+		strides = append(strides, n)
+	}
+	if err1 != nil || err2 != nil || lo < *line || hi < lo || *line < 8 || *line%8 != 0 {
+		fmt.Fprintln(os.Stderr, "memlat: need 8 <= line <= min <= max, line a multiple of 8")
+		os.Exit(2)
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	buf := make([]uint64, hi/8)
+	var rows []row
+	fmt.Printf("%10s %10s %12s", "set", "chase ns", "stream GB/s")
+	for _, s := range strides {
+		fmt.Printf(" %10s", fmt.Sprintf("%dB ns", s))
+	}
+	fmt.Println()
+	for size := lo; size <= hi; size *= 2 {
+		r := row{size: size}
+		words := buf[:size/8]
+		r.chase = chase(words, *line/8, *accesses, rng)
+		r.stream = stream(words)
+		for _, s := range strides {
+			r.strided = append(r.strided, strided(words, s/8, *accesses))
+		}
+		rows = append(rows, r)
+		fmt.Printf("%10s %10.2f %12.2f", formatSize(size), r.chase, r.stream)
+		for _, ns := range r.strided {
+			fmt.Printf(" %10.2f", ns)
+		}
+		fmt.Println()
+	}
+
+	// Cache sizes: each step up in chase latency from the current
+	// plateau ends a level at the size before it. A climb over several
+	// sizes (the TLB running out on the way, say) is one step, up to
+	// where it levels off.
+	fmt.Println()
+	level, base := 1, rows[0].chase
+	for i := 1; i < len(rows); i++ {
+		if rows[i].chase > *step*base {
+			end := rows[i-1].size
+			for i+1 < len(rows) && rows[i+1].chase > *step*rows[i].chase {
+				i++
+			}
+			fmt.Printf("latency steps up past %s (%.1fns -> %.1fns): level %d holds about %s\n",
+				formatSize(end), base, rows[i].chase, level, formatSize(end))
+			level++
+			base = rows[i].chase
+		} else if rows[i].chase < base {
+			base = rows[i].chase
+		}
+	}
+	if level == 1 {
+		fmt.Printf("no step in latency between %s and %s; try a wider range\n", formatSize(lo), formatSize(hi))
+	} else {
+		fmt.Printf("beyond that, %.1fns per load is the last level measured (memory, if -max is big enough)\n", rows[len(rows)-1].chase)
+	}
+}
+
+// sink keeps the loads from being optimized away.
+var sink uint64
+
+// chase links one word every step words of w into a single random cycle
+// (Sattolo's algorithm) and follows it n times, returning ns per load.
+func chase(w []uint64, step, n int, rng *rand.Rand) float64 {
+	nodes := len(w) / step
+	order := make([]int, nodes)
+	for i := range order {
+		order[i] = i * step
+	}
+	for i := nodes - 1; i > 0; i-- {
+		j := rng.Intn(i)
+		order[i], order[j] = order[j], order[i]
+	}
+	for i := range order {
+		w[order[i]] = uint64(order[(i+1)%nodes])
+	}
+	p := uint64(order[0])
+	for i := 0; i < nodes; i++ { // once round to warm the caches
+		p = w[p]
+	}
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		p = w[p]
+	}
+	el := time.Since(start)
+	sink += p
+	return float64(el.Nanoseconds()) / float64(n)
+}
+
+// stream sums w sequentially, enough times to take a while, and returns
+// GB/s read.
+func stream(w []uint64) float64 {
+	passes := max(1, (64<<20)/(len(w)*8))
+	var sum uint64
+	for _, v := range w { // warm
+		sum += v
+	}
+	start := time.Now()
+	for p := 0; p < passes; p++ {
+		for _, v := range w {
+			sum += v
+		}
+	}
+	el := time.Since(start)
+	sink += sum
+	return float64(passes*len(w)*8) / el.Seconds() / 1e9
+}
+
+// strided reads every step'th word of w in order, wrapping round, n times,
+// and returns ns per load.
+func strided(w []uint64, step, n int) float64 {
+	var sum uint64
+	i := 0
+	start := time.Now()
+	for k := 0; k < n; k++ {
+		sum += w[i]
+		i += step
+		if i >= len(w) {
+			i -= len(w)
+		}
+	}
+	el := time.Since(start)
+	sink += sum
+	return float64(el.Nanoseconds()) / float64(n)
+}
+
+// parseSize reads a byte count with an optional K, M or G suffix.
+func parseSize(s string) (int, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := 1
+	for suffix, m := range map[string]int{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if strings.HasSuffix(s, suffix) {
+			s, mult = strings.TrimSuffix(s, suffix), m
+		}
+	}
+	n, err := strconv.Atoi(s)
+	return n * mult, err
+}
+
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<30 && n%(1<<30) == 0:
+		return fmt.Sprintf("%dG", n>>30)
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dM", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dK", n>>10)
+	}
+	return fmt.Sprint(n)
+}
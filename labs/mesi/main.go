@@ -0,0 +1,150 @@
+// MESI cache-coherence simulator
+// Runs access traces through per-core private caches kept coherent by
+// MESI over a snooping bus (see package mesi) and compares what each
+// costs: hit rate, misses by kind (cold, capacity, and the coherence
+// misses, true or false sharing), upgrades, invalidations, write-backs,
+// cache-to-cache transfers and bus transactions per access. The
+// generated workloads mirror the lock and counter benchmarks: private
+// data, counters false-shared in one line or padded apart (cmd/falseshare),
+// one shared counter, and test-and-set, test-and-test-and-set and ticket
+// spinlocks (package locks). -trace runs traces from files instead, one
+// per core, interleaved round robin.
+//
+//	go run ./cmd/mesi
+//	go run ./cmd/mesi -patterns tas,ttas,ticket -cores 8 -n 100000
+//	go run ./cmd/mesi -patterns falseshare -v 24 -transitions
+//	go run ./cmd/mesi -trace core0.txt,core1.txt -per-core
+//
+// A trace has one access per line: "[@core] [r|w] address".
+package mesi
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/mesi"
+)
+
+var cmdline = labs.FlagSet("mesi")
+
+func Main(args []string) {
+	cfg := mesi.DefaultConfig
+	var (
+		patterns = cmdline.String("patterns", strings.Join(mesi.Patterns, ","), "comma-separated generated workloads: "+strings.Join(mesi.Patterns, " | "))
+		n        = cmdline.Int("n", 20000, "generated accesses per workload")
+		seed     = cmdline.Int64("seed", 1, "generated workloads: seed")
+		traces   = cmdline.String("trace", "", "comma-separated trace files, file i for core i unless its lines say @N")
+		verbose  = cmdline.Int("v", 0, "print the first n accesses of each run with the line's state in every cache")
+		perCore  = cmdline.Bool("per-core", false, "print each core's counts")
+		trans    = cmdline.Bool("transitions", false, "print how often each state transition happened")
+	)
+	cmdline.IntVar(&cfg.Cores, "cores", cfg.Cores, "cores, each with a private cache")
+	cmdline.IntVar(&cfg.Line, "line", cfg.Line, "bytes per cache line")
+	cmdline.IntVar(&cfg.Sets, "sets", cfg.Sets, "sets per cache")
+	cmdline.IntVar(&cfg.Ways, "ways", cfg.Ways, "lines per set")
+	cmdline.Parse(args)
+
+	type workload struct {
+		name     string
+		accesses []mesi.Access
+	}
+	var runs []workload
+	if *traces != "" {
+		var per [][]mesi.Access
+		for i, path := range strings.Split(*traces, ",") {
+			f, err := os.Open(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			t, err := mesi.ParseTrace(f, i)
+			f.Close()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+				os.Exit(1)
+			}
+			per = append(per, t)
+		}
+		runs = append(runs, workload{"trace", mesi.Interleave(per...)})
+	} else {
+		for _, p := range strings.Split(*patterns, ",") {
+			p = strings.TrimSpace(p)
+			acc, err := mesi.Generate(p, cfg.Cores, *n, cfg.Line, *seed)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			runs = append(runs, workload{p, acc})
+		}
+	}
+
+	fmt.Printf("%d cores, each %d sets x %d ways x %dB = %dB\n\n", cfg.Cores, cfg.Sets, cfg.Ways, cfg.Line, cfg.Sets*cfg.Ways*cfg.Line)
+	var results []mesi.Result
+	for _, w := range runs {
+		shown := 0
+		var trace func(mesi.Access, bool, mesi.MissKind, []mesi.State)
+		if *verbose > 0 {
+			fmt.Printf("%s:\n", w.name)
+			trace = func(a mesi.Access, hit bool, kind mesi.MissKind, states []mesi.State) {
+				if shown >= *verbose {
+					return
+				}
+				shown++
+				what := "hit"
+				if !hit {
+					what = kind.String() + " miss"
+				}
+				var st []string
+				for _, s := range states {
+					st = append(st, s.String())
+				}
+				fmt.Printf("    %-18v %-20s %s\n", a, what, strings.Join(st, " "))
+			}
+		}
+		r, err := mesi.Run(cfg, w.accesses, trace)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		results = append(results, r)
+		if *verbose > 0 {
+			fmt.Println()
+		}
+	}
+
+	fmt.Printf("%-10s %8s %6s %6s %6s %6s %6s %7s %7s %6s %6s %8s\n",
+		"workload", "accesses", "hit%", "cold", "cap", "true", "false", "upgrade", "inval", "wb", "xfer", "bus/acc")
+	for i, r := range results {
+		t := r.Total
+		fmt.Printf("%-10s %8d %6.1f %6d %6d %6d %6d %7d %7d %6d %6d %8.3f\n",
+			runs[i].name, t.Accesses(), 100*t.HitRate(), t.Misses[mesi.Cold], t.Misses[mesi.Capacity],
+			t.Misses[mesi.TrueSharing], t.Misses[mesi.FalseSharing], t.Upgrades, t.Invalidations, t.Writebacks,
+			t.Transfers, float64(t.Bus())/float64(max(1, t.Accesses())))
+		if *perCore {
+			for c, s := range r.PerCore {
+				fmt.Printf("    core %d: %v\n", c, s)
+			}
+		}
+	}
+	if *trans {
+		for i, r := range results {
+			fmt.Printf("\n%s transitions:\n", runs[i].name)
+			var ts []mesi.Transition
+			for t := range r.Transitions {
+				ts = append(ts, t)
+			}
+			sort.Slice(ts, func(a, b int) bool {
+				if ts[a].From != ts[b].From {
+					return ts[a].From < ts[b].From
+				}
+				return ts[a].To < ts[b].To
+			})
+			for _, t := range ts {
+				fmt.Printf("    %v -> %v %8d\n", t.From, t.To, r.Transitions[t])
+			}
+		}
+	}
+}
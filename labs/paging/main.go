@@ -0,0 +1,256 @@
+// Page replacement simulator
+// Runs a reference string through FIFO, LRU, CLOCK, random, and optimal
+// (OPT) replacement (see package vm) and reports hits, faults, and dirty
+// pages written back to swap; given several memory sizes it prints the
+// hit-rate curve of every policy and points out Belady's anomaly. With
+// -swap, pages live on a swap device (simulated, or a file used as a
+// raid.Disk) and every fault is timed, giving the effective access time.
+//
+//	go run ./cmd/paging                                     # 20 random references to 10 pages, 3 frames
+//	go run ./cmd/paging -refs 1,2,3,4,1,2,5,1,2,3,4,5 -policy fifo -frames 3,4
+//	go run ./cmd/paging -pattern 80-20 -n 10000 -pages 100 -frames 1-100 -q -svg curves.svg
+//	go run ./cmd/paging -trace addrs.txt -page 4k -frames 4-64
+//	go run ./cmd/paging -pattern 80-20 -n 2000 -pages 100 -writes 0.3 -frames 10,40,80 -swap swap.dat
+//
+// A reference string has page numbers separated by commas or spaces, "3w"
+// for a write; an address trace has "[@asid] [r|w|x] address" per line.
+package paging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/HW7/raid"
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/vm"
+)
+
+var cmdline = labs.FlagSet("paging")
+
+func Main(args []string) {
+	var (
+		policy = cmdline.String("policy", "fifo,lru,clock,random,opt", "comma-separated replacement policies: fifo | lru | clock | random | opt")
+		frames = cmdline.String("frames", "3", "comma-separated page frame counts, or ranges like 1-20")
+		refs   = cmdline.String("refs", "", "reference string, e.g. 1,2,3w,1 (default: generated)")
+		file   = cmdline.String("refs-file", "", "file holding a reference string")
+		trace  = cmdline.String("trace", "", "address trace to take the reference string from, one \"[@asid] [r|w|x] address\" per line")
+		page   = cmdline.String("page", "4k", "-trace: page size")
+		asize  = cmdline.String("asize", "4g", "-trace: address space size, to keep processes' pages apart")
+		ptrn   = cmdline.String("pattern", "random", "generated references: random | 80-20 | loop")
+		n      = cmdline.Int("n", 20, "generated references: how many")
+		pages  = cmdline.Int("pages", 10, "generated references: distinct pages")
+		writes = cmdline.Float64("writes", 0, "generated references: fraction of writes")
+		seed   = cmdline.Int64("seed", 0, "generated references and random replacement: seed")
+		quiet  = cmdline.Bool("q", false, "don't list every reference, only the totals")
+		csv    = cmdline.String("csv", "", "write the hit-rate curves to this CSV file")
+		svg    = cmdline.String("svg", "", "write the hit-rate curves to this SVG file")
+		swap   = cmdline.String("swap", "", "swap device for demand paging: sim (fixed -swap-in/-swap-out costs) or a file to use as a raid.Disk")
+		swapIn = cmdline.Duration("swap-in", 8*time.Millisecond, "-swap sim: time to read a page in")
+		swapOt = cmdline.Duration("swap-out", 8*time.Millisecond, "-swap sim: time to write a page out")
+		memNS  = cmdline.Float64("mem-ns", 100, "-swap: ns per memory access, for the effective access time")
+	)
+	cmdline.Parse(args)
+
+	var (
+		rs  []vm.PageRef
+		err error
+	)
+	switch {
+	case *refs != "":
+		rs, err = vm.ParseRefs(strings.NewReader(*refs))
+	case *file != "":
+		rs, err = readFile(*file, vm.ParseRefs)
+	case *trace != "":
+		var accesses []vm.Access
+		if accesses, err = readFile(*trace, vm.ParseTrace); err == nil {
+			var ps, as uint64
+			if ps, err = vm.ParseSize(*page); err == nil {
+				if as, err = vm.ParseSize(*asize); err == nil {
+					rs = vm.TraceRefs(accesses, max(ps, 1), as)
+				}
+			}
+		}
+	default:
+		rs, err = vm.GenRefs(*ptrn, max(*n, 1), *pages, *writes, *seed)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	sizes, err := parseFrames(*frames)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bad -frames:", err)
+		os.Exit(2)
+	}
+	var policies []string
+	for _, p := range strings.Split(*policy, ",") {
+		policies = append(policies, strings.TrimSpace(p))
+	}
+
+	curves, err := vm.Curves(rs, policies, sizes, *seed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	distinct := map[uint64]bool{}
+	for _, r := range rs {
+		distinct[r.Page] = true
+	}
+	fmt.Printf("%d references to %d distinct pages\n\n", len(rs), len(distinct))
+
+	if *swap != "" {
+		var disk *raid.Disk
+		if *swap != "sim" {
+			if disk, err = raid.OpenDisk(*swap); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		// demand runs one policy at one size with every page on swap
+		demand := func(name string, size int, record bool) vm.DemandResult {
+			var dev vm.Swap = vm.SimSwap{In: *swapIn, Out: *swapOt}
+			if disk != nil {
+				dev = vm.NewDiskSwap(disk)
+			}
+			p, _ := vm.NewReplacer(name, rs, *seed)
+			res, err := vm.RunDemand(rs, size, p, dev, record)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return res
+		}
+		if len(sizes) == 1 {
+			var results []vm.DemandResult
+			for _, name := range policies {
+				res := demand(name, sizes[0], !*quiet)
+				fmt.Println(res.Format(*memNS))
+				results = append(results, res)
+			}
+			fmt.Printf("%-6s %7s %10s %9s %10s %12s %14s\n", "policy", "faults", "fault rate", "page-ins", "page-outs", "per fault", "EAT (ns)")
+			for _, r := range results {
+				fmt.Printf("%-6s %7d %9.2f%% %9d %10d %12v %14.1f\n", r.Policy, r.Faults, 100*r.FaultRate(), r.PageIns, r.PageOuts,
+					r.ServiceTime().Round(time.Microsecond), r.EffectiveAccessTime(*memNS))
+			}
+		} else {
+			// The effective access time curve, with the fault rate behind it
+			fmt.Printf("effective access time in ns (fault rate), %.0f ns memory\n%6s", *memNS, "frames")
+			for _, c := range curves {
+				fmt.Printf(" %22s", c.Policy)
+			}
+			fmt.Println()
+			for _, size := range sizes {
+				fmt.Printf("%6d", size)
+				for _, name := range policies {
+					r := demand(name, size, false)
+					fmt.Printf(" %13.1f (%5.2f%%)", r.EffectiveAccessTime(*memNS), 100*r.FaultRate())
+				}
+				fmt.Println()
+			}
+		}
+	} else if len(sizes) == 1 {
+		// One memory size: every step, then the totals side by side
+		for _, name := range policies {
+			p, _ := vm.NewReplacer(name, rs, *seed)
+			res, err := vm.RunPaging(rs, sizes[0], p, !*quiet)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			fmt.Println(res.Format())
+		}
+		fmt.Printf("%-6s %7s %7s %6s %9s %10s\n", "policy", "hits", "faults", "cold", "hit rate", "writebacks")
+		for _, c := range curves {
+			r := c.Points[0]
+			fmt.Printf("%-6s %7d %7d %6d %8.2f%% %10d\n", c.Policy, r.Hits, r.Faults, r.Cold, 100*r.HitRate(), r.Writebacks)
+		}
+	} else {
+		// A curve per policy: hit rate against memory size
+		fmt.Printf("%6s", "frames")
+		for _, c := range curves {
+			fmt.Printf(" %8s", c.Policy)
+		}
+		fmt.Println()
+		for i, size := range sizes {
+			fmt.Printf("%6d", size)
+			for _, c := range curves {
+				fmt.Printf(" %7.2f%%", 100*c.Points[i].HitRate())
+			}
+			fmt.Println()
+		}
+		for _, c := range curves {
+			if a := c.Anomalies(); len(a) > 0 {
+				fmt.Printf("\n%s shows Belady's anomaly: more faults with %v frame(s) than with one fewer", c.Policy, a)
+			}
+		}
+		fmt.Println()
+	}
+
+	if *csv != "" {
+		writeFile(*csv, func(w io.Writer) error { return vm.WriteCurvesCSV(w, curves) })
+	}
+	if *svg != "" {
+		writeFile(*svg, func(w io.Writer) error { return vm.WriteCurvesSVG(w, curves) })
+	}
+}
+
+// readFile parses the named file.
+func readFile[T any](name string, parse func(io.Reader) (T, error)) (T, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer f.Close()
+	return parse(f)
+}
+
+// writeFile creates the named file and fills it, exiting on failure.
+func writeFile(name string, write func(io.Writer) error) {
+	f, err := os.Create(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := write(f); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// parseFrames parses a comma-separated list of counts and ranges, like
+// "1,2,8-16", in increasing order.
+func parseFrames(list string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(list, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(f), "-")
+		a, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, err
+		}
+		b := a
+		if isRange {
+			if b, err = strconv.Atoi(hi); err != nil {
+				return nil, err
+			}
+		}
+		for v := a; v <= b; v++ {
+			if len(out) > 0 && v <= out[len(out)-1] {
+				return nil, fmt.Errorf("frame counts must increase, got %d after %d", v, out[len(out)-1])
+			}
+			out = append(out, v)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no frame counts in %q", list)
+	}
+	return out, nil
+}
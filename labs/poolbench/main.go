@@ -0,0 +1,137 @@
+// Worker pool benchmark
+// Runs -tasks small CPU-bound tasks (-work µs each) in bursts of -burst,
+// -gap apart, first the hand-rolled way (a goroutine per task and a
+// WaitGroup) and then on a pool of package pool over each queue kind, and
+// reports throughput, the pool's peak workers and workers started, and how
+// long tasks waited and ran. -panic makes every n-th task panic, to show
+// the pool recovering and counting it; the goroutine-per-task run
+// recovers them by hand.
+//
+//	go run ./cmd/poolbench
+//	go run ./cmd/poolbench -tasks 100000 -work 5 -max 4 -queue 64
+//	go run ./cmd/poolbench -burst 500 -gap 50ms -idle 10ms -panic 1000
+package poolbench
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/pool"
+	"example.com/operating-systems/queue"
+)
+
+var cmdline = labs.FlagSet("poolbench")
+
+func Main(args []string) {
+	cfg := pool.DefaultConfig
+	var (
+		tasks  = cmdline.Int("tasks", 20000, "tasks to run")
+		work   = cmdline.Int("work", 20, "µs of work per task")
+		burst  = cmdline.Int("burst", 2000, "tasks submitted back to back")
+		gap    = cmdline.Duration("gap", 5*time.Millisecond, "pause between bursts")
+		every  = cmdline.Int("panic", 0, "make every n-th task panic; 0 for none")
+		kinds  = cmdline.String("kinds", "two-lock,ms", "comma-separated pool queue kinds: two-lock | ms | ms-hp")
+		direct = cmdline.Bool("goroutines", true, "also run a goroutine per task, for comparison")
+	)
+	cmdline.IntVar(&cfg.Min, "min", cfg.Min, "pool: fewest workers")
+	cmdline.IntVar(&cfg.Max, "max", cfg.Max, "pool: most workers")
+	cmdline.IntVar(&cfg.Queue, "queue", cfg.Queue, "pool: queued tasks")
+	cmdline.DurationVar(&cfg.Idle, "idle", cfg.Idle, "pool: let an idle worker go this often")
+	defer labs.ParseBench(cmdline, args)()
+
+	var sum atomic.Uint64 // keeps the work from being optimized away
+	task := func(i int) func() {
+		return func() {
+			if *every > 0 && i%*every == *every-1 {
+				panic(fmt.Sprintf("task %d", i))
+			}
+			sum.Add(busyUS(*work))
+		}
+	}
+	bursts := func(submit func(i int) error) error {
+		for i := 0; i < *tasks; i++ {
+			if i > 0 && i%max(1, *burst) == 0 {
+				time.Sleep(*gap)
+			}
+			if err := submit(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	fmt.Printf("%-14s %10s %10s %6s %8s %8s   %s\n", "run", "elapsed", "tasks/s", "peak", "spawned", "panics", "task wait / run")
+	if *direct {
+		var wg sync.WaitGroup
+		var panics atomic.Int64
+		start := time.Now()
+		bursts(func(i int) error {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					if recover() != nil {
+						panics.Add(1)
+					}
+				}()
+				task(i)()
+			}()
+			return nil
+		})
+		wg.Wait()
+		el := time.Since(start)
+		fmt.Printf("%-14s %10v %10.0f %6s %8s %8d   -\n", "goroutines", el.Round(time.Millisecond),
+			float64(*tasks)/el.Seconds(), "-", "-", panics.Load())
+	}
+	for _, name := range strings.Split(*kinds, ",") {
+		k, err := queue.ParseKind(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		c := cfg
+		c.Kind = k
+		p, err := pool.New(c)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		start := time.Now()
+		if err := bursts(func(i int) error { return p.Submit(task(i)) }); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := p.Shutdown(context.Background()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		el := time.Since(start)
+		s := p.Stats()
+		fmt.Printf("%-14s %10v %10.0f %6d %8d %8d   wait %v\n%66s run %v\n", "pool/"+k.String(), el.Round(time.Millisecond),
+			float64(s.Completed)/el.Seconds(), s.Peak, s.Spawned, s.Panics, &s.Wait, "", &s.Run)
+		if s.Completed != *tasks {
+			fmt.Fprintf(os.Stderr, "pool/%v completed %d of %d tasks\n", k, s.Completed, *tasks)
+			os.Exit(1)
+		}
+	}
+	_ = sum.Load()
+}
+
+// busyUS burns about us microseconds and returns a value that depends on
+// the work.
+func busyUS(us int) uint64 {
+	end := time.Now().Add(time.Duration(us) * time.Microsecond)
+	x := uint64(1469598103934665603)
+	for time.Now().Before(end) {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+	}
+	return x
+}
@@ -0,0 +1,223 @@
+// Bounded buffer modes (HW1 extension)
+// The two other textbook producer/consumer solutions next to channels
+// (OSTEP ch. 30-31): a bounded buffer guarded by a mutex and two condition
+// variables, and one guarded by counting semaphores. Both data and ACKs go
+// through the same kind of buffer so the primitive is all that changes.
+
+package prodcons
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// boundedBuffer is a fixed-capacity FIFO shared by producer and consumer.
+type boundedBuffer interface {
+	put(m message)
+	get() (message, bool) // false once closed and drained
+	close()
+}
+
+// ring is the unsynchronized FIFO storage both buffers wrap.
+type ring struct {
+	items      []message
+	head, size int
+}
+
+func (r *ring) push(m message) {
+	r.items[(r.head+r.size)%len(r.items)] = m
+	r.size++
+}
+
+func (r *ring) pop() message {
+	m := r.items[r.head]
+	r.head = (r.head + 1) % len(r.items)
+	r.size--
+	return m
+}
+
+/* ---------------- mutex + condition variables ---------------- */
+
+type condBuffer struct {
+	mu       sync.Mutex
+	notFull  *sync.Cond
+	notEmpty *sync.Cond
+	buf      ring
+	closed   bool
+}
+
+func newCondBuffer(capacity int) boundedBuffer {
+	b := &condBuffer{buf: ring{items: make([]message, max(capacity, 1))}}
+	b.notFull = sync.NewCond(&b.mu)
+	b.notEmpty = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *condBuffer) put(m message) {
+	b.mu.Lock()
+	for b.buf.size == len(b.buf.items) { // while, not if (Mesa semantics)
+		b.notFull.Wait()
+	}
+	b.buf.push(m)
+	b.notEmpty.Signal()
+	b.mu.Unlock()
+}
+
+func (b *condBuffer) get() (message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.buf.size == 0 {
+		if b.closed {
+			return message{}, false
+		}
+		b.notEmpty.Wait()
+	}
+	m := b.buf.pop()
+	b.notFull.Signal()
+	return m, true
+}
+
+func (b *condBuffer) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.notEmpty.Broadcast()
+	b.mu.Unlock()
+}
+
+/* ---------------- counting semaphores ---------------- */
+
+// semaphore is a counting semaphore built from a lock and a condition
+// variable (OSTEP Figure 31.17), since Go has no user-level semaphore.
+type semaphore struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	n    int
+}
+
+func newSemaphore(n int) *semaphore {
+	s := &semaphore{n: n}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// wait (P) blocks until the count is positive, then decrements it.
+func (s *semaphore) wait() {
+	s.mu.Lock()
+	for s.n <= 0 {
+		s.cond.Wait()
+	}
+	s.n--
+	s.mu.Unlock()
+}
+
+// post (V) increments the count and wakes one waiter.
+func (s *semaphore) post() {
+	s.mu.Lock()
+	s.n++
+	s.cond.Signal()
+	s.mu.Unlock()
+}
+
+type semBuffer struct {
+	empty  *semaphore // free slots
+	full   *semaphore // filled slots (plus one token on close)
+	mutex  *semaphore // binary semaphore around the ring
+	buf    ring
+	closed bool
+}
+
+func newSemBuffer(capacity int) boundedBuffer {
+	capacity = max(capacity, 1)
+	return &semBuffer{
+		empty: newSemaphore(capacity),
+		full:  newSemaphore(0),
+		mutex: newSemaphore(1),
+		buf:   ring{items: make([]message, capacity)},
+	}
+}
+
+func (b *semBuffer) put(m message) {
+	b.empty.wait()
+	b.mutex.wait()
+	b.buf.push(m)
+	b.mutex.post()
+	b.full.post()
+}
+
+func (b *semBuffer) get() (message, bool) {
+	b.full.wait()
+	b.mutex.wait()
+	if b.buf.size == 0 && b.closed {
+		b.mutex.post()
+		b.full.post() // pass the close token on to any other consumer
+		return message{}, false
+	}
+	m := b.buf.pop()
+	b.mutex.post()
+	b.empty.post()
+	return m, true
+}
+
+func (b *semBuffer) close() {
+	b.mutex.wait()
+	b.closed = true
+	b.mutex.post()
+	b.full.post()
+}
+
+/* ---------------- exchange ---------------- */
+
+// runBounded is runGoroutine with the channels swapped for bounded buffers
+// built by newBuf (--buf is the data buffer's capacity; 0 means 1 slot).
+func runBounded(ctx context.Context, c config, newBuf func(capacity int) boundedBuffer) (result, error) {
+	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	data := newBuf(c.buf)
+	ack := newBuf(1)
+	payload := makePayload(c.msgsize)
+
+	start := time.Now()
+
+	// Consumer goroutine
+	go func() {
+		got := 0
+		buf := make([]byte, c.msgsize)
+		for {
+			m, ok := data.get()
+			if !ok {
+				return
+			}
+			copy(buf, m.payload)
+			if !c.quiet && m.seq <= 5 {
+				fmt.Printf("Consumer: %d\n", m.seq)
+			}
+			got++
+			if got%c.window == 0 {
+				ack.put(message{seq: m.seq})
+			}
+		}
+	}()
+
+	// Producer (main goroutine)
+	clock := newRTTClock(c)
+	done := ctx.Done()
+	sent := 0
+	for i := 1; i <= c.n && !interrupted(done); i++ {
+		if !c.quiet && i <= 5 {
+			fmt.Printf("Producer: %d\n", i)
+		}
+		clock.send(i, c)
+		data.put(message{seq: i, payload: payload})
+		sent = i
+		if i%c.window == 0 {
+			ack.get()
+			clock.acked()
+		}
+	}
+	data.close()
+
+	return result{elapsed: time.Since(start), rtt: clock.samples, sent: sent}, ctx.Err()
+}
@@ -0,0 +1,132 @@
+// errgroup mode (HW1 extension)
+// The goroutine mode rewritten as structured concurrency: producer and
+// consumer are both members of an errGroup, every blocking channel
+// operation also watches the group's context, and the first error (or
+// Ctrl-C) cancels the other side instead of leaving it blocked. The consumer
+// checks that sequence numbers arrive in order, so there is a real error to
+// propagate. Benchmarked next to goroutine mode to show what the extra
+// select cases cost.
+//
+// errGroup has the same shape as golang.org/x/sync/errgroup (WithContext,
+// Go, Wait), written out here to keep the project standard-library only.
+
+package prodcons
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// errGroup runs goroutines that share a context, cancelled by the first error.
+type errGroup struct {
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+	cancel context.CancelCauseFunc
+}
+
+// withErrGroup returns a group and the context its goroutines should watch.
+func withErrGroup(ctx context.Context) (*errGroup, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &errGroup{cancel: cancel}, ctx
+}
+
+// Go runs f in its own goroutine; a non-nil error cancels the group.
+func (g *errGroup) Go(f func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := f(); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				g.cancel(err)
+			})
+		}
+	}()
+}
+
+// Wait blocks until every goroutine has returned and reports the first error.
+func (g *errGroup) Wait() error {
+	g.wg.Wait()
+	g.cancel(nil)
+	return g.err
+}
+
+func runErrgroup(ctx context.Context, c config) (result, error) {
+	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	g, gctx := withErrGroup(ctx)
+	done := gctx.Done()
+	data := make(chan message, c.buf)
+	ack := make(chan struct{})
+	payload := makePayload(c.msgsize)
+	clock := newRTTClock(c)
+	sent := 0
+
+	start := time.Now()
+
+	// Consumer
+	g.Go(func() error {
+		got := 0
+		buf := make([]byte, c.msgsize)
+		for {
+			var m message
+			select {
+			case v, ok := <-data:
+				if !ok {
+					return nil
+				}
+				m = v
+			case <-done:
+				return gctx.Err()
+			}
+			if m.seq != got+1 {
+				return fmt.Errorf("consumer: got message %d, want %d", m.seq, got+1)
+			}
+			copy(buf, m.payload)
+			if !c.quiet && m.seq <= 5 {
+				fmt.Printf("Consumer: %d\n", m.seq)
+			}
+			got++
+			if got%c.window == 0 {
+				select {
+				case ack <- struct{}{}:
+				case <-done:
+					return gctx.Err()
+				}
+			}
+		}
+	})
+
+	// Producer
+	g.Go(func() error {
+		defer close(data)
+		for i := 1; i <= c.n; i++ {
+			if !c.quiet && i <= 5 {
+				fmt.Printf("Producer: %d\n", i)
+			}
+			clock.send(i, c)
+			select {
+			case data <- message{seq: i, payload: payload}:
+			case <-done:
+				return gctx.Err()
+			}
+			sent = i
+			if i%c.window == 0 {
+				select {
+				case <-ack:
+					clock.acked()
+				case <-done:
+					return gctx.Err()
+				}
+			}
+		}
+		return nil
+	})
+
+	err := g.Wait() // Wait orders the goroutines' writes before our reads
+	return result{elapsed: time.Since(start), rtt: clock.samples, sent: sent}, err
+}
@@ -0,0 +1,140 @@
+// Fan-in mode (HW1 extension)
+// --producers P goroutines each own a channel; a single consumer selects
+// across all of them (reflect.Select, since P is only known at run time)
+// plus a --fanin-timeout case, until n messages have been consumed. Go's
+// select picks uniformly among ready cases, so the interesting output is
+// how evenly that spreads service: per-producer counts and latencies, and
+// Jain's fairness index (1 = perfectly even, 1/P = one producer got it all).
+// The usual rtt line holds send -> consume latency here, as there are no ACKs.
+
+package prodcons
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// faninMsg is one item from producer `from`, stamped when it was sent.
+type faninMsg struct {
+	from int
+	seq  int
+	at   time.Time
+}
+
+// faninStats is what fan-in mode reports on top of the usual result.
+type faninStats struct {
+	served   []int        // messages consumed per producer
+	latency  []latSummary // send -> consume, per producer
+	timeouts int          // select rounds that hit the timeout
+}
+
+// jain returns Jain's fairness index of the per-producer service counts.
+func (f *faninStats) jain() float64 {
+	var sum, sq float64
+	for _, v := range f.served {
+		sum += float64(v)
+		sq += float64(v) * float64(v)
+	}
+	if sq == 0 {
+		return 0
+	}
+	return sum * sum / (float64(len(f.served)) * sq)
+}
+
+func (f *faninStats) String() string {
+	total := 0
+	for _, v := range f.served {
+		total += v
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "fan-in producers=%d jain=%.4f timeouts=%d", len(f.served), f.jain(), f.timeouts)
+	for i, v := range f.served {
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(v) / float64(total)
+		}
+		fmt.Fprintf(&b, "\n  producer %d: served=%d (%.1f%%)  %v", i+1, v, share, f.latency[i].format("latency"))
+	}
+	return b.String()
+}
+
+func runFanin(ctx context.Context, c config) (result, error) {
+	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	p := max(c.producers, 1)
+	stop := make(chan struct{}) // closed once n messages have been consumed
+	chans := make([]chan faninMsg, p)
+	var wg sync.WaitGroup
+	for i := range chans {
+		chans[i] = make(chan faninMsg, c.buf)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for seq := 1; ; seq++ {
+				select {
+				case chans[i] <- faninMsg{from: i, seq: seq, at: time.Now()}:
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	// Select cases: one per producer, then the timeout, then cancellation
+	cases := make([]reflect.SelectCase, p+2)
+	for i, ch := range chans {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}
+	}
+	timeoutCase, doneCase := p, p+1
+	timer := time.NewTimer(c.faninTimeout)
+	defer timer.Stop()
+	cases[timeoutCase] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)}
+	cases[doneCase] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+
+	stats := &faninStats{served: make([]int, p), latency: make([]latSummary, p)}
+	samples := make([][]time.Duration, p)
+	var all []time.Duration
+	got := 0
+	start := time.Now()
+	for got < c.n {
+		chosen, v, _ := reflect.Select(cases)
+		if chosen == doneCase {
+			break
+		}
+		if chosen == timeoutCase {
+			stats.timeouts++
+			timer.Reset(c.faninTimeout)
+			continue
+		}
+		m := v.Interface().(faninMsg)
+		d := time.Since(m.at)
+		samples[m.from] = append(samples[m.from], d)
+		all = append(all, d)
+		stats.served[m.from]++
+		got++
+		if !c.quiet && got <= 5 {
+			fmt.Printf("Consumer: %d from producer %d\n", m.seq, m.from+1)
+		}
+		timer.Reset(c.faninTimeout) // the timeout bounds the wait for the next message
+	}
+	elapsed := time.Since(start)
+	close(stop)
+	wg.Wait()
+
+	for i, s := range samples {
+		stats.latency[i] = summarizeLatency(s)
+	}
+	return result{elapsed: elapsed, rtt: all, sent: got, fanin: stats}, ctx.Err()
+}
+
+// printFanin prints the fairness report of a fan-in run.
+func printFanin(res result) {
+	if res.fanin != nil {
+		fmt.Printf("  %v\n", res.fanin)
+	}
+}
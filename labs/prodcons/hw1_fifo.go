@@ -0,0 +1,148 @@
+//go:build unix
+
+// Named pipe (FIFO) mode (HW1 extension)
+// Data and ACK travel over two mkfifo-created pipes in a directory, so the
+// producer and consumer don't have to be parent and child:
+//
+//	terminal 1: go run . --mode fifo --fifo /tmp/hw1
+//	terminal 2: go run . --role=consumer --fifo /tmp/hw1
+//
+// Without --fifo the producer uses a temp directory and spawns the consumer
+// itself (this is what --bench does).
+
+package prodcons
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"example.com/operating-systems/labs"
+)
+
+const (
+	fifoData = "data.fifo" // producer -> consumer
+	fifoAck  = "ack.fifo"  // consumer -> producer
+)
+
+// makeFifos creates the two named pipes in dir, keeping any that already exist.
+func makeFifos(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, name := range []string{fifoData, fifoAck} {
+		err := syscall.Mkfifo(filepath.Join(dir, name), 0o600)
+		if err != nil && err != syscall.EEXIST {
+			return err
+		}
+	}
+	return nil
+}
+
+func runFifo(ctx context.Context, c config) (result, error) {
+	dir := c.fifo
+	var cmd *exec.Cmd
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "hw1-fifo-*")
+		if err != nil {
+			return result{}, err
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+		cmd = spawnConsumer(c, "--fifo="+dir)
+	}
+	if err := makeFifos(dir); err != nil {
+		return result{}, err
+	}
+	exited := make(chan error, 1)
+	if cmd != nil {
+		if err := cmd.Start(); err != nil {
+			return result{}, err
+		}
+		go func() { exited <- cmd.Wait() }()
+	} else {
+		fmt.Printf("waiting for consumer: run `%s` in another terminal\n",
+			strings.Join(labs.Command(c.childArgs("--fifo="+dir)...).Args, " "))
+	}
+
+	data, ack, err := openFifos(ctx, dir)
+	if err != nil {
+		if cmd != nil {
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+		return result{}, err
+	}
+	defer ack.Close()
+
+	start := time.Now()
+	res, err := produceStream(ctx, data, ack, c, func() { _ = data.Close() })
+	res.elapsed = time.Since(start)
+	_ = data.Close()
+	if err != nil {
+		if cmd != nil {
+			_ = stopChild(cmd, exited)
+		}
+		return res, err
+	}
+	if cmd != nil {
+		if err := <-exited; err != nil {
+			return result{}, err
+		}
+	}
+	res.elapsed = time.Since(start)
+	return res, nil
+}
+
+// openFifos opens the producer ends. Opening a FIFO blocks until the other
+// end opens it too, so it runs in the background where Ctrl-C can abandon
+// it. Both sides open data first, then ack, so the rendezvous can't deadlock.
+func openFifos(ctx context.Context, dir string) (data, ack *os.File, err error) {
+	type pair struct {
+		data, ack *os.File
+		err       error
+	}
+	opened := make(chan pair, 1)
+	go func() {
+		d, err := os.OpenFile(filepath.Join(dir, fifoData), os.O_WRONLY, 0)
+		if err != nil {
+			opened <- pair{err: err}
+			return
+		}
+		a, err := os.OpenFile(filepath.Join(dir, fifoAck), os.O_RDONLY, 0)
+		if err != nil {
+			d.Close()
+		}
+		opened <- pair{d, a, err}
+	}()
+	select {
+	case p := <-opened:
+		return p.data, p.ack, p.err
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+// Consumer entry for fifo mode; may be a spawned child or started by hand.
+func consumerFifo(c config) error {
+	dir := c.fifo
+	if err := makeFifos(dir); err != nil {
+		return err
+	}
+	data, err := os.OpenFile(filepath.Join(dir, fifoData), os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	ack, err := os.OpenFile(filepath.Join(dir, fifoAck), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer ack.Close()
+	return consumeStream(data, ack, c)
+}
@@ -0,0 +1,77 @@
+// Round-trip latency accounting (HW1 extension)
+// Every mode times each window from the send of its first message to the
+// ACK that releases it. With --window 1 that is a plain per-message RTT.
+
+package prodcons
+
+import (
+	"fmt"
+	"time"
+
+	"example.com/operating-systems/stats"
+)
+
+// result is what one exchange reports back to the harness.
+type result struct {
+	elapsed  time.Duration
+	rtt      []time.Duration // send -> ACK, one sample per window
+	sent     int             // messages sent (less than n if interrupted)
+	usage    usage           // filled in by runMeasured
+	stages   []latSummary    // per-stage hop latency (pipeline modes)
+	crashes  int             // consumer restarts (restart mode)
+	recovery []time.Duration // restart mode: failure detected -> first ACK from the new consumer
+	fanin    *faninStats     // fan-in mode fairness report
+	qdelay   latSummary      // --rate: due -> taken by the consumer
+}
+
+// rttClock tracks the open window on the producer side.
+type rttClock struct {
+	sent    time.Time
+	samples []time.Duration
+}
+
+// rttPrealloc caps the samples reserved up front; a huge --n (or a restart
+// mode session that ends early) shouldn't allocate it all at once.
+const rttPrealloc = 1 << 20
+
+func newRTTClock(c config) *rttClock {
+	return &rttClock{samples: make([]time.Duration, 0, min(c.n/c.window+1, rttPrealloc))}
+}
+
+// send notes message i; only the first message of a window starts the clock.
+func (r *rttClock) send(i int, c config) {
+	if (i-1)%c.window == 0 {
+		r.sent = time.Now()
+	}
+}
+
+// acked closes the window.
+func (r *rttClock) acked() {
+	r.samples = append(r.samples, time.Since(r.sent))
+}
+
+type latSummary struct {
+	N                  int
+	P50, P95, P99, Max time.Duration
+}
+
+func summarizeLatency(ds []time.Duration) latSummary {
+	s := stats.Summarize(ds)
+	return latSummary{
+		N:   s.N,
+		P50: s.Quantile(0.50),
+		P95: s.Quantile(0.95),
+		P99: s.Quantile(0.99),
+		Max: s.Max,
+	}
+}
+
+func (s latSummary) String() string { return s.format("rtt") }
+
+// format prints the summary under the given label.
+func (s latSummary) format(label string) string {
+	if s.N == 0 {
+		return label + ": no samples"
+	}
+	return fmt.Sprintf("%s p50=%v p95=%v p99=%v max=%v (N=%d)", label, s.P50, s.P95, s.P99, s.Max, s.N)
+}
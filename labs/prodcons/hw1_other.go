@@ -0,0 +1,33 @@
+//go:build !unix
+
+package prodcons
+
+import (
+	"context"
+	"errors"
+)
+
+// Shared-memory, FIFO, and process pipeline modes rely on mmap, mkfifo, and
+// passing extra fds to children, which this platform doesn't provide.
+var (
+	errShmUnsupported  = errors.New("shm mode requires a unix platform (mmap)")
+	errFifoUnsupported = errors.New("fifo mode requires a unix platform (mkfifo)")
+	errPipeUnsupported = errors.New("pipeline-proc mode requires a unix platform (inherited pipe fds)")
+)
+
+func runShm(ctx context.Context, c config) (result, error) { return result{}, errShmUnsupported }
+
+func consumerShm(path string, c config) error { return errShmUnsupported }
+
+func runFifo(ctx context.Context, c config) (result, error) { return result{}, errFifoUnsupported }
+
+func consumerFifo(c config) error { return errFifoUnsupported }
+
+func runPipelineProc(ctx context.Context, c config) (result, error) {
+	return result{}, errPipeUnsupported
+}
+
+func consumerStage(stage, last int, c config) error { return errPipeUnsupported }
+
+// getRusage has no getrusage(2) to call here; only runtime stats are reported.
+func getRusage(children bool) (rusage, bool) { return rusage{}, false }
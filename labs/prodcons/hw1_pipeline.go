@@ -0,0 +1,189 @@
+// Pipeline modes (HW1 extension)
+// The producer/consumer pair generalized to a chain of --stages K stages
+// after the producer: K-1 relays that pass each message on, then a final
+// consumer that ACKs back to the producer once per window. --stages 1 is
+// the original two-party exchange.
+//
+//	pipeline      - every stage is a goroutine, linked by channels (--buf)
+//	pipeline-proc - every stage is a child process, linked by pipes
+//
+// Each message is stamped when it is forwarded, so every stage records its
+// hop latency (upstream write -> this stage's read) next to the end-to-end RTT.
+
+package prodcons
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/operating-systems/ipc"
+)
+
+/* ---------------- goroutine pipeline ---------------- */
+
+// stamped is a message plus the time the previous stage forwarded it.
+type stamped struct {
+	message
+	at time.Time
+}
+
+func runPipeline(ctx context.Context, c config) (result, error) {
+	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	k := max(c.stages, 1)
+	links := make([]chan stamped, k) // links[i] feeds stage i+1
+	for i := range links {
+		links[i] = make(chan stamped, c.buf)
+	}
+	ack := make(chan struct{})
+	hops := make([][]time.Duration, k)
+	payload := makePayload(c.msgsize)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	// Relays: stages 1..k-1 copy the payload and pass the message on
+	for s := 0; s < k-1; s++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(links[s+1])
+			buf := make([]byte, c.msgsize)
+			samples := make([]time.Duration, 0, 1024)
+			for m := range links[s] {
+				samples = append(samples, time.Since(m.at))
+				copy(buf, m.payload)
+				links[s+1] <- stamped{message{seq: m.seq, payload: buf}, time.Now()}
+				buf = make([]byte, c.msgsize) // next stage may still hold the old one
+			}
+			hops[s] = samples
+		}()
+	}
+
+	// Final consumer: stage k
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		got := 0
+		buf := make([]byte, c.msgsize)
+		samples := make([]time.Duration, 0, 1024)
+		for m := range links[k-1] {
+			samples = append(samples, time.Since(m.at))
+			copy(buf, m.payload)
+			if !c.quiet && m.seq <= 5 {
+				fmt.Printf("Consumer: %d\n", m.seq)
+			}
+			got++
+			if got%c.window == 0 {
+				ack <- struct{}{}
+			}
+		}
+		hops[k-1] = samples
+	}()
+
+	// Producer (main goroutine)
+	clock := newRTTClock(c)
+	done := ctx.Done()
+	sent := 0
+	for i := 1; i <= c.n && !interrupted(done); i++ {
+		if !c.quiet && i <= 5 {
+			fmt.Printf("Producer: %d\n", i)
+		}
+		clock.send(i, c)
+		links[0] <- stamped{message{seq: i, payload: payload}, time.Now()}
+		sent = i
+		if i%c.window == 0 {
+			<-ack
+			clock.acked()
+		}
+	}
+	close(links[0])
+	elapsed := time.Since(start)
+	wg.Wait() // the close ripples down the chain; collect every stage's samples
+
+	res := result{elapsed: elapsed, rtt: clock.samples, sent: sent}
+	for _, h := range hops {
+		res.stages = append(res.stages, summarizeLatency(h))
+	}
+	return res, ctx.Err()
+}
+
+/* ---------------- process pipeline: stage ---------------- */
+
+// runStage is the body of pipeline stage `stage` of `last`. Relays forward
+// to out; the last stage ACKs on out instead. Hop latencies are measured
+// against the wall clock, which all the processes share.
+func runStage(stage, last int, in io.Reader, out io.Writer, c config) (latSummary, error) {
+	br := bufio.NewReaderSize(in, max(64*1024, c.msgsize+64))
+	r := ipc.NewStampedReader(br)
+	bw := bufio.NewWriterSize(out, 64*1024)
+	w := ipc.StampedWriter{Writer: bw}
+	samples := make([]time.Duration, 0, 1024)
+
+	got := 0
+	for {
+		seq, payload, err := r.ReadMsg()
+		if err == io.EOF {
+			return summarizeLatency(samples), bw.Flush()
+		}
+		if err != nil {
+			return latSummary{}, err
+		}
+		samples = append(samples, time.Since(r.At))
+		if stage < last {
+			if err := w.WriteMsg(seq, payload); err != nil {
+				return latSummary{}, err
+			}
+			// Pass on whatever arrived together, but never sit on a
+			// message while blocking for the next one
+			if br.Buffered() == 0 {
+				if err := bw.Flush(); err != nil {
+					return latSummary{}, err
+				}
+			}
+			continue
+		}
+		if !c.quiet && seq <= 5 {
+			fmt.Printf("Consumer: %d\n", seq)
+		}
+		got++
+		if got%c.window == 0 {
+			if err := ipc.WriteAck(ipc.Stamped, bw); err != nil {
+				return latSummary{}, err
+			}
+		}
+	}
+}
+
+// stageReport is the line each pipeline process writes on exit.
+func stageReport(stage int, s latSummary) string {
+	return fmt.Sprintf("stage %d %d %d %d %d %d\n", stage, s.N, s.P50, s.P95, s.P99, s.Max)
+}
+
+// parseStageReports fills stages[i-1] from the "stage i ..." lines in r.
+func parseStageReports(r io.Reader, stages []latSummary) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		var i int
+		var s latSummary
+		_, err := fmt.Sscanf(sc.Text(), "stage %d %d %d %d %d %d", &i, &s.N, &s.P50, &s.P95, &s.P99, &s.Max)
+		if err == nil && i >= 1 && i <= len(stages) {
+			stages[i-1] = s
+		}
+	}
+}
+
+// formatStages prints one hop-latency line per stage.
+func formatStages(stages []latSummary) string {
+	lines := make([]string, len(stages))
+	for i, s := range stages {
+		lines[i] = s.format(fmt.Sprintf("stage %d hop", i+1))
+	}
+	return strings.Join(lines, "\n  ")
+}
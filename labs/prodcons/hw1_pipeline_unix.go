@@ -0,0 +1,132 @@
+//go:build unix
+
+// Process pipeline (HW1 extension)
+// The producer starts one child per stage and links them with pipes:
+//
+//	producer -> stage 1 -> ... -> stage K --ACKs--> producer
+//
+// Every stage also gets a shared report pipe as fd 3, where it writes its
+// hop-latency summary on exit (one short line, so writes don't interleave).
+
+package prodcons
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"example.com/operating-systems/ipc"
+	"example.com/operating-systems/labs"
+)
+
+func runPipelineProc(ctx context.Context, c config) (result, error) {
+	k := max(c.stages, 1)
+	sc := c
+	sc.proto = ipc.Stamped
+
+	reportR, reportW, err := os.Pipe()
+	if err != nil {
+		return result{}, err
+	}
+	defer reportR.Close()
+
+	// in is the read end feeding the next stage; dataW is the producer's end
+	in, dataW, err := os.Pipe()
+	if err != nil {
+		reportW.Close()
+		return result{}, err
+	}
+
+	var cmds []*exec.Cmd
+	var exits []chan error
+	// kill tears down whatever was started when setup fails
+	kill := func() {
+		for i, cmd := range cmds {
+			_ = cmd.Process.Kill()
+			<-exits[i]
+		}
+	}
+	for s := 1; s <= k; s++ {
+		out, next, err := os.Pipe() // next is read by stage s+1, or by us (ACKs) after the last
+		if err != nil {
+			in.Close()
+			dataW.Close()
+			reportW.Close()
+			kill()
+			return result{}, err
+		}
+		cmd := labs.Command(append(c.childArgs("--stage="+strconv.Itoa(s), "--stages="+strconv.Itoa(k)), "--spawned")...)
+		cmd.Stdin = in
+		cmd.Stdout = next
+		cmd.Stderr = os.Stderr
+		cmd.ExtraFiles = []*os.File{reportW}
+		err = cmd.Start()
+		in.Close() // the child holds its own copies now
+		next.Close()
+		if err != nil {
+			out.Close()
+			dataW.Close()
+			reportW.Close()
+			kill()
+			return result{}, err
+		}
+		exited := make(chan error, 1)
+		go func() { exited <- cmd.Wait() }()
+		cmds = append(cmds, cmd)
+		exits = append(exits, exited)
+		in = out
+	}
+	reportW.Close() // so reportR sees EOF once every stage has exited
+	ackR := in
+	defer ackR.Close()
+
+	stages := make([]latSummary, k)
+	reported := make(chan struct{})
+	go func() {
+		parseStageReports(reportR, stages)
+		close(reported)
+	}()
+
+	start := time.Now()
+	res, err := produceStream(ctx, dataW, ackR, sc, func() { _ = dataW.Close() })
+	res.elapsed = time.Since(start)
+	_ = dataW.Close() // EOF ripples down the chain
+
+	// Stages exit in order as their input closes
+	for i, cmd := range cmds {
+		var werr error
+		if err != nil {
+			werr = stopChild(cmd, exits[i])
+		} else {
+			werr = <-exits[i]
+		}
+		if werr != nil && err == nil {
+			err = werr
+		}
+	}
+	<-reported
+	res.stages = stages
+	if err != nil {
+		return res, err
+	}
+	res.elapsed = time.Since(start)
+	return res, nil
+}
+
+// Child process entry for pipeline-proc: stage `stage` of `last` reads
+// stdin and writes stdout (messages, or ACKs from the last stage).
+func consumerStage(stage, last int, c config) error {
+	// stdout carries the stream, so per-item prints go to stderr
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	s, err := runStage(stage, last, os.Stdin, out, c)
+	if err != nil {
+		return err
+	}
+	report := os.NewFile(3, "report")
+	defer report.Close()
+	_, err = report.WriteString(stageReport(stage, s))
+	return err
+}
@@ -0,0 +1,916 @@
+// EECE 4811 - Operating Systems
+// HW0/HW1: One Producer / One Consumer
+// Himadri Saha, Ashwin Srinivasan, Yaritza Sanchez
+// - Process-based (parent/child with pipes passed as extra fds)
+// - Goroutine-based (single process, channels; errgroup variant)
+// - Bounded buffer (single process, mutex+condition variables or semaphores)
+// - Shared-memory (parent/child over an mmap-ed ring buffer)
+// - Socket-based (parent/child over a unix domain socket or loopback TCP)
+// - Named pipes (independent processes over two FIFOs)
+// - Pipelines (K chained stages, as goroutines or as processes)
+// - Restart (process mode with a crashing consumer that gets restarted)
+// - Relay / splice (a forwarding process in the middle; splice is zero-copy on Linux)
+// - Fan-in (one consumer selecting over several producer channels)
+// Includes a simple benchmark harness.
+//
+// Notes:
+// - For fair timing, use --quiet and large --n.
+// ---buf only affects the single-process modes (channel / bounded buffer capacity).
+// ---window N lets N messages go out per ACK (credit-style flow control);
+//   --sweep-window 1,8,64 benchmarks several window sizes in one run.
+// ---sweep-buf 0,1,16,256 does the same for --buf, and --out FILE saves
+//   every benchmark trial as a CSV row for plotting.
+// ---stages K sets the pipeline depth; --sweep-stages 1,2,4,8 benchmarks several.
+// ---rate R paces the producer at R msgs/sec (token bucket) and reports the
+//   consumer's queueing delay; --sweep-rate gives latency vs offered load.
+// ---msgsize N attaches an N-byte payload to every message; results then
+//   include MB/s alongside messages/sec.
+// ---rpc makes the consumer answer every message with a computed result that
+//   the producer verifies (request/response instead of bare ACKs).
+// ---trace FILE logs every message and ACK (through the HW8 logger), and
+//   --replay FILE checks such a trace for ordering and completeness.
+// ---proto picks the stream encoding (binary framing by default, or the
+//   original text lines, or gob).
+// - Every run prints CPU time, context switches, max RSS (self and child)
+//   and goroutine / GC counts alongside the timing.
+// - Ctrl-C stops the exchange cleanly: pipes and channels are closed, the
+//   child is given a moment to exit (then killed), and partial counts print.
+
+package prodcons
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"example.com/operating-systems/ipc"
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/results"
+	"example.com/operating-systems/stats"
+)
+
+var cmdline = labs.BenchFlagSet("prodcons")
+
+const roleFlag = "--role=consumer"
+
+// childGrace is how long a consumer gets to exit after an interrupted run
+// closes its input before it is killed.
+const childGrace = 2 * time.Second
+
+var (
+	mode    = cmdline.String("mode", "goroutine", "process | goroutine | cond | sem | shm | uds | tcp | fifo | pipeline | pipeline-proc | restart | relay | splice | fanin | errgroup")
+	n       = cmdline.Int("n", 5, "count of numbers to exchange")
+	trials  = cmdline.Int("trials", 3, "benchmark trials (when --bench)")
+	bufSz   = cmdline.Int("buf", 0, "channel / bounded buffer size (goroutine, cond, sem modes)")
+	window  = cmdline.Int("window", 1, "messages in flight before waiting for an ACK (1 = strict handshake)")
+	msgsize = cmdline.Int("msgsize", 0, "payload bytes carried by each message")
+	proto   = cmdline.String("proto", "binary", "stream encoding for process/uds/tcp/fifo: binary | text | gob")
+	quiet   = cmdline.Bool("quiet", false, "suppress per-item prints for timing")
+	bench   = cmdline.Bool("bench", false, "run benchmark comparing modes")
+	fifo    = cmdline.String("fifo", "", "directory for named pipes (fifo mode; empty = temp dir + spawned consumer)")
+	windows = cmdline.String("sweep-window", "", "comma-separated window sizes to benchmark, e.g. 1,8,64 (with --bench)")
+	bufs    = cmdline.String("sweep-buf", "", "comma-separated --buf sizes to benchmark, e.g. 0,1,16,256,4096 (with --bench)")
+	outCSV  = cmdline.String("out", "", "write one CSV row per benchmark trial to this file (with --bench)")
+	stages  = cmdline.Int("stages", 3, "stages after the producer in the pipeline modes (1 = plain producer/consumer)")
+	depths  = cmdline.String("sweep-stages", "", "comma-separated pipeline depths to benchmark, e.g. 1,2,4,8 (with --bench)")
+	crash   = cmdline.Int("crash-after", 1000, "restart mode: each consumer crashes after a random 1..N items")
+	nprod   = cmdline.Int("producers", 4, "fanin mode: producer goroutines feeding the one consumer")
+	rate    = cmdline.Float64("rate", 0, "offered load in msgs/sec, paced by a token bucket (0 = as fast as possible)")
+	rates   = cmdline.String("sweep-rate", "", "comma-separated --rate values to benchmark, e.g. 1000,10000,100000 (with --bench)")
+	rpc     = cmdline.Bool("rpc", false, "consumer replies to every message with a computed result, checked by the producer")
+	timeout = cmdline.Duration("fanin-timeout", 10*time.Millisecond, "fanin mode: consumer's select timeout")
+	shmWait = cmdline.String("shm-wait", "spin", "shm mode: how each side waits on the ring: spin | futex")
+	trace   = cmdline.String("trace", "", "log every message sent and ACK received, with timestamps, to this file")
+	replay  = cmdline.String("replay", "", "check a --trace file for ordering and completeness, then exit")
+)
+
+// benchModes lists the modes compared by --bench, in print order.
+var benchModes = []string{"process", "goroutine", "errgroup", "cond", "sem", "shm", "uds", "tcp", "fifo", "pipeline", "pipeline-proc", "relay", "splice", "fanin"}
+
+// bufModes are the modes --buf affects; a --sweep-buf only re-runs these.
+var bufModes = map[string]bool{"goroutine": true, "cond": true, "sem": true, "pipeline": true, "fanin": true, "errgroup": true}
+
+// stageModes are the modes --stages affects; a --sweep-stages only re-runs these.
+var stageModes = map[string]bool{"pipeline": true, "pipeline-proc": true}
+
+// config holds the exchange parameters shared by every mode.
+type config struct {
+	n       int     // count of numbers to exchange
+	buf     int     // channel / bounded buffer size (single-process modes)
+	window  int     // consumer ACKs once per window messages
+	msgsize int     // payload bytes per message
+	proto   string  // stream encoding (process, uds, tcp, fifo)
+	quiet   bool    // suppress per-item prints
+	fifo    string  // named-pipe directory (fifo mode)
+	stages  int     // pipeline depth after the producer (pipeline modes)
+	crash   int     // restart mode: consumer crashes after 1..crash items
+	rpc     bool    // reply with a computed result per message instead of ACKs
+	rate    float64 // offered load in msgs/sec (0 = unpaced)
+	trace   *tracer // --trace: producer-side event log (nil = off)
+	shmWait string  // shm mode: spin | futex
+
+	producers    int           // fanin mode: producer count
+	faninTimeout time.Duration // fanin mode: select timeout
+}
+
+// childArgs builds the consumer command line: role flag, mode-specific
+// extras, then the settings both sides must agree on.
+func (c config) childArgs(extra ...string) []string {
+	args := append([]string{roleFlag}, extra...)
+	args = append(args, "--window="+strconv.Itoa(c.window), "--msgsize="+strconv.Itoa(c.msgsize), "--proto="+c.proto)
+	if c.quiet {
+		args = append(args, "--quiet")
+	}
+	if c.rpc {
+		args = append(args, "--rpc")
+	}
+	if c.rate > 0 {
+		args = append(args, "--rate="+strconv.FormatFloat(c.rate, 'g', -1, 64))
+	}
+	return args
+}
+
+// spawnConsumer prepares a child consumer whose shutdown is owned by this
+// process (--spawned makes it ignore Ctrl-C and wait for end of input).
+func spawnConsumer(c config, extra ...string) *exec.Cmd {
+	cmd := labs.Command(append(c.childArgs(extra...), "--spawned")...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// stopChild waits for a consumer that has been told to finish, killing it
+// if it hasn't exited within childGrace.
+func stopChild(cmd *exec.Cmd, exited <-chan error) error {
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(childGrace):
+		_ = cmd.Process.Kill()
+		return <-exited
+	}
+}
+
+// interrupted reports whether ctx has been cancelled, without blocking.
+func interrupted(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+func Main(args []string) {
+	// Child process path (checked before labs.ParseBench, which doesn't know --role)
+	if len(args) > 0 && args[0] == roleFlag {
+		runChild(args[1:])
+		return
+	}
+
+	defer labs.ParseBench(cmdline, args)()
+
+	if *replay != "" {
+		if err := replayTrace(*replay); err != nil {
+			fmt.Fprintln(os.Stderr, "replay:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Ctrl-C cancels ctx; each mode winds down and reports what it got done
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *window < 1 {
+		*window = 1
+	}
+	if err := ipc.CheckProto(*proto); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	cfg := config{n: *n, buf: *bufSz, window: *window, msgsize: max(*msgsize, 0), proto: *proto, quiet: *quiet, fifo: *fifo, stages: max(*stages, 1), crash: *crash, rpc: *rpc, rate: max(*rate, 0), shmWait: *shmWait,
+		producers: max(*nprod, 1), faninTimeout: max(*timeout, time.Microsecond)}
+
+	// Top-level runner / benchmarker
+	if *bench {
+		if *trace != "" {
+			fmt.Fprintln(os.Stderr, "--trace records a single run; it can't be combined with --bench")
+			os.Exit(2)
+		}
+		sweepWin, err := parseInts(*windows)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bad --sweep-window:", err)
+			os.Exit(2)
+		}
+		sweepBuf, err := parseInts(*bufs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bad --sweep-buf:", err)
+			os.Exit(2)
+		}
+		sweepStages, err := parseInts(*depths)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bad --sweep-stages:", err)
+			os.Exit(2)
+		}
+		sweepRates, err := parseFloats(*rates)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bad --sweep-rate:", err)
+			os.Exit(2)
+		}
+		var out *csvSink
+		if *outCSV != "" {
+			if out, err = createCSV(*outCSV); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		runBenchmarks(ctx, cfg, *trials, sweep{sweepWin, sweepBuf, sweepStages, sweepRates}, out)
+		if err := out.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "writing --out:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *trace != "" {
+		t, err := createTrace(*trace)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg.trace = t
+		t.begin(*mode, cfg)
+	}
+	res, err := runMeasured(ctx, *mode, cfg)
+	cfg.trace.end(res.sent, err)
+	if terr := cfg.trace.Close(); terr != nil {
+		fmt.Fprintln(os.Stderr, "writing --trace:", terr)
+		os.Exit(1)
+	}
+	if errors.Is(err, context.Canceled) {
+		fmt.Printf("%s mode: interrupted after %d of %d messages, elapsed=%v  %s\n",
+			*mode, res.sent, cfg.n, res.elapsed, throughput(res.sent, cfg.msgsize, res.elapsed))
+		fmt.Printf("  %v\n", summarizeLatency(res.rtt))
+		printStages(res)
+		printRestarts(res)
+		printFanin(res)
+		printQdelay(res, cfg)
+		fmt.Printf("  %v\n", res.usage)
+		os.Exit(130)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s mode error: %v\n", *mode, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s mode: n=%d window=%d msgsize=%d elapsed=%v  %s\n",
+		*mode, cfg.n, cfg.window, cfg.msgsize, res.elapsed, throughput(cfg.n, cfg.msgsize, res.elapsed))
+	fmt.Printf("  %v\n", summarizeLatency(res.rtt))
+	printStages(res)
+	printRestarts(res)
+	printFanin(res)
+	printQdelay(res, cfg)
+	fmt.Printf("  %v\n", res.usage)
+}
+
+// printStages prints the per-stage hop latencies of a pipeline run.
+func printStages(res result) {
+	if len(res.stages) > 0 {
+		fmt.Printf("  %s\n", formatStages(res.stages))
+	}
+}
+
+// throughput formats messages/sec and, when messages carry a payload, MB/s.
+func throughput(msgs, msgsize int, d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	secs := d.Seconds()
+	out := fmt.Sprintf("msgs/sec=%.0f", float64(msgs)/secs)
+	if msgsize > 0 {
+		out += fmt.Sprintf("  MB/s=%.2f", float64(msgs)*float64(msgsize)/secs/1e6)
+	}
+	return out
+}
+
+// makePayload returns msgsize printable bytes (no newlines, so the line
+// protocol can carry it as-is).
+func makePayload(msgsize int) []byte {
+	p := make([]byte, msgsize)
+	for i := range p {
+		p[i] = 'a' + byte(i%26)
+	}
+	return p
+}
+
+// runMode runs one exchange in the named mode. If ctx is cancelled midway
+// it returns the partial result along with ctx.Err().
+func runMode(ctx context.Context, name string, c config) (result, error) {
+	if c.rpc && !rpcModes[name] {
+		return result{}, fmt.Errorf("--rpc is not supported by %s mode", name)
+	}
+	if c.trace != nil && !traceModes[name] {
+		return result{}, fmt.Errorf("--trace is not supported by %s mode", name)
+	}
+	if c.rate > 0 {
+		if !rateModes[name] {
+			return result{}, fmt.Errorf("--rate is not supported by %s mode", name)
+		}
+		if streamModes[name] {
+			c.proto = ipc.Stamped // the wire has to carry each message's due time
+		}
+	}
+	switch name {
+	case "process":
+		return runProcess(ctx, c)
+	case "goroutine":
+		return runGoroutine(ctx, c)
+	case "cond":
+		return runBounded(ctx, c, newCondBuffer)
+	case "sem":
+		return runBounded(ctx, c, newSemBuffer)
+	case "shm":
+		return runShm(ctx, c)
+	case "uds", "tcp":
+		return runSocket(ctx, name, c)
+	case "fifo":
+		return runFifo(ctx, c)
+	case "pipeline":
+		return runPipeline(ctx, c)
+	case "pipeline-proc":
+		return runPipelineProc(ctx, c)
+	case "restart":
+		return runRestart(ctx, c)
+	case "relay", "splice":
+		return runRelay(ctx, name, c)
+	case "fanin":
+		return runFanin(ctx, c)
+	case "errgroup":
+		return runErrgroup(ctx, c)
+	default:
+		return result{}, fmt.Errorf("unknown --mode %q (use process|goroutine|cond|sem|shm|uds|tcp|fifo|pipeline|pipeline-proc|restart|relay|splice|fanin|errgroup)", name)
+	}
+}
+
+// runChild parses the consumer-side flags and runs the matching consumer.
+func runChild(args []string) {
+	fs := flag.NewFlagSet("consumer", flag.ExitOnError)
+	childQuiet := fs.Bool("quiet", false, "suppress per-item prints")
+	childWindow := fs.Int("window", 1, "send one ACK per this many messages")
+	childMsgsize := fs.Int("msgsize", 0, "payload bytes carried by each message")
+	childProto := fs.String("proto", "binary", "stream encoding: binary | text | gob")
+	shmPath := fs.String("shm", "", "shared-memory ring file (shm mode)")
+	childShmWait := fs.String("shm-wait", "spin", "how to wait on the shared-memory ring: spin | futex")
+	sockNet := fs.String("net", "", "socket network to dial: unix | tcp (uds/tcp modes)")
+	sockAddr := fs.String("addr", "", "socket address to dial (uds/tcp modes)")
+	fifoDir := fs.String("fifo", "", "directory holding the named pipes (fifo mode)")
+	stage := fs.Int("stage", 0, "this process's position in the chain (pipeline-proc mode)")
+	lastStage := fs.Int("stages", 0, "number of stages in the chain (pipeline-proc mode)")
+	childCrash := fs.Int("crash", 0, "exit abruptly after a random 1..N items (restart mode)")
+	childRPC := fs.Bool("rpc", false, "reply to every message with a computed result")
+	childRate := fs.Float64("rate", 0, "record queueing delay and report it after the last ACK")
+	relayMethod := fs.String("relay", "", "forward stdin to stdout: relay | splice (relay modes)")
+	spawned := fs.Bool("spawned", false, "started by the producer, which owns shutdown")
+	_ = fs.Parse(args)
+
+	// Ctrl-C (or a group-wide SIGTERM) reaches every process; a spawned consumer leaves it to
+	// the producer, which closes our input and waits for us to drain.
+	if *spawned {
+		signal.Ignore(os.Interrupt, syscall.SIGTERM)
+	}
+
+	c := config{window: max(*childWindow, 1), msgsize: *childMsgsize, proto: *childProto, quiet: *childQuiet, fifo: *fifoDir, crash: *childCrash, rpc: *childRPC, rate: *childRate, shmWait: *childShmWait}
+	var err error
+	switch {
+	case *relayMethod != "":
+		err = consumerRelay(*relayMethod, c)
+	case *stage > 0:
+		err = consumerStage(*stage, *lastStage, c)
+	case *shmPath != "":
+		err = consumerShm(*shmPath, c)
+	case *sockNet != "":
+		err = consumerSocket(*sockNet, *sockAddr, c)
+	case *fifoDir != "":
+		err = consumerFifo(c)
+	default:
+		err = consumerProcess(c)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "consumer error:", err)
+		os.Exit(1)
+	}
+}
+
+// parseFloats parses a comma-separated list like "1000,1e4"; empty means none.
+func parseFloats(list string) ([]float64, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var out []float64
+	for _, f := range strings.Split(list, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// parseInts parses a comma-separated list like "1,8,64"; empty means none.
+func parseInts(list string) ([]int, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var out []int
+	for _, f := range strings.Split(list, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// Goroutine mode (HW1)
+
+// message is one item exchanged in the single-process modes.
+type message struct {
+	seq     int
+	payload []byte
+	due     time.Time // --rate: when the token bucket released it
+}
+
+func runGoroutine(ctx context.Context, c config) (result, error) {
+	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	data := make(chan message, c.buf)
+	ack := make(chan struct{})
+	replies := make(chan uint64, c.window) // --rpc: one result per message
+	payload := makePayload(c.msgsize)
+	sum := payloadSum(payload)
+	qdelay := make(chan latSummary, 1) // --rate: consumer's summary once it drains
+
+	start := time.Now()
+
+	// Consumer goroutine
+	go func() {
+		got := 0
+		buf := make([]byte, c.msgsize)
+		var waits []time.Duration
+		for m := range data {
+			if c.rate > 0 {
+				waits = append(waits, time.Since(m.due))
+			}
+			copy(buf, m.payload) // take a private copy, as a pipe read would
+			if !c.quiet && m.seq <= 5 {
+				fmt.Printf("Consumer: %d\n", m.seq)
+			}
+			got++
+			if c.rpc {
+				replies <- rpcReply(m.seq, payloadSum(buf))
+			} else if got%c.window == 0 {
+				ack <- struct{}{} // simple sync (like your ACK line), once per window
+			}
+		}
+		close(replies)
+		qdelay <- summarizeLatency(waits)
+	}()
+
+	// Producer (main goroutine)
+	clock := newRTTClock(c)
+	bucket := pacer(c)
+	done := ctx.Done()
+	sent := 0
+	for i := 1; i <= c.n && !interrupted(done); i++ {
+		if !c.quiet && i <= 5 {
+			fmt.Printf("Producer: %d\n", i)
+		}
+		m := message{seq: i, payload: payload}
+		if bucket != nil {
+			m.due = bucket.wait()
+		}
+		clock.send(i, c)
+		data <- m
+		c.trace.send(i)
+		sent = i
+		switch {
+		case c.rpc && (i%c.window == 0 || i == c.n):
+			// Check this window's results (the last one may be partial)
+			if err := awaitReplies(replies, i-(i-1)%c.window, i, sum); err != nil {
+				close(data)
+				return result{}, err
+			}
+		case !c.rpc && i%c.window == 0:
+			<-ack
+		default:
+			continue
+		}
+		if i%c.window == 0 {
+			clock.acked()
+			c.trace.ack(i)
+		}
+	}
+	close(data)
+
+	res := result{elapsed: time.Since(start), rtt: clock.samples, sent: sent}
+	if c.rate > 0 {
+		res.qdelay = <-qdelay
+	}
+	return res, ctx.Err()
+}
+
+// Process mode (HW0, refined)
+// Parent = producer, Child = consumer via exec + pipes
+
+func runProcess(ctx context.Context, c config) (result, error) {
+	cmd := spawnConsumer(c)
+
+	// Dedicated pipes: parent writes messages on one, reads ACKs from the other
+	consumerData, consumerAck, release, err := ipc.AttachStreams(cmd)
+	if err != nil {
+		return result{}, err
+	}
+	defer consumerAck.Close()
+
+	err = cmd.Start()
+	release()
+	if err != nil {
+		consumerData.Close()
+		return result{}, err
+	}
+
+	start := time.Now()
+	res, err := produceStream(ctx, consumerData, consumerAck, c, func() { _ = consumerData.Close() })
+	res.elapsed = time.Since(start)
+	_ = consumerData.Close()
+
+	// All ACK reads are done, so it's safe to Wait now
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	if err != nil {
+		_ = stopChild(cmd, exited)
+		return res, err
+	}
+	if err := <-exited; err != nil {
+		return res, err
+	}
+	res.elapsed = time.Since(start)
+	return res, nil
+}
+
+// produceStream is the producer half of the protocol shared by the pipe,
+// socket, and fifo modes: write messages in the --proto encoding, and after
+// every window of them wait for an ACK. Any trailing partial window is
+// confirmed by the consumer exiting cleanly instead. Returns the per-window
+// RTT samples and how many messages went out.
+//
+// If ctx is cancelled the loop stops and abort is called to close the data
+// side, which also unblocks a pending ACK read once the consumer exits.
+// With --rpc, abort also ends the stream before a short last window's
+// replies are read.
+func produceStream(ctx context.Context, w io.Writer, ack io.Reader, c config, abort func()) (result, error) {
+	return produceRange(ctx, w, ack, c, 1, abort)
+}
+
+// produceRange is produceStream starting at message from (restart mode
+// resumes there); from-1 must be a multiple of the window so ACKs stay aligned.
+func produceRange(ctx context.Context, w io.Writer, ack io.Reader, c config, from int, abort func()) (result, error) {
+	ackReader := bufio.NewReader(ack)
+	writer := ipc.NewWriter(c.proto, w)
+	payload := makePayload(c.msgsize)
+	sum := payloadSum(payload) // every message carries the same payload
+	clock := newRTTClock(c)
+	bucket := pacer(c)
+	stampW, _ := writer.(ipc.StampedWriter) // set when --rate switched the wire to stamped
+	stop := context.AfterFunc(ctx, abort)
+	defer stop()
+
+	// fail reports a cancelled run as such rather than as the I/O error abort caused
+	var res result
+	fail := func(err error) (result, error) {
+		res.rtt = clock.samples
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+		return res, err
+	}
+
+	done := ctx.Done()
+	replied := from - 1 // --rpc: last message whose reply has been checked
+	for i := from; i <= c.n; i++ {
+		if interrupted(done) {
+			return fail(ctx.Err())
+		}
+		if !c.quiet && i <= 5 {
+			fmt.Printf("Producer: %d\n", i)
+		}
+		var err error
+		if bucket != nil && stampW.Writer != nil {
+			due := bucket.wait()
+			clock.send(i, c)
+			err = stampW.WriteAt(i, due, payload)
+		} else {
+			clock.send(i, c)
+			err = writer.WriteMsg(i, payload)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		c.trace.send(i)
+		if i%c.window != 0 && i != c.n {
+			continue // keep batching until the window is full
+		}
+		// Flush promptly so child sees it
+		if err := writer.Flush(); err != nil {
+			return fail(err)
+		}
+		res.sent = i
+
+		// --rpc: one reply per message, checked in order
+		if c.rpc {
+			if i%c.window != 0 {
+				abort() // short last window: EOF tells the consumer to flush its replies
+			}
+			for ; replied < i; replied++ {
+				v, err := readReply(c.proto, ackReader)
+				if err != nil {
+					return fail(err)
+				}
+				if err := checkReply(replied+1, sum, v); err != nil {
+					return fail(err)
+				}
+			}
+			if i%c.window == 0 {
+				clock.acked()
+				c.trace.ack(i)
+			}
+			continue
+		}
+
+		// Wait for the ACK
+		if i%c.window == 0 {
+			if err := ipc.ReadAck(c.proto, ackReader); err != nil {
+				return fail(err)
+			}
+			clock.acked()
+			c.trace.ack(i)
+		}
+	}
+	res.rtt = clock.samples
+
+	// --rate: end the stream; the consumer answers with its queueing delay
+	if bucket != nil {
+		abort()
+		s, err := readQdelayTrailer(ackReader)
+		if err != nil {
+			return fail(err)
+		}
+		res.qdelay = s
+	}
+	return res, nil
+}
+
+// Child process entry: reads messages and emits ACKs on the pipes the
+// parent passed in (see attachStreams).
+func consumerProcess(c config) error {
+	data, ack := ipc.ChildStreams()
+	return consumeStream(data, ack, c)
+}
+
+// consumeStream is the consumer half of the stream protocol.
+func consumeStream(r io.Reader, ack io.Writer, c config) error {
+	in := ipc.NewReader(c.proto, r, c.msgsize)
+	outAck := bufio.NewWriterSize(ack, 64*1024)
+	buf := make([]byte, c.msgsize)
+	crashAt := 0 // restart mode: die abruptly after this many items
+	if c.crash > 0 {
+		crashAt = rand.IntN(c.crash) + 1
+	}
+
+	stampR, _ := in.(*ipc.StampedReader) // set when --rate switched the wire to stamped
+	var waits []time.Duration
+
+	got := 0
+	for {
+		n, payload, err := in.ReadMsg()
+		if err == io.EOF {
+			if stampR != nil && c.rate > 0 {
+				if _, err := outAck.WriteString(qdelayTrailer(summarizeLatency(waits))); err != nil {
+					return err
+				}
+			}
+			return outAck.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		if stampR != nil && c.rate > 0 {
+			waits = append(waits, time.Since(stampR.At))
+		}
+		copy(buf, payload)
+		if !c.quiet && n <= 5 {
+			fmt.Printf("Consumer: %d\n", n)
+		}
+		got++
+		if got == crashAt {
+			os.Exit(crashExit) // no flush, no goodbye: the producer sees a broken pipe
+		}
+		if c.rpc {
+			if err := writeReply(c.proto, outAck, rpcReply(n, payloadSum(buf))); err != nil {
+				return err
+			}
+		}
+		if got%c.window != 0 {
+			continue
+		}
+		if c.rpc {
+			if err := outAck.Flush(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := ipc.WriteAck(c.proto, outAck); err != nil {
+			return err
+		}
+	}
+}
+
+// Benchmark harness
+
+type stat struct {
+	trials  stats.Summary[time.Duration] // of the successful trials' times
+	all     []time.Duration
+	rtt     latSummary // pooled over all successful trials
+	partial *result    // set if a trial was interrupted
+}
+
+// sweep holds the parameter lists a benchmark run iterates over; an empty
+// list means just the configured value.
+type sweep struct {
+	windows, bufs, stages []int
+	rates                 []float64
+}
+
+// sweepPoint is one combination of swept values. The first* fields mark
+// values that are the first in their list: modes a parameter doesn't
+// affect only run there, not once per value.
+type sweepPoint struct {
+	c                               config
+	firstBuf, firstStage, firstRate bool
+}
+
+// points expands the sweep into configurations, windows outermost.
+func (sw sweep) points(c config) []sweepPoint {
+	or := func(l []int, v int) []int {
+		if len(l) == 0 {
+			return []int{v}
+		}
+		return l
+	}
+	rates := sw.rates
+	if len(rates) == 0 {
+		rates = []float64{c.rate}
+	}
+	var pts []sweepPoint
+	for _, w := range or(sw.windows, c.window) {
+		for bi, b := range or(sw.bufs, c.buf) {
+			for si, k := range or(sw.stages, c.stages) {
+				for ri, r := range rates {
+					p := c
+					p.window, p.buf, p.stages, p.rate = max(w, 1), max(b, 0), max(k, 1), max(r, 0)
+					pts = append(pts, sweepPoint{p, bi == 0, si == 0, ri == 0})
+				}
+			}
+		}
+	}
+	return pts
+}
+
+// runs reports whether mode m belongs in the benchmark at this point.
+func (p sweepPoint) runs(m string) bool {
+	return (p.firstBuf || bufModes[m]) &&
+		(p.firstStage || stageModes[m]) &&
+		(p.firstRate || rateModes[m]) &&
+		(!p.c.rpc || rpcModes[m]) &&
+		(p.c.rate == 0 || rateModes[m])
+}
+
+func runBenchmarks(ctx context.Context, c config, Trials int, sw sweep, out *csvSink) {
+	fmt.Printf("Benchmarking with n=%d, trials=%d, quiet=%v\n", c.n, Trials, c.quiet)
+	fmt.Println("Tip: run with --quiet for fair timing (I/O is expensive).")
+
+	c.fifo = "" // benchmark always spawns its own fifo consumer
+	var metrics []results.Metric
+	for _, p := range sw.points(c) {
+		c := p.c
+		var modes []string
+		for _, m := range benchModes {
+			if p.runs(m) {
+				modes = append(modes, m)
+			}
+		}
+
+		measured := make([]stat, 0, len(modes))
+		for _, m := range modes {
+			measured = append(measured, doTrials(m, c, Trials, out, func() (result, error) { return runMeasured(ctx, m, c) }))
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		fmt.Printf("\nResults window=%d buf=%d stages=%d rate=%g msgsize=%d (lower is better):\n", c.window, c.buf, c.stages, c.rate, c.msgsize)
+		for i, s := range measured {
+			printStat(fmt.Sprintf("%-13s", modes[i]), s, c)
+			if s.trials.N > 0 {
+				name := fmt.Sprintf("%s[window=%d,buf=%d,stages=%d,rate=%g,msgsize=%d]", modes[i], c.window, c.buf, c.stages, c.rate, c.msgsize)
+				metrics = append(metrics, results.Duration(name+".avg", s.trials.Mean),
+					results.Duration(name+".rtt_p50", s.rtt.P50), results.Duration(name+".rtt_p99", s.rtt.P99))
+			}
+		}
+		if ctx.Err() != nil {
+			fmt.Println("(interrupted; remaining modes and sweeps skipped)")
+			return
+		}
+	}
+	if err := labs.Record(cmdline, metrics...); err != nil {
+		fmt.Fprintln(os.Stderr, "record:", err)
+	}
+}
+
+// doTrials runs fn Trials times, printing each trial's resource usage and
+// recording it to out (if any).
+func doTrials(label string, c config, Trials int, out *csvSink, fn func() (result, error)) stat {
+	durs := make([]time.Duration, 0, Trials)
+	var rtts []time.Duration
+
+	record := func(t int, status string, res result) {
+		if err := out.writeTrial(label, c, t+1, status, res); err != nil {
+			fmt.Fprintf(os.Stderr, "%s trial %d: writing --out: %v\n", label, t+1, err)
+		}
+	}
+
+	var partial *result
+	for t := 0; t < Trials; t++ {
+		// light GC to reduce noise between trials
+		runtime.GC()
+		time.Sleep(20 * time.Millisecond)
+
+		res, err := fn()
+		if errors.Is(err, context.Canceled) {
+			record(t, "interrupted", res)
+			rtts = append(rtts, res.rtt...)
+			partial = &res
+			break
+		}
+		if err != nil {
+			record(t, "error", res)
+			fmt.Fprintf(os.Stderr, "%s trial %d error: %v\n", label, t+1, err)
+			continue
+		}
+		record(t, "ok", res)
+		// Resource usage explains the timing, so show it per trial
+		fmt.Printf("%s trial %d: %v\n", label, t+1, res.elapsed)
+		printStages(res)
+		printFanin(res)
+		printQdelay(res, c)
+		fmt.Printf("  %v\n", res.usage)
+		durs = append(durs, res.elapsed)
+		rtts = append(rtts, res.rtt...)
+	}
+
+	return stat{
+		trials:  stats.Summarize(durs),
+		all:     durs,
+		rtt:     summarizeLatency(rtts),
+		partial: partial,
+	}
+}
+
+func printStat(name string, s stat, c config) {
+	pad := strings.Repeat(" ", len(name))
+	if len(s.all) == 0 {
+		fmt.Printf("%s: no successful trials\n", name)
+	} else {
+		t := s.trials
+		fmt.Printf("%s  avg=%v ±%v  best=%v  std=%v  %s  samples=%v\n", name, t.Mean, t.CI95(), t.Min, t.Stddev, throughput(c.n, c.msgsize, t.Mean), s.all)
+		name = pad
+	}
+	if s.partial != nil {
+		fmt.Printf("%s  interrupted trial: %d of %d messages in %v\n", name, s.partial.sent, c.n, s.partial.elapsed)
+	}
+	fmt.Printf("%s  %v\n", pad, s.rtt)
+}
@@ -0,0 +1,107 @@
+// Rate-limited producer (HW1 extension)
+// --rate R paces the producer with a token bucket, so the harness can offer
+// a fixed load instead of always running flat out. Every message is stamped
+// with the moment its token became available (when it was due to be sent),
+// and the consumer records the queueing delay from then until it takes the
+// message. Below saturation that delay stays near the transfer latency; as R
+// approaches the mechanism's capacity, messages back up and it climbs, which
+// is the latency-vs-offered-load curve --sweep-rate traces out.
+//
+// Stream modes carry the due time in the "stamped" framing (see
+// hw1_pipeline.go); the consumer sends its queueing-delay summary back as a
+// trailer line after the last ACK.
+
+package prodcons
+
+import (
+	"bufio"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// rateModes are the modes that implement --rate.
+var rateModes = map[string]bool{
+	"process": true, "goroutine": true, "uds": true, "tcp": true, "fifo": true,
+	"relay": true, "splice": true,
+}
+
+// streamModes are the rate modes built on produceStream / consumeStream.
+var streamModes = map[string]bool{
+	"process": true, "uds": true, "tcp": true, "fifo": true,
+	"relay": true, "splice": true,
+}
+
+// bucketDepth is how much sending the bucket lets build up while the
+// producer is blocked; it absorbs sleep overshoot without allowing big bursts.
+const bucketDepth = time.Millisecond
+
+// spinWindow is how close to a due time the producer stops sleeping and
+// spins. Timer wakeups are about a millisecond late here, so above ~500
+// msgs/sec the paced producer keeps one CPU busy.
+const spinWindow = 2 * time.Millisecond
+
+// tokenBucket releases rate tokens per second, holding at most bucketDepth's worth.
+type tokenBucket struct {
+	interval time.Duration // time to earn one token
+	next     time.Time     // when the next token is due
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait blocks until a token is available and returns when it was due.
+func (b *tokenBucket) wait() time.Time {
+	now := time.Now()
+	if b.next.IsZero() {
+		b.next = now
+	}
+	// Tokens don't pile up beyond the bucket depth
+	if floor := now.Add(-bucketDepth); b.next.Before(floor) {
+		b.next = floor
+	}
+	due := b.next
+	// Sleep for the bulk of a long wait, then spin: time.Sleep can overshoot
+	// by far more than the gap between messages at high rates
+	if d := due.Sub(now); d > spinWindow {
+		time.Sleep(d - spinWindow)
+	}
+	for time.Now().Before(due) {
+		runtime.Gosched()
+	}
+	b.next = due.Add(b.interval)
+	return due
+}
+
+// pacer returns the producer's token bucket, or nil when --rate is off.
+func pacer(c config) *tokenBucket {
+	if c.rate <= 0 {
+		return nil
+	}
+	return newTokenBucket(c.rate)
+}
+
+// qdelayTrailer is the line a stream consumer sends after its last ACK.
+func qdelayTrailer(s latSummary) string {
+	return fmt.Sprintf("qdelay %d %d %d %d %d\n", s.N, s.P50, s.P95, s.P99, s.Max)
+}
+
+// readQdelayTrailer reads the consumer's trailer off the ACK stream.
+func readQdelayTrailer(r *bufio.Reader) (latSummary, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return latSummary{}, fmt.Errorf("reading queueing-delay trailer: %w", err)
+	}
+	var s latSummary
+	_, err = fmt.Sscanf(strings.TrimSpace(line), "qdelay %d %d %d %d %d", &s.N, &s.P50, &s.P95, &s.P99, &s.Max)
+	return s, err
+}
+
+// printQdelay prints the consumer-side queueing delay of a --rate run.
+func printQdelay(res result, c config) {
+	if c.rate > 0 {
+		fmt.Printf("  offered=%.0f msgs/sec  %v\n", c.rate, res.qdelay.format("queueing delay"))
+	}
+}
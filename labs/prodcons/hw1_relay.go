@@ -0,0 +1,133 @@
+// Relay modes (HW1 extension)
+// Process mode with a relay process between producer and consumer:
+//
+//	producer -> pipe -> relay -> pipe -> consumer --ACKs--> producer
+//
+// The relay only forwards bytes, it never parses messages, so the two modes
+// differ in nothing but how the bytes cross it:
+//
+//	relay  - read(2) into a user-space buffer, then write(2) it out
+//	splice - splice(2) straight from one pipe to the other (Linux), so the
+//	         payload never enters the relay's memory; elsewhere, or if the
+//	         kernel refuses, it falls back to the read/write loop
+//
+// The difference shows with large --msgsize.
+
+package prodcons
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"example.com/operating-systems/ipc"
+	"example.com/operating-systems/labs"
+)
+
+// relayBufSize is the read/write relay's buffer, and the most one splice call moves.
+const relayBufSize = 1 << 20
+
+// errNoSplice means splice isn't available and the relay should copy instead.
+var errNoSplice = errors.New("splice not supported")
+
+func runRelay(ctx context.Context, method string, c config) (result, error) {
+	inR, inW, err := os.Pipe() // producer -> relay
+	if err != nil {
+		return result{}, err
+	}
+	outR, outW, err := os.Pipe() // relay -> consumer
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return result{}, err
+	}
+
+	relay := labs.Command(append(c.childArgs("--relay="+method), "--spawned")...)
+	relay.Stdin = inR
+	relay.Stdout = outW
+	relay.Stderr = os.Stderr
+	err = relay.Start()
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		return result{}, err
+	}
+	relayExited := make(chan error, 1)
+	go func() { relayExited <- relay.Wait() }()
+
+	consumer := spawnConsumer(c)
+	ack, release, err := ipc.AttachAck(consumer, outR)
+	if err != nil {
+		outR.Close()
+	} else {
+		defer ack.Close()
+		err = consumer.Start()
+		release()
+	}
+	if err != nil {
+		inW.Close()
+		_ = stopChild(relay, relayExited)
+		return result{}, err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- consumer.Wait() }()
+
+	start := time.Now()
+	res, err := produceStream(ctx, inW, ack, c, func() { _ = inW.Close() })
+	res.elapsed = time.Since(start)
+	_ = inW.Close() // EOF reaches the relay, which then closes the consumer's input
+
+	if err != nil {
+		_ = stopChild(relay, relayExited)
+		_ = stopChild(consumer, exited)
+		return res, err
+	}
+	if err := <-relayExited; err != nil {
+		_ = stopChild(consumer, exited)
+		return res, fmt.Errorf("relay: %w", err)
+	}
+	if err := <-exited; err != nil {
+		return res, err
+	}
+	res.elapsed = time.Since(start)
+	return res, nil
+}
+
+// Child process entry for the relay: forward stdin to stdout until EOF.
+func consumerRelay(method string, c config) error {
+	if method == "splice" {
+		err := spliceRelay(os.Stdin, os.Stdout)
+		if !errors.Is(err, errNoSplice) {
+			return err
+		}
+		if !c.quiet {
+			fmt.Fprintln(os.Stderr, "relay: splice unavailable, falling back to read/write")
+		}
+	}
+	return copyRelay(os.Stdin, os.Stdout)
+}
+
+// copyRelay is the plain user-space path. It loops by hand because io.Copy
+// between *os.Files may itself pick a zero-copy syscall.
+func copyRelay(in io.Reader, out io.Writer) error {
+	buf := make([]byte, relayBufSize)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			if _, werr := out.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Restart mode (HW1 extension)
+// Process mode with failure injection: every consumer is started with
+// --crash N and exits abruptly after a random 1..N items. The producer sees
+// the broken pipe (or the ACK stream ending), reaps the child, starts a new
+// one, and resends everything after the last ACKed message. Delivery is
+// therefore at-least-once: items past the last ACK may be seen twice.
+//
+// Recovery time runs from detecting the failure to the first ACK from the
+// replacement consumer.
+
+package prodcons
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"example.com/operating-systems/ipc"
+)
+
+// crashExit is the exit status of a consumer that crashed on purpose.
+const crashExit = 3
+
+// maxRestarts stops a run that keeps failing without making progress.
+const maxRestarts = 10000
+
+func runRestart(ctx context.Context, c config) (result, error) {
+	if c.crash > 0 && c.crash < c.window {
+		// a consumer would always die before its first ACK
+		return result{}, fmt.Errorf("--crash-after %d must be at least --window %d", c.crash, c.window)
+	}
+
+	var res result
+	acked := 0 // last message covered by an ACK; a new consumer resumes after it
+	var failedAt time.Time
+	start := time.Now()
+	for {
+		sess, firstAck, err := restartSession(ctx, c, acked+1)
+		res.rtt = append(res.rtt, sess.rtt...)
+		res.sent = max(res.sent, sess.sent)
+		acked += len(sess.rtt) * c.window
+		if !failedAt.IsZero() && !firstAck.IsZero() {
+			res.recovery = append(res.recovery, firstAck.Sub(failedAt))
+			failedAt = time.Time{}
+		}
+		res.elapsed = time.Since(start)
+		if err == nil || ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+
+		// Broken pipe, lost ACK stream, or a crashed exit: start over after the last ACK
+		if failedAt.IsZero() {
+			failedAt = time.Now()
+		}
+		res.crashes++
+		if res.crashes > maxRestarts {
+			return res, fmt.Errorf("giving up after %d restarts: %w", maxRestarts, err)
+		}
+		if !c.quiet {
+			fmt.Printf("Producer: consumer failed (%v); restarting from %d\n", err, acked+1)
+		}
+		c.trace.restart(acked + 1)
+	}
+}
+
+// restartSession runs one consumer from message `from` on, returning when
+// it has everything or fails. firstAck is when its first ACK arrived (zero
+// if none did).
+func restartSession(ctx context.Context, c config, from int) (result, time.Time, error) {
+	cmd := spawnConsumer(c, "--crash="+strconv.Itoa(c.crash))
+	consumerData, consumerAck, release, err := ipc.AttachStreams(cmd)
+	if err != nil {
+		return result{}, time.Time{}, err
+	}
+	defer consumerAck.Close()
+	err = cmd.Start()
+	release()
+	if err != nil {
+		consumerData.Close()
+		return result{}, time.Time{}, err
+	}
+
+	ack := &firstRead{r: consumerAck}
+	res, err := produceRange(ctx, consumerData, ack, c, from, func() { _ = consumerData.Close() })
+	_ = consumerData.Close()
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	if err != nil {
+		// The child is usually dead already (its exit status says more than
+		// the broken pipe); stopChild covers one that isn't
+		if werr := stopChild(cmd, exited); werr != nil && ctx.Err() == nil {
+			err = werr
+		}
+		return res, ack.at, err
+	}
+	// A crash inside the trailing partial window only shows in the exit status
+	if err := <-exited; err != nil {
+		return res, ack.at, err
+	}
+	if res.sent < c.n {
+		return res, ack.at, errors.New("consumer stopped early")
+	}
+	return res, ack.at, nil
+}
+
+// firstRead wraps the ACK stream and notes when data first arrives on it.
+type firstRead struct {
+	r  io.Reader
+	at time.Time
+}
+
+func (f *firstRead) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if n > 0 && f.at.IsZero() {
+		f.at = time.Now()
+	}
+	return n, err
+}
+
+// printRestarts prints the restart count and recovery times of a restart run.
+func printRestarts(res result) {
+	if res.crashes > 0 {
+		fmt.Printf("  restarts=%d  %v\n", res.crashes, summarizeLatency(res.recovery).format("recovery"))
+	}
+}
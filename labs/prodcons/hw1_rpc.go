@@ -0,0 +1,87 @@
+// Duplex / RPC exchange (HW1 extension)
+// With --rpc the consumer answers every message with a computed result
+// instead of one bare ACK per window: a request/response exchange, as an
+// RPC over pipes or sockets would do. The consumer hashes the payload it
+// received and mixes in the sequence number; the producer knows what it
+// sent, so it checks every reply and fails the run on the first mismatch.
+// Replies still travel in batches of --window, so the window keeps its
+// meaning (requests in flight before the producer waits).
+//
+// Reply encoding follows --proto: a decimal line for text, otherwise eight
+// little-endian bytes.
+
+package prodcons
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// rpcModes are the modes that implement --rpc.
+var rpcModes = map[string]bool{
+	"process": true, "goroutine": true, "uds": true, "tcp": true, "fifo": true,
+	"restart": true, "relay": true, "splice": true,
+}
+
+// payloadSum is the consumer's "work": an FNV-1a hash of the payload.
+func payloadSum(p []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(p)
+	return h.Sum64()
+}
+
+// rpcReply is the result for message seq whose payload hashed to sum.
+func rpcReply(seq int, sum uint64) uint64 {
+	return sum ^ uint64(seq)*0x9E3779B97F4A7C15
+}
+
+// checkReply compares a reply against what the producer expects.
+func checkReply(seq int, sum, got uint64) error {
+	if want := rpcReply(seq, sum); got != want {
+		return fmt.Errorf("reply to message %d: got %#x, want %#x", seq, got, want)
+	}
+	return nil
+}
+
+// writeReply buffers one reply; the caller flushes at the end of a window.
+func writeReply(proto string, w *bufio.Writer, v uint64) error {
+	if proto == "text" {
+		_, err := w.WriteString(strconv.FormatUint(v, 10) + "\n")
+		return err
+	}
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	_, err := w.Write(b[:])
+	return err
+}
+
+// readReply waits for one reply.
+func readReply(proto string, r *bufio.Reader) (uint64, error) {
+	if proto == "text" {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(strings.TrimSuffix(line, "\n"), 10, 64)
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
+
+// awaitReplies checks the goroutine-mode replies for messages from..to.
+func awaitReplies(replies <-chan uint64, from, to int, sum uint64) error {
+	for seq := from; seq <= to; seq++ {
+		if err := checkReply(seq, sum, <-replies); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+//go:build unix
+
+// Shared-memory mode (HW1 extension)
+// Parent = producer, Child = consumer; both map the same file and talk
+// through a single-producer/single-consumer shmring ring buffer.
+//
+// Layout of the mapped file:
+//
+//	0   acked - number of items the consumer has ACKed (written by consumer)
+//	64  ring  - a shmring of nslots slots of [int64 seq][msgsize payload bytes]
+
+package prodcons
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"example.com/operating-systems/shmring"
+)
+
+const (
+	shmMaxSlots = 1024
+	shmMaxData  = 16 << 20 // cap the slot area so big payloads don't map gigabytes
+	shmAckOff   = 0
+	shmRingOff  = 64
+)
+
+// shmConfig returns the ring geometry for a payload size; both processes
+// derive it from --msgsize so nothing else has to be exchanged.
+func shmConfig(msgsize int, wait shmring.Wait) shmring.Config {
+	slotSize := 8 + msgsize
+	return shmring.Config{Slots: min(shmMaxSlots, max(2, shmMaxData/slotSize)), SlotSize: slotSize, Mode: shmring.SPSC, Wait: wait}
+}
+
+// shmRing is a view over the mapped region: the ACK counter, accessed
+// atomically since the other side lives in a different process, and the
+// ring itself.
+type shmRing struct {
+	mem   []byte
+	acked *uint64
+	ring  *shmring.Ring
+	buf   []byte // one message: seq then payload
+}
+
+func shmSize(msgsize int) int {
+	return shmRingOff + shmring.Size(shmConfig(msgsize, shmring.Spin))
+}
+
+// mapShmRing maps f; the producer (create) formats the ring, the
+// consumer attaches to it.
+func mapShmRing(f *os.File, msgsize int, wait shmring.Wait, create bool) (*shmRing, error) {
+	mem, err := syscall.Mmap(int(f.Fd()), 0, shmSize(msgsize), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	var ring *shmring.Ring
+	if create {
+		ring, err = shmring.Init(mem[shmRingOff:], shmConfig(msgsize, wait))
+	} else {
+		ring, err = shmring.Attach(mem[shmRingOff:], wait)
+	}
+	if err != nil {
+		syscall.Munmap(mem)
+		return nil, err
+	}
+	return &shmRing{
+		mem:   mem,
+		acked: (*uint64)(unsafe.Add(unsafe.Pointer(&mem[0]), shmAckOff)),
+		ring:  ring,
+		buf:   make([]byte, 8+msgsize),
+	}, nil
+}
+
+func (r *shmRing) unmap() error { return syscall.Munmap(r.mem) }
+
+// backoff spins briefly, then yields the OS thread (same idea as the HW4
+// consumers). The peer is another process, so runtime.Gosched alone never
+// lets it run on a busy CPU.
+func backoff(spin *int) {
+	*spin++
+	if *spin < 50 {
+		runtime.Gosched()
+		return
+	}
+	osYield()
+}
+
+// push blocks until there is room in the ring, then copies seq and payload
+// into the next slot and publishes it.
+func (r *shmRing) push(seq int64, payload []byte) error {
+	binary.LittleEndian.PutUint64(r.buf, uint64(seq))
+	copy(r.buf[8:], payload)
+	return r.ring.Push(r.buf)
+}
+
+// pop blocks until an item is available and copies its payload into dst;
+// ok=false once the producer closed the ring and everything has been drained.
+func (r *shmRing) pop(dst []byte) (seq int64, ok bool, err error) {
+	if _, err := r.ring.Pop(r.buf); err != nil {
+		if err == io.EOF {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	copy(dst, r.buf[8:])
+	return int64(binary.LittleEndian.Uint64(r.buf)), true, nil
+}
+
+// waitAck blocks until the consumer has ACKed at least n items, or the
+// consumer process exits (reported on exited).
+func (r *shmRing) waitAck(n uint64, exited <-chan error) error {
+	spin := 0
+	for atomic.LoadUint64(r.acked) < n {
+		select {
+		case err := <-exited:
+			if err == nil {
+				err = errors.New("consumer exited before ACK")
+			}
+			return err
+		default:
+		}
+		backoff(&spin)
+	}
+	return nil
+}
+
+func runShm(ctx context.Context, c config) (result, error) {
+	f, err := os.CreateTemp("", "hw1-shm-*")
+	if err != nil {
+		return result{}, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := f.Truncate(int64(shmSize(c.msgsize))); err != nil {
+		return result{}, err
+	}
+	wait, err := shmring.ParseWait(c.shmWait)
+	if err != nil {
+		return result{}, err
+	}
+	ring, err := mapShmRing(f, c.msgsize, wait, true)
+	if err != nil {
+		return result{}, err
+	}
+	defer ring.unmap()
+
+	cmd := spawnConsumer(c, "--shm="+f.Name(), "--shm-wait="+wait.String())
+
+	if err := cmd.Start(); err != nil {
+		return result{}, err
+	}
+	// Reap the child in the background so a crashed consumer can't hang waitAck
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	payload := makePayload(c.msgsize)
+	clock := newRTTClock(c)
+	done := ctx.Done()
+	res := result{}
+	start := time.Now()
+	for i := 1; i <= c.n && !interrupted(done); i++ {
+		if !c.quiet && i <= 5 {
+			fmt.Printf("Producer: %d\n", i)
+		}
+		clock.send(i, c)
+		if err := ring.push(int64(i), payload); err != nil {
+			_ = cmd.Process.Kill()
+			return result{}, err
+		}
+		res.sent = i
+
+		// Wait for the consumer to bump the ACK counter once per window
+		if i%c.window == 0 {
+			if err := ring.waitAck(uint64(i), exited); err != nil {
+				_ = cmd.Process.Kill()
+				return result{}, err
+			}
+			clock.acked()
+		}
+	}
+	res.rtt = clock.samples
+	res.elapsed = time.Since(start)
+
+	// Closing the ring tells the consumer to drain and exit
+	ring.ring.CloseWrite()
+	if ctx.Err() != nil {
+		_ = stopChild(cmd, exited)
+		return res, ctx.Err()
+	}
+	if err := <-exited; err != nil {
+		return result{}, err
+	}
+	res.elapsed = time.Since(start)
+	return res, nil
+}
+
+// Child process entry for shm mode: pops numbers from the ring, bumps the
+// ACK counter by a whole window at a time.
+func consumerShm(path string, c config) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	wait, err := shmring.ParseWait(c.shmWait)
+	if err != nil {
+		return err
+	}
+	ring, err := mapShmRing(f, c.msgsize, wait, false)
+	if err != nil {
+		return err
+	}
+	defer ring.unmap()
+
+	buf := make([]byte, c.msgsize)
+	got := 0
+	for {
+		v, ok, err := ring.pop(buf)
+		if !ok {
+			return err
+		}
+		if !c.quiet && v <= 5 {
+			fmt.Printf("Consumer: %d\n", v)
+		}
+		got++
+		if got%c.window == 0 {
+			atomic.AddUint64(ring.acked, uint64(c.window))
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Socket modes (HW1 extension)
+// Parent = producer listening on a unix domain socket or loopback TCP port,
+// Child = consumer that dials back. Same message/ACK protocol as the
+// pipe-based process mode, so only the transport differs.
+
+package prodcons
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// listenFor opens the listener for a socket mode ("uds" or "tcp") and
+// returns the network name the child should dial.
+func listenFor(mode string) (ln net.Listener, network string, cleanup func(), err error) {
+	switch mode {
+	case "uds":
+		dir, err := os.MkdirTemp("", "hw1-uds-*")
+		if err != nil {
+			return nil, "", nil, err
+		}
+		ln, err = net.Listen("unix", filepath.Join(dir, "hw1.sock"))
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, "", nil, err
+		}
+		return ln, "unix", func() { ln.Close(); os.RemoveAll(dir) }, nil
+	case "tcp":
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return ln, "tcp", func() { ln.Close() }, nil
+	default:
+		return nil, "", nil, errors.New("unknown socket mode: " + mode)
+	}
+}
+
+func runSocket(ctx context.Context, mode string, c config) (result, error) {
+	ln, network, cleanup, err := listenFor(mode)
+	if err != nil {
+		return result{}, err
+	}
+	defer cleanup()
+
+	cmd := spawnConsumer(c, "--net="+network, "--addr="+ln.Addr().String())
+
+	if err := cmd.Start(); err != nil {
+		return result{}, err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	// Accept in the background so a child that never connects can't hang us
+	type acceptResult struct {
+		conn net.Conn
+		err  error
+	}
+	accepted := make(chan acceptResult, 1)
+	go func() {
+		c, err := ln.Accept()
+		accepted <- acceptResult{c, err}
+	}()
+
+	var conn net.Conn
+	select {
+	case a := <-accepted:
+		if a.err != nil {
+			_ = cmd.Process.Kill()
+			return result{}, a.err
+		}
+		conn = a.conn
+	case err := <-exited:
+		if err == nil {
+			err = errors.New("consumer exited before connecting")
+		}
+		return result{}, err
+	case <-ctx.Done():
+		_ = cmd.Process.Kill()
+		<-exited
+		return result{}, ctx.Err()
+	}
+	defer conn.Close()
+
+	// Half-close our side so the child's reader sees EOF
+	closeWrite := func() {
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		} else {
+			_ = conn.Close()
+		}
+	}
+
+	start := time.Now()
+	// Same socket carries data one way and ACKs the other
+	res, err := produceStream(ctx, conn, conn, c, closeWrite)
+	res.elapsed = time.Since(start)
+	closeWrite()
+	if err != nil {
+		_ = stopChild(cmd, exited)
+		return res, err
+	}
+	if err := <-exited; err != nil {
+		return result{}, err
+	}
+	res.elapsed = time.Since(start)
+	return res, nil
+}
+
+// Child process entry for socket modes: dial the parent, then run the stream protocol.
+func consumerSocket(network, addr string, c config) error {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return consumeStream(conn, conn, c)
+}
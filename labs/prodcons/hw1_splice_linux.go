@@ -0,0 +1,33 @@
+package prodcons
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	spliceMove = 0x1 // SPLICE_F_MOVE: move pages instead of copying, if possible
+	spliceMore = 0x4 // SPLICE_F_MORE: more data is coming
+)
+
+// spliceRelay moves everything from in to out with splice(2); both must be
+// pipes. It reports errNoSplice if the very first call is refused, so the
+// caller can fall back before any bytes have moved.
+func spliceRelay(in, out *os.File) error {
+	rfd, wfd := int(in.Fd()), int(out.Fd())
+	moved := false
+	for {
+		n, err := syscall.Splice(rfd, nil, wfd, nil, relayBufSize, spliceMove|spliceMore)
+		switch {
+		case err == syscall.EINTR:
+			continue
+		case (err == syscall.EINVAL || err == syscall.ENOSYS) && !moved:
+			return errNoSplice
+		case err != nil:
+			return err
+		case n == 0:
+			return nil // writer closed its end
+		}
+		moved = true
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package prodcons
+
+import "os"
+
+// spliceRelay: splice(2) is Linux-only, so the relay always copies here.
+func spliceRelay(in, out *os.File) error { return errNoSplice }
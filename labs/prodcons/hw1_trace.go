@@ -0,0 +1,267 @@
+// Exchange trace and replay (HW1 extension, using the HW8 logger)
+// --trace FILE records the producer's side of a run through HW8's
+// ChannelLogger: a line per message sent and per ACK received, each stamped
+// with nanoseconds since the run started (the log line's own timestamp only
+// has one-second resolution). Only the producer goroutine logs, so the order
+// of the lines is the order of the events.
+//
+// --replay FILE reads a trace back and checks it: messages go out in
+// sequence and never more than a window past the last ACK, every ACK
+// releases exactly the next window, restart mode resumes right after the
+// last ACK, time never runs backwards, and a run that finished sent all n.
+// Replaying the timeline also recomputes the per-window RTTs, which should
+// match what the run itself printed.
+//
+// A trace looks like:
+//
+//	[2026-10-15 09:30:00] [INFO] [start] mode=process n=1000 window=8
+//	[2026-10-15 09:30:00] [INFO] [send] seq=1 t=41230
+//	...
+//	[2026-10-15 09:30:00] [INFO] [ack] seq=8 t=97114
+//	[2026-10-15 09:30:00] [INFO] [end] sent=1000 status=ok t=5120977
+
+package prodcons
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+)
+
+// traceModes are the modes that implement --trace.
+var traceModes = map[string]bool{
+	"process": true, "goroutine": true, "uds": true, "tcp": true, "fifo": true,
+	"restart": true, "relay": true, "splice": true,
+}
+
+// traceSync and traceChan size the ChannelLogger: fsync once per traceSync
+// entries, and let the producer run up to traceChan entries ahead of the file.
+const (
+	traceSync = 4096
+	traceChan = 4096
+)
+
+// tracer writes the producer's events; a nil *tracer records nothing.
+type tracer struct {
+	log   logger.Logger
+	start time.Time
+	err   error // first failed Log
+}
+
+func createTrace(path string) (*tracer, error) {
+	l, err := logger.NewChannelLogger(path, traceSync, traceChan)
+	if err != nil {
+		return nil, err
+	}
+	return &tracer{log: l, start: time.Now()}, nil
+}
+
+// event logs one line; every event but start carries its t=nanoseconds.
+func (t *tracer) event(level, kind, msg string) {
+	now := time.Now()
+	if kind != "start" {
+		msg += fmt.Sprintf(" t=%d", now.Sub(t.start).Nanoseconds())
+	}
+	if err := t.log.Log(logger.LogEntry{Timestamp: now, Level: level, Context: kind, Message: msg}); err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+// begin starts the clock and records the run's parameters.
+func (t *tracer) begin(mode string, c config) {
+	if t == nil {
+		return
+	}
+	t.start = time.Now()
+	t.event("INFO", "start", fmt.Sprintf("mode=%s n=%d window=%d", mode, c.n, c.window))
+}
+
+// send records that message seq went out.
+func (t *tracer) send(seq int) {
+	if t != nil {
+		t.event("INFO", "send", fmt.Sprintf("seq=%d", seq))
+	}
+}
+
+// ack records the ACK (or checked replies) releasing the window ending at seq.
+func (t *tracer) ack(seq int) {
+	if t != nil {
+		t.event("INFO", "ack", fmt.Sprintf("seq=%d", seq))
+	}
+}
+
+// restart records restart mode starting a new consumer at message from.
+func (t *tracer) restart(from int) {
+	if t != nil {
+		t.event("WARN", "restart", fmt.Sprintf("from=%d", from))
+	}
+}
+
+// end records how the run finished.
+func (t *tracer) end(sent int, err error) {
+	if t == nil {
+		return
+	}
+	level, status := "INFO", "ok"
+	switch {
+	case errors.Is(err, context.Canceled):
+		level, status = "WARN", "interrupted"
+	case err != nil:
+		level, status = "ERROR", "error"
+	}
+	t.event(level, "end", fmt.Sprintf("sent=%d status=%s", sent, status))
+}
+
+// Close flushes the trace, reporting the first write error.
+func (t *tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	if err := t.log.Close(); err != nil {
+		return err
+	}
+	return t.err
+}
+
+// replayTrace checks the trace at path and prints what it replayed.
+func replayTrace(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		mode           string
+		n, window      int
+		status         string
+		ended          bool
+		lastT          int64
+		lastSent       int // highest message of the current consumer
+		maxSent        int // highest message overall
+		lastAck        int // last message covered by an ACK
+		sends, resent  int
+		acks, restarts int
+		winStart       int64 // when the open window's first message went out
+		rtts           []time.Duration
+	)
+
+	line := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line++
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", path, line, fmt.Sprintf(format, args...))
+		}
+		e, err := logger.ParseEntry(sc.Text())
+		if err != nil {
+			return fail("%v", err)
+		}
+		if line == 1 {
+			if e.Context != "start" {
+				return fail("trace must begin with a start record, got %q", e.Context)
+			}
+			if _, err := fmt.Sscanf(e.Message, "mode=%s n=%d window=%d", &mode, &n, &window); err != nil || window < 1 {
+				return fail("bad start record %q", e.Message)
+			}
+			continue
+		}
+		if ended {
+			return fail("%s record after the end record", e.Context)
+		}
+
+		var seq, sent int
+		var t int64
+		switch e.Context {
+		case "send", "ack":
+			_, err = fmt.Sscanf(e.Message, "seq=%d t=%d", &seq, &t)
+		case "restart":
+			_, err = fmt.Sscanf(e.Message, "from=%d t=%d", &seq, &t)
+		case "end":
+			_, err = fmt.Sscanf(e.Message, "sent=%d status=%s t=%d", &sent, &status, &t)
+		default:
+			return fail("unknown record %q", e.Context)
+		}
+		if err != nil {
+			return fail("bad %s record %q", e.Context, e.Message)
+		}
+		if t < lastT {
+			return fail("time runs backwards (%dns after %dns)", t, lastT)
+		}
+		lastT = t
+
+		switch e.Context {
+		case "send":
+			if seq != lastSent+1 {
+				return fail("message %d sent after %d", seq, lastSent)
+			}
+			if seq > lastAck+window {
+				return fail("message %d sent with only %d ACKed (window %d)", seq, lastAck, window)
+			}
+			if seq > n {
+				return fail("message %d sent, but n=%d", seq, n)
+			}
+			if (seq-1)%window == 0 {
+				winStart = t
+			}
+			if seq <= maxSent {
+				resent++
+			}
+			lastSent, maxSent = seq, max(maxSent, seq)
+			sends++
+		case "ack":
+			if seq != lastAck+window {
+				return fail("ACK for %d, but the next window ends at %d", seq, lastAck+window)
+			}
+			if seq > lastSent {
+				return fail("ACK for %d before it was sent", seq)
+			}
+			rtts = append(rtts, time.Duration(t-winStart))
+			lastAck = seq
+			acks++
+		case "restart":
+			if seq != lastAck+1 {
+				return fail("restart from %d, but the last ACK covered %d", seq, lastAck)
+			}
+			lastSent = seq - 1
+			restarts++
+		case "end":
+			if sent > maxSent {
+				return fail("end record says %d sent, trace shows only %d", sent, maxSent)
+			}
+			ended = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if line == 0 {
+		return fmt.Errorf("%s: empty trace", path)
+	}
+	if !ended {
+		return fmt.Errorf("%s: no end record (was the run killed?)", path)
+	}
+	if status == "ok" {
+		if maxSent != n {
+			return fmt.Errorf("%s: run finished but only messages 1..%d of %d were sent", path, maxSent, n)
+		}
+		if want := n - n%window; lastAck != want {
+			return fmt.Errorf("%s: run finished but the last ACK covered %d, want %d", path, lastAck, want)
+		}
+	}
+
+	fmt.Printf("trace %s: %s mode n=%d window=%d status=%s\n", path, mode, n, window, status)
+	fmt.Printf("  sends=%d (resent %d) acks=%d restarts=%d span=%v\n", sends, resent, acks, restarts, time.Duration(lastT))
+	fmt.Printf("  replayed %v\n", summarizeLatency(rtts))
+	if status == "ok" {
+		fmt.Println("  ordering and completeness verified")
+	} else {
+		fmt.Println("  ordering verified (the run didn't finish, so completeness isn't checked)")
+	}
+	return nil
+}
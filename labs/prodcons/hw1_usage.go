@@ -0,0 +1,114 @@
+// Resource usage accounting (HW1 extension)
+// Each exchange is bracketed by getrusage (for this process and for the
+// consumer children it reaped) and runtime stats, so a result can show where
+// the time went: CPU split, context switches, memory, goroutines, GC.
+
+package prodcons
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// rusage is the subset of getrusage(2) the benchmark reports.
+type rusage struct {
+	user, sys     time.Duration
+	nvcsw, nivcsw int64 // voluntary / involuntary context switches
+	maxRSS        int64 // bytes (a high-water mark, so never a delta)
+}
+
+func (a rusage) sub(b rusage) rusage {
+	return rusage{
+		user:   a.user - b.user,
+		sys:    a.sys - b.sys,
+		nvcsw:  a.nvcsw - b.nvcsw,
+		nivcsw: a.nivcsw - b.nivcsw,
+		maxRSS: a.maxRSS,
+	}
+}
+
+func (r rusage) String() string {
+	return fmt.Sprintf("user=%v sys=%v csw vol=%d invol=%d maxrss=%s",
+		r.user.Round(time.Microsecond), r.sys.Round(time.Microsecond), r.nvcsw, r.nivcsw, mib(r.maxRSS))
+}
+
+func mib(b int64) string { return fmt.Sprintf("%.1fMiB", float64(b)/(1<<20)) }
+
+// usage is what one exchange cost, beyond wall-clock time.
+type usage struct {
+	ok          bool   // getrusage is available (false on non-unix)
+	self, child rusage // producer process; reaped consumer children
+	hasChild    bool   // a consumer process ran during the exchange
+	goroutines  int    // peak goroutine count, sampled while running
+	gcCycles    uint32 // GC cycles completed during the exchange
+	heapAlloc   uint64 // bytes allocated on the heap during the exchange
+}
+
+// runMeasured runs one exchange via runMode and attaches its resource usage.
+func runMeasured(ctx context.Context, name string, c config) (result, error) {
+	var ms0, ms1 runtime.MemStats
+	runtime.ReadMemStats(&ms0)
+	self0, ok := getRusage(false)
+	child0, _ := getRusage(true)
+
+	// Sample the goroutine count in the background; a goroutine mode's
+	// consumer is gone by the time runMode returns.
+	var peak atomic.Int64
+	peak.Store(int64(runtime.NumGoroutine()))
+	stop := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		t := time.NewTicker(time.Millisecond)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				if g := int64(runtime.NumGoroutine()) - 1; g > peak.Load() {
+					peak.Store(g)
+				}
+			}
+		}
+	}()
+
+	res, err := runMode(ctx, name, c)
+
+	close(stop)
+	<-sampled
+	self1, _ := getRusage(false)
+	child1, _ := getRusage(true)
+	runtime.ReadMemStats(&ms1)
+
+	u := usage{
+		ok:         ok,
+		self:       self1.sub(self0),
+		child:      child1.sub(child0),
+		goroutines: int(peak.Load()),
+		gcCycles:   ms1.NumGC - ms0.NumGC,
+		heapAlloc:  ms1.TotalAlloc - ms0.TotalAlloc,
+	}
+	u.hasChild = u.child.user+u.child.sys > 0 || u.child.nvcsw+u.child.nivcsw > 0
+	if !u.hasChild {
+		u.child = rusage{} // RUSAGE_CHILDREN's maxrss belongs to an earlier child
+	}
+	res.usage = u
+	return res, err
+}
+
+// String prints the process-level and runtime-level lines for a trial.
+func (u usage) String() string {
+	rt := fmt.Sprintf("runtime goroutines(peak)=%d gc=%d alloc=%s", u.goroutines, u.gcCycles, mib(int64(u.heapAlloc)))
+	if !u.ok {
+		return rt
+	}
+	out := "self  " + u.self.String()
+	if u.hasChild {
+		out += "\n  child " + u.child.String()
+	}
+	return out + "\n  " + rt
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package prodcons
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// getRusage reads getrusage(2) for this process, or for all reaped children.
+func getRusage(children bool) (rusage, bool) {
+	who := syscall.RUSAGE_SELF
+	if children {
+		who = syscall.RUSAGE_CHILDREN
+	}
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(who, &ru); err != nil {
+		return rusage{}, false
+	}
+	// ru_maxrss is in bytes on darwin, kilobytes elsewhere
+	rss := int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" {
+		rss *= 1024
+	}
+	return rusage{
+		user:   time.Duration(ru.Utime.Nano()),
+		sys:    time.Duration(ru.Stime.Nano()),
+		nvcsw:  int64(ru.Nvcsw),
+		nivcsw: int64(ru.Nivcsw),
+		maxRSS: rss,
+	}, true
+}
@@ -0,0 +1,10 @@
+//go:build unix && !linux
+
+package prodcons
+
+import "time"
+
+// osYield gives up the CPU; without sched_yield a short sleep is the closest thing.
+func osYield() {
+	time.Sleep(time.Microsecond)
+}
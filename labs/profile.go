@@ -0,0 +1,114 @@
+package labs
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// profileFlags are the profiling flags ParseBench adds, and what each
+// writes; "trace" becomes "exectrace" in a flag set that has a -trace of
+// its own.
+var profileFlags = []struct{ name, usage string }{
+	{"cpuprofile", "write a CPU profile to `file`"},
+	{"memprofile", "write a heap profile to `file` when the benchmark ends"},
+	{"blockprofile", "write a profile of where goroutines blocked to `file`"},
+	{"mutexprofile", "write a profile of mutex contention to `file`"},
+	{"trace", "write an execution trace to `file` (go tool trace)"},
+}
+
+// ParseBench parses args into fs, as fs.Parse does, after adding the
+// profiling flags every benchmark takes: -cpuprofile, -memprofile,
+// -blockprofile, -mutexprofile and -trace (-exectrace if fs already has
+// a -trace). It starts whatever was asked for and returns a function that
+// stops it and writes the profiles, to defer in the benchmark's Main;
+// the profiles cover the whole run, set-up included.
+func ParseBench(fs *flag.FlagSet, args []string) (stop func()) {
+	paths := map[string]*string{}
+	for _, f := range profileFlags {
+		name := f.name
+		if prev := fs.Lookup(name); prev != nil {
+			if p, ours := prev.Value.(*profilePath); ours {
+				paths[f.name] = (*string)(p) // parsed before
+				continue
+			}
+			name = "exec" + name
+		}
+		p := new(profilePath)
+		fs.Var(p, name, f.usage)
+		paths[f.name] = (*string)(p)
+	}
+	fs.Parse(args)
+
+	var stops []func()
+	fail := func(err error) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", Prog(), err)
+		os.Exit(1)
+	}
+	if path := *paths["cpuprofile"]; path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			fail(err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fail(err)
+		}
+		stops = append(stops, func() { pprof.StopCPUProfile(); f.Close() })
+	}
+	if path := *paths["trace"]; path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			fail(err)
+		}
+		if err := trace.Start(f); err != nil {
+			fail(err)
+		}
+		stops = append(stops, func() { trace.Stop(); f.Close() })
+	}
+	if *paths["blockprofile"] != "" {
+		runtime.SetBlockProfileRate(1)
+	}
+	if *paths["mutexprofile"] != "" {
+		runtime.SetMutexProfileFraction(1)
+	}
+	return func() {
+		for _, s := range stops {
+			s()
+		}
+		for _, p := range []struct{ flag, profile string }{
+			{"memprofile", "heap"}, {"blockprofile", "block"}, {"mutexprofile", "mutex"},
+		} {
+			if path := *paths[p.flag]; path != "" {
+				if p.profile == "heap" {
+					runtime.GC() // so the profile shows what is live now
+				}
+				if err := writeProfile(p.profile, path); err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", Prog(), err)
+				}
+			}
+		}
+	}
+}
+
+// profilePath is a profiling flag's value, a type of its own so that
+// ParseBench can tell its flags from a benchmark's.
+type profilePath string
+
+func (p *profilePath) String() string     { return string(*p) }
+func (p *profilePath) Set(s string) error { *p = profilePath(s); return nil }
+
+// writeProfile writes the named runtime profile to path.
+func writeProfile(name, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,217 @@
+package queues
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/queue"
+	"example.com/operating-systems/results"
+	"example.com/operating-systems/stats"
+)
+
+var cmdline = labs.BenchFlagSet("queues")
+
+type Counter struct {
+	EnqOK    uint64
+	DeqOK    uint64
+	DeqEmpty uint64
+}
+
+func (c *Counter) add(other Counter) {
+	atomic.AddUint64(&c.EnqOK, other.EnqOK)
+	atomic.AddUint64(&c.DeqOK, other.DeqOK)
+	atomic.AddUint64(&c.DeqEmpty, other.DeqEmpty)
+}
+
+func busyWork(nanos int) {
+	if nanos <= 0 {
+		return
+	}
+	start := time.Now()
+	x := uint64(1469598103934665603) // simple mix
+	for time.Since(start) < time.Duration(nanos)*time.Nanosecond {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+	}
+	_ = x
+}
+
+// The two-lock and Michael & Scott queues themselves are in package queue.
+
+/*
+ Benchmark harness
+ */
+func runProducers(ctx context.Context, wg *sync.WaitGroup, q queue.Queue[int], id int, c *Counter, workNS int) {
+	defer wg.Done()
+	r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)*1337))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			q.Enqueue(int(r.Uint32()))
+			atomic.AddUint64(&c.EnqOK, 1)
+			busyWork(workNS)
+		}
+	}
+}
+
+func runConsumers(ctx context.Context, wg *sync.WaitGroup, q queue.Queue[int], id int, c *Counter, workNS int) {
+	defer wg.Done()
+	spin := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			if _, ok := q.Dequeue(); ok {
+				atomic.AddUint64(&c.DeqOK, 1)
+				busyWork(workNS)
+				spin = 0
+			} else {
+				atomic.AddUint64(&c.DeqEmpty, 1)
+				// light backoff to avoid burning CPU when empty
+				spin++
+				if spin < 50 {
+					runtime.Gosched()
+				} else {
+					time.Sleep(time.Microsecond)
+					if spin > 1000 {
+						spin = 0
+					}
+				}
+			}
+		}
+	}
+}
+
+func human(n uint64, dur time.Duration) string {
+	return rate(float64(n) / dur.Seconds())
+}
+
+// rate formats ops/s with a unit prefix.
+func rate(opsPerSec float64) string {
+	switch {
+	case opsPerSec > 1e9:
+		return fmt.Sprintf("%.2f Gops/s", opsPerSec/1e9)
+	case opsPerSec > 1e6:
+		return fmt.Sprintf("%.2f Mops/s", opsPerSec/1e6)
+	case opsPerSec > 1e3:
+		return fmt.Sprintf("%.2f Kops/s", opsPerSec/1e3)
+	default:
+		return fmt.Sprintf("%.2f ops/s", opsPerSec)
+	}
+}
+
+func Main(args []string) {
+	var (
+		queueType  = cmdline.String("q", "lock", "queue type: lock | ms | ms-hp")
+		producers  = cmdline.Int("producers", 4, "number of producer goroutines")
+		consumers  = cmdline.Int("consumers", 4, "number of consumer goroutines")
+		duration   = cmdline.Duration("dur", 5*time.Second, "benchmark duration")
+		workNS     = cmdline.Int("work", 0, "synthetic CPU nanos per successful op (simulate app work)")
+		gomaxprocs = cmdline.Int("gomaxprocs", 0, "if >0, sets GOMAXPROCS")
+		warmup     = cmdline.Duration("warmup", 500*time.Millisecond, "warmup time")
+		runs       = cmdline.Int("runs", 1, "measured runs; with more than one, report mean throughput with a 95% confidence interval")
+	)
+	defer labs.ParseBench(cmdline, args)()
+
+	if *gomaxprocs > 0 {
+		runtime.GOMAXPROCS(*gomaxprocs)
+	}
+
+	// Reduce GC interference variance a bit
+	debug.SetGCPercent(100)
+
+	kind, err := queue.ParseKind(*queueType)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	q, err := queue.New[int](kind)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Seed with some items so consumers don’t start on empty queue
+	for i := 0; i < *consumers; i++ {
+		q.Enqueue(i)
+	}
+
+	var total Counter
+	var wg sync.WaitGroup
+
+	// Warmup
+	ctxW, cancelW := context.WithTimeout(context.Background(), *warmup)
+	for i := 0; i < *producers; i++ {
+		wg.Add(1)
+		go runProducers(ctxW, &wg, q, i, &total, 0)
+	}
+	for i := 0; i < *consumers; i++ {
+		wg.Add(1)
+		go runConsumers(ctxW, &wg, q, i, &total, 0)
+	}
+	wg.Wait()
+	cancelW()
+
+	// Main runs
+	var enqRates, deqRates []float64
+	for r := 0; r < max(*runs, 1); r++ {
+		agg := measure(q, *producers, *consumers, *duration, *workNS)
+		enqRates = append(enqRates, float64(agg.EnqOK)/duration.Seconds())
+		deqRates = append(deqRates, float64(agg.DeqOK)/duration.Seconds())
+		if *runs > 1 {
+			fmt.Printf("Run %d: ", r+1)
+		}
+		fmt.Printf("Queue: %s | P=%d C=%d | dur=%s | work/op=%dns\n", *queueType, *producers, *consumers, *duration, *workNS)
+		fmt.Printf("Enqueue: %d  (%s)\n", agg.EnqOK, human(agg.EnqOK, *duration))
+		fmt.Printf("Dequeue: %d  (%s)\n", agg.DeqOK, human(agg.DeqOK, *duration))
+		fmt.Printf("Empty  : %d  (dequeue attempts when empty)\n", agg.DeqEmpty)
+	}
+	enq, deq := stats.Summarize(enqRates), stats.Summarize(deqRates)
+	if *runs > 1 {
+		fmt.Printf("\nOver %d runs (mean ± 95%% CI, stddev):\n", *runs)
+		fmt.Printf("Enqueue: %s ± %s  (stddev %s)\n", rate(enq.Mean), rate(enq.CI95()), rate(enq.Stddev))
+		fmt.Printf("Dequeue: %s ± %s  (stddev %s)\n", rate(deq.Mean), rate(deq.CI95()), rate(deq.Stddev))
+	}
+	if err := labs.Record(cmdline, results.Rate("enqueue", enq.Mean, "ops/s"), results.Rate("dequeue", deq.Mean, "ops/s")); err != nil {
+		fmt.Println("record:", err)
+	}
+}
+
+// measure runs the producers and consumers against q for dur and adds
+// up their counters.
+func measure(q queue.Queue[int], producers, consumers int, dur time.Duration, workNS int) Counter {
+	ctx, cancel := context.WithTimeout(context.Background(), dur)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	counters := make([]Counter, producers+consumers)
+
+	for i := 0; i < producers; i++ {
+		wg.Add(1)
+		go runProducers(ctx, &wg, q, i, &counters[i], workNS)
+	}
+	for i := 0; i < consumers; i++ {
+		wg.Add(1)
+		go runConsumers(ctx, &wg, q, i, &counters[producers+i], workNS)
+	}
+	wg.Wait()
+
+	// Aggregate
+	var agg Counter
+	for i := range counters {
+		agg.add(counters[i])
+	}
+	return agg
+}
@@ -0,0 +1,73 @@
+package raidbench
+
+import (
+    "fmt"
+    "time"
+    "example.com/operating-systems/HW7/raid"
+    "example.com/operating-systems/labs"
+    "example.com/operating-systems/results"
+    "math/rand"
+)
+
+var cmdline = labs.BenchFlagSet("raidbench")
+
+const Blocks = 25000
+
+func runBenchmark(name string, r raid.RAID) []results.Metric {
+    fmt.Println("=== Benchmark:", name, "===")
+
+    data := make([]byte, raid.BlockSize)
+    rand.Read(data)
+
+    startW := time.Now()
+    for i := 0; i < Blocks; i++ {
+        r.Write(i, data)
+    }
+    writeTime := time.Since(startW)
+
+    startR := time.Now()
+    for i := 0; i < Blocks; i++ {
+        r.Read(i)
+    }
+    readTime := time.Since(startR)
+
+    fmt.Printf("Write Time: %v\n", writeTime)
+    fmt.Printf("Read Time:  %v\n", readTime)
+    fmt.Printf("Per-block write: %v\n", writeTime/Blocks)
+    fmt.Printf("Per-block read:  %v\n\n", readTime/Blocks)
+    return []results.Metric{
+        results.Duration(name+" write/block", writeTime/Blocks),
+        results.Duration(name+" read/block", readTime/Blocks),
+    }
+}
+
+func Main(args []string) {
+    var opts raid.DiskOptions
+    cmdline.Var(&opts.Sync, "sync", "how each block write syncs: full (fsync; F_FULLFSYNC on macOS), data (fdatasync), none")
+    cmdline.BoolVar(&opts.Direct, "direct", false, "bypass the page cache (O_DIRECT, F_NOCACHE, FILE_FLAG_NO_BUFFERING)")
+    prealloc := cmdline.Bool("prealloc", false, "reserve the disks' space before writing")
+    defer labs.ParseBench(cmdline, args)()
+    if *prealloc {
+        opts.Preallocate = Blocks
+    }
+    fmt.Printf("sync: %v  direct: %v  prealloc: %v\n\n", opts.Sync, opts.Direct, *prealloc)
+
+    var disks []*raid.Disk
+    for i := 0; i < 5; i++ {
+        d, err := raid.OpenDiskWith(fmt.Sprintf("disk%d.dat", i), opts)
+        if err != nil {
+            fmt.Println("open disk:", err)
+            return
+        }
+        disks = append(disks, d)
+    }
+
+    var metrics []results.Metric
+    metrics = append(metrics, runBenchmark("RAID 0", raid.NewRAID0(disks))...)
+    metrics = append(metrics, runBenchmark("RAID 1", raid.NewRAID1(disks))...)
+    metrics = append(metrics, runBenchmark("RAID 4", raid.NewRAID4(disks))...)
+    metrics = append(metrics, runBenchmark("RAID 5", raid.NewRAID5(disks))...)
+    if err := labs.Record(cmdline, metrics...); err != nil {
+        fmt.Println("record:", err)
+    }
+}
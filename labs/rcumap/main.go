@@ -0,0 +1,117 @@
+// RCU map vs readers-writers-locked maps
+// Runs N goroutines against each map of package rcu for -dur at each
+// read ratio in -reads: a read loads a random key, anything else stores
+// one, over -keys keys. The table gives millions of operations per
+// second, one column per map: the RCU map's lock-free reads win when
+// reads dominate, and its whole-map copy per write loses as writes grow
+// and the map with them. -v adds the RCU map's epoch counts: how often
+// the epoch advanced and how many retired copies were freed for reuse.
+//
+//	go run ./cmd/rcumap
+//	go run ./cmd/rcumap -reads 90,99,99.9,100 -goroutines 8 -keys 4096
+//	go run ./cmd/rcumap -maps rcu,rwmutex,reader-pref,writer-pref,fair -v
+package rcumap
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/rcu"
+)
+
+var cmdline = labs.FlagSet("rcumap")
+
+func Main(args []string) {
+	var (
+		names   = cmdline.String("maps", "rcu,rwmutex,fair", "comma-separated maps: rcu | rwmutex | reader-pref | writer-pref | fair")
+		reads   = cmdline.String("reads", "50,90,99,100", "comma-separated read percentages")
+		g       = cmdline.Int("goroutines", 4, "goroutines")
+		keys    = cmdline.Int("keys", 1024, "keys in the map")
+		dur     = cmdline.Duration("dur", 500*time.Millisecond, "how long each run lasts")
+		seed    = cmdline.Int64("seed", 1, "key and operation choice seed")
+		verbose = cmdline.Bool("v", false, "print the RCU map's epoch counts after each run")
+	)
+	defer labs.ParseBench(cmdline, args)()
+	var ratios []float64
+	for _, f := range strings.Split(*reads, ",") {
+		r, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || r < 0 || r > 100 {
+			fmt.Fprintf(os.Stderr, "rcumap: bad read percentage %q\n", f)
+			os.Exit(2)
+		}
+		ratios = append(ratios, r)
+	}
+	maps := strings.Split(*names, ",")
+	for i := range maps {
+		maps[i] = strings.TrimSpace(maps[i])
+		if _, err := rcu.New[int, int](maps[i]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	fmt.Printf("%d CPUs, %d goroutines, %d keys, %v per run; Mops/s\n\n", runtime.NumCPU(), *g, *keys, *dur)
+	fmt.Printf("%7s", "read%")
+	for _, name := range maps {
+		fmt.Printf(" %12s", name)
+	}
+	fmt.Println()
+	var notes []string
+	for _, r := range ratios {
+		fmt.Printf("%7g", r)
+		for _, name := range maps {
+			m, _ := rcu.New[int, int](name)
+			ops := run(m, *g, *keys, r/100, *dur, *seed)
+			fmt.Printf(" %12.2f", float64(ops)/dur.Seconds()/1e6)
+			if rm, ok := m.(*rcu.RCU[int, int]); ok && *verbose {
+				s := rm.Domain().Stats()
+				notes = append(notes, fmt.Sprintf("%g%% reads: %d writes, %d epoch advances, %d copies freed, %d pending, %d guards",
+					r, s.Retired-uint64(*keys), s.Advances, s.Freed, s.Pending(), s.Records))
+			}
+		}
+		fmt.Println()
+	}
+	for _, n := range notes {
+		fmt.Println(n)
+	}
+}
+
+// run fills m with keys keys and has g goroutines load (with probability
+// reads) or store random keys for dur, returning the operations done.
+func run(m rcu.Map[int, int], g, keys int, reads float64, dur time.Duration, seed int64) uint64 {
+	for k := 0; k < keys; k++ {
+		m.Store(k, k)
+	}
+	var ops atomic.Uint64
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for i := 0; i < g; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed + int64(i)))
+			n := uint64(0)
+			for ; !stop.Load(); n++ {
+				k := rng.Intn(keys)
+				if rng.Float64() < reads {
+					m.Load(k)
+				} else {
+					m.Store(k, int(n))
+				}
+			}
+			ops.Add(n)
+		}()
+	}
+	time.Sleep(dur)
+	stop.Store(true)
+	wg.Wait()
+	return ops.Load()
+}
@@ -0,0 +1,194 @@
+// Replicated log: durability vs availability
+// Starts a replog leader and -followers follower processes (this program
+// re-run with -replog-follower), then logs -entries HW8 log entries at
+// each quorum size in -quorums. A third of the way in, -kill followers
+// are killed; two thirds in, with -restart, they come back and catch
+// up. At the end the leader dies too, and the followers' logs on disk
+// are all that's left.
+//
+// For each quorum the table gives the entries committed, the Log calls
+// that couldn't reach a quorum within -timeout (unavailable), commit
+// latency, and how many committed entries no surviving follower holds
+// (lost with the leader). A quorum of 1 is always available and loses
+// whatever only the leader had; a quorum of every replica never loses a
+// committed entry but stalls as soon as one follower is down.
+//
+// Faults for the followers: -drop (probability of not acknowledging),
+// -delay (before each acknowledgment), -nosync (acknowledge before
+// syncing) and -crash-after (a follower crashes itself after that many
+// entries).
+//
+//	go run ./cmd/replog
+//	go run ./cmd/replog -followers 4 -quorums 1,3,5 -kill 2 -restart
+//	go run ./cmd/replog -quorums 2 -drop 0.3 -delay 2ms -v
+package replog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/replog"
+	"example.com/operating-systems/stats"
+)
+
+var cmdline = labs.FlagSet("replog")
+
+var levels = []string{"INFO", "WARN", "ERROR"}
+
+func Main(args []string) {
+	var (
+		followers  = cmdline.Int("followers", 2, "follower processes")
+		quorums    = cmdline.String("quorums", "", "comma-separated quorum sizes, the leader included (default 1 to followers+1)")
+		entries    = cmdline.Int("entries", 300, "entries to log per quorum")
+		timeout    = cmdline.Duration("timeout", 100*time.Millisecond, "how long Log waits for a quorum")
+		kill       = cmdline.Int("kill", 1, "followers killed a third of the way in")
+		restart    = cmdline.Bool("restart", false, "restart the killed followers two thirds of the way in")
+		drop       = cmdline.Float64("drop", 0, "followers: probability of not acknowledging a batch")
+		delay      = cmdline.Duration("delay", 0, "followers: delay before each acknowledgment")
+		nosync     = cmdline.Bool("nosync", false, "followers: acknowledge before syncing")
+		crashAfter = cmdline.Int("crash-after", 0, "followers: crash after this many entries (0: never)")
+		verbose    = cmdline.Bool("v", false, "print each follower's log length at the end")
+
+		child  = cmdline.Int("replog-follower", -1, "internal: run as follower N")
+		leader = cmdline.String("leader", "", "internal: the leader's address")
+		wal    = cmdline.String("wal", "", "internal: the follower's log file")
+		seed   = cmdline.Int64("seed", 1, "fault injection seed")
+	)
+	cmdline.Parse(args)
+	faults := replog.Faults{CrashAfter: *crashAfter, Drop: *drop, Delay: *delay, NoSync: *nosync, Seed: *seed}
+	if *child >= 0 {
+		err := replog.Follow(*leader, *child, *wal, faults)
+		if errors.Is(err, replog.ErrCrash) {
+			os.Exit(3)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "follower %d: %v\n", *child, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var qs []int
+	if *quorums == "" {
+		for q := 1; q <= *followers+1; q++ {
+			qs = append(qs, q)
+		}
+	} else {
+		for _, f := range strings.Split(*quorums, ",") {
+			q, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil || q < 1 {
+				fmt.Fprintf(os.Stderr, "replog: bad quorum %q\n", f)
+				os.Exit(2)
+			}
+			qs = append(qs, q)
+		}
+	}
+	fmt.Printf("leader + %d followers, %d entries, %d killed at 1/3%s, timeout %v\n\n", *followers, *entries, *kill,
+		map[bool]string{true: " and restarted at 2/3", false: ""}[*restart], *timeout)
+	fmt.Printf("%6s %9s %11s %10s %10s %10s\n", "quorum", "committed", "unavailable", "p50", "p99", "lost")
+	for _, q := range qs {
+		dir, err := os.MkdirTemp("", "replog")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		err = run(dir, q, *followers, *entries, *kill, *restart, *timeout, args, *verbose)
+		os.RemoveAll(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "quorum %d: %v\n", q, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// run is one quorum's experiment.
+func run(dir string, quorum, followers, entries, kill int, restart bool, timeout time.Duration, args []string, verbose bool) error {
+	l, err := replog.NewLeader("127.0.0.1:0", filepath.Join(dir, "leader.log"), replog.Config{Quorum: quorum, Timeout: timeout})
+	if err != nil {
+		return err
+	}
+	procs := make([]*exec.Cmd, followers)
+	walOf := func(i int) string { return filepath.Join(dir, fmt.Sprintf("follower%d.log", i)) }
+	spawn := func(i int) error {
+		cmd := labs.Command(append(args, "-replog-follower", strconv.Itoa(i), "-leader", l.Addr(), "-wal", walOf(i))...)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		procs[i] = cmd
+		go cmd.Wait()
+		return nil
+	}
+	defer func() {
+		for _, p := range procs {
+			if p != nil && p.Process != nil {
+				p.Process.Kill()
+			}
+		}
+	}()
+	for i := range procs {
+		if err := spawn(i); err != nil {
+			return err
+		}
+	}
+	if err := l.WaitFollowers(followers, 5*time.Second); err != nil {
+		return err
+	}
+
+	var lat []time.Duration
+	for i := 0; i < entries; i++ {
+		switch {
+		case i == entries/3:
+			for k := 0; k < kill && k < followers; k++ {
+				procs[k].Process.Kill()
+			}
+		case i == 2*entries/3 && restart:
+			for k := 0; k < kill && k < followers; k++ {
+				if err := spawn(k); err != nil {
+					return err
+				}
+			}
+		}
+		e := logger.LogEntry{Timestamp: time.Now(), Level: levels[i%len(levels)], Context: fmt.Sprintf("req-%d", i), Message: fmt.Sprintf("entry %d", i)}
+		began := time.Now()
+		err := l.Log(e)
+		switch {
+		case err == nil:
+			lat = append(lat, time.Since(began))
+		case !errors.Is(err, replog.ErrNoQuorum):
+			return err
+		}
+	}
+	st := l.Stats()
+	// The leader dies; only the followers' logs are left.
+	l.Close()
+	for _, p := range procs {
+		p.Process.Kill()
+	}
+	time.Sleep(50 * time.Millisecond) // let the kills land before reading
+	longest := 0
+	var lens []string
+	for i := range procs {
+		got, err := replog.ReadLog(walOf(i))
+		if err != nil {
+			return err
+		}
+		longest = max(longest, len(got))
+		lens = append(lens, strconv.Itoa(len(got)))
+	}
+	s := stats.Summarize(lat)
+	fmt.Printf("%6d %9d %11d %10v %10v %10d\n", quorum, st.Committed, st.NoQuorum,
+		s.Quantile(0.50).Round(time.Microsecond), s.Quantile(0.99).Round(time.Microsecond), max(0, st.Committed-longest))
+	if verbose {
+		fmt.Printf("       leader %d entries; followers' logs: %s\n", st.Entries, strings.Join(lens, ", "))
+	}
+	return nil
+}
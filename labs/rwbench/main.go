@@ -0,0 +1,194 @@
+// Readers-writers benchmark
+// Runs -readers reader and -writers writer goroutines against each lock of
+// package rwlock for -duration. A reader holds the lock for -read µs and
+// comes straight back after -rthink µs; a writer holds it for -write µs
+// every -wthink µs, so by default the load is read-heavy and readers
+// overlap continuously, which is what starves writers under reader
+// preference. Each lock is checked as it runs: a writer must be alone and
+// a reader must never see a writer.
+//
+// The report gives reader and writer throughput, the writers' wait to get
+// in (p50, p99, max) and the readers' max wait. A writer still waiting at
+// the end is let in once the readers stop, so a starved writer's wait
+// shows as about the whole run.
+//
+//	go run ./cmd/rwbench
+//	go run ./cmd/rwbench -readers 16 -writers 4 -wthink 200 -duration 2s
+//	go run ./cmd/rwbench -kinds fair,writer-pref -readers 2 -writers 8 -wthink 0
+package rwbench
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/rwlock"
+	"example.com/operating-systems/stats"
+)
+
+var cmdline = labs.FlagSet("rwbench")
+
+func Main(args []string) {
+	var (
+		kinds    = cmdline.String("kinds", "reader-pref,writer-pref,fair,rwmutex", "comma-separated locks: reader-pref | writer-pref | fair | rwmutex")
+		readers  = cmdline.Int("readers", 8, "reader goroutines")
+		writers  = cmdline.Int("writers", 2, "writer goroutines")
+		duration = cmdline.Duration("duration", time.Second, "how long each lock runs")
+		read     = cmdline.Int("read", 50, "µs a reader holds the lock")
+		write    = cmdline.Int("write", 50, "µs a writer holds the lock")
+		rthink   = cmdline.Int("rthink", 0, "µs a reader waits between reads")
+		wthink   = cmdline.Int("wthink", 1000, "µs a writer waits between writes")
+	)
+	defer labs.ParseBench(cmdline, args)()
+
+	c := cfg{readers: *readers, writers: *writers, duration: *duration,
+		read: *read, write: *write, rthink: *rthink, wthink: *wthink}
+	var rows []result
+	for _, name := range strings.Split(*kinds, ",") {
+		k, err := rwlock.ParseKind(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		l, err := rwlock.New(k)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		r := run(l, c)
+		r.kind = k
+		fmt.Printf("%-12s %d reads, %d writes in %v", k, r.reads, r.writes, r.elapsed.Round(time.Millisecond))
+		if r.violations > 0 {
+			fmt.Printf(": %d EXCLUSION VIOLATIONS", r.violations)
+		}
+		fmt.Println()
+		rows = append(rows, r)
+	}
+
+	fmt.Printf("\n%-12s %10s %10s %12s %12s %12s %12s %10s\n",
+		"lock", "reads/s", "writes/s", "w wait p50", "w wait p99", "w wait max", "r wait max", "violations")
+	for _, r := range rows {
+		s := r.elapsed.Seconds()
+		w := summarize(r.writeWaits)
+		fmt.Printf("%-12s %10.0f %10.0f %12v %12v %12v %12v %10d\n", r.kind, float64(r.reads)/s, float64(r.writes)/s,
+			w.p50.Round(time.Microsecond), w.p99.Round(time.Microsecond), w.max.Round(time.Microsecond),
+			r.maxReadWait.Round(time.Microsecond), r.violations)
+	}
+}
+
+// cfg is the load.
+type cfg struct {
+	readers, writers            int
+	duration                    time.Duration
+	read, write, rthink, wthink int
+}
+
+// result is one lock's run.
+type result struct {
+	kind          rwlock.Kind
+	elapsed       time.Duration
+	reads, writes int
+	writeWaits    []time.Duration
+	maxReadWait   time.Duration
+	violations    int64
+}
+
+// run loads l with c's readers and writers.
+func run(l rwlock.RWLock, c cfg) result {
+	var (
+		wg         sync.WaitGroup
+		stop       atomic.Bool
+		inReaders  atomic.Int64 // readers inside
+		inWriters  atomic.Int64 // writers inside
+		violations atomic.Int64
+		mu         sync.Mutex // guards r
+		r          result
+	)
+	start := time.Now()
+	for i := 0; i < c.readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var n int
+			var maxWait time.Duration
+			for !stop.Load() {
+				t0 := time.Now()
+				l.RLock()
+				maxWait = max(maxWait, time.Since(t0))
+				inReaders.Add(1)
+				if inWriters.Load() != 0 {
+					violations.Add(1)
+				}
+				busyUS(c.read)
+				inReaders.Add(-1)
+				l.RUnlock()
+				n++
+				sleepUS(c.rthink)
+			}
+			mu.Lock()
+			r.reads += n
+			r.maxReadWait = max(r.maxReadWait, maxWait)
+			mu.Unlock()
+		}()
+	}
+	for i := 0; i < c.writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var waits []time.Duration
+			for !stop.Load() {
+				t0 := time.Now()
+				l.Lock()
+				waits = append(waits, time.Since(t0))
+				if inWriters.Add(1) != 1 || inReaders.Load() != 0 {
+					violations.Add(1)
+				}
+				busyUS(c.write)
+				inWriters.Add(-1)
+				l.Unlock()
+				sleepUS(c.wthink)
+			}
+			mu.Lock()
+			r.writes += len(waits)
+			r.writeWaits = append(r.writeWaits, waits...)
+			mu.Unlock()
+		}()
+	}
+	time.Sleep(c.duration)
+	stop.Store(true)
+	wg.Wait()
+	r.elapsed = time.Since(start)
+	r.violations = violations.Load()
+	return r
+}
+
+// busyUS burns about us microseconds, holding the CPU as a critical
+// section would.
+func busyUS(us int) {
+	if us <= 0 {
+		return
+	}
+	end := time.Now().Add(time.Duration(us) * time.Microsecond)
+	for time.Now().Before(end) {
+	}
+}
+
+func sleepUS(us int) {
+	if us > 0 {
+		time.Sleep(time.Duration(us) * time.Microsecond)
+	}
+}
+
+type latSummary struct {
+	p50, p99, max time.Duration
+}
+
+// summarize returns the percentiles of ds.
+func summarize(ds []time.Duration) latSummary {
+	s := stats.Summarize(ds)
+	return latSummary{p50: s.Quantile(0.50), p99: s.Quantile(0.99), max: s.Max}
+}
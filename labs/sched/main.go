@@ -0,0 +1,265 @@
+// CPU scheduling simulator
+// Runs a workload through FIFO, SJF, STCF, Round Robin, MLFQ, and CFS (see
+// package sched) and compares turnaround, response, and waiting times.
+//
+//	go run ./cmd/sched                        # built-in example workload
+//	go run ./cmd/sched -trace jobs.txt -policy rr -quantum 2
+//	go run ./cmd/sched -exec -workers 2 -tick 1ms     # and for real
+//	go run ./cmd/sched -preempt -tick 2ms -check 500us  # preempted by a timer
+//	go run ./cmd/sched -gen 12 -gen-seed 7 -gen-out w.txt -gantt 80 -svg runs.svg
+//
+// A trace has one job per line: "[name] arrival burst [nice [io-every io-time]]".
+package sched
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/sched"
+)
+
+var cmdline = labs.FlagSet("sched")
+
+// example is the classic convoy: a long job arriving just ahead of two short ones.
+const example = `A 0 100
+B 10 10
+C 10 10
+`
+
+func Main(args []string) {
+	var (
+		trace   = cmdline.String("trace", "", "workload file, one \"[name] arrival burst [nice [io-every io-time]]\" per line (default: built-in example)")
+		policy  = cmdline.String("policy", "all", "comma-separated policies: fifo | sjf | stcf | prio | rr | mlfq | cfs, or all")
+		quantum = cmdline.Int("quantum", 1, "Round Robin time slice in ticks")
+		quanta  = cmdline.String("mlfq-quanta", "10,20,40", "MLFQ time slice per level, top level first")
+		allots  = cmdline.String("mlfq-allot", "", "MLFQ allotment per level before demotion (default: one quantum)")
+		boost   = cmdline.Int("mlfq-boost", 200, "MLFQ priority boost period in ticks (0 = never)")
+		noAcct  = cmdline.Bool("mlfq-no-accounting", false, "MLFQ: forgive jobs that give up the CPU early (the gameable Rule 4)")
+		latency = cmdline.Int("cfs-latency", 48, "CFS targeted latency in ticks (one period in which every job runs)")
+		minGran = cmdline.Int("cfs-min-gran", 6, "CFS minimum time slice in ticks")
+		real    = cmdline.Bool("exec", false, "also run the workload for real: CPU-bound tasks on a worker pool, dispatched by each policy")
+		workers = cmdline.Int("workers", 1, "-exec: worker goroutines (CPUs) in the pool")
+		tick    = cmdline.Duration("tick", time.Millisecond, "-exec, -preempt: CPU time one tick of burst stands for")
+		preempt = cmdline.Bool("preempt", false, "also run the workload on one CPU preempted by a timer interrupt every -tick")
+		check   = cmdline.Duration("check", 0, "-preempt: CPU a process burns between checkpoints (default -tick/20)")
+		gantt   = cmdline.Int("gantt", 0, "if >0, draw an ASCII Gantt chart of each run this many columns wide")
+		svg     = cmdline.String("svg", "", "write Gantt charts of all runs, on one time axis, to this SVG file")
+
+		def     = sched.DefaultGenerator()
+		genJobs = cmdline.Int("gen", 0, "if >0, generate a random workload of this many jobs instead of reading -trace")
+		genSeed = cmdline.Int64("gen-seed", def.Seed, "-gen: random seed (the same seed gives the same workload)")
+		genOut  = cmdline.String("gen-out", "", "-gen: also write the generated workload to this trace file")
+		genIO   = cmdline.Float64("gen-io-jobs", def.IOJobs, "-gen: fraction of jobs that do I/O")
+		dists   = []struct {
+			flag, usage string
+			dst         *sched.Dist
+		}{
+			{"gen-batch", "jobs per arrival burst", &def.Batch},
+			{"gen-gap", "ticks between arrivals inside a burst", &def.Gap},
+			{"gen-idle", "ticks between bursts", &def.Idle},
+			{"gen-cpu", "CPU burst per job", &def.CPU},
+			{"gen-nice", "nice value per job", &def.Nice},
+			{"gen-io-every", "I/O jobs: CPU ticks between I/O requests", &def.IOEvery},
+			{"gen-io-time", "I/O jobs: ticks each I/O request blocks", &def.IOTime},
+		}
+	)
+	for _, d := range dists {
+		cmdline.Func(d.flag, "-gen: "+d.usage+", a distribution: const:N | uniform:LO,HI | exp:MEAN | normal:MEAN,SD | pareto:MIN,SHAPE (default "+d.dst.String()+")",
+			func(v string) (err error) {
+				*d.dst, err = sched.ParseDist(v)
+				return err
+			})
+	}
+	cmdline.Parse(args)
+
+	var jobs []sched.Job
+	var err error
+	switch {
+	case *genJobs > 0:
+		gen := def
+		gen.Jobs, gen.Seed, gen.IOJobs = *genJobs, *genSeed, *genIO
+		if jobs, err = gen.Generate(); err != nil {
+			fmt.Fprintln(os.Stderr, "bad -gen settings:", err)
+			os.Exit(2)
+		}
+		if *genOut != "" {
+			if err := writeTrace(*genOut, gen.String(), jobs); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+	case *trace != "":
+		f, ferr := os.Open(*trace)
+		if ferr != nil {
+			fmt.Fprintln(os.Stderr, ferr)
+			os.Exit(1)
+		}
+		jobs, err = sched.ParseJobs(f)
+		f.Close()
+	default:
+		jobs, err = sched.ParseJobs(strings.NewReader(example))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bad -trace:", err)
+		os.Exit(2)
+	}
+	if len(jobs) == 0 {
+		fmt.Fprintln(os.Stderr, "the workload has no jobs")
+		os.Exit(2)
+	}
+
+	opts := sched.Options{Quantum: *quantum, Boost: *boost, NoAccounting: *noAcct, Latency: *latency, MinGranularity: *minGran}
+	if opts.Quanta, err = parseInts(*quanta); err != nil {
+		fmt.Fprintln(os.Stderr, "bad -mlfq-quanta:", err)
+		os.Exit(2)
+	}
+	if opts.Allotments, err = parseInts(*allots); err != nil {
+		fmt.Fprintln(os.Stderr, "bad -mlfq-allot:", err)
+		os.Exit(2)
+	}
+
+	names := sched.Policies
+	if *policy != "all" {
+		names = strings.Split(*policy, ",")
+	}
+	var results []sched.Result
+	var execs []sched.ExecResult
+	var preempts []sched.PreemptResult
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		p, err := sched.NewPolicy(name, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		res, err := sched.Simulate(jobs, p)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(res.Format())
+		results = append(results, res)
+
+		if *real {
+			p, _ := sched.NewPolicy(name, opts) // policies keep state, so a fresh one
+			ex, err := sched.Executor{Workers: *workers, Tick: *tick}.Run(jobs, p)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Println(ex.Format())
+			execs = append(execs, ex)
+		}
+		if *preempt {
+			p, _ := sched.NewPolicy(name, opts)
+			pr, err := sched.Machine{Tick: *tick, Check: *check}.Run(jobs, p)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Println(pr.Format())
+			preempts = append(preempts, pr)
+		}
+	}
+
+	// Gantt charts, all to the scale of the longest run
+	span := 0
+	for _, r := range results {
+		span = max(span, r.Makespan)
+	}
+	if *gantt > 0 {
+		for _, r := range results {
+			fmt.Println(r.Gantt(*gantt, span))
+		}
+	}
+	if *svg != "" {
+		if err := writeSVG(*svg, results); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	// Side-by-side summary
+	width := len("policy")
+	for _, r := range results {
+		width = max(width, len(r.Policy))
+	}
+	fmt.Printf("%-*s %12s %10s %10s %9s\n", width, "policy", "turnaround", "response", "waiting", "switches")
+	for _, r := range results {
+		t, resp, w := r.Averages()
+		fmt.Printf("%-*s %12.2f %10.2f %10.2f %9d\n", width, r.Policy, t, resp, w, r.Switches)
+	}
+
+	// Measured, in ticks, next to the simulation
+	if len(execs) > 0 {
+		fmt.Printf("\nMeasured on %d worker(s), in ticks of %v (simulated in parentheses):\n", *workers, *tick)
+		fmt.Printf("%-*s %18s %18s %18s\n", width, "policy", "turnaround", "response", "waiting")
+		for i, ex := range execs {
+			t, resp, w := ex.Averages()
+			st, sresp, sw := results[i].Averages()
+			inTicks := func(d time.Duration) float64 { return float64(d) / float64(*tick) }
+			fmt.Printf("%-*s %9.2f (%6.2f) %9.2f (%6.2f) %9.2f (%6.2f)\n", width, ex.Policy,
+				inTicks(t), st, inTicks(resp), sresp, inTicks(w), sw)
+		}
+	}
+
+	// Preempted by the timer, next to the simulation
+	if len(preempts) > 0 {
+		fmt.Printf("\nPreempted by a timer every %v, in ticks (simulated in parentheses):\n", *tick)
+		fmt.Printf("%-*s %18s %18s %9s %9s %9s %10s\n", width, "policy", "turnaround", "response", "switches", "timer", "arrival", "trap p99")
+		for i, pr := range preempts {
+			t, resp, _ := pr.Averages()
+			st, sresp, _ := results[i].Averages()
+			inTicks := func(d time.Duration) float64 { return float64(d) / float64(*tick) }
+			fmt.Printf("%-*s %9.2f (%6.2f) %9.2f (%6.2f) %4d (%3d) %9d %9d %10v\n", width, pr.Policy,
+				inTicks(t), st, inTicks(resp), sresp, pr.Switches, results[i].Switches, pr.Preemptions, pr.ArrivalPreempted,
+				pr.Latency(0.99).Round(time.Microsecond))
+		}
+	}
+}
+
+// writeTrace saves a generated workload so the run can be repeated with -trace.
+func writeTrace(path, header string, jobs []sched.Job) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := sched.WriteJobs(f, header, jobs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeSVG saves the Gantt charts of results.
+func writeSVG(path string, results []sched.Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := sched.WriteSVG(f, results); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseInts parses a comma-separated list like "10,20,40"; empty means none.
+func parseInts(list string) ([]int, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var out []int
+	for _, f := range strings.Split(list, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
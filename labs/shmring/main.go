@@ -0,0 +1,218 @@
+//go:build unix
+
+// Shared-memory ring throughput
+// Maps a shmring in a temporary file and has N producer processes (this
+// program re-run with -shmring-producer) push -n messages of -size bytes
+// each into it while this process pops them, for every producer count
+// in -producers and way of waiting in -waits. One producer uses the SPSC
+// ring, more use MPSC. Every message carries its producer and sequence
+// number, and the consumer checks each producer's arrive complete and in
+// order. The table gives throughput and CPU time per message (producers
+// and consumer together): spinning waiters burn CPU while the ring is
+// full or empty, futex waiters sleep. -rate paces each producer, which
+// leaves the consumer mostly waiting, where the difference shows most.
+//
+//	go run ./cmd/shmring
+//	go run ./cmd/shmring -producers 1,2,8 -n 200000 -size 64
+//	go run ./cmd/shmring -producers 2 -rate 20000 -n 20000
+package shmring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/shmring"
+)
+
+var cmdline = labs.FlagSet("shmring")
+
+func Main(args []string) {
+	var (
+		producers = cmdline.String("producers", "1,4", "comma-separated producer process counts")
+		waits     = cmdline.String("waits", "spin,futex", "comma-separated ways to wait: spin | futex")
+		n         = cmdline.Int("n", 100000, "messages per producer")
+		size      = cmdline.Int("size", 32, "payload bytes per message")
+		slots     = cmdline.Int("slots", shmring.DefaultConfig.Slots, "ring slots")
+		rate      = cmdline.Float64("rate", 0, "messages per second per producer (0: as fast as possible)")
+
+		child = cmdline.Int("shmring-producer", -1, "internal: run as producer N")
+		ring  = cmdline.String("ring", "", "internal: the ring file")
+		wait  = cmdline.String("wait", "spin", "internal: the producer's way of waiting")
+	)
+	defer labs.ParseBench(cmdline, args)()
+	if *child >= 0 {
+		if err := produce(*ring, *wait, *child, *n, *size, *rate); err != nil {
+			fmt.Fprintf(os.Stderr, "producer %d: %v\n", *child, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	counts, err := ints(*producers)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "shmring: -producers:", err)
+		os.Exit(2)
+	}
+	var ws []shmring.Wait
+	for _, s := range strings.Split(*waits, ",") {
+		w, err := shmring.ParseWait(s)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		ws = append(ws, w)
+	}
+
+	fmt.Printf("%d messages of %d bytes per producer, %d slots", *n, *size, *slots)
+	if *rate > 0 {
+		fmt.Printf(", %.0f msgs/s each", *rate)
+	}
+	fmt.Printf("\n\n%9s %-5s %-6s %12s %10s %12s %6s\n", "producers", "mode", "wait", "msgs/s", "MB/s", "cpu/msg", "check")
+	for _, p := range counts {
+		for _, w := range ws {
+			if err := run(p, w, *n, *size, *slots, *rate); err != nil {
+				fmt.Fprintf(os.Stderr, "%d producers, %v: %v\n", p, w, err)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// run is one row: p producer processes into a ring waiting with w.
+func run(p int, w shmring.Wait, n, size, slots int, rate float64) error {
+	dir, err := os.MkdirTemp("", "shmring")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ring")
+	mode := shmring.SPSC
+	if p > 1 {
+		mode = shmring.MPSC
+	}
+	r, err := shmring.Create(path, shmring.Config{Slots: slots, SlotSize: 12 + size, Mode: mode, Wait: w})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	before := cpu()
+	began := time.Now()
+	procs := make([]*exec.Cmd, p)
+	for i := range procs {
+		procs[i] = labs.Command("-shmring-producer", strconv.Itoa(i), "-ring", path, "-wait", w.String(),
+			"-n", strconv.Itoa(n), "-size", strconv.Itoa(size), "-rate", strconv.FormatFloat(rate, 'g', -1, 64))
+		procs[i].Stderr = os.Stderr
+		if err := procs[i].Start(); err != nil {
+			return err
+		}
+	}
+	// Close the ring once every producer is done, so Pop ends
+	exited := make(chan error, 1)
+	go func() {
+		var first error
+		for _, c := range procs {
+			if err := c.Wait(); err != nil && first == nil {
+				first = err
+			}
+		}
+		r.CloseWrite()
+		exited <- first
+	}()
+
+	next := make([]uint64, p)
+	buf := make([]byte, 12+size)
+	got, bad := 0, 0
+	for {
+		m, err := r.Pop(buf)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		who, seq := binary.LittleEndian.Uint32(buf), binary.LittleEndian.Uint64(buf[4:])
+		if m != len(buf) || int(who) >= p || seq != next[who] {
+			bad++
+		} else {
+			next[who]++
+		}
+		got++
+	}
+	if err := <-exited; err != nil {
+		return err
+	}
+	elapsed := time.Since(began)
+	used := cpu() - before
+
+	check := "ok"
+	if bad > 0 || got != p*n {
+		check = fmt.Sprintf("%d/%d", got-bad, p*n)
+	}
+	fmt.Printf("%9d %-5v %-6v %12.0f %10.1f %12v %6s\n", p, mode, w, float64(got)/elapsed.Seconds(),
+		float64(got*size)/elapsed.Seconds()/1e6, (used / time.Duration(max(got, 1))).Round(time.Nanosecond), check)
+	return nil
+}
+
+// produce is a producer process: n messages, numbered, into the ring at
+// path.
+func produce(path, wait string, id, n, size int, rate float64) error {
+	w, err := shmring.ParseWait(wait)
+	if err != nil {
+		return err
+	}
+	r, err := shmring.OpenFile(path, w)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	buf := make([]byte, 12+size)
+	binary.LittleEndian.PutUint32(buf, uint32(id))
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if rate > 0 {
+			time.Sleep(time.Until(start.Add(time.Duration(float64(i) / rate * float64(time.Second)))))
+		}
+		binary.LittleEndian.PutUint64(buf[4:], uint64(i))
+		if err := r.Push(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cpu is the user and system time of this process and its waited-for
+// children so far.
+func cpu() time.Duration {
+	var total time.Duration
+	for _, who := range []int{syscall.RUSAGE_SELF, syscall.RUSAGE_CHILDREN} {
+		var ru syscall.Rusage
+		if syscall.Getrusage(who, &ru) == nil {
+			total += time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+		}
+	}
+	return total
+}
+
+// ints parses a comma-separated list of positive integers.
+func ints(s string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("bad count %q", f)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package shmring
+
+import (
+	"fmt"
+	"os"
+)
+
+// Main reports that the experiment needs mmap and separate processes.
+func Main(args []string) {
+	fmt.Fprintln(os.Stderr, "shmring: needs a unix system")
+	os.Exit(1)
+}
@@ -0,0 +1,163 @@
+// Process vs goroutine creation cost
+// HW1 compares moving data between processes and between goroutines; this
+// compares making them. Each round starts a batch of -batch workers at
+// once and waits for them all: for processes, fork/exec of this binary
+// as a child that exits at once (so the Go runtime's start-up counts,
+// as it would for HW1's consumer), and with -true of /bin/true as well,
+// a child with next to no start-up of its own; for goroutines, go and
+// a WaitGroup. Rounds repeat until -n processes (-gn goroutines) have
+// run per batch size. Each line reports the cost per worker, the round
+// times' p50 and p99, and getrusage deltas (this process plus the
+// children it reaped) per worker: CPU split, context switches.
+//
+//	go run ./cmd/spawnbench
+//	go run ./cmd/spawnbench -batches 1,4,16,64 -n 500 -true
+//	go run ./cmd/spawnbench -gn 1000000 -batches 1,100,10000
+package spawnbench
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/stats"
+)
+
+var cmdline = labs.FlagSet("spawnbench")
+
+// childArg makes the binary exit at once; it has to come before flag
+// parsing so the child does nothing else.
+const childArg = "-spawnbench-child"
+
+// result is one mode at one batch size.
+type result struct {
+	mode    string
+	batch   int
+	workers int
+	elapsed time.Duration
+	rounds  []time.Duration
+	usage   rusage
+}
+
+func Main(args []string) {
+	if len(args) > 0 && args[0] == childArg {
+		return
+	}
+	var (
+		batches = cmdline.String("batches", "1,10,100", "comma-separated batch sizes: workers started at once per round")
+		n       = cmdline.Int("n", 200, "processes per batch size")
+		gn      = cmdline.Int("gn", 100000, "goroutines per batch size")
+		withTru = cmdline.Bool("true", false, "also fork/exec /bin/true")
+	)
+	defer labs.ParseBench(cmdline, args)()
+	var sizes []int
+	for _, s := range strings.Split(*batches, ",") {
+		b, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || b < 1 {
+			fmt.Fprintf(os.Stderr, "spawnbench: bad batch size %q\n", s)
+			os.Exit(2)
+		}
+		sizes = append(sizes, b)
+	}
+	self := labs.Command(childArg)
+
+	var results []result
+	for _, b := range sizes {
+		r, err := measure("self-exec", b, *n, func() error { return processes(b, self.Path, self.Args[1:]...) })
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "spawnbench:", err)
+			os.Exit(1)
+		}
+		results = append(results, r)
+		if *withTru {
+			r, err := measure("/bin/true", b, *n, func() error { return processes(b, "/bin/true") })
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "spawnbench:", err)
+				os.Exit(1)
+			}
+			results = append(results, r)
+		}
+		r, _ = measure("goroutine", b, *gn, func() error { goroutines(b); return nil })
+		results = append(results, r)
+	}
+
+	fmt.Printf("%-10s %6s %8s %12s %12s %12s %11s %11s %9s %9s\n",
+		"mode", "batch", "workers", "per worker", "round p50", "round p99", "user/wkr", "sys/wkr", "vcsw/wkr", "icsw/wkr")
+	for _, r := range results {
+		w := time.Duration(r.workers)
+		fmt.Printf("%-10s %6d %8d %12v %12v %12v %11v %11v %9.2f %9.2f\n",
+			r.mode, r.batch, r.workers, (r.elapsed / w).Round(time.Nanosecond),
+			stats.Percentile(r.rounds, 0.50).Round(time.Nanosecond), stats.Percentile(r.rounds, 0.99).Round(time.Nanosecond),
+			(r.usage.user / w).Round(time.Nanosecond), (r.usage.sys / w).Round(time.Nanosecond),
+			float64(r.usage.nvcsw)/float64(r.workers), float64(r.usage.nivcsw)/float64(r.workers))
+	}
+	fmt.Println()
+	for _, b := range sizes {
+		var proc, gor time.Duration
+		for _, r := range results {
+			switch {
+			case r.batch == b && r.mode == "self-exec":
+				proc = r.elapsed / time.Duration(r.workers)
+			case r.batch == b && r.mode == "goroutine":
+				gor = r.elapsed / time.Duration(r.workers)
+			}
+		}
+		if gor > 0 {
+			fmt.Printf("batch %d: a process costs %.0fx a goroutine\n", b, float64(proc)/float64(gor))
+		}
+	}
+}
+
+// measure runs round, which starts and waits for batch workers, until
+// total workers have run, timing each round and the rusage of them all.
+func measure(mode string, batch, total int, round func() error) (result, error) {
+	r := result{mode: mode, batch: batch}
+	before := getUsage()
+	start := time.Now()
+	for r.workers < max(total, batch) {
+		t := time.Now()
+		if err := round(); err != nil {
+			return r, fmt.Errorf("%s: %w", mode, err)
+		}
+		r.rounds = append(r.rounds, time.Since(t))
+		r.workers += batch
+	}
+	r.elapsed = time.Since(start)
+	r.usage = getUsage().sub(before)
+	return r, nil
+}
+
+// processes starts b copies of path with args, then waits for each.
+func processes(b int, path string, args ...string) error {
+	cmds := make([]*exec.Cmd, b)
+	for i := range cmds {
+		cmds[i] = exec.Command(path, args...)
+		if err := cmds[i].Start(); err != nil {
+			for _, c := range cmds[:i] {
+				c.Wait()
+			}
+			return err
+		}
+	}
+	for _, c := range cmds {
+		if err := c.Wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// goroutines starts b goroutines that do nothing, then waits for them.
+func goroutines(b int) {
+	var wg sync.WaitGroup
+	wg.Add(b)
+	for i := 0; i < b; i++ {
+		go wg.Done()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,18 @@
+package spawnbench
+
+import "time"
+
+// rusage is the part of getrusage(2) the benchmark reports.
+type rusage struct {
+	user, sys     time.Duration
+	nvcsw, nivcsw int64 // voluntary / involuntary context switches
+}
+
+func (a rusage) sub(b rusage) rusage {
+	return rusage{
+		user:   a.user - b.user,
+		sys:    a.sys - b.sys,
+		nvcsw:  a.nvcsw - b.nvcsw,
+		nivcsw: a.nivcsw - b.nivcsw,
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package spawnbench
+
+// getUsage has no getrusage to read here; the usage columns stay zero.
+func getUsage() rusage { return rusage{} }
@@ -0,0 +1,25 @@
+//go:build unix
+
+package spawnbench
+
+import (
+	"syscall"
+	"time"
+)
+
+// getUsage adds up getrusage(2) for this process and for the children
+// it has reaped.
+func getUsage() rusage {
+	var u rusage
+	for _, who := range []int{syscall.RUSAGE_SELF, syscall.RUSAGE_CHILDREN} {
+		var ru syscall.Rusage
+		if err := syscall.Getrusage(who, &ru); err != nil {
+			continue
+		}
+		u.user += time.Duration(ru.Utime.Nano())
+		u.sys += time.Duration(ru.Stime.Nano())
+		u.nvcsw += int64(ru.Nvcsw)
+		u.nivcsw += int64(ru.Nivcsw)
+	}
+	return u
+}
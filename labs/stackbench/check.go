@@ -0,0 +1,313 @@
+// Correctness checks for the concurrent stacks (-check)
+// Two parts, both run against every stack in -s:
+//
+//   - Linearizability: many short rounds in which each goroutine does a few
+//     random pushes and pops while every operation's call and return are
+//     stamped from one shared counter. The recorded history must have a
+//     legal sequential LIFO order that respects real time (an operation that
+//     returned before another was called comes first). The search is Wing &
+//     Gong's, remembering dead ends, so rounds are kept to at most 64 ops.
+//   - Conservation: a -dur randomized workload of producers pushing unique
+//     values and consumers popping, then a single-threaded drain. Every value
+//     must come out exactly once, nothing may come out that wasn't pushed,
+//     and the drain must return each producer's leftovers newest first.
+
+package stackbench
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/HW0/Q2/stack"
+)
+
+// op is one completed stack operation in a recorded history.
+type op struct {
+	push     bool
+	val      int  // value pushed, or value popped
+	ok       bool // pop: false if it reported the stack empty
+	call, rt int64
+}
+
+func (o op) String() string {
+	switch {
+	case o.push:
+		return fmt.Sprintf("push(%d)@[%d,%d]", o.val, o.call, o.rt)
+	case o.ok:
+		return fmt.Sprintf("pop()=%d@[%d,%d]", o.val, o.call, o.rt)
+	default:
+		return fmt.Sprintf("pop()=empty@[%d,%d]", o.call, o.rt)
+	}
+}
+
+// linearizable reports whether history (at most 64 ops, unique push values)
+// has a sequential LIFO order consistent with its call/return times.
+func linearizable(history []op) bool {
+	ops := slices.Clone(history)
+	slices.SortFunc(ops, func(a, b op) int { return int(a.call - b.call) })
+	all := uint64(1)<<len(ops) - 1
+	if len(ops) == 64 {
+		all = ^uint64(0)
+	}
+	dead := map[string]bool{} // done-set + stack contents already known to fail
+
+	var stk []int
+	var search func(done uint64) bool
+	search = func(done uint64) bool {
+		if done == all {
+			return true
+		}
+		key := strconv.FormatUint(done, 16) + ":" + fmt.Sprint(stk)
+		if dead[key] {
+			return false
+		}
+		// Anything called before the earliest pending return may go next
+		horizon := int64(1<<63 - 1)
+		for i, o := range ops {
+			if done&(1<<i) == 0 {
+				horizon = min(horizon, o.rt)
+			}
+		}
+		for i, o := range ops {
+			if done&(1<<i) != 0 || o.call > horizon {
+				continue
+			}
+			switch {
+			case o.push:
+				stk = append(stk, o.val)
+				if search(done | 1<<i) {
+					return true
+				}
+				stk = stk[:len(stk)-1]
+			case !o.ok:
+				if len(stk) == 0 && search(done|1<<i) {
+					return true
+				}
+			default:
+				if n := len(stk); n > 0 && stk[n-1] == o.val {
+					stk = stk[:n-1]
+					if search(done | 1<<i) {
+						return true
+					}
+					stk = append(stk, o.val)
+				}
+			}
+		}
+		dead[key] = true
+		return false
+	}
+	return search(0)
+}
+
+// recordRound runs workers goroutines doing opsEach random operations on s
+// and returns the combined history.
+func recordRound(s stack.Concurrent, workers, opsEach int, round int) []op {
+	var clock atomic.Int64
+	histories := make([][]op, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(w)*1337))
+			for i := 0; i < opsEach; i++ {
+				o := op{push: r.Intn(2) == 0}
+				if o.push {
+					o.val = (round*workers+w)*opsEach + i + 1 // unique within the round
+				}
+				o.call = clock.Add(1)
+				if o.push {
+					_ = s.Push(o.val)
+				} else {
+					v, err := s.Pop()
+					o.val, o.ok = v, err == nil
+				}
+				o.rt = clock.Add(1)
+				histories[w] = append(histories[w], o)
+				if r.Intn(2) == 0 {
+					runtime.Gosched() // shake up the interleaving
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return slices.Concat(histories...)
+}
+
+// checkLinearizable runs rounds of recorded workloads against fresh stacks.
+func checkLinearizable(kind string, workers, opsEach, rounds int) error {
+	if workers*opsEach > 64 {
+		return fmt.Errorf("%d workers x %d ops is more than the 64 ops a round can check", workers, opsEach)
+	}
+	for round := 0; round < rounds; round++ {
+		s, err := newStack(kind)
+		if err != nil {
+			return err
+		}
+		h := recordRound(s, workers, opsEach, round)
+		if !linearizable(h) {
+			return fmt.Errorf("round %d: history is not linearizable: %v", round+1, h)
+		}
+	}
+	return nil
+}
+
+// checkConservation runs a timed producer/consumer workload with unique
+// values, drains what is left, and checks that every value came out once.
+func checkConservation(kind string, pc pcPair, duration time.Duration) (pushed, popped, drained int, err error) {
+	s, err := newStack(kind)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	stop := make(chan struct{})
+	pushes := make([]int, pc.p) // values pushed per producer: id + p*k for k < count
+	pops := make([][]int, pc.c) // values popped per consumer
+	var wg sync.WaitGroup
+	for p := 0; p < pc.p; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; ; k++ {
+				select {
+				case <-stop:
+					pushes[p] = k
+					return
+				default:
+				}
+				if err := s.Push(p + pc.p*k); err != nil {
+					pushes[p] = k
+					return
+				}
+			}
+		}()
+	}
+	for c := 0; c < pc.c; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if v, err := s.Pop(); err == nil {
+					pops[c] = append(pops[c], v)
+				} else {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+	time.Sleep(duration)
+	close(stop)
+	wg.Wait()
+
+	total := 0
+	for _, k := range pushes {
+		total += k
+	}
+	seen := make([]bool, pc.p*(slices.Max(pushes)+1)) // indexed by value
+	count := 0
+	take := func(v int, where string) error {
+		p, k := v%pc.p, v/pc.p
+		if v < 0 || k >= pushes[p] {
+			return fmt.Errorf("%s returned %d, which was never pushed", where, v)
+		}
+		if seen[v] {
+			return fmt.Errorf("%s returned %d a second time", where, v)
+		}
+		seen[v] = true
+		count++
+		return nil
+	}
+	for c, vs := range pops {
+		for _, v := range vs {
+			if err := take(v, fmt.Sprintf("consumer %d", c+1)); err != nil {
+				return total, count, 0, err
+			}
+		}
+	}
+	popped = count
+
+	// Single-threaded drain: each producer's leftovers must come out newest first
+	last := make([]int, pc.p)
+	for p := range last {
+		last[p] = -1
+	}
+	for {
+		v, err := s.Pop()
+		if err != nil {
+			break
+		}
+		if err := take(v, "drain"); err != nil {
+			return total, popped, drained, err
+		}
+		p := v % pc.p
+		if last[p] >= 0 && v > last[p] {
+			return total, popped, drained, fmt.Errorf("drain returned %d after %d from producer %d (not LIFO)", v, last[p], p+1)
+		}
+		last[p] = v
+		drained++
+	}
+	if count != total {
+		return total, popped, drained, fmt.Errorf("%d values pushed but %d came back out", total, count)
+	}
+	return total, popped, drained, nil
+}
+
+// runChecks checks every stack at every producer/consumer count and reports
+// whether all of them passed.
+func runChecks(kinds []string, counts []pcPair, rounds, opsEach int, duration time.Duration) bool {
+	// The checker itself must reject a history that isn't LIFO
+	bad := []op{{push: true, val: 1, call: 1, rt: 2}, {push: true, val: 2, call: 3, rt: 4}, {val: 1, ok: true, call: 5, rt: 6}}
+	if linearizable(bad) {
+		fmt.Println("checker self-test FAILED: accepted pop()=1 right after push(1), push(2)")
+		return false
+	}
+
+	passed := true
+	for _, pc := range counts {
+		for _, kind := range kinds {
+			if !checkStack(kind, pc, rounds, opsEach, duration) {
+				passed = false
+			}
+		}
+	}
+	fmt.Println(strings.Repeat("-", 40))
+	if passed {
+		fmt.Println("all checks passed")
+	} else {
+		fmt.Println("some checks FAILED")
+	}
+	return passed
+}
+
+// checkStack runs both checks on one stack at one producer/consumer count.
+func checkStack(kind string, pc pcPair, rounds, opsEach int, duration time.Duration) bool {
+	workers := pc.p + pc.c
+	passed := true
+	fmt.Printf("Stack: %s | P=%d C=%d\n", kind, pc.p, pc.c)
+	start := time.Now()
+	if err := checkLinearizable(kind, workers, opsEach, rounds); err != nil {
+		fmt.Printf("  linearizability: FAILED: %v\n", err)
+		passed = false
+	} else {
+		fmt.Printf("  linearizability: ok (%d rounds, %d goroutines x %d ops, %v)\n", rounds, workers, opsEach, time.Since(start).Round(time.Millisecond))
+	}
+	pushed, popped, drained, err := checkConservation(kind, pc, duration)
+	if err != nil {
+		fmt.Printf("  conservation: FAILED: %v\n", err)
+		passed = false
+	} else {
+		fmt.Printf("  conservation: ok (%d pushed = %d popped + %d drained)\n", pushed, popped, drained)
+	}
+	return passed
+}
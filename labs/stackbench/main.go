@@ -0,0 +1,302 @@
+// Stack benchmark: mutex-protected stack vs Treiber lock-free stack
+// Same harness as the HW4 queue benchmark: producers push, consumers pop,
+// for a fixed duration after a warmup. Runs every stack at every
+// producer/consumer count in -pc and reports ops/sec plus, for the Treiber
+// stack, how many CAS attempts failed and had to retry. -check runs the
+// correctness checks in check.go instead.
+//
+//	go run ./HW0/Q2/stackbench -pc 1x1,4x1,1x4,4x4,8x8 -dur 2s
+//	go run ./HW0/Q2/stackbench -check -pc 1x1,2x2,4x4 -dur 500ms
+package stackbench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/HW0/Q2/stack"
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("stackbench")
+
+type Counter struct {
+	PushOK   uint64
+	PopOK    uint64
+	PopEmpty uint64
+}
+
+func (c *Counter) add(other Counter) {
+	atomic.AddUint64(&c.PushOK, other.PushOK)
+	atomic.AddUint64(&c.PopOK, other.PopOK)
+	atomic.AddUint64(&c.PopEmpty, other.PopEmpty)
+}
+
+func busyWork(nanos int) {
+	if nanos <= 0 {
+		return
+	}
+	start := time.Now()
+	x := uint64(1469598103934665603) // simple mix
+	for time.Since(start) < time.Duration(nanos)*time.Nanosecond {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+	}
+	_ = x
+}
+
+func runProducers(ctx context.Context, wg *sync.WaitGroup, s stack.Concurrent, id int, c *Counter, workNS int) {
+	defer wg.Done()
+	r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)*1337))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			if s.Push(int(r.Uint32())) == nil {
+				atomic.AddUint64(&c.PushOK, 1)
+			}
+			busyWork(workNS)
+		}
+	}
+}
+
+func runConsumers(ctx context.Context, wg *sync.WaitGroup, s stack.Concurrent, id int, c *Counter, workNS int) {
+	defer wg.Done()
+	spin := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			if _, err := s.Pop(); err == nil {
+				atomic.AddUint64(&c.PopOK, 1)
+				busyWork(workNS)
+				spin = 0
+			} else {
+				atomic.AddUint64(&c.PopEmpty, 1)
+				// light backoff to avoid burning CPU when empty
+				spin++
+				if spin < 50 {
+					runtime.Gosched()
+				} else {
+					time.Sleep(time.Microsecond)
+					if spin > 1000 {
+						spin = 0
+					}
+				}
+			}
+		}
+	}
+}
+
+func human(n uint64, dur time.Duration) string {
+	opsPerSec := float64(n) / dur.Seconds()
+	switch {
+	case opsPerSec > 1e9:
+		return fmt.Sprintf("%.2f Gops/s", opsPerSec/1e9)
+	case opsPerSec > 1e6:
+		return fmt.Sprintf("%.2f Mops/s", opsPerSec/1e6)
+	case opsPerSec > 1e3:
+		return fmt.Sprintf("%.2f Kops/s", opsPerSec/1e3)
+	default:
+		return fmt.Sprintf("%.2f ops/s", opsPerSec)
+	}
+}
+
+// newStack builds the named stack.
+func newStack(kind string) (stack.Concurrent, error) {
+	switch kind {
+	case "lock":
+		return stack.NewLocked(), nil
+	case "treiber":
+		return stack.NewTreiber(), nil
+	default:
+		return nil, fmt.Errorf("unknown stack type %q (use lock or treiber)", kind)
+	}
+}
+
+// retries reports the stack's failed CAS count, if it has one.
+func retries(s stack.Concurrent) (uint64, bool) {
+	if t, ok := s.(interface{ Retries() uint64 }); ok {
+		return t.Retries(), true
+	}
+	return 0, false
+}
+
+// pcPair is one producer/consumer count to benchmark.
+type pcPair struct{ p, c int }
+
+// parsePairs parses a list like "1x1,4x1,1x4".
+func parsePairs(list string) ([]pcPair, error) {
+	var out []pcPair
+	for _, f := range strings.Split(list, ",") {
+		ps, cs, ok := strings.Cut(strings.TrimSpace(f), "x")
+		p, err1 := strconv.Atoi(ps)
+		c, err2 := strconv.Atoi(cs)
+		if !ok || err1 != nil || err2 != nil || p < 1 || c < 1 {
+			return nil, fmt.Errorf("bad producer/consumer pair %q (want PxC, e.g. 4x2)", f)
+		}
+		out = append(out, pcPair{p, c})
+	}
+	return out, nil
+}
+
+// outcome is one benchmark run's totals.
+type outcome struct {
+	agg        Counter
+	retries    uint64
+	hasRetries bool
+}
+
+// bench runs one stack at one producer/consumer count.
+func bench(kind string, pc pcPair, duration, warmup time.Duration, workNS int) (outcome, error) {
+	s, err := newStack(kind)
+	if err != nil {
+		return outcome{}, err
+	}
+
+	// Seed with some items so consumers don’t start on an empty stack
+	for i := 0; i < pc.c; i++ {
+		_ = s.Push(i)
+	}
+
+	var total Counter
+	var wg sync.WaitGroup
+
+	// Warmup
+	ctxW, cancelW := context.WithTimeout(context.Background(), warmup)
+	for i := 0; i < pc.p; i++ {
+		wg.Add(1)
+		go runProducers(ctxW, &wg, s, i, &total, 0)
+	}
+	for i := 0; i < pc.c; i++ {
+		wg.Add(1)
+		go runConsumers(ctxW, &wg, s, i, &total, 0)
+	}
+	wg.Wait()
+	cancelW()
+
+	// Main run
+	base, _ := retries(s)
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	wg = sync.WaitGroup{}
+	counters := make([]Counter, pc.p+pc.c)
+	for i := 0; i < pc.p; i++ {
+		wg.Add(1)
+		go runProducers(ctx, &wg, s, i, &counters[i], workNS)
+	}
+	for i := 0; i < pc.c; i++ {
+		wg.Add(1)
+		go runConsumers(ctx, &wg, s, i, &counters[pc.p+i], workNS)
+	}
+	wg.Wait()
+
+	// Aggregate
+	var out outcome
+	for i := range counters {
+		out.agg.add(counters[i])
+	}
+	if r, ok := retries(s); ok {
+		out.retries, out.hasRetries = r-base, true
+	}
+	return out, nil
+}
+
+func Main(args []string) {
+	var (
+		stackType  = cmdline.String("s", "lock,treiber", "comma-separated stack types: lock | treiber")
+		producers  = cmdline.Int("producers", 4, "number of producer goroutines (when -pc is empty)")
+		consumers  = cmdline.Int("consumers", 4, "number of consumer goroutines (when -pc is empty)")
+		pairs      = cmdline.String("pc", "", "comma-separated producer x consumer counts to sweep, e.g. 1x1,4x1,1x4,4x4")
+		duration   = cmdline.Duration("dur", 2*time.Second, "benchmark duration per run")
+		workNS     = cmdline.Int("work", 0, "synthetic CPU nanos per successful op (simulate app work)")
+		gomaxprocs = cmdline.Int("gomaxprocs", 0, "if >0, sets GOMAXPROCS")
+		warmup     = cmdline.Duration("warmup", 500*time.Millisecond, "warmup time per run")
+		check      = cmdline.Bool("check", false, "check linearizability and element conservation instead of benchmarking")
+		rounds     = cmdline.Int("rounds", 2000, "-check: recorded rounds per stack for the linearizability check")
+		opsEach    = cmdline.Int("ops", 6, "-check: operations per goroutine in each recorded round")
+	)
+	defer labs.ParseBench(cmdline, args)()
+
+	if *gomaxprocs > 0 {
+		runtime.GOMAXPROCS(*gomaxprocs)
+	}
+
+	// Reduce GC interference variance a bit
+	debug.SetGCPercent(100)
+
+	counts := []pcPair{{max(*producers, 1), max(*consumers, 1)}}
+	if *pairs != "" {
+		var err error
+		if counts, err = parsePairs(*pairs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	kinds := strings.Split(*stackType, ",")
+
+	if *check {
+		if !runChecks(kinds, counts, *rounds, max(*opsEach, 1), *duration) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	type row struct {
+		kind string
+		pc   pcPair
+		out  outcome
+	}
+	var rows []row
+	for _, pc := range counts {
+		for _, kind := range kinds {
+			out, err := bench(kind, pc, *duration, *warmup, *workNS)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			rows = append(rows, row{kind, pc, out})
+
+			agg := out.agg
+			fmt.Printf("Stack: %s | P=%d C=%d | dur=%s | work/op=%dns\n", kind, pc.p, pc.c, *duration, *workNS)
+			fmt.Printf("Push   : %d  (%s)\n", agg.PushOK, human(agg.PushOK, *duration))
+			fmt.Printf("Pop    : %d  (%s)\n", agg.PopOK, human(agg.PopOK, *duration))
+			fmt.Printf("Empty  : %d  (pop attempts when empty)\n", agg.PopEmpty)
+			if out.hasRetries {
+				fmt.Printf("Retries: %d  (%.3f failed CAS per op)\n", out.retries, perOp(out.retries, agg.PushOK+agg.PopOK))
+			}
+			fmt.Println()
+		}
+	}
+
+	// Side-by-side summary
+	fmt.Printf("%-8s %-4s %-4s %14s %14s %12s\n", "stack", "P", "C", "push", "pop", "retries/op")
+	for _, r := range rows {
+		retry := "-"
+		if r.out.hasRetries {
+			retry = fmt.Sprintf("%.3f", perOp(r.out.retries, r.out.agg.PushOK+r.out.agg.PopOK))
+		}
+		fmt.Printf("%-8s %-4d %-4d %14s %14s %12s\n", r.kind, r.pc.p, r.pc.c,
+			human(r.out.agg.PushOK, *duration), human(r.out.agg.PopOK, *duration), retry)
+	}
+}
+
+// perOp is n per operation, or 0 if nothing completed.
+func perOp(n, ops uint64) float64 {
+	if ops == 0 {
+		return 0
+	}
+	return float64(n) / float64(ops)
+}
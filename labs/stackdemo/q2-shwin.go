@@ -0,0 +1,39 @@
+package stackdemo
+
+import (
+	"fmt" //library
+
+	"example.com/operating-systems/HW0/Q2/stack"
+)
+
+// Demo of the stack package: Push and Pop report overflow / underflow as
+// errors instead of printing them and returning a sentinel value.
+func Main(args []string) {
+	s := stack.New()
+
+	for _, v := range []int{10, 20, 30} {
+		if err := s.Push(v); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		val, err := s.Pop() // 30, 20, 10, then underflow
+		if err != nil {
+			fmt.Println("Error:", err)
+			continue
+		}
+		fmt.Println("Popped:", val)
+	}
+
+	// A bounded stack behaves like the original fixed array of 100
+	b := stack.NewBounded(100)
+	pushed := 0
+	for i := 0; i < 101; i++ {
+		if err := b.Push(i); err != nil {
+			fmt.Printf("Error after %d pushes: %v\n", pushed, err)
+			break
+		}
+		pushed++
+	}
+}
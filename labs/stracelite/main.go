@@ -0,0 +1,132 @@
+// strace-lite, a syscall counter
+// Runs a command under ptrace(2), following every thread and child it
+// forks, and reports what strace -c -w does: for each syscall, how many
+// calls, how many failed, and the wall-clock time from entry to return,
+// sorted by total time. That time is measured by the tracer between the
+// entry and exit stops, so it includes the stops' own cost; compare
+// syscalls against each other, not against an untraced run.
+//
+// Pointed at HW1's process mode, it shows where the time goes: the
+// parent's write/read pairs per message and window, the consumer's
+// fork+execve, the futex and nanosleep of the Go runtime underneath.
+// Linux only (amd64, arm64).
+//
+//	go run ./cmd/strace-lite -- ls -l
+//	go build -o /tmp/hw1 ./HW1/Q2 && go run ./cmd/strace-lite -- /tmp/hw1 --mode process -n 10000 --quiet
+//	go run ./cmd/strace-lite -sort calls -top 10 -- /tmp/hw1 --mode goroutine -n 10000 --quiet
+package stracelite
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("strace-lite")
+
+// count is one syscall's totals.
+type count struct {
+	name   string
+	calls  int
+	errors int
+	time   time.Duration
+}
+
+// report is what a traced run did.
+type report struct {
+	counts    map[string]*count
+	processes int // the command and every process it forked
+	threads   int // threads beyond each process's first
+	status    int // the command's exit status
+	elapsed   time.Duration
+}
+
+func Main(args []string) {
+	by := cmdline.String("sort", "time", "order syscalls by time | calls | errors | name")
+	top := cmdline.Int("top", 0, "print only the first n syscalls; 0 for all")
+	cmdline.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: strace-lite [flags] [--] command [args...]\n")
+		cmdline.PrintDefaults()
+	}
+	cmdline.Parse(args)
+	if cmdline.NArg() == 0 {
+		cmdline.Usage()
+		os.Exit(2)
+	}
+	switch *by {
+	case "time", "calls", "errors", "name":
+	default:
+		fmt.Fprintf(os.Stderr, "strace-lite: unknown sort %q (time, calls, errors, name)\n", *by)
+		os.Exit(2)
+	}
+
+	r, err := trace(cmdline.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "strace-lite:", err)
+		os.Exit(1)
+	}
+	printReport(r, *by, *top)
+	os.Exit(r.status)
+}
+
+// printReport writes the table to stderr, where it doesn't mix with the
+// command's own output.
+func printReport(r report, by string, top int) {
+	cs := make([]*count, 0, len(r.counts))
+	var total count
+	for _, c := range r.counts {
+		cs = append(cs, c)
+		total.calls += c.calls
+		total.errors += c.errors
+		total.time += c.time
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		a, b := cs[i], cs[j]
+		switch by {
+		case "calls":
+			if a.calls != b.calls {
+				return a.calls > b.calls
+			}
+		case "errors":
+			if a.errors != b.errors {
+				return a.errors > b.errors
+			}
+		case "time":
+			if a.time != b.time {
+				return a.time > b.time
+			}
+		}
+		return a.name < b.name
+	})
+	if top > 0 && top < len(cs) {
+		cs = cs[:top]
+	}
+	w := os.Stderr
+	fmt.Fprintf(w, "\n%6s %12s %11s %9s %9s  %s\n", "% time", "seconds", "usecs/call", "calls", "errors", "syscall")
+	fmt.Fprintf(w, "%6s %12s %11s %9s %9s  %s\n", "------", "-----------", "-----------", "---------", "---------", "----------------")
+	row := func(c *count) {
+		pct := 0.0
+		if total.time > 0 {
+			pct = 100 * c.time.Seconds() / total.time.Seconds()
+		}
+		per := int64(0)
+		if c.calls > 0 {
+			per = c.time.Microseconds() / int64(c.calls)
+		}
+		errs := ""
+		if c.errors > 0 {
+			errs = fmt.Sprint(c.errors)
+		}
+		fmt.Fprintf(w, "%6.2f %12.6f %11d %9d %9s  %s\n", pct, c.time.Seconds(), per, c.calls, errs, c.name)
+	}
+	for _, c := range cs {
+		row(c)
+	}
+	fmt.Fprintf(w, "%6s %12s %11s %9s %9s  %s\n", "------", "-----------", "-----------", "---------", "---------", "----------------")
+	total.name = "total"
+	row(&total)
+	fmt.Fprintf(w, "%d processes, %d more threads, exit status %d, %v\n", r.processes, r.threads, r.status, r.elapsed.Round(time.Millisecond))
+}
@@ -0,0 +1,28 @@
+package stracelite
+
+import "syscall"
+
+// On arm64 the syscall number is in x8 and the return value in x0.
+func syscallNr(r *syscall.PtraceRegs) int  { return int(int64(r.Regs[8])) }
+func syscallRet(r *syscall.PtraceRegs) int { return int(int64(r.Regs[0])) }
+
+// syscallNames is the part of the generic syscall table
+// (include/uapi/asm-generic/unistd.h) that programs commonly make.
+var syscallNames = [...]string{
+	17: "getcwd", 19: "eventfd2", 20: "epoll_create1", 21: "epoll_ctl", 22: "epoll_pwait", 23: "dup", 24: "dup3", 25: "fcntl",
+	29: "ioctl", 32: "flock", 33: "mknodat", 34: "mkdirat", 35: "unlinkat", 36: "symlinkat", 37: "linkat", 38: "renameat",
+	43: "statfs", 44: "fstatfs", 45: "truncate", 46: "ftruncate", 47: "fallocate", 48: "faccessat", 49: "chdir", 50: "fchdir",
+	51: "chroot", 52: "fchmod", 53: "fchmodat", 54: "fchownat", 55: "fchown", 56: "openat", 57: "close", 59: "pipe2",
+	61: "getdents64", 62: "lseek", 63: "read", 64: "write", 65: "readv", 66: "writev", 67: "pread64", 68: "pwrite64",
+	71: "sendfile", 72: "pselect6", 73: "ppoll", 76: "splice", 77: "tee", 78: "readlinkat", 79: "newfstatat", 80: "fstat",
+	81: "sync", 82: "fsync", 83: "fdatasync", 88: "utimensat", 93: "exit", 94: "exit_group", 95: "waitid", 96: "set_tid_address",
+	98: "futex", 99: "set_robust_list", 101: "nanosleep", 113: "clock_gettime", 115: "clock_nanosleep", 124: "sched_yield",
+	129: "kill", 130: "tkill", 131: "tgkill", 132: "sigaltstack", 134: "rt_sigaction", 135: "rt_sigprocmask", 139: "rt_sigreturn",
+	160: "uname", 163: "getrlimit", 165: "getrusage", 167: "prctl", 172: "getpid", 173: "getppid", 174: "getuid", 175: "geteuid",
+	176: "getgid", 177: "getegid", 178: "gettid", 198: "socket", 199: "socketpair", 200: "bind", 201: "listen", 202: "accept",
+	203: "connect", 204: "getsockname", 205: "getpeername", 206: "sendto", 207: "recvfrom", 208: "setsockopt", 209: "getsockopt",
+	210: "shutdown", 211: "sendmsg", 212: "recvmsg", 214: "brk", 215: "munmap", 216: "mremap", 220: "clone", 221: "execve",
+	222: "mmap", 226: "mprotect", 233: "madvise", 242: "accept4", 260: "wait4", 261: "prlimit64", 278: "getrandom",
+	279: "memfd_create", 291: "statx", 293: "rseq", 434: "pidfd_open", 435: "clone3", 436: "close_range", 437: "openat2",
+	439: "faccessat2",
+}
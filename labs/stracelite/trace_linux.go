@@ -0,0 +1,147 @@
+//go:build linux && (amd64 || arm64)
+
+package stracelite
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// tracee is a traced thread.
+type tracee struct {
+	inSyscall bool
+	nr        int // the syscall it's in
+	entered   time.Time
+}
+
+// trace runs args[0] under ptrace until it and everything it started
+// have exited. ptrace requests must all come from the thread that
+// attached, so the goroutine stays locked to it.
+func trace(args []string) (report, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Ptrace: true}
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return report{}, err
+	}
+	pid := cmd.Process.Pid
+
+	// The child stops with SIGTRAP once it has exec'd the command.
+	var ws syscall.WaitStatus
+	if _, err := syscall.Wait4(pid, &ws, 0, nil); err != nil {
+		return report{}, err
+	}
+	if !ws.Stopped() {
+		return report{}, fmt.Errorf("%s didn't stop for tracing: %v", args[0], ws)
+	}
+	opts := syscall.PTRACE_O_TRACESYSGOOD | syscall.PTRACE_O_TRACECLONE | syscall.PTRACE_O_TRACEFORK |
+		syscall.PTRACE_O_TRACEVFORK | syscall.PTRACE_O_TRACEEXEC
+	if err := syscall.PtraceSetOptions(pid, opts); err != nil {
+		cmd.Process.Kill()
+		return report{}, fmt.Errorf("ptrace: %w", err)
+	}
+
+	r := report{counts: map[string]*count{}, processes: 1}
+	threads := map[int]*tracee{pid: {}}
+	if err := syscall.PtraceSyscall(pid, 0); err != nil {
+		return report{}, fmt.Errorf("ptrace: %w", err)
+	}
+	for len(threads) > 0 {
+		tid, err := syscall.Wait4(-1, &ws, syscall.WALL, nil)
+		if err != nil {
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			if errors.Is(err, syscall.ECHILD) {
+				break
+			}
+			return report{}, err
+		}
+		if ws.Exited() || ws.Signaled() {
+			delete(threads, tid)
+			if tid == pid {
+				r.status = ws.ExitStatus()
+				if ws.Signaled() {
+					r.status = 128 + int(ws.Signal())
+				}
+			}
+			continue
+		}
+		if !ws.Stopped() {
+			continue
+		}
+		t, seen := threads[tid]
+		if !seen {
+			// A new thread or child, auto-attached by the clone/fork
+			// options; its first stop is a SIGSTOP we swallow.
+			t = &tracee{}
+			threads[tid] = t
+		}
+		inject := 0
+		switch sig := ws.StopSignal(); {
+		case sig == syscall.SIGTRAP|0x80: // a syscall stop, TRACESYSGOOD marks them
+			if !t.inSyscall {
+				if regs, err := getRegs(tid); err == nil {
+					t.nr = syscallNr(regs)
+				}
+				t.inSyscall, t.entered = true, time.Now()
+				break
+			}
+			t.inSyscall = false
+			c := r.counts[syscallName(t.nr)]
+			if c == nil {
+				c = &count{name: syscallName(t.nr)}
+				r.counts[c.name] = c
+			}
+			c.calls++
+			c.time += time.Since(t.entered)
+			if regs, err := getRegs(tid); err == nil {
+				if ret := syscallRet(regs); ret < 0 && ret >= -4095 {
+					c.errors++
+				}
+			}
+		case sig == syscall.SIGTRAP && ws.TrapCause() > 0: // a ptrace event
+			switch ws.TrapCause() {
+			case syscall.PTRACE_EVENT_FORK, syscall.PTRACE_EVENT_VFORK:
+				r.processes++
+			case syscall.PTRACE_EVENT_CLONE:
+				r.threads++
+			}
+		case sig == syscall.SIGSTOP && !seen:
+		default:
+			inject = int(sig) // a real signal: pass it on
+		}
+		if err := syscall.PtraceSyscall(tid, inject); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return report{}, fmt.Errorf("ptrace: %w", err)
+		}
+	}
+	r.elapsed = time.Since(start)
+	// Make the exec.Cmd let go of the process; it has already been reaped.
+	cmd.Process.Release()
+	return r, nil
+}
+
+func getRegs(tid int) (*syscall.PtraceRegs, error) {
+	var regs syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(tid, &regs); err != nil {
+		return nil, err
+	}
+	return &regs, nil
+}
+
+// syscallName names syscall nr, or numbers it if it's not in the table.
+func syscallName(nr int) string {
+	if nr >= 0 && nr < len(syscallNames) && syscallNames[nr] != "" {
+		return syscallNames[nr]
+	}
+	return fmt.Sprintf("syscall_%d", nr)
+}
@@ -0,0 +1,14 @@
+//go:build !linux || !(amd64 || arm64)
+
+package stracelite
+
+import (
+	"errors"
+	"runtime"
+)
+
+// trace needs ptrace and a syscall table, which only linux/amd64 and
+// linux/arm64 have here.
+func trace([]string) (report, error) {
+	return report{}, errors.New("tracing needs linux/amd64 or linux/arm64, not " + runtime.GOOS + "/" + runtime.GOARCH)
+}
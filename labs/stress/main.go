@@ -0,0 +1,166 @@
+// Stress test
+// Runs randomized concurrent workloads against every concurrent structure
+// in the repository for -d each, then checks what they did: the queues
+// (package queue), HW3's lists (package clist), the stacks (HW0/Q2/stack),
+// HW8's mutex, channel and ring loggers, and HW7's RAID levels. Every goroutine
+// mixes operations at random and makes values no one else makes, so at
+// the end each value must come out exactly once (a queue or stack
+// drained, a list walked, a log file read back, a block read), and each
+// structure's own invariants must hold: a queue hands out each
+// producer's values in order, a list holds every key inserted, a log has
+// no torn lines and keeps each goroutine's entries in order, and a RAID's
+// mirrors agree and its parity is the XOR of its stripes. Run it under the
+// race detector to check the synchronization as well; the exit status is
+// 1 if any structure failed. A structure's "ok" is only about its checks:
+// under -race a data race is reported where it happens, however the
+// checks turn out, and the process exits with status 66 (1 if a check
+// failed too), so it is the exit status that says whether the run passed.
+//
+// HW8's naive logger is unsynchronized on purpose, so it runs only when
+// named: it tears lines.
+//
+//	go run -race ./cmd/stress
+//	go run -race ./cmd/stress -d 10s -goroutines 16 -structures queue-ms,raid5
+//	go run ./cmd/stress -structures logger-naive
+package stress
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/labs"
+)
+
+var cmdline = labs.FlagSet("stress")
+
+// config is what every workload runs with.
+type config struct {
+	goroutines int
+	duration   time.Duration
+	seed       int64
+	dir        string // for files: logs and disks
+}
+
+// rngs returns a random source for each worker.
+func (c config) rngs() []*rand.Rand {
+	rs := make([]*rand.Rand, c.goroutines)
+	for w := range rs {
+		rs[w] = rand.New(rand.NewSource(c.seed + int64(w)*7919))
+	}
+	return rs
+}
+
+// target is one structure to stress: run runs the workload, checks it,
+// and returns how many operations it did.
+type target struct {
+	name  string
+	safe  bool // run by default
+	about string
+	run   func(c config) (ops int64, err error)
+}
+
+var targets = []target{
+	{"queue-lock", true, "two-lock queue", queueWorkload("lock")},
+	{"queue-ms", true, "Michael-Scott queue", queueWorkload("ms")},
+	{"queue-ms-hp", true, "Michael-Scott queue, hazard pointers", queueWorkload("ms-hp")},
+	{"list-coarse", true, "coarse-grained list", listWorkload("coarse")},
+	{"list-hoh", true, "hand-over-hand list", listWorkload("hoh")},
+	{"stack-locked", true, "mutex stack", stackWorkload("locked")},
+	{"stack-treiber", true, "Treiber stack", stackWorkload("treiber")},
+	{"stack-treiber-hp", true, "Treiber stack, hazard pointers", stackWorkload("treiber-hp")},
+	{"logger-mutex", true, "HW8 mutex logger", loggerWorkload("mutex")},
+	{"logger-channel", true, "HW8 channel logger", loggerWorkload("channel")},
+	{"logger-ring", true, "HW8 lock-free ring logger", loggerWorkload("ring")},
+	{"logger-naive", false, "HW8 naive logger (unsynchronized)", loggerWorkload("naive")},
+	{"raid0", true, "HW7 RAID 0", raidWorkload(0)},
+	{"raid1", true, "HW7 RAID 1", raidWorkload(1)},
+	{"raid4", true, "HW7 RAID 4", raidWorkload(4)},
+	{"raid5", true, "HW7 RAID 5", raidWorkload(5)},
+}
+
+func Main(args []string) {
+	var (
+		structures = cmdline.String("structures", "", "comma-separated structures to stress (default: every synchronized one; see -list)")
+		goroutines = cmdline.Int("goroutines", 8, "goroutines per structure")
+		duration   = cmdline.Duration("d", 2*time.Second, "how long to stress each structure")
+		seed       = cmdline.Int64("seed", time.Now().UnixNano(), "random seed")
+		list       = cmdline.Bool("list", false, "list the structures and exit")
+	)
+	cmdline.Parse(args)
+	if *list {
+		for _, t := range targets {
+			note := ""
+			if !t.safe {
+				note = " (only when named)"
+			}
+			fmt.Printf("%-18s %s%s\n", t.name, t.about, note)
+		}
+		return
+	}
+	if *goroutines < 1 {
+		fmt.Fprintln(os.Stderr, "stress: -goroutines must be at least 1")
+		os.Exit(2)
+	}
+	run, err := pick(*structures)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	dir, err := os.MkdirTemp("", "stress")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "stress:", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(dir)
+
+	fmt.Printf("stress: %d goroutines, %v each, seed %d\n", *goroutines, *duration, *seed)
+	failed := 0
+	for _, t := range run {
+		c := config{goroutines: *goroutines, duration: *duration, seed: *seed, dir: dir}
+		start := time.Now()
+		ops, err := t.run(c)
+		elapsed := time.Since(start)
+		status := "ok"
+		if err != nil {
+			status = "FAIL: " + err.Error()
+			failed++
+		}
+		fmt.Printf("%-18s %10d ops %9.0f ops/s  %s\n", t.name, ops, float64(ops)/elapsed.Seconds(), status)
+	}
+	if raceDetector {
+		fmt.Println("race detector on: a data race reported above fails the run, ok or not; the exit status is then 66, or 1 if a check failed too")
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d structures failed (seed %d)\n", failed, len(run), *seed)
+		os.Exit(1)
+	}
+}
+
+// pick returns the targets named in names, or every safe one.
+func pick(names string) ([]target, error) {
+	if names == "" {
+		var ts []target
+		for _, t := range targets {
+			if t.safe {
+				ts = append(ts, t)
+			}
+		}
+		return ts, nil
+	}
+	var ts []target
+next:
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		for _, t := range targets {
+			if t.name == name {
+				ts = append(ts, t)
+				continue next
+			}
+		}
+		return nil, fmt.Errorf("stress: unknown structure %q (see -list)", name)
+	}
+	return ts, nil
+}
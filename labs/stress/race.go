@@ -0,0 +1,6 @@
+//go:build race
+
+package stress
+
+// raceDetector is whether the race detector is built in.
+const raceDetector = true
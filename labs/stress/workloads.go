@@ -0,0 +1,418 @@
+package stress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/operating-systems/HW0/Q2/stack"
+	"example.com/operating-systems/HW7/raid"
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/clist"
+	"example.com/operating-systems/hazard"
+	"example.com/operating-systems/queue"
+)
+
+// Every worker w makes the values w, w+g, w+2g, ... (g workers), so a
+// value says who made it (v%g) and in what order (v/g).
+
+// workers runs body(w) on c.goroutines goroutines until c.duration has
+// passed, and returns how many times body ran and the first error one
+// returned.
+func workers(c config, body func(w int) error) (int64, error) {
+	deadline := time.Now().Add(c.duration)
+	ops := make([]int64, c.goroutines)
+	errs := make([]error, c.goroutines)
+	var wg sync.WaitGroup
+	for w := range c.goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n%64 != 0 || time.Now().Before(deadline); n++ {
+				if err := body(w); err != nil {
+					errs[w] = err
+					return
+				}
+				ops[w]++
+			}
+		}()
+	}
+	wg.Wait()
+	var total int64
+	var first error
+	for w, n := range ops {
+		total += n
+		if first == nil && errs[w] != nil {
+			first = fmt.Errorf("goroutine %d: %v", w, errs[w])
+		}
+	}
+	return total, first
+}
+
+// ledger checks that what came out of a structure is exactly what went
+// in: made[w] is how many values worker w put in.
+type ledger struct {
+	g    int
+	made []int
+}
+
+func newLedger(g int) *ledger { return &ledger{g: g, made: make([]int, g)} }
+
+// next returns worker w's next value.
+func (l *ledger) next(w int) int {
+	v := l.made[w]*l.g + w
+	l.made[w]++
+	return v
+}
+
+// check reports a value in out that was never put in or came out twice,
+// or how many never came out.
+func (l *ledger) check(out []int) error {
+	seen := make([][]bool, l.g)
+	for w := range seen {
+		seen[w] = make([]bool, l.made[w])
+	}
+	for _, v := range out {
+		w, s := v%l.g, v/l.g
+		if v < 0 || s >= l.made[w] {
+			return fmt.Errorf("value %d was never put in", v)
+		}
+		if seen[w][s] {
+			return fmt.Errorf("value %d came out twice", v)
+		}
+		seen[w][s] = true
+	}
+	lost := 0
+	for w := range seen {
+		for _, ok := range seen[w] {
+			if !ok {
+				lost++
+			}
+		}
+	}
+	if lost > 0 {
+		return fmt.Errorf("%d of %d values lost", lost, len(out)+lost)
+	}
+	return nil
+}
+
+// inOrder checks that, within vs, each worker's values come in the order
+// it made them, after any in after (the last of each worker's already
+// seen, -1 for none), and updates after.
+func (l *ledger) inOrder(vs []int, after []int) error {
+	last := append([]int(nil), after...)
+	for _, v := range vs {
+		w, s := v%l.g, v/l.g
+		if s <= last[w] {
+			return fmt.Errorf("worker %d's value %d came out after its value %d", w, v, last[w]*l.g+w)
+		}
+		last[w] = s
+	}
+	for w := range after {
+		after[w] = max(after[w], last[w])
+	}
+	return nil
+}
+
+func none(g int) []int {
+	after := make([]int, g)
+	for w := range after {
+		after[w] = -1
+	}
+	return after
+}
+
+func queueWorkload(kind string) func(config) (int64, error) {
+	return func(c config) (int64, error) {
+		k, err := queue.ParseKind(kind)
+		if err != nil {
+			return 0, err
+		}
+		q, err := queue.New[int](k)
+		if err != nil {
+			return 0, err
+		}
+		l := newLedger(c.goroutines)
+		got := make([][]int, c.goroutines)
+		rngs := c.rngs()
+		ops, err := workers(c, func(w int) error {
+			if rngs[w].Intn(2) == 0 {
+				q.Enqueue(l.next(w))
+			} else if v, ok := q.Dequeue(); ok {
+				got[w] = append(got[w], v)
+			}
+			return nil
+		})
+		if err != nil {
+			return ops, err
+		}
+		// A queue hands each producer's values out in order: to each
+		// consumer, and what is left after everything taken.
+		taken := none(c.goroutines)
+		var out []int
+		for w, vs := range got {
+			seen := none(c.goroutines)
+			if err := l.inOrder(vs, seen); err != nil {
+				return ops, fmt.Errorf("consumer %d: %v", w, err)
+			}
+			for p := range taken {
+				taken[p] = max(taken[p], seen[p])
+			}
+			out = append(out, vs...)
+		}
+		var left []int
+		for v, ok := q.Dequeue(); ok; v, ok = q.Dequeue() {
+			left = append(left, v)
+		}
+		if err := l.inOrder(left, taken); err != nil {
+			return ops, fmt.Errorf("left in the queue: %v", err)
+		}
+		return ops, l.check(append(out, left...))
+	}
+}
+
+func stackWorkload(kind string) func(config) (int64, error) {
+	return func(c config) (int64, error) {
+		var s stack.Concurrent
+		switch kind {
+		case "locked":
+			s = stack.NewLocked()
+		case "treiber":
+			s = stack.NewTreiber()
+		case "treiber-hp":
+			h, err := stack.NewTreiberHazard(hazard.DefaultConfig)
+			if err != nil {
+				return 0, err
+			}
+			s = h
+		}
+		l := newLedger(c.goroutines)
+		got := make([][]int, c.goroutines)
+		rngs := c.rngs()
+		ops, err := workers(c, func(w int) error {
+			if rngs[w].Intn(2) == 0 {
+				return s.Push(l.next(w))
+			}
+			v, err := s.Pop()
+			if errors.Is(err, stack.ErrEmpty) {
+				return nil
+			}
+			got[w] = append(got[w], v)
+			return err
+		})
+		if err != nil {
+			return ops, err
+		}
+		var out []int
+		for _, vs := range got {
+			out = append(out, vs...)
+		}
+		for v, err := s.Pop(); err == nil; v, err = s.Pop() {
+			out = append(out, v)
+		}
+		return ops, l.check(out)
+	}
+}
+
+func listWorkload(kind string) func(config) (int64, error) {
+	return func(c config) (int64, error) {
+		var list clist.List = clist.NewCoarseList()
+		if kind == "hoh" {
+			list = clist.NewHoHList()
+		}
+		l := newLedger(c.goroutines)
+		rngs := c.rngs()
+		ops, err := workers(c, func(w int) error {
+			r := rngs[w]
+			switch n := l.made[w]; {
+			case r.Intn(10) < 3:
+				if v := l.next(w); !list.Insert(v) {
+					return fmt.Errorf("insert %d failed", v)
+				}
+			case n > 0 && r.Intn(2) == 0:
+				// A key this worker inserted must be there.
+				if v := r.Intn(n)*l.g + w; !list.Contains(v) {
+					return fmt.Errorf("inserted key %d not found", v)
+				}
+			default:
+				// No one inserts a negative key.
+				if v := -1 - r.Intn(1000); list.Contains(v) {
+					return fmt.Errorf("found key %d, which was never inserted", v)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return ops, err
+		}
+		return ops, l.check(list.Keys())
+	}
+}
+
+func loggerWorkload(kind string) func(config) (int64, error) {
+	return func(c config) (int64, error) {
+		path := filepath.Join(c.dir, "logger-"+kind+".log")
+		var lg logger.Logger
+		var err error
+		switch kind {
+		case "naive":
+			lg, err = logger.NewNaiveLogger(path)
+		case "mutex":
+			lg, err = logger.NewMutexLogger(path, 10)
+		case "channel":
+			lg, err = logger.NewChannelLogger(path, 10, 100)
+		case "ring":
+			lg, err = logger.NewRingLogger(path, 10, 64)
+		}
+		if err != nil {
+			return 0, err
+		}
+		l := newLedger(c.goroutines)
+		rngs := c.rngs()
+		levels := []string{"INFO", "WARN", "ERROR"}
+		ops, err := workers(c, func(w int) error {
+			r := rngs[w]
+			// Messages of every length, so a torn line shows.
+			msg := fmt.Sprintf("%d %s", l.next(w), strings.Repeat("x", r.Intn(200)))
+			e := logger.LogEntry{Timestamp: time.Now(), Level: levels[r.Intn(len(levels))],
+				Context: "w" + strconv.Itoa(w), Message: msg}
+			// Some entries wait to be synced, so acknowledgments are
+			// stressed too: each must come, and come back nil.
+			if dl, ok := lg.(logger.DurableLogger); ok && r.Intn(4) == 0 {
+				return <-dl.LogDurable(e)
+			}
+			return lg.Log(e)
+		})
+		if cerr := lg.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return ops, err
+		}
+		out, err := readLog(path, l.g)
+		if err != nil {
+			return ops, err
+		}
+		// Each worker logged in order, so its lines must be in order.
+		if err := l.inOrder(out, none(l.g)); err != nil {
+			return ops, err
+		}
+		return ops, l.check(out)
+	}
+}
+
+// readLog reads back the values a log's lines carry, checking that each
+// line parses and came from the worker its value says.
+func readLog(path string, g int) ([]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []int
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		e, err := logger.ParseEntry(sc.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		field, _, _ := strings.Cut(e.Message, " ")
+		v, err := strconv.Atoi(field)
+		if err != nil || v < 0 || e.Context != "w"+strconv.Itoa(v%g) {
+			return nil, fmt.Errorf("line %d is garbled: %q", n, sc.Text())
+		}
+		out = append(out, v)
+	}
+	return out, sc.Err()
+}
+
+func raidWorkload(level int) func(config) (int64, error) {
+	return func(c config) (int64, error) {
+		dir := filepath.Join(c.dir, fmt.Sprintf("raid%d", level))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return 0, err
+		}
+		var disks []*raid.Disk
+		defer func() {
+			for _, d := range disks {
+				d.Close()
+			}
+		}()
+		for i := range 5 {
+			d, err := raid.OpenDisk(filepath.Join(dir, fmt.Sprintf("disk%d.dat", i)))
+			if err != nil {
+				return 0, err
+			}
+			disks = append(disks, d)
+		}
+		var r raid.RAID
+		switch level {
+		case 0:
+			r = raid.NewRAID0(disks)
+		case 1:
+			r = raid.NewRAID1(disks)
+		case 4:
+			r = raid.NewRAID4(disks)
+		case 5:
+			r = raid.NewRAID5(disks)
+		}
+
+		// Block b belongs to worker b%g, so neighbouring blocks, and
+		// so every stripe, are written by different workers at once.
+		g := c.goroutines
+		blocks := 16 * g
+		last := make([]map[int][]byte, g)
+		rngs := c.rngs()
+		ops, err := workers(c, func(w int) error {
+			rng := rngs[w]
+			if last[w] == nil {
+				last[w] = map[int][]byte{}
+			}
+			b := rng.Intn(blocks/g)*g + w
+			if rng.Intn(3) < 2 {
+				data := make([]byte, raid.BlockSize)
+				rng.Read(data)
+				binary.LittleEndian.PutUint64(data, uint64(b))
+				if err := r.Write(b, data); err != nil {
+					return fmt.Errorf("write block %d: %v", b, err)
+				}
+				last[w][b] = data
+				return nil
+			}
+			got, err := r.Read(b)
+			if err != nil {
+				return fmt.Errorf("read block %d: %v", b, err)
+			}
+			if want, ok := last[w][b]; ok && !bytes.Equal(got, want) {
+				return fmt.Errorf("block %d does not hold what was last written to it", b)
+			}
+			return nil
+		})
+		if err != nil {
+			return ops, err
+		}
+		for b := range blocks {
+			want, ok := last[b%g][b]
+			if !ok {
+				continue
+			}
+			got, err := r.Read(b)
+			if err != nil {
+				return ops, fmt.Errorf("read block %d: %v", b, err)
+			}
+			if !bytes.Equal(got, want) {
+				return ops, fmt.Errorf("block %d does not hold what was last written to it", b)
+			}
+		}
+		return ops, raid.Check(r)
+	}
+}
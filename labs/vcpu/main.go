@@ -0,0 +1,233 @@
+// Tiny virtual CPU
+// Assembles a few user programs (built in, or .s files named on the
+// command line), loads them into one machine's memory, each in its own
+// base-and-bounds address space, and runs them under each scheduler in
+// -scheds. The kernel arms the timer with the scheduler's quantum at
+// every dispatch; when it goes off, or the process yields, the kernel
+// saves its registers into its process control block and restores the
+// next one's. The table gives, per process, the instructions it ran,
+// dispatches, timer preemptions, yields, first-run and finish cycles,
+// and what it printed; then the switches, timer interrupts, system calls
+// and the cycles context switches cost (-switch-cost each).
+//
+// Built-in programs: count (a long loop), primes (trial division), fib
+// (a table in memory), interactive (prints and yields) and wild (stores
+// outside its memory and is killed). -programs picks them, "name:prio"
+// giving a priority for the prio scheduler (lower first).
+//
+//	go run ./cmd/vcpu
+//	go run ./cmd/vcpu -scheds rr -quantum 10 -switch-cost 50 -trace
+//	go run ./cmd/vcpu -programs count,interactive:0,wild -scheds prio -print
+//	go run ./cmd/vcpu -list primes
+package vcpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/vcpu"
+)
+
+var cmdline = labs.FlagSet("vcpu")
+
+var builtin = map[string]string{
+	"count": `
+        LOADI r1, 0         ; sum
+        LOADI r2, 2000      ; n
+loop:   ADD r1, r1, r2
+        ADDI r2, r2, -1
+        JNZ r2, loop
+        SYS 1               ; print the sum
+        SYS 0
+`,
+	"primes": `
+        LOADI r1, 0         ; primes found
+        LOADI r2, 2         ; candidate
+        LOADI r7, 300       ; limit
+outer:  LOADI r3, 2         ; divisor
+inner:  MUL r4, r3, r3
+        JLT r2, r4, prime   ; divisor squared past the candidate: prime
+        MOD r5, r2, r3
+        JZ r5, next         ; divides it: not prime
+        ADDI r3, r3, 1
+        JMP inner
+prime:  ADDI r1, r1, 1
+next:   ADDI r2, r2, 1
+        JLT r2, r7, outer
+        SYS 1
+        SYS 0
+`,
+	"fib": `
+        LOADI r2, 0         ; fib(i)
+        LOADI r3, 1         ; fib(i+1)
+        LOADI r4, 60        ; terms
+        LOADI r5, table
+loop:   STORE r2, r5, 0
+        ADDI r5, r5, 1
+        ADD r6, r2, r3
+        MOV r2, r3
+        MOV r3, r6
+        ADDI r4, r4, -1
+        JNZ r4, loop
+        LOAD r1, r5, -1     ; the last term stored
+        SYS 1
+        SYS 0
+table:  .word 0
+`,
+	"interactive": `
+        SYS 3               ; r0 = pid
+        MOV r1, r0
+        SYS 1
+        LOADI r2, 8         ; rounds
+loop:   LOADI r3, 25        ; a little work per round
+work:   ADDI r3, r3, -1
+        JNZ r3, work
+        MOV r1, r2
+        SYS 1
+        SYS 2               ; yield
+        ADDI r2, r2, -1
+        JNZ r2, loop
+        SYS 0
+`,
+	"wild": `
+        LOADI r1, 1000
+        STORE r1, r1, 0     ; address 1000: outside its memory
+        SYS 0
+`,
+}
+
+// program is one to load.
+type program struct {
+	name string
+	code vcpu.Program
+	prio int
+}
+
+func Main(args []string) {
+	var (
+		progs   = cmdline.String("programs", "count,primes,fib,interactive:0", "comma-separated built-in programs, name[:priority]: count | primes | fib | interactive | wild")
+		scheds  = cmdline.String("scheds", strings.Join(vcpu.Schedulers, ","), "comma-separated schedulers: "+strings.Join(vcpu.Schedulers, " | "))
+		quantum = cmdline.Int("quantum", 50, "instructions before the timer interrupts (rr, prio)")
+		cost    = cmdline.Int("switch-cost", 20, "cycles a context switch costs")
+		words   = cmdline.Int("words", 256, "words of memory per process")
+		cycles  = cmdline.Int64("cycles", 10000000, "stop after this many cycles")
+		trace   = cmdline.Bool("trace", false, "print every context switch with the saved registers")
+		print   = cmdline.Bool("print", false, "print what the programs print as they do")
+		list    = cmdline.String("list", "", "disassemble this program and exit")
+	)
+	cmdline.Parse(args)
+
+	var ps []program
+	for _, s := range strings.Split(*progs, ",") {
+		name, prio, _ := strings.Cut(strings.TrimSpace(s), ":")
+		p := program{name: name, prio: 1}
+		if prio != "" {
+			v, err := strconv.Atoi(prio)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "vcpu: bad priority in %q\n", s)
+				os.Exit(2)
+			}
+			p.prio = v
+		}
+		src, ok := builtin[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "vcpu: no built-in program %q\n", name)
+			os.Exit(2)
+		}
+		ps = append(ps, p)
+		ps[len(ps)-1].code = mustAssemble(name, src)
+	}
+	for _, path := range cmdline.Args() {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		ps = append(ps, program{name: name, code: mustAssemble(path, string(src)), prio: 1})
+	}
+	if *list != "" {
+		for _, p := range ps {
+			if p.name == *list {
+				fmt.Print(p.code.Disassemble())
+				return
+			}
+		}
+		if src, ok := builtin[*list]; ok {
+			fmt.Print(mustAssemble(*list, src).Disassemble())
+			return
+		}
+		fmt.Fprintf(os.Stderr, "vcpu: no program %q\n", *list)
+		os.Exit(2)
+	}
+
+	for _, name := range strings.Split(*scheds, ",") {
+		s, err := vcpu.NewScheduler(name, *quantum)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		k := vcpu.NewKernel(*words*len(ps), s)
+		k.SwitchCost = *cost
+		if *print {
+			k.Out = os.Stdout
+		}
+		if *trace {
+			k.OnSwitch = func(from, to *vcpu.Process) {
+				if from == nil {
+					fmt.Printf("  cycle %7d: start %d %s\n", k.CPU.Cycles, to.PID, to.Name)
+					return
+				}
+				fmt.Printf("  cycle %7d: %d %s (%v, pc=%d regs=%v) -> %d %s (pc=%d)\n", k.CPU.Cycles,
+					from.PID, from.Name, from.State, from.PC, from.Regs, to.PID, to.Name, to.PC)
+			}
+		}
+		for _, p := range ps {
+			if _, err := k.Spawn(p.name, p.code, *words, p.prio); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		fmt.Println(s.Name())
+		runErr := k.Run(*cycles)
+		report(k)
+		if runErr != nil {
+			fmt.Println(" ", runErr)
+		}
+		fmt.Println()
+	}
+}
+
+func mustAssemble(name, src string) vcpu.Program {
+	code, err := vcpu.Assemble(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(2)
+	}
+	return code
+}
+
+// report prints a run's table and totals.
+func report(k *vcpu.Kernel) {
+	fmt.Printf("  %3s %-12s %7s %7s %9s %8s %6s %8s %8s  %s\n", "pid", "name", "state", "instr", "dispatch", "preempt", "yields", "first", "done", "output")
+	for _, p := range k.Processes() {
+		out := make([]string, len(p.Output))
+		for i, v := range p.Output {
+			out[i] = strconv.FormatInt(v, 10)
+		}
+		if len(out) > 6 {
+			out = append(out[:5], "...", out[len(out)-1])
+		}
+		if p.Err != nil {
+			out = append(out, "("+p.Err.Error()+")")
+		}
+		fmt.Printf("  %3d %-12s %7v %7d %9d %8d %6d %8d %8d  %s\n", p.PID, p.Name, p.State, p.Instructions,
+			p.Dispatches, p.Preemptions, p.Yields, p.FirstRun, p.Finished, strings.Join(out, " "))
+	}
+	fmt.Printf("  %d cycles, %d context switches, %d timer interrupts, %d system calls, %.1f%% of cycles switching\n",
+		k.CPU.Cycles, k.Switches, k.Timer, k.Syscalls, 100*float64(k.Overhead)/float64(max(k.CPU.Cycles, 1)))
+}
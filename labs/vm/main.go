@@ -0,0 +1,229 @@
+// Virtual memory address translation simulator
+// Translates a stream of virtual addresses with base and bounds, with
+// segmentation, with multi-level page tables, and with a TLB in front of
+// the page table (see package vm) and reports every translation, the
+// faults, per-segment usage, internal/external fragmentation, the
+// page-table walk cost, TLB hit rates, and the effective access time.
+//
+//	go run ./cmd/vm                                   # 10 random addresses, every mode
+//	go run ./cmd/vm -mode seg -trace addrs.txt -q
+//	go run ./cmd/vm -segs "code@32k+2k:r-x,heap@34k+3k,-,stack@28k-2k"
+//	go run ./cmd/vm -mode pt -levels 1,2,3 -asize 1m -phys 4m -page 256 -n 1000 -pattern mapped -q
+//	go run ./cmd/vm -mode pt,tlb -tlb 4,8,16 -tlb-policy lru,random -pattern hot -n 10000 -q
+//
+// A trace has one access per line: "[@asid] [r|w|x] address".
+package vm
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"example.com/operating-systems/labs"
+	"example.com/operating-systems/vm"
+)
+
+var cmdline = labs.FlagSet("vm")
+
+func Main(args []string) {
+	var (
+		mode   = cmdline.String("mode", "bb,seg,pt", "comma-separated translators: bb (base and bounds) | seg (segmentation) | pt (page table)")
+		asize  = cmdline.String("asize", "16k", "virtual address space size")
+		phys   = cmdline.String("phys", "64k", "physical memory size")
+		base   = cmdline.String("base", "16k", "bb: base register")
+		bounds = cmdline.String("bounds", "", "bb: bounds register (default: the address space size)")
+		segs   = cmdline.String("segs", "code@32k+2k:r-x,heap@34k+3k:rw-,-,stack@28k-2k:rw-",
+			"seg: segments in address space order, name@base+size or name@base-size (grows down), optional :prot; - skips one")
+		page   = cmdline.String("page", "64", "pt: page size")
+		levels = cmdline.String("levels", "2", "pt: comma-separated page table depths to run, 1 (linear) to 3")
+		pteSz  = cmdline.Uint64("pte", 4, "pt: bytes per page-table entry")
+		tlbN   = cmdline.String("tlb", "16", "tlb: comma-separated TLB sizes (entries) to run")
+		ways   = cmdline.Int("tlb-ways", 0, "tlb: associativity, entries per set (0 = fully associative)")
+		tlbPol = cmdline.String("tlb-policy", "lru", "tlb: comma-separated replacement policies: lru | random")
+		noASID = cmdline.Bool("tlb-no-asid", false, "tlb: untagged entries, flush the TLB on every context switch")
+		tlbNS  = cmdline.Float64("tlb-ns", 1, "effective access time: ns per TLB lookup")
+		memNS  = cmdline.Float64("mem-ns", 100, "effective access time: ns per memory access")
+		trace  = cmdline.String("trace", "", "address trace, one \"[@asid] [r|w|x] address\" per line (default: generated)")
+		n      = cmdline.Int("n", 10, "generated trace: number of addresses")
+		seed   = cmdline.Int64("seed", 0, "generated trace, page placement and random replacement: seed")
+		writes = cmdline.Float64("writes", 0.3, "generated trace: fraction of writes")
+		ptrn   = cmdline.String("pattern", "uniform", "generated trace: uniform (anywhere) | mapped (inside the segments) | seq (array scan) | hot (80% of accesses to 20% of pages)")
+		stride = cmdline.Uint64("stride", 4, "seq pattern: bytes between accesses")
+		procs  = cmdline.Int("procs", 1, "generated trace: processes (address spaces) sharing it, round robin; needs pt or tlb")
+		slice  = cmdline.Int("quantum", 100, "-procs: accesses per time slice")
+		quiet  = cmdline.Bool("q", false, "don't list every translation, only the summary")
+	)
+	cmdline.Parse(args)
+
+	sizes := map[string]*string{"asize": asize, "phys": phys, "base": base, "page": page}
+	if *bounds == "" {
+		*bounds = *asize
+	}
+	sizes["bounds"] = bounds
+	val := map[string]uint64{}
+	for name, s := range sizes {
+		v, err := vm.ParseSize(*s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bad -%s: %v\n", name, err)
+			os.Exit(2)
+		}
+		val[name] = v
+	}
+
+	// The segment layout; paging maps the same virtual regions
+	list, err := vm.ParseSegments(*segs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bad -segs:", err)
+		os.Exit(2)
+	}
+	seg, err := vm.NewSegmentation(val["asize"], list)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var accesses []vm.Access
+	if *trace != "" {
+		f, err := os.Open(*trace)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		accesses, err = vm.ParseTrace(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bad -trace:", err)
+			os.Exit(2)
+		}
+	} else {
+		count := max(*n, 1)
+		switch *ptrn {
+		case "uniform":
+			accesses = vm.RandomTrace(count, val["asize"], *writes, *seed)
+		case "mapped":
+			accesses = vm.RegionTrace(count, seg.Virtual(), *writes, *seed)
+		case "seq":
+			accesses = vm.SeqTrace(count, seg.Virtual(), *stride, *writes, *seed)
+		case "hot":
+			accesses = vm.HotTrace(count, seg.Virtual(), val["page"], 0.2, 0.8, *writes, *seed)
+		default:
+			fmt.Fprintf(os.Stderr, "unknown pattern %q (use uniform, mapped, seq, or hot)\n", *ptrn)
+			os.Exit(2)
+		}
+		vm.Interleave(accesses, *procs, *slice)
+	}
+
+	// One address space per process in the trace
+	spaces := 1
+	for _, a := range accesses {
+		spaces = max(spaces, a.ASID+1)
+	}
+
+	depths, err := parseInts(*levels)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bad -levels:", err)
+		os.Exit(2)
+	}
+	tlbSizes, err := parseInts(*tlbN)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bad -tlb:", err)
+		os.Exit(2)
+	}
+	// newPageTable builds a fresh page table of the given depth
+	newPageTable := func(depth int) *vm.PageTable {
+		cfg := vm.Paging{AddressSpace: val["asize"], PageSize: val["page"], Levels: depth, PTESize: *pteSz,
+			PhysMem: val["phys"], Seed: *seed, Spaces: spaces}
+		pt, err := vm.NewPageTable(cfg, seg.Virtual())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return pt
+	}
+
+	var translators []vm.Translator
+	for _, m := range strings.Split(*mode, ",") {
+		switch strings.TrimSpace(m) {
+		case "bb":
+			translators = append(translators, vm.BaseBounds{Base: val["base"], Bounds: val["bounds"]})
+		case "seg":
+			translators = append(translators, seg)
+		case "pt":
+			for _, depth := range depths {
+				translators = append(translators, newPageTable(depth))
+			}
+		case "tlb":
+			for _, depth := range depths {
+				for _, size := range tlbSizes {
+					for _, pol := range strings.Split(*tlbPol, ",") {
+						cfg := vm.TLBConfig{Entries: size, Ways: *ways, Policy: strings.TrimSpace(pol), NoASID: *noASID, Seed: *seed}
+						t, err := vm.NewTLB(newPageTable(depth), cfg)
+						if err != nil {
+							fmt.Fprintln(os.Stderr, err)
+							os.Exit(2)
+						}
+						translators = append(translators, t)
+					}
+				}
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "unknown mode %q (use bb, seg, pt, or tlb)\n", m)
+			os.Exit(2)
+		}
+	}
+
+	var results []vm.Result
+	for _, t := range translators {
+		if _, ok := t.(vm.Switcher); spaces > 1 && !ok {
+			fmt.Printf("%s: skipped, it has a single address space\n\n", t.Name())
+			continue
+		}
+		res, err := vm.Run(t, val["asize"], val["phys"], accesses)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *quiet {
+			fmt.Println(res.Summary())
+		} else {
+			fmt.Println(res.Format())
+		}
+		results = append(results, res)
+	}
+
+	// Side-by-side summary
+	width := len("translator")
+	for _, r := range results {
+		width = max(width, len(r.Translator))
+	}
+	fmt.Printf("%-*s %7s %12s %9s %10s\n", width, "translator", "faults", "reads/acc", "tlb hit", "EAT (ns)")
+	for _, r := range results {
+		faults := 0
+		for _, c := range r.Faults {
+			faults += c
+		}
+		hit := "-"
+		if r.TLB != nil {
+			hit = fmt.Sprintf("%.1f%%", 100*r.TLB.HitRate())
+		}
+		reads := "-"
+		if r.Walks && len(r.Translations) > 0 {
+			reads = fmt.Sprintf("%.2f", float64(r.Reads)/float64(len(r.Translations)))
+		}
+		fmt.Printf("%-*s %7d %12s %9s %10.1f\n", width, r.Translator, faults, reads, hit, r.EffectiveAccessTime(*tlbNS, *memNS))
+	}
+}
+
+// parseInts parses a comma-separated list like "1,2,3".
+func parseInts(list string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(list, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
@@ -0,0 +1,325 @@
+// Package lclock is logical clocks for ordering the logs of processes
+// that don't share a clock. A Lamport clock is one counter per process,
+// ticked at every event and pushed past any timestamp received, so if a
+// happened before b, L(a) < L(b), though not the other way round. A
+// vector clock keeps a counter for every process it has heard of, so
+// that a happened before b exactly when V(a) < V(b), and two events
+// neither of which precedes the other are concurrent.
+//
+// A Process keeps both. Its stamps go in logger.LogEntry's Clock field,
+// and Order sorts stamped entries from many logs into one order that
+// every happened-before relation agrees with.
+package lclock
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"example.com/operating-systems/HW8/logger"
+)
+
+// Vector is a vector clock: a counter per process name.
+type Vector map[string]uint64
+
+// Copy returns a copy of v.
+func (v Vector) Copy() Vector {
+	c := make(Vector, len(v))
+	for p, n := range v {
+		c[p] = n
+	}
+	return c
+}
+
+// Merge raises each of v's counters to o's, if o's is higher.
+func (v Vector) Merge(o Vector) {
+	for p, n := range o {
+		if n > v[p] {
+			v[p] = n
+		}
+	}
+}
+
+// Sum is every counter added up; a happened before b makes a's smaller.
+func (v Vector) Sum() uint64 {
+	var s uint64
+	for _, n := range v {
+		s += n
+	}
+	return s
+}
+
+// String is "p:n,q:m", processes sorted.
+func (v Vector) String() string {
+	procs := make([]string, 0, len(v))
+	for p := range v {
+		procs = append(procs, p)
+	}
+	sort.Strings(procs)
+	var b strings.Builder
+	for i, p := range procs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s:%d", p, v[p])
+	}
+	return b.String()
+}
+
+// ParseVector reads a Vector written by String.
+func ParseVector(s string) (Vector, error) {
+	v := Vector{}
+	if s == "" {
+		return v, nil
+	}
+	for _, f := range strings.Split(s, ",") {
+		p, n, ok := strings.Cut(f, ":")
+		c, err := strconv.ParseUint(n, 10, 64)
+		if !ok || p == "" || err != nil {
+			return nil, fmt.Errorf("lclock: bad vector entry %q", f)
+		}
+		v[p] = c
+	}
+	return v, nil
+}
+
+// Relation is how two events are ordered.
+type Relation int
+
+const (
+	Equal Relation = iota
+	Before
+	After
+	Concurrent
+)
+
+func (r Relation) String() string {
+	switch r {
+	case Equal:
+		return "equal"
+	case Before:
+		return "before"
+	case After:
+		return "after"
+	case Concurrent:
+		return "concurrent"
+	}
+	return fmt.Sprintf("Relation(%d)", int(r))
+}
+
+// Compare says whether a happened before b, after it, or neither.
+func Compare(a, b Vector) Relation {
+	less, more := false, false
+	for p, n := range a {
+		if n < b[p] {
+			less = true
+		} else if n > b[p] {
+			more = true
+		}
+	}
+	for p, n := range b {
+		if _, ok := a[p]; !ok && n > 0 {
+			less = true
+		}
+	}
+	switch {
+	case less && more:
+		return Concurrent
+	case less:
+		return Before
+	case more:
+		return After
+	}
+	return Equal
+}
+
+// Stamp is an event's logical time: the process it happened in and its
+// clocks there. Lamport is 0 and Vector nil in a stamp that lacks them.
+type Stamp struct {
+	Proc    string
+	Lamport uint64
+	Vector  Vector
+}
+
+// String is "proc L=n V=p:n,q:m", each clock only if present.
+func (s Stamp) String() string {
+	out := s.Proc
+	if s.Lamport > 0 {
+		out += " L=" + strconv.FormatUint(s.Lamport, 10)
+	}
+	if s.Vector != nil {
+		out += " V=" + s.Vector.String()
+	}
+	return out
+}
+
+// ParseStamp reads a Stamp written by String.
+func ParseStamp(s string) (Stamp, error) {
+	f := strings.Fields(s)
+	if len(f) == 0 || strings.Contains(f[0], "=") {
+		return Stamp{}, fmt.Errorf("lclock: stamp %q names no process", s)
+	}
+	st := Stamp{Proc: f[0]}
+	for _, kv := range f[1:] {
+		var err error
+		switch {
+		case strings.HasPrefix(kv, "L="):
+			st.Lamport, err = strconv.ParseUint(kv[2:], 10, 64)
+		case strings.HasPrefix(kv, "V="):
+			st.Vector, err = ParseVector(kv[2:])
+		default:
+			err = fmt.Errorf("unknown field %q", kv)
+		}
+		if err != nil {
+			return Stamp{}, fmt.Errorf("lclock: bad stamp %q: %v", s, err)
+		}
+	}
+	return st, nil
+}
+
+// Process is one process's clocks, safe for concurrent use.
+type Process struct {
+	mu      sync.Mutex
+	name    string
+	lamport uint64
+	vector  Vector
+}
+
+// NewProcess returns the clocks of a process called name, at zero.
+func NewProcess(name string) *Process {
+	return &Process{name: name, vector: Vector{name: 0}}
+}
+
+// Name is the process's name.
+func (p *Process) Name() string { return p.name }
+
+// tick advances both clocks for a new event; p.mu is held.
+func (p *Process) tick() Stamp {
+	p.lamport++
+	p.vector[p.name]++
+	return Stamp{Proc: p.name, Lamport: p.lamport, Vector: p.vector.Copy()}
+}
+
+// Event stamps a local event, sending a message included: the stamp
+// goes along with it.
+func (p *Process) Event() Stamp {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tick()
+}
+
+// Receive stamps the receipt of a message sent with stamp s.
+func (p *Process) Receive(s Stamp) Stamp {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lamport = max(p.lamport, s.Lamport)
+	p.vector.Merge(s.Vector)
+	return p.tick()
+}
+
+// Tag stamps e as a local event, if it isn't stamped already.
+func (p *Process) Tag(e logger.LogEntry) logger.LogEntry {
+	if e.Clock == "" {
+		e.Clock = p.Event().String()
+	}
+	return e
+}
+
+// Entry is a log entry with its stamp parsed.
+type Entry struct {
+	logger.LogEntry
+	Stamp Stamp
+}
+
+// Parse parses e's stamp.
+func Parse(e logger.LogEntry) (Entry, error) {
+	if e.Clock == "" {
+		return Entry{}, fmt.Errorf("lclock: entry %q has no clock", strings.TrimSpace(e.String()))
+	}
+	s, err := ParseStamp(e.Clock)
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{LogEntry: e, Stamp: s}, nil
+}
+
+// By is the order entries are merged in.
+type By int
+
+const (
+	ByVector  By = iota // causal: vector sum, then Lamport, then process
+	ByLamport           // causal: Lamport, then process
+	ByWall              // wall clock, which skew can make disagree with causality
+)
+
+// Bys lists every order.
+var Bys = []By{ByVector, ByLamport, ByWall}
+
+func (b By) String() string {
+	switch b {
+	case ByVector:
+		return "vector"
+	case ByLamport:
+		return "lamport"
+	case ByWall:
+		return "wall"
+	}
+	return fmt.Sprintf("By(%d)", int(b))
+}
+
+// ParseBy returns the order named s.
+func ParseBy(s string) (By, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "vector", "vc":
+		return ByVector, nil
+	case "lamport", "l":
+		return ByLamport, nil
+	case "wall", "time", "timestamp":
+		return ByWall, nil
+	}
+	return 0, fmt.Errorf("lclock: unknown order %q (vector, lamport, wall)", s)
+}
+
+// Order sorts es, stably, in order b. Both causal orders are linear
+// extensions of happened-before: if a happened before b, a comes first.
+func Order(es []Entry, b By) {
+	key := func(e Entry) (uint64, uint64) {
+		switch b {
+		case ByVector:
+			return e.Stamp.Vector.Sum(), e.Stamp.Lamport
+		case ByLamport:
+			return e.Stamp.Lamport, 0
+		}
+		return uint64(e.Timestamp.UnixNano()), 0
+	}
+	sort.SliceStable(es, func(i, j int) bool {
+		a1, a2 := key(es[i])
+		b1, b2 := key(es[j])
+		if a1 != b1 {
+			return a1 < b1
+		}
+		if a2 != b2 {
+			return a2 < b2
+		}
+		return es[i].Stamp.Proc < es[j].Stamp.Proc
+	})
+}
+
+// Violations counts the pairs of entries in es, in order, where the
+// later happened before the earlier by their vector clocks, and the
+// concurrent pairs.
+func Violations(es []Entry) (violations, concurrent int) {
+	for i := range es {
+		for j := i + 1; j < len(es); j++ {
+			switch Compare(es[i].Stamp.Vector, es[j].Stamp.Vector) {
+			case After:
+				violations++
+			case Concurrent:
+				concurrent++
+			}
+		}
+	}
+	return violations, concurrent
+}
@@ -0,0 +1,101 @@
+// Package locks holds the HW2 locks as an importable library, for the
+// synchronization packages built on them: the CAS spin lock and ticket
+// lock benchmarked in HW2/Q3, HW2-Q1's queue lock (a guard spin lock
+// protecting a flag and a queue of parked waiters), and a counting
+// semaphore and a condition variable built the same way as the queue
+// lock. Parking is a receive on a channel of the waiter's own, and
+// waking hands over straight to the longest waiter, so the queue lock,
+// the semaphore, and the condition variable are all FIFO.
+package locks
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// Lock is a mutual exclusion lock.
+type Lock interface {
+	Lock()
+	Unlock()
+}
+
+// CASLock is an unfair spin lock: compare-and-swap on a 0/1 flag,
+// yielding between tries.
+type CASLock struct {
+	state int32 // 0 = unlocked, 1 = locked
+}
+
+func (l *CASLock) Lock() {
+	for !atomic.CompareAndSwapInt32(&l.state, 0, 1) {
+		runtime.Gosched()
+	}
+}
+
+func (l *CASLock) Unlock() { atomic.StoreInt32(&l.state, 0) }
+
+// TicketLock is a fair (FIFO) spin lock: fetch-and-add hands out
+// tickets, and the holder of the ticket being served goes in.
+type TicketLock struct {
+	next       uint64 // next ticket to give out
+	nowServing uint64 // ticket allowed in
+}
+
+func (l *TicketLock) Lock() {
+	my := atomic.AddUint64(&l.next, 1) - 1
+	for atomic.LoadUint64(&l.nowServing) != my {
+		runtime.Gosched()
+	}
+}
+
+func (l *TicketLock) Unlock() { atomic.AddUint64(&l.nowServing, 1) }
+
+// waitQueue is a FIFO of parked goroutines, guarded by its owner's guard.
+type waitQueue []chan struct{}
+
+// park adds a waiter and returns the channel it should block on.
+func (q *waitQueue) park() chan struct{} {
+	c := make(chan struct{})
+	*q = append(*q, c)
+	return c
+}
+
+// unpark wakes the longest waiter, reporting whether there was one.
+func (q *waitQueue) unpark() bool {
+	if len(*q) == 0 {
+		return false
+	}
+	c := (*q)[0]
+	*q = (*q)[1:]
+	close(c)
+	return true
+}
+
+// QueueLock is HW2-Q1's lock: a guard spin lock protects the flag and a
+// queue of waiters, and a waiter parks instead of spinning on the flag.
+// Unlock with someone waiting leaves the flag set and hands the lock
+// straight to the next in line.
+type QueueLock struct {
+	guard CASLock
+	flag  bool
+	q     waitQueue
+}
+
+func (l *QueueLock) Lock() {
+	l.guard.Lock()
+	if !l.flag {
+		l.flag = true
+		l.guard.Unlock()
+		return
+	}
+	c := l.q.park()
+	l.guard.Unlock()
+	<-c
+}
+
+func (l *QueueLock) Unlock() {
+	l.guard.Lock()
+	if !l.q.unpark() {
+		l.flag = false
+	}
+	l.guard.Unlock()
+}
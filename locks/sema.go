@@ -0,0 +1,87 @@
+package locks
+
+// Semaphore is a counting semaphore. Post with goroutines waiting hands
+// the unit to the one that has waited longest rather than bumping the
+// count, so a later Wait can't barge ahead of it.
+type Semaphore struct {
+	guard CASLock
+	n     int
+	q     waitQueue
+}
+
+// NewSemaphore returns a semaphore with count n.
+func NewSemaphore(n int) *Semaphore { return &Semaphore{n: n} }
+
+// Wait (P) blocks until the count is positive, then decrements it.
+func (s *Semaphore) Wait() {
+	s.guard.Lock()
+	if s.n > 0 {
+		s.n--
+		s.guard.Unlock()
+		return
+	}
+	c := s.q.park()
+	s.guard.Unlock()
+	<-c
+}
+
+// TryWait decrements the count if it's positive, reporting whether it
+// did.
+func (s *Semaphore) TryWait() bool {
+	s.guard.Lock()
+	defer s.guard.Unlock()
+	if s.n > 0 {
+		s.n--
+		return true
+	}
+	return false
+}
+
+// Post (V) wakes the longest waiter, or increments the count if there is
+// none.
+func (s *Semaphore) Post() {
+	s.guard.Lock()
+	if !s.q.unpark() {
+		s.n++
+	}
+	s.guard.Unlock()
+}
+
+// Cond is a condition variable over any Lock: Wait parks the caller in
+// FIFO order, Signal wakes the longest waiter, and Broadcast all of them.
+// As with sync.Cond, a woken waiter must recheck its condition.
+type Cond struct {
+	L     Lock
+	guard CASLock
+	q     waitQueue
+}
+
+// NewCond returns a condition variable over l.
+func NewCond(l Lock) *Cond { return &Cond{L: l} }
+
+// Wait unlocks c.L, parks until signalled, and locks c.L again. The
+// caller is queued before c.L is released, so a Signal sent in between
+// isn't lost.
+func (c *Cond) Wait() {
+	c.guard.Lock()
+	ch := c.q.park()
+	c.guard.Unlock()
+	c.L.Unlock()
+	<-ch
+	c.L.Lock()
+}
+
+// Signal wakes the longest waiter, if any.
+func (c *Cond) Signal() {
+	c.guard.Lock()
+	c.q.unpark()
+	c.guard.Unlock()
+}
+
+// Broadcast wakes every waiter.
+func (c *Cond) Broadcast() {
+	c.guard.Lock()
+	for c.q.unpark() {
+	}
+	c.guard.Unlock()
+}
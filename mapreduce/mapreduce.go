@@ -0,0 +1,264 @@
+// Package mapreduce is a small MapReduce over goroutines: the input
+// splits are mapped as tasks on a worker pool (package pool, through
+// package future), each map task's output is partitioned by key and
+// shuffled to the reducers through one HW4 queue (package queue) per
+// partition, and each partition is then grouped by key and reduced as a
+// task of its own.
+//
+// Workers fail. Config.Fail makes an attempt crash partway through, by
+// panicking, as a worker dying would; the pool recovers it and the master
+// re-executes the task, up to Config.Attempts times. A map task's output
+// is held by the attempt and only queued for the reducers once the
+// attempt finishes, and a reduce task's only merged then, so a failed
+// attempt leaves nothing behind and re-execution can't count anything
+// twice. Task events go to Config.Log, an HW8 logger, when one is set.
+package mapreduce
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/future"
+	"example.com/operating-systems/pool"
+	"example.com/operating-systems/queue"
+)
+
+// Mapper turns one input split into key-value pairs, passing each to emit.
+type Mapper[I, V any] func(in I, emit func(key string, v V)) error
+
+// Reducer combines the values emitted for one key.
+type Reducer[V, R any] func(key string, vs []V) (R, error)
+
+// Config sets up a job.
+type Config struct {
+	Reducers int           // partitions, one reduce task each
+	Attempts int           // tries per task before the job fails
+	Fail     float64       // chance an attempt crashes, for testing re-execution
+	Seed     int64         // seeds the crashes
+	Kind     queue.Kind    // the shuffle queues
+	Log      logger.Logger // task events; nil for none
+}
+
+// DefaultConfig reduces into 4 partitions and tries each task up to 4
+// times, with no crashes injected.
+var DefaultConfig = Config{Reducers: 4, Attempts: 4, Kind: queue.MSKind}
+
+// Stats counts a job's work.
+type Stats struct {
+	Maps, Reduces    int // tasks
+	Attempts, Failed int // task attempts in all, and those that failed
+	Pairs, Keys      int // intermediate pairs shuffled, and distinct keys
+	Map, Reduce      time.Duration
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d map + %d reduce tasks in %d attempts (%d failed); %d pairs, %d keys; map %v, reduce %v",
+		s.Maps, s.Reduces, s.Attempts, s.Failed, s.Pairs, s.Keys, s.Map.Round(time.Microsecond), s.Reduce.Round(time.Microsecond))
+}
+
+// crash is the panic of an injected failure.
+type crash struct{ task string }
+
+func (c crash) String() string { return "injected crash in " + c.task }
+
+// KV is an intermediate pair.
+type KV[V any] struct {
+	Key   string
+	Value V
+}
+
+// job is one run's state, used only by the master (Run's goroutine).
+type job struct {
+	cfg   Config
+	p     *pool.Pool
+	rng   *rand.Rand // the master's; attempts are drawn before they're submitted
+	stats Stats
+	err   error // first failed Log
+}
+
+// Run maps every input with m and reduces each key's values with r, on p.
+func Run[I, V, R any](p *pool.Pool, cfg Config, inputs []I, m Mapper[I, V], r Reducer[V, R]) (map[string]R, Stats, error) {
+	if cfg.Reducers < 1 || cfg.Attempts < 1 || cfg.Fail < 0 || cfg.Fail >= 1 {
+		return nil, Stats{}, fmt.Errorf("mapreduce: need reducers and attempts at least 1 and 0 <= fail < 1, got %d, %d, %g",
+			cfg.Reducers, cfg.Attempts, cfg.Fail)
+	}
+	j := &job{cfg: cfg, p: p, rng: rand.New(rand.NewSource(cfg.Seed))}
+	parts := make([]queue.Queue[KV[V]], cfg.Reducers)
+	for i := range parts {
+		q, err := queue.New[KV[V]](cfg.Kind)
+		if err != nil {
+			return nil, Stats{}, err
+		}
+		parts[i] = q
+	}
+	j.log("INFO", "job", fmt.Sprintf("maps=%d reducers=%d attempts=%d fail=%g", len(inputs), cfg.Reducers, cfg.Attempts, cfg.Fail))
+
+	// Map: each attempt buckets its pairs by partition, and only the
+	// attempt that finishes hands them to the shuffle.
+	start := time.Now()
+	mapTask := func(i int, crashAt int) (func() ([][]KV[V], error), string) {
+		name := fmt.Sprintf("map %d", i)
+		return func() ([][]KV[V], error) {
+			out := make([][]KV[V], cfg.Reducers)
+			n := 0
+			err := m(inputs[i], func(key string, v V) {
+				if n == crashAt {
+					panic(crash{name})
+				}
+				n++
+				r := partition(key, cfg.Reducers)
+				out[r] = append(out[r], KV[V]{key, v})
+			})
+			if crashAt >= 0 {
+				panic(crash{name}) // fewer pairs than crashAt: crash at the end
+			}
+			return out, err
+		}, name
+	}
+	err := tasks(j, len(inputs), mapTask, func(i int, out [][]KV[V]) {
+		for r, kvs := range out {
+			for _, kv := range kvs {
+				parts[r].Enqueue(kv)
+			}
+			j.stats.Pairs += len(kvs)
+		}
+	})
+	j.stats.Maps, j.stats.Map = len(inputs), time.Since(start)
+	if err != nil {
+		j.log("ERROR", "job", err.Error())
+		return nil, j.stats, err
+	}
+
+	// Shuffle: group each partition's pairs by key, then reduce them.
+	start = time.Now()
+	groups := make([]map[string][]V, cfg.Reducers)
+	for r, q := range parts {
+		groups[r] = map[string][]V{}
+		for kv, ok := q.Dequeue(); ok; kv, ok = q.Dequeue() {
+			groups[r][kv.Key] = append(groups[r][kv.Key], kv.Value)
+		}
+	}
+	result := map[string]R{}
+	reduceTask := func(i int, crashAt int) (func() (map[string]R, error), string) {
+		name := fmt.Sprintf("reduce %d", i)
+		return func() (map[string]R, error) {
+			out := make(map[string]R, len(groups[i]))
+			n := 0
+			for k, vs := range groups[i] {
+				if n == crashAt {
+					panic(crash{name})
+				}
+				n++
+				v, err := r(k, vs)
+				if err != nil {
+					return nil, fmt.Errorf("key %q: %w", k, err)
+				}
+				out[k] = v
+			}
+			if crashAt >= 0 {
+				panic(crash{name})
+			}
+			return out, nil
+		}, name
+	}
+	err = tasks(j, cfg.Reducers, reduceTask, func(i int, out map[string]R) {
+		for k, v := range out {
+			result[k] = v
+		}
+	})
+	j.stats.Reduces, j.stats.Reduce = cfg.Reducers, time.Since(start)
+	j.stats.Keys = len(result)
+	if err != nil {
+		j.log("ERROR", "job", err.Error())
+		return nil, j.stats, err
+	}
+	j.log("INFO", "job", "done: "+j.stats.String())
+	return result, j.stats, j.err
+}
+
+// tasks runs tasks 0..n-1 on the pool, each made by mk for an attempt
+// that crashes after crashAt pairs or keys (-1 for none), and re-executes
+// the failed ones in rounds until they've all finished or one has used
+// up its attempts. commit gets each finished task's output, on the
+// calling goroutine.
+func tasks[T any](j *job, n int, mk func(i, crashAt int) (func() (T, error), string), commit func(i int, out T)) error {
+	todo := make([]int, n)
+	for i := range todo {
+		todo[i] = i
+	}
+	for attempt := 1; len(todo) > 0; attempt++ {
+		fs := make([]*future.Future[T], len(todo))
+		names := make([]string, len(todo))
+		for k, i := range todo {
+			crashAt := -1
+			if j.rng.Float64() < j.cfg.Fail {
+				crashAt = j.rng.Intn(8)
+			}
+			var fn func() (T, error)
+			fn, names[k] = mk(i, crashAt)
+			fs[k] = future.Submit(j.p, fn)
+			j.stats.Attempts++
+		}
+		var again []int
+		for k, i := range todo {
+			out, err := fs[k].Get()
+			if err == nil {
+				commit(i, out)
+				continue
+			}
+			j.stats.Failed++
+			var pe *pool.PanicError
+			if errors.As(err, &pe) {
+				if c, ok := pe.Value.(crash); ok {
+					err = errors.New(c.String())
+				}
+			}
+			if attempt == j.cfg.Attempts || errors.Is(err, pool.ErrClosed) {
+				return fmt.Errorf("mapreduce: %s failed %d times, last: %w", names[k], attempt, err)
+			}
+			j.log("WARN", names[k], fmt.Sprintf("attempt %d failed, re-executing: %v", attempt, err))
+			again = append(again, i)
+		}
+		todo = again
+	}
+	return nil
+}
+
+// partition picks the reduce partition of key.
+func partition(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+func (j *job) log(level, context, msg string) {
+	if j.cfg.Log == nil {
+		return
+	}
+	if err := j.cfg.Log.Log(logger.LogEntry{Timestamp: time.Now(), Level: level, Context: context, Message: msg}); err != nil && j.err == nil {
+		j.err = err
+	}
+}
+
+// Split cuts text into about n pieces of similar size, breaking only at
+// whitespace so no word is split.
+func Split(text string, n int) []string {
+	n = max(1, n)
+	var out []string
+	for len(text) > 0 && n > 0 {
+		size := (len(text) + n - 1) / n
+		cut := size
+		for cut < len(text) && !strings.ContainsRune(" \t\n\r", rune(text[cut])) {
+			cut++
+		}
+		out = append(out, text[:cut])
+		text = text[cut:]
+		n--
+	}
+	return out
+}
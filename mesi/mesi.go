@@ -0,0 +1,408 @@
+// Package mesi simulates the private caches of a multicore kept coherent
+// by the MESI protocol over a snooping bus. Each core has a
+// set-associative LRU cache of lines, each line Modified, Exclusive,
+// Shared or Invalid; a read miss puts BusRd on the bus, a write miss
+// BusRdX, and a write to a Shared line BusUpgr, and every other cache
+// snoops them: a Modified copy is written back and supplied, copies are
+// downgraded to Shared on BusRd and invalidated on BusRdX and BusUpgr.
+//
+// Run drives the caches with an interleaved trace of accesses and
+// counts what the protocol did: hits, misses split into cold, capacity
+// (the line was evicted) and coherence (another core's write invalidated
+// it), the coherence misses split again into true sharing (the word read
+// was one the other core wrote) and false sharing (only its line-mate
+// was), upgrades, invalidations, write-backs and cache-to-cache
+// transfers. Those counts are what the lock and false-sharing benchmarks
+// pay for and can't show.
+package mesi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// State is a line's MESI state.
+type State byte
+
+const (
+	Invalid State = iota
+	Shared
+	Exclusive
+	Modified
+)
+
+func (s State) String() string {
+	switch s {
+	case Invalid:
+		return "I"
+	case Shared:
+		return "S"
+	case Exclusive:
+		return "E"
+	case Modified:
+		return "M"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Op is a read or a write.
+type Op byte
+
+const (
+	Read Op = iota
+	Write
+)
+
+func (o Op) String() string {
+	if o == Write {
+		return "w"
+	}
+	return "r"
+}
+
+// Access is one load or store by a core.
+type Access struct {
+	Core int
+	Op   Op
+	Addr uint64
+}
+
+func (a Access) String() string { return fmt.Sprintf("@%d %v %#x", a.Core, a.Op, a.Addr) }
+
+// Config shapes the caches, all alike.
+type Config struct {
+	Cores int
+	Line  int // bytes per line, a power of two from 8 to 512
+	Sets  int
+	Ways  int // lines per set
+}
+
+// DefaultConfig is four cores, each with 16 KiB in 64 four-way sets of
+// 64-byte lines.
+var DefaultConfig = Config{Cores: 4, Line: 64, Sets: 64, Ways: 4}
+
+// MissKind classifies a miss.
+type MissKind int
+
+const (
+	Cold         MissKind = iota // the core never had the line
+	Capacity                     // the core evicted it (capacity and conflict)
+	TrueSharing                  // invalidated, and another core wrote the word now read
+	FalseSharing                 // invalidated, but only other words of the line were written
+	numMissKinds
+)
+
+func (k MissKind) String() string {
+	return [...]string{"cold", "capacity", "true sharing", "false sharing"}[k]
+}
+
+// Stats counts one core's accesses and what they cost, or all cores'.
+type Stats struct {
+	Reads, Writes int
+	Hits          int
+	Misses        [numMissKinds]int
+	Upgrades      int // writes to a Shared line: BusUpgr
+	Invalidations int // copies in other caches invalidated by this core's writes
+	Writebacks    int // Modified lines written back, evicted or snooped
+	Transfers     int // misses supplied by another cache's Modified copy
+	BusRd, BusRdX int
+}
+
+// Accesses is reads plus writes.
+func (s Stats) Accesses() int { return s.Reads + s.Writes }
+
+// MissCount is every miss of every kind.
+func (s Stats) MissCount() int {
+	n := 0
+	for _, m := range s.Misses {
+		n += m
+	}
+	return n
+}
+
+// Coherence is the misses caused by other cores' writes.
+func (s Stats) Coherence() int { return s.Misses[TrueSharing] + s.Misses[FalseSharing] }
+
+// Bus is every transaction put on the bus.
+func (s Stats) Bus() int { return s.BusRd + s.BusRdX + s.Upgrades }
+
+// HitRate is hits / accesses, or 0 before any access.
+func (s Stats) HitRate() float64 {
+	if s.Accesses() == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Accesses())
+}
+
+func (s *Stats) add(o Stats) {
+	s.Reads += o.Reads
+	s.Writes += o.Writes
+	s.Hits += o.Hits
+	for k := range s.Misses {
+		s.Misses[k] += o.Misses[k]
+	}
+	s.Upgrades += o.Upgrades
+	s.Invalidations += o.Invalidations
+	s.Writebacks += o.Writebacks
+	s.Transfers += o.Transfers
+	s.BusRd += o.BusRd
+	s.BusRdX += o.BusRdX
+}
+
+func (s Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d accesses (%d r, %d w), hit rate %.1f%%; misses", s.Accesses(), s.Reads, s.Writes, 100*s.HitRate())
+	for k := MissKind(0); k < numMissKinds; k++ {
+		fmt.Fprintf(&b, " %s %d", k, s.Misses[k])
+		if k < numMissKinds-1 {
+			b.WriteByte(',')
+		}
+	}
+	fmt.Fprintf(&b, "; %d upgrades, %d invalidations, %d write-backs, %d transfers; bus %d (%d BusRd, %d BusRdX)",
+		s.Upgrades, s.Invalidations, s.Writebacks, s.Transfers, s.Bus(), s.BusRd, s.BusRdX)
+	return b.String()
+}
+
+// Transition is a line going from one state to another in one cache,
+// counted by Result.Transitions.
+type Transition struct{ From, To State }
+
+// line is one cache line's slot.
+type line struct {
+	tag     uint64 // line number (address / line size)
+	state   State
+	lastUse int
+}
+
+// history is what a core knows of a line it doesn't hold: why it lost
+// it, and, after an invalidation, which words others have written since.
+type history struct {
+	invalidated bool
+	written     uint64 // word mask
+}
+
+// cache is one core's.
+type cache struct {
+	sets [][]line
+	past map[uint64]*history // lines held before, by line number
+}
+
+// System is the cores' caches and the bus between them.
+type System struct {
+	cfg         Config
+	caches      []cache
+	stats       []Stats
+	transitions map[Transition]int
+	clock       int
+	// Trace, if set, is called after each access with what it did.
+	Trace func(a Access, hit bool, miss MissKind, states []State)
+}
+
+// New returns a system of empty caches.
+func New(c Config) (*System, error) {
+	if c.Cores < 1 || c.Sets < 1 || c.Ways < 1 || c.Line < 8 || c.Line > 512 || c.Line&(c.Line-1) != 0 {
+		return nil, fmt.Errorf("mesi: need cores, sets and ways at least 1 and a power-of-two line of 8 to 512 bytes, got %+v", c)
+	}
+	s := &System{cfg: c, caches: make([]cache, c.Cores), stats: make([]Stats, c.Cores), transitions: map[Transition]int{}}
+	for i := range s.caches {
+		s.caches[i].sets = make([][]line, c.Sets)
+		s.caches[i].past = map[uint64]*history{}
+	}
+	return s, nil
+}
+
+// find returns core c's slot for line n, or nil.
+func (s *System) find(c int, n uint64) *line {
+	for i := range s.caches[c].sets[n%uint64(s.cfg.Sets)] {
+		l := &s.caches[c].sets[n%uint64(s.cfg.Sets)][i]
+		if l.tag == n && l.state != Invalid {
+			return l
+		}
+	}
+	return nil
+}
+
+// set moves l to state to, counting the transition.
+func (s *System) set(l *line, to State) {
+	if l.state != to {
+		s.transitions[Transition{l.state, to}]++
+		l.state = to
+	}
+}
+
+// fill finds core c a slot for line n, evicting the set's least recently
+// used line if it's full.
+func (s *System) fill(c int, n uint64) *line {
+	set := &s.caches[c].sets[n%uint64(s.cfg.Sets)]
+	for i := range *set {
+		if (*set)[i].state == Invalid {
+			(*set)[i] = line{tag: n}
+			return &(*set)[i]
+		}
+	}
+	if len(*set) < s.cfg.Ways {
+		*set = append(*set, line{tag: n})
+		return &(*set)[len(*set)-1]
+	}
+	victim := &(*set)[0]
+	for i := range *set {
+		if (*set)[i].lastUse < victim.lastUse {
+			victim = &(*set)[i]
+		}
+	}
+	if victim.state == Modified {
+		s.stats[c].Writebacks++
+	}
+	s.set(victim, Invalid)
+	s.caches[c].past[victim.tag] = &history{}
+	*victim = line{tag: n}
+	return victim
+}
+
+// Access performs one access.
+func (s *System) Access(a Access) error {
+	if a.Core < 0 || a.Core >= s.cfg.Cores {
+		return fmt.Errorf("mesi: core %d out of range (%d cores)", a.Core, s.cfg.Cores)
+	}
+	s.clock++
+	c, st := a.Core, &s.stats[a.Core]
+	n := a.Addr / uint64(s.cfg.Line)
+	word := (a.Addr % uint64(s.cfg.Line)) / 8
+	if a.Op == Write {
+		st.Writes++
+	} else {
+		st.Reads++
+	}
+
+	l := s.find(c, n)
+	hit, kind := l != nil, MissKind(0)
+	if !hit {
+		kind = Cold
+		if h := s.caches[c].past[n]; h != nil {
+			kind = Capacity
+			if h.invalidated {
+				kind = FalseSharing
+				if h.written&(1<<word) != 0 {
+					kind = TrueSharing
+				}
+			}
+		}
+		st.Misses[kind]++
+		delete(s.caches[c].past, n)
+	} else {
+		st.Hits++
+	}
+
+	switch {
+	case a.Op == Read && hit:
+	case a.Op == Read:
+		// BusRd: a Modified copy is written back and supplies the line;
+		// every copy drops to Shared.
+		st.BusRd++
+		shared := false
+		for o := range s.caches {
+			if o == c {
+				continue
+			}
+			if ol := s.find(o, n); ol != nil {
+				shared = true
+				if ol.state == Modified {
+					s.stats[o].Writebacks++
+					st.Transfers++
+				}
+				s.set(ol, Shared)
+			}
+		}
+		l = s.fill(c, n)
+		if shared {
+			s.set(l, Shared)
+		} else {
+			s.set(l, Exclusive)
+		}
+	case hit && (l.state == Modified || l.state == Exclusive):
+		s.set(l, Modified) // E -> M is silent
+	default:
+		// BusUpgr from Shared, BusRdX from Invalid: every other copy is
+		// invalidated, a Modified one written back and supplied first.
+		if hit {
+			st.Upgrades++
+		} else {
+			st.BusRdX++
+		}
+		for o := range s.caches {
+			if o == c {
+				continue
+			}
+			if ol := s.find(o, n); ol != nil {
+				if ol.state == Modified {
+					s.stats[o].Writebacks++
+					st.Transfers++
+				}
+				s.set(ol, Invalid)
+				s.caches[o].past[n] = &history{invalidated: true}
+				st.Invalidations++
+			}
+		}
+		if !hit {
+			l = s.fill(c, n)
+		}
+		s.set(l, Modified)
+	}
+	l.lastUse = s.clock
+
+	if a.Op == Write {
+		// Tell the cores that lost this line to invalidation which word
+		// they'll find changed.
+		for o := range s.caches {
+			if h := s.caches[o].past[n]; o != c && h != nil && h.invalidated {
+				h.written |= 1 << word
+			}
+		}
+	}
+	if s.Trace != nil {
+		states := make([]State, s.cfg.Cores)
+		for o := range states {
+			if ol := s.find(o, n); ol != nil {
+				states[o] = ol.state
+			}
+		}
+		s.Trace(a, hit, kind, states)
+	}
+	return nil
+}
+
+// Result is a finished run.
+type Result struct {
+	Config      Config
+	PerCore     []Stats
+	Total       Stats
+	Transitions map[Transition]int
+}
+
+// Run performs every access of trace on a fresh system. trace is called
+// with each access and what it did, if it isn't nil.
+func Run(c Config, accesses []Access, trace func(a Access, hit bool, miss MissKind, states []State)) (Result, error) {
+	s, err := New(c)
+	if err != nil {
+		return Result{}, err
+	}
+	s.Trace = trace
+	for _, a := range accesses {
+		if err := s.Access(a); err != nil {
+			return Result{}, err
+		}
+	}
+	return s.Result(), nil
+}
+
+// Result returns the counts so far.
+func (s *System) Result() Result {
+	r := Result{Config: s.cfg, PerCore: append([]Stats(nil), s.stats...), Transitions: map[Transition]int{}}
+	for _, st := range s.stats {
+		r.Total.add(st)
+	}
+	for t, n := range s.transitions {
+		r.Transitions[t] = n
+	}
+	return r
+}
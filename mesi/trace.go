@@ -0,0 +1,184 @@
+package mesi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// ParseTrace reads an access trace, one access per line, in cmd/vm's
+// form: an address (decimal, or hex with 0x), optionally preceded by r or
+// w (default r), and before that by @N for an access by core N (default
+// core). Blank lines and text after '#' are ignored.
+func ParseTrace(r io.Reader, core int) ([]Access, error) {
+	var out []Access
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		f := strings.Fields(text)
+		if len(f) == 0 {
+			continue
+		}
+		a := Access{Core: core, Op: Read}
+		if strings.HasPrefix(f[0], "@") {
+			c, err := strconv.Atoi(f[0][1:])
+			if err != nil || c < 0 {
+				return nil, fmt.Errorf("line %d: bad core %q", line, f[0])
+			}
+			a.Core, f = c, f[1:]
+		}
+		if len(f) == 2 {
+			switch f[0] {
+			case "r", "R":
+			case "w", "W":
+				a.Op = Write
+			default:
+				return nil, fmt.Errorf("line %d: access type must be r or w, got %q", line, f[0])
+			}
+			f = f[1:]
+		}
+		if len(f) != 1 {
+			return nil, fmt.Errorf("line %d: want \"[@core] [r|w] address\", got %q", line, sc.Text())
+		}
+		addr, err := strconv.ParseUint(f[0], 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad address %q", line, f[0])
+		}
+		a.Addr = addr
+		out = append(out, a)
+	}
+	return out, sc.Err()
+}
+
+// Interleave merges per-core traces into one, taking an access from each
+// in turn, round robin, until all are used up: one legal order for the
+// bus to see them in.
+func Interleave(traces ...[]Access) []Access {
+	var out []Access
+	for i := 0; ; i++ {
+		more := false
+		for _, t := range traces {
+			if i < len(t) {
+				out = append(out, t[i])
+				more = true
+			}
+		}
+		if !more {
+			return out
+		}
+	}
+}
+
+// Patterns names the generated workloads, in the order cmd/mesi runs
+// them.
+var Patterns = []string{"private", "falseshare", "padded", "counter", "tas", "ttas", "ticket", "random"}
+
+// Generate returns n accesses of a named workload on cores cores, each
+// step by a core picked at random (the same for the same seed):
+//
+//	private     each core reads and writes its own lines
+//	falseshare  each core increments its own counter, all in one line
+//	padded      the same counters a line apart
+//	counter     every core increments one shared counter
+//	tas         a spinlock: the holder works on private data, then
+//	            releases; waiters test-and-set (a write) every try
+//	ttas        the same lock, waiters spinning on a read first
+//	ticket      a ticket lock: waiters spin reading now-serving, a release
+//	            writes it, and the next holder takes a ticket
+//	random      reads and writes anywhere in four lines, a third writes
+//
+// The addresses assume a line of line bytes.
+func Generate(pattern string, cores, n, line int, seed int64) ([]Access, error) {
+	rng := rand.New(rand.NewSource(seed))
+	L := uint64(line)
+	const lock, data = 0, 1 << 16 // the lock word's line, and private data well clear of it
+	var out []Access
+	emit := func(c int, op Op, addr uint64) { out = append(out, Access{Core: c, Op: op, Addr: addr}) }
+	switch pattern {
+	case "private":
+		for len(out) < n {
+			c := rng.Intn(cores)
+			emit(c, Op(rng.Intn(2)), data+uint64(c)*4*L+uint64(rng.Intn(4))*L)
+		}
+	case "falseshare", "padded", "counter":
+		for len(out) < n {
+			c := rng.Intn(cores)
+			addr := uint64(c) * 8 // falseshare: eight counters to a 64-byte line
+			switch pattern {
+			case "padded":
+				addr = uint64(c) * L
+			case "counter":
+				addr = 0
+			}
+			emit(c, Read, addr) // an increment: load, then store
+			emit(c, Write, addr)
+		}
+	case "tas", "ttas", "ticket":
+		// A lock handed round: the holder does a few private accesses,
+		// then releases; meanwhile, the others spin. The next holder is
+		// whoever's turn comes up after the release.
+		const serving, next = lock, lock + 8 // ticket lock words
+		holder, work := 0, 0
+		waiting := make([]bool, cores) // ttas: read the lock free since release
+		emit(0, Write, lock)
+		for len(out) < n {
+			c := rng.Intn(cores)
+			if c == holder {
+				if work < 4 {
+					emit(c, Op(rng.Intn(2)), data+uint64(c)*4*L+uint64(work)*L)
+					work++
+					continue
+				}
+				// release
+				if pattern == "ticket" {
+					emit(c, Read, serving)
+					emit(c, Write, serving)
+				} else {
+					emit(c, Write, lock)
+				}
+				for i := range waiting {
+					waiting[i] = false
+				}
+				holder, work = -1, 0
+				continue
+			}
+			free := holder < 0
+			switch pattern {
+			case "tas":
+				emit(c, Write, lock) // test-and-set: a write, won or not
+			case "ttas":
+				emit(c, Read, lock)
+				if free && !waiting[c] {
+					waiting[c] = true // saw it free; try the set next time
+					continue
+				}
+				if free {
+					emit(c, Write, lock)
+				}
+			case "ticket":
+				if free {
+					emit(c, Read, next) // fetch-and-add the next ticket
+					emit(c, Write, next)
+				}
+				emit(c, Read, serving)
+			}
+			if free && (pattern != "ttas" || waiting[c]) {
+				holder = c
+			}
+		}
+	case "random":
+		for len(out) < n {
+			op := Read
+			if rng.Intn(3) == 0 {
+				op = Write
+			}
+			emit(rng.Intn(cores), op, uint64(rng.Intn(4*line))&^7)
+		}
+	default:
+		return nil, fmt.Errorf("mesi: unknown pattern %q (%s)", pattern, strings.Join(Patterns, ", "))
+	}
+	return out[:min(n, len(out))], nil
+}
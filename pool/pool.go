@@ -0,0 +1,270 @@
+// Package pool is a worker pool: tasks go into a bounded queue from
+// package queue, and between Min and Max worker goroutines take them off
+// and run them. The pool grows a worker whenever a task is queued with
+// the workers all busy, and while workers sit idle lets one go every
+// Idle, down to Min. A task that panics is recovered and counted, and its worker
+// carries on. Shutdown stops new tasks, lets the queued ones finish, and
+// waits for the workers. Stats reports, beside the counts, how long tasks
+// waited in the queue and how long they ran.
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"example.com/operating-systems/queue"
+)
+
+var (
+	ErrClosed = errors.New("pool: shut down")
+	ErrFull   = errors.New("pool: queue full")
+)
+
+// Config sizes a pool.
+type Config struct {
+	Min, Max int           // workers; Min start at once
+	Queue    int           // tasks queued beyond those running
+	Idle     time.Duration // a worker idle this long is let go, down to Min; 0 never
+	Kind     queue.Kind    // the queue under the bound
+	// OnPanic, if set, is called with each recovered panic.
+	OnPanic func(*PanicError)
+}
+
+// DefaultConfig keeps 1 to 8 workers on a 512-task queue.
+var DefaultConfig = Config{Min: 1, Max: 8, Queue: 512, Idle: 100 * time.Millisecond, Kind: queue.MSKind}
+
+// PanicError is a task's recovered panic.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("pool: task panicked: %v", e.Value) }
+
+// job is a queued task; a nil run tells the worker taking it to exit.
+type job struct {
+	run    func()
+	queued time.Time
+}
+
+// Pool runs tasks on a varying number of workers.
+type Pool struct {
+	cfg     Config
+	q       *queue.Bounded[job]
+	mu      sync.Mutex // guards everything below
+	workers int
+	idle    int // workers waiting for a task
+	exiting int // exit jobs queued and not yet taken
+	closed  bool
+	stats   Stats
+	wg      sync.WaitGroup
+	stop    chan struct{} // closed at Shutdown, stopping the shrinker
+}
+
+// New starts a pool with cfg.Min workers.
+func New(cfg Config) (*Pool, error) {
+	if cfg.Min < 0 || cfg.Max < 1 || cfg.Min > cfg.Max || cfg.Queue < 1 || cfg.Idle < 0 {
+		return nil, fmt.Errorf("pool: need 0 <= min <= max, max and queue at least 1, got min %d, max %d, queue %d",
+			cfg.Min, cfg.Max, cfg.Queue)
+	}
+	q, err := queue.New[job](cfg.Kind)
+	if err != nil {
+		return nil, err
+	}
+	p := &Pool{cfg: cfg, q: queue.NewBounded(q, cfg.Queue), stop: make(chan struct{})}
+	p.mu.Lock()
+	for i := 0; i < cfg.Min; i++ {
+		p.spawn()
+	}
+	p.mu.Unlock()
+	if cfg.Idle > 0 {
+		go p.shrinker()
+	}
+	return p, nil
+}
+
+// Submit queues f, waiting for room if the queue is full.
+func (p *Pool) Submit(f func()) error {
+	if f == nil {
+		return errors.New("pool: nil task")
+	}
+	if !p.admit() {
+		return ErrClosed
+	}
+	if !p.q.Put(job{run: f, queued: time.Now()}) {
+		p.reject()
+		return ErrClosed
+	}
+	p.grow()
+	return nil
+}
+
+// TrySubmit queues f if there's room, or returns ErrFull.
+func (p *Pool) TrySubmit(f func()) error {
+	if f == nil {
+		return errors.New("pool: nil task")
+	}
+	if !p.admit() {
+		return ErrClosed
+	}
+	if !p.q.TryPut(job{run: f, queued: time.Now()}) {
+		p.reject()
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			return ErrClosed
+		}
+		return ErrFull
+	}
+	p.grow()
+	return nil
+}
+
+// admit counts a submission, reporting false if the pool is shut down.
+func (p *Pool) admit() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		p.stats.Rejected++
+		return false
+	}
+	p.stats.Submitted++
+	return true
+}
+
+// reject takes back a submission admit counted.
+func (p *Pool) reject() {
+	p.mu.Lock()
+	p.stats.Submitted--
+	p.stats.Rejected++
+	p.mu.Unlock()
+}
+
+// grow adds a worker if tasks are queued beyond the idle workers' reach.
+func (p *Pool) grow() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed && p.workers < p.cfg.Max && p.q.Len() > p.idle-p.exiting {
+		p.spawn()
+	}
+}
+
+// spawn starts a worker; p.mu is held.
+func (p *Pool) spawn() {
+	p.workers++
+	p.stats.Peak = max(p.stats.Peak, p.workers)
+	p.stats.Spawned++
+	p.wg.Add(1)
+	go p.worker()
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+	for {
+		p.mu.Lock()
+		p.idle++
+		p.mu.Unlock()
+		j, ok := p.q.Get()
+		p.mu.Lock()
+		p.idle--
+		if !ok || j.run == nil {
+			if ok {
+				p.exiting--
+			}
+			p.workers--
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+
+		start := time.Now()
+		perr := run(j.run)
+		ran := time.Since(start)
+
+		p.mu.Lock()
+		p.stats.Wait.Add(start.Sub(j.queued))
+		p.stats.Run.Add(ran)
+		p.stats.Completed++
+		if perr != nil {
+			p.stats.Panics++
+		}
+		p.mu.Unlock()
+		if perr != nil && p.cfg.OnPanic != nil {
+			p.cfg.OnPanic(perr)
+		}
+	}
+}
+
+// run calls f, recovering a panic.
+func run(f func()) (perr *PanicError) {
+	defer func() {
+		if v := recover(); v != nil {
+			perr = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	f()
+	return nil
+}
+
+// shrinker lets one idle worker go every Idle while more than Min are
+// idle, by queueing an exit job for it.
+func (p *Pool) shrinker() {
+	t := time.NewTicker(p.cfg.Idle)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+			p.mu.Lock()
+			shrink := p.workers-p.exiting > p.cfg.Min && p.idle-p.exiting > 0 && p.q.Len() == 0
+			if shrink {
+				p.exiting++
+			}
+			p.mu.Unlock()
+			if shrink && !p.q.TryPut(job{}) {
+				p.mu.Lock()
+				p.exiting--
+				p.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Shutdown stops new tasks and waits for the queued and running ones to
+// finish, or for ctx to end first, when it returns ctx's error and the
+// workers finish in the background.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.stop)
+		p.q.Close()
+	}
+	p.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the pool's counts so far.
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	s.Workers, s.Queued = p.workers, p.q.Len()
+	return s
+}
@@ -0,0 +1,21 @@
+package pool
+
+import (
+	"fmt"
+
+	"example.com/operating-systems/stats"
+)
+
+// Stats counts a pool's work.
+type Stats struct {
+	Submitted, Rejected int // tasks accepted, and turned away full or shut down
+	Completed, Panics   int // tasks finished, and those of them that panicked
+	Workers, Queued     int // now
+	Peak, Spawned       int // most workers at once, and workers started in all
+	Wait, Run           stats.Histogram
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d submitted, %d rejected, %d completed (%d panicked); %d workers now, peak %d, %d spawned; wait %v; run %v",
+		s.Submitted, s.Rejected, s.Completed, s.Panics, s.Workers, s.Peak, s.Spawned, &s.Wait, &s.Run)
+}
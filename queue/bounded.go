@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"sync/atomic"
+
+	"example.com/operating-systems/locks"
+	"example.com/operating-systems/rwlock"
+)
+
+// Bounded is a queue of at most a fixed number of values: semaphores from
+// package locks count the free slots and the queued values, in front of
+// an unbounded Queue that holds them, so producers and consumers only
+// meet in the queue itself.
+//
+// Close stops Puts; Gets go on returning what's queued and then report
+// false. Puts hold a fair readers-writers lock as readers, and Close as
+// the writer, so nothing is enqueued once Close has returned.
+type Bounded[T any] struct {
+	q      Queue[T]
+	slots  *locks.Semaphore
+	items  *locks.Semaphore // one more than queued once closed: the close permit
+	close  *rwlock.Fair
+	closed bool // guarded by close
+	n      atomic.Int64
+}
+
+// NewBounded returns an empty queue of capacity values kept in q.
+func NewBounded[T any](q Queue[T], capacity int) *Bounded[T] {
+	return &Bounded[T]{q: q, slots: locks.NewSemaphore(capacity), items: locks.NewSemaphore(0), close: rwlock.NewFair()}
+}
+
+// Put waits for a free slot and adds v, reporting false if the queue is
+// (or while waiting became) closed.
+func (b *Bounded[T]) Put(v T) bool {
+	b.slots.Wait()
+	return b.put(v)
+}
+
+// TryPut adds v if there's a free slot, reporting whether it did.
+func (b *Bounded[T]) TryPut(v T) bool {
+	if !b.slots.TryWait() {
+		return false
+	}
+	return b.put(v)
+}
+
+// put adds v, holding a slot.
+func (b *Bounded[T]) put(v T) bool {
+	b.close.RLock()
+	defer b.close.RUnlock()
+	if b.closed {
+		// Pass the slot on, in case it's the one Close posted to wake
+		// a blocked Put
+		b.slots.Post()
+		return false
+	}
+	b.q.Enqueue(v)
+	b.n.Add(1)
+	b.items.Post()
+	return true
+}
+
+// Get waits for a value and removes it, reporting false once the queue is
+// closed and empty.
+func (b *Bounded[T]) Get() (T, bool) {
+	b.items.Wait()
+	return b.get()
+}
+
+// TryGet removes a value if one is queued.
+func (b *Bounded[T]) TryGet() (T, bool) {
+	if !b.items.TryWait() {
+		var zero T
+		return zero, false
+	}
+	return b.get()
+}
+
+// get removes a value, holding an items permit. The queue being empty
+// means the permit was the close permit, which goes on to the next Get.
+func (b *Bounded[T]) get() (T, bool) {
+	v, ok := b.q.Dequeue()
+	if !ok {
+		b.items.Post()
+		return v, false
+	}
+	b.n.Add(-1)
+	b.slots.Post()
+	return v, true
+}
+
+// Close stops Puts and wakes everyone waiting: Gets once the queue has
+// drained. Closing twice is a no-op.
+func (b *Bounded[T]) Close() {
+	b.close.Lock()
+	defer b.close.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	b.items.Post()
+	b.slots.Post()
+}
+
+// Len is how many values are queued, a moment ago.
+func (b *Bounded[T]) Len() int { return int(b.n.Load()) }
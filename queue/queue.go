@@ -0,0 +1,259 @@
+// Package queue holds the HW4 concurrent queues as an importable, generic
+// library: the two-lock queue (OSTEP Figure 29.9) and Michael and Scott's
+// lock-free queue, the latter also with its nodes reclaimed by hazard
+// pointers rather than the GC, all unbounded, and Bounded, which puts either behind a
+// capacity with blocking Put and Get and a Close that lets consumers drain
+// what's left.
+package queue
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"example.com/operating-systems/hazard"
+)
+
+// Queue is an unbounded FIFO queue, safe for concurrent use.
+type Queue[T any] interface {
+	Enqueue(v T)
+	// Dequeue removes the oldest value, reporting false if there was none.
+	Dequeue() (T, bool)
+}
+
+// Kind names a queue algorithm.
+type Kind int
+
+const (
+	TwoLockKind Kind = iota
+	MSKind
+	MSHazardKind
+)
+
+func (k Kind) String() string {
+	switch k {
+	case TwoLockKind:
+		return "two-lock"
+	case MSKind:
+		return "ms"
+	case MSHazardKind:
+		return "ms-hp"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// ParseKind returns the algorithm named s.
+func ParseKind(s string) (Kind, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "two-lock", "twolock", "tlq", "lock":
+		return TwoLockKind, nil
+	case "ms", "michael-scott", "lock-free", "lockfree":
+		return MSKind, nil
+	case "ms-hp", "ms-hazard", "hazard":
+		return MSHazardKind, nil
+	}
+	return 0, fmt.Errorf("queue: unknown kind %q (two-lock, ms, ms-hp)", s)
+}
+
+// New returns an empty queue of kind k.
+func New[T any](k Kind) (Queue[T], error) {
+	switch k {
+	case TwoLockKind:
+		return NewTwoLock[T](), nil
+	case MSKind:
+		return NewMS[T](), nil
+	case MSHazardKind:
+		return NewMSHazard[T](hazard.DefaultConfig)
+	}
+	return nil, fmt.Errorf("queue: unknown kind %v", k)
+}
+
+type tlqNode[T any] struct {
+	val  T
+	next atomic.Pointer[tlqNode[T]] // written under tailMutex, read under headMutex
+}
+
+// TwoLock is the two-lock queue: a dummy node keeps the head and tail
+// apart, so an enqueue and a dequeue don't contend, each taking only its
+// own end's lock. The two locks don't order an enqueue's link against a
+// dequeue's read of it, so next is atomic: its Store publishes the node,
+// value and all, to the Load that finds it.
+type TwoLock[T any] struct {
+	head, tail           *tlqNode[T]
+	headMutex, tailMutex sync.Mutex
+}
+
+func NewTwoLock[T any]() *TwoLock[T] {
+	dummy := &tlqNode[T]{}
+	return &TwoLock[T]{head: dummy, tail: dummy}
+}
+
+func (q *TwoLock[T]) Enqueue(v T) {
+	n := &tlqNode[T]{val: v}
+	q.tailMutex.Lock()
+	q.tail.next.Store(n)
+	q.tail = n
+	q.tailMutex.Unlock()
+}
+
+func (q *TwoLock[T]) Dequeue() (T, bool) {
+	q.headMutex.Lock()
+	n := q.head.next.Load()
+	if n == nil {
+		q.headMutex.Unlock()
+		var zero T
+		return zero, false
+	}
+	v := n.val
+	var zero T
+	n.val = zero // n is the new dummy; don't keep v alive through it
+	q.head = n
+	q.headMutex.Unlock()
+	return v, true
+}
+
+type msNode[T any] struct {
+	val  T
+	next atomic.Pointer[msNode[T]]
+}
+
+// MS is Michael and Scott's lock-free queue: enqueue links a node after
+// the tail with compare-and-swap and then swings the tail, and anyone
+// finding the tail behind helps it along.
+type MS[T any] struct {
+	head, tail atomic.Pointer[msNode[T]]
+}
+
+func NewMS[T any]() *MS[T] {
+	dummy := &msNode[T]{}
+	q := &MS[T]{}
+	q.head.Store(dummy)
+	q.tail.Store(dummy)
+	return q
+}
+
+func (q *MS[T]) Enqueue(v T) {
+	n := &msNode[T]{val: v}
+	for {
+		tail := q.tail.Load()
+		next := tail.next.Load()
+		if tail == q.tail.Load() {
+			if next == nil {
+				if tail.next.CompareAndSwap(nil, n) {
+					q.tail.CompareAndSwap(tail, n)
+					return
+				}
+			} else {
+				q.tail.CompareAndSwap(tail, next)
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+func (q *MS[T]) Dequeue() (T, bool) {
+	for {
+		head := q.head.Load()
+		tail := q.tail.Load()
+		next := head.next.Load()
+		if head == q.head.Load() {
+			if next == nil {
+				var zero T
+				return zero, false
+			}
+			if head == tail {
+				q.tail.CompareAndSwap(tail, next)
+				continue
+			}
+			v := next.val
+			if q.head.CompareAndSwap(head, next) {
+				return v, true
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+// MSHazard is the MS queue recycling its nodes: a dequeued dummy is
+// retired to a hazard-pointer domain and reused by later enqueues once
+// no one can still be reading it. Hazard pointer 0 guards the head or
+// tail being worked on, 1 the head's successor.
+type MSHazard[T any] struct {
+	head, tail atomic.Pointer[msNode[T]]
+	d          *hazard.Domain[msNode[T]]
+}
+
+// NewMSHazard returns an empty queue whose nodes are reclaimed by a
+// domain configured by c, which needs at least two hazard pointers.
+func NewMSHazard[T any](c hazard.Config) (*MSHazard[T], error) {
+	if c.Hazards < 2 {
+		return nil, fmt.Errorf("queue: the MS queue needs 2 hazard pointers, got %d", c.Hazards)
+	}
+	d, err := hazard.NewDomain[msNode[T]](c)
+	if err != nil {
+		return nil, err
+	}
+	dummy := &msNode[T]{}
+	q := &MSHazard[T]{d: d}
+	q.head.Store(dummy)
+	q.tail.Store(dummy)
+	return q, nil
+}
+
+// Domain returns the queue's hazard-pointer domain, for its Stats.
+func (q *MSHazard[T]) Domain() *hazard.Domain[msNode[T]] { return q.d }
+
+func (q *MSHazard[T]) Enqueue(v T) {
+	r := q.d.Acquire()
+	defer r.Release()
+	n := r.New()
+	n.val = v
+	n.next.Store(nil)
+	for {
+		tail := r.Protect(0, &q.tail)
+		next := tail.next.Load()
+		if tail == q.tail.Load() {
+			if next == nil {
+				if tail.next.CompareAndSwap(nil, n) {
+					q.tail.CompareAndSwap(tail, n)
+					return
+				}
+			} else {
+				q.tail.CompareAndSwap(tail, next)
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+func (q *MSHazard[T]) Dequeue() (T, bool) {
+	r := q.d.Acquire()
+	defer r.Release()
+	for {
+		head := r.Protect(0, &q.head)
+		tail := q.tail.Load()
+		next := head.next.Load()
+		r.Set(1, next)
+		// head still the head means next, its successor, isn't retired.
+		if head == q.head.Load() {
+			if next == nil {
+				var zero T
+				return zero, false
+			}
+			if head == tail {
+				q.tail.CompareAndSwap(tail, next)
+				continue
+			}
+			v := next.val
+			if q.head.CompareAndSwap(head, next) {
+				// Others may still be reading head.val, as their next.val,
+				// so it isn't cleared; reuse overwrites it.
+				r.Retire(head)
+				return v, true
+			}
+		}
+		runtime.Gosched()
+	}
+}
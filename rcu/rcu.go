@@ -0,0 +1,144 @@
+// Package rcu is a read-mostly map in the style of read-copy-update:
+// readers load the current map through an atomic pointer with no lock
+// at all, and writers, one at a time, copy it, change the copy and
+// publish it. A replaced map is retired to an epoch domain (package
+// epoch) and, once no reader can still be in it, cleared and reused as
+// the next copy. Reads scale with readers; every write costs a copy of
+// the whole map, so the more writes, the better a map behind a
+// readers-writers lock does. Locked is that map, behind any lock of
+// package rwlock, for comparison.
+package rcu
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"example.com/operating-systems/epoch"
+	"example.com/operating-systems/rwlock"
+)
+
+// Map is a map safe for concurrent use.
+type Map[K comparable, V any] interface {
+	Load(k K) (V, bool)
+	Store(k K, v V)
+	Delete(k K)
+	Len() int
+}
+
+// RCU is the copy-on-write map.
+type RCU[K comparable, V any] struct {
+	cur   atomic.Pointer[map[K]V]
+	mu    sync.Mutex // serializes writers
+	d     *epoch.Domain[*map[K]V]
+	spare []*map[K]V // freed maps, guarded by mu
+}
+
+// NewRCU returns an empty map.
+func NewRCU[K comparable, V any]() *RCU[K, V] {
+	m := &RCU[K, V]{}
+	// Retire is only called by a writer holding mu, and so is free.
+	m.d = epoch.NewDomain(func(old *map[K]V) {
+		clear(*old)
+		m.spare = append(m.spare, old)
+	})
+	m.cur.Store(&map[K]V{})
+	return m
+}
+
+// Domain returns the map's epoch domain, for its Stats.
+func (m *RCU[K, V]) Domain() *epoch.Domain[*map[K]V] { return m.d }
+
+func (m *RCU[K, V]) Load(k K) (V, bool) {
+	g := m.d.Enter()
+	v, ok := (*m.cur.Load())[k]
+	g.Exit()
+	return v, ok
+}
+
+func (m *RCU[K, V]) Len() int {
+	g := m.d.Enter()
+	defer g.Exit()
+	return len(*m.cur.Load())
+}
+
+func (m *RCU[K, V]) Store(k K, v V) {
+	m.update(func(c map[K]V) { c[k] = v })
+}
+
+func (m *RCU[K, V]) Delete(k K) {
+	m.update(func(c map[K]V) { delete(c, k) })
+}
+
+// update publishes a changed copy of the map and retires the old one.
+func (m *RCU[K, V]) update(change func(map[K]V)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.cur.Load()
+	var next *map[K]V
+	if n := len(m.spare); n > 0 {
+		next = m.spare[n-1]
+		m.spare = m.spare[:n-1]
+	} else {
+		next = &map[K]V{}
+	}
+	maps.Copy(*next, *old)
+	change(*next)
+	m.cur.Store(next)
+	m.d.Retire(old)
+}
+
+// Locked is a map behind a readers-writers lock.
+type Locked[K comparable, V any] struct {
+	l rwlock.RWLock
+	m map[K]V
+}
+
+// NewLocked returns an empty map guarded by l.
+func NewLocked[K comparable, V any](l rwlock.RWLock) *Locked[K, V] {
+	return &Locked[K, V]{l: l, m: map[K]V{}}
+}
+
+func (m *Locked[K, V]) Load(k K) (V, bool) {
+	m.l.RLock()
+	v, ok := m.m[k]
+	m.l.RUnlock()
+	return v, ok
+}
+
+func (m *Locked[K, V]) Len() int {
+	m.l.RLock()
+	defer m.l.RUnlock()
+	return len(m.m)
+}
+
+func (m *Locked[K, V]) Store(k K, v V) {
+	m.l.Lock()
+	m.m[k] = v
+	m.l.Unlock()
+}
+
+func (m *Locked[K, V]) Delete(k K) {
+	m.l.Lock()
+	delete(m.m, k)
+	m.l.Unlock()
+}
+
+// New returns an empty map of the kind named s: "rcu", or a lock kind
+// of package rwlock.
+func New[K comparable, V any](s string) (Map[K, V], error) {
+	if k := strings.ToLower(strings.TrimSpace(s)); k == "rcu" || k == "epoch" {
+		return NewRCU[K, V](), nil
+	}
+	kind, err := rwlock.ParseKind(s)
+	if err != nil {
+		return nil, fmt.Errorf("rcu: unknown map %q (rcu, reader-pref, writer-pref, fair, rwmutex)", s)
+	}
+	l, err := rwlock.New(kind)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocked[K, V](l), nil
+}
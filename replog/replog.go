@@ -0,0 +1,448 @@
+// Package replog replicates an HW8 log over TCP. A Leader is a
+// logger.Logger: Log writes the entry to the leader's own write-ahead
+// log (an HW8 MutexLogger syncing every entry), ships it to every
+// follower, and returns once a quorum of replicas, the leader included,
+// have it on disk. That is the first phase of a two-phase commit; the
+// second is the commit index, which the leader advances past every
+// entry a quorum holds and sends on to the followers.
+//
+// A follower (Follow) appends what it's sent to its own log file in
+// the HW8 line format, syncs it, and acknowledges the highest index it
+// holds; a follower that connects, or reconnects after a crash, says
+// how far its log goes and is sent the rest. Faults makes a follower
+// crash, drop acknowledgments, answer late, or acknowledge before
+// syncing.
+//
+// The leader stamps every entry that isn't stamped already with its
+// logical clocks (package lclock), so replicated logs merge causally
+// with the logs of the processes that wrote to them.
+//
+// The quorum is the tradeoff: the larger it is, the more replicas every
+// committed entry survives on, and the fewer failures it takes before
+// Log can't reach a quorum in time and returns ErrNoQuorum (a timed-out
+// entry stays in the log and may yet commit).
+package replog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/operating-systems/HW8/logger"
+	"example.com/operating-systems/lclock"
+)
+
+var (
+	ErrNoQuorum = errors.New("replog: no quorum in time")
+	ErrClosed   = errors.New("replog: leader closed")
+	// ErrCrash is what Follow returns when Faults.CrashAfter is reached.
+	ErrCrash = errors.New("replog: follower crashed (fault injected)")
+)
+
+// Config tunes a leader.
+type Config struct {
+	Quorum  int           // replicas, the leader included, that must hold an entry to commit it
+	Timeout time.Duration // how long Log waits for the quorum
+}
+
+// DefaultConfig is a majority of three replicas.
+var DefaultConfig = Config{Quorum: 2, Timeout: time.Second}
+
+// Stats counts what a leader has done.
+type Stats struct {
+	Entries   int // logged
+	Committed int // the commit index
+	NoQuorum  int // Log calls that timed out
+	Followers int // connected now
+}
+
+// peer is a connected follower.
+type peer struct {
+	id     int
+	conn   net.Conn
+	next   int // index of the next entry to send
+	commit int // the commit index last sent
+	dead   bool
+}
+
+// Leader is the replica clients log to.
+type Leader struct {
+	cfg   Config
+	ln    net.Listener
+	wal   logger.Logger
+	clock *lclock.Process
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	log      []logger.LogEntry // entry i is log[i-1]
+	match    map[int]int       // follower id -> highest index it has acknowledged
+	peers    map[*peer]bool
+	commit   int
+	noQuorum int
+	closed   bool
+}
+
+// NewLeader starts a leader listening on addr (host:port; port 0 picks
+// one) with its write-ahead log at walPath.
+func NewLeader(addr, walPath string, c Config) (*Leader, error) {
+	if c.Quorum < 1 || c.Timeout <= 0 {
+		return nil, fmt.Errorf("replog: need a quorum of at least 1 and a positive timeout, got %+v", c)
+	}
+	wal, err := logger.NewMutexLogger(walPath, 1)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		wal.Close()
+		return nil, err
+	}
+	l := &Leader{cfg: c, ln: ln, wal: wal, clock: lclock.NewProcess("leader"), match: map[int]int{}, peers: map[*peer]bool{}}
+	l.cond = sync.NewCond(&l.mu)
+	go l.accept()
+	return l, nil
+}
+
+// Addr is the address followers connect to.
+func (l *Leader) Addr() string { return l.ln.Addr().String() }
+
+func (l *Leader) accept() {
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			return
+		}
+		go l.serve(conn)
+	}
+}
+
+// serve runs one follower's connection: the hello, then a sender and
+// this goroutine reading acknowledgments.
+func (l *Leader) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	var id, last int
+	if err == nil {
+		_, err = fmt.Sscanf(line, "HELLO %d %d\n", &id, &last)
+	}
+	if err != nil {
+		conn.Close()
+		return
+	}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		conn.Close()
+		return
+	}
+	p := &peer{id: id, conn: conn, next: min(last, len(l.log)) + 1}
+	l.peers[p] = true
+	l.match[id] = min(last, len(l.log))
+	l.cond.Broadcast()
+	l.mu.Unlock()
+	go l.send(p)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		var n int
+		if _, err := fmt.Sscanf(line, "ACK %d\n", &n); err != nil {
+			break
+		}
+		l.mu.Lock()
+		if n > l.match[id] {
+			l.match[id] = n
+			l.advance()
+			l.cond.Broadcast()
+		}
+		l.mu.Unlock()
+	}
+	l.mu.Lock()
+	p.dead = true
+	delete(l.peers, p)
+	l.cond.Broadcast()
+	l.mu.Unlock()
+	conn.Close()
+}
+
+// send ships p what it hasn't had: entries, then the commit index.
+func (l *Leader) send(p *peer) {
+	w := bufio.NewWriter(p.conn)
+	for {
+		l.mu.Lock()
+		for !l.closed && !p.dead && p.next > len(l.log) && p.commit == l.commit {
+			l.cond.Wait()
+		}
+		if l.closed || p.dead {
+			l.mu.Unlock()
+			return
+		}
+		from, batch, commit := p.next, l.log[p.next-1:], l.commit
+		p.next, p.commit = len(l.log)+1, commit
+		l.mu.Unlock()
+
+		for i, e := range batch {
+			fmt.Fprintf(w, "APPEND %d %s", from+i, e)
+		}
+		fmt.Fprintf(w, "COMMIT %d\n", commit)
+		if err := w.Flush(); err != nil {
+			p.conn.Close() // serve sees it and drops p
+			return
+		}
+	}
+}
+
+// replicas is how many replicas hold entry n; l.mu is held.
+func (l *Leader) replicas(n int) int {
+	c := 1 // the leader
+	for _, m := range l.match {
+		if m >= n {
+			c++
+		}
+	}
+	return c
+}
+
+// advance moves the commit index past every entry a quorum holds;
+// l.mu is held.
+func (l *Leader) advance() {
+	for l.commit < len(l.log) && l.replicas(l.commit+1) >= l.cfg.Quorum {
+		l.commit++
+	}
+}
+
+// Log appends e to the replicated log and waits for a quorum to hold it.
+func (l *Leader) Log(e logger.LogEntry) error {
+	_, err := l.Append(e)
+	return err
+}
+
+// LogCtx is Log, giving up with ctx's error if ctx ends before a quorum
+// holds e. The entry is in the leader's log by then, and may still
+// commit.
+func (l *Leader) LogCtx(ctx context.Context, e logger.LogEntry) error {
+	_, err := l.append(ctx, e)
+	return err
+}
+
+// Append is Log, returning the entry's index too.
+func (l *Leader) Append(e logger.LogEntry) (int, error) {
+	return l.append(context.Background(), e)
+}
+
+func (l *Leader) append(ctx context.Context, e logger.LogEntry) (int, error) {
+	if strings.ContainsAny(e.Level+e.Context+e.Message, "\n") {
+		return 0, errors.New("replog: an entry can't contain a newline")
+	}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return 0, ErrClosed
+	}
+	// The leader's own copy goes to disk first, under the lock, so the
+	// WAL is in index order, and so are the stamps.
+	e = l.clock.Tag(e)
+	if err := l.wal.Log(e); err != nil {
+		l.mu.Unlock()
+		return 0, err
+	}
+	l.log = append(l.log, e)
+	n := len(l.log)
+	l.advance()
+	l.cond.Broadcast()
+
+	expired := false
+	t := time.AfterFunc(l.cfg.Timeout, func() {
+		l.mu.Lock()
+		expired = true
+		l.cond.Broadcast()
+		l.mu.Unlock()
+	})
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		l.cond.Broadcast()
+		l.mu.Unlock()
+	})
+	for l.commit < n && !expired && !l.closed && ctx.Err() == nil {
+		l.cond.Wait()
+	}
+	t.Stop()
+	stop()
+	defer l.mu.Unlock()
+	switch {
+	case l.commit >= n:
+		return n, nil
+	case l.closed:
+		return n, ErrClosed
+	case ctx.Err() != nil:
+		return n, ctx.Err()
+	}
+	l.noQuorum++
+	return n, ErrNoQuorum
+}
+
+// Stats returns the counts so far.
+func (l *Leader) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{Entries: len(l.log), Committed: l.commit, NoQuorum: l.noQuorum, Followers: len(l.peers)}
+}
+
+// WaitFollowers waits up to d for n followers to be connected.
+func (l *Leader) WaitFollowers(n int, d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for {
+		l.mu.Lock()
+		have := len(l.peers)
+		l.mu.Unlock()
+		if have >= n {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("replog: %d of %d followers connected after %v", have, n, d)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Close stops the leader, dropping every follower, and closes its log.
+func (l *Leader) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return ErrClosed
+	}
+	l.closed = true
+	for p := range l.peers {
+		p.conn.Close()
+	}
+	l.cond.Broadcast()
+	l.mu.Unlock()
+	l.ln.Close()
+	return l.wal.Close()
+}
+
+// Faults are failures a follower injects.
+type Faults struct {
+	CrashAfter int           // stop, as if killed, after this many entries (0: never)
+	Drop       float64       // probability of not acknowledging a batch
+	Delay      time.Duration // wait before each acknowledgment
+	NoSync     bool          // acknowledge before the entries are synced
+	Seed       int64
+}
+
+// Follow connects to the leader at addr as follower id, keeping its log
+// at walPath, and follows until the connection ends.
+func Follow(addr string, id int, walPath string, f Faults) error {
+	last, err := ReadLog(walPath)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(walPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// Cut off a torn last line, so the next entry starts a line.
+	size := 0
+	for _, e := range last {
+		size += len(e.String())
+	}
+	if err := file.Truncate(int64(size)); err != nil {
+		return err
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := fmt.Fprintf(conn, "HELLO %d %d\n", id, len(last)); err != nil {
+		return err
+	}
+
+	rng := rand.New(rand.NewSource(f.Seed + int64(id)))
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(file)
+	have, got := len(last), 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil // the leader closed or died, mid-message or not
+		}
+		switch {
+		case strings.HasPrefix(line, "APPEND "):
+			idx, entry, _ := strings.Cut(line[len("APPEND "):], " ")
+			n, err := strconv.Atoi(idx)
+			if err != nil {
+				return fmt.Errorf("replog: bad message %q", line)
+			}
+			if n != have+1 {
+				continue // already have it, from before a reconnect
+			}
+			if _, err := w.WriteString(entry); err != nil {
+				return err
+			}
+			have++
+			if got++; f.CrashAfter > 0 && got >= f.CrashAfter {
+				w.Flush() // what the OS had is what a kill leaves
+				return ErrCrash
+			}
+		case strings.HasPrefix(line, "COMMIT "):
+		default:
+			return fmt.Errorf("replog: bad message %q", line)
+		}
+		if r.Buffered() > 0 {
+			continue // more to come: group the sync and the acknowledgment
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if !f.NoSync {
+			if err := file.Sync(); err != nil {
+				return err
+			}
+		}
+		if f.Drop > 0 && rng.Float64() < f.Drop {
+			continue
+		}
+		if f.Delay > 0 {
+			time.Sleep(f.Delay)
+		}
+		if _, err := fmt.Fprintf(conn, "ACK %d\n", have); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadLog reads a log file written by a leader or follower, as far as
+// its entries parse; a missing file is an empty log.
+func ReadLog(path string) ([]logger.LogEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []logger.LogEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		e, err := logger.ParseEntry(sc.Text())
+		if err != nil {
+			break // a torn last line
+		}
+		out = append(out, e)
+	}
+	return out, sc.Err()
+}
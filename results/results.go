@@ -0,0 +1,330 @@
+// Package results keeps a record of benchmark runs, so that a run can be
+// compared with an earlier one and a slowdown noticed. A Run is one
+// invocation of a benchmark: its name, every setting it ran with, the
+// git revision and the host it ran on, and the metrics it measured, each
+// of which knows whether lower or higher is better. Runs are appended to
+// a JSON-lines file, one run per line, which needs nothing but the
+// standard library and survives being concatenated or edited by hand.
+//
+// Compare lines up the metrics two runs share and flags those that got
+// worse by more than a threshold.
+package results
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Better says which way a metric improves.
+type Better int
+
+const (
+	Lower  Better = iota // times, latencies, sizes
+	Higher               // throughputs
+)
+
+func (b Better) String() string {
+	switch b {
+	case Lower:
+		return "lower"
+	case Higher:
+		return "higher"
+	}
+	return fmt.Sprintf("Better(%d)", int(b))
+}
+
+// ParseBetter accepts "lower" or "higher".
+func ParseBetter(s string) (Better, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "lower", "less", "min":
+		return Lower, nil
+	case "higher", "more", "max":
+		return Higher, nil
+	}
+	return 0, fmt.Errorf("results: unknown direction %q (lower, higher)", s)
+}
+
+func (b Better) MarshalText() ([]byte, error) { return []byte(b.String()), nil }
+
+func (b *Better) UnmarshalText(text []byte) error {
+	v, err := ParseBetter(string(text))
+	*b = v
+	return err
+}
+
+// Metric is one number a run measured.
+type Metric struct {
+	Name   string  `json:"name"`
+	Value  float64 `json:"value"`
+	Unit   string  `json:"unit,omitempty"`
+	Better Better  `json:"better"`
+}
+
+// Duration is a time metric, in nanoseconds; lower is better.
+func Duration(name string, d time.Duration) Metric {
+	return Metric{Name: name, Value: float64(d.Nanoseconds()), Unit: "ns", Better: Lower}
+}
+
+// Rate is a throughput metric in unit (such as "ops/s"); higher is better.
+func Rate(name string, v float64, unit string) Metric {
+	return Metric{Name: name, Value: v, Unit: unit, Better: Higher}
+}
+
+// Format formats v in unit: nanoseconds as a duration, anything else with
+// a k, M or G prefix.
+func Format(v float64, unit string) string {
+	if unit == "ns" {
+		return time.Duration(v).String()
+	}
+	for _, p := range []struct {
+		scale  float64
+		prefix string
+	}{{1e9, "G"}, {1e6, "M"}, {1e3, "k"}} {
+		if v >= p.scale || v <= -p.scale {
+			return fmt.Sprintf("%.2f%s %s", v/p.scale, p.prefix, unit)
+		}
+	}
+	return fmt.Sprintf("%.4g %s", v, unit)
+}
+
+func (m Metric) String() string { return m.Name + " " + Format(m.Value, m.Unit) }
+
+// Host is the machine a run ran on.
+type Host struct {
+	Name     string `json:"name"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	CPUs     int    `json:"cpus"`
+	MaxProcs int    `json:"gomaxprocs"`
+	Go       string `json:"go"`
+}
+
+// CurrentHost describes this machine.
+func CurrentHost() Host {
+	name, _ := os.Hostname()
+	return Host{Name: name, OS: runtime.GOOS, Arch: runtime.GOARCH, CPUs: runtime.NumCPU(),
+		MaxProcs: runtime.GOMAXPROCS(0), Go: runtime.Version()}
+}
+
+func (h Host) String() string {
+	return fmt.Sprintf("%s (%s/%s, %d CPUs, GOMAXPROCS %d, %s)", h.Name, h.OS, h.Arch, h.CPUs, h.MaxProcs, h.Go)
+}
+
+// Run is one invocation of a benchmark.
+type Run struct {
+	Bench   string            `json:"bench"`
+	Time    time.Time         `json:"time"`
+	Rev     string            `json:"rev"`
+	Host    Host              `json:"host"`
+	Config  map[string]string `json:"config,omitempty"`
+	Metrics []Metric          `json:"metrics"`
+}
+
+// NewRun stamps a run of bench, made with config, with the time, the
+// revision and the host.
+func NewRun(bench string, config map[string]string, metrics ...Metric) Run {
+	return Run{Bench: bench, Time: time.Now().UTC().Truncate(time.Second), Rev: Revision(),
+		Host: CurrentHost(), Config: config, Metrics: metrics}
+}
+
+// Metric returns the metric called name, if the run has one.
+func (r Run) Metric(name string) (Metric, bool) {
+	for _, m := range r.Metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Metric{}, false
+}
+
+// Revision is the git revision the running binary was built from, with
+// "+dirty" if the tree had uncommitted changes, or "unknown". It comes
+// from the build info "go build" stamps into a binary, or failing that
+// (as under "go run") from git itself.
+func Revision() string {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		var rev, modified string
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				rev = s.Value
+			case "vcs.modified":
+				modified = s.Value
+			}
+		}
+		if rev != "" {
+			return shortRev(rev, modified == "true")
+		}
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "unknown"
+	}
+	status, err := exec.Command("git", "status", "--porcelain", "--untracked-files=no").Output()
+	return shortRev(strings.TrimSpace(string(out)), err == nil && len(status) > 0)
+}
+
+func shortRev(rev string, dirty bool) string {
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	if dirty {
+		rev += "+dirty"
+	}
+	return rev
+}
+
+// RecordFlag is the name of the flag that asks a benchmark to record
+// its run; FlagConfig leaves it out.
+const RecordFlag = "record"
+
+// FlagConfig returns every flag of fs with its value, set or default.
+func FlagConfig(fs *flag.FlagSet) map[string]string {
+	c := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name != RecordFlag {
+			c[f.Name] = f.Value.String()
+		}
+	})
+	return c
+}
+
+// Append adds r to the end of the store at path, creating it.
+func Append(path string, r Run) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads every run in the store at path, oldest first.
+func Load(path string) ([]Run, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var runs []Run
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+	for n := 1; sc.Scan(); n++ {
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+		var r Run
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("results: %s:%d: %v", path, n, err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, sc.Err()
+}
+
+// ErrNoRun is returned by Pick when no run matches.
+var ErrNoRun = errors.New("results: no such run")
+
+// Pick returns the index in runs of the i-th run of bench (every run if
+// bench is ""), counting from 1; a negative i counts back from the last.
+func Pick(runs []Run, bench string, i int) (int, error) {
+	var idx []int
+	for j, r := range runs {
+		if bench == "" || r.Bench == bench {
+			idx = append(idx, j)
+		}
+	}
+	if i < 0 {
+		i += len(idx) + 1
+	}
+	if i < 1 || i > len(idx) {
+		return 0, ErrNoRun
+	}
+	return idx[i-1], nil
+}
+
+// Delta is how one metric changed from a base run to a head run.
+type Delta struct {
+	Metric     string
+	Unit       string
+	Better     Better
+	Base, Head float64
+	Change     float64 // (Head-Base)/Base; +0.10 is 10% more
+	Regression bool    // worse by more than the threshold
+}
+
+// Compare lines up the metrics base and head share, in head's order, and
+// marks those that got worse by more than threshold (0.05 is 5%).
+func Compare(base, head Run, threshold float64) []Delta {
+	var ds []Delta
+	for _, h := range head.Metrics {
+		b, ok := base.Metric(h.Name)
+		if !ok {
+			continue
+		}
+		d := Delta{Metric: h.Name, Unit: h.Unit, Better: h.Better, Base: b.Value, Head: h.Value}
+		if b.Value != 0 {
+			d.Change = (h.Value - b.Value) / b.Value
+		}
+		worse := d.Change
+		if h.Better == Higher {
+			worse = -worse
+		}
+		d.Regression = worse > threshold
+		ds = append(ds, d)
+	}
+	return ds
+}
+
+// Only returns the names of the metrics in a that b doesn't have.
+func Only(a, b Run) []string {
+	var names []string
+	for _, m := range a.Metrics {
+		if _, ok := b.Metric(m.Name); !ok {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+// ConfigDiff describes the settings that differ between two runs, as
+// "name: base -> head", sorted by name.
+func ConfigDiff(base, head Run) []string {
+	var diffs []string
+	for k, h := range head.Config {
+		if b, ok := base.Config[k]; !ok || b != h {
+			diffs = append(diffs, fmt.Sprintf("%s: %s -> %s", k, orNone(b, ok), h))
+		}
+	}
+	for k, b := range base.Config {
+		if _, ok := head.Config[k]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: %s -> (none)", k, b))
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
+
+func orNone(s string, ok bool) string {
+	if !ok {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,218 @@
+// Package rwlock solves the readers-writers problem three ways, each on
+// the semaphores of package locks, which differ in who goes first when
+// readers and writers contend:
+//
+//   - ReaderPref lets a reader in whenever others are reading, so a
+//     steady stream of overlapping readers starves writers forever;
+//   - WriterPref stops admitting readers once a writer is waiting, so a
+//     steady stream of writers starves readers instead;
+//   - Fair queues readers and writers together in arrival order through
+//     a FIFO turnstile, so neither starves: a writer waits only for the
+//     readers already in and those queued ahead of it.
+package rwlock
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"example.com/operating-systems/locks"
+)
+
+// RWLock is a readers-writers lock.
+type RWLock interface {
+	RLock()
+	RUnlock()
+	Lock()
+	Unlock()
+}
+
+// Kind names an implementation.
+type Kind int
+
+const (
+	ReaderPreference Kind = iota
+	WriterPreference
+	FairFIFO
+	// Mutex is sync.RWMutex, the runtime's own, for comparison.
+	Mutex
+)
+
+// Kinds lists every implementation.
+var Kinds = []Kind{ReaderPreference, WriterPreference, FairFIFO, Mutex}
+
+func (k Kind) String() string {
+	switch k {
+	case ReaderPreference:
+		return "reader-pref"
+	case WriterPreference:
+		return "writer-pref"
+	case FairFIFO:
+		return "fair"
+	case Mutex:
+		return "sync.RWMutex"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// ParseKind returns the implementation named s.
+func ParseKind(s string) (Kind, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "reader-pref", "reader", "readers":
+		return ReaderPreference, nil
+	case "writer-pref", "writer", "writers":
+		return WriterPreference, nil
+	case "fair", "fifo":
+		return FairFIFO, nil
+	case "sync.rwmutex", "rwmutex", "sync", "go":
+		return Mutex, nil
+	}
+	return 0, fmt.Errorf("rwlock: unknown kind %q (reader-pref, writer-pref, fair, rwmutex)", s)
+}
+
+// New returns a new lock of kind k.
+func New(k Kind) (RWLock, error) {
+	switch k {
+	case ReaderPreference:
+		return NewReaderPref(), nil
+	case WriterPreference:
+		return NewWriterPref(), nil
+	case FairFIFO:
+		return NewFair(), nil
+	case Mutex:
+		return &sync.RWMutex{}, nil
+	}
+	return nil, fmt.Errorf("rwlock: unknown kind %v", k)
+}
+
+// ReaderPref is OSTEP's reader-writer lock (Figure 31.13): the first
+// reader in takes the write lock for all of them and the last one out
+// gives it back.
+type ReaderPref struct {
+	mu      *locks.Semaphore // guards readers
+	write   *locks.Semaphore // held by a writer, or by the readers together
+	readers int
+}
+
+func NewReaderPref() *ReaderPref {
+	return &ReaderPref{mu: locks.NewSemaphore(1), write: locks.NewSemaphore(1)}
+}
+
+func (l *ReaderPref) RLock() {
+	l.mu.Wait()
+	l.readers++
+	if l.readers == 1 {
+		l.write.Wait()
+	}
+	l.mu.Post()
+}
+
+func (l *ReaderPref) RUnlock() {
+	l.mu.Wait()
+	l.readers--
+	if l.readers == 0 {
+		l.write.Post()
+	}
+	l.mu.Post()
+}
+
+func (l *ReaderPref) Lock()   { l.write.Wait() }
+func (l *ReaderPref) Unlock() { l.write.Post() }
+
+// WriterPref is Courtois, Heymans and Parnas's second solution: the first
+// waiting writer closes readTry behind the readers already in, and the
+// last writer out opens it again.
+type WriterPref struct {
+	rmu, wmu         *locks.Semaphore // guard readers and writers
+	readTry          *locks.Semaphore // readers pass through it; writers hold it shut
+	resource         *locks.Semaphore // held by a writer, or by the readers together
+	readers, writers int              // readers in, writers in or waiting
+}
+
+func NewWriterPref() *WriterPref {
+	return &WriterPref{rmu: locks.NewSemaphore(1), wmu: locks.NewSemaphore(1),
+		readTry: locks.NewSemaphore(1), resource: locks.NewSemaphore(1)}
+}
+
+func (l *WriterPref) RLock() {
+	l.readTry.Wait()
+	l.rmu.Wait()
+	l.readers++
+	if l.readers == 1 {
+		l.resource.Wait()
+	}
+	l.rmu.Post()
+	l.readTry.Post()
+}
+
+func (l *WriterPref) RUnlock() {
+	l.rmu.Wait()
+	l.readers--
+	if l.readers == 0 {
+		l.resource.Post()
+	}
+	l.rmu.Post()
+}
+
+func (l *WriterPref) Lock() {
+	l.wmu.Wait()
+	l.writers++
+	if l.writers == 1 {
+		l.readTry.Wait()
+	}
+	l.wmu.Post()
+	l.resource.Wait()
+}
+
+func (l *WriterPref) Unlock() {
+	l.resource.Post()
+	l.wmu.Wait()
+	l.writers--
+	if l.writers == 0 {
+		l.readTry.Post()
+	}
+	l.wmu.Post()
+}
+
+// Fair is the third readers-writers solution: everyone goes through the
+// queue turnstile, in arrival order since the semaphore is FIFO, and a
+// writer holds it until the readers ahead of it have left, so no reader
+// behind it gets past.
+type Fair struct {
+	queue    *locks.Semaphore // the turnstile
+	rmu      *locks.Semaphore // guards readers
+	resource *locks.Semaphore // held by a writer, or by the readers together
+	readers  int
+}
+
+func NewFair() *Fair {
+	return &Fair{queue: locks.NewSemaphore(1), rmu: locks.NewSemaphore(1), resource: locks.NewSemaphore(1)}
+}
+
+func (l *Fair) RLock() {
+	l.queue.Wait()
+	l.rmu.Wait()
+	l.readers++
+	if l.readers == 1 {
+		l.resource.Wait()
+	}
+	l.queue.Post()
+	l.rmu.Post()
+}
+
+func (l *Fair) RUnlock() {
+	l.rmu.Wait()
+	l.readers--
+	if l.readers == 0 {
+		l.resource.Post()
+	}
+	l.rmu.Post()
+}
+
+func (l *Fair) Lock() {
+	l.queue.Wait()
+	l.resource.Wait()
+	l.queue.Post()
+}
+
+func (l *Fair) Unlock() { l.resource.Post() }
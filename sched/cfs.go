@@ -0,0 +1,125 @@
+package sched
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+)
+
+// CFS models Linux's Completely Fair Scheduler. Every job accumulates
+// virtual runtime, its CPU time scaled by 1024/weight, where the weight
+// comes from its nice value (each nice step is about 10% more or less CPU).
+// The runqueue is a min-heap on vruntime and the job furthest behind always
+// runs next, for a slice of Latency split among runnable jobs by weight
+// (never below MinGranularity). A new job starts at the queue's minimum
+// vruntime so it can't starve everyone by arriving with zero. Like Linux's
+// wakeup preemption, an arriving job gets a chance to run immediately.
+type CFS struct {
+	Latency        int // targeted latency: every runnable job runs once per period
+	MinGranularity int // shortest slice handed out
+
+	rq          cfsQueue
+	minVruntime float64
+	vruntime    map[int]float64
+	jobs        []*Proc // every job seen, by Proc.ID, for the report
+}
+
+// NewCFS returns a CFS with the given targeted latency and minimum slice.
+func NewCFS(latency, minGranularity int) (*CFS, error) {
+	if latency < 1 || minGranularity < 1 {
+		return nil, fmt.Errorf("cfs latency and min granularity must be at least 1, got %d and %d", latency, minGranularity)
+	}
+	return &CFS{Latency: latency, MinGranularity: minGranularity, vruntime: map[int]float64{}}, nil
+}
+
+func (c *CFS) Name() string {
+	return fmt.Sprintf("CFS(latency=%d min=%d)", c.Latency, c.MinGranularity)
+}
+
+func (c *CFS) Preemptive() bool { return true }
+func (c *CFS) Len() int         { return len(c.rq) }
+
+func (c *CFS) Ready(p *Proc, now int) {
+	vr, seen := c.vruntime[p.ID]
+	if !seen {
+		vr = c.minVruntime // newcomers start level with the queue
+		for len(c.jobs) <= p.ID {
+			c.jobs = append(c.jobs, nil)
+		}
+		c.jobs[p.ID] = p
+	} else {
+		vr += float64(p.LastRan) * nice0Weight / float64(Weight(p.Nice))
+	}
+	c.vruntime[p.ID] = vr
+	heap.Push(&c.rq, cfsEntry{p, vr})
+}
+
+func (c *CFS) Pick(now int) (*Proc, int) {
+	total := 0
+	for _, e := range c.rq {
+		total += Weight(e.p.Nice)
+	}
+	e := heap.Pop(&c.rq).(cfsEntry)
+	c.minVruntime = max(c.minVruntime, e.vruntime)
+	slice := max(c.Latency*Weight(e.p.Nice)/total, c.MinGranularity)
+	return e.p, slice
+}
+
+// Report lists each job's nice value, weight, and final virtual runtime.
+func (c *CFS) Report() string {
+	var b strings.Builder
+	b.WriteString("  cfs:\n")
+	for _, p := range c.jobs {
+		if p == nil {
+			continue
+		}
+		vr := c.vruntime[p.ID] + float64(p.LastRan)*nice0Weight/float64(Weight(p.Nice)) // include the final run
+		fmt.Fprintf(&b, "    %-6s nice=%d weight=%d vruntime=%.1f\n", p.Name, p.Nice, Weight(p.Nice), vr)
+	}
+	return b.String()
+}
+
+// nice0Weight is the weight of a nice 0 job.
+const nice0Weight = 1024
+
+// niceWeights is Linux's sched_prio_to_weight table, nice -20 through 19.
+var niceWeights = [40]int{
+	88761, 71755, 56483, 46273, 36291,
+	29154, 23254, 18705, 14949, 11916,
+	9548, 7620, 6100, 4904, 3906,
+	3121, 2501, 1991, 1586, 1277,
+	1024, 820, 655, 526, 423,
+	335, 272, 215, 172, 137,
+	110, 87, 70, 56, 45,
+	36, 29, 23, 18, 15,
+}
+
+// Weight returns the CFS weight of a nice value (clamped to -20..19).
+func Weight(nice int) int {
+	return niceWeights[min(max(nice, -20), 19)+20]
+}
+
+// cfsEntry is a runnable job keyed by its vruntime when it was queued.
+type cfsEntry struct {
+	p        *Proc
+	vruntime float64
+}
+
+// cfsQueue is a min-heap of runnable jobs by vruntime (ties: workload order).
+type cfsQueue []cfsEntry
+
+func (q cfsQueue) Len() int { return len(q) }
+func (q cfsQueue) Less(i, j int) bool {
+	if q[i].vruntime != q[j].vruntime {
+		return q[i].vruntime < q[j].vruntime
+	}
+	return q[i].p.ID < q[j].p.ID
+}
+func (q cfsQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *cfsQueue) Push(x any)   { *q = append(*q, x.(cfsEntry)) }
+func (q *cfsQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,228 @@
+package sched
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Executor runs a workload for real instead of simulating it: each job is a
+// CPU-bound task (a busy loop calibrated to burn Burst ticks of CPU, one
+// tick = Tick of wall time), released at its arrival time and dispatched to
+// a pool of Workers goroutines by the same Policy the simulator uses. Work
+// is done a tick at a time, so time slices and (for preemptive policies)
+// preemption on arrival behave as in the simulator. A job that does I/O
+// gives its worker back and sleeps for IOTime ticks at each request. What
+// comes back is the measured turnaround, response, and waiting time of
+// every job.
+type Executor struct {
+	Workers int
+	Tick    time.Duration
+}
+
+// ExecStats is what happened to one job in a real run.
+type ExecStats struct {
+	Job
+	Turnaround time.Duration // done - arrival
+	Response   time.Duration // first dispatch - arrival
+	Waiting    time.Duration // turnaround - burst - nominal I/O time
+}
+
+// ExecResult is a finished real run.
+type ExecResult struct {
+	Policy   string
+	Workers  int
+	Tick     time.Duration
+	Jobs     []ExecStats // in workload order
+	Timeline []Slice     // in ticks since the start, Slice.CPU = worker
+	Elapsed  time.Duration
+}
+
+// Averages returns the mean turnaround, response, and waiting times.
+func (r ExecResult) Averages() (turnaround, response, waiting time.Duration) {
+	if len(r.Jobs) == 0 {
+		return 0, 0, 0
+	}
+	for _, s := range r.Jobs {
+		turnaround += s.Turnaround
+		response += s.Response
+		waiting += s.Waiting
+	}
+	n := time.Duration(len(r.Jobs))
+	return turnaround / n, response / n, waiting / n
+}
+
+// Run executes jobs under policy p and measures them.
+func (e Executor) Run(jobs []Job, p Policy) (ExecResult, error) {
+	if e.Workers < 1 || e.Tick <= 0 {
+		return ExecResult{}, fmt.Errorf("executor needs at least 1 worker and a positive tick, got %d and %v", e.Workers, e.Tick)
+	}
+	procs := make([]*Proc, len(jobs))
+	for i, j := range jobs {
+		if err := j.validate(); err != nil {
+			return ExecResult{}, err
+		}
+		procs[i] = &Proc{Job: j, ID: i, Remaining: j.Burst, FirstRun: -1, untilIO: j.IOEvery}
+	}
+	pending := append([]*Proc(nil), procs...)
+	sort.SliceStable(pending, func(a, b int) bool { return pending[a].Arrival < pending[b].Arrival })
+	spins := calibrate(e.Tick)
+	leveler, _ := p.(Leveler)
+
+	var (
+		mu       sync.Mutex // guards p, procs, and everything below
+		cond     = sync.NewCond(&mu)
+		left     = len(procs)
+		firstRun = make([]time.Time, len(procs))
+		doneAt   = make([]time.Time, len(procs))
+		timeline []Slice
+		arrivals atomic.Uint64 // bumped on every arrival and I/O completion; preemptive policies re-pick
+	)
+	start := time.Now()
+	now := func() int { return int(time.Since(start) / e.Tick) }
+
+	// release readies pr once the clock reaches at
+	release := func(pr *Proc, at time.Time) {
+		time.Sleep(time.Until(at))
+		mu.Lock()
+		p.Ready(pr, now())
+		mu.Unlock()
+		arrivals.Add(1)
+		cond.Signal()
+	}
+
+	// Release each job at its arrival time
+	go func() {
+		for _, pr := range pending {
+			release(pr, start.Add(time.Duration(pr.Arrival)*e.Tick))
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < e.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			for {
+				for p.Len() == 0 && left > 0 {
+					cond.Wait()
+				}
+				if left == 0 {
+					return
+				}
+				cur, slice := p.Pick(now())
+				level := 0
+				if leveler != nil {
+					level = leveler.Level(cur)
+				}
+				if firstRun[cur.ID].IsZero() {
+					firstRun[cur.ID] = time.Now()
+				}
+				run := cur.Remaining
+				if slice > 0 {
+					run = min(run, slice)
+				}
+				if cur.IOEvery > 0 {
+					run = min(run, cur.untilIO)
+				}
+				seen := arrivals.Load()
+				from := now()
+				mu.Unlock()
+
+				// The task itself, a tick at a time
+				ran := 0
+				for ran < run {
+					burn(spins)
+					ran++
+					// Yield between ticks: with fewer cores than workers, Go's own
+					// scheduler would otherwise only preempt us every ~10ms, late
+					// for arrivals and for the other workers
+					runtime.Gosched()
+					if p.Preemptive() && arrivals.Load() != seen {
+						break
+					}
+				}
+
+				mu.Lock()
+				timeline = append(timeline, Slice{Proc: cur.ID, Start: from, End: now(), Level: level, CPU: w})
+				cur.Remaining -= ran
+				cur.LastRan = ran
+				cur.untilIO -= ran
+				switch {
+				case cur.Remaining == 0:
+					doneAt[cur.ID] = time.Now()
+					left--
+					if left == 0 {
+						cond.Broadcast() // wake the idle workers so they can exit
+					}
+				case cur.IOEvery > 0 && cur.untilIO == 0:
+					// Block on I/O: the worker moves on and the job comes back later
+					cur.untilIO = cur.IOEvery
+					cur.IO += cur.IOTime
+					go release(cur, time.Now().Add(time.Duration(cur.IOTime)*e.Tick))
+				default:
+					p.Ready(cur, now())
+					cond.Signal()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	res := ExecResult{Policy: p.Name(), Workers: e.Workers, Tick: e.Tick, Timeline: timeline, Elapsed: time.Since(start)}
+	res.Jobs = make([]ExecStats, len(procs))
+	for i, pr := range procs {
+		arrived := start.Add(time.Duration(pr.Arrival) * e.Tick)
+		t := doneAt[i].Sub(arrived)
+		res.Jobs[i] = ExecStats{Job: pr.Job, Turnaround: t, Response: firstRun[i].Sub(arrived), Waiting: t - time.Duration(pr.Burst+pr.IO)*e.Tick}
+	}
+	return res, nil
+}
+
+// Format renders a real run as a per-job table in milliseconds.
+func (r ExecResult) Format() string {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s on %d worker(s), tick=%v, elapsed=%v\n", r.Policy, r.Workers, r.Tick, r.Elapsed.Round(time.Microsecond))
+	fmt.Fprintf(&b, "  %-6s %8s %6s %15s %13s %12s\n", "job", "arrival", "burst", "turnaround ms", "response ms", "waiting ms")
+	for _, s := range r.Jobs {
+		fmt.Fprintf(&b, "  %-6s %8d %6d %15.2f %13.2f %12.2f\n", s.Name, s.Arrival, s.Burst, ms(s.Turnaround), ms(s.Response), ms(s.Waiting))
+	}
+	t, resp, w := r.Averages()
+	fmt.Fprintf(&b, "  %-6s %8s %6s %15.2f %13.2f %12.2f\n", "avg", "", "", ms(t), ms(resp), ms(w))
+	return b.String()
+}
+
+// spinSink keeps the busy loop from being optimized away.
+var spinSink atomic.Uint64
+
+// burn spins for n iterations of an xorshift loop (real CPU work, unlike a
+// sleep: with more workers than cores the tasks really compete).
+func burn(n int) {
+	x := uint64(1469598103934665603)
+	for i := 0; i < n; i++ {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+	}
+	spinSink.Add(x & 1)
+}
+
+// calibrate returns how many burn iterations take about one tick.
+func calibrate(tick time.Duration) int {
+	n := 1 << 10
+	for {
+		start := time.Now()
+		burn(n)
+		if d := time.Since(start); d >= 20*time.Millisecond {
+			return max(int(float64(n)*float64(tick)/float64(d)), 1)
+		}
+		n *= 2
+	}
+}
@@ -0,0 +1,181 @@
+package sched
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// Job states on a Gantt chart, by priority when several fall in one column.
+const (
+	absent  = iota // not arrived yet, or finished
+	ready          // runnable, waiting for the CPU
+	blocked        // waiting on I/O
+	running
+)
+
+// states returns, for every job, its state at every tick up to span.
+func (r Result) states(span int) [][]int {
+	st := make([][]int, len(r.Jobs))
+	for id, j := range r.Jobs {
+		st[id] = make([]int, span)
+		for t := j.Arrival; t < min(j.Completion, span); t++ {
+			st[id][t] = ready
+		}
+	}
+	mark := func(slices []Slice, state int) {
+		for _, s := range slices {
+			for t := s.Start; t < min(s.End, span); t++ {
+				st[s.Proc][t] = state
+			}
+		}
+	}
+	mark(r.Blocked, blocked)
+	mark(r.Timeline, running)
+	return st
+}
+
+// Gantt draws the run as an ASCII chart at most width columns wide, one row
+// per job: '#' running (the level digit for policies with levels), '.'
+// ready, '~' blocked on I/O. span is the tick the chart ends at; pass the
+// largest makespan of several results to draw them to the same scale (0 =
+// this result's own makespan).
+func (r Result) Gantt(width, span int) string {
+	if span <= 0 {
+		span = r.Makespan
+	}
+	span = max(span, 1)
+	width = max(width, 10)
+	scale := (span + width - 1) / width // ticks per column
+	cols := (span + scale - 1) / scale
+	st := r.states(span)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  (1 column = %d tick(s))\n", r.Policy, scale)
+	axis := []byte(strings.Repeat(" ", cols+8))
+	for c := 0; c < cols; c += 10 {
+		copy(axis[c:], fmt.Sprint(c*scale))
+	}
+	fmt.Fprintf(&b, "  %-6s %s\n", "", strings.TrimRight(string(axis), " "))
+	for id, j := range r.Jobs {
+		row := make([]byte, cols)
+		for c := range row {
+			state := absent
+			for t := c * scale; t < min((c+1)*scale, span); t++ {
+				state = max(state, st[id][t])
+			}
+			row[c] = " .~#"[state]
+		}
+		if r.Levels {
+			r.levelDigits(id, row, scale)
+		}
+		fmt.Fprintf(&b, "  %-6s %s\n", j.Name, strings.TrimRight(string(row), " "))
+	}
+	b.WriteString("  # running  . ready  ~ I/O")
+	if r.Levels {
+		b.WriteString("  (digits: running at that level)")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// levelDigits replaces a job's '#' columns with the level it ran at.
+func (r Result) levelDigits(id int, row []byte, scale int) {
+	for _, s := range r.Timeline {
+		if s.Proc != id {
+			continue
+		}
+		for c := s.Start / scale; c <= (s.End-1)/scale && c < len(row); c++ {
+			if row[c] == '#' {
+				row[c] = "0123456789"[min(s.Level, 9)]
+			}
+		}
+	}
+}
+
+// palette colors jobs on the SVG chart, cycling when there are more jobs.
+var palette = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+
+// WriteSVG draws results as Gantt charts stacked in one SVG image, all on
+// the same time axis so policies can be compared at a glance: a colored
+// bar per CPU slice, a thin gray line while a job is ready, and a hatched
+// bar while it is blocked on I/O.
+func WriteSVG(w io.Writer, results []Result) error {
+	const (
+		left, right = 70, 20 // margins, px
+		rowH, barH  = 18, 12
+		titleH      = 26
+		axisH       = 22
+		plotW       = 900
+	)
+	span := 1
+	height := 10
+	for _, r := range results {
+		span = max(span, r.Makespan)
+		height += titleH + rowH*len(r.Jobs) + axisH
+	}
+	x := func(t int) float64 { return left + float64(t)*plotW/float64(span) }
+	step := axisStep(span)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="11">`+"\n", left+plotW+right, height)
+	bw.WriteString(`<defs><pattern id="io" width="4" height="4" patternUnits="userSpaceOnUse" patternTransform="rotate(45)">` +
+		`<rect width="2" height="4" fill="#999"/></pattern></defs>` + "\n")
+	fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	y := 10
+	for _, r := range results {
+		fmt.Fprintf(bw, `<text x="4" y="%d" font-size="13" font-weight="bold">%s</text>`+"\n", y+16, html.EscapeString(r.Policy))
+		y += titleH
+		bottom := y + rowH*len(r.Jobs)
+		for t := 0; t <= span; t += step {
+			fmt.Fprintf(bw, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#eee"/>`+"\n", x(t), y, x(t), bottom)
+		}
+		for id, j := range r.Jobs {
+			mid := y + rowH/2
+			fmt.Fprintf(bw, `<text x="4" y="%d">%s</text>`+"\n", mid+4, html.EscapeString(j.Name))
+			fmt.Fprintf(bw, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#ccc"/>`+"\n", x(j.Arrival), mid, x(j.Completion), mid)
+			color := palette[id%len(palette)]
+			for _, s := range r.Blocked {
+				if s.Proc == id {
+					fmt.Fprintf(bw, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="url(#io)"><title>%s I/O %d-%d</title></rect>`+"\n",
+						x(s.Start), mid-barH/2, x(s.End)-x(s.Start), barH, html.EscapeString(j.Name), s.Start, s.End)
+				}
+			}
+			for _, s := range r.Timeline {
+				if s.Proc != id {
+					continue
+				}
+				tip := fmt.Sprintf("%s %d-%d", j.Name, s.Start, s.End)
+				if r.Levels {
+					tip += fmt.Sprintf(" level %d", s.Level)
+				}
+				fmt.Fprintf(bw, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"><title>%s</title></rect>`+"\n",
+					x(s.Start), mid-barH/2, x(s.End)-x(s.Start), barH, color, html.EscapeString(tip))
+			}
+			y += rowH
+		}
+		// Time axis
+		fmt.Fprintf(bw, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`+"\n", left, y, left+plotW, y)
+		for t := 0; t <= span; t += step {
+			fmt.Fprintf(bw, `<text x="%.1f" y="%d" text-anchor="middle">%d</text>`+"\n", x(t), y+14, t)
+		}
+		y += axisH
+	}
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+// axisStep picks a round tick spacing giving at most about 10 labels.
+func axisStep(span int) int {
+	step := 1
+	for span/step > 10 {
+		if fmt.Sprint(step)[0] == '2' {
+			step = step / 2 * 5 // 2 -> 5, 20 -> 50, ...
+		} else {
+			step *= 2
+		}
+	}
+	return step
+}
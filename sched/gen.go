@@ -0,0 +1,168 @@
+package sched
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Dist is a distribution of integers, written "kind:params":
+//
+//	const:5          always 5
+//	uniform:1,10     1 through 10, equally likely
+//	exp:20           exponential with mean 20 (memoryless arrivals)
+//	normal:50,10     normal with mean 50 and standard deviation 10
+//	pareto:5,1.5     Pareto with minimum 5 and shape 1.5 (heavy-tailed job sizes)
+//
+// Samples are rounded to integers; the Generator clamps them to each
+// field's range.
+type Dist struct {
+	Kind string
+	A, B float64
+}
+
+// ParseDist parses a distribution like "exp:20".
+func ParseDist(s string) (Dist, error) {
+	kind, args, _ := strings.Cut(strings.TrimSpace(s), ":")
+	var p []float64
+	if args != "" {
+		for _, f := range strings.Split(args, ",") {
+			v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+			if err != nil {
+				return Dist{}, fmt.Errorf("distribution %q: bad parameter %q", s, f)
+			}
+			p = append(p, v)
+		}
+	}
+	want := map[string]int{"const": 1, "uniform": 2, "exp": 1, "normal": 2, "pareto": 2}
+	n, ok := want[kind]
+	switch {
+	case !ok:
+		return Dist{}, fmt.Errorf("distribution %q: unknown kind (use const, uniform, exp, normal, or pareto)", s)
+	case len(p) != n:
+		return Dist{}, fmt.Errorf("distribution %q: %s takes %d parameter(s)", s, kind, n)
+	case kind == "uniform" && p[1] < p[0]:
+		return Dist{}, fmt.Errorf("distribution %q: uniform needs lo <= hi", s)
+	case kind == "exp" && p[0] <= 0, kind == "pareto" && (p[0] <= 0 || p[1] <= 0):
+		return Dist{}, fmt.Errorf("distribution %q: parameters must be positive", s)
+	}
+	d := Dist{Kind: kind, A: p[0]}
+	if n == 2 {
+		d.B = p[1]
+	}
+	return d, nil
+}
+
+// mustDist is ParseDist for distributions known to be valid.
+func mustDist(s string) Dist {
+	d, err := ParseDist(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Sample draws one value.
+func (d Dist) Sample(r *rand.Rand) int {
+	var v float64
+	switch d.Kind {
+	case "const":
+		v = d.A
+	case "uniform":
+		lo, hi := math.Round(d.A), math.Round(d.B)
+		v = lo + float64(r.Intn(int(hi-lo)+1))
+	case "exp":
+		v = r.ExpFloat64() * d.A
+	case "normal":
+		v = d.A + r.NormFloat64()*d.B
+	case "pareto":
+		v = d.A / math.Pow(1-r.Float64(), 1/d.B)
+	}
+	return int(math.Round(v))
+}
+
+func (d Dist) String() string {
+	if d.Kind == "const" || d.Kind == "exp" {
+		return fmt.Sprintf("%s:%g", d.Kind, d.A)
+	}
+	return fmt.Sprintf("%s:%g,%g", d.Kind, d.A, d.B)
+}
+
+// Generator makes random workloads. Arrivals come in batches: Batch jobs
+// Gap ticks apart, then Idle ticks of quiet before the next batch, so
+// Batch const:1 gives smooth arrivals (Idle is then the inter-arrival
+// time) and larger batches give bursts. A fraction IOJobs of the jobs are
+// interactive: they block for IOTime ticks after every IOEvery ticks of
+// CPU. The same Seed always gives the same workload.
+type Generator struct {
+	Jobs    int
+	Seed    int64
+	Batch   Dist    // jobs per arrival burst (at least 1)
+	Gap     Dist    // ticks between arrivals inside a burst
+	Idle    Dist    // ticks between bursts
+	CPU     Dist    // CPU burst per job (at least 1)
+	Nice    Dist    // nice value per job (clamped to -20..19)
+	IOJobs  float64 // fraction of jobs that do I/O, 0..1
+	IOEvery Dist    // I/O jobs: CPU ticks between requests (at least 1)
+	IOTime  Dist    // I/O jobs: ticks each request blocks
+}
+
+// DefaultGenerator is a mixed workload: Poisson-like arrivals in bursts
+// of up to 4, exponential CPU bursts, a third of the jobs doing I/O.
+func DefaultGenerator() Generator {
+	return Generator{
+		Jobs:    10,
+		Seed:    1,
+		Batch:   mustDist("uniform:1,4"),
+		Gap:     mustDist("const:1"),
+		Idle:    mustDist("exp:30"),
+		CPU:     mustDist("exp:20"),
+		Nice:    mustDist("const:0"),
+		IOJobs:  0.3,
+		IOEvery: mustDist("uniform:2,5"),
+		IOTime:  mustDist("const:10"),
+	}
+}
+
+// Generate returns the workload, in arrival order.
+func (g Generator) Generate() ([]Job, error) {
+	if g.Jobs < 1 {
+		return nil, errors.New("generator needs at least 1 job")
+	}
+	if g.IOJobs < 0 || g.IOJobs > 1 {
+		return nil, fmt.Errorf("I/O job fraction must be between 0 and 1, got %g", g.IOJobs)
+	}
+	r := rand.New(rand.NewSource(g.Seed))
+	jobs := make([]Job, 0, g.Jobs)
+	now := 0
+	for len(jobs) < g.Jobs {
+		n := max(g.Batch.Sample(r), 1)
+		for i := 0; i < n && len(jobs) < g.Jobs; i++ {
+			if i > 0 {
+				now += max(g.Gap.Sample(r), 0)
+			}
+			j := Job{
+				Name:    jobName(len(jobs)),
+				Arrival: now,
+				Burst:   max(g.CPU.Sample(r), 1),
+				Nice:    min(max(g.Nice.Sample(r), -20), 19),
+			}
+			if r.Float64() < g.IOJobs {
+				j.IOEvery = max(g.IOEvery.Sample(r), 1)
+				j.IOTime = max(g.IOTime.Sample(r), 0)
+			}
+			jobs = append(jobs, j)
+		}
+		now += max(g.Idle.Sample(r), 0)
+	}
+	return jobs, nil
+}
+
+// String describes the generator's settings, for the header of a written trace.
+func (g Generator) String() string {
+	return fmt.Sprintf("generated: jobs=%d seed=%d batch=%v gap=%v idle=%v cpu=%v nice=%v io-jobs=%g io-every=%v io-time=%v",
+		g.Jobs, g.Seed, g.Batch, g.Gap, g.Idle, g.CPU, g.Nice, g.IOJobs, g.IOEvery, g.IOTime)
+}
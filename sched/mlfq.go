@@ -0,0 +1,193 @@
+package sched
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MLFQ is the Multi-Level Feedback Queue from OSTEP ch. 8:
+//
+//   - Rule 1/2: the highest non-empty level runs, round robin within a level.
+//   - Rule 3: a new job enters the top level (0).
+//   - Rule 4: once a job has used up its level's allotment it moves down a
+//     level. With accounting on (the default) the allotment counts all CPU
+//     time at the level, however it was split up; with it off, a job that
+//     gives up the CPU before its slice ends keeps its level and starts its
+//     allotment over, which is the rule a job can game.
+//   - Rule 5: every Boost ticks, all jobs go back to the top level.
+//
+// MLFQ is preemptive: a newly arrived job gets the CPU straight away if it
+// outranks the running one.
+type MLFQ struct {
+	quanta     []int // time slice per level, top first
+	allotments []int // CPU time per level before demotion
+	boost      int   // ticks between priority boosts (0 = never)
+	accounting bool  // Rule 4 counts total time at a level (gaming-proof)
+
+	levels    [][]*Proc
+	state     map[int]*mlfqJob
+	nextBoost int
+	names     []string // job names by Proc.ID, for the report
+}
+
+// mlfqJob is MLFQ's bookkeeping for one job.
+type mlfqJob struct {
+	level     int
+	used      int // CPU time used against the current level's allotment
+	slice     int // slice it was given on its latest dispatch
+	demotions int
+	boosts    int
+}
+
+// NewMLFQ builds an MLFQ with one level per quantum. allotments gives each
+// level's allotment (missing entries default to that level's quantum; the
+// bottom level never demotes); boost is the priority boost period (0 = off).
+func NewMLFQ(quanta, allotments []int, boost int, accounting bool) (*MLFQ, error) {
+	if len(quanta) == 0 {
+		return nil, errors.New("mlfq needs at least one level")
+	}
+	m := &MLFQ{
+		quanta:     quanta,
+		allotments: make([]int, len(quanta)),
+		boost:      max(boost, 0),
+		accounting: accounting,
+		levels:     make([][]*Proc, len(quanta)),
+		state:      map[int]*mlfqJob{},
+		nextBoost:  boost,
+	}
+	for i, q := range quanta {
+		if q < 1 {
+			return nil, fmt.Errorf("mlfq level %d: quantum must be at least 1, got %d", i, q)
+		}
+		m.allotments[i] = q
+		if i < len(allotments) {
+			if allotments[i] < 1 {
+				return nil, fmt.Errorf("mlfq level %d: allotment must be at least 1, got %d", i, allotments[i])
+			}
+			m.allotments[i] = allotments[i]
+		}
+	}
+	return m, nil
+}
+
+func (m *MLFQ) Name() string {
+	s := fmt.Sprintf("MLFQ(q=%s", joinInts(m.quanta))
+	if m.boost > 0 {
+		s += fmt.Sprintf(" boost=%d", m.boost)
+	}
+	if !m.accounting {
+		s += " no-accounting"
+	}
+	return s + ")"
+}
+
+func (m *MLFQ) Preemptive() bool { return true }
+
+func (m *MLFQ) Len() int {
+	n := 0
+	for _, q := range m.levels {
+		n += len(q)
+	}
+	return n
+}
+
+func (m *MLFQ) Level(p *Proc) int { return m.state[p.ID].level }
+
+func (m *MLFQ) Ready(p *Proc, now int) {
+	st, ok := m.state[p.ID]
+	if !ok {
+		// Rule 3: new jobs start at the top
+		st = &mlfqJob{}
+		m.state[p.ID] = st
+		for len(m.names) <= p.ID {
+			m.names = append(m.names, "")
+		}
+		m.names[p.ID] = p.Name
+	} else {
+		m.charge(st, p.LastRan)
+	}
+	m.levels[st.level] = append(m.levels[st.level], p)
+}
+
+// charge applies Rule 4 to a job that just came off the CPU after ran ticks.
+func (m *MLFQ) charge(st *mlfqJob, ran int) {
+	st.used += ran
+	bottom := len(m.quanta) - 1
+	switch {
+	case st.level < bottom && st.used >= m.allotments[st.level]:
+		st.level++
+		st.used = 0
+		st.demotions++
+	case !m.accounting && ran < st.slice:
+		st.used = 0 // gave up the CPU early: the old rule forgives it
+	}
+}
+
+func (m *MLFQ) Pick(now int) (*Proc, int) {
+	m.maybeBoost(now)
+	for lvl := range m.levels {
+		if len(m.levels[lvl]) == 0 {
+			continue
+		}
+		p := pop(&m.levels[lvl], 0)
+		st := m.state[p.ID]
+		slice := m.quanta[lvl]
+		if lvl < len(m.quanta)-1 {
+			slice = min(slice, m.allotments[lvl]-st.used)
+		}
+		if m.boost > 0 {
+			slice = min(slice, m.nextBoost-now) // stop at the boost so it happens on time
+		}
+		st.slice = slice
+		return p, slice
+	}
+	return nil, 0 // the engine only calls Pick when Len() > 0
+}
+
+// maybeBoost applies Rule 5 if a boost is due.
+func (m *MLFQ) maybeBoost(now int) {
+	if m.boost == 0 || now < m.nextBoost {
+		return
+	}
+	for m.nextBoost <= now {
+		m.nextBoost += m.boost
+	}
+	// Nothing is on the CPU while Pick runs, so every live job is queued
+	for lvl := range m.levels {
+		for _, p := range m.levels[lvl] {
+			st := m.state[p.ID]
+			if lvl > 0 {
+				st.boosts++
+			}
+			st.level, st.used = 0, 0
+		}
+		if lvl > 0 {
+			m.levels[0] = append(m.levels[0], m.levels[lvl]...)
+			m.levels[lvl] = m.levels[lvl][:0]
+		}
+	}
+}
+
+// Report lists how often each job was demoted and boosted.
+func (m *MLFQ) Report() string {
+	var b strings.Builder
+	b.WriteString("  mlfq:\n")
+	for id, name := range m.names {
+		st, ok := m.state[id]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "    %-6s demotions=%d boosts=%d\n", name, st.demotions, st.boosts)
+	}
+	return b.String()
+}
+
+// joinInts formats a list like "10/20/40".
+func joinInts(v []int) string {
+	s := make([]string, len(v))
+	for i, x := range v {
+		s[i] = fmt.Sprint(x)
+	}
+	return strings.Join(s, "/")
+}
@@ -0,0 +1,124 @@
+package sched
+
+import "fmt"
+
+// FIFO runs jobs to completion in arrival order.
+type FIFO struct{ queue []*Proc }
+
+func (f *FIFO) Name() string              { return "FIFO" }
+func (f *FIFO) Ready(p *Proc, now int)    { f.queue = append(f.queue, p) }
+func (f *FIFO) Len() int                  { return len(f.queue) }
+func (f *FIFO) Preemptive() bool          { return false }
+func (f *FIFO) Pick(now int) (*Proc, int) { return pop(&f.queue, 0), 0 }
+
+// SJF runs the shortest job next, each to completion (non-preemptive).
+type SJF struct{ ready []*Proc }
+
+func (s *SJF) Name() string           { return "SJF" }
+func (s *SJF) Ready(p *Proc, now int) { s.ready = append(s.ready, p) }
+func (s *SJF) Len() int               { return len(s.ready) }
+func (s *SJF) Preemptive() bool       { return false }
+func (s *SJF) Pick(now int) (*Proc, int) {
+	return pop(&s.ready, shortest(s.ready, func(p *Proc) int { return p.Burst })), 0
+}
+
+// STCF (shortest time-to-completion first) is preemptive SJF: whenever a
+// job arrives, the one with the least remaining time runs.
+type STCF struct{ ready []*Proc }
+
+func (s *STCF) Name() string           { return "STCF" }
+func (s *STCF) Ready(p *Proc, now int) { s.ready = append(s.ready, p) }
+func (s *STCF) Len() int               { return len(s.ready) }
+func (s *STCF) Preemptive() bool       { return true }
+func (s *STCF) Pick(now int) (*Proc, int) {
+	return pop(&s.ready, shortest(s.ready, func(p *Proc) int { return p.Remaining })), 0
+}
+
+// Priority runs the job with the lowest nice value (highest priority),
+// preempting as soon as a higher-priority job arrives; equal priorities
+// go in arrival order.
+type Priority struct{ ready []*Proc }
+
+func (s *Priority) Name() string           { return "Priority" }
+func (s *Priority) Ready(p *Proc, now int) { s.ready = append(s.ready, p) }
+func (s *Priority) Len() int               { return len(s.ready) }
+func (s *Priority) Preemptive() bool       { return true }
+func (s *Priority) Pick(now int) (*Proc, int) {
+	return pop(&s.ready, shortest(s.ready, func(p *Proc) int { return p.Nice })), 0
+}
+
+// RR runs each ready job for at most Quantum ticks, then sends it to the
+// back of the queue.
+type RR struct {
+	Quantum int
+	queue   []*Proc
+}
+
+func (r *RR) Name() string              { return fmt.Sprintf("RR(q=%d)", r.Quantum) }
+func (r *RR) Ready(p *Proc, now int)    { r.queue = append(r.queue, p) }
+func (r *RR) Len() int                  { return len(r.queue) }
+func (r *RR) Preemptive() bool          { return false }
+func (r *RR) Pick(now int) (*Proc, int) { return pop(&r.queue, 0), max(r.Quantum, 1) }
+
+// shortest returns the index of the process with the smallest key; ties go
+// to the earlier arrival, then to workload order.
+func shortest(ps []*Proc, key func(*Proc) int) int {
+	best := 0
+	for i, p := range ps[1:] {
+		b := ps[best]
+		if k, kb := key(p), key(b); k < kb || k == kb && (p.Arrival < b.Arrival || p.Arrival == b.Arrival && p.ID < b.ID) {
+			best = i + 1
+		}
+	}
+	return best
+}
+
+// pop removes and returns (*q)[i].
+func pop(q *[]*Proc, i int) *Proc {
+	p := (*q)[i]
+	*q = append((*q)[:i], (*q)[i+1:]...)
+	return p
+}
+
+// Options configures the policies NewPolicy builds.
+type Options struct {
+	Quantum int // rr: time slice
+
+	// mlfq (see MLFQ)
+	Quanta       []int
+	Allotments   []int
+	Boost        int
+	NoAccounting bool
+
+	// cfs (see CFS)
+	Latency        int
+	MinGranularity int
+}
+
+// NewPolicy returns the named policy: fifo, sjf, stcf, prio, rr, mlfq, or cfs.
+func NewPolicy(name string, o Options) (Policy, error) {
+	switch name {
+	case "fifo":
+		return &FIFO{}, nil
+	case "sjf":
+		return &SJF{}, nil
+	case "stcf":
+		return &STCF{}, nil
+	case "prio":
+		return &Priority{}, nil
+	case "rr":
+		if o.Quantum < 1 {
+			return nil, fmt.Errorf("rr needs a quantum of at least 1, got %d", o.Quantum)
+		}
+		return &RR{Quantum: o.Quantum}, nil
+	case "mlfq":
+		return NewMLFQ(o.Quanta, o.Allotments, o.Boost, !o.NoAccounting)
+	case "cfs":
+		return NewCFS(o.Latency, o.MinGranularity)
+	default:
+		return nil, fmt.Errorf("unknown policy %q (use fifo, sjf, stcf, prio, rr, mlfq, or cfs)", name)
+	}
+}
+
+// Policies lists the names NewPolicy accepts.
+var Policies = []string{"fifo", "sjf", "stcf", "prio", "rr", "mlfq", "cfs"}
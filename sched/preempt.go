@@ -0,0 +1,269 @@
+package sched
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/operating-systems/stats"
+)
+
+// Machine runs a workload on one CPU the way a kernel does, with a timer
+// interrupt. Every job is a goroutine that burns CPU for as long as it
+// likes, calling a checkpoint every Check of work; only the process
+// holding the CPU runs, the others wait to be dispatched. A ticker fires
+// every Tick, and the next checkpoint traps into the scheduler: the
+// ticks since the last trap are charged to the running process, and if
+// its slice is used up, its burst is done, it is due for I/O, or (for a
+// preemptive policy) a job arrived or woke up meanwhile, it is taken off
+// the CPU and the Policy picks the next. Time is the tick count, so a
+// process is charged whole ticks however much of one it really ran, as
+// with tick-based accounting in a real kernel.
+//
+// Unlike Executor, whose tasks give the CPU back at every tick of work
+// they do, a process here doesn't know about slices at all: it is
+// preempted from outside, as late as the checkpoint after the interrupt,
+// and the result measures how late that was.
+type Machine struct {
+	Tick  time.Duration // timer interrupt period: one tick
+	Check time.Duration // CPU a process burns between checkpoints (default Tick/20)
+}
+
+// PreemptResult is a finished run on a Machine. ExecResult.Timeline is in
+// ticks, and Workers is 1.
+type PreemptResult struct {
+	ExecResult
+	Interrupts       int             // timer interrupts
+	Preemptions      int             // processes taken off the CPU unfinished by the timer
+	ArrivalPreempted int             // ... by an arrival or I/O completion
+	Switches         int             // dispatches of a different process than the one before
+	Idle             int             // ticks with nothing to run
+	TrapLatency      []time.Duration // from when an interrupt was due to the checkpoint that took it, sorted
+}
+
+// Run executes jobs under policy p on the machine.
+func (m Machine) Run(jobs []Job, p Policy) (PreemptResult, error) {
+	if m.Tick <= 0 {
+		return PreemptResult{}, fmt.Errorf("machine needs a positive tick, got %v", m.Tick)
+	}
+	if m.Check <= 0 {
+		m.Check = m.Tick / 20
+	}
+	procs := make([]*Proc, len(jobs))
+	for i, j := range jobs {
+		if err := j.validate(); err != nil {
+			return PreemptResult{}, err
+		}
+		procs[i] = &Proc{Job: j, ID: i, Remaining: j.Burst, FirstRun: -1, untilIO: j.IOEvery}
+	}
+	pending := append([]*Proc(nil), procs...)
+	sort.SliceStable(pending, func(a, b int) bool { return pending[a].Arrival < pending[b].Arrival })
+	spins := calibrate(m.Check)
+	leveler, _ := p.(Leveler)
+
+	var (
+		ticks     atomic.Int64 // the clock: timer interrupts so far
+		interrupt atomic.Bool  // raised by the timer or an arrival, cleared by the trap
+		raisedAt  atomic.Int64 // when the interrupt was due, in ns since start
+
+		mu       sync.Mutex // guards p, procs, and everything below
+		running  *Proc
+		slice    int // running's slice, 0 for until done
+		ran      int // ticks running has been charged since dispatch
+		from     int // tick it was dispatched at
+		charged  int64
+		seen     int // arrivals when it was dispatched
+		arrivals int
+		last     = -1
+		left     = len(procs)
+		wake     = make([]chan struct{}, len(procs))
+		firstRun = make([]time.Time, len(procs))
+		doneAt   = make([]time.Time, len(procs))
+		level    int // running's priority level, if p is a Leveler
+		idle     = true
+		idleFrom int64 // tick the CPU went idle
+		res      PreemptResult
+		finished = make(chan struct{})
+	)
+	for i := range wake {
+		wake[i] = make(chan struct{}, 1)
+	}
+	start := time.Now()
+	now := func() int { return int(ticks.Load()) }
+	raise := func(due time.Time) {
+		if !interrupt.Swap(true) {
+			raisedAt.Store(int64(due.Sub(start)))
+		}
+	}
+
+	// dispatch gives the CPU to the policy's next pick, or leaves it idle
+	dispatch := func() {
+		running = nil
+		if p.Len() == 0 {
+			if !idle {
+				idle, idleFrom = true, ticks.Load()
+			}
+			return
+		}
+		if idle {
+			res.Idle += int(ticks.Load() - idleFrom)
+			idle = false
+		}
+		running, slice = p.Pick(now())
+		if leveler != nil {
+			level = leveler.Level(running)
+		}
+		ran, from, charged, seen = 0, now(), ticks.Load(), arrivals
+		if firstRun[running.ID].IsZero() {
+			firstRun[running.ID] = time.Now()
+		}
+		if running.ID != last {
+			res.Switches++
+			last = running.ID
+		}
+		wake[running.ID] <- struct{}{}
+	}
+	// offCPU records the slice cur just ran
+	offCPU := func(cur *Proc) {
+		res.Timeline = append(res.Timeline, Slice{Proc: cur.ID, Start: from, End: now(), Level: level})
+		cur.LastRan = ran
+	}
+	// release readies pr once the clock reaches at: an arrival, or the end
+	// of its I/O
+	release := func(pr *Proc, at time.Time) {
+		time.Sleep(time.Until(at))
+		mu.Lock()
+		defer mu.Unlock()
+		p.Ready(pr, now())
+		arrivals++
+		if running == nil {
+			dispatch()
+		} else if p.Preemptive() {
+			raise(at)
+		}
+	}
+
+	// trap is the scheduler, entered from cur's checkpoint after an
+	// interrupt; it reports whether cur still has work to do, having
+	// waited to be dispatched again if it was taken off the CPU.
+	trap := func(cur *Proc) bool {
+		mu.Lock()
+		interrupt.Store(false)
+		res.TrapLatency = append(res.TrapLatency, time.Since(start)-time.Duration(raisedAt.Load()))
+		t := ticks.Load()
+		n := min(int(t-charged), cur.Remaining)
+		charged = t
+		ran += n
+		cur.Remaining -= n
+		cur.untilIO -= n
+		switch {
+		case cur.Remaining == 0:
+			offCPU(cur)
+			doneAt[cur.ID] = time.Now()
+			left--
+			if left == 0 {
+				close(finished)
+			}
+			dispatch()
+			mu.Unlock()
+			return false
+		case cur.IOEvery > 0 && cur.untilIO <= 0:
+			offCPU(cur)
+			cur.untilIO = cur.IOEvery
+			cur.IO += cur.IOTime
+			go release(cur, time.Now().Add(time.Duration(cur.IOTime)*m.Tick))
+		case slice > 0 && ran >= slice:
+			offCPU(cur)
+			res.Preemptions++
+			p.Ready(cur, now())
+		case p.Preemptive() && arrivals != seen:
+			offCPU(cur)
+			res.ArrivalPreempted++
+			p.Ready(cur, now())
+		default:
+			mu.Unlock()
+			return true
+		}
+		dispatch()
+		mu.Unlock()
+		<-wake[cur.ID]
+		return true
+	}
+
+	// The processes: each burns CPU until its burst is charged
+	for _, pr := range procs {
+		go func() {
+			<-wake[pr.ID]
+			for {
+				burn(spins)
+				// Let the timer goroutine in: with one core, Go's own
+				// scheduler would only preempt us every ~10ms
+				runtime.Gosched()
+				if interrupt.Load() && !trap(pr) {
+					return
+				}
+			}
+		}()
+	}
+
+	// The timer
+	timer := time.NewTicker(m.Tick)
+	go func() {
+		for {
+			select {
+			case <-finished:
+				return
+			case due := <-timer.C:
+				ticks.Add(1)
+				mu.Lock()
+				res.Interrupts++
+				if running != nil {
+					raise(due)
+				}
+				mu.Unlock()
+			}
+		}
+	}()
+
+	// Release each job at its arrival time
+	go func() {
+		for _, pr := range pending {
+			release(pr, start.Add(time.Duration(pr.Arrival)*m.Tick))
+		}
+	}()
+
+	<-finished
+	timer.Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	res.Policy, res.Workers, res.Tick, res.Elapsed = p.Name(), 1, m.Tick, time.Since(start)
+	res.Jobs = make([]ExecStats, len(procs))
+	for i, pr := range procs {
+		arrived := start.Add(time.Duration(pr.Arrival) * m.Tick)
+		t := doneAt[i].Sub(arrived)
+		res.Jobs[i] = ExecStats{Job: pr.Job, Turnaround: t, Response: firstRun[i].Sub(arrived), Waiting: t - time.Duration(pr.Burst+pr.IO)*m.Tick}
+	}
+	sort.Slice(res.TrapLatency, func(a, b int) bool { return res.TrapLatency[a] < res.TrapLatency[b] })
+	return res, nil
+}
+
+// Latency returns the q quantile of the trap latencies.
+func (r PreemptResult) Latency(q float64) time.Duration {
+	return stats.Percentile(r.TrapLatency, q)
+}
+
+// Format renders the run like ExecResult.Format, followed by its
+// interrupt and preemption counts.
+func (r PreemptResult) Format() string {
+	var b strings.Builder
+	b.WriteString(r.ExecResult.Format())
+	fmt.Fprintf(&b, "  %d timer interrupts, %d idle ticks, %d switches; preempted %d times by the timer, %d by arrivals\n",
+		r.Interrupts, r.Idle, r.Switches, r.Preemptions, r.ArrivalPreempted)
+	fmt.Fprintf(&b, "  trap latency p50 %v, p99 %v, max %v\n",
+		r.Latency(0.50).Round(time.Microsecond), r.Latency(0.99).Round(time.Microsecond), r.Latency(1).Round(time.Microsecond))
+	return b.String()
+}
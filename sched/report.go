@@ -0,0 +1,65 @@
+package sched
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format renders a result as a per-job table, the averages, and the timeline.
+func (r Result) Format() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", r.Policy)
+	// The I/O column only appears when some job does I/O
+	hasIO := len(r.Blocked) > 0
+	ioCol := func(s string) string {
+		if !hasIO {
+			return ""
+		}
+		return fmt.Sprintf(" %6s", s)
+	}
+	fmt.Fprintf(&b, "  %-6s %8s %6s%s %11s %11s %9s %8s\n", "job", "arrival", "burst", ioCol("io"), "completion", "turnaround", "response", "waiting")
+	for _, s := range r.Jobs {
+		fmt.Fprintf(&b, "  %-6s %8d %6d%s %11d %11d %9d %8d\n", s.Name, s.Arrival, s.Burst, ioCol(fmt.Sprint(s.IO)), s.Completion, s.Turnaround, s.Response, s.Waiting)
+	}
+	t, resp, w := r.Averages()
+	fmt.Fprintf(&b, "  %-6s %8s %6s%s %11s %11.2f %9.2f %8.2f\n", "avg", "", "", ioCol(""), "", t, resp, w)
+	fmt.Fprintf(&b, "  context switches=%d makespan=%d\n", r.Switches, r.Makespan)
+	fmt.Fprintf(&b, "  timeline:")
+	for _, s := range r.Timeline {
+		fmt.Fprintf(&b, " %s[%d-%d]", r.Jobs[s.Proc].Name, s.Start, s.End)
+	}
+	b.WriteString("\n")
+	b.WriteString(r.jobTimelines())
+	b.WriteString(r.Extra)
+	return b.String()
+}
+
+// jobTimelines lists each job's own slices; with priority levels, each
+// slice is tagged @level and the job's CPU time per level is totalled.
+func (r Result) jobTimelines() string {
+	var b strings.Builder
+	b.WriteString("  per job:\n")
+	nlevels := 0
+	for _, s := range r.Timeline {
+		nlevels = max(nlevels, s.Level+1)
+	}
+	for id, job := range r.Jobs {
+		perLevel := make([]int, nlevels)
+		fmt.Fprintf(&b, "    %-6s", job.Name)
+		for _, s := range r.Timeline {
+			if s.Proc != id {
+				continue
+			}
+			fmt.Fprintf(&b, " [%d-%d]", s.Start, s.End)
+			if r.Levels {
+				fmt.Fprintf(&b, "@%d", s.Level)
+			}
+			perLevel[s.Level] += s.End - s.Start
+		}
+		if r.Levels {
+			fmt.Fprintf(&b, "  (ticks per level: %s)", joinInts(perLevel))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
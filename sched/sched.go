@@ -0,0 +1,239 @@
+// Package sched is a discrete-event CPU scheduling simulator. A workload is
+// a list of jobs (arrival time, CPU burst, optionally an I/O pattern);
+// Simulate plays it through a
+// Policy and reports turnaround, response, and waiting time per job, plus
+// the timeline of who ran when. Time is in abstract ticks, as in the
+// textbook examples.
+package sched
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Job is one entry of a workload.
+type Job struct {
+	Name    string
+	Arrival int // tick the job becomes runnable
+	Burst   int // ticks of CPU it needs
+	Nice    int // priority for weighted policies (CFS): -20 (most CPU) .. 19
+	IOEvery int // ticks of CPU between I/O requests (0 = CPU-bound, never blocks)
+	IOTime  int // ticks each I/O request blocks for
+}
+
+// Proc is a job while it is being simulated.
+type Proc struct {
+	Job
+	ID        int // index in the workload
+	Remaining int // CPU ticks still needed
+	FirstRun  int // tick it was first dispatched (-1 until then)
+	Done      int // tick it finished
+	LastRan   int // ticks it got on its latest dispatch
+	IO        int // ticks spent blocked on I/O so far
+
+	untilIO int // CPU ticks left before its next I/O request
+	wake    int // tick its current I/O completes
+}
+
+// Policy decides which ready process runs next and for how long.
+type Policy interface {
+	Name() string
+	// Ready is called when p becomes runnable: on arrival, when it comes
+	// off the CPU unfinished, and when its I/O completes (p.LastRan says
+	// how long it ran before that).
+	Ready(p *Proc, now int)
+	// Pick removes and returns the next process to run and its time slice;
+	// a slice of 0 means until it finishes. Only called when Len() > 0.
+	Pick(now int) (p *Proc, slice int)
+	// Len is the number of ready processes.
+	Len() int
+	// Preemptive policies are asked again whenever a job arrives or
+	// returns from I/O.
+	Preemptive() bool
+}
+
+// Leveler is implemented by policies with priority levels; the timeline
+// then records the level each slice ran at.
+type Leveler interface {
+	Level(p *Proc) int
+}
+
+// Reporter is implemented by policies with their own per-job accounting,
+// printed after the standard table.
+type Reporter interface {
+	Report() string
+}
+
+// Slice is a stretch of time one process held the CPU.
+type Slice struct {
+	Proc       int // Proc.ID
+	Start, End int
+	Level      int // priority level it ran at (0 unless the policy is a Leveler)
+	CPU        int // worker that ran it (Executor runs; the simulator has one CPU)
+}
+
+// Stats is what happened to one job.
+type Stats struct {
+	Job
+	Completion int
+	Turnaround int // completion - arrival
+	Response   int // first run - arrival
+	IO         int // time spent blocked on I/O
+	Waiting    int // turnaround - burst - io: time spent ready but not running
+}
+
+// Result is a finished simulation.
+type Result struct {
+	Policy   string
+	Jobs     []Stats // in workload order
+	Timeline []Slice
+	Blocked  []Slice // stretches jobs spent blocked on I/O
+	Switches int     // dispatches of a different process than the one before
+	Makespan int     // tick the last job finished
+	Levels   bool    // the policy has priority levels (Slice.Level is meaningful)
+	Extra    string  // the policy's own report, if it is a Reporter
+}
+
+// Averages returns the mean turnaround, response, and waiting times.
+func (r Result) Averages() (turnaround, response, waiting float64) {
+	if len(r.Jobs) == 0 {
+		return 0, 0, 0
+	}
+	for _, s := range r.Jobs {
+		turnaround += float64(s.Turnaround)
+		response += float64(s.Response)
+		waiting += float64(s.Waiting)
+	}
+	n := float64(len(r.Jobs))
+	return turnaround / n, response / n, waiting / n
+}
+
+// Simulate runs jobs under policy p until every job has finished.
+func Simulate(jobs []Job, p Policy) (Result, error) {
+	procs := make([]*Proc, len(jobs))
+	for i, j := range jobs {
+		if err := j.validate(); err != nil {
+			return Result{}, err
+		}
+		procs[i] = &Proc{Job: j, ID: i, Remaining: j.Burst, FirstRun: -1, untilIO: j.IOEvery}
+	}
+	// Arrival order; ties keep workload order
+	pending := append([]*Proc(nil), procs...)
+	sort.SliceStable(pending, func(a, b int) bool { return pending[a].Arrival < pending[b].Arrival })
+
+	res := Result{Policy: p.Name()}
+	leveler, _ := p.(Leveler)
+	res.Levels = leveler != nil
+	var blocked []*Proc // waiting on I/O, by wake-up tick
+	now, last, done := 0, -1, 0
+	// next is the tick of the next arrival or I/O completion (-1 if none)
+	next := func() int {
+		t := -1
+		if len(pending) > 0 {
+			t = pending[0].Arrival
+		}
+		if len(blocked) > 0 && (t < 0 || blocked[0].wake < t) {
+			t = blocked[0].wake
+		}
+		return t
+	}
+	// admit readies everything due by now, in time order; at the same tick,
+	// jobs back from I/O go ahead of new arrivals
+	admit := func() {
+		for {
+			switch {
+			case len(blocked) > 0 && blocked[0].wake <= now && (len(pending) == 0 || blocked[0].wake <= pending[0].Arrival):
+				p.Ready(blocked[0], now)
+				blocked = blocked[1:]
+			case len(pending) > 0 && pending[0].Arrival <= now:
+				p.Ready(pending[0], now)
+				pending = pending[1:]
+			default:
+				return
+			}
+		}
+	}
+	for done < len(procs) {
+		admit()
+		if p.Len() == 0 {
+			now = next() // idle until something arrives or wakes up
+			continue
+		}
+		cur, slice := p.Pick(now)
+		run := cur.Remaining
+		if slice > 0 {
+			run = min(run, slice)
+		}
+		if cur.IOEvery > 0 {
+			run = min(run, cur.untilIO)
+		}
+		if t := next(); p.Preemptive() && t >= 0 {
+			run = min(run, t-now)
+		}
+		if cur.FirstRun < 0 {
+			cur.FirstRun = now
+		}
+		if cur.ID != last {
+			res.Switches++
+			last = cur.ID
+		}
+		level := 0
+		if leveler != nil {
+			level = leveler.Level(cur)
+		}
+		res.addSlice(cur.ID, level, now, now+run)
+		now += run
+		cur.Remaining -= run
+		cur.LastRan = run
+		cur.untilIO -= run
+
+		// Jobs that arrived meanwhile queue ahead of the one coming off the CPU
+		admit()
+		switch {
+		case cur.Remaining == 0:
+			cur.Done = now
+			done++
+		case cur.IOEvery > 0 && cur.untilIO == 0:
+			cur.untilIO = cur.IOEvery
+			cur.wake = now + cur.IOTime
+			cur.IO += cur.IOTime
+			res.Blocked = append(res.Blocked, Slice{Proc: cur.ID, Start: now, End: cur.wake})
+			i := sort.Search(len(blocked), func(i int) bool { return blocked[i].wake > cur.wake })
+			blocked = append(blocked[:i], append([]*Proc{cur}, blocked[i:]...)...)
+		default:
+			p.Ready(cur, now)
+		}
+	}
+
+	res.Makespan = now
+	res.Jobs = make([]Stats, len(procs))
+	for i, pr := range procs {
+		t := pr.Done - pr.Arrival
+		res.Jobs[i] = Stats{Job: pr.Job, Completion: pr.Done, Turnaround: t, Response: pr.FirstRun - pr.Arrival, IO: pr.IO, Waiting: t - pr.Burst - pr.IO}
+	}
+	if r, ok := p.(Reporter); ok {
+		res.Extra = r.Report()
+	}
+	return res, nil
+}
+
+// validate checks a job's fields before it is run.
+func (j Job) validate() error {
+	if j.Arrival < 0 || j.Burst < 1 {
+		return fmt.Errorf("job %q: arrival must be >= 0 and burst >= 1", j.Name)
+	}
+	if j.IOEvery < 0 || j.IOTime < 0 {
+		return fmt.Errorf("job %q: io-every and io-time must be >= 0", j.Name)
+	}
+	return nil
+}
+
+// addSlice appends to the timeline, merging with the previous slice when
+// the same process simply kept running at the same level.
+func (r *Result) addSlice(id, level, start, end int) {
+	if n := len(r.Timeline); n > 0 && r.Timeline[n-1].Proc == id && r.Timeline[n-1].Level == level && r.Timeline[n-1].End == start {
+		r.Timeline[n-1].End = end
+		return
+	}
+	r.Timeline = append(r.Timeline, Slice{Proc: id, Start: start, End: end, Level: level})
+}
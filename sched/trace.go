@@ -0,0 +1,77 @@
+package sched
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseJobs reads a workload, one job per line: "name arrival burst", or
+// just "arrival burst" to have the jobs named A, B, C..., optionally
+// followed by a nice value ("name arrival burst nice") and then an I/O
+// pattern ("name arrival burst nice io-every io-time": block for io-time
+// ticks after every io-every ticks of CPU). Blank lines and text after '#'
+// are ignored.
+func ParseJobs(r io.Reader) ([]Job, error) {
+	var jobs []Job
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		f := strings.Fields(text)
+		if len(f) == 0 {
+			continue
+		}
+		name := jobName(len(jobs))
+		if len(f) >= 3 {
+			name, f = f[0], f[1:]
+		}
+		if len(f) == 2 {
+			f = append(f, "0")
+		}
+		if len(f) == 3 {
+			f = append(f, "0", "0")
+		}
+		if len(f) != 5 {
+			return nil, fmt.Errorf("line %d: want \"[name] arrival burst [nice [io-every io-time]]\", got %q", line, sc.Text())
+		}
+		v := make([]int, len(f))
+		for i := range f {
+			var err error
+			if v[i], err = strconv.Atoi(f[i]); err != nil {
+				return nil, fmt.Errorf("line %d: arrival, burst, nice and the I/O fields must be integers, got %q", line, sc.Text())
+			}
+		}
+		jobs = append(jobs, Job{Name: name, Arrival: v[0], Burst: v[1], Nice: v[2], IOEvery: v[3], IOTime: v[4]})
+	}
+	return jobs, sc.Err()
+}
+
+// WriteJobs writes a workload in the format ParseJobs reads, every line
+// starting with "# " from header first.
+func WriteJobs(w io.Writer, header string, jobs []Job) error {
+	bw := bufio.NewWriter(w)
+	if header != "" {
+		for _, line := range strings.Split(strings.TrimRight(header, "\n"), "\n") {
+			fmt.Fprintf(bw, "# %s\n", line)
+		}
+	}
+	fmt.Fprintln(bw, "# name arrival burst nice io-every io-time")
+	for _, j := range jobs {
+		fmt.Fprintf(bw, "%s %d %d %d", j.Name, j.Arrival, j.Burst, j.Nice)
+		if j.IOEvery > 0 {
+			fmt.Fprintf(bw, " %d %d", j.IOEvery, j.IOTime)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// jobName names the i-th unnamed job A..Z, then J26, J27...
+func jobName(i int) string {
+	if i < 26 {
+		return string(rune('A' + i))
+	}
+	return "J" + strconv.Itoa(i)
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package shmring
+
+import "time"
+
+// Without futex(2), waiting is a short sleep and waking is left to it.
+func futexWait(addr *uint32, val uint32, d time.Duration) {
+	time.Sleep(min(d, 50*time.Microsecond))
+}
+
+func futexWake(addr *uint32) {}
+
+// osYield gives up the CPU; without sched_yield a short sleep is the closest thing.
+func osYield() {
+	time.Sleep(time.Microsecond)
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package shmring
+
+import "errors"
+
+// errNoMmap is returned where there is no mmap to share memory with;
+// Init and Attach still work on memory within one process.
+var errNoMmap = errors.New("shmring: shared files need a unix platform (mmap)")
+
+func Create(path string, c Config) (*Ring, error) { return nil, errNoMmap }
+
+func OpenFile(path string, w Wait) (*Ring, error) { return nil, errNoMmap }
@@ -0,0 +1,59 @@
+//go:build unix
+
+package shmring
+
+import (
+	"os"
+	"syscall"
+)
+
+// Create makes the file at path a ring with geometry c, mapped shared,
+// for other processes to OpenFile.
+func Create(path string, c Config) (*Ring, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := f.Truncate(int64(Size(c))); err != nil {
+		return nil, err
+	}
+	mem, err := syscall.Mmap(int(f.Fd()), 0, Size(c), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Init(mem, c)
+	if err != nil {
+		syscall.Munmap(mem)
+		return nil, err
+	}
+	r.unmap = syscall.Munmap
+	return r, nil
+}
+
+// OpenFile maps the ring Create made at path, waiting with w.
+func OpenFile(path string, w Wait) (*Ring, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() < headerSize {
+		return nil, ErrBadRing
+	}
+	mem, err := syscall.Mmap(int(f.Fd()), 0, int(st.Size()), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Attach(mem, w)
+	if err != nil {
+		syscall.Munmap(mem)
+		return nil, err
+	}
+	r.unmap = syscall.Munmap
+	return r, nil
+}
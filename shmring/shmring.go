@@ -0,0 +1,363 @@
+// Package shmring is a ring buffer of byte messages that lives entirely
+// in a byte slice, so that two processes mapping the same file (Create,
+// OpenFile) can pass messages through it without a system call per
+// message. It generalizes the ring of HW1's shared-memory mode.
+//
+// Every slot carries a sequence number, as in Vyukov's bounded queue: the
+// slot for position pos is free when its sequence is pos and full when it
+// is pos+1, and the consumer frees it for the next lap by setting it to
+// pos+slots. A single producer (SPSC) just takes the next position; with
+// several producers (MPSC), in one process or many, each claims a
+// position with a compare-and-swap on the tail. There is always one
+// consumer.
+//
+// A side that finds the ring empty or full waits by spinning and
+// yielding (Spin), or, with Futex, by sleeping in futex(2) on an event
+// counter in the shared memory that the other side bumps and wakes, so
+// an idle consumer uses no CPU. Futex is Linux only; elsewhere it falls
+// back to short sleeps.
+//
+// Layout, every field on its own cache line:
+//
+//	0    magic "shmring1", slots, slot size, mode
+//	64   tail: next position producers claim
+//	128  head: next position the consumer reads
+//	192  closed: set by CloseWrite
+//	256  data event counter, consumers waiting on it
+//	320  space event counter, producers waiting on it
+//	384  slots: [sequence uint64][length uint32][pad][payload]
+package shmring
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Mode is how many producers the ring has.
+type Mode uint32
+
+const (
+	SPSC Mode = iota // one producer
+	MPSC             // any number of producers
+)
+
+// Modes lists every mode.
+var Modes = []Mode{SPSC, MPSC}
+
+func (m Mode) String() string {
+	switch m {
+	case SPSC:
+		return "spsc"
+	case MPSC:
+		return "mpsc"
+	}
+	return fmt.Sprintf("Mode(%d)", uint32(m))
+}
+
+// ParseMode returns the mode named s.
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "spsc", "single":
+		return SPSC, nil
+	case "mpsc", "multi":
+		return MPSC, nil
+	}
+	return 0, fmt.Errorf("shmring: unknown mode %q (spsc, mpsc)", s)
+}
+
+// Wait is how a side waits for the other.
+type Wait int
+
+const (
+	Spin  Wait = iota // spin, then yield the CPU
+	Futex             // spin briefly, then sleep in futex(2)
+)
+
+// Waits lists every way of waiting.
+var Waits = []Wait{Spin, Futex}
+
+func (w Wait) String() string {
+	switch w {
+	case Spin:
+		return "spin"
+	case Futex:
+		return "futex"
+	}
+	return fmt.Sprintf("Wait(%d)", int(w))
+}
+
+// ParseWait returns the way of waiting named s.
+func ParseWait(s string) (Wait, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "spin", "yield":
+		return Spin, nil
+	case "futex", "sleep":
+		return Futex, nil
+	}
+	return 0, fmt.Errorf("shmring: unknown wait %q (spin, futex)", s)
+}
+
+// Config is a ring's geometry and behaviour.
+type Config struct {
+	Slots    int  // messages the ring holds
+	SlotSize int  // largest message, in bytes
+	Mode     Mode // fixed when the ring is made; Attach reads it back
+	Wait     Wait // per side, not stored in the ring
+}
+
+// DefaultConfig is a 1024-slot single-producer ring of messages up to
+// 256 bytes, waiting by spinning.
+var DefaultConfig = Config{Slots: 1024, SlotSize: 256, Mode: SPSC, Wait: Spin}
+
+var (
+	ErrTooLarge = errors.New("shmring: message larger than a slot")
+	ErrShort    = errors.New("shmring: buffer smaller than the message")
+	ErrClosed   = errors.New("shmring: ring closed for writing")
+	ErrBadRing  = errors.New("shmring: memory holds no ring")
+)
+
+const (
+	magic      = "shmring1"
+	offTail    = 64
+	offHead    = 128
+	offClosed  = 192
+	offData    = 256
+	offSpace   = 320
+	headerSize = 384
+	slotHeader = 16 // sequence, length, pad
+	// spins is how often a side checks again before it yields or sleeps.
+	spins = 50
+	// futexTimeout bounds a futex sleep, so a peer that died without
+	// waking us can't block us for ever.
+	futexTimeout = 10 * time.Millisecond
+)
+
+// stride is the bytes one slot takes.
+func stride(slotSize int) int { return slotHeader + (slotSize+7)/8*8 }
+
+// Size is the bytes of memory a ring with c's geometry needs.
+func Size(c Config) int { return headerSize + c.Slots*stride(c.SlotSize) }
+
+// Ring is a view of a ring in memory. A Ring value is for one goroutine;
+// each producer and the consumer attach their own.
+type Ring struct {
+	mem      []byte
+	slots    uint64
+	slotSize int
+	stride   int
+	mode     Mode
+	wait     Wait
+	unmap    func([]byte) error // set by Create and OpenFile
+}
+
+// Init formats mem as an empty ring with c's geometry and returns a view
+// of it. mem must be 8-byte aligned and at least Size(c) bytes.
+func Init(mem []byte, c Config) (*Ring, error) {
+	if c.Slots < 2 || c.SlotSize < 1 {
+		return nil, fmt.Errorf("shmring: need at least 2 slots of at least 1 byte, got %d of %d", c.Slots, c.SlotSize)
+	}
+	if len(mem) < Size(c) {
+		return nil, fmt.Errorf("shmring: %d bytes of memory, ring needs %d", len(mem), Size(c))
+	}
+	if uintptr(unsafe.Pointer(&mem[0]))%8 != 0 {
+		return nil, errors.New("shmring: memory not 8-byte aligned")
+	}
+	clear(mem[:headerSize])
+	r := &Ring{mem: mem, slots: uint64(c.Slots), slotSize: c.SlotSize, stride: stride(c.SlotSize), mode: c.Mode, wait: c.Wait}
+	for i := uint64(0); i < r.slots; i++ {
+		atomic.StoreUint64(r.seq(i), i)
+	}
+	le := [3]uint32{uint32(c.Slots), uint32(c.SlotSize), uint32(c.Mode)}
+	for i, v := range le {
+		*r.u32(8 + 4*i) = v
+	}
+	copy(mem, magic) // last: Attach trusts the header once it sees this
+	return r, nil
+}
+
+// Attach returns a view of the ring Init made in mem, waiting with w.
+func Attach(mem []byte, w Wait) (*Ring, error) {
+	if len(mem) < headerSize || string(mem[:len(magic)]) != magic {
+		return nil, ErrBadRing
+	}
+	r := &Ring{mem: mem, wait: w}
+	r.slots, r.slotSize, r.mode = uint64(*r.u32(8)), int(*r.u32(12)), Mode(*r.u32(16))
+	r.stride = stride(r.slotSize)
+	if len(mem) < Size(r.Config()) {
+		return nil, fmt.Errorf("%w: %d bytes, its geometry needs %d", ErrBadRing, len(mem), Size(r.Config()))
+	}
+	return r, nil
+}
+
+// Config returns the ring's geometry and this view's way of waiting.
+func (r *Ring) Config() Config {
+	return Config{Slots: int(r.slots), SlotSize: r.slotSize, Mode: r.mode, Wait: r.wait}
+}
+
+func (r *Ring) u32(off int) *uint32 { return (*uint32)(unsafe.Pointer(&r.mem[off])) }
+func (r *Ring) u64(off int) *uint64 { return (*uint64)(unsafe.Pointer(&r.mem[off])) }
+
+// slot returns the offset of position pos's slot.
+func (r *Ring) slot(pos uint64) int { return headerSize + int(pos%r.slots)*r.stride }
+
+func (r *Ring) seq(pos uint64) *uint64 { return r.u64(r.slot(pos)) }
+
+// TryPush copies p into the ring if there is room, reporting whether
+// there was.
+func (r *Ring) TryPush(p []byte) (bool, error) {
+	if len(p) > r.slotSize {
+		return false, ErrTooLarge
+	}
+	if atomic.LoadUint32(r.u32(offClosed)) != 0 {
+		return false, ErrClosed
+	}
+	tail := r.u64(offTail)
+	pos := atomic.LoadUint64(tail)
+	for {
+		seq := atomic.LoadUint64(r.seq(pos))
+		switch {
+		case seq < pos:
+			return false, nil // the consumer hasn't freed it: full
+		case seq > pos:
+			pos = atomic.LoadUint64(tail) // another producer took it
+			continue
+		}
+		if r.mode == SPSC {
+			atomic.StoreUint64(tail, pos+1)
+			break
+		}
+		if atomic.CompareAndSwapUint64(tail, pos, pos+1) {
+			break
+		}
+		pos = atomic.LoadUint64(tail)
+	}
+	off := r.slot(pos)
+	*r.u32(off + 8) = uint32(len(p))
+	copy(r.mem[off+slotHeader:], p)
+	atomic.StoreUint64(r.seq(pos), pos+1)
+	r.signal(offData)
+	return true, nil
+}
+
+// Push copies p into the ring, waiting for room.
+func (r *Ring) Push(p []byte) error {
+	spin := 0
+	for {
+		ok, err := r.TryPush(p)
+		if ok || err != nil {
+			return err
+		}
+		r.block(offSpace, &spin, func() bool {
+			pos := atomic.LoadUint64(r.u64(offTail))
+			return atomic.LoadUint64(r.seq(pos)) >= pos || atomic.LoadUint32(r.u32(offClosed)) != 0
+		})
+	}
+}
+
+// TryPop copies the next message into dst if there is one, returning
+// its length. ok is false if the ring was empty; err is io.EOF once it
+// is empty and closed.
+func (r *Ring) TryPop(dst []byte) (n int, ok bool, err error) {
+	head := r.u64(offHead)
+	pos := atomic.LoadUint64(head)
+	if atomic.LoadUint64(r.seq(pos)) != pos+1 {
+		// Empty; closed and empty is the end, unless a producer slipped
+		// a message in before it saw the close.
+		if atomic.LoadUint32(r.u32(offClosed)) != 0 && atomic.LoadUint64(r.seq(pos)) != pos+1 &&
+			atomic.LoadUint64(r.u64(offTail)) == pos {
+			return 0, false, io.EOF
+		}
+		return 0, false, nil
+	}
+	off := r.slot(pos)
+	n = int(*r.u32(off + 8))
+	if n > len(dst) {
+		return n, false, ErrShort
+	}
+	copy(dst, r.mem[off+slotHeader:off+slotHeader+n])
+	atomic.StoreUint64(r.seq(pos), pos+r.slots)
+	atomic.StoreUint64(head, pos+1)
+	r.signal(offSpace)
+	return n, true, nil
+}
+
+// Pop copies the next message into dst, waiting for one, and returns its
+// length; io.EOF once the ring is closed and drained.
+func (r *Ring) Pop(dst []byte) (int, error) {
+	spin := 0
+	for {
+		n, ok, err := r.TryPop(dst)
+		if ok || err != nil {
+			return n, err
+		}
+		r.block(offData, &spin, func() bool {
+			pos := atomic.LoadUint64(r.u64(offHead))
+			return atomic.LoadUint64(r.seq(pos)) == pos+1 || atomic.LoadUint32(r.u32(offClosed)) != 0
+		})
+	}
+}
+
+// CloseWrite closes the ring: Push fails from now on, and Pop returns
+// io.EOF once the messages in it are read.
+func (r *Ring) CloseWrite() {
+	atomic.StoreUint32(r.u32(offClosed), 1)
+	r.signal(offData)
+	r.signal(offSpace)
+}
+
+// Closed reports whether CloseWrite was called.
+func (r *Ring) Closed() bool { return atomic.LoadUint32(r.u32(offClosed)) != 0 }
+
+// Len is the number of messages in the ring, claimed ones included.
+func (r *Ring) Len() int {
+	return int(atomic.LoadUint64(r.u64(offTail)) - atomic.LoadUint64(r.u64(offHead)))
+}
+
+// Close unmaps the ring, if Create or OpenFile mapped it.
+func (r *Ring) Close() error {
+	if r.unmap == nil {
+		return nil
+	}
+	err := r.unmap(r.mem)
+	r.mem, r.unmap = nil, nil
+	return err
+}
+
+// signal bumps the event counter at off and, if anyone sleeps on it,
+// wakes them.
+func (r *Ring) signal(off int) {
+	ev := r.u32(off)
+	atomic.AddUint32(ev, 1)
+	if atomic.LoadUint32(r.u32(off+4)) != 0 {
+		futexWake(ev)
+	}
+}
+
+// block waits once for the event at off, until ready may have become
+// true: the first few times by yielding, then by yielding the OS thread
+// (Spin) or sleeping on the event counter (Futex).
+func (r *Ring) block(off int, spin *int, ready func() bool) {
+	*spin++
+	if *spin < spins {
+		runtime.Gosched()
+		return
+	}
+	if r.wait == Spin {
+		osYield()
+		return
+	}
+	waiters := r.u32(off + 4)
+	atomic.AddUint32(waiters, 1)
+	ev := r.u32(off)
+	v := atomic.LoadUint32(ev)
+	if !ready() {
+		futexWait(ev, v, futexTimeout)
+	}
+	atomic.AddUint32(waiters, ^uint32(0))
+}
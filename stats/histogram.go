@@ -0,0 +1,128 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// subBits splits each power of two into 1<<subBits buckets.
+const subBits = 4
+
+// Histogram summarizes a stream of durations in constant space: count,
+// sum, extremes, and log-linear buckets that percentiles are read off.
+// Durations under 32ns have a bucket each; above that each power of two
+// is split into 16 buckets, so a bucket is at most 1/16 of its lower
+// bound wide. The zero value is empty and ready to use; it is not safe
+// for concurrent use, so give each goroutine its own and Merge them.
+type Histogram struct {
+	N             int
+	Sum, Min, Max time.Duration
+
+	sumSq  float64 // of nanoseconds, for Stddev
+	counts [(64 - subBits + 1) << subBits]int
+}
+
+// bucket returns the index of the bucket holding ns.
+func bucket(ns uint64) int {
+	if ns < 2<<subBits {
+		return int(ns)
+	}
+	e := bits.Len64(ns) - 1 // ns is in [2^e, 2^(e+1))
+	sub := int(ns>>(e-subBits)) & (1<<subBits - 1)
+	return (e-subBits+1)<<subBits | sub
+}
+
+// bounds returns the smallest and largest durations bucket i holds.
+func bounds(i int) (lo, hi time.Duration) {
+	if i < 2<<subBits {
+		return time.Duration(i), time.Duration(i)
+	}
+	shift := i>>subBits - 1
+	lo = time.Duration(1<<subBits|i&(1<<subBits-1)) << shift
+	return lo, lo + 1<<shift - 1
+}
+
+// Add records d; negative durations count as 0.
+func (h *Histogram) Add(d time.Duration) {
+	d = max(d, 0)
+	if h.N == 0 || d < h.Min {
+		h.Min = d
+	}
+	h.N++
+	h.Sum += d
+	h.Max = max(h.Max, d)
+	h.sumSq += float64(d) * float64(d)
+	h.counts[bucket(uint64(d))]++
+}
+
+// Merge adds every duration o recorded.
+func (h *Histogram) Merge(o *Histogram) {
+	if o.N == 0 {
+		return
+	}
+	if h.N == 0 || o.Min < h.Min {
+		h.Min = o.Min
+	}
+	h.N += o.N
+	h.Sum += o.Sum
+	h.Max = max(h.Max, o.Max)
+	h.sumSq += o.sumSq
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+}
+
+// Mean is the average duration.
+func (h *Histogram) Mean() time.Duration {
+	if h.N == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.N)
+}
+
+// Stddev is the sample standard deviation.
+func (h *Histogram) Stddev() time.Duration {
+	if h.N < 2 {
+		return 0
+	}
+	mean := float64(h.Sum) / float64(h.N)
+	v := (h.sumSq - float64(h.N)*mean*mean) / float64(h.N-1)
+	return time.Duration(math.Sqrt(max(v, 0)))
+}
+
+// CI95 is the half-width of the 95% confidence interval for the mean,
+// as Summary.CI95.
+func (h *Histogram) CI95() time.Duration {
+	if h.N < 2 {
+		return 0
+	}
+	return time.Duration(tCritical95(h.N-1) * float64(h.Stddev()) / math.Sqrt(float64(h.N)))
+}
+
+// Quantile returns the middle of the bucket holding the q-th quantile
+// (0 <= q <= 1), kept within Min and Max; the largest is Max itself.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.N == 0 {
+		return 0
+	}
+	rank := max(int(math.Ceil(min(max(q, 0), 1)*float64(h.N))), 1)
+	if rank == h.N {
+		return h.Max
+	}
+	seen := 0
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			lo, hi := bounds(i)
+			return min(max(lo+(hi-lo)/2, h.Min), h.Max)
+		}
+	}
+	return h.Max
+}
+
+func (h *Histogram) String() string {
+	return fmt.Sprintf("mean %v p50 %v p99 %v max %v", h.Mean().Round(time.Microsecond),
+		h.Quantile(0.5).Round(time.Microsecond), h.Quantile(0.99).Round(time.Microsecond), h.Max.Round(time.Microsecond))
+}
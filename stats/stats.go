@@ -0,0 +1,108 @@
+// Package stats summarizes benchmark measurements, so that every
+// experiment reports them the same way. Summarize keeps every sample and
+// gives exact percentiles, interpolated linearly between the two nearest
+// samples as HW1 and HW2 computed them, along with the mean, the sample
+// standard deviation and a 95% confidence interval for the mean. A
+// Histogram takes durations one at a time in constant space, for runs
+// too long to keep them all: its buckets are a sixteenth of a power of
+// two wide, so a percentile read off it is within about 3% of the true
+// one, and histograms kept by several goroutines merge into one.
+package stats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Number is what Summarize summarizes: durations, counts, rates.
+type Number interface {
+	~int | ~int64 | ~float64
+}
+
+// Summary describes a set of samples. Mean and Stddev are of type T too,
+// so for an integer T they are truncated.
+type Summary[T Number] struct {
+	N                      int
+	Mean, Stddev, Min, Max T
+
+	sorted []T
+}
+
+// Summarize sorts a copy of xs and summarizes it.
+func Summarize[T Number](xs []T) Summary[T] {
+	s := Summary[T]{N: len(xs)}
+	if s.N == 0 {
+		return s
+	}
+	s.sorted = append([]T(nil), xs...)
+	sort.Slice(s.sorted, func(i, j int) bool { return s.sorted[i] < s.sorted[j] })
+	s.Min, s.Max = s.sorted[0], s.sorted[s.N-1]
+	var sum float64
+	for _, x := range xs {
+		sum += float64(x)
+	}
+	mean := sum / float64(s.N)
+	s.Mean = T(mean)
+	if s.N > 1 {
+		var ss float64
+		for _, x := range xs {
+			d := float64(x) - mean
+			ss += d * d
+		}
+		s.Stddev = T(math.Sqrt(ss / float64(s.N-1)))
+	}
+	return s
+}
+
+// Quantile returns the q-th quantile (0 <= q <= 1), interpolating
+// linearly between the samples either side of it.
+func (s Summary[T]) Quantile(q float64) T {
+	if s.N == 0 {
+		return 0
+	}
+	pos := min(max(q, 0), 1) * float64(s.N-1)
+	lo, hi := int(math.Floor(pos)), int(math.Ceil(pos))
+	f := pos - float64(lo)
+	return T(float64(s.sorted[lo])*(1-f) + float64(s.sorted[hi])*f)
+}
+
+// CI95 returns the half-width of the 95% confidence interval for the
+// mean: the true mean lies within Mean ± CI95, by Student's t with N-1
+// degrees of freedom. It is 0 with fewer than two samples.
+func (s Summary[T]) CI95() T {
+	if s.N < 2 {
+		return 0
+	}
+	return T(tCritical95(s.N-1) * float64(s.Stddev) / math.Sqrt(float64(s.N)))
+}
+
+func (s Summary[T]) String() string {
+	if s.N == 0 {
+		return "no samples"
+	}
+	return fmt.Sprintf("mean %v ±%v p50 %v p95 %v p99 %v max %v (N=%d)",
+		s.Mean, s.CI95(), s.Quantile(0.50), s.Quantile(0.95), s.Quantile(0.99), s.Max, s.N)
+}
+
+// Percentile returns the q-th quantile of xs, as Summarize(xs).Quantile(q).
+func Percentile[T Number](xs []T, q float64) T {
+	return Summarize(xs).Quantile(q)
+}
+
+// t95 is the two-sided 95% critical value of Student's t for 1 to 30
+// degrees of freedom.
+var t95 = [...]float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tCritical95 returns the 95% critical value for df degrees of freedom;
+// past the table, 1.96 + 2.5/df is within 0.002 of it.
+func tCritical95(df int) float64 {
+	if df <= len(t95) {
+		return t95[max(df, 1)-1]
+	}
+	return 1.96 + 2.5/float64(df)
+}
@@ -0,0 +1,158 @@
+package vcpu
+
+import "fmt"
+
+// Context is the CPU state a context switch saves and restores.
+type Context struct {
+	Regs  [NumRegs]int64
+	PC    int64 // address of the next instruction, relative to Base
+	Base  int64 // physical address of the process's address 0
+	Limit int64 // size of its address space
+}
+
+// Trap is why Step returned control to the kernel.
+type Trap int
+
+const (
+	TrapNone    Trap = iota // the instruction ran; carry on
+	TrapTimer               // the timer went off before the next instruction
+	TrapSyscall             // a SYS instruction ran; Inst says which call
+	TrapHalt                // a HALT instruction ran
+	TrapFault               // the instruction faulted; CPU.Fault says why
+)
+
+func (t Trap) String() string {
+	switch t {
+	case TrapNone:
+		return "none"
+	case TrapTimer:
+		return "timer"
+	case TrapSyscall:
+		return "syscall"
+	case TrapHalt:
+		return "halt"
+	case TrapFault:
+		return "fault"
+	}
+	return fmt.Sprintf("Trap(%d)", int(t))
+}
+
+// CPU is the processor: the registers of whatever runs on it, physical
+// memory, and the timer.
+type CPU struct {
+	Context
+	Mem    []int64 // physical memory
+	Timer  int     // instructions before the timer interrupt; negative: off
+	Cycles int64   // instructions executed, and cycles the kernel charged
+	Inst   Inst    // the instruction last executed
+	Fault  error   // why the last TrapFault happened
+}
+
+// NewCPU returns a CPU with words of zeroed memory and the timer off.
+func NewCPU(words int) *CPU {
+	return &CPU{Mem: make([]int64, words), Timer: -1}
+}
+
+// Save returns the registers, as a context switch saves them into the
+// outgoing process.
+func (c *CPU) Save() Context { return c.Context }
+
+// Restore loads the registers of the incoming process.
+func (c *CPU) Restore(ctx Context) { c.Context = ctx }
+
+// addr translates a virtual address through base and limit.
+func (c *CPU) addr(v int64) (int64, error) {
+	if v < 0 || v >= c.Limit {
+		return 0, fmt.Errorf("address %d outside 0..%d", v, c.Limit-1)
+	}
+	return c.Base + v, nil
+}
+
+// Step runs one fetch-decode-execute cycle, unless the timer has run
+// out, in which case it interrupts first.
+func (c *CPU) Step() Trap {
+	if c.Timer == 0 {
+		c.Timer = -1
+		return TrapTimer
+	}
+	pa, err := c.addr(c.PC)
+	if err != nil {
+		c.Fault = fmt.Errorf("fetch at pc %d: %v", c.PC, err)
+		return TrapFault
+	}
+	in := Decode(c.Mem[pa])
+	c.Inst = in
+	c.PC++
+	c.Cycles++
+	if c.Timer > 0 {
+		c.Timer--
+	}
+
+	r := &c.Regs
+	if in.Rd >= NumRegs || in.Rs >= NumRegs || in.Rt >= NumRegs {
+		c.Fault = fmt.Errorf("pc %d: bad register in %v", c.PC-1, in)
+		return TrapFault
+	}
+	switch in.Op {
+	case NOP:
+	case HALT:
+		return TrapHalt
+	case LOADI:
+		r[in.Rd] = int64(in.Imm)
+	case MOV:
+		r[in.Rd] = r[in.Rs]
+	case ADD:
+		r[in.Rd] = r[in.Rs] + r[in.Rt]
+	case SUB:
+		r[in.Rd] = r[in.Rs] - r[in.Rt]
+	case MUL:
+		r[in.Rd] = r[in.Rs] * r[in.Rt]
+	case DIV, MOD:
+		if r[in.Rt] == 0 {
+			c.Fault = fmt.Errorf("pc %d: division by zero", c.PC-1)
+			return TrapFault
+		}
+		if in.Op == DIV {
+			r[in.Rd] = r[in.Rs] / r[in.Rt]
+		} else {
+			r[in.Rd] = r[in.Rs] % r[in.Rt]
+		}
+	case ADDI:
+		r[in.Rd] = r[in.Rs] + int64(in.Imm)
+	case LOAD, STORE:
+		base := r[in.Rs]
+		if in.Op == STORE {
+			base = r[in.Rt]
+		}
+		pa, err := c.addr(base + int64(in.Imm))
+		if err != nil {
+			c.Fault = fmt.Errorf("pc %d: %v: %v", c.PC-1, in.Op, err)
+			return TrapFault
+		}
+		if in.Op == LOAD {
+			r[in.Rd] = c.Mem[pa]
+		} else {
+			c.Mem[pa] = r[in.Rs]
+		}
+	case JMP:
+		c.PC = int64(in.Imm)
+	case JZ:
+		if r[in.Rs] == 0 {
+			c.PC = int64(in.Imm)
+		}
+	case JNZ:
+		if r[in.Rs] != 0 {
+			c.PC = int64(in.Imm)
+		}
+	case JLT:
+		if r[in.Rs] < r[in.Rt] {
+			c.PC = int64(in.Imm)
+		}
+	case SYS:
+		return TrapSyscall
+	default:
+		c.Fault = fmt.Errorf("pc %d: illegal instruction %#x", c.PC-1, c.Mem[pa])
+		return TrapFault
+	}
+	return TrapNone
+}
@@ -0,0 +1,253 @@
+// Package vcpu is a tiny computer for seeing the mechanisms behind the
+// rest of this repo's simulations at work on real code: a CPU that
+// fetches, decodes and executes 64-bit instruction words, a timer that
+// interrupts it every so many instructions, and a kernel that runs
+// several user programs on it by saving one's registers into its process
+// control block and restoring another's: a context switch.
+//
+// The machine has NumRegs general registers, a program counter, and
+// base and limit registers that relocate and bound every address, so each
+// process sees its own memory from address 0 up (OSTEP's base and
+// bounds). An access outside it faults and the kernel kills the process.
+// Programs are written in a small assembly language (Assemble). Which
+// process runs next, and for how many instructions, is up to a Scheduler;
+// Kernel.OnSwitch sees every switch.
+package vcpu
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NumRegs is the number of general registers, r0 to r7.
+const NumRegs = 8
+
+// Op is an instruction's opcode.
+type Op uint8
+
+const (
+	NOP   Op = iota
+	HALT     // stop the process
+	LOADI    // rd = imm
+	MOV      // rd = rs
+	ADD      // rd = rs + rt
+	SUB      // rd = rs - rt
+	MUL      // rd = rs * rt
+	DIV      // rd = rs / rt; faults on zero
+	MOD      // rd = rs % rt; faults on zero
+	ADDI     // rd = rs + imm
+	LOAD     // rd = mem[rs + imm]
+	STORE    // mem[rt + imm] = rs
+	JMP      // pc = imm
+	JZ       // if rs == 0, pc = imm
+	JNZ      // if rs != 0, pc = imm
+	JLT      // if rs < rt, pc = imm
+	SYS      // system call imm, argument in r1, result in r0
+	numOps
+)
+
+// field is an operand position in assembly.
+type field int
+
+const (
+	fRd field = iota
+	fRs
+	fRt
+	fImm
+)
+
+// ops is every opcode's mnemonic and operands, in assembly order.
+var ops = [numOps]struct {
+	name     string
+	operands []field
+}{
+	NOP:   {"NOP", nil},
+	HALT:  {"HALT", nil},
+	LOADI: {"LOADI", []field{fRd, fImm}},
+	MOV:   {"MOV", []field{fRd, fRs}},
+	ADD:   {"ADD", []field{fRd, fRs, fRt}},
+	SUB:   {"SUB", []field{fRd, fRs, fRt}},
+	MUL:   {"MUL", []field{fRd, fRs, fRt}},
+	DIV:   {"DIV", []field{fRd, fRs, fRt}},
+	MOD:   {"MOD", []field{fRd, fRs, fRt}},
+	ADDI:  {"ADDI", []field{fRd, fRs, fImm}},
+	LOAD:  {"LOAD", []field{fRd, fRs, fImm}},
+	STORE: {"STORE", []field{fRs, fRt, fImm}},
+	JMP:   {"JMP", []field{fImm}},
+	JZ:    {"JZ", []field{fRs, fImm}},
+	JNZ:   {"JNZ", []field{fRs, fImm}},
+	JLT:   {"JLT", []field{fRs, fRt, fImm}},
+	SYS:   {"SYS", []field{fImm}},
+}
+
+func (o Op) String() string {
+	if o < numOps {
+		return ops[o].name
+	}
+	return fmt.Sprintf("Op(%d)", uint8(o))
+}
+
+// System calls.
+const (
+	SysExit   = 0 // end the process
+	SysPrint  = 1 // print r1
+	SysYield  = 2 // give up the CPU
+	SysGetpid = 3 // r0 = the process's pid
+)
+
+// Inst is a decoded instruction.
+type Inst struct {
+	Op         Op
+	Rd, Rs, Rt uint8
+	Imm        int32
+}
+
+// Encode packs i into a word: opcode, rd, rs and rt a byte each from the
+// top, then the immediate in the low 32 bits.
+func (i Inst) Encode() int64 {
+	return int64(uint64(i.Op)<<56 | uint64(i.Rd)<<48 | uint64(i.Rs)<<40 | uint64(i.Rt)<<32 | uint64(uint32(i.Imm)))
+}
+
+// Decode unpacks a word Encode made.
+func Decode(w int64) Inst {
+	u := uint64(w)
+	return Inst{Op: Op(u >> 56), Rd: uint8(u >> 48), Rs: uint8(u >> 40), Rt: uint8(u >> 32), Imm: int32(uint32(u))}
+}
+
+// String is i in assembly.
+func (i Inst) String() string {
+	if i.Op >= numOps {
+		return fmt.Sprintf(".word %d", i.Encode())
+	}
+	var args []string
+	for _, f := range ops[i.Op].operands {
+		switch f {
+		case fRd:
+			args = append(args, fmt.Sprintf("r%d", i.Rd))
+		case fRs:
+			args = append(args, fmt.Sprintf("r%d", i.Rs))
+		case fRt:
+			args = append(args, fmt.Sprintf("r%d", i.Rt))
+		case fImm:
+			args = append(args, strconv.Itoa(int(i.Imm)))
+		}
+	}
+	if len(args) == 0 {
+		return i.Op.String()
+	}
+	return i.Op.String() + " " + strings.Join(args, ", ")
+}
+
+// Program is machine code: the words loaded at a process's address 0.
+type Program []int64
+
+// Disassemble lists p an instruction per line, with addresses.
+func (p Program) Disassemble() string {
+	var b strings.Builder
+	for a, w := range p {
+		fmt.Fprintf(&b, "%4d  %s\n", a, Decode(w))
+	}
+	return b.String()
+}
+
+// Assemble translates assembly into a Program. A line is an optional
+// "label:", then an instruction ("ADDI r1, r1, -1") or ".word N"; ';' or
+// '#' starts a comment. An immediate may be a number or a label, which
+// stands for its address.
+func Assemble(src string) (Program, error) {
+	type line struct {
+		no     int
+		fields []string
+	}
+	var lines []line
+	labels := map[string]int{}
+	sc := bufio.NewScanner(strings.NewReader(src))
+	for no := 1; sc.Scan(); no++ {
+		text := sc.Text()
+		if i := strings.IndexAny(text, ";#"); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if label, rest, ok := strings.Cut(text, ":"); ok {
+			label = strings.TrimSpace(label)
+			if label == "" || strings.ContainsAny(label, " \t,") {
+				return nil, fmt.Errorf("vcpu: line %d: bad label %q", no, label)
+			}
+			if _, dup := labels[label]; dup {
+				return nil, fmt.Errorf("vcpu: line %d: label %q defined twice", no, label)
+			}
+			labels[label] = len(lines)
+			text = strings.TrimSpace(rest)
+		}
+		if text == "" {
+			continue
+		}
+		f := strings.Fields(strings.ReplaceAll(text, ",", " "))
+		lines = append(lines, line{no, f})
+	}
+
+	imm := func(s string) (int32, error) {
+		if a, ok := labels[s]; ok {
+			return int32(a), nil
+		}
+		v, err := strconv.ParseInt(s, 0, 32)
+		if err != nil {
+			return 0, fmt.Errorf("bad immediate or unknown label %q", s)
+		}
+		return int32(v), nil
+	}
+	reg := func(s string) (uint8, error) {
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(s), "r"))
+		if !strings.HasPrefix(strings.ToLower(s), "r") || err != nil || n < 0 || n >= NumRegs {
+			return 0, fmt.Errorf("bad register %q (r0 to r%d)", s, NumRegs-1)
+		}
+		return uint8(n), nil
+	}
+
+	prog := make(Program, 0, len(lines))
+	for _, l := range lines {
+		name, args := strings.ToUpper(l.fields[0]), l.fields[1:]
+		if name == ".WORD" {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("vcpu: line %d: .word takes one value", l.no)
+			}
+			v, err := strconv.ParseInt(args[0], 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("vcpu: line %d: bad .word %q", l.no, args[0])
+			}
+			prog = append(prog, v)
+			continue
+		}
+		op := NOP
+		for op < numOps && ops[op].name != name {
+			op++
+		}
+		if op == numOps {
+			return nil, fmt.Errorf("vcpu: line %d: unknown instruction %q", l.no, l.fields[0])
+		}
+		if len(args) != len(ops[op].operands) {
+			return nil, fmt.Errorf("vcpu: line %d: %v takes %d operands, got %d", l.no, op, len(ops[op].operands), len(args))
+		}
+		in := Inst{Op: op}
+		for k, f := range ops[op].operands {
+			var err error
+			switch f {
+			case fRd:
+				in.Rd, err = reg(args[k])
+			case fRs:
+				in.Rs, err = reg(args[k])
+			case fRt:
+				in.Rt, err = reg(args[k])
+			case fImm:
+				in.Imm, err = imm(args[k])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("vcpu: line %d: %v", l.no, err)
+			}
+		}
+		prog = append(prog, in.Encode())
+	}
+	return prog, nil
+}
@@ -0,0 +1,271 @@
+package vcpu
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// State is where a process is in its life.
+type State int
+
+const (
+	Ready State = iota
+	Running
+	Exited
+	Killed
+)
+
+func (s State) String() string {
+	switch s {
+	case Ready:
+		return "ready"
+	case Running:
+		return "running"
+	case Exited:
+		return "exited"
+	case Killed:
+		return "killed"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Process is a process control block: the saved context of a process
+// that isn't running, and its accounting.
+type Process struct {
+	PID      int
+	Name     string
+	Priority int // for the Priority scheduler: lower runs first
+	Context      // saved registers, valid while not Running
+	State    State
+	Err      error   // the fault that killed it
+	Output   []int64 // what it printed
+
+	Instructions int64 // instructions it executed
+	Dispatches   int   // times it was given the CPU
+	Preemptions  int   // times the timer took the CPU away
+	Yields       int   // times it gave the CPU up
+	FirstRun     int64 // cycle it first ran at (-1 until then)
+	Finished     int64 // cycle it exited or was killed at
+}
+
+// Scheduler decides which ready process runs next and for how long.
+type Scheduler interface {
+	Name() string
+	// Ready queues p: when it is spawned, preempted, or yields.
+	Ready(p *Process)
+	// Next removes and returns the process to run; only called when
+	// Len() > 0.
+	Next() *Process
+	Len() int
+	// Quantum is how many instructions p may run before the timer
+	// interrupts it; 0 is until it yields or exits.
+	Quantum(p *Process) int
+}
+
+// FIFO runs each process until it yields or exits, in order of arrival.
+type FIFO struct{ queue []*Process }
+
+func (s *FIFO) Name() string           { return "FIFO" }
+func (s *FIFO) Ready(p *Process)       { s.queue = append(s.queue, p) }
+func (s *FIFO) Len() int               { return len(s.queue) }
+func (s *FIFO) Quantum(p *Process) int { return 0 }
+func (s *FIFO) Next() *Process {
+	p := s.queue[0]
+	s.queue = s.queue[1:]
+	return p
+}
+
+// RoundRobin runs each process for at most Q instructions in turn.
+type RoundRobin struct {
+	Q int
+	FIFO
+}
+
+func (s *RoundRobin) Name() string           { return fmt.Sprintf("RR(q=%d)", s.Q) }
+func (s *RoundRobin) Quantum(p *Process) int { return s.Q }
+
+// Priority runs the ready process of lowest Priority value, round robin
+// among equals, for at most Q instructions.
+type Priority struct {
+	Q     int
+	queue []*Process
+}
+
+func (s *Priority) Name() string           { return fmt.Sprintf("Priority(q=%d)", s.Q) }
+func (s *Priority) Len() int               { return len(s.queue) }
+func (s *Priority) Quantum(p *Process) int { return s.Q }
+func (s *Priority) Ready(p *Process) {
+	// After every process of its priority: round robin among equals
+	i := sort.Search(len(s.queue), func(i int) bool { return s.queue[i].Priority > p.Priority })
+	s.queue = append(s.queue, nil)
+	copy(s.queue[i+1:], s.queue[i:])
+	s.queue[i] = p
+}
+func (s *Priority) Next() *Process {
+	p := s.queue[0]
+	s.queue = s.queue[1:]
+	return p
+}
+
+// Schedulers names every scheduler NewScheduler makes.
+var Schedulers = []string{"fifo", "rr", "prio"}
+
+// NewScheduler returns the scheduler named name, with quantum q where it
+// has one.
+func NewScheduler(name string, q int) (Scheduler, error) {
+	if q < 1 {
+		return nil, fmt.Errorf("vcpu: quantum must be at least 1, got %d", q)
+	}
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "fifo", "fcfs":
+		return &FIFO{}, nil
+	case "rr", "round-robin":
+		return &RoundRobin{Q: q}, nil
+	case "prio", "priority":
+		return &Priority{Q: q}, nil
+	}
+	return nil, fmt.Errorf("vcpu: unknown scheduler %q (%s)", name, strings.Join(Schedulers, ", "))
+}
+
+// Kernel runs processes on a CPU.
+type Kernel struct {
+	CPU        *CPU
+	Sched      Scheduler
+	SwitchCost int       // cycles a switch to another process costs
+	Out        io.Writer // where SysPrint writes, if not nil
+	// OnSwitch, if not nil, is called at every switch from one process
+	// to another, after from's context is saved (from.State says why it
+	// left; nil the first time) and before to's is restored.
+	OnSwitch func(from, to *Process)
+
+	procs    []*Process
+	free     int64 // next unallocated physical address
+	Switches int   // switches from one process to another
+	Timer    int   // timer interrupts taken
+	Syscalls int
+	Overhead int64 // cycles spent switching
+}
+
+// NewKernel returns a kernel for a CPU with words of memory, scheduling
+// with s.
+func NewKernel(words int, s Scheduler) *Kernel {
+	return &Kernel{CPU: NewCPU(words), Sched: s}
+}
+
+// ErrNoMemory is returned by Spawn when physical memory is used up.
+var ErrNoMemory = errors.New("vcpu: out of physical memory")
+
+// Spawn loads prog into an address space of words words and makes it a
+// ready process.
+func (k *Kernel) Spawn(name string, prog Program, words, priority int) (*Process, error) {
+	if words < len(prog) {
+		return nil, fmt.Errorf("vcpu: %s needs %d words, given %d", name, len(prog), words)
+	}
+	if k.free+int64(words) > int64(len(k.CPU.Mem)) {
+		return nil, ErrNoMemory
+	}
+	p := &Process{PID: len(k.procs) + 1, Name: name, Priority: priority, FirstRun: -1,
+		Context: Context{Base: k.free, Limit: int64(words)}}
+	copy(k.CPU.Mem[k.free:], prog)
+	k.free += int64(words)
+	k.procs = append(k.procs, p)
+	k.Sched.Ready(p)
+	return p, nil
+}
+
+// Processes returns every process spawned, in pid order.
+func (k *Kernel) Processes() []*Process { return k.procs }
+
+// Run runs processes until all have exited or been killed, or the CPU
+// has done maxCycles cycles (0 for no limit).
+func (k *Kernel) Run(maxCycles int64) error {
+	cpu := k.CPU
+	var cur, last *Process
+	for maxCycles == 0 || cpu.Cycles < maxCycles {
+		if cur == nil {
+			if k.Sched.Len() == 0 {
+				return nil
+			}
+			cur = k.Sched.Next()
+			if cur != last {
+				if k.OnSwitch != nil {
+					k.OnSwitch(last, cur)
+				}
+				if last != nil {
+					k.Switches++
+					cpu.Cycles += int64(k.SwitchCost)
+					k.Overhead += int64(k.SwitchCost)
+				}
+				last = cur
+			}
+			cpu.Restore(cur.Context)
+			cpu.Timer = -1
+			if q := k.Sched.Quantum(cur); q > 0 {
+				cpu.Timer = q
+			}
+			cur.State = Running
+			cur.Dispatches++
+			if cur.FirstRun < 0 {
+				cur.FirstRun = cpu.Cycles
+			}
+		}
+
+		trap := cpu.Step()
+		if trap != TrapTimer {
+			cur.Instructions++
+		}
+		switch trap {
+		case TrapNone:
+			continue
+		case TrapTimer:
+			k.Timer++
+			cur.Preemptions++
+		case TrapSyscall:
+			k.Syscalls++
+			switch cpu.Inst.Imm {
+			case SysExit:
+				k.finish(cur, Exited, nil)
+				cur = nil
+				continue
+			case SysPrint:
+				cur.Output = append(cur.Output, cpu.Regs[1])
+				if k.Out != nil {
+					fmt.Fprintf(k.Out, "[%d %s] %d\n", cur.PID, cur.Name, cpu.Regs[1])
+				}
+				continue
+			case SysYield:
+				cur.Yields++
+			case SysGetpid:
+				cpu.Regs[0] = int64(cur.PID)
+				continue
+			default:
+				k.finish(cur, Killed, fmt.Errorf("pc %d: unknown system call %d", cpu.PC-1, cpu.Inst.Imm))
+				cur = nil
+				continue
+			}
+		case TrapHalt:
+			k.finish(cur, Exited, nil)
+			cur = nil
+			continue
+		case TrapFault:
+			k.finish(cur, Killed, cpu.Fault)
+			cur = nil
+			continue
+		}
+		// Preempted or yielded: save its registers and queue it again
+		cur.Context = cpu.Save()
+		cur.State = Ready
+		k.Sched.Ready(cur)
+		cur = nil
+	}
+	return fmt.Errorf("vcpu: stopped after %d cycles with processes still running", cpu.Cycles)
+}
+
+// finish ends cur, saving its final registers.
+func (k *Kernel) finish(cur *Process, s State, err error) {
+	cur.Context = k.CPU.Save()
+	cur.State, cur.Err, cur.Finished = s, err, k.CPU.Cycles
+}
@@ -0,0 +1,127 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+)
+
+// Curve is one policy run over a range of memory sizes.
+type Curve struct {
+	Policy string
+	Points []PagingResult // by increasing frame count
+}
+
+// Anomalies lists the frame counts at which this curve faults more than
+// with one frame fewer: Belady's anomaly, which FIFO can show but stack
+// policies like LRU and OPT never do.
+func (c Curve) Anomalies() []int {
+	var out []int
+	for i := 1; i < len(c.Points); i++ {
+		prev, cur := c.Points[i-1], c.Points[i]
+		if cur.Frames == prev.Frames+1 && cur.Faults > prev.Faults {
+			out = append(out, cur.Frames)
+		}
+	}
+	return out
+}
+
+// Curves runs refs through every named policy at every frame count.
+func Curves(refs []PageRef, policies []string, frames []int, seed int64) ([]Curve, error) {
+	var out []Curve
+	for _, name := range policies {
+		var c Curve
+		for _, n := range frames {
+			p, err := NewReplacer(name, refs, seed)
+			if err != nil {
+				return nil, err
+			}
+			res, err := RunPaging(refs, n, p, false)
+			if err != nil {
+				return nil, err
+			}
+			c.Policy = res.Policy
+			c.Points = append(c.Points, res)
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// WriteCurvesCSV writes one row per frame count, a hit-rate column per
+// policy, for plotting elsewhere.
+func WriteCurvesCSV(w io.Writer, curves []Curve) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("frames")
+	for _, c := range curves {
+		fmt.Fprintf(bw, ",%s", c.Policy)
+	}
+	bw.WriteString("\n")
+	for i := range curves[0].Points {
+		fmt.Fprint(bw, curves[0].Points[i].Frames)
+		for _, c := range curves {
+			fmt.Fprintf(bw, ",%.4f", c.Points[i].HitRate())
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// curveColors colors the policies on the SVG chart.
+var curveColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#59a14f", "#b07aa1", "#9c755f"}
+
+// WriteCurvesSVG draws the hit rate of every policy against the number of
+// frames, the classic policy-comparison chart.
+func WriteCurvesSVG(w io.Writer, curves []Curve) error {
+	const (
+		left, right = 50, 110 // margins, px; the legend goes on the right
+		top, bottom = 20, 40
+		plotW       = 700
+		plotH       = 360
+	)
+	points := curves[0].Points
+	lo, hi := points[0].Frames, points[len(points)-1].Frames
+	x := func(f int) float64 {
+		if hi == lo {
+			return left + plotW/2
+		}
+		return left + float64(f-lo)*plotW/float64(hi-lo)
+	}
+	y := func(rate float64) float64 { return top + (1-rate)*plotH }
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="11">`+"\n", left+plotW+right, top+plotH+bottom)
+	fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	for pct := 0; pct <= 100; pct += 10 {
+		fmt.Fprintf(bw, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#eee"/>`+"\n", left, y(float64(pct)/100), left+plotW, y(float64(pct)/100))
+		fmt.Fprintf(bw, `<text x="%d" y="%.1f" text-anchor="end">%d%%</text>`+"\n", left-4, y(float64(pct)/100)+4, pct)
+	}
+	fmt.Fprintf(bw, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`+"\n", left, top+plotH, left+plotW, top+plotH)
+	step := 1
+	for (hi-lo)/step > 10 {
+		step *= 2
+	}
+	for f := lo; f <= hi; f += step {
+		fmt.Fprintf(bw, `<text x="%.1f" y="%d" text-anchor="middle">%d</text>`+"\n", x(f), top+plotH+14, f)
+	}
+	fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="middle">frames</text>`+"\n", left+plotW/2, top+plotH+32)
+
+	for i, c := range curves {
+		color := curveColors[i%len(curveColors)]
+		bw.WriteString(`<polyline fill="none" stroke-width="2" stroke="` + color + `" points="`)
+		for _, p := range c.Points {
+			fmt.Fprintf(bw, "%.1f,%.1f ", x(p.Frames), y(p.HitRate()))
+		}
+		bw.WriteString(`"/>` + "\n")
+		for _, p := range c.Points {
+			fmt.Fprintf(bw, `<circle cx="%.1f" cy="%.1f" r="2" fill="%s"><title>%s, %d frames: %.1f%% hits</title></circle>`+"\n",
+				x(p.Frames), y(p.HitRate()), color, html.EscapeString(c.Policy), p.Frames, 100*p.HitRate())
+		}
+		ly := top + 10 + 18*i
+		fmt.Fprintf(bw, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="2"/>`+"\n", left+plotW+10, ly, left+plotW+30, ly, color)
+		fmt.Fprintf(bw, `<text x="%d" y="%d">%s</text>`+"\n", left+plotW+36, ly+4, html.EscapeString(c.Policy))
+	}
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
@@ -0,0 +1,254 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand"
+)
+
+// ErrInvalid is the fault for an access to a page with no valid mapping.
+var ErrInvalid = errors.New("invalid page (segmentation fault)")
+
+// Walker is implemented by translators that read page-table entries from
+// memory to translate; Run counts those reads per access.
+type Walker interface {
+	// LastWalk is the number of memory reads the latest Translate made.
+	LastWalk() int
+}
+
+// Paged is implemented by paging translators. Their regions are virtual
+// (Region.Base is a virtual address) and physical memory is handed out in
+// page frames, so there is no external fragmentation to report.
+type Paged interface {
+	PageSize() uint64
+	// Frames counts physical frames holding data pages, holding the page
+	// table itself, and still free.
+	Frames() (data, table, free int)
+}
+
+// Paging configures a page table.
+type Paging struct {
+	AddressSpace uint64 // virtual address space size, a power of two
+	PageSize     uint64 // a power of two
+	Levels       int    // 1 (a linear table), 2, or 3
+	PTESize      uint64 // bytes per entry (default 4)
+	PhysMem      uint64
+	Seed         int64 // where data pages land among the free frames
+	Spaces       int   // address spaces (processes, ASIDs 0..Spaces-1) with the same layout; default 1
+}
+
+// pte is a page-table entry: valid and protection bits, and either the
+// next-level table (inner levels) or a frame number (the last level).
+type pte struct {
+	valid bool
+	prot  Prot
+	next  *ptNode
+	pfn   uint64
+}
+
+// ptNode is one table of the tree; it occupies whole page frames.
+type ptNode struct {
+	entries []pte
+}
+
+// PageTable is a multi-level (radix tree) page table. The virtual page
+// number is split into one index per level, the root taking any leftover
+// bit; inner tables are only allocated for parts of the address space that
+// have mappings, which is the whole point over a linear table. Every
+// translation walks the tree from the root, one memory read per level.
+type PageTable struct {
+	cfg     Paging
+	shifts  []uint    // per level, root first: how far to shift the VPN
+	widths  []uint    // per level: index bits
+	roots   []*ptNode // one tree per address space
+	cur     int       // the running address space
+	regions []Region  // the mapped virtual regions
+	free    []uint64  // free frame numbers, in allocation order
+	data    int       // frames holding data pages
+	table   int       // frames holding page tables
+	walk    int       // reads made by the latest Translate
+}
+
+// NewPageTable builds a page table mapping every page of regions (virtual
+// extents, e.g. Segmentation.Virtual) with the region's protection, once
+// per address space.
+func NewPageTable(cfg Paging, regions []Region) (*PageTable, error) {
+	if cfg.PTESize == 0 {
+		cfg.PTESize = 4
+	}
+	cfg.Spaces = max(cfg.Spaces, 1)
+	switch {
+	case !pow2(cfg.AddressSpace) || !pow2(cfg.PageSize):
+		return nil, fmt.Errorf("address space and page size must be powers of two, got %d and %d", cfg.AddressSpace, cfg.PageSize)
+	case cfg.PageSize > cfg.AddressSpace:
+		return nil, fmt.Errorf("page size %d is larger than the %d-byte address space", cfg.PageSize, cfg.AddressSpace)
+	case cfg.Levels < 1 || cfg.Levels > 3:
+		return nil, fmt.Errorf("page tables have 1 to 3 levels, got %d", cfg.Levels)
+	}
+	vpnBits := uint(bits.TrailingZeros64(cfg.AddressSpace) - bits.TrailingZeros64(cfg.PageSize))
+	if vpnBits < uint(cfg.Levels) {
+		return nil, fmt.Errorf("%d virtual page number bit(s) can't be split over %d levels", vpnBits, cfg.Levels)
+	}
+	t := &PageTable{cfg: cfg, regions: regions}
+	// Split the VPN evenly, the root taking the remainder
+	per := vpnBits / uint(cfg.Levels)
+	shift := vpnBits
+	for l := 0; l < cfg.Levels; l++ {
+		w := per
+		if l == 0 {
+			w += vpnBits % uint(cfg.Levels)
+		}
+		shift -= w
+		t.widths = append(t.widths, w)
+		t.shifts = append(t.shifts, shift)
+	}
+
+	frames := cfg.PhysMem / cfg.PageSize
+	for f := uint64(0); f < frames; f++ {
+		t.free = append(t.free, f)
+	}
+	// The roots go at the bottom of memory (where the page-table base
+	// register points); everything else is scattered
+	for range cfg.Spaces {
+		root, err := t.newNode(0)
+		if err != nil {
+			return nil, err
+		}
+		t.roots = append(t.roots, root)
+	}
+	rand.New(rand.NewSource(cfg.Seed)).Shuffle(len(t.free), func(i, j int) { t.free[i], t.free[j] = t.free[j], t.free[i] })
+
+	for _, r := range regions {
+		if r.Base+r.Size > cfg.AddressSpace {
+			return nil, fmt.Errorf("%s [%#x, %#x) is outside the %d-byte address space", r.Name, r.Base, r.Base+r.Size, cfg.AddressSpace)
+		}
+	}
+	for asid, root := range t.roots {
+		for _, r := range regions {
+			if r.Size == 0 {
+				continue
+			}
+			for vpn := r.Base / cfg.PageSize; vpn <= (r.Base+r.Size-1)/cfg.PageSize; vpn++ {
+				if err := t.mapPage(root, vpn, r.Prot); err != nil {
+					return nil, fmt.Errorf("mapping %s in address space %d: %v", r.Name, asid, err)
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// newNode allocates a table for the given level.
+func (t *PageTable) newNode(level int) (*ptNode, error) {
+	n := uint64(1) << t.widths[level]
+	need := int((n*t.cfg.PTESize + t.cfg.PageSize - 1) / t.cfg.PageSize)
+	if len(t.free) < need {
+		return nil, errors.New("out of physical memory for the page table")
+	}
+	t.free = t.free[need:]
+	t.table += need
+	return &ptNode{entries: make([]pte, n)}, nil
+}
+
+// mapPage maps vpn to a fresh frame in the tree under root, allocating
+// tables on the way down.
+func (t *PageTable) mapPage(root *ptNode, vpn uint64, prot Prot) error {
+	node := root
+	for l := range t.widths {
+		e := &node.entries[t.index(vpn, l)]
+		if l == len(t.widths)-1 {
+			if e.valid {
+				return fmt.Errorf("virtual page %#x is mapped twice", vpn)
+			}
+			if len(t.free) == 0 {
+				return errors.New("out of physical memory")
+			}
+			*e = pte{valid: true, prot: prot, pfn: t.free[0]}
+			t.free = t.free[1:]
+			t.data++
+			return nil
+		}
+		if !e.valid {
+			next, err := t.newNode(l + 1)
+			if err != nil {
+				return err
+			}
+			*e = pte{valid: true, prot: ProtAll, next: next}
+		}
+		node = e.next
+	}
+	return nil
+}
+
+// index is vpn's index into its level-l table.
+func (t *PageTable) index(vpn uint64, l int) uint64 {
+	return vpn >> t.shifts[l] & (1<<t.widths[l] - 1)
+}
+
+func (t *PageTable) Name() string {
+	s := fmt.Sprintf("page table(%d-level, %d-byte pages, index bits %v", t.cfg.Levels, t.cfg.PageSize, t.widths)
+	if t.cfg.Spaces > 1 {
+		s += fmt.Sprintf(", %d address spaces", t.cfg.Spaces)
+	}
+	return s + ")"
+}
+
+func (t *PageTable) Translate(va uint64, op Op) (uint64, int, error) {
+	e, reads, err := t.lookup(va / t.cfg.PageSize)
+	t.walk = reads
+	if err == nil && !e.prot.Allows(op) {
+		err = ErrProtection
+	}
+	if err != nil {
+		return 0, t.region(va), err
+	}
+	return e.pfn*t.cfg.PageSize + va%t.cfg.PageSize, t.region(va), nil
+}
+
+// lookup walks the running address space's tree for vpn and returns its
+// last-level entry and the number of entries read on the way.
+func (t *PageTable) lookup(vpn uint64) (pte, int, error) {
+	node := t.roots[t.cur]
+	for l := range t.widths {
+		e := node.entries[t.index(vpn, l)]
+		if !e.valid {
+			return pte{}, l + 1, ErrInvalid
+		}
+		if l == len(t.widths)-1 {
+			return e, l + 1, nil
+		}
+		node = e.next
+	}
+	return pte{}, len(t.widths), ErrInvalid
+}
+
+// region returns the index of the region va falls in, or -1.
+func (t *PageTable) region(va uint64) int {
+	for i, r := range t.regions {
+		if va >= r.Base && va < r.Base+r.Size {
+			return i
+		}
+	}
+	return -1
+}
+
+// Switch makes address space asid the running one (a context switch).
+func (t *PageTable) Switch(asid int) error {
+	if asid < 0 || asid >= len(t.roots) {
+		return fmt.Errorf("no address space %d (there are %d)", asid, len(t.roots))
+	}
+	t.cur = asid
+	return nil
+}
+
+func (t *PageTable) Regions() []Region { return t.regions }
+func (t *PageTable) LastWalk() int     { return t.walk }
+func (t *PageTable) PageSize() uint64  { return t.cfg.PageSize }
+
+func (t *PageTable) Frames() (data, table, free int) {
+	return t.data, t.table, len(t.free)
+}
+
+// pow2 reports whether v is a power of two.
+func pow2(v uint64) bool { return v != 0 && v&(v-1) == 0 }
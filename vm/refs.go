@@ -0,0 +1,79 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// ParseRefs reads a reference string: page numbers separated by commas,
+// spaces or newlines, each optionally followed by "w" for a write (as in
+// "3w"). Text after '#' on a line is ignored.
+func ParseRefs(r io.Reader) ([]PageRef, error) {
+	var out []PageRef
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		for _, f := range strings.FieldsFunc(text, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' }) {
+			ref := PageRef{}
+			if s, ok := strings.CutSuffix(strings.ToLower(f), "w"); ok {
+				ref.Write, f = true, s
+			}
+			page, err := strconv.ParseUint(f, 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad page number %q", line, f)
+			}
+			ref.Page = page
+			out = append(out, ref)
+		}
+	}
+	return out, sc.Err()
+}
+
+// TraceRefs turns an address trace into a reference string of virtual
+// page numbers. Different address spaces get disjoint pages, so
+// processes compete for the same frames instead of sharing pages.
+func TraceRefs(accesses []Access, pageSize, asize uint64) []PageRef {
+	out := make([]PageRef, len(accesses))
+	for i, a := range accesses {
+		out[i] = PageRef{Page: (uint64(a.ASID)*asize + a.Addr) / pageSize, Write: a.Op == Write}
+	}
+	return out
+}
+
+// GenRefs generates n references to pages 0..pages-1, a fraction writes
+// of them writes, the same for the same seed. The workloads are those of
+// OSTEP's paging-policy chapter:
+//
+//	random  every page equally likely: no locality, so every policy but OPT does about the same
+//	80-20   80% of the references go to 20% of the pages
+//	loop    pages 0..pages-1 over and over: LRU and FIFO's worst case once it doesn't fit
+func GenRefs(kind string, n, pages int, writes float64, seed int64) ([]PageRef, error) {
+	if pages < 1 {
+		return nil, fmt.Errorf("need at least 1 page, got %d", pages)
+	}
+	r := rand.New(rand.NewSource(seed))
+	out := make([]PageRef, n)
+	hot := max(pages/5, 1)
+	for i := range out {
+		switch kind {
+		case "random":
+			out[i].Page = uint64(r.Intn(pages))
+		case "80-20":
+			if r.Float64() < 0.8 || hot == pages {
+				out[i].Page = uint64(r.Intn(hot))
+			} else {
+				out[i].Page = uint64(hot + r.Intn(pages-hot))
+			}
+		case "loop":
+			out[i].Page = uint64(i % pages)
+		default:
+			return nil, fmt.Errorf("unknown reference pattern %q (use random, 80-20, or loop)", kind)
+		}
+		out[i].Write = r.Float64() < writes
+	}
+	return out, nil
+}
@@ -0,0 +1,331 @@
+package vm
+
+import (
+	"container/list"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// PageRef is one entry of a reference string.
+type PageRef struct {
+	Page  uint64
+	Write bool // dirties the page, so evicting it means writing it to swap
+}
+
+// Replacer is a page replacement policy: it tracks the resident pages and
+// picks which one to evict when memory is full. t is the reference's
+// position in the string.
+type Replacer interface {
+	Name() string
+	// Hit records a reference to a resident page.
+	Hit(page uint64, t int)
+	// Add records that page was just loaded into a free frame.
+	Add(page uint64, t int)
+	// Victim picks a resident page to evict and forgets it.
+	Victim(t int) uint64
+	// Resident lists the resident pages in the policy's own order (the
+	// next victim last), for the step-by-step output.
+	Resident() []uint64
+}
+
+// FIFOReplacer evicts the page that was loaded first.
+type FIFOReplacer struct{ queue []uint64 }
+
+func (f *FIFOReplacer) Name() string            { return "FIFO" }
+func (f *FIFOReplacer) Hit(page uint64, t int)  {}
+func (f *FIFOReplacer) Add(page uint64, t int)  { f.queue = append(f.queue, page) }
+func (f *FIFOReplacer) Victim(t int) (p uint64) { p, f.queue = f.queue[0], f.queue[1:]; return p }
+func (f *FIFOReplacer) Resident() []uint64      { return reversed(f.queue) }
+
+// LRUReplacer evicts the least recently used page (a list in recency
+// order, most recent at the front).
+type LRUReplacer struct {
+	order *list.List
+	at    map[uint64]*list.Element
+}
+
+func NewLRU() *LRUReplacer { return &LRUReplacer{order: list.New(), at: map[uint64]*list.Element{}} }
+
+func (l *LRUReplacer) Name() string           { return "LRU" }
+func (l *LRUReplacer) Hit(page uint64, t int) { l.order.MoveToFront(l.at[page]) }
+func (l *LRUReplacer) Add(page uint64, t int) { l.at[page] = l.order.PushFront(page) }
+func (l *LRUReplacer) Victim(t int) uint64 {
+	e := l.order.Back()
+	l.order.Remove(e)
+	p := e.Value.(uint64)
+	delete(l.at, p)
+	return p
+}
+func (l *LRUReplacer) Resident() []uint64 {
+	var out []uint64
+	for e := l.order.Front(); e != nil; e = e.Next() {
+		out = append(out, e.Value.(uint64))
+	}
+	return out
+}
+
+// ClockReplacer approximates LRU: frames sit on a circle, each with a use
+// bit set on every reference; the hand sweeps, clearing set bits, and
+// evicts the first page whose bit is already clear.
+type ClockReplacer struct {
+	frames []uint64
+	use    []bool
+	slot   map[uint64]int
+	hand   int
+	free   int // the slot the last eviction emptied, or -1
+}
+
+func NewClock() *ClockReplacer { return &ClockReplacer{slot: map[uint64]int{}, free: -1} }
+
+func (c *ClockReplacer) Name() string           { return "CLOCK" }
+func (c *ClockReplacer) Hit(page uint64, t int) { c.use[c.slot[page]] = true }
+func (c *ClockReplacer) Add(page uint64, t int) {
+	// Refill the slot the last eviction emptied, or grow the circle
+	if c.free >= 0 {
+		c.frames[c.free], c.use[c.free], c.slot[page] = page, true, c.free
+		c.free = -1
+		return
+	}
+	c.slot[page] = len(c.frames)
+	c.frames = append(c.frames, page)
+	c.use = append(c.use, true)
+}
+func (c *ClockReplacer) Victim(t int) uint64 {
+	for c.use[c.hand] {
+		c.use[c.hand] = false
+		c.hand = (c.hand + 1) % len(c.frames)
+	}
+	p := c.frames[c.hand]
+	delete(c.slot, p)
+	c.free = c.hand
+	c.hand = (c.hand + 1) % len(c.frames)
+	return p
+}
+
+// Resident lists the pages from the one after the hand round to the one
+// under it, so the next victim (if no use bits are set) comes last.
+func (c *ClockReplacer) Resident() []uint64 {
+	var out []uint64
+	for i := range c.frames {
+		out = append(out, c.frames[(c.hand+1+i)%len(c.frames)])
+	}
+	return out
+}
+
+// RandomReplacer evicts a resident page at random.
+type RandomReplacer struct {
+	pages []uint64
+	rng   *rand.Rand
+}
+
+func NewRandom(seed int64) *RandomReplacer {
+	return &RandomReplacer{rng: rand.New(rand.NewSource(seed))}
+}
+
+func (r *RandomReplacer) Name() string           { return "RAND" }
+func (r *RandomReplacer) Hit(page uint64, t int) {}
+func (r *RandomReplacer) Add(page uint64, t int) { r.pages = append(r.pages, page) }
+func (r *RandomReplacer) Victim(t int) uint64 {
+	i := r.rng.Intn(len(r.pages))
+	p := r.pages[i]
+	r.pages[i] = r.pages[len(r.pages)-1]
+	r.pages = r.pages[:len(r.pages)-1]
+	return p
+}
+func (r *RandomReplacer) Resident() []uint64 { return append([]uint64(nil), r.pages...) }
+
+// OPTReplacer is Belady's optimal policy: it knows the whole reference
+// string and evicts the page whose next use is furthest in the future
+// (or never comes). No policy can fault less, so it is the yardstick.
+type OPTReplacer struct {
+	next     []int          // next[t]: position of the next reference to refs[t]'s page
+	nextUse  map[uint64]int // resident page -> its next reference
+	resident []uint64
+}
+
+// never is the next use of a page that is not referenced again.
+const never = int(^uint(0) >> 1)
+
+func NewOPT(refs []PageRef) *OPTReplacer {
+	o := &OPTReplacer{next: make([]int, len(refs)), nextUse: map[uint64]int{}}
+	last := map[uint64]int{}
+	for t := len(refs) - 1; t >= 0; t-- {
+		o.next[t] = never
+		if n, ok := last[refs[t].Page]; ok {
+			o.next[t] = n
+		}
+		last[refs[t].Page] = t
+	}
+	return o
+}
+
+func (o *OPTReplacer) Name() string           { return "OPT" }
+func (o *OPTReplacer) Hit(page uint64, t int) { o.nextUse[page] = o.next[t] }
+func (o *OPTReplacer) Add(page uint64, t int) {
+	o.nextUse[page] = o.next[t]
+	o.resident = append(o.resident, page)
+}
+func (o *OPTReplacer) Victim(t int) uint64 {
+	far := 0
+	for i, p := range o.resident {
+		if o.nextUse[p] > o.nextUse[o.resident[far]] {
+			far = i
+		}
+	}
+	p := o.resident[far]
+	o.resident = append(o.resident[:far], o.resident[far+1:]...)
+	delete(o.nextUse, p)
+	return p
+}
+func (o *OPTReplacer) Resident() []uint64 { return append([]uint64(nil), o.resident...) }
+
+// NewReplacer returns the named policy: fifo, lru, clock, random, or opt
+// (which needs refs, the string it will be run on).
+func NewReplacer(name string, refs []PageRef, seed int64) (Replacer, error) {
+	switch name {
+	case "fifo":
+		return &FIFOReplacer{}, nil
+	case "lru":
+		return NewLRU(), nil
+	case "clock":
+		return NewClock(), nil
+	case "random":
+		return NewRandom(seed), nil
+	case "opt":
+		return NewOPT(refs), nil
+	default:
+		return nil, fmt.Errorf("unknown replacement policy %q (use fifo, lru, clock, random, or opt)", name)
+	}
+}
+
+// Replacers lists the names NewReplacer accepts.
+var Replacers = []string{"fifo", "lru", "clock", "random", "opt"}
+
+// PageStep is what happened on one reference.
+type PageStep struct {
+	PageRef
+	Hit      bool
+	Evicted  uint64
+	Evict    bool // a page was evicted
+	Dirty    bool // ...and it had to be written back to swap
+	Resident []uint64
+}
+
+// PagingResult is a reference string run through one policy.
+type PagingResult struct {
+	Policy     string
+	Frames     int
+	Refs       int
+	Hits       int
+	Cold       int // compulsory misses: first reference to a page
+	Faults     int // all misses, cold included
+	Evictions  int
+	Writebacks int        // dirty pages written to swap on eviction
+	Steps      []PageStep // only when recorded
+}
+
+// HitRate is hits / references.
+func (r PagingResult) HitRate() float64 {
+	if r.Refs == 0 {
+		return 0
+	}
+	return float64(r.Hits) / float64(r.Refs)
+}
+
+// RunPaging plays refs through policy p with the given number of page
+// frames. A miss loads the page into a free frame or, once memory is full,
+// into the frame of the page p evicts; evicting a page written since it was
+// loaded costs a writeback to swap. With record set, every step is kept.
+func RunPaging(refs []PageRef, frames int, p Replacer, record bool) (PagingResult, error) {
+	return runPaging(refs, frames, p, record, nil)
+}
+
+// runPaging is RunPaging, calling fault (if not nil) on every miss once
+// the victim, if any, is chosen.
+func runPaging(refs []PageRef, frames int, p Replacer, record bool, fault func(PageStep) error) (PagingResult, error) {
+	if frames < 1 {
+		return PagingResult{}, fmt.Errorf("need at least 1 page frame, got %d", frames)
+	}
+	res := PagingResult{Policy: p.Name(), Frames: frames, Refs: len(refs)}
+	dirty := map[uint64]bool{} // resident pages, and whether each is dirty
+	seen := map[uint64]bool{}
+	for t, ref := range refs {
+		step := PageStep{PageRef: ref}
+		if _, ok := dirty[ref.Page]; ok {
+			res.Hits++
+			step.Hit = true
+			p.Hit(ref.Page, t)
+		} else {
+			res.Faults++
+			if !seen[ref.Page] {
+				res.Cold++
+				seen[ref.Page] = true
+			}
+			if len(dirty) == frames {
+				v := p.Victim(t)
+				res.Evictions++
+				step.Evict, step.Evicted, step.Dirty = true, v, dirty[v]
+				if dirty[v] {
+					res.Writebacks++
+				}
+				delete(dirty, v)
+			}
+			if fault != nil {
+				if err := fault(step); err != nil {
+					return res, err
+				}
+			}
+			dirty[ref.Page] = false
+			p.Add(ref.Page, t)
+		}
+		if ref.Write {
+			dirty[ref.Page] = true
+		}
+		if record {
+			step.Resident = p.Resident()
+			res.Steps = append(res.Steps, step)
+		}
+	}
+	return res, nil
+}
+
+// Format renders the recorded steps in the style of OSTEP's
+// paging-policy.py, then the totals.
+func (r PagingResult) Format() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s with %d frame(s)\n", r.Policy, r.Frames)
+	hits, misses := 0, 0
+	for _, s := range r.Steps {
+		kind, op := "MISS", ""
+		if s.Hit {
+			kind = "HIT "
+			hits++
+		} else {
+			misses++
+		}
+		if s.Write {
+			op = "w"
+		}
+		evicted := "-"
+		if s.Evict {
+			evicted = fmt.Sprint(s.Evicted)
+			if s.Dirty {
+				evicted += " (written back)"
+			}
+		}
+		fmt.Fprintf(&b, "  Access: %4d%-1s %s  %-24s Replaced: %-18s [Hits:%d Misses:%d]\n", s.Page, op, kind, fmt.Sprint(s.Resident), evicted, hits, misses)
+	}
+	fmt.Fprintf(&b, "  refs=%d hits=%d faults=%d (cold %d) hit rate=%.2f%% evictions=%d writebacks=%d\n",
+		r.Refs, r.Hits, r.Faults, r.Cold, 100*r.HitRate(), r.Evictions, r.Writebacks)
+	return b.String()
+}
+
+// reversed returns a reversed copy of s.
+func reversed(s []uint64) []uint64 {
+	out := make([]uint64, len(s))
+	for i, v := range s {
+		out[len(s)-1-i] = v
+	}
+	return out
+}
@@ -0,0 +1,180 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// BaseBounds is dynamic relocation with one base and bounds register pair:
+// the whole address space is one contiguous block of physical memory
+// starting at Base, and any address at or past Bounds faults.
+type BaseBounds struct {
+	Base, Bounds uint64
+}
+
+func (t BaseBounds) Name() string {
+	return fmt.Sprintf("base-bounds(base=%#x bounds=%d)", t.Base, t.Bounds)
+}
+
+func (t BaseBounds) Translate(va uint64, op Op) (uint64, int, error) {
+	if va >= t.Bounds {
+		return 0, 0, ErrBounds
+	}
+	return t.Base + va, 0, nil
+}
+
+func (t BaseBounds) Regions() []Region {
+	return []Region{{Name: "space", Base: t.Base, Size: t.Bounds, Prot: ProtAll}}
+}
+
+// Segment is one segment's base/bounds pair. For a segment that grows up,
+// Base is its lowest physical address; for one that grows down (a stack),
+// Base is one past its highest, as in OSTEP's segmentation chapter.
+type Segment struct {
+	Name string
+	Base uint64
+	Size uint64 // the bounds: how far the segment extends from Base
+	Down bool
+	Prot Prot
+}
+
+// Segmentation splits the address space into equal parts by its top bits,
+// one per segment (two bits for code, heap and stack, like OSTEP), each
+// with its own base, bounds, growth direction, and protection.
+type Segmentation struct {
+	segs    []Segment
+	segBits uint
+	maxSeg  uint64 // size of each segment's share of the address space
+}
+
+// NewSegmentation builds a segmented translator for an address space of
+// asize bytes (a power of two).
+func NewSegmentation(asize uint64, segs []Segment) (*Segmentation, error) {
+	if len(segs) == 0 {
+		return nil, errors.New("segmentation needs at least one segment")
+	}
+	if !pow2(asize) {
+		return nil, fmt.Errorf("address space size must be a power of two, got %d", asize)
+	}
+	s := &Segmentation{segs: segs, segBits: uint(bits.Len(uint(len(segs) - 1)))}
+	s.maxSeg = asize >> s.segBits
+	if s.maxSeg == 0 {
+		return nil, fmt.Errorf("a %d-byte address space is too small for %d segments", asize, len(segs))
+	}
+	for _, sg := range segs {
+		if sg.Size > s.maxSeg {
+			return nil, fmt.Errorf("segment %s: size %d exceeds its %d-byte share of the address space", sg.Name, sg.Size, s.maxSeg)
+		}
+		if sg.Down && sg.Size > sg.Base {
+			return nil, fmt.Errorf("segment %s: a downward segment of %d bytes needs a base of at least %d", sg.Name, sg.Size, sg.Size)
+		}
+	}
+	return s, nil
+}
+
+func (s *Segmentation) Name() string {
+	names := make([]string, len(s.segs))
+	for i, sg := range s.segs {
+		names[i] = sg.Name
+	}
+	return fmt.Sprintf("segmentation(%s, %d segment bit(s))", strings.Join(names, "/"), s.segBits)
+}
+
+func (s *Segmentation) Translate(va uint64, op Op) (uint64, int, error) {
+	i := int(va / s.maxSeg)
+	if i >= len(s.segs) {
+		return 0, -1, ErrBounds // no segment behind these top bits
+	}
+	sg := s.segs[i]
+	offset := va % s.maxSeg
+	var pa uint64
+	if sg.Down {
+		// Negative offset from the top of the segment's share
+		neg := s.maxSeg - offset
+		if neg > sg.Size {
+			return 0, i, ErrBounds
+		}
+		pa = sg.Base - neg
+	} else {
+		if offset >= sg.Size {
+			return 0, i, ErrBounds
+		}
+		pa = sg.Base + offset
+	}
+	if !sg.Prot.Allows(op) {
+		return 0, i, ErrProtection
+	}
+	return pa, i, nil
+}
+
+func (s *Segmentation) Regions() []Region {
+	rs := make([]Region, len(s.segs))
+	for i, sg := range s.segs {
+		base := sg.Base
+		if sg.Down {
+			base -= sg.Size
+		}
+		rs[i] = Region{Name: sg.Name, Base: base, Size: sg.Size, Down: sg.Down, Prot: sg.Prot}
+	}
+	return rs
+}
+
+// Virtual returns the part of the virtual address space each segment
+// covers (Base is a virtual address), e.g. to map the same layout with a
+// PageTable. Unused segments are left out.
+func (s *Segmentation) Virtual() []Region {
+	var rs []Region
+	for i, sg := range s.segs {
+		if sg.Size == 0 {
+			continue
+		}
+		base := uint64(i) * s.maxSeg
+		if sg.Down {
+			base += s.maxSeg - sg.Size
+		}
+		rs = append(rs, Region{Name: sg.Name, Base: base, Size: sg.Size, Down: sg.Down, Prot: sg.Prot})
+	}
+	return rs
+}
+
+// ParseSegments parses a list like "code@32k+2k:r-x,heap@34k+3k:rw-,stack@28k-2k:rw-":
+// name@base+size for a segment that grows up, name@base-size for one that
+// grows down, and optional permissions (default rw-). A bare "-" leaves a
+// segment number unused, e.g. to put the stack in the top quarter.
+func ParseSegments(list string) ([]Segment, error) {
+	var segs []Segment
+	for _, f := range strings.Split(list, ",") {
+		f = strings.TrimSpace(f)
+		if f == "-" {
+			segs = append(segs, Segment{Name: "-"}) // unused: every address in it faults
+			continue
+		}
+		name, rest, ok := strings.Cut(f, "@")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("bad segment %q (want name@base+size[:prot] or name@base-size[:prot])", f)
+		}
+		sg := Segment{Name: name, Prot: ProtRead | ProtWrite}
+		f, prot, hasProt := strings.Cut(rest, ":")
+		if hasProt {
+			var err error
+			if sg.Prot, err = ParseProt(prot); err != nil {
+				return nil, fmt.Errorf("segment %s: %v", name, err)
+			}
+		}
+		sep := strings.IndexAny(f, "+-")
+		if sep < 0 {
+			return nil, fmt.Errorf("segment %s: want base+size or base-size, got %q", name, f)
+		}
+		sg.Down = f[sep] == '-'
+		var err1, err2 error
+		sg.Base, err1 = ParseSize(f[:sep])
+		sg.Size, err2 = ParseSize(f[sep+1:])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("segment %s: bad base or size in %q", name, f)
+		}
+		segs = append(segs, sg)
+	}
+	return segs, nil
+}
@@ -0,0 +1,153 @@
+package vm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"example.com/operating-systems/HW7/raid"
+)
+
+// Swap is the backing store of demand paging: a fault reads the page in
+// from it, and evicting a dirty page writes the page out to it first.
+// Each call returns how long the I/O took.
+type Swap interface {
+	Name() string
+	PageIn(page uint64) (time.Duration, error)
+	PageOut(page uint64) (time.Duration, error)
+}
+
+// SimSwap is a simulated swap device with fixed costs per page.
+type SimSwap struct {
+	In, Out time.Duration
+}
+
+func (s SimSwap) Name() string                               { return fmt.Sprintf("simulated disk (%v in, %v out)", s.In, s.Out) }
+func (s SimSwap) PageIn(page uint64) (time.Duration, error)  { return s.In, nil }
+func (s SimSwap) PageOut(page uint64) (time.Duration, error) { return s.Out, nil }
+
+// DiskSwap keeps pages in blocks of a raid.Disk (one page per
+// raid.BlockSize block), so every page-in and page-out is a real, timed
+// read or synced write of the disk file. A page gets the next free block
+// the first time it is seen; each written block is stamped with its page
+// number, which a later page-in checks.
+type DiskSwap struct {
+	disk    *raid.Disk
+	slot    map[uint64]int
+	written map[uint64]bool
+	buf     []byte
+}
+
+// NewDiskSwap uses disk as the swap device.
+func NewDiskSwap(disk *raid.Disk) *DiskSwap {
+	return &DiskSwap{disk: disk, slot: map[uint64]int{}, written: map[uint64]bool{}, buf: make([]byte, raid.BlockSize)}
+}
+
+func (s *DiskSwap) Name() string {
+	return fmt.Sprintf("raid.Disk (%d-byte blocks)", raid.BlockSize)
+}
+
+// block returns page's block, handing out the next one if it has none.
+func (s *DiskSwap) block(page uint64) int {
+	b, ok := s.slot[page]
+	if !ok {
+		b = len(s.slot)
+		s.slot[page] = b
+	}
+	return b
+}
+
+func (s *DiskSwap) PageIn(page uint64) (time.Duration, error) {
+	start := time.Now()
+	data, err := s.disk.ReadBlock(s.block(page))
+	took := time.Since(start)
+	// Past the end of the file is a block never written: a zero page
+	if err != nil && !errors.Is(err, io.EOF) {
+		return took, err
+	}
+	if s.written[page] {
+		if got := binary.LittleEndian.Uint64(data); got != page {
+			return took, fmt.Errorf("swap block %d holds page %d, want page %d", s.slot[page], got, page)
+		}
+	}
+	return took, nil
+}
+
+func (s *DiskSwap) PageOut(page uint64) (time.Duration, error) {
+	for i := range s.buf {
+		s.buf[i] = byte(page)
+	}
+	binary.LittleEndian.PutUint64(s.buf, page)
+	start := time.Now()
+	err := s.disk.WriteBlock(s.block(page), s.buf)
+	took := time.Since(start)
+	if err != nil {
+		return took, err
+	}
+	s.written[page] = true
+	return took, nil
+}
+
+// DemandResult is a PagingResult with the swap traffic behind it.
+type DemandResult struct {
+	PagingResult
+	Swap            string
+	PageIns         int
+	PageOuts        int
+	InTime, OutTime time.Duration
+}
+
+// FaultRate is faults / references.
+func (r DemandResult) FaultRate() float64 { return 1 - r.HitRate() }
+
+// EffectiveAccessTime is the average time per reference in ns: a memory
+// access each, plus the swap time spent on the faults spread over all of
+// them, i.e. (1-p)*mem + p*(mem + fault service time) for fault rate p.
+func (r DemandResult) EffectiveAccessTime(mem float64) float64 {
+	if r.Refs == 0 {
+		return 0
+	}
+	return mem + float64(r.InTime+r.OutTime)/float64(r.Refs)
+}
+
+// ServiceTime is the average time to service a fault: its page-in, plus
+// the page-out of a dirty victim when there was one.
+func (r DemandResult) ServiceTime() time.Duration {
+	if r.Faults == 0 {
+		return 0
+	}
+	return (r.InTime + r.OutTime) / time.Duration(r.Faults)
+}
+
+// RunDemand is RunPaging with every page living on swap: a fault pages
+// the victim out if it is dirty and the faulting page in, timing both.
+func RunDemand(refs []PageRef, frames int, p Replacer, swap Swap, record bool) (DemandResult, error) {
+	res := DemandResult{Swap: swap.Name()}
+	pr, err := runPaging(refs, frames, p, record, func(s PageStep) error {
+		if s.Dirty {
+			d, err := swap.PageOut(s.Evicted)
+			if err != nil {
+				return fmt.Errorf("paging out %d: %v", s.Evicted, err)
+			}
+			res.PageOuts++
+			res.OutTime += d
+		}
+		d, err := swap.PageIn(s.Page)
+		if err != nil {
+			return fmt.Errorf("paging in %d: %v", s.Page, err)
+		}
+		res.PageIns++
+		res.InTime += d
+		return nil
+	})
+	res.PagingResult = pr
+	return res, err
+}
+
+// Format is PagingResult.Format with the swap traffic.
+func (r DemandResult) Format(mem float64) string {
+	return r.PagingResult.Format() + fmt.Sprintf("  swap %s: %d page-ins (%v), %d page-outs (%v), %v per fault, EAT %.1f ns\n",
+		r.Swap, r.PageIns, r.InTime, r.PageOuts, r.OutTime, r.ServiceTime(), r.EffectiveAccessTime(mem))
+}
@@ -0,0 +1,175 @@
+package vm
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Switcher is implemented by translators with several address spaces;
+// Run calls Switch whenever the trace moves to another one.
+type Switcher interface {
+	Switch(asid int) error
+}
+
+// Cached is implemented by translators with a TLB in front.
+type Cached interface {
+	CacheStats() CacheStats
+}
+
+// CacheStats counts TLB lookups.
+type CacheStats struct {
+	Hits, Misses int
+	Evictions    int // valid entries replaced
+	Flushes      int // whole-TLB flushes on a context switch (no ASIDs)
+}
+
+// HitRate is hits / lookups, or 0 before any lookup.
+func (c CacheStats) HitRate() float64 {
+	if c.Hits+c.Misses == 0 {
+		return 0
+	}
+	return float64(c.Hits) / float64(c.Hits+c.Misses)
+}
+
+// TLBConfig shapes a TLB.
+type TLBConfig struct {
+	Entries int
+	Ways    int    // associativity: entries per set (Entries = fully associative)
+	Policy  string // replacement within a set: "lru" or "random"
+	NoASID  bool   // entries aren't tagged, so every context switch flushes the TLB
+	Seed    int64  // for random replacement
+}
+
+// tlbEntry caches one translation.
+type tlbEntry struct {
+	valid   bool
+	asid    int
+	vpn     uint64
+	pfn     uint64
+	prot    Prot
+	lastUse int
+}
+
+// TLB is a translation lookaside buffer in front of a PageTable. A VPN
+// maps to set vpn % sets; a hit costs no page-table reads, a miss walks
+// the page table and caches the result, evicting the least recently used
+// (or a random) entry of the set when it is full. Entries are tagged with
+// the address space (ASID), so a context switch keeps them unless NoASID.
+type TLB struct {
+	cfg   TLBConfig
+	pt    *PageTable
+	sets  [][]tlbEntry
+	asid  int
+	clock int // lookups so far, for LRU
+	rng   *rand.Rand
+	walk  int
+	stats CacheStats
+}
+
+// NewTLB puts a TLB in front of pt.
+func NewTLB(pt *PageTable, cfg TLBConfig) (*TLB, error) {
+	if cfg.Ways == 0 {
+		cfg.Ways = cfg.Entries
+	}
+	switch {
+	case cfg.Entries < 1 || cfg.Ways < 1 || cfg.Entries%cfg.Ways != 0:
+		return nil, fmt.Errorf("a TLB needs at least 1 entry and a way count dividing it, got %d entries, %d ways", cfg.Entries, cfg.Ways)
+	case cfg.Policy != "lru" && cfg.Policy != "random":
+		return nil, fmt.Errorf("unknown TLB replacement policy %q (use lru or random)", cfg.Policy)
+	}
+	t := &TLB{cfg: cfg, pt: pt, rng: rand.New(rand.NewSource(cfg.Seed))}
+	t.sets = make([][]tlbEntry, cfg.Entries/cfg.Ways)
+	for i := range t.sets {
+		t.sets[i] = make([]tlbEntry, cfg.Ways)
+	}
+	return t, nil
+}
+
+func (t *TLB) Name() string {
+	assoc := fmt.Sprintf("%d-way", t.cfg.Ways)
+	if t.cfg.Ways == t.cfg.Entries {
+		assoc = "fully associative"
+	}
+	asid := "asid"
+	if t.cfg.NoASID {
+		asid = "flush on switch"
+	}
+	return fmt.Sprintf("TLB(%d entries, %s, %s, %s) over a %d-level page table", t.cfg.Entries, assoc, t.cfg.Policy, asid, t.pt.cfg.Levels)
+}
+
+func (t *TLB) Translate(va uint64, op Op) (uint64, int, error) {
+	ps := t.pt.PageSize()
+	vpn := va / ps
+	set := t.sets[vpn%uint64(len(t.sets))]
+	t.clock++
+	t.walk = 0
+	for i := range set {
+		e := &set[i]
+		if e.valid && e.vpn == vpn && e.asid == t.asid {
+			t.stats.Hits++
+			e.lastUse = t.clock
+			if !e.prot.Allows(op) {
+				return 0, t.pt.region(va), ErrProtection
+			}
+			return e.pfn*ps + va%ps, t.pt.region(va), nil
+		}
+	}
+
+	t.stats.Misses++
+	e, reads, err := t.pt.lookup(vpn)
+	t.walk = reads
+	if err != nil {
+		return 0, t.pt.region(va), err
+	}
+	victim := t.victim(set)
+	if set[victim].valid {
+		t.stats.Evictions++
+	}
+	set[victim] = tlbEntry{valid: true, asid: t.asid, vpn: vpn, pfn: e.pfn, prot: e.prot, lastUse: t.clock}
+	if !e.prot.Allows(op) {
+		return 0, t.pt.region(va), ErrProtection
+	}
+	return e.pfn*ps + va%ps, t.pt.region(va), nil
+}
+
+// victim picks the entry of set to replace: a free one if there is one,
+// else by the replacement policy.
+func (t *TLB) victim(set []tlbEntry) int {
+	for i, e := range set {
+		if !e.valid {
+			return i
+		}
+	}
+	if t.cfg.Policy == "random" {
+		return t.rng.Intn(len(set))
+	}
+	lru := 0
+	for i, e := range set {
+		if e.lastUse < set[lru].lastUse {
+			lru = i
+		}
+	}
+	return lru
+}
+
+// Switch changes the running address space, flushing the TLB if its
+// entries aren't tagged with ASIDs.
+func (t *TLB) Switch(asid int) error {
+	if err := t.pt.Switch(asid); err != nil {
+		return err
+	}
+	if asid != t.asid && t.cfg.NoASID {
+		for _, set := range t.sets {
+			clear(set)
+		}
+		t.stats.Flushes++
+	}
+	t.asid = asid
+	return nil
+}
+
+func (t *TLB) Regions() []Region               { return t.pt.Regions() }
+func (t *TLB) LastWalk() int                   { return t.walk }
+func (t *TLB) PageSize() uint64                { return t.pt.PageSize() }
+func (t *TLB) Frames() (data, table, free int) { return t.pt.Frames() }
+func (t *TLB) CacheStats() CacheStats          { return t.stats }
@@ -0,0 +1,201 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// ParseTrace reads an address trace, one access per line: an address
+// (decimal, or hex with 0x), optionally preceded by r, w, or x for a
+// read, write, or instruction fetch (default r), and before that by @N
+// for an access from address space N (default 0). Blank lines and text
+// after '#' are ignored.
+func ParseTrace(r io.Reader) ([]Access, error) {
+	var out []Access
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		f := strings.Fields(text)
+		if len(f) == 0 {
+			continue
+		}
+		a := Access{Op: Read}
+		if strings.HasPrefix(f[0], "@") {
+			asid, err := strconv.Atoi(f[0][1:])
+			if err != nil || asid < 0 {
+				return nil, fmt.Errorf("line %d: bad address space %q", line, f[0])
+			}
+			a.ASID, f = asid, f[1:]
+		}
+		if len(f) == 2 {
+			switch f[0] {
+			case "r", "R":
+			case "w", "W":
+				a.Op = Write
+			case "x", "X":
+				a.Op = Exec
+			default:
+				return nil, fmt.Errorf("line %d: access type must be r, w, or x, got %q", line, f[0])
+			}
+			f = f[1:]
+		}
+		if len(f) != 1 {
+			return nil, fmt.Errorf("line %d: want \"[@asid] [r|w|x] address\", got %q", line, sc.Text())
+		}
+		addr, err := strconv.ParseUint(f[0], 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad address %q", line, f[0])
+		}
+		a.Addr = addr
+		out = append(out, a)
+	}
+	return out, sc.Err()
+}
+
+// RandomTrace returns n accesses to uniformly random addresses below
+// asize, a fraction writes of them writes, the same for the same seed
+// (like the OSTEP simulators' -s and -n).
+func RandomTrace(n int, asize uint64, writes float64, seed int64) []Access {
+	r := rand.New(rand.NewSource(seed))
+	out := make([]Access, n)
+	for i := range out {
+		out[i].Addr = uint64(r.Int63n(int64(asize)))
+		if r.Float64() < writes {
+			out[i].Op = Write
+		}
+	}
+	return out
+}
+
+// RegionTrace is RandomTrace with every address drawn from one of regions
+// (virtual extents, e.g. Segmentation.Virtual), weighted by size, so the
+// accesses hit mapped memory. Writes to read-only regions become reads and
+// accesses to executable ones become instruction fetches.
+func RegionTrace(n int, regions []Region, writes float64, seed int64) []Access {
+	var total uint64
+	for _, rg := range regions {
+		total += rg.Size
+	}
+	if total == 0 {
+		return nil
+	}
+	r := rand.New(rand.NewSource(seed))
+	out := make([]Access, n)
+	for i := range out {
+		at := uint64(r.Int63n(int64(total)))
+		for _, rg := range regions {
+			if at < rg.Size {
+				out[i] = Access{Op: opFor(rg, writes, r), Addr: rg.Base + at}
+				break
+			}
+			at -= rg.Size
+		}
+	}
+	return out
+}
+
+// opFor picks the kind of access a region allows: fetches from code,
+// otherwise a write with probability writes if the region is writable.
+func opFor(rg Region, writes float64, r *rand.Rand) Op {
+	switch {
+	case rg.Prot.Allows(Exec):
+		return Exec
+	case rg.Prot.Allows(Write) && r.Float64() < writes:
+		return Write
+	}
+	return Read
+}
+
+// SeqTrace sweeps through regions in order, stride bytes at a time,
+// starting over when it reaches the end: an array scan, the best case
+// for a TLB since every page is used many times in a row.
+func SeqTrace(n int, regions []Region, stride uint64, writes float64, seed int64) []Access {
+	var live []Region
+	for _, rg := range regions {
+		if rg.Size > 0 {
+			live = append(live, rg)
+		}
+	}
+	if len(live) == 0 || stride == 0 {
+		return nil
+	}
+	r := rand.New(rand.NewSource(seed))
+	out := make([]Access, n)
+	ri, off := 0, uint64(0)
+	for i := range out {
+		rg := live[ri]
+		out[i] = Access{Op: opFor(rg, writes, r), Addr: rg.Base + off}
+		if off += stride; off >= rg.Size {
+			ri, off = (ri+1)%len(live), 0
+		}
+	}
+	return out
+}
+
+// HotTrace is the 80-20 workload: a fraction hotProb of the accesses go to
+// a hot set of hotPages (a fraction) of the mapped pages, the rest to any
+// mapped page, at a random offset.
+func HotTrace(n int, regions []Region, pageSize uint64, hotPages, hotProb, writes float64, seed int64) []Access {
+	type page struct {
+		base, size uint64
+		rg         Region
+	}
+	var pages []page
+	for _, rg := range regions {
+		for at := rg.Base; at < rg.Base+rg.Size; at = (at/pageSize + 1) * pageSize {
+			end := min((at/pageSize+1)*pageSize, rg.Base+rg.Size)
+			pages = append(pages, page{at, end - at, rg})
+		}
+	}
+	if len(pages) == 0 {
+		return nil
+	}
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(pages), func(i, j int) { pages[i], pages[j] = pages[j], pages[i] })
+	hot := max(int(float64(len(pages))*hotPages), 1)
+	out := make([]Access, n)
+	for i := range out {
+		pg := pages[r.Intn(len(pages))]
+		if r.Float64() < hotProb {
+			pg = pages[r.Intn(hot)]
+		}
+		out[i] = Access{Op: opFor(pg.rg, writes, r), Addr: pg.base + uint64(r.Int63n(int64(pg.size)))}
+	}
+	return out
+}
+
+// Interleave spreads accesses over procs address spaces, round robin,
+// quantum accesses at a time: each process runs the same program, and
+// every change of ASID is a context switch.
+func Interleave(accesses []Access, procs, quantum int) {
+	if procs < 2 || quantum < 1 {
+		return
+	}
+	for i := range accesses {
+		accesses[i].ASID = i / quantum % procs
+	}
+}
+
+// ParseSize parses a byte count or address: decimal, 0x hex, or with a
+// k, m, or g suffix (powers of 1024), e.g. "16k" or "0x3000".
+func ParseSize(s string) (uint64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	mult := uint64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		mult, s = 1<<10, s[:len(s)-1]
+	case strings.HasSuffix(s, "m"):
+		mult, s = 1<<20, s[:len(s)-1]
+	case strings.HasSuffix(s, "g"):
+		mult, s = 1<<30, s[:len(s)-1]
+	}
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return v * mult, nil
+}
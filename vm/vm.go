@@ -0,0 +1,396 @@
+// Package vm simulates virtual memory address translation. A Translator
+// (base and bounds, segmentation, or a multi-level page table) maps each
+// virtual address of an access stream to a physical one or faults, and Run
+// reports the translations, the faults, how much of each segment was used,
+// how fragmented physical memory is, and what translating cost in memory
+// reads, in the style of the OSTEP relocation, segmentation, and paging
+// homework simulators.
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Faults a translation can raise.
+var (
+	ErrBounds     = errors.New("segmentation violation: address out of bounds")
+	ErrProtection = errors.New("protection fault")
+)
+
+// Op is the kind of memory access.
+type Op uint8
+
+const (
+	Read Op = iota
+	Write
+	Exec // instruction fetch
+)
+
+func (o Op) String() string { return [...]string{"r", "w", "x"}[o] }
+
+// Prot is a set of access permissions.
+type Prot uint8
+
+const (
+	ProtRead Prot = 1 << iota
+	ProtWrite
+	ProtExec
+	ProtAll = ProtRead | ProtWrite | ProtExec
+)
+
+// Allows reports whether op is permitted.
+func (p Prot) Allows(op Op) bool { return p&(1<<op) != 0 }
+
+func (p Prot) String() string {
+	b := []byte("---")
+	for i, c := range "rwx" {
+		if p&(1<<i) != 0 {
+			b[i] = byte(c)
+		}
+	}
+	return string(b)
+}
+
+// ParseProt parses permissions like "rw" or "r-x".
+func ParseProt(s string) (Prot, error) {
+	var p Prot
+	for _, c := range s {
+		switch c {
+		case 'r':
+			p |= ProtRead
+		case 'w':
+			p |= ProtWrite
+		case 'x':
+			p |= ProtExec
+		case '-':
+		default:
+			return 0, fmt.Errorf("bad protection %q (use letters from rwx)", s)
+		}
+	}
+	return p, nil
+}
+
+// Access is one memory reference of a trace.
+type Access struct {
+	Op   Op
+	Addr uint64 // virtual address
+	ASID int    // address space (process) making it
+}
+
+// Region is a stretch of memory a Translator maps: a segment, or the whole
+// address space under base and bounds. For a Paged translator it is a
+// stretch of the virtual address space instead.
+type Region struct {
+	Name string
+	Base uint64 // lowest physical (or, paged, virtual) address
+	Size uint64
+	Down bool // grows toward lower addresses (a stack)
+	Prot Prot
+}
+
+// Translator maps virtual addresses to physical ones.
+type Translator interface {
+	Name() string
+	// Translate returns the physical address of va, and the index in
+	// Regions of the region it fell in (-1 if none), or a fault.
+	Translate(va uint64, op Op) (pa uint64, region int, err error)
+	// Regions lists the physical memory the translator maps.
+	Regions() []Region
+}
+
+// Translation is what happened to one access.
+type Translation struct {
+	Access
+	Phys   uint64
+	Region int // -1 if the address fell in no region
+	Fault  error
+	Walk   int // page-table reads it took (Walker translators)
+}
+
+// RegionUsage is one region's share of a run.
+type RegionUsage struct {
+	Region
+	Allocated uint64 // physical bytes behind it (Size rounded up to whole pages when paged)
+	Accesses  int
+	Faults    int
+	Touched   uint64 // bytes of the region accessed, in lineSize units
+}
+
+// Hole is a free stretch of physical memory.
+type Hole struct{ Base, Size uint64 }
+
+// Result is a finished run.
+type Result struct {
+	Translator   string
+	AddressSpace uint64 // virtual address space size
+	PhysMem      uint64
+	Translations []Translation
+	Faults       map[error]int // by kind
+	Regions      []RegionUsage
+	Holes        []Hole // free physical memory, in address order (not paged)
+
+	// Walker translators
+	Walks bool
+	Reads int // page-table reads over the whole run
+
+	Switches int         // context switches between address spaces
+	TLB      *CacheStats // Cached translators
+
+	// Paged translators
+	PageSize                            uint64
+	DataFrames, TableFrames, FreeFrames int
+}
+
+// lineSize is the granularity at which Run records which bytes of a
+// region were touched, for the internal fragmentation estimate.
+const lineSize = 64
+
+// Run translates every access under t. asize is the virtual address space
+// size (addresses at or past it are rejected); phys is the physical memory
+// size, which t's regions must fit in without overlapping.
+func Run(t Translator, asize, phys uint64, accesses []Access) (Result, error) {
+	regions := t.Regions()
+	paged, isPaged := t.(Paged)
+	walker, walks := t.(Walker)
+	if !isPaged {
+		if err := checkLayout(regions, phys); err != nil {
+			return Result{}, err
+		}
+	}
+	res := Result{Translator: t.Name(), AddressSpace: asize, PhysMem: phys, Faults: map[error]int{}, Walks: walks}
+	switcher, _ := t.(Switcher)
+	asid := 0
+	if switcher != nil {
+		if err := switcher.Switch(0); err != nil {
+			return Result{}, err
+		}
+	}
+	res.Regions = make([]RegionUsage, len(regions))
+	touched := make([]map[uint64]bool, len(regions))
+	for i, r := range regions {
+		res.Regions[i].Region = r
+		res.Regions[i].Allocated = r.Size
+		if isPaged {
+			ps := paged.PageSize()
+			res.Regions[i].Allocated = (r.Base+r.Size+ps-1)/ps*ps - r.Base/ps*ps
+		}
+		touched[i] = map[uint64]bool{}
+	}
+	for _, a := range accesses {
+		if a.Addr >= asize {
+			return Result{}, fmt.Errorf("virtual address %#x is outside the %d-byte address space", a.Addr, asize)
+		}
+		if a.ASID != asid {
+			if switcher == nil {
+				return Result{}, fmt.Errorf("%s has a single address space, the trace uses ASID %d", t.Name(), a.ASID)
+			}
+			if err := switcher.Switch(a.ASID); err != nil {
+				return Result{}, err
+			}
+			asid = a.ASID
+			res.Switches++
+		}
+		pa, ri, err := t.Translate(a.Addr, a.Op)
+		tr := Translation{Access: a, Phys: pa, Region: ri, Fault: err}
+		if walks {
+			tr.Walk = walker.LastWalk()
+			res.Reads += tr.Walk
+		}
+		res.Translations = append(res.Translations, tr)
+		if ri >= 0 {
+			res.Regions[ri].Accesses++
+		}
+		if err != nil {
+			res.Faults[err]++
+			if ri >= 0 {
+				res.Regions[ri].Faults++
+			}
+			continue
+		}
+		touched[ri][pa/lineSize] = true
+	}
+	for i := range regions {
+		res.Regions[i].Touched = min(uint64(len(touched[i]))*lineSize, res.Regions[i].Allocated)
+	}
+	if c, ok := t.(Cached); ok {
+		st := c.CacheStats()
+		res.TLB = &st
+	}
+	if isPaged {
+		res.PageSize = paged.PageSize()
+		res.DataFrames, res.TableFrames, res.FreeFrames = paged.Frames()
+	} else {
+		res.Holes = holes(regions, phys)
+	}
+	return res, nil
+}
+
+// checkLayout makes sure the regions fit in physical memory and don't overlap.
+func checkLayout(regions []Region, phys uint64) error {
+	rs := append([]Region(nil), regions...)
+	sort.Slice(rs, func(a, b int) bool { return rs[a].Base < rs[b].Base })
+	for i, r := range rs {
+		if r.Base+r.Size > phys {
+			return fmt.Errorf("%s [%#x, %#x) does not fit in %d bytes of physical memory", r.Name, r.Base, r.Base+r.Size, phys)
+		}
+		if i > 0 && rs[i-1].Base+rs[i-1].Size > r.Base {
+			return fmt.Errorf("%s and %s overlap in physical memory", rs[i-1].Name, r.Name)
+		}
+	}
+	return nil
+}
+
+// holes returns the free stretches of physical memory around the regions.
+func holes(regions []Region, phys uint64) []Hole {
+	rs := append([]Region(nil), regions...)
+	sort.Slice(rs, func(a, b int) bool { return rs[a].Base < rs[b].Base })
+	var out []Hole
+	at := uint64(0)
+	for _, r := range rs {
+		if r.Base > at {
+			out = append(out, Hole{at, r.Base - at})
+		}
+		at = max(at, r.Base+r.Size)
+	}
+	if at < phys {
+		out = append(out, Hole{at, phys - at})
+	}
+	return out
+}
+
+// Fragmentation summarizes the run's memory use: allocated is the physical
+// memory the regions take, touched the part of it the trace used (the rest
+// is internal fragmentation), free the memory left over, and external the
+// share of free memory outside the largest hole (1 - largest/free: 0 when
+// it is all in one piece, near 1 when it is scattered in small holes).
+// Paged, free memory is the free frames, and any frame fits any page, so
+// external fragmentation is 0.
+func (r Result) Fragmentation() (allocated, touched, free uint64, external float64) {
+	for _, u := range r.Regions {
+		allocated += u.Allocated
+		touched += u.Touched
+	}
+	if r.PageSize > 0 {
+		return allocated, touched, uint64(r.FreeFrames) * r.PageSize, 0
+	}
+	var largest uint64
+	for _, h := range r.Holes {
+		free += h.Size
+		largest = max(largest, h.Size)
+	}
+	if free > 0 {
+		external = 1 - float64(largest)/float64(free)
+	}
+	return allocated, touched, free, external
+}
+
+// Format renders the whole result: every access and what it translated
+// to, then the Summary.
+func (r Result) Format() string {
+	var b strings.Builder
+	b.WriteString(r.header())
+	for i, t := range r.Translations {
+		fmt.Fprintf(&b, "  VA %2d: %s %#08x (%6d) --> ", i, t.Op, t.Addr, t.Addr)
+		switch {
+		case t.Fault != nil && t.Region >= 0:
+			fmt.Fprintf(&b, "%s [%s]", strings.ToUpper(t.Fault.Error()), r.Regions[t.Region].Name)
+		case t.Fault != nil:
+			fmt.Fprintf(&b, "%s", strings.ToUpper(t.Fault.Error()))
+		default:
+			fmt.Fprintf(&b, "VALID: %#08x (%6d) [%s]", t.Phys, t.Phys, r.Regions[t.Region].Name)
+		}
+		if r.Walks {
+			fmt.Fprintf(&b, "  walk=%d", t.Walk)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(r.summary())
+	return b.String()
+}
+
+// Summary renders the faults, per-region usage, and fragmentation.
+func (r Result) Summary() string {
+	return r.header() + r.summary()
+}
+
+func (r Result) header() string {
+	return fmt.Sprintf("%s  (address space %d bytes, physical memory %d bytes)\n", r.Translator, r.AddressSpace, r.PhysMem)
+}
+
+func (r Result) summary() string {
+	var b strings.Builder
+	faults := 0
+	for _, n := range r.Faults {
+		faults += n
+	}
+	fmt.Fprintf(&b, "  accesses=%d faults=%d", len(r.Translations), faults)
+	for _, f := range []error{ErrBounds, ErrInvalid, ErrProtection} {
+		if r.Faults[f] > 0 {
+			fmt.Fprintf(&b, " (%v: %d)", f, r.Faults[f])
+		}
+	}
+	b.WriteString("\n")
+
+	fmt.Fprintf(&b, "  %-8s %10s %8s %5s %4s %9s %7s %10s %6s\n", "region", "base", "size", "grows", "prot", "accesses", "faults", "touched", "used")
+	for _, u := range r.Regions {
+		dir := "up"
+		if u.Down {
+			dir = "down"
+		}
+		fmt.Fprintf(&b, "  %-8s %#10x %8d %5s %4s %9d %7d %10d %5.1f%%\n", u.Name, u.Base, u.Size, dir, u.Prot, u.Accesses, u.Faults, u.Touched, pct(u.Touched, u.Allocated))
+	}
+	alloc, touched, free, ext := r.Fragmentation()
+	fmt.Fprintf(&b, "  internal fragmentation: %d of %d allocated bytes never touched (%.1f%%)\n", alloc-touched, alloc, pct(alloc-touched, alloc))
+	if r.PageSize > 0 {
+		fmt.Fprintf(&b, "  frames: %d data + %d page table (%d bytes of table) + %d free, no external fragmentation\n",
+			r.DataFrames, r.TableFrames, uint64(r.TableFrames)*r.PageSize, r.FreeFrames)
+	} else {
+		fmt.Fprintf(&b, "  external fragmentation: %d bytes free in %d hole(s), %.1f%% outside the largest\n", free, len(r.Holes), 100*ext)
+	}
+	if r.Switches > 0 {
+		fmt.Fprintf(&b, "  context switches: %d\n", r.Switches)
+	}
+	if r.TLB != nil {
+		fmt.Fprintf(&b, "  tlb: %d hits, %d misses (hit rate %.1f%%), %d evictions, %d flushes\n",
+			r.TLB.Hits, r.TLB.Misses, 100*r.TLB.HitRate(), r.TLB.Evictions, r.TLB.Flushes)
+	}
+	if r.Walks && len(r.Translations) > 0 {
+		n := float64(len(r.Translations))
+		data := float64(len(r.Translations) - faults) // faulting accesses never reach memory
+		fmt.Fprintf(&b, "  translation overhead: %.2f page-table reads per access, %.2f memory accesses per access counting the data\n",
+			float64(r.Reads)/n, (float64(r.Reads)+data)/n)
+	}
+	return b.String()
+}
+
+// EffectiveAccessTime is the average time per access given the time of a
+// TLB lookup and of a memory access: the lookup (if there is a TLB), the
+// page-table reads, and the data access itself (faults never get that far).
+func (r Result) EffectiveAccessTime(tlb, mem float64) float64 {
+	if len(r.Translations) == 0 {
+		return 0
+	}
+	reads := r.Reads
+	for _, t := range r.Translations {
+		if t.Fault == nil {
+			reads++
+		}
+	}
+	n := float64(len(r.Translations))
+	eat := float64(reads) / n * mem
+	if r.TLB != nil {
+		eat += tlb
+	}
+	return eat
+}
+
+// pct is n as a percentage of total, or 0 if total is 0.
+func pct(n, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}